@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/omec-project/gnbsim/util/ngapTestpacket"
+	"github.com/omec-project/gnbsim/util/test"
+
+	"git.cs.nctu.edu.tw/calee/sctp"
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapConvert"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+// Identity of the loopback AMF, sent to the gNBs in the NG Setup Response
+const (
+	LOOPBACK_AMF_NAME   string = "bench-amf"
+	LOOPBACK_AMF_ID     string = "cafe00"
+	LOOPBACK_AMF_RELCAP int64  = 255
+)
+
+// Identity of the gNBs and the UEs, and of the network served by the
+// loopback AMF
+var (
+	benchPlmn   = models.PlmnId{Mcc: "208", Mnc: "93"}
+	benchSnssai = models.Snssai{Sst: 1, Sd: "010203"}
+)
+
+// Length of the buffer into which the NGAP messages are read
+const MAX_NGAP_MSG_LEN int = 2048
+
+// loopbackAmf is an SCTP server on the loopback address standing in for the
+// AMF. It completes NG Setup with the gNBs and answers each Uplink NAS
+// Transport with a Downlink NAS Transport carrying the same NAS PDU, so that
+// the messages of the UEs make the round trip through the gNB
+type loopbackAmf struct {
+	listener *sctp.SCTPListener
+	port     int
+
+	// Encoded once, the same response is sent to all the gNBs
+	ngSetupResp []byte
+}
+
+func startLoopbackAmf() (*loopbackAmf, error) {
+	ngSetupResp, err := getNgSetupResponse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ng setup response: %v", err)
+	}
+
+	addr := &sctp.SCTPAddr{
+		IPAddrs: []net.IPAddr{{IP: net.ParseIP(LOOPBACK)}},
+	}
+	listener, err := sctp.ListenSCTP("sctp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on sctp: %v", err)
+	}
+
+	amf := &loopbackAmf{
+		listener:    listener,
+		port:        listener.Addr().(*sctp.SCTPAddr).Port,
+		ngSetupResp: ngSetupResp,
+	}
+	go func() {
+		for {
+			conn, err := listener.AcceptSCTP()
+			if err != nil {
+				return
+			}
+			go amf.serve(conn)
+		}
+	}()
+	return amf, nil
+}
+
+func (a *loopbackAmf) Close() {
+	a.listener.Close()
+}
+
+// serve answers the messages received on the association until it is closed
+func (a *loopbackAmf) serve(conn *sctp.SCTPConn) {
+	defer conn.Close()
+	buf := make([]byte, MAX_NGAP_MSG_LEN)
+	for {
+		n, _, _, err := conn.SCTPRead(buf)
+		if err != nil {
+			return
+		}
+		if n == 0 {
+			continue
+		}
+		rsp, err := a.answer(buf[:n])
+		if err != nil || rsp == nil {
+			continue
+		}
+		_, err = conn.Write(rsp)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// answer returns the response to the NGAP message, nil if none is due
+func (a *loopbackAmf) answer(msg []byte) ([]byte, error) {
+	pdu, err := ngap.Decoder(msg)
+	if err != nil {
+		return nil, err
+	}
+	initiatingMessage := pdu.InitiatingMessage
+	if initiatingMessage == nil {
+		return nil, nil
+	}
+
+	switch initiatingMessage.ProcedureCode.Value {
+	case ngapType.ProcedureCodeNGSetup:
+		return a.ngSetupResp, nil
+	case ngapType.ProcedureCodeUplinkNASTransport:
+		ranUeNgapId, nasPdu := getUplinkNasTransportIes(
+			initiatingMessage.Value.UplinkNASTransport)
+		if nasPdu == nil {
+			return nil, fmt.Errorf("nas pdu not received in uplink nas transport")
+		}
+		// AMF UE NGAP ID is that of the RAN, the UE is not tracked
+		return test.GetDownlinkNASTransport(ranUeNgapId, ranUeNgapId, nasPdu)
+	}
+	return nil, nil
+}
+
+// getNgSetupResponse encodes the NG Setup Response, serving the PLMN and the
+// slice of the gNBs
+func getNgSetupResponse() ([]byte, error) {
+	plmnId := ngapConvert.PlmnIdToNgap(benchPlmn)
+
+	guami := ngapType.ServedGUAMIItem{}
+	guami.GUAMI.PLMNIdentity = plmnId
+	regionId, setId, ptrId := ngapConvert.AmfIdToNgap(LOOPBACK_AMF_ID)
+	guami.GUAMI.AMFRegionID.Value = regionId
+	guami.GUAMI.AMFSetID.Value = setId
+	guami.GUAMI.AMFPointer.Value = ptrId
+
+	plmn := ngapType.PLMNSupportItem{}
+	plmn.PLMNIdentity = plmnId
+	plmn.SliceSupportList.List = []ngapType.SliceSupportItem{
+		{SNSSAI: ngapConvert.SNssaiToNgap(benchSnssai)},
+	}
+
+	pdu := ngapTestpacket.BuildNGSetupResponse(LOOPBACK_AMF_NAME,
+		[]ngapType.ServedGUAMIItem{guami}, []ngapType.PLMNSupportItem{plmn},
+		LOOPBACK_AMF_RELCAP)
+	return ngap.Encoder(pdu)
+}
+
+// getUplinkNasTransportIes returns the RAN UE NGAP ID and the NAS PDU of the
+// Uplink NAS Transport, the NAS PDU is nil if not found
+func getUplinkNasTransportIes(msg *ngapType.UplinkNASTransport) (int64, []byte) {
+	if msg == nil {
+		return 0, nil
+	}
+	var ranUeNgapId int64
+	var nasPdu []byte
+	for _, ie := range msg.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			if ie.Value.RANUENGAPID != nil {
+				ranUeNgapId = ie.Value.RANUENGAPID.Value
+			}
+		case ngapType.ProtocolIEIDNASPDU:
+			if ie.Value.NASPDU != nil {
+				nasPdu = ie.Value.NASPDU.Value
+			}
+		}
+	}
+	return ranUeNgapId, nasPdu
+}
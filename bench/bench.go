@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package bench measures the limits of the simulator itself without a core,
+// so that the bottlenecks of gnbsim may be told apart from those of the core
+// under test. The gNBs and the SimUes of the simulator are driven against a
+// loopback AMF answering the NAS PDUs of the UEs, and a UDP echo server
+// standing in for the UPF
+package bench
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/gnodeb/idrange"
+	"github.com/omec-project/gnbsim/logger"
+)
+
+// Defaults of the benchmark options
+const (
+	DEFAULT_DURATION      time.Duration = 5 * time.Second
+	DEFAULT_STEP_DURATION time.Duration = 2 * time.Second
+	DEFAULT_GNBS          int           = 4
+	DEFAULT_MAX_UES       int           = 4096
+	DEFAULT_LATENCY_LIMIT time.Duration = 10 * time.Millisecond
+	DEFAULT_PAYLOAD_SIZE  int           = 64
+	DEFAULT_N3_BATCH_SIZE int           = 64
+)
+
+// Largest number of UEs of a step of the UE ramp, the UEs being served by a
+// gNB allocating their RAN UE NGAP IDs within its ID range
+const MAX_UES int = 1<<(idrange.MAX_ID_BITS-idrange.MAX_RANGE_BITS) - 1
+
+// Loopback address on which the loopback AMF and the echo server listen
+const LOOPBACK string = "127.0.0.1"
+
+// Time allowed for the echoes in flight to be received once the senders stop
+const ECHO_DRAIN_TIME time.Duration = 200 * time.Millisecond
+
+// Options of the benchmark
+type Options struct {
+	// Duration of the NGAP and GTP-U rate measurements
+	Duration time.Duration
+
+	// Duration of each step of the UE ramp
+	StepDuration time.Duration
+
+	// Number of UEs sending NGAP messages concurrently, served by a single
+	// gNB over its association, and then by as many gNBs, each with its
+	// association
+	Gnbs int
+
+	// Upper limit of the UE ramp, the number of UEs is doubled at each step
+	MaxUes int
+
+	// Round trip time at the 99th percentile beyond which the latency of the
+	// UEs is considered degraded
+	LatencyLimit time.Duration
+
+	// Size of the user data carried by each G-PDU
+	PayloadSize int
+
+	// GTP-U packets read and written per system call by the gNB, measured
+	// along with the packets read and written one at a time. Not measured
+	// when set to 1
+	N3BatchSize int
+}
+
+// Report is the result of the benchmark
+type Report struct {
+	// UEs sharing the association of a single gNB, and served by a gNB each
+	NgapShared *NgapRate
+	NgapPerGnb *NgapRate
+
+	// Steps of the UE ramp, the last one degraded unless MaxUes is reached
+	UeSteps []*UeStep
+
+	// Largest number of concurrent SimUes whose latency is not degraded, 0
+	// if degraded with a single SimUe
+	MaxSimUes int
+
+	// Packets read and written one at a time, followed by the packets read
+	// and written in batches when measured
+	Gtpu []*GtpuRate
+}
+
+// Validate checks the options, setting the defaults of those not provided
+func (o *Options) Validate() error {
+	if o.Duration == 0 {
+		o.Duration = DEFAULT_DURATION
+	}
+	if o.StepDuration == 0 {
+		o.StepDuration = DEFAULT_STEP_DURATION
+	}
+	if o.Gnbs == 0 {
+		o.Gnbs = DEFAULT_GNBS
+	}
+	if o.MaxUes == 0 {
+		o.MaxUes = DEFAULT_MAX_UES
+	}
+	if o.LatencyLimit == 0 {
+		o.LatencyLimit = DEFAULT_LATENCY_LIMIT
+	}
+	if o.PayloadSize == 0 {
+		o.PayloadSize = DEFAULT_PAYLOAD_SIZE
+	}
+	if o.N3BatchSize == 0 {
+		o.N3BatchSize = DEFAULT_N3_BATCH_SIZE
+	}
+	if o.Gnbs < 0 || o.MaxUes < 0 || o.PayloadSize < 0 || o.N3BatchSize < 0 {
+		return fmt.Errorf("gnbs, max ues, payload size and n3 batch size must be positive")
+	}
+	if o.MaxUes > MAX_UES {
+		return fmt.Errorf("max ues exceeds %v", MAX_UES)
+	}
+	return nil
+}
+
+// Run executes the benchmark: the NGAP message rate of the UEs of a single
+// gNB and of as many gNBs, the SimUe ramp and the GTP-U packet rate
+func Run(opts *Options) (*Report, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+	quietLogs()
+
+	amf, err := startLoopbackAmf()
+	if err != nil {
+		return nil, err
+	}
+	defer amf.Close()
+
+	gnbs := make([]*gnbctx.GNodeB, opts.Gnbs)
+	defer func() { closeGnbs(gnbs) }()
+	for i := range gnbs {
+		gnbs[i], err = newBenchGnb(i+1, amf.port, 0)
+		if err != nil {
+			gnbs = gnbs[:i]
+			return nil, err
+		}
+	}
+
+	report := &Report{}
+	logger.AppLog.Infof("Measuring NGAP message rate, %v UEs served by a gNB",
+		opts.Gnbs)
+	report.NgapShared, err = benchNgapRate(gnbs[:1], opts.Gnbs, opts.Duration)
+	if err != nil {
+		return nil, err
+	}
+	logger.AppLog.Infof("Measuring NGAP message rate, %v UEs served by a gNB each",
+		opts.Gnbs)
+	report.NgapPerGnb, err = benchNgapRate(gnbs, 1, opts.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	for ues := 1; ; ues *= 2 {
+		if ues > opts.MaxUes {
+			ues = opts.MaxUes
+		}
+		logger.AppLog.Infoln("Measuring NGAP round trip time,", ues, "concurrent SimUes")
+		step, err := benchUeStep(gnbs[0], ues, opts.StepDuration)
+		if err != nil {
+			return nil, err
+		}
+		report.UeSteps = append(report.UeSteps, step)
+		step.Degraded = step.P99 > opts.LatencyLimit || step.Timeouts != 0
+		if step.Degraded {
+			break
+		}
+		report.MaxSimUes = ues
+		if ues == opts.MaxUes {
+			break
+		}
+	}
+
+	logger.AppLog.Infoln("Measuring GTP-U packet rate")
+	rate, err := benchGtpu(gnbs[0], opts.PayloadSize, opts.Duration)
+	if err != nil {
+		return nil, err
+	}
+	report.Gtpu = append(report.Gtpu, rate)
+	if opts.N3BatchSize > 1 {
+		logger.AppLog.Infoln("Measuring GTP-U packet rate, batches of",
+			opts.N3BatchSize, "packets")
+		gnb, err := newBenchGnb(opts.Gnbs+1, amf.port, opts.N3BatchSize)
+		if err != nil {
+			return nil, err
+		}
+		gnbs = append(gnbs, gnb)
+		rate, err = benchGtpu(gnb, opts.PayloadSize, opts.Duration)
+		if err != nil {
+			return nil, err
+		}
+		report.Gtpu = append(report.Gtpu, rate)
+	}
+	return report, nil
+}
+
+// quietLogs limits the logs of the gNBs and the UEs to the errors, so that
+// the logging does not weigh on the measurements
+func quietLogs() {
+	for _, module := range []string{logger.MODULE_GNB, logger.MODULE_GTPU,
+		logger.MODULE_NAS, logger.MODULE_NGAP, logger.MODULE_SIMUE} {
+		err := logger.SetModuleLogLevel(module, "error")
+		if err != nil {
+			logger.AppLog.Errorln("Failed to set log level of module", module, ":", err)
+		}
+	}
+}
+
+// Print writes the report in a human readable form
+func (r *Report) Print(w io.Writer, opts *Options) {
+	fmt.Fprintln(w, "NGAP encode+send (Uplink NAS Transport of the UEs):")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "   gNBs\tUEs\tSent/s\tEchoed/s")
+	for _, rate := range []*NgapRate{r.NgapShared, r.NgapPerGnb} {
+		fmt.Fprintf(tw, "   %v\t%v\t%.0f\t%.0f\n", rate.Gnbs, rate.Ues,
+			rate.SentRate, rate.EchoRate)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "Concurrent SimUes (NGAP round trip through a gNB):")
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "   SimUes\tRound Trips/s\tP50\tP99\tTimeouts\tStale\t")
+	for _, step := range r.UeSteps {
+		mark := ""
+		if step.Degraded {
+			mark = "DEGRADED"
+		}
+		fmt.Fprintf(tw, "   %v\t%.0f\t%v\t%v\t%v\t%v\t%v\n", step.Ues, step.Rate,
+			step.P50, step.P99, step.Timeouts, step.Stale, mark)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "   Max concurrent SimUes within %v P99: %v\n", opts.LatencyLimit,
+		r.MaxSimUes)
+
+	fmt.Fprintf(w, "GTP-U (%v octet payload):\n", opts.PayloadSize)
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "   Batch Size\tSent pps\tEchoed pps\tLoss\tSend Errors")
+	for _, g := range r.Gtpu {
+		batch := "-"
+		if g.BatchSize > 1 {
+			batch = fmt.Sprint(g.BatchSize)
+		}
+		fmt.Fprintf(tw, "   %v\t%.0f\t%.0f\t%.2f%%\t%v\n", batch, g.SentRate,
+			g.EchoRate, g.Loss, g.SendErrors)
+	}
+	tw.Flush()
+}
+
+// percentile expects the provided list to be sorted in ascending order
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := (len(sorted)*p+99)/100 - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+// sortDurations sorts the durations in ascending order
+func sortDurations(d []time.Duration) {
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/gnodeb"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	"github.com/omec-project/gnbsim/simue"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+
+	"github.com/omec-project/openapi/models"
+)
+
+// Tracking area of the gNBs
+const BENCH_TAC string = "000001"
+
+// Length of the NAS PDU sent by the UEs, that of a typical protected NAS
+// message. It starts with the sequence number of the message, by which the
+// UE matches the echo with the message
+const NAS_PDU_LEN int = 64
+
+// newBenchGnb initializes a gNB connected to the loopback AMF, through the
+// same code path as the configured gNBs: the association with the AMF, NG
+// Setup, and the user plane transport batching the GTP-U packets as per the
+// batch size
+func newBenchGnb(id, amfPort, n3BatchSize int) (*gnbctx.GNodeB, error) {
+	plmn := benchPlmn
+	gnb := &gnbctx.GNodeB{
+		GnbName: fmt.Sprintf("bench-gnb-%v", id),
+		GnbN2Ip: LOOPBACK,
+		GnbN3Ip: LOOPBACK,
+		RanId: models.GlobalRanNodeId{
+			PlmnId: &plmn,
+			GNbId:  &models.GNbId{BitLength: 24, GNBValue: fmt.Sprintf("%06x", id)},
+		},
+		SupportedTaList: []gnbctx.SupportedTA{{
+			Tac: BENCH_TAC,
+			BroadcastPLMNList: []gnbctx.BroadcastPLMNItem{{
+				PlmnId:              benchPlmn,
+				TaiSliceSupportList: []models.Snssai{benchSnssai},
+			}},
+		}},
+		DefaultAmf:  gnbctx.NewGnbAmf(LOOPBACK, amfPort),
+		N3BatchSize: n3BatchSize,
+	}
+	err := gnodeb.Init(gnb)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize %v: %v", gnb.GnbName, err)
+	}
+	return gnb, nil
+}
+
+// closeGnbs closes the associations of the gNBs with the loopback AMF. The
+// user plane sockets remain open, their receive routines run for the
+// lifetime of the process
+func closeGnbs(gnbs []*gnbctx.GNodeB) {
+	for _, gnb := range gnbs {
+		for _, amf := range gnb.GetAmfs() {
+			if amf.Conn != nil {
+				amf.Conn.Close()
+			}
+		}
+	}
+}
+
+// newBenchUes connects the SimUes to the gNB, each served by a gNB UE context
+// and its routine as in a profile run. The SimUes are driven by the
+// benchmark in place of the SimUe and RealUe routines, exchanging the NAS
+// PDUs with the gNB UE contexts as the RealUes do
+func newBenchUes(gnb *gnbctx.GNodeB, count int) ([]*simuectx.SimUe, error) {
+	plmn, snssai := benchPlmn, benchSnssai
+	profile := &profctx.Profile{
+		Name:   "bench",
+		Key:    "5122250214c33e723a5dd523fc145fc0",
+		Opc:    "981d464c7c52eb6e5036234984ad0bcf",
+		SeqNum: "16f3b3f70fc2",
+		Plmn:   &plmn,
+		SNssai: &snssai,
+	}
+
+	ues := make([]*simuectx.SimUe, 0, count)
+	for i := 0; i < count; i++ {
+		ue := simuectx.NewSimUe(fmt.Sprintf("imsi-20893%010d", i), gnb, profile)
+		err := simue.ConnectToGnb(ue)
+		if err != nil {
+			releaseBenchUes(ues)
+			return nil, fmt.Errorf("failed to connect ue to %v: %v", gnb.GnbName, err)
+		}
+		ues = append(ues, ue)
+	}
+	return ues, nil
+}
+
+// releaseBenchUes terminates the gNB UE contexts of the SimUes, once the
+// messages in flight are drained
+func releaseBenchUes(ues []*simuectx.SimUe) {
+	var wg sync.WaitGroup
+	for _, ue := range ues {
+		wg.Add(1)
+		go func(ue *simuectx.SimUe) {
+			defer wg.Done()
+			drainUe(ue)
+			msg := &common.DefaultMessage{}
+			msg.Event = common.QUIT_EVENT
+			ue.WriteGnbUeChan <- msg
+		}(ue)
+	}
+	wg.Wait()
+}
+
+// drainUe discards the messages sent by the gNB UE context to the SimUe,
+// until none is received for ECHO_DRAIN_TIME
+func drainUe(ue *simuectx.SimUe) {
+	timer := time.NewTimer(ECHO_DRAIN_TIME)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ue.ReadChan:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(ECHO_DRAIN_TIME)
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// newUlInfoTransfer returns the NAS PDU carrying the sequence number, sent
+// by the SimUe to the gNB UE context as the RealUe does
+func newUlInfoTransfer(seq uint64) *common.UuMessage {
+	nasPdu := make([]byte, NAS_PDU_LEN)
+	binary.BigEndian.PutUint64(nasPdu, seq)
+	msg := &common.UuMessage{}
+	msg.Event = common.UL_INFO_TRANSFER_EVENT
+	msg.NasPdus = common.NasPduList{nasPdu}
+	return msg
+}
+
+// getEchoSeq returns the sequence number of the NAS PDU echoed by the
+// loopback AMF and forwarded by the gNB UE context, false if the message is
+// not an echo
+func getEchoSeq(msg common.InterfaceMessage) (uint64, bool) {
+	if msg.GetEventType() != common.DL_INFO_TRANSFER_EVENT {
+		return 0, false
+	}
+	uemsg, ok := msg.(*common.UuMessage)
+	if !ok || len(uemsg.NasPdus) == 0 || len(uemsg.NasPdus[0]) < 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(uemsg.NasPdus[0]), true
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/util/test"
+)
+
+// Length of the buffer into which the G-PDUs are read
+const MAX_GTPU_PKT_LEN int = 65535
+
+// GtpuRate is the rate at which G-PDUs were encoded and sent
+type GtpuRate struct {
+	PayloadSize int
+
+	// Packets read and written per system call by the gNB, 0 when not
+	// batched
+	BatchSize int
+
+	Sent       uint64
+	Echoed     uint64
+	SendErrors uint64
+	SentRate   float64
+	EchoRate   float64
+
+	// Percentage of the G-PDUs sent which were not echoed
+	Loss float64
+}
+
+// benchGtpu measures the rate at which G-PDUs are encoded and sent by the
+// user plane transport of the gNB as fast as possible to a UDP echo server on
+// the loopback address, standing in for the UPF, and the rate at which the
+// echoed G-PDUs are received by the gNB and decoded. With batching, the
+// packets queued by the transport when the measurement ends are counted as
+// sent
+func benchGtpu(gnb *gnbctx.GNodeB, payloadSize int,
+	duration time.Duration) (*GtpuRate, error) {
+
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(LOOPBACK)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on udp: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, MAX_GTPU_PKT_LEN)
+		for {
+			n, addr, err := echo.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteToUDP(buf[:n], addr)
+		}
+	}()
+
+	// Packets received from the echo server are forwarded by the transport
+	// to the UPF context, which is read here in place of its worker
+	upf := gnbctx.NewGnbUpf(LOOPBACK)
+	if upf == nil {
+		return nil, fmt.Errorf("failed to create upf context")
+	}
+	upf.UpfAddr = echo.LocalAddr().(*net.UDPAddr)
+	gnb.GnbPeers.AddGnbUpf(LOOPBACK, upf)
+
+	rate := &GtpuRate{PayloadSize: payloadSize, BatchSize: gnb.N3BatchSize}
+	done := make(chan struct{})
+	recvDone := make(chan struct{})
+	go func() {
+		defer close(recvDone)
+		for {
+			select {
+			case msg := <-upf.ReadChan:
+				tMsg, ok := msg.(*common.TransportMessage)
+				if !ok {
+					continue
+				}
+				_, err := test.DecodeGTPv1Header(tMsg.RawPkt)
+				if err == nil {
+					rate.Echoed++
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	payload := make([]byte, payloadSize)
+	start := time.Now()
+	deadline := start.Add(duration)
+	for teid := uint32(1); time.Now().Before(deadline); teid++ {
+		// Packet is not modified once handed over to the transport
+		pkt, err := test.AppendGpduMessage(nil, payload, teid)
+		if err == nil {
+			err = gnb.UpTransport.SendToPeer(upf, pkt)
+		}
+		if err != nil {
+			rate.SendErrors++
+			continue
+		}
+		rate.Sent++
+	}
+	elapsed := time.Since(start)
+
+	time.Sleep(ECHO_DRAIN_TIME)
+	close(done)
+	<-recvDone
+
+	rate.SentRate = float64(rate.Sent) / elapsed.Seconds()
+	rate.EchoRate = float64(rate.Echoed) / elapsed.Seconds()
+	if rate.Sent != 0 && rate.Echoed < rate.Sent {
+		rate.Loss = float64(rate.Sent-rate.Echoed) * 100 / float64(rate.Sent)
+	}
+	return rate, nil
+}
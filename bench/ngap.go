@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// Time a UE waits for its message to be echoed before counting a timeout
+const UE_ECHO_TIMEOUT time.Duration = time.Second
+
+// NgapRate is the rate at which the gNBs encoded and sent the NGAP messages
+// of their UEs
+type NgapRate struct {
+	Gnbs     int
+	Ues      int
+	Sent     uint64
+	Echoed   uint64
+	SentRate float64
+	EchoRate float64
+}
+
+// UeStep is the NGAP round trip time of the SimUes at a step of the UE ramp
+type UeStep struct {
+	Ues        int
+	RoundTrips uint64
+	Timeouts   uint64
+
+	// Echoes received after the UE timed out waiting for them, discarded
+	Stale uint64
+
+	Rate     float64
+	P50      time.Duration
+	P99      time.Duration
+	Degraded bool
+}
+
+// benchNgapRate measures the rate at which the gNBs encode and send Uplink
+// NAS Transport messages, each gNB serving the provided number of UEs. The
+// UEs hand over NAS PDUs to their gNB UE contexts as fast as these take
+// them, the messages are counted as sent by the NGAP pacers of the gNBs
+func benchNgapRate(gnbs []*gnbctx.GNodeB, uesPerGnb int,
+	duration time.Duration) (*NgapRate, error) {
+
+	var ues []*simuectx.SimUe
+	for _, gnb := range gnbs {
+		gnbUes, err := newBenchUes(gnb, uesPerGnb)
+		if err != nil {
+			releaseBenchUes(ues)
+			return nil, err
+		}
+		ues = append(ues, gnbUes...)
+	}
+
+	// Messages sent before the measurement, NG Setup included, are skipped
+	cursors := make([]*gnbctx.NgapPacerCursor, len(gnbs))
+	for i, gnb := range gnbs {
+		cursors[i] = gnb.NgapPacer.NewCursor()
+		cursors[i].Sample()
+	}
+
+	rate := &NgapRate{Gnbs: len(gnbs), Ues: len(ues)}
+	start := time.Now()
+	deadline := start.Add(duration)
+	var wg sync.WaitGroup
+	for _, ue := range ues {
+		wg.Add(1)
+		go func(ue *simuectx.SimUe) {
+			defer wg.Done()
+			atomic.AddUint64(&rate.Echoed, floodUe(ue, deadline))
+		}(ue)
+	}
+
+	time.Sleep(time.Until(deadline))
+	for _, cursor := range cursors {
+		rate.Sent += cursor.Sample().IntvlSentCount
+	}
+	elapsed := time.Since(start)
+	wg.Wait()
+	releaseBenchUes(ues)
+
+	rate.SentRate = float64(rate.Sent) / elapsed.Seconds()
+	rate.EchoRate = float64(rate.Echoed) / elapsed.Seconds()
+	return rate, nil
+}
+
+// floodUe hands over NAS PDUs to the gNB UE context of the SimUe as fast as
+// it takes them until the deadline, and returns the number of echoes
+// received meanwhile
+func floodUe(ue *simuectx.SimUe, deadline time.Time) (echoed uint64) {
+	var seq uint64
+	msg := newUlInfoTransfer(seq)
+	for time.Now().Before(deadline) {
+		select {
+		case ue.WriteGnbUeChan <- msg:
+			seq++
+			msg = newUlInfoTransfer(seq)
+		case rsp := <-ue.ReadChan:
+			if _, ok := getEchoSeq(rsp); ok {
+				echoed++
+			}
+		}
+	}
+	return
+}
+
+// benchUeStep measures the NGAP round trip time of the SimUes served by the
+// gNB. Each SimUe sends a NAS PDU through its gNB UE context and waits for
+// the echo carrying the same sequence number, routed back by the gNB to the
+// UE context by its RAN UE NGAP ID. Echoes of the messages which timed out
+// are discarded
+func benchUeStep(gnb *gnbctx.GNodeB, ues int, duration time.Duration) (*UeStep, error) {
+	simUes, err := newBenchUes(gnb, ues)
+	if err != nil {
+		return nil, err
+	}
+
+	step := &UeStep{Ues: ues}
+	var lock sync.Mutex
+	var rtts []time.Duration
+
+	start := time.Now()
+	deadline := start.Add(duration)
+	var wg sync.WaitGroup
+	for _, ue := range simUes {
+		wg.Add(1)
+		go func(ue *simuectx.SimUe) {
+			defer wg.Done()
+			var ueRtts []time.Duration
+			var timeouts, stale uint64
+			timer := time.NewTimer(UE_ECHO_TIMEOUT)
+			defer timer.Stop()
+			for seq := uint64(1); time.Now().Before(deadline); seq++ {
+				sent := time.Now()
+				ue.WriteGnbUeChan <- newUlInfoTransfer(seq)
+
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(UE_ECHO_TIMEOUT)
+			wait:
+				for {
+					select {
+					case rsp := <-ue.ReadChan:
+						echoSeq, ok := getEchoSeq(rsp)
+						if !ok {
+							continue
+						}
+						if echoSeq != seq {
+							stale++
+							continue
+						}
+						ueRtts = append(ueRtts, time.Since(sent))
+						break wait
+					case <-timer.C:
+						timeouts++
+						break wait
+					}
+				}
+			}
+
+			lock.Lock()
+			rtts = append(rtts, ueRtts...)
+			step.Timeouts += timeouts
+			step.Stale += stale
+			lock.Unlock()
+		}(ue)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	releaseBenchUes(simUes)
+
+	sortDurations(rtts)
+	step.RoundTrips = uint64(len(rtts))
+	step.Rate = float64(step.RoundTrips) / elapsed.Seconds()
+	step.P50 = percentile(rtts, 50)
+	step.P99 = percentile(rtts, 99)
+	return step, nil
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// CallFlowMessage is a message of a recorded call flow. Only the protocol,
+// the direction and the name of the message are retained, the IE values vary
+// with the identities and the keys of the UE
+type CallFlowMessage struct {
+	Direction string `json:"direction"`
+	Protocol  string `json:"protocol"`
+	Message   string `json:"message"`
+}
+
+func (m CallFlowMessage) String() string {
+	return m.Protocol + " " + m.Direction + " " + m.Message
+}
+
+// CallFlow is the sequence of NAS and NGAP messages of a passing UE run,
+// recorded from the timeline of the UE
+type CallFlow struct {
+	Profile  string            `json:"profile"`
+	Supi     string            `json:"supi"`
+	Recorded time.Time         `json:"recorded"`
+	Messages []CallFlowMessage `json:"messages"`
+}
+
+// NewCallFlow returns the call flow of the timeline entries
+func NewCallFlow(profile, supi string, entries []TimelineEntry) *CallFlow {
+	flow := &CallFlow{
+		Profile:  profile,
+		Supi:     supi,
+		Recorded: time.Now(),
+		Messages: make([]CallFlowMessage, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		flow.Messages = append(flow.Messages, CallFlowMessage{
+			Direction: entry.Direction,
+			Protocol:  entry.Protocol,
+			Message:   entry.Message,
+		})
+	}
+	return flow
+}
+
+// ReadCallFlow reads a call flow recorded by WriteCallFlow
+func ReadCallFlow(path string) (*CallFlow, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read call flow file: %v", err)
+	}
+	flow := &CallFlow{}
+	err = json.Unmarshal(data, flow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode call flow file:%v, error:%v",
+			path, err)
+	}
+	if len(flow.Messages) == 0 {
+		return nil, fmt.Errorf("no message in call flow file:%v", path)
+	}
+	return flow, nil
+}
+
+// WriteCallFlow writes the call flow to the file as JSON
+func WriteCallFlow(path string, flow *CallFlow) error {
+	data, err := json.MarshalIndent(flow, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode call flow: %v", err)
+	}
+
+	// File is replaced at once so that it is never read partially written
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write call flow file: %v", err)
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return fmt.Errorf("failed to write call flow file: %v", err)
+	}
+	return nil
+}
+
+// Compare checks the call flow against the expected one. The NAS and the
+// NGAP messages are compared as separate sequences, as the order between a
+// NAS message and an NGAP message depends on the scheduling of the UE and the
+// gNB routines. Returns an error listing the differences, nil if none
+func (f *CallFlow) Compare(expected *CallFlow) error {
+	var diffs []string
+	for _, protocol := range []string{TIMELINE_PROTOCOL_NAS, TIMELINE_PROTOCOL_NGAP} {
+		diff := diffCallFlowMessages(protocol, expected.getMessages(protocol),
+			f.getMessages(protocol))
+		if diff != "" {
+			diffs = append(diffs, diff)
+		}
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("call flow differs from the recorded one: %v",
+		strings.Join(diffs, ", "))
+}
+
+// getMessages returns the messages of the protocol in the recorded order
+func (f *CallFlow) getMessages(protocol string) []CallFlowMessage {
+	var messages []CallFlowMessage
+	for _, message := range f.Messages {
+		if message.Protocol == protocol {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// diffCallFlowMessages returns the first difference between the expected and
+// the actual message sequences of the protocol, empty if none. The messages
+// following it are not compared, since a message missing or added shifts the
+// remaining ones
+func diffCallFlowMessages(protocol string, expected, actual []CallFlowMessage) string {
+	i := 0
+	for i < len(expected) && i < len(actual) && expected[i] == actual[i] {
+		i++
+	}
+	switch {
+	case i == len(expected) && i == len(actual):
+		return ""
+	case i == len(actual):
+		return fmt.Sprintf("%v message %v: expected %v, none received",
+			protocol, i+1, expected[i])
+	case i == len(expected):
+		return fmt.Sprintf("%v message %v: unexpected %v", protocol, i+1, actual[i])
+	}
+	return fmt.Sprintf("%v message %v: expected %v, received %v", protocol, i+1,
+		expected[i], actual[i])
+}
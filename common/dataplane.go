@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"sort"
+	"time"
+)
+
+// DataPlaneStats are the user plane KPIs measured by a UE over the user data
+// it generates. Throughput is computed over Duration, which is the time the
+// UE spends sending and receiving the user data
+type DataPlaneStats struct {
+	UlPkts  uint64
+	UlBytes uint64
+	DlPkts  uint64
+	DlBytes uint64
+
+	Duration time.Duration
+
+	// Round trip times of the ICMP echo requests, or of the TCP handshakes
+	Rtts []time.Duration
+
+	// Interarrival jitter of the round trip times, estimated as in RFC 3550
+	// Section 6.4.1
+	Jitter time.Duration
+}
+
+// Merge adds the stats of another burst or PDU session. The jitter is
+// averaged, weighted by the number of round trip times
+func (s *DataPlaneStats) Merge(o *DataPlaneStats) {
+	if o == nil {
+		return
+	}
+	if n := len(s.Rtts) + len(o.Rtts); n != 0 {
+		s.Jitter = (s.Jitter*time.Duration(len(s.Rtts)) +
+			o.Jitter*time.Duration(len(o.Rtts))) / time.Duration(n)
+	}
+	s.UlPkts += o.UlPkts
+	s.UlBytes += o.UlBytes
+	s.DlPkts += o.DlPkts
+	s.DlBytes += o.DlBytes
+	s.Duration += o.Duration
+	s.Rtts = append(s.Rtts, o.Rtts...)
+}
+
+// GetThroughput returns the uplink and downlink throughput in bits per second
+func (s *DataPlaneStats) GetThroughput() (ul float64, dl float64) {
+	if s.Duration <= 0 {
+		return 0, 0
+	}
+	secs := s.Duration.Seconds()
+	return float64(s.UlBytes) * 8 / secs, float64(s.DlBytes) * 8 / secs
+}
+
+// GetRttPercentiles returns the percentiles of the round trip times, in the
+// order of the provided percentiles. Zero is returned if no RTT is measured
+func (s *DataPlaneStats) GetRttPercentiles(percentiles ...int) []time.Duration {
+	values := make([]time.Duration, len(percentiles))
+	if len(s.Rtts) == 0 {
+		return values
+	}
+	sorted := make([]time.Duration, len(s.Rtts))
+	copy(sorted, s.Rtts)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	for i, p := range percentiles {
+		index := (len(sorted)*p+99)/100 - 1
+		if index < 0 {
+			index = 0
+		}
+		values[i] = sorted[index]
+	}
+	return values
+}
+
+// DataPlaneSummary are the user plane KPIs of a profile, aggregated over the
+// UEs which generated user data. Throughput is in bits per second over the
+// duration of the profile
+type DataPlaneSummary struct {
+	UeCount      int
+	UlPkts       uint64
+	UlBytes      uint64
+	DlPkts       uint64
+	DlBytes      uint64
+	UlThroughput float64
+	DlThroughput float64
+	RttP50       time.Duration
+	RttP90       time.Duration
+	RttP99       time.Duration
+	Jitter       time.Duration
+}
@@ -4,7 +4,11 @@
 
 package common
 
-import "github.com/omec-project/gnbsim/logger"
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/logger"
+)
 
 type EventType uint32
 
@@ -33,6 +37,41 @@ const (
 	PROFILE_START_EVENT EventType = PROFILE_SIMUE_EVENT + 1 + iota
 	PROFILE_PASS_EVENT
 	PROFILE_FAIL_EVENT
+
+	// Directs SimUe to execute a specific procedure, irrespective of the
+	// procedure list of the profile
+	EXECUTE_PROCEDURE_EVENT
+
+	// Directs SimUe to clean up its state in the network as the application
+	// is shutting down
+	SHUTDOWN_EVENT
+
+	// Raised within SimUe when the think time between the traffic bursts of
+	// a held PDU session expires
+	THINK_TIME_EXPIRY_EVENT
+
+	// Raised within SimUe when the next scripted mobility step of the UE is
+	// due
+	MOBILITY_STEP_EVENT
+
+	// Raised within SimUe when a NAS timer of the UE, such as T3510 or T3521,
+	// expires
+	NAS_TIMER_EXPIRY_EVENT
+
+	// Raised within SimUe once the gNB restarted by the UE is connected to
+	// the AMF again
+	GNB_RESTART_COMPLETE_EVENT
+
+	// Raised within SimUe once the backoff before the retry of the failed
+	// procedure expires
+	RETRY_PROCEDURE_EVENT
+
+	// Raised within SimUe once the wait before the next procedure expires
+	STEP_DELAY_EXPIRY_EVENT
+
+	// Queries the state of the UE, answered by SimUe and RealUe from their
+	// routines
+	UE_STATE_QUERY_EVENT
 )
 
 /* Events between SimUe and RealUE */
@@ -40,6 +79,24 @@ const (
 	DATA_PKT_GEN_REQUEST_EVENT EventType = SIMUE_REALUE_EVENT + 1 + iota
 	DATA_PKT_GEN_SUCCESS_EVENT
 	DATA_PKT_GEN_FAILURE_EVENT
+
+	// SimUe directs RealUe to send the mobile originated SMS, RealUe returns
+	// the generated NAS message using the same event and notifies
+	// MO_SMS_COMPLETE_EVENT once the SMSC acknowledges the SMS. RealUe
+	// acknowledges a mobile terminated SMS by itself and notifies
+	// MT_SMS_RECEIVED_EVENT. Other SMS messages generated by RealUe, such as
+	// CP-ACK, are returned using SMS_UL_TRANSPORT_EVENT
+	MO_SMS_REQUEST_EVENT
+	MO_SMS_COMPLETE_EVENT
+	MT_SMS_RECEIVED_EVENT
+	SMS_UL_TRANSPORT_EVENT
+
+	// RealUe notifies the setup of the PDU session whose user data is
+	// carried over NAS, in place of the data bearer setup. The UL NAS
+	// Transport carrying the uplink user data is returned using
+	// NAS_DATA_UL_TRANSPORT_EVENT
+	NAS_DATA_PATH_SETUP_EVENT
+	NAS_DATA_UL_TRANSPORT_EVENT
 )
 
 /* Events between UE and GNodeB (UU) */
@@ -66,6 +123,63 @@ const (
 	// SimUe commands gNB to trigger RAN Connection release which further
 	// triggers gNB initiated UE Context Release Request
 	TRIGGER_AN_RELEASE_EVENT
+
+	// SimUe commands gNB to respond to the next Initial Context Setup Request
+	// with Initial Context Setup Failure
+	TRIGGER_INITIAL_CTX_SETUP_FAILURE_EVENT
+
+	// SimUe commands gNB to move the UE to RRC Inactive state or to resume it
+	// back to RRC Connected state. gNB reports the transition to AMF through
+	// RRC Inactive Transition Report and acknowledges SimUe using
+	// RRC_INACTIVE_TRANSITION_REPORT_EVENT
+	TRIGGER_RRC_INACTIVE_TRANSITION_EVENT
+	TRIGGER_RRC_RESUME_EVENT
+	RRC_INACTIVE_TRANSITION_REPORT_EVENT
+
+	// Raised within gNB when the next scripted cell change of the UE is due
+	TRIGGER_CELL_CHANGE_EVENT
+
+	// SimUe commands gNB to move the UE to the target cell of a handover. The
+	// source gNB UE context hands over the UE to the target gNB UE context
+	// using XN_HANDOVER_REQUEST_EVENT or HANDOVER_EXECUTION_EVENT, as per the
+	// handover type. The target gNB UE context takes over the UE using
+	// HANDOVER_SWITCH_EVENT followed by the data bearer setup, and
+	// acknowledges SimUe using HANDOVER_COMPLETE_EVENT. HANDOVER_ABORTED_EVENT
+	// reports the N2 handover which is cancelled or fails the preparation as
+	// requested by SimUe, the UE then remains in the source cell
+	TRIGGER_HANDOVER_EVENT
+	XN_HANDOVER_REQUEST_EVENT
+	HANDOVER_EXECUTION_EVENT
+	HANDOVER_SWITCH_EVENT
+	HANDOVER_COMPLETE_EVENT
+	HANDOVER_FAILURE_EVENT
+	HANDOVER_ABORTED_EVENT
+
+	// gNB notifies SimUe once the network has modified the user plane
+	// resources of the PDU sessions of the UE through PDU Session Resource
+	// Modify Request
+	DATA_BEARER_MODIFY_EVENT
+
+	// GnbCpUe directs GnbUpUe to send the uplink packets to the UPF tunnel
+	// endpoint modified by the network
+	UL_TUNNEL_UPDATE_EVENT
+
+	// gNB directs GnbCpUe to tear down the UE context as the gNB restarts.
+	// GnbCpUe notifies SimUe of the connection release, with this event as
+	// the triggering event
+	GNB_RESTART_EVENT
+
+	// gNB notifies the UE in CM-IDLE state paged by the AMF
+	PAGING_EVENT
+
+	// Raised within gNB once the inactivity timer of the UE expires. GnbCpUe
+	// notifies SimUe of the resulting connection release, with this event as
+	// the triggering event
+	INACTIVITY_TIMER_EXPIRY_EVENT
+
+	// Raised within gNB when the secondary RAT data usage of the UE is to be
+	// reported
+	SECONDARY_RAT_USAGE_REPORT_EVENT
 )
 
 /* Events betweem UE and AMF (N1)
@@ -93,7 +207,14 @@ const (
 	SERVICE_REJECT_EVENT
 	SERVICE_ACCEPT_EVENT //78
 
-	AUTH_REQUEST_EVENT = UE_5GS_MOBILITY_MANAGEMENT_EVENTS + 10 + iota //86
+	NSSAA_COMMAND_EVENT = UE_5GS_MOBILITY_MANAGEMENT_EVENTS + 4 + iota //80
+	NSSAA_COMPLETE_EVENT
+	NSSAA_RESULT_EVENT //82
+
+	CONFIG_UPDATE_COMMAND_EVENT = UE_5GS_MOBILITY_MANAGEMENT_EVENTS + 5 + iota //84
+	CONFIG_UPDATE_COMPLETE_EVENT
+
+	AUTH_REQUEST_EVENT = UE_5GS_MOBILITY_MANAGEMENT_EVENTS + 5 + iota //86
 	AUTH_RESPONSE_EVENT
 	AUTH_REJECT_EVENT
 	AUTH_FAILURE_EVENT
@@ -104,7 +225,7 @@ const (
 	SEC_MOD_COMPLETE_EVENT
 	SEC_MOD_REJECT_EVENT //95
 
-	FIVE_GMM_STATUS_EVENT = UE_5GS_MOBILITY_MANAGEMENT_EVENTS + 14 + iota //86
+	FIVE_GMM_STATUS_EVENT = UE_5GS_MOBILITY_MANAGEMENT_EVENTS + 9 + iota //100
 	NOTIFICATION_EVENT
 	NOTIFICATION_RESPONSE_EVENT
 	UL_NAS_TRANSPORT_EVENT
@@ -144,6 +265,20 @@ const (
 	PDU_SESS_RESOURCE_SETUP_REQUEST_EVENT
 	PDU_SESS_RESOURCE_RELEASE_COMMAND_EVENT
 	UE_CTX_RELEASE_COMMAND_EVENT
+	LOCATION_REPORTING_CONTROL_EVENT
+	UE_RADIO_CAPABILITY_CHECK_REQUEST_EVENT
+	PATH_SWITCH_REQUEST_ACK_EVENT
+	PATH_SWITCH_REQUEST_FAILURE_EVENT
+	HANDOVER_REQUEST_EVENT
+	HANDOVER_COMMAND_EVENT
+	HANDOVER_PREPARATION_FAILURE_EVENT
+	UE_CTX_MODIFICATION_REQUEST_EVENT
+	PDU_SESS_RESOURCE_MODIFY_REQUEST_EVENT
+	HANDOVER_CANCEL_ACK_EVENT
+	PDU_SESS_RESOURCE_MODIFY_CONFIRM_EVENT
+	TRACE_START_EVENT
+	DEACTIVATE_TRACE_EVENT
+	REROUTE_NAS_REQUEST_EVENT
 )
 
 // Events between GNodeB and UPF (N3)
@@ -158,9 +293,24 @@ var evtStrMap map[EventType]string = map[EventType]string{
 	PROFILE_START_EVENT:                     "PROFILE-START-EVENT",
 	PROFILE_PASS_EVENT:                      "PROFILE-PASS-EVENT",
 	PROFILE_FAIL_EVENT:                      "PROFILE-FAIL-EVENT",
+	EXECUTE_PROCEDURE_EVENT:                 "EXECUTE-PROCEDURE-EVENT",
+	SHUTDOWN_EVENT:                          "SHUTDOWN-EVENT",
+	THINK_TIME_EXPIRY_EVENT:                 "THINK-TIME-EXPIRY-EVENT",
+	MOBILITY_STEP_EVENT:                     "MOBILITY-STEP-EVENT",
+	NAS_TIMER_EXPIRY_EVENT:                  "NAS-TIMER-EXPIRY-EVENT",
+	GNB_RESTART_COMPLETE_EVENT:              "GNB-RESTART-COMPLETE-EVENT",
+	RETRY_PROCEDURE_EVENT:                   "RETRY-PROCEDURE-EVENT",
+	STEP_DELAY_EXPIRY_EVENT:                 "STEP-DELAY-EXPIRY-EVENT",
+	UE_STATE_QUERY_EVENT:                    "UE-STATE-QUERY-EVENT",
 	DATA_PKT_GEN_REQUEST_EVENT:              "DATA-PACKET-GENERATION-REQUEST-EVENT",
 	DATA_PKT_GEN_SUCCESS_EVENT:              "DATA-PACKET-SUCCESS-EVENT",
 	DATA_PKT_GEN_FAILURE_EVENT:              "DATA-PACKET-FAILURE-EVENT",
+	MO_SMS_REQUEST_EVENT:                    "MO-SMS-REQUEST-EVENT",
+	MO_SMS_COMPLETE_EVENT:                   "MO-SMS-COMPLETE-EVENT",
+	MT_SMS_RECEIVED_EVENT:                   "MT-SMS-RECEIVED-EVENT",
+	SMS_UL_TRANSPORT_EVENT:                  "SMS-UL-TRANSPORT-EVENT",
+	NAS_DATA_PATH_SETUP_EVENT:               "NAS-DATA-PATH-SETUP-EVENT",
+	NAS_DATA_UL_TRANSPORT_EVENT:             "NAS-DATA-UL-TRANSPORT-EVENT",
 	CONNECTION_REQUEST_EVENT:                "CONNECTION-REQUEST-EVENT",
 	CONNECTION_RELEASE_REQUEST_EVENT:        "CONNECTION-RELEASE-REQUEST-EVENT",
 	UL_INFO_TRANSFER_EVENT:                  "UL-INFO-TRANSFER-EVENT",
@@ -173,6 +323,24 @@ var evtStrMap map[EventType]string = map[EventType]string{
 	DATA_BEARER_RELEASE_REQUEST_EVENT:       "DATA-BEARER-RELEASE-REQUEST-EVENT",
 	CTX_RELEASE_ACKNOWLEDGEMENT_EVENT:       "CONTEXT-RELEASE-ACKNOWLEDGEMENT-EVENT",
 	TRIGGER_AN_RELEASE_EVENT:                "TRIGGER-AN-RELEASE-EVENT",
+	TRIGGER_INITIAL_CTX_SETUP_FAILURE_EVENT: "TRIGGER-INITIAL-CONTEXT-SETUP-FAILURE-EVENT",
+	TRIGGER_RRC_INACTIVE_TRANSITION_EVENT:   "TRIGGER-RRC-INACTIVE-TRANSITION-EVENT",
+	TRIGGER_RRC_RESUME_EVENT:                "TRIGGER-RRC-RESUME-EVENT",
+	RRC_INACTIVE_TRANSITION_REPORT_EVENT:    "RRC-INACTIVE-TRANSITION-REPORT-EVENT",
+	TRIGGER_CELL_CHANGE_EVENT:               "TRIGGER-CELL-CHANGE-EVENT",
+	TRIGGER_HANDOVER_EVENT:                  "TRIGGER-HANDOVER-EVENT",
+	XN_HANDOVER_REQUEST_EVENT:               "XN-HANDOVER-REQUEST-EVENT",
+	HANDOVER_EXECUTION_EVENT:                "HANDOVER-EXECUTION-EVENT",
+	HANDOVER_SWITCH_EVENT:                   "HANDOVER-SWITCH-EVENT",
+	HANDOVER_COMPLETE_EVENT:                 "HANDOVER-COMPLETE-EVENT",
+	HANDOVER_FAILURE_EVENT:                  "HANDOVER-FAILURE-EVENT",
+	HANDOVER_ABORTED_EVENT:                  "HANDOVER-ABORTED-EVENT",
+	DATA_BEARER_MODIFY_EVENT:                "DATA-BEARER-MODIFY-EVENT",
+	UL_TUNNEL_UPDATE_EVENT:                  "UL-TUNNEL-UPDATE-EVENT",
+	GNB_RESTART_EVENT:                       "GNB-RESTART-EVENT",
+	PAGING_EVENT:                            "PAGING-EVENT",
+	INACTIVITY_TIMER_EXPIRY_EVENT:           "INACTIVITY-TIMER-EXPIRY-EVENT",
+	SECONDARY_RAT_USAGE_REPORT_EVENT:        "SECONDARY-RAT-USAGE-REPORT-EVENT",
 	REG_REQUEST_EVENT:                       "REGESTRATION-REQUEST-EVENT",
 	REG_ACCEPT_EVENT:                        "REGESTRATION-ACCEPT-EVENT",
 	REG_COMPLETE_EVENT:                      "REGESTRATION-COMPLETE-EVENT",
@@ -184,6 +352,11 @@ var evtStrMap map[EventType]string = map[EventType]string{
 	SERVICE_REQUEST_EVENT:                   "SERVICE-REQUEST-EVENT",
 	SERVICE_REJECT_EVENT:                    "SERVICE-REJECT-EVENT",
 	SERVICE_ACCEPT_EVENT:                    "SERVICE-ACCEPT-EVENT",
+	NSSAA_COMMAND_EVENT:                     "NSSAA-COMMAND-EVENT",
+	NSSAA_COMPLETE_EVENT:                    "NSSAA-COMPLETE-EVENT",
+	NSSAA_RESULT_EVENT:                      "NSSAA-RESULT-EVENT",
+	CONFIG_UPDATE_COMMAND_EVENT:             "CONFIGURATION-UPDATE-COMMAND-EVENT",
+	CONFIG_UPDATE_COMPLETE_EVENT:            "CONFIGURATION-UPDATE-COMPLETE-EVENT",
 	AUTH_REQUEST_EVENT:                      "AUTHENTICATION-REQUEST-EVENT",
 	AUTH_RESPONSE_EVENT:                     "AUTHENTICATION-RESPONSE-EVENT",
 	AUTH_REJECT_EVENT:                       "AUTHENTICATION-REJECT-EVENT",
@@ -220,6 +393,20 @@ var evtStrMap map[EventType]string = map[EventType]string{
 	INITIAL_CTX_SETUP_REQUEST_EVENT:         "INITIAL-CONTEXT-SETUP-REQUEST-EVENT",
 	PDU_SESS_RESOURCE_SETUP_REQUEST_EVENT:   "PDU-SESSION-RESOURCE-SETUP-REQUEST-EVENT",
 	UE_CTX_RELEASE_COMMAND_EVENT:            "UE-CONTEXT-RELEASE-COMMAND-EVENT",
+	LOCATION_REPORTING_CONTROL_EVENT:        "LOCATION-REPORTING-CONTROL-EVENT",
+	UE_RADIO_CAPABILITY_CHECK_REQUEST_EVENT: "UE-RADIO-CAPABILITY-CHECK-REQUEST-EVENT",
+	PATH_SWITCH_REQUEST_ACK_EVENT:           "PATH-SWITCH-REQUEST-ACKNOWLEDGE-EVENT",
+	PATH_SWITCH_REQUEST_FAILURE_EVENT:       "PATH-SWITCH-REQUEST-FAILURE-EVENT",
+	HANDOVER_REQUEST_EVENT:                  "HANDOVER-REQUEST-EVENT",
+	HANDOVER_COMMAND_EVENT:                  "HANDOVER-COMMAND-EVENT",
+	HANDOVER_PREPARATION_FAILURE_EVENT:      "HANDOVER-PREPARATION-FAILURE-EVENT",
+	UE_CTX_MODIFICATION_REQUEST_EVENT:       "UE-CONTEXT-MODIFICATION-REQUEST-EVENT",
+	PDU_SESS_RESOURCE_MODIFY_REQUEST_EVENT:  "PDU-SESSION-RESOURCE-MODIFY-REQUEST-EVENT",
+	HANDOVER_CANCEL_ACK_EVENT:               "HANDOVER-CANCEL-ACK-EVENT",
+	PDU_SESS_RESOURCE_MODIFY_CONFIRM_EVENT:  "PDU-SESSION-RESOURCE-MODIFY-CONFIRM-EVENT",
+	TRACE_START_EVENT:                       "TRACE-START-EVENT",
+	DEACTIVATE_TRACE_EVENT:                  "DEACTIVATE-TRACE-EVENT",
+	REROUTE_NAS_REQUEST_EVENT:               "REROUTE-NAS-REQUEST-EVENT",
 	DL_UE_DATA_TRANSPORT_EVENT:              "DL-UE-DATA-TRANSPORT-EVENT",
 }
 
@@ -230,3 +417,14 @@ func (id EventType) String() string {
 	}
 	return evtStr
 }
+
+// GetEventType returns the event with the provided name, as listed in
+// evtStrMap
+func GetEventType(name string) (EventType, error) {
+	for id, evtStr := range evtStrMap {
+		if evtStr == name {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid event name:%v", name)
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/omec-project/openapi/models"
+)
+
+// GoldenIes holds the expected ("golden") IE values of the key downlink NAS
+// messages. Only the configured values are compared, the UE fails with a
+// diff of the mismatching IEs
+type GoldenIes struct {
+	RegistrationAccept *GoldenRegAccept        `yaml:"registrationAccept" json:"registrationAccept"`
+	PduSessEstAccept   *GoldenPduSessEstAccept `yaml:"pduSessionEstablishmentAccept" json:"pduSessionEstablishmentAccept"`
+}
+
+// GoldenRegAccept holds the expected IE values of the Registration Accept
+type GoldenRegAccept struct {
+	// S-NSSAIs of the Allowed NSSAI, compared irrespective of the order
+	AllowedNssai []models.Snssai `yaml:"allowedNssai" json:"allowedNssai"`
+
+	// Number of TAIs in the TAI list
+	TaiListLength *int `yaml:"taiListLength" json:"taiListLength"`
+
+	// Bits of the 5GS network feature support, TS 24.501 Section 9.11.3.5
+	NetworkFeatureSupport *GoldenNetworkFeatureSupport `yaml:"networkFeatureSupport" json:"networkFeatureSupport"`
+}
+
+// GoldenNetworkFeatureSupport holds the expected bits of the 5GS network
+// feature support IE. The IE is expected to be absent if all the bits are
+// configured as 0
+type GoldenNetworkFeatureSupport struct {
+	ImsVoPs3gpp  *uint8 `yaml:"imsVoPs3gpp" json:"imsVoPs3gpp"`
+	ImsVoPsN3gpp *uint8 `yaml:"imsVoPsN3gpp" json:"imsVoPsN3gpp"`
+	Emc          *uint8 `yaml:"emc" json:"emc"`
+	Emf          *uint8 `yaml:"emf" json:"emf"`
+	IwkN26       *uint8 `yaml:"iwkN26" json:"iwkN26"`
+	Mpsi         *uint8 `yaml:"mpsi" json:"mpsi"`
+	Emcn3        *uint8 `yaml:"emcn3" json:"emcn3"`
+	Mcsi         *uint8 `yaml:"mcsi" json:"mcsi"`
+}
+
+// GoldenPduSessEstAccept holds the expected IE values of the PDU Session
+// Establishment Accept
+type GoldenPduSessEstAccept struct {
+	// IPV4, IPV6 or IPV4V6
+	PduSessionType string         `yaml:"pduSessionType" json:"pduSessionType"`
+	SscMode        *uint8         `yaml:"sscMode" json:"sscMode"`
+	SNssai         *models.Snssai `yaml:"sNssai" json:"sNssai"`
+	Dnn            string         `yaml:"dnn" json:"dnn"`
+}
+
+// Validate checks the golden IE values
+func (g *GoldenIes) Validate() error {
+	if regAccept := g.RegistrationAccept; regAccept != nil {
+		for _, snssai := range regAccept.AllowedNssai {
+			err := validateGoldenSnssai(&snssai)
+			if err != nil {
+				return err
+			}
+		}
+		if regAccept.TaiListLength != nil && *regAccept.TaiListLength < 0 {
+			return fmt.Errorf("invalid golden tai list length:%v",
+				*regAccept.TaiListLength)
+		}
+	}
+	if estAccept := g.PduSessEstAccept; estAccept != nil {
+		switch models.PduSessionType(strings.ToUpper(estAccept.PduSessionType)) {
+		case "", models.PduSessionType_IPV4, models.PduSessionType_IPV6,
+			models.PduSessionType_IPV4_V6:
+		default:
+			return fmt.Errorf("invalid golden pdu session type:%v",
+				estAccept.PduSessionType)
+		}
+		if estAccept.SNssai != nil {
+			return validateGoldenSnssai(estAccept.SNssai)
+		}
+	}
+	return nil
+}
+
+func validateGoldenSnssai(snssai *models.Snssai) error {
+	if snssai.Sst < 0 || snssai.Sst > 255 {
+		return fmt.Errorf("invalid golden sst:%v", snssai.Sst)
+	}
+	if snssai.Sd == "" {
+		return nil
+	}
+	sd, err := hex.DecodeString(snssai.Sd)
+	if err != nil || len(sd) != 3 {
+		return fmt.Errorf("invalid golden sd:%v, expected 6 hex digits", snssai.Sd)
+	}
+	return nil
+}
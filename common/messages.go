@@ -5,11 +5,16 @@
 package common
 
 import (
+	"net"
+	"sync"
+	"time"
+
 	"github.com/omec-project/gnbsim/util/ngapTestpacket"
 	"github.com/omec-project/gnbsim/util/test"
 
 	"github.com/omec-project/nas"
 	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
 )
 
 type InterfaceMessage interface {
@@ -55,16 +60,90 @@ type UuMessage struct {
 	*/
 	TriggeringEvent EventType
 
+	// TAC of the TA in which the UE camps and the PLMN selected by the UE,
+	// carried in the connection request to the gNB. Any of the gNB cells may
+	// be selected when TAC is empty
+	Tac  string
+	Plmn *models.PlmnId
+
+	// NR Cell Identity of the cell to which the UE connects, carried in the
+	// connection request. Takes precedence over TAC when set
+	NrCellId string
+
+	// GUAMI of the 5G-GUTI of a registered UE and the slice of the UE,
+	// carried in the connection request for the AMF selection
+	Guami  *models.Guami
+	Snssai *models.Snssai
+
+	// Scripted cell changes of the UE, carried in the connection request
+	CellChanges []CellChange
+
+	// UE Radio Capability, carried in the connection request
+	UeRadioCapability []byte
+
+	// NGAP cause with which gNB rejects the UE Context Modification
+	// Requests, carried in the connection request
+	UeCtxModFailureCause *ngapType.Cause
+
+	// User plane KPIs of the user data generated, carried in the data packet
+	// generation success
+	DataStats *DataPlaneStats
+
+	// Timeline of the UE recording the NGAP messages, carried in the
+	// connection request. Nil when the recording is not enabled
+	Timeline *Timeline
+
 	// channel that a src entity can optionally send to the target entity.
 	// Target entity will use this channel to write to the src entity
 	CommChan chan InterfaceMessage
 }
 
+// CellChange moves the UE to another cell of the gNB, after the delay (in
+// milliseconds) since the previous change
+type CellChange struct {
+	Delay    uint32 `yaml:"delay" json:"delay"`
+	NrCellId string `yaml:"nrCellId" json:"nrCellId"`
+}
+
 // ProfileMessage is used to carry information between the Profile and SimUe
 type ProfileMessage struct {
 	DefaultMessage
 	Supi string
 	Proc ProcedureType
+
+	// User plane KPIs of the UE, nil if the UE generated no user data
+	DataStats *DataPlaneStats
+
+	// Count of the PDU sessions modified and released by the network outside
+	// of the procedures of the profile
+	NwPduSessMods uint
+	NwPduSessRels uint
+
+	// Time taken by each of the procedures completed by the UE, in order
+	StageTimes []StageTime
+
+	// Count of the failed procedures retried by the UE
+	Retries uint
+
+	// Time since the UE entered CM-IDLE state at which each paging attempt
+	// is received during the network triggered service request
+	PagingTimes []time.Duration
+}
+
+// StageTime is the time taken by the UE to complete a procedure
+type StageTime struct {
+	Procedure ProcedureType
+	Duration  time.Duration
+}
+
+// StageTiming is the time taken to complete a procedure across the UEs of a
+// profile
+type StageTiming struct {
+	Procedure string
+	Count     uint
+	Min       time.Duration
+	Avg       time.Duration
+	Max       time.Duration
 }
 
 // SummaryMessage is used to carry profile execution summary. Sent by profile
@@ -76,6 +155,86 @@ type SummaryMessage struct {
 	UePassedCount uint
 	UeFailedCount uint
 	ErrorList     []error
+
+	// Time at which the profile started and completed
+	StartTime time.Time
+	EndTime   time.Time
+
+	// Result of each UE, collected only when requested
+	UeResults []UeResult
+
+	// User plane KPIs of the profile, nil if no user data was generated
+	DataPlane *DataPlaneSummary
+
+	// Count of the PDU sessions modified and released by the network outside
+	// of the procedures of the profile
+	NwPduSessMods uint
+	NwPduSessRels uint
+
+	// Count of the failed procedures retried by the UEs
+	Retries uint
+
+	// Time taken by each of the procedures, in the order of execution
+	StageTimings []StageTiming
+
+	// Results of the stages of the load schedule, nil if not configured
+	LoadStages []LoadStageSummary
+
+	// Results of the UEs broken down by tag, nil if no UE is tagged
+	Tags []TagSummary
+}
+
+// TagSummary is the result of the UEs carrying a tag
+type TagSummary struct {
+	Tag           string
+	UePassedCount uint
+	UeFailedCount uint
+
+	// Time taken by the UEs to complete the profile
+	AvgLatency time.Duration
+	MaxLatency time.Duration
+}
+
+// LoadStageSummary is the result of the UEs started during a stage of the
+// load schedule of a profile
+type LoadStageSummary struct {
+	Name     string
+	Duration time.Duration
+
+	UeStartedCount uint
+	UePassedCount  uint
+	UeFailedCount  uint
+
+	// UEs not started at the arrival rate as all the IMSIs were executing
+	UeSkippedCount uint
+
+	// Maximum number of UEs executing at a time during the stage
+	MaxActiveUes uint
+
+	// Time taken by the UEs to complete the profile
+	AvgLatency time.Duration
+	MaxLatency time.Duration
+}
+
+// UeResult is the result of a single UE execution of a profile
+type UeResult struct {
+	Supi      string
+	Error     error
+	Duration  time.Duration
+	DataStats *DataPlaneStats
+
+	// Count of the failed procedures retried by the UE
+	Retries uint
+
+	// Tags of the UE configured in the profile
+	Tags []string
+
+	// Procedure failed by the UE, empty if the UE passed or timed out
+	Procedure string
+
+	// Time taken by the UE to complete each of the procedures, in the order
+	// of execution
+	StageTimes []StageTime
 }
 
 // DataBearerParams hold information require to setup data bearer(path) between
@@ -93,6 +252,9 @@ type UserDataMessage struct {
 	DefaultMessage
 	Payload []byte
 	Qfi     *uint8
+
+	// PDU session of the user data carried over NAS
+	PduSessId int64
 }
 
 type N3Message struct {
@@ -107,6 +269,57 @@ type TransportMessage struct {
 	RawPkt []byte
 }
 
+// GnbRestartMessage directs GnbCpUe to tear down the UE context as the gNB
+// restarts. Done is signalled once the UE is notified of the connection
+// release
+type GnbRestartMessage struct {
+	DefaultMessage
+	Done *sync.WaitGroup
+}
+
+// UeStateMessage queries the state of the UE. SimUe fills in its part and
+// passes the message on to RealUe, which completes the state and closes Done,
+// so that the state is read only by the routines modifying it
+type UeStateMessage struct {
+	DefaultMessage
+	State *UeState
+	Done  chan struct{}
+}
+
+// UeState is a snapshot of the state of the UE
+type UeState struct {
+	Procedure            ProcedureType
+	Guti                 string
+	NgKsi                int32
+	SecurityCtxAvailable bool
+	UlCount              uint32
+	DlCount              uint32
+	CmIdle               bool
+	MicoGranted          bool
+	T3512                uint32
+
+	// Sorted by PDU Session ID
+	PduSessions []PduSessionState
+}
+
+// PduSessionState is a snapshot of the state of a PDU Session of the UE
+type PduSessionState struct {
+	PduSessId  int64
+	PduAddress net.IP
+	Dnn        string
+	SscMode    uint8
+	UlAmbr     uint64
+	DlAmbr     uint64
+}
+
+// TimerMessage notifies the expiry of a timer. The generation of the timer
+// tells apart the expiries of the timers which were stopped or restarted
+type TimerMessage struct {
+	DefaultMessage
+	Timer string
+	Gen   uint
+}
+
 // UeMessage is used to carry information within UE
 type UeMessage struct {
 	DefaultMessage
@@ -120,5 +333,37 @@ type UeMessage struct {
 	// default destination of data pkt
 	DefaultAs string
 
+	// Protocol of the user data packets, ICMP echo requests when not set,
+	// and the UDP or TCP ports, the resolver port for DNS
+	Protocol string
+	SrcPort  uint16
+	DstPort  uint16
+
+	// Path of the HTTP GET requests, when the protocol is HTTP
+	HttpPath string
+
+	// Names and record types of the queries, when the protocol is DNS
+	DnsNames []string
+	DnsTypes []uint16
+
+	// NGAP cause to be used by gNB, as directed by profile
+	NgapCause *ngapType.Cause
+
+	// 5GS registration type of the Registration Request to be generated by
+	// RealUe, initial registration when not set
+	RegistrationType uint8
+
+	// Indicates that the Deregistration Request to be generated by RealUe
+	// is due to switch off, no Deregistration Accept is expected
+	SwitchOff bool
+
+	// Indicates that the PDU Session Establishment Request to be generated by
+	// RealUe is for the PDU session to the IMS DNN
+	Ims bool
+
+	// Indicates that the Service Request to be generated by RealUe responds
+	// to the paging
+	PagingResponse bool
+
 	CommChan chan InterfaceMessage
 }
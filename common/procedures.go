@@ -4,7 +4,11 @@
 
 package common
 
-import "github.com/omec-project/gnbsim/logger"
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/logger"
+)
 
 type ProcedureType uint8
 
@@ -19,19 +23,43 @@ const (
 	NW_TRIGGERED_UE_DEREGISTRATION_PROCEDURE
 	AMF_RELEASE_PROCEDURE
 	NW_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE
+	UL_DATA_TRIGGERED_SERVICE_REQUEST_PROCEDURE
+	INITIAL_CTX_SETUP_FAILURE_PROCEDURE
+	RRC_INACTIVE_TRANSITION_PROCEDURE
+	RRC_RESUME_PROCEDURE
+	SESSION_HOLD_PROCEDURE
+	MOBILITY_PROCEDURE
+	UE_POWER_OFF_DEREGISTRATION_PROCEDURE
+	UE_DISAPPEARANCE_PROCEDURE
+	SMS_PROCEDURE
+	NSSAA_PROCEDURE
+	GNB_RESTART_PROCEDURE
+	NW_TRIGGERED_SERVICE_REQUEST_PROCEDURE
 )
 
 var procStrMap = map[ProcedureType]string{
-	REGISTRATION_PROCEDURE:                     "REGISTRATION-PROCEDURE",
-	PDU_SESSION_ESTABLISHMENT_PROCEDURE:        "PDU-SESSION-ESTABLISHMENT-PROCEDURE",
-	USER_DATA_PKT_GENERATION_PROCEDURE:         "USER-DATA-PACKET-GENERATION-PROCEDURE",
-	UE_INITIATED_DEREGISTRATION_PROCEDURE:      "UE-INITIATED-DEREGISTRATION-PROCEDURE",
-	AN_RELEASE_PROCEDURE:                       "AN-RELEASE-PROCEDURE",
-	UE_TRIGGERED_SERVICE_REQUEST_PROCEDURE:     "UE-TRIGGERED-SERVICE-REQUEST-PROCEDURE",
-	NW_TRIGGERED_UE_DEREGISTRATION_PROCEDURE:   "NW-TRIGGERED-UE-DEREGISTRATION-PROCEDURE",
-	AMF_RELEASE_PROCEDURE:                      "AMF-RELEASE-PROCEDURE",
-	UE_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE: "UE-REQUESTED-PDU-SESSION-RELEASE-PROCEDURE",
-	NW_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE: "NW-REQUESTED-PDU-SESSION-RELEASE-PROCEDURE",
+	REGISTRATION_PROCEDURE:                      "REGISTRATION-PROCEDURE",
+	PDU_SESSION_ESTABLISHMENT_PROCEDURE:         "PDU-SESSION-ESTABLISHMENT-PROCEDURE",
+	USER_DATA_PKT_GENERATION_PROCEDURE:          "USER-DATA-PACKET-GENERATION-PROCEDURE",
+	UE_INITIATED_DEREGISTRATION_PROCEDURE:       "UE-INITIATED-DEREGISTRATION-PROCEDURE",
+	AN_RELEASE_PROCEDURE:                        "AN-RELEASE-PROCEDURE",
+	UE_TRIGGERED_SERVICE_REQUEST_PROCEDURE:      "UE-TRIGGERED-SERVICE-REQUEST-PROCEDURE",
+	NW_TRIGGERED_UE_DEREGISTRATION_PROCEDURE:    "NW-TRIGGERED-UE-DEREGISTRATION-PROCEDURE",
+	AMF_RELEASE_PROCEDURE:                       "AMF-RELEASE-PROCEDURE",
+	UE_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE:  "UE-REQUESTED-PDU-SESSION-RELEASE-PROCEDURE",
+	NW_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE:  "NW-REQUESTED-PDU-SESSION-RELEASE-PROCEDURE",
+	UL_DATA_TRIGGERED_SERVICE_REQUEST_PROCEDURE: "UL-DATA-TRIGGERED-SERVICE-REQUEST-PROCEDURE",
+	INITIAL_CTX_SETUP_FAILURE_PROCEDURE:         "INITIAL-CONTEXT-SETUP-FAILURE-PROCEDURE",
+	RRC_INACTIVE_TRANSITION_PROCEDURE:           "RRC-INACTIVE-TRANSITION-PROCEDURE",
+	RRC_RESUME_PROCEDURE:                        "RRC-RESUME-PROCEDURE",
+	SESSION_HOLD_PROCEDURE:                      "SESSION-HOLD-PROCEDURE",
+	MOBILITY_PROCEDURE:                          "MOBILITY-PROCEDURE",
+	UE_POWER_OFF_DEREGISTRATION_PROCEDURE:       "UE-POWER-OFF-DEREGISTRATION-PROCEDURE",
+	UE_DISAPPEARANCE_PROCEDURE:                  "UE-DISAPPEARANCE-PROCEDURE",
+	SMS_PROCEDURE:                               "SMS-PROCEDURE",
+	NSSAA_PROCEDURE:                             "NSSAA-PROCEDURE",
+	GNB_RESTART_PROCEDURE:                       "GNB-RESTART-PROCEDURE",
+	NW_TRIGGERED_SERVICE_REQUEST_PROCEDURE:      "NW-TRIGGERED-SERVICE-REQUEST-PROCEDURE",
 }
 
 func (id ProcedureType) String() string {
@@ -41,3 +69,14 @@ func (id ProcedureType) String() string {
 	}
 	return procStr
 }
+
+// GetProcedureType returns the procedure with the provided name, as listed in
+// procStrMap
+func GetProcedureType(name string) (ProcedureType, error) {
+	for id, procStr := range procStrMap {
+		if procStr == name {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid procedure name:%v", name)
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// randomSeed is the seed of the run, from which each entity drawing random
+// values derives its own source. Entities do not share a source, so that
+// their draws do not depend on the scheduling of the other entities and the
+// run is reproducible from the seed
+var randomSeed = struct {
+	sync.Mutex
+	seed int64
+}{}
+
+// InitRandomSeed sets the seed of the run. A seed is generated when 0 is
+// provided. It returns the seed in use, to be logged so that the run may be
+// reproduced
+func InitRandomSeed(seed int64) int64 {
+	randomSeed.Lock()
+	defer randomSeed.Unlock()
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	randomSeed.seed = seed
+	return seed
+}
+
+// GetRandomSeed returns the seed of the run
+func GetRandomSeed() int64 {
+	randomSeed.Lock()
+	defer randomSeed.Unlock()
+	return randomSeed.seed
+}
+
+// NewRand returns a source of random values derived from the seed of the
+// run and the key identifying the entity, e.g. the SUPI of a UE. The source
+// is not safe for concurrent use
+func NewRand(key string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return rand.New(rand.NewSource(GetRandomSeed() ^ int64(h.Sum64())))
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// Protocols of the messages recorded in the timeline
+const (
+	TIMELINE_PROTOCOL_NAS  = "NAS"
+	TIMELINE_PROTOCOL_NGAP = "NGAP"
+)
+
+// Directions of the messages recorded in the timeline. NAS messages are
+// exchanged between the UE and the AMF, NGAP messages between the gNB and the
+// AMF
+const (
+	TIMELINE_UPLINK   = "UL"
+	TIMELINE_DOWNLINK = "DL"
+)
+
+// TimelineEntry is a NAS or NGAP message sent or received for a UE. Size is
+// the length of the encoded message, including the NAS security header
+type TimelineEntry struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Protocol  string    `json:"protocol"`
+	Message   string    `json:"message"`
+	Size      int       `json:"size"`
+}
+
+// Timeline records the messages of a UE in the order in which they are sent
+// or received. It is shared by the RealUe, recording the NAS messages, and
+// the gNB UE contexts, recording the NGAP messages. Once maxEntries are
+// recorded the oldest entries are dropped, so that the messages leading to a
+// failure are retained
+type Timeline struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    []TimelineEntry
+	dropped    uint
+}
+
+func NewTimeline(maxEntries int) *Timeline {
+	return &Timeline{maxEntries: maxEntries}
+}
+
+// Record adds a message to the timeline. It is a no-op on a nil timeline,
+// i.e. when the recording is not enabled for the UE
+func (t *Timeline) Record(protocol, direction, message string, size int) {
+	if t == nil {
+		return
+	}
+	entry := TimelineEntry{
+		Time:      time.Now(),
+		Direction: direction,
+		Protocol:  protocol,
+		Message:   message,
+		Size:      size,
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.maxEntries > 0 && len(t.entries) >= t.maxEntries {
+		t.entries = append(t.entries[:0], t.entries[1:]...)
+		t.dropped++
+	}
+	t.entries = append(t.entries, entry)
+}
+
+// GetEntries returns a copy of the recorded entries, along with the count of
+// the entries dropped as the timeline was full
+func (t *Timeline) GetEntries() ([]TimelineEntry, uint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := make([]TimelineEntry, len(t.entries))
+	copy(entries, t.entries)
+	return entries, t.dropped
+}
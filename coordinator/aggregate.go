@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/notifier"
+)
+
+// aggregateResults adds the summaries returned by the workers to the summary
+// of the profile. Counts and data volumes are summed up, the times taken by
+// the procedures are averaged over the UEs of all the workers, and the RTT
+// percentiles and jitter are the worst reported by any worker
+func aggregateResults(summary *common.SummaryMessage, results []*workerResult) {
+	stages := make(map[string]*common.StageTiming)
+	var stageOrder []string
+	stageTotals := make(map[string]time.Duration)
+	var loadStageTotals []time.Duration
+	tags := make(map[string]*common.TagSummary)
+	var tagOrder []string
+	tagTotals := make(map[string]time.Duration)
+
+	for _, result := range results {
+		if result.err != nil {
+			summary.UeFailedCount += uint(result.ueCount)
+			summary.ErrorList = append(summary.ErrorList,
+				fmt.Errorf("worker %v: %v", result.worker, result.err))
+			continue
+		}
+
+		ws := result.summary
+		summary.UePassedCount += ws.UePassedCount
+		summary.UeFailedCount += ws.UeFailedCount
+		summary.NwPduSessMods += ws.NwPduSessMods
+		summary.NwPduSessRels += ws.NwPduSessRels
+		summary.Retries += ws.Retries
+		for _, e := range ws.Errors {
+			summary.ErrorList = append(summary.ErrorList,
+				fmt.Errorf("worker %v: %v", result.worker, e))
+		}
+
+		for _, ueResult := range ws.UeResults {
+			res := common.UeResult{
+				Supi:      ueResult.Supi,
+				Duration:  time.Duration(ueResult.Duration) * time.Millisecond,
+				Retries:   ueResult.Retries,
+				Tags:      ueResult.Tags,
+				Procedure: ueResult.Procedure,
+			}
+			if ueResult.Result == notifier.RESULT_FAIL {
+				res.Error = errors.New(ueResult.Error)
+			}
+			summary.UeResults = append(summary.UeResults, res)
+		}
+
+		if dp := ws.DataPlane; dp != nil {
+			aggregateDataPlane(summary, dp)
+		}
+
+		for _, stage := range ws.Stages {
+			st, ok := stages[stage.Procedure]
+			if !ok {
+				st = &common.StageTiming{
+					Procedure: stage.Procedure,
+					Min:       time.Duration(stage.Min) * time.Microsecond,
+				}
+				stages[stage.Procedure] = st
+				stageOrder = append(stageOrder, stage.Procedure)
+			}
+			min := time.Duration(stage.Min) * time.Microsecond
+			max := time.Duration(stage.Max) * time.Microsecond
+			if min < st.Min {
+				st.Min = min
+			}
+			if max > st.Max {
+				st.Max = max
+			}
+			st.Count += stage.Count
+			stageTotals[stage.Procedure] += time.Duration(stage.Count) *
+				time.Duration(stage.Avg) * time.Microsecond
+		}
+
+		for i, stage := range ws.LoadStages {
+			if i == len(summary.LoadStages) {
+				summary.LoadStages = append(summary.LoadStages,
+					common.LoadStageSummary{Name: stage.Name})
+				loadStageTotals = append(loadStageTotals, 0)
+			}
+			ls := &summary.LoadStages[i]
+			duration := time.Duration(stage.Duration) * time.Millisecond
+			if duration > ls.Duration {
+				ls.Duration = duration
+			}
+			ls.UeStartedCount += stage.UeStartedCount
+			ls.UePassedCount += stage.UePassedCount
+			ls.UeFailedCount += stage.UeFailedCount
+			ls.UeSkippedCount += stage.UeSkippedCount
+			ls.MaxActiveUes += stage.MaxActiveUes
+			maxLatency := time.Duration(stage.MaxLatency) * time.Millisecond
+			if maxLatency > ls.MaxLatency {
+				ls.MaxLatency = maxLatency
+			}
+			completed := stage.UePassedCount + stage.UeFailedCount
+			loadStageTotals[i] += time.Duration(completed) *
+				time.Duration(stage.AvgLatency) * time.Millisecond
+		}
+
+		for _, tag := range ws.Tags {
+			ts, ok := tags[tag.Name]
+			if !ok {
+				ts = &common.TagSummary{Tag: tag.Name}
+				tags[tag.Name] = ts
+				tagOrder = append(tagOrder, tag.Name)
+			}
+			ts.UePassedCount += tag.UePassedCount
+			ts.UeFailedCount += tag.UeFailedCount
+			maxLatency := time.Duration(tag.MaxLatency) * time.Millisecond
+			if maxLatency > ts.MaxLatency {
+				ts.MaxLatency = maxLatency
+			}
+			completed := tag.UePassedCount + tag.UeFailedCount
+			tagTotals[tag.Name] += time.Duration(completed) *
+				time.Duration(tag.AvgLatency) * time.Millisecond
+		}
+	}
+
+	for _, procedure := range stageOrder {
+		st := stages[procedure]
+		if st.Count != 0 {
+			st.Avg = stageTotals[procedure] / time.Duration(st.Count)
+		}
+		summary.StageTimings = append(summary.StageTimings, *st)
+	}
+
+	for i := range summary.LoadStages {
+		ls := &summary.LoadStages[i]
+		completed := ls.UePassedCount + ls.UeFailedCount
+		if completed != 0 {
+			ls.AvgLatency = loadStageTotals[i] / time.Duration(completed)
+		}
+	}
+
+	sort.Strings(tagOrder)
+	for _, name := range tagOrder {
+		ts := tags[name]
+		completed := ts.UePassedCount + ts.UeFailedCount
+		if completed != 0 {
+			ts.AvgLatency = tagTotals[name] / time.Duration(completed)
+		}
+		summary.Tags = append(summary.Tags, *ts)
+	}
+}
+
+// aggregateDataPlane adds the user plane KPIs of a worker to those of the
+// profile. The workers execute concurrently, hence their throughputs add up
+func aggregateDataPlane(summary *common.SummaryMessage, dp *notifier.DataPlane) {
+	if summary.DataPlane == nil {
+		summary.DataPlane = &common.DataPlaneSummary{}
+	}
+	s := summary.DataPlane
+	s.UlPkts += dp.UlPackets
+	s.UlBytes += dp.UlBytes
+	s.DlPkts += dp.DlPackets
+	s.DlBytes += dp.DlBytes
+	s.UlThroughput += dp.UlThroughput
+	s.DlThroughput += dp.DlThroughput
+
+	maxDuration := func(current *time.Duration, us int64) {
+		if d := time.Duration(us) * time.Microsecond; d > *current {
+			*current = d
+		}
+	}
+	maxDuration(&s.RttP50, dp.RttP50)
+	maxDuration(&s.RttP90, dp.RttP90)
+	maxDuration(&s.RttP99, dp.RttP99)
+	maxDuration(&s.Jitter, dp.Jitter)
+}
@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package coordinator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/factory"
+	"github.com/omec-project/gnbsim/notifier"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+)
+
+// Path of the API through which a worker executes a profile and responds with
+// its summary once the profile is complete
+const EXECUTE_PROFILE_PATH = "/gnbsim/v1/executeProfile?wait=true"
+
+// workerResult is the summary returned by a worker for its share of the
+// IMSIs of the profile
+type workerResult struct {
+	worker  string
+	ueCount int
+	summary *notifier.ProfileSummary
+	err     error
+}
+
+// ExecuteProfile splits the IMSIs of the profile across the workers, each
+// worker executing a contiguous share of the IMSIs, and sends the aggregated
+// summary on summaryChan once all the workers respond. The UEs of a worker
+// which fails to respond are accounted as failed
+func ExecuteProfile(profile *profctx.Profile, summaryChan chan common.InterfaceMessage) {
+	summary := &common.SummaryMessage{
+		ProfileType: profile.ProfileType,
+		ProfileName: profile.Name,
+		ErrorList:   make([]error, 0, 10),
+		StartTime:   time.Now(),
+	}
+
+	defer func() {
+		summary.EndTime = time.Now()
+		summaryChan <- summary
+	}()
+
+	if profile.UePool != "" || profile.PublishUePool != "" {
+		err := fmt.Errorf("ue pools not supported by the coordinator")
+		summary.ErrorList = append(summary.ErrorList, err)
+		return
+	}
+
+	err := profile.LoadProvisionedSubscribers()
+	if err != nil {
+		summary.ErrorList = append(summary.ErrorList, err)
+		return
+	}
+
+	imsis, err := profile.GetImsis()
+	if err != nil {
+		summary.ErrorList = append(summary.ErrorList, err)
+		return
+	}
+
+	workers, err := GetWorkers()
+	if err != nil {
+		summary.ErrorList = append(summary.ErrorList, err)
+		return
+	}
+
+	shares := splitImsis(imsis, len(workers))
+	profile.Log.Infoln("executing profile:", profile.Name, ", ue count:",
+		len(imsis), ", workers:", len(shares))
+
+	results := make([]*workerResult, len(shares))
+	var wg sync.WaitGroup
+	for i, share := range shares {
+		wg.Add(1)
+		go func(i int, share []string) {
+			defer wg.Done()
+			result := &workerResult{worker: workers[i], ueCount: len(share)}
+			workerProfile := getWorkerProfile(profile, share, len(imsis))
+			result.summary, result.err = executeOnWorker(workers[i], workerProfile)
+			if result.err != nil {
+				profile.Log.Errorln("worker", workers[i], "failed:", result.err)
+			}
+			results[i] = result
+		}(i, share)
+	}
+	wg.Wait()
+
+	aggregateResults(summary, results)
+}
+
+// GetWorkers returns the base URLs of the configured workers, along with
+// those of the workers resolved from the worker service
+func GetWorkers() ([]string, error) {
+	coordinator := factory.AppConfig.Configuration.Coordinator
+	workers := append([]string(nil), coordinator.Workers...)
+	if coordinator.WorkerService != "" {
+		host, port, err := net.SplitHostPort(coordinator.WorkerService)
+		if err != nil {
+			return nil, fmt.Errorf("invalid worker service:%v", err)
+		}
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve worker service:%v", err)
+		}
+		sort.Strings(addrs)
+		for _, addr := range addrs {
+			workers = append(workers, "http://"+net.JoinHostPort(addr, port))
+		}
+	}
+	if len(workers) == 0 {
+		return nil, fmt.Errorf("no workers available")
+	}
+	return workers, nil
+}
+
+// splitImsis splits the IMSIs into contiguous shares of nearly equal size,
+// one per worker. Workers get no share when there are fewer IMSIs than workers
+func splitImsis(imsis []string, workerCount int) [][]string {
+	if workerCount > len(imsis) {
+		workerCount = len(imsis)
+	}
+	var shares [][]string
+	start := 0
+	for i := 0; i < workerCount; i++ {
+		end := start + (len(imsis)-start)/(workerCount-i)
+		shares = append(shares, imsis[start:end])
+		start = end
+	}
+	return shares
+}
+
+// getWorkerProfile returns a copy of the profile restricted to the share of
+// the IMSIs. The load of each stage of the load schedule is scaled down as
+// per the share
+func getWorkerProfile(profile *profctx.Profile, share []string,
+	imsiCount int) *profctx.Profile {
+
+	workerProfile := *profile
+	workerProfile.Enable = true
+	workerProfile.Imsis = share
+	workerProfile.UeCount = len(share)
+	workerProfile.StartAfter = nil
+	if profile.Subscribers != nil {
+		workerProfile.Subscribers = make(map[string]*profctx.Subscriber, len(share))
+		for _, imsi := range share {
+			workerProfile.Subscribers[imsi] = profile.Subscribers[imsi]
+		}
+	}
+
+	workerProfile.LoadSchedule = nil
+	ratio := float64(len(share)) / float64(imsiCount)
+	for _, loadStage := range profile.LoadSchedule {
+		stage := *loadStage
+		if stage.ActiveUes != 0 {
+			// Rounded up, each worker executing at least one UE
+			stage.ActiveUes = (stage.ActiveUes*len(share) + imsiCount - 1) / imsiCount
+		}
+		stage.ArrivalRate *= ratio
+		workerProfile.LoadSchedule = append(workerProfile.LoadSchedule, &stage)
+	}
+	return &workerProfile
+}
+
+// executeOnWorker requests the worker to execute the profile and waits for
+// its summary
+func executeOnWorker(worker string, profile *profctx.Profile) (*notifier.ProfileSummary, error) {
+	body, err := json.Marshal(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode profile: %v", err)
+	}
+
+	url := strings.TrimSuffix(worker, "/") + EXECUTE_PROFILE_PATH
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	timeout := factory.AppConfig.Configuration.Coordinator.Timeout
+	if timeout == 0 {
+		timeout = factory.DEFAULT_WORKER_TIMEOUT
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute profile: %v", err)
+	}
+	defer rsp.Body.Close()
+
+	rspBody, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("worker returned status: %v, %v", rsp.Status,
+			string(rspBody))
+	}
+
+	summary := &notifier.ProfileSummary{}
+	err = json.Unmarshal(rspBody, summary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode profile summary: %v", err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package decoder
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	realue_nas "github.com/omec-project/gnbsim/realue/nas"
+
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/nas/security"
+	"github.com/omec-project/ngap"
+)
+
+// Types of the decoded PDUs
+const (
+	PDU_TYPE_AUTO = "auto"
+	PDU_TYPE_NGAP = "ngap"
+	PDU_TYPE_NAS  = "nas"
+)
+
+// NasSecurity holds the parameters with which the ciphered NAS messages are
+// deciphered. The NAS COUNT is formed from the overflow and the sequence
+// number of the security header
+type NasSecurity struct {
+	CipheringAlg uint8
+	KnasEnc      [16]byte
+	Overflow     uint16
+
+	// security.DirectionUplink or security.DirectionDownlink
+	Direction uint8
+}
+
+// Decoder prints the structured breakdown of the NGAP PDUs and NAS messages
+// captured as hex, including the NAS messages carried in the NGAP PDUs
+type Decoder struct {
+	// Deciphers the ciphered NAS messages when set
+	Security *NasSecurity
+
+	w io.Writer
+}
+
+func NewDecoder(w io.Writer, sec *NasSecurity) *Decoder {
+	return &Decoder{Security: sec, w: w}
+}
+
+// ParseHex parses the hex bytes, ignoring the "0x" prefix and the whitespace,
+// colon and dash separators
+func ParseHex(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "0x")
+	s = strings.NewReplacer(" ", "", "\n", "", "\t", "", ":", "", "-", "").Replace(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex bytes:%v", err)
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("no bytes to decode")
+	}
+	return b, nil
+}
+
+// Decode prints the breakdown of the PDU of the given type. With PDU_TYPE_AUTO
+// the PDU is taken to be a NAS message if it starts with the 5GMM or 5GSM
+// extended protocol discriminator, and an NGAP PDU otherwise
+func (d *Decoder) Decode(pduType string, pdu []byte) error {
+	if pduType == PDU_TYPE_AUTO {
+		pduType = PDU_TYPE_NGAP
+		if pdu[0] == nasMessage.Epd5GSMobilityManagementMessage ||
+			pdu[0] == nasMessage.Epd5GSSessionManagementMessage {
+			pduType = PDU_TYPE_NAS
+		}
+	}
+
+	switch pduType {
+	case PDU_TYPE_NGAP:
+		return d.DecodeNgap(pdu)
+	case PDU_TYPE_NAS:
+		return d.DecodeNas(pdu, 0)
+	default:
+		return fmt.Errorf("unsupported pdu type:%v", pduType)
+	}
+}
+
+// DecodeNgap prints the breakdown of the NGAP PDU, the NAS-PDU IEs are
+// decoded as well
+func (d *Decoder) DecodeNgap(pdu []byte) error {
+	ngapPdu, err := ngap.Decoder(pdu)
+	if err != nil {
+		return fmt.Errorf("failed to decode ngap pdu:%v", err)
+	}
+	d.printValue("NGAPPDU", ngapPdu, 0)
+	return nil
+}
+
+// DecodeNas prints the breakdown of the NAS message. The security header of
+// a security protected message is printed, followed by the plain NAS
+// message, which is deciphered if the security parameters are provided
+func (d *Decoder) DecodeNas(pdu []byte, depth int) error {
+	if len(pdu) < 3 {
+		return fmt.Errorf("nas message too short, length:%v", len(pdu))
+	}
+
+	securityHeaderType := nas.GetSecurityHeaderType(pdu) & 0x0f
+	if pdu[0] == nasMessage.Epd5GSMobilityManagementMessage &&
+		securityHeaderType != nas.SecurityHeaderTypePlainNas {
+		if len(pdu) < realue_nas.SECURITY_HEADER_LEN {
+			return fmt.Errorf("security protected nas message too short, length:%v",
+				len(pdu))
+		}
+		sqn := pdu[realue_nas.SECURITY_HEADER_LEN-1]
+		d.printf(depth, "SecurityProtectedMessage:\n")
+		d.printf(depth+1, "SecurityHeaderType: %v\n", securityHeaderType)
+		d.printf(depth+1, "MessageAuthenticationCode: %x\n", pdu[2:realue_nas.SECURITY_HEADER_LEN-1])
+		d.printf(depth+1, "SequenceNumber: %v\n", sqn)
+
+		plain := append([]byte(nil), pdu[realue_nas.SECURITY_HEADER_LEN:]...)
+		ciphered := securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCiphered ||
+			securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext
+		if ciphered {
+			if d.Security == nil {
+				d.printf(depth+1, "CipheredMessage: %x\n", plain)
+				d.printf(depth+1, "(ciphering key not provided, not deciphered)\n")
+				return nil
+			}
+			count := uint32(d.Security.Overflow)<<8 | uint32(sqn)
+			err := security.NASEncrypt(d.Security.CipheringAlg, d.Security.KnasEnc, count,
+				security.Bearer3GPP, d.Security.Direction, plain)
+			if err != nil {
+				return fmt.Errorf("failed to decipher nas message:%v", err)
+			}
+		}
+		pdu = plain
+		depth++
+	}
+
+	name, body, err := realue_nas.DecodeNasMessage(pdu)
+	if err != nil {
+		d.printf(depth, "PlainNasMessage: %x\n", pdu)
+		return fmt.Errorf("failed to decode nas message:%v", err)
+	}
+	d.printValue(name, body, depth)
+
+	// 5GSM message carried in the payload container
+	var containerType uint8
+	var container []byte
+	switch msg := body.(type) {
+	case *nasMessage.ULNASTransport:
+		containerType = msg.SpareHalfOctetAndPayloadContainerType.GetPayloadContainerType()
+		container = msg.PayloadContainer.GetPayloadContainerContents()
+	case *nasMessage.DLNASTransport:
+		containerType = msg.SpareHalfOctetAndPayloadContainerType.GetPayloadContainerType()
+		container = msg.PayloadContainer.GetPayloadContainerContents()
+	}
+	if containerType == nasMessage.PayloadContainerTypeN1SMInfo && len(container) != 0 {
+		d.printf(depth, "PayloadContainer (decoded):\n")
+		return d.DecodeNas(container, depth+1)
+	}
+	return nil
+}
+
+func (d *Decoder) printf(depth int, format string, args ...interface{}) {
+	fmt.Fprintf(d.w, strings.Repeat("  ", depth)+format, args...)
+}
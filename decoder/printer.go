@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package decoder
+
+import (
+	"reflect"
+
+	"github.com/omec-project/ngap/ngapType"
+)
+
+var nasPduType = reflect.TypeOf(ngapType.NASPDU{})
+
+// printValue prints the decoded value as a tree of its fields, one field per
+// line. Unset optional fields (nil pointers and empty lists) are omitted and
+// octet strings are printed in hex. The NAS-PDU IEs of NGAP are decoded as NAS
+// messages
+func (d *Decoder) printValue(name string, value interface{}, depth int) {
+	d.printReflectValue(name, reflect.ValueOf(value), depth)
+}
+
+func (d *Decoder) printReflectValue(name string, v reflect.Value, depth int) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == nasPduType {
+		pdu := v.Interface().(ngapType.NASPDU).Value
+		d.printf(depth, "%v: %x\n", name, []byte(pdu))
+		d.printf(depth, "%v (decoded):\n", name)
+		err := d.DecodeNas(pdu, depth+1)
+		if err != nil {
+			d.printf(depth+1, "(%v)\n", err)
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		d.printf(depth, "%v:\n", name)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				// Unexported
+				continue
+			}
+			d.printReflectValue(field.Name, v.Field(i), depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			octets := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(octets), v)
+			d.printf(depth, "%v: %x\n", name, octets)
+			return
+		}
+		d.printf(depth, "%v:\n", name)
+		for i := 0; i < v.Len(); i++ {
+			d.printReflectValue("-", v.Index(i), depth+1)
+		}
+	default:
+		d.printf(depth, "%v: %v\n", name, v.Interface())
+	}
+}
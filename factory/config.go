@@ -12,6 +12,8 @@ package factory
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 
 	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
@@ -21,6 +23,22 @@ import (
 const (
 	GNBSIM_EXPECTED_CONFIG_VERSION string = "1.0.0"
 	GNBSIM_DEFAULT_CONFIG_PATH            = "/gnbsim/config/gnb.conf"
+
+	// Default time in seconds allowed for deregistering the active UEs on
+	// shutdown
+	DEFAULT_SHUTDOWN_DEADLINE uint32 = 10
+
+	// Default time in seconds allowed for posting a profile summary to the
+	// webhook
+	DEFAULT_WEBHOOK_TIMEOUT uint32 = 5
+
+	// Default time in seconds allowed for a worker to execute its share of
+	// a profile
+	DEFAULT_WORKER_TIMEOUT uint32 = 3600
+
+	// Default time in seconds allowed for the GTP-U echo response of a UPF
+	// during the pre-flight checks
+	DEFAULT_PREFLIGHT_TIMEOUT uint32 = 3
 )
 
 type Config struct {
@@ -40,6 +58,60 @@ type Configuration struct {
 	SingleInterface bool                      `yaml:"singleInterface"`
 	ExecInParallel  bool                      `yaml:"execInParallel"`
 	Server          HttpServer                `yaml:"httpServer"`
+
+	// Maximum number of UEs executing at a time across all the profiles, the
+	// UEs of the profiles wait for their turn. Unlimited when set to 0
+	MaxConcurrentUes int `yaml:"maxConcurrentUes"`
+
+	// Serves the live statistics of the run as JSON, usable as a Grafana
+	// JSON datasource
+	StatsServer HttpServer `yaml:"statsServer"`
+
+	// Interval in seconds at which interim profile summaries are logged,
+	// added to the result file and posted to the webhook when enabled in
+	// Webhook.InterimSummaries. Disabled when set to 0
+	InterimSummaryInterval uint32 `yaml:"interimSummaryInterval"`
+
+	// Time in seconds allowed for deregistering the active UEs when the
+	// application receives SIGINT or SIGTERM. Defaults to
+	// DEFAULT_SHUTDOWN_DEADLINE when set to 0
+	ShutdownDeadline uint32 `yaml:"shutdownDeadline"`
+
+	// Webhook to which the summary of each profile is posted once the
+	// profile is complete. Disabled when not configured
+	Webhook *Webhook `yaml:"webhook"`
+
+	// Moves the IMSI range of a profile past the ranges of the earlier
+	// profiles it overlaps with, instead of failing the validation, when the
+	// profiles are executed in parallel
+	AutoOffsetImsi bool `yaml:"autoOffsetImsi"`
+
+	// Directory to which the state of the UEs and gNBs is dumped as JSON on
+	// SIGUSR1, the temporary directory when not configured
+	StateDumpDir string `yaml:"stateDumpDir"`
+
+	// Seed from which all the random values of the run are drawn, so that a
+	// run may be reproduced. Generated when not configured
+	Seed int64 `yaml:"seed"`
+
+	// File to which the results of the run, including the result of each UE,
+	// are written as JSON once each profile is complete. The result files of
+	// two runs may be compared through the "compare" command
+	ResultFile string `yaml:"resultFile"`
+
+	// File to which the result of each UE is written as CSV once each profile
+	// is complete, one row per UE, for analysis in spreadsheets or pandas
+	ResultCsvFile string `yaml:"resultCsvFile"`
+
+	// Runs gnbsim as a coordinator, which splits the UEs of each profile
+	// across the gnbsim workers instead of executing them locally. Disabled
+	// when not configured
+	Coordinator *Coordinator `yaml:"coordinator"`
+
+	// Checks the AMF and UPF endpoints before the profiles are executed, and
+	// fails fast with a pre-flight report if any check fails. Disabled when
+	// not configured
+	Preflight *Preflight `yaml:"preflight"`
 }
 
 type HttpServer struct {
@@ -48,8 +120,60 @@ type HttpServer struct {
 	Port   string `yaml:"port"`
 }
 
+// Webhook receives the profile summaries as JSON through HTTP POST
+type Webhook struct {
+	Url string `yaml:"url"`
+
+	// Time in seconds allowed for each request. Defaults to
+	// DEFAULT_WEBHOOK_TIMEOUT when set to 0
+	Timeout uint32 `yaml:"timeout"`
+
+	// Additional HTTP headers sent with each request, e.g. Authorization
+	Headers map[string]string `yaml:"headers"`
+
+	// Includes the result of each UE in the summary
+	IncludeUeResults bool `yaml:"includeUeResults"`
+
+	// Posts the interim summaries as well, when InterimSummaryInterval is
+	// set. These carry "event": "interimSummary"
+	InterimSummaries bool `yaml:"interimSummaries"`
+}
+
+// Coordinator executes the profiles through the HTTP API of the workers, each
+// worker executing a contiguous share of the IMSIs of the profile, and
+// aggregates the summaries returned by the workers
+type Coordinator struct {
+	// Base URLs of the HTTP API of the workers, e.g. http://10.1.0.5:8080
+	Workers []string `yaml:"workers"`
+
+	// Service ("<host>:<port>") resolved to the addresses of the workers,
+	// e.g. a Kubernetes headless service selecting the worker pods. Used in
+	// addition to the workers listed
+	WorkerService string `yaml:"workerService"`
+
+	// Time in seconds allowed for a worker to execute its share of a
+	// profile. Defaults to DEFAULT_WORKER_TIMEOUT when set to 0
+	Timeout uint32 `yaml:"timeout"`
+}
+
+// Preflight configures the pre-flight checks. The SCTP association with the
+// AMF and NG Setup are always checked for each gNodeB
+type Preflight struct {
+	// N3 addresses ("<ip>" or "<ip>:<port>") of the UPFs to which each
+	// gNodeB sends GTP-U echo requests. Not checked when not configured
+	Upfs []string `yaml:"upfs"`
+
+	// Time in seconds allowed for the GTP-U echo response. Defaults to
+	// DEFAULT_PREFLIGHT_TIMEOUT when set to 0
+	Timeout uint32 `yaml:"timeout"`
+}
+
 type Logger struct {
 	LogLevel string `yaml:"logLevel"`
+
+	// Log levels of the modules overriding LogLevel, keyed by module: app,
+	// cfg, gnb, gtpu, http, nas, ngap, profile, simue or util
+	ModuleLogLevels map[string]string `yaml:"moduleLogLevels"`
 }
 
 func (c *Config) GetVersion() string {
@@ -76,6 +200,9 @@ func (c *Config) Validate() (err error) {
 	if c.Configuration.Server.IpAddr == "POD_IP" {
 		c.Configuration.Server.IpAddr = os.Getenv("POD_IP")
 	}
+	if c.Configuration.StatsServer.IpAddr == "POD_IP" {
+		c.Configuration.StatsServer.IpAddr = os.Getenv("POD_IP")
+	}
 
 	if c.Configuration.SingleInterface == true {
 		for _, gnb := range c.Configuration.Gnbs {
@@ -89,6 +216,31 @@ func (c *Config) Validate() (err error) {
 		return fmt.Errorf("no profile information available")
 	}
 
+	if webhook := c.Configuration.Webhook; webhook != nil {
+		u, err := url.Parse(webhook.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook url: %v", webhook.Url)
+		}
+	}
+
+	if coordinator := c.Configuration.Coordinator; coordinator != nil {
+		if len(coordinator.Workers) == 0 && coordinator.WorkerService == "" {
+			return fmt.Errorf("no workers configured for the coordinator")
+		}
+		for _, worker := range coordinator.Workers {
+			u, err := url.Parse(worker)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid worker url: %v", worker)
+			}
+		}
+		if coordinator.WorkerService != "" {
+			_, _, err := net.SplitHostPort(coordinator.WorkerService)
+			if err != nil {
+				return fmt.Errorf("invalid worker service: %v", coordinator.WorkerService)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -7,51 +7,76 @@
 package main
 
 import (
+	"fmt"
+	"net"
 	"net/http"
 	_ "net/http/pprof" //Using package only for invoking initialization.
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/omec-project/gnbsim/bench"
 	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/decoder"
 	"github.com/omec-project/gnbsim/factory"
 	"github.com/omec-project/gnbsim/gnodeb"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
 	"github.com/omec-project/gnbsim/httpserver"
 	"github.com/omec-project/gnbsim/logger"
+	"github.com/omec-project/gnbsim/notifier"
 	prof "github.com/omec-project/gnbsim/profile"
 	profctx "github.com/omec-project/gnbsim/profile/context"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+	"github.com/omec-project/gnbsim/shell"
+	"github.com/omec-project/gnbsim/simue"
+	"github.com/omec-project/gnbsim/stats"
 
+	"github.com/omec-project/nas/security"
 	"github.com/urfave/cli"
 )
 
+// version is set at build time through -ldflags "-X main.version=<version>"
+var version = "dev"
+
+// Time allowed for the profiles aborted on SIGINT or SIGTERM to report their
+// summaries, once the active UEs are deregistered
+const SUMMARY_FLUSH_DEADLINE = 30 * time.Second
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "GNBSIM"
-	app.Usage = "./gnbsim --cfg [gnbsim configuration file]"
+	app.Usage = "./gnbsim [command] --cfg [gnbsim configuration file]"
+	app.Version = version
 	app.Action = action
 	app.Flags = getCliFlags()
+	app.Commands = getCliCommands()
 
 	logger.AppLog.Infoln("App Name:", app.Name)
 
 	if err := app.Run(os.Args); err != nil {
 		logger.AppLog.Errorln("Failed to run GNBSIM:", err)
-		return
+		os.Exit(1)
 	}
 }
 
-func action(c *cli.Context) error {
-
-	cfg := c.String("cfg")
-	if cfg == "" {
-		logger.AppLog.Warnln("No configuration file provided. Using default configuration file:", factory.GNBSIM_DEFAULT_CONFIG_PATH)
-		logger.AppLog.Infoln("Application Usage:", c.App.Usage)
-		cfg = factory.GNBSIM_DEFAULT_CONFIG_PATH
+// runAction executes the enabled profiles, or only prints the execution plan
+// when the "dry-run" flag is set
+func runAction(c *cli.Context) error {
+	if c.Bool("dry-run") {
+		return dryRunAction(c)
 	}
+	return action(c)
+}
 
-	if err := factory.InitConfigFactory(cfg); err != nil {
-		logger.AppLog.Errorln("Failed to initialize config factory:", err)
+func action(c *cli.Context) error {
+
+	err := initialize(c)
+	if err != nil {
 		return err
 	}
 
@@ -64,18 +89,17 @@ func action(c *cli.Context) error {
 	}()
 
 	config := factory.AppConfig
-	lvl := config.Logger.LogLevel
-	logger.AppLog.Infoln("Setting log level to:", lvl)
-	logger.SetLogLevel(lvl)
 
-	prof.InitializeAllProfiles()
-	err := gnodeb.InitializeAllGnbs()
-	if err != nil {
-		logger.AppLog.Errorln("Failed to initialize gNodeBs:", err)
-		return err
-	}
+	summaryDone := make(chan struct{})
+	go func() {
+		defer close(summaryDone)
+		ListenAndLogSummary()
+	}()
 
-	go ListenAndLogSummary()
+	if config.Configuration.InterimSummaryInterval != 0 {
+		interval := time.Duration(config.Configuration.InterimSummaryInterval) * time.Second
+		go ReportInterimSummaries(interval)
+	}
 
 	var appWaitGrp sync.WaitGroup
 	if config.Configuration.Server.Enable {
@@ -87,44 +111,683 @@ func action(c *cli.Context) error {
 				logger.AppLog.Infoln("StartHttpServer returned :", err)
 			}
 		}()
+	}
 
-		signalChannel := make(chan os.Signal, 1)
-		signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
+	if config.Configuration.StatsServer.Enable {
+		statsServer := config.Configuration.StatsServer
 		go func() {
-			<-signalChannel
-			httpserver.StopHttpServer()
+			err := stats.StartServer(statsServer.IpAddr + ":" + statsServer.Port)
+			if err != nil {
+				logger.AppLog.Errorln("Stats server returned:", err)
+			}
 		}()
 	}
 
-	var profileWaitGrp sync.WaitGroup
-	for _, profile := range config.Configuration.Profiles {
+	go dumpStateOnSignal(config.Configuration.StateDumpDir)
+
+	profilesDone := make(chan struct{})
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signalChannel
+		logger.AppLog.Infoln("Received signal:", sig)
+		if config.Configuration.Server.Enable {
+			httpserver.StopHttpServer()
+		}
+		Shutdown()
+		flushSummaries(profilesDone, summaryDone)
+
+		// Interrupted run is not reported as successful
+		code := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		os.Exit(code)
+	}()
+
+	prof.ExecuteAllProfiles()
+	close(profilesDone)
+
+	appWaitGrp.Wait()
+
+	// TODO: To be removed. Allowing summary logger to dump the logs
+	time.Sleep(time.Second * 5)
+
+	return nil
+}
+
+// flushSummaries aborts the profiles once the application is interrupted and
+// waits for their summaries to be logged, written to the result files and
+// posted to the webhook, within SUMMARY_FLUSH_DEADLINE
+func flushSummaries(profilesDone, summaryDone chan struct{}) {
+	prof.AbortAllProfiles()
+
+	timer := time.NewTimer(SUMMARY_FLUSH_DEADLINE)
+	defer timer.Stop()
+	select {
+	case <-profilesDone:
+	case <-timer.C:
+		logger.AppLog.Warnln("Profiles not complete within", SUMMARY_FLUSH_DEADLINE,
+			", their summaries are not reported")
+		return
+	}
+
+	// Summary routine quits once the summaries sent before are reported
+	quitMsg := &common.DefaultMessage{}
+	quitMsg.Event = common.QUIT_EVENT
+	select {
+	case profctx.SummaryChan <- quitMsg:
+		<-summaryDone
+	case <-summaryDone:
+	case <-timer.C:
+		logger.AppLog.Warnln("Summaries not reported within", SUMMARY_FLUSH_DEADLINE)
+	}
+}
+
+// dumpStateOnSignal writes the state of the UEs and gNBs to the directory
+// each time SIGUSR1 is received, for debugging stuck runs
+func dumpStateOnSignal(dir string) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	dumpChannel := make(chan os.Signal, 1)
+	signal.Notify(dumpChannel, syscall.SIGUSR1)
+	for range dumpChannel {
+		path, err := simue.WriteStateDump(dir)
+		if err != nil {
+			logger.AppLog.Errorln("State dump failed:", err)
+			continue
+		}
+		logger.AppLog.Infoln("State dumped to", path)
+	}
+}
+
+// initialize loads the configuration and initializes the profiles and gNodeBs
+func initialize(c *cli.Context) error {
+	err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+
+	seed := common.InitRandomSeed(factory.AppConfig.Configuration.Seed)
+	logger.AppLog.Infoln("Random seed of the run, configure it to reproduce the run:", seed)
+
+	prof.InitializeAllProfiles()
+	if errs := prof.LoadAllProvisionedSubscribers(); len(errs) != 0 {
+		for _, err := range errs {
+			logger.AppLog.Errorln(err)
+		}
+		return fmt.Errorf("subscriber discovery failed, %v error(s) found", len(errs))
+	}
+	if errs := prof.ValidateImsiOverlap(); len(errs) != 0 {
+		for _, err := range errs {
+			logger.AppLog.Errorln(err)
+		}
+		return fmt.Errorf("overlapping imsi ranges, %v error(s) found", len(errs))
+	}
+	if errs := prof.ValidateProfileOrder(); len(errs) != 0 {
+		for _, err := range errs {
+			logger.AppLog.Errorln(err)
+		}
+		return fmt.Errorf("invalid profile order, %v error(s) found", len(errs))
+	}
+
+	// The coordinator does not connect to the AMF, the gNodeBs are
+	// initialized by the workers
+	if factory.AppConfig.Configuration.Coordinator != nil {
+		return nil
+	}
+
+	if factory.AppConfig.Configuration.Preflight != nil {
+		return runPreflightChecks()
+	}
+
+	err = gnodeb.InitializeAllGnbs()
+	if err != nil {
+		logger.AppLog.Errorln("Failed to initialize gNodeBs:", err)
+		return err
+	}
+	return nil
+}
+
+// runPreflightChecks initializes the gNodeBs through the pre-flight checks
+// and prints the pre-flight report. It fails if any check fails, so that the
+// profiles are not executed against unreachable endpoints
+func runPreflightChecks() error {
+	report := gnodeb.RunPreflightChecks()
+
+	fmt.Println("Pre-flight report:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, check := range report.Checks {
+		result := "PASS"
+		if check.Err != nil {
+			result = "FAIL: " + check.Err.Error()
+		}
+		fmt.Fprintf(w, "   %v\t%v\t%v\t%v\t%v\n", check.GnbName, check.Check,
+			check.Target, check.Duration.Round(time.Millisecond), result)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed := report.GetFailedCount(); failed != 0 {
+		return fmt.Errorf("pre-flight checks failed, %v of %v check(s) failed",
+			failed, len(report.Checks))
+	}
+	logger.AppLog.Infoln("All pre-flight checks passed")
+	return nil
+}
+
+// preflightAction checks the AMF and UPF endpoints of the gNodeBs, without
+// executing the profiles
+func preflightAction(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if factory.AppConfig.Configuration.Preflight == nil {
+		factory.AppConfig.Configuration.Preflight = &factory.Preflight{}
+	}
+	return runPreflightChecks()
+}
+
+// loadConfig reads the configuration file provided through the "cfg" flag and
+// sets the log level
+func loadConfig(c *cli.Context) error {
+	cfg := c.String("cfg")
+	if cfg == "" {
+		logger.AppLog.Warnln("No configuration file provided. Using default configuration file:", factory.GNBSIM_DEFAULT_CONFIG_PATH)
+		logger.AppLog.Infoln("Application Usage:", c.App.Usage)
+		cfg = factory.GNBSIM_DEFAULT_CONFIG_PATH
+	}
+
+	if err := factory.InitConfigFactory(cfg); err != nil {
+		logger.AppLog.Errorln("Failed to initialize config factory:", err)
+		return err
+	}
+
+	config := factory.AppConfig
+	lvl := config.Logger.LogLevel
+	logger.AppLog.Infoln("Setting log level to:", lvl)
+	logger.SetLogLevel(lvl)
+	for module, lvl := range config.Logger.ModuleLogLevels {
+		err := logger.SetModuleLogLevel(module, lvl)
+		if err != nil {
+			logger.AppLog.Errorln("Failed to set log level of module", module, ":", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// validateConfig checks the cross references within the configuration and
+// prints the errors found. The subscribers are fetched through the
+// provisioning interface only when requested, their keys are checked then
+func validateConfig(fetchSubscribers bool) error {
+	errs := gnodeb.ValidateAllGnbs()
+	if fetchSubscribers {
+		errs = append(errs, prof.LoadAllProvisionedSubscribers()...)
+	}
+	errs = append(errs, prof.ValidateAllProfiles()...)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	fmt.Println("Configuration errors:")
+	for _, err := range errs {
+		fmt.Println("  -", err)
+	}
+	return fmt.Errorf("invalid configuration, %v error(s) found", len(errs))
+}
+
+// validateAction parses the configuration file and checks it without
+// connecting to the AMF, or to the provisioning interface unless requested
+func validateAction(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if err := validateConfig(c.Bool("provisioning")); err != nil {
+		return err
+	}
+	fmt.Println("Configuration is valid")
+	return nil
+}
+
+// dryRunAction prints the profiles which would be executed, in order, along
+// with the UEs and the procedures, without connecting to the AMF
+func dryRunAction(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
+	}
+	if err := validateConfig(true); err != nil {
+		return err
+	}
+
+	config := factory.AppConfig.Configuration
+	order := "sequentially"
+	if config.ExecInParallel {
+		order = "in parallel"
+	}
+	fmt.Println("Execution plan, profiles executed", order)
+	if config.MaxConcurrentUes > 0 {
+		fmt.Println("Up to", config.MaxConcurrentUes, "UEs executed at a time")
+	}
+
+	step := 0
+	for _, profile := range config.Profiles {
 		if !profile.Enable {
 			continue
 		}
-		profileWaitGrp.Add(1)
+		step++
 
-		go func(profileCtx *profctx.Profile) {
-			defer profileWaitGrp.Done()
-			prof.ExecuteProfile(profileCtx, profctx.SummaryChan)
-		}(profile)
+		gnb, _ := config.GetGNodeB(profile.GnbName)
+		fmt.Printf("%v. Profile: %v, Type: %v\n", step, profile.Name, profile.ProfileType)
+		fmt.Printf("   gNB: %v, N2: %v", gnb.GnbName,
+			net.JoinHostPort(gnb.GnbN2Ip, strconv.Itoa(gnb.GnbN2Port)))
+		if amf := gnb.DefaultAmf; amf != nil {
+			addr := amf.AmfIp
+			if addr == "" {
+				addr = amf.AmfHostName
+			}
+			fmt.Printf(", AMF: %v", net.JoinHostPort(addr, strconv.Itoa(amf.AmfPort)))
+		}
+		fmt.Println()
 
-		if config.Configuration.ExecInParallel == false {
-			profileWaitGrp.Wait()
+		ueOrder := "sequentially"
+		if profile.ExecInParallel {
+			ueOrder = "in parallel"
 		}
+		if profile.UePool != "" {
+			count := "all"
+			if profile.UeCount != 0 {
+				count = fmt.Sprint("up to ", profile.UeCount)
+			}
+			fmt.Printf("   UEs: %v from ue pool %v, executed %v\n", count,
+				profile.UePool, ueOrder)
+		} else if len(profile.Imsis) != 0 {
+			imsis, _ := profile.GetImsis()
+			fmt.Printf("   UEs: %v, from imsi list %v, executed %v\n", len(imsis),
+				strings.Join(profile.Imsis, ", "), ueOrder)
+		} else {
+			fmt.Printf("   UEs: %v, starting at imsi-%v, executed %v\n", profile.UeCount,
+				profile.StartImsi, ueOrder)
+		}
+		for i, stage := range profile.LoadSchedule {
+			load := "no UEs started"
+			if stage.ActiveUes != 0 {
+				load = fmt.Sprint(stage.ActiveUes, " UEs executing")
+			} else if stage.ArrivalRate != 0 {
+				load = fmt.Sprint(stage.ArrivalRate, " UEs started per second")
+			}
+			fmt.Printf("   Load stage %v: %v, %v seconds, %v\n", i+1,
+				stage.GetName(i), stage.Duration, load)
+		}
+		if len(profile.StartAfter) != 0 && config.ExecInParallel {
+			fmt.Println("   Starts after", strings.Join(profile.StartAfter, ", "))
+		}
+		if profile.PublishUePool != "" {
+			fmt.Println("   Registered UEs added to ue pool", profile.PublishUePool)
+		}
+		if profile.ProfileTimeout != 0 {
+			fmt.Println("   Aborted after", profile.ProfileTimeout, "seconds")
+		}
+
+		var procs []string
+		for _, proc := range profile.Procedures {
+			procs = append(procs, proc.String())
+		}
+		fmt.Println("   Procedures:", strings.Join(procs, ", "))
 	}
+	if step == 0 {
+		fmt.Println("No profile enabled")
+	}
+	return nil
+}
 
-	if config.Configuration.ExecInParallel == true {
-		profileWaitGrp.Wait()
+// listProfilesAction prints the configured profiles
+func listProfilesAction(c *cli.Context) error {
+	if err := loadConfig(c); err != nil {
+		return err
 	}
 
-	appWaitGrp.Wait()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tENABLED\tGNB\tSTART IMSI\tUE COUNT")
+	for _, profile := range factory.AppConfig.Configuration.Profiles {
+		startImsi, ueCount := profile.StartImsi, profile.UeCount
+		if len(profile.Imsis) != 0 {
+			imsis, err := profile.GetImsis()
+			if err == nil && len(imsis) != 0 {
+				startImsi, ueCount = imsis[0], len(imsis)
+			}
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", profile.Name,
+			profile.ProfileType, profile.Enable, profile.GnbName,
+			startImsi, ueCount)
+	}
+	return w.Flush()
+}
 
-	// TODO: To be removed. Allowing summary logger to dump the logs
-	time.Sleep(time.Second * 5)
+// compareAction compares the result files of two runs and reports the
+// regressions of the current run: profiles not executed or failing, newly
+// failing IMSIs, and the changes in the time taken by the procedures and in
+// the throughput. It fails if any profile regresses, so that it may be used
+// as a regression gate
+func compareAction(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("expected baseline and current result files")
+	}
+	baseline, err := notifier.ReadResultFile(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	current, err := notifier.ReadResultFile(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	comparisons := notifier.CompareRunResults(baseline, current,
+		c.Float64("latency-threshold"), c.Float64("throughput-threshold"))
+	regressions := 0
+	for _, cmp := range comparisons {
+		status := "OK"
+		if cmp.Regressed {
+			status = "REGRESSED"
+			regressions++
+		}
+		fmt.Printf("Profile: %v, %v\n", cmp.ProfileName, status)
+		if cmp.Missing {
+			fmt.Println("   Not executed in current run")
+			continue
+		}
+		fmt.Printf("   Result: %v -> %v\n", cmp.BaselineResult, cmp.CurrentResult)
+		if len(cmp.NewlyFailed) != 0 {
+			fmt.Println("   Newly failing:", strings.Join(cmp.NewlyFailed, ", "))
+		}
+		if len(cmp.NewlyPassed) != 0 {
+			fmt.Println("   Newly passing:", strings.Join(cmp.NewlyPassed, ", "))
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, stage := range cmp.Stages {
+			fmt.Fprintf(w, "   Stage: %v\t%v -> %v\t%+.1f%%\t%v\n", stage.Procedure,
+				time.Duration(stage.Baseline)*time.Microsecond,
+				time.Duration(stage.Current)*time.Microsecond, stage.Change,
+				regressedMark(stage.Regressed))
+		}
+		for _, tput := range cmp.Throughput {
+			fmt.Fprintf(w, "   %v Throughput:\t%.0f -> %.0f bps\t%+.1f%%\t%v\n",
+				tput.Direction, tput.Baseline, tput.Current, tput.Change,
+				regressedMark(tput.Regressed))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
 
+	if regressions != 0 {
+		return fmt.Errorf("%v of %v profile(s) regressed", regressions,
+			len(comparisons))
+	}
+	fmt.Println("No regression")
 	return nil
 }
 
+// decodeAction prints the structured breakdown of an NGAP PDU or NAS message
+// captured as hex, e.g. copied from a packet capture or a log. Ciphered NAS
+// messages are deciphered when the NAS ciphering key is provided
+func decodeAction(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("expected hex bytes to decode")
+	}
+	pdu, err := decoder.ParseHex(strings.Join(c.Args(), ""))
+	if err != nil {
+		return err
+	}
+
+	var sec *decoder.NasSecurity
+	if key := c.String("enc-key"); key != "" {
+		keyBytes, err := decoder.ParseHex(key)
+		if err != nil || len(keyBytes) != 16 {
+			return fmt.Errorf("invalid nas ciphering key, expected 16 octets")
+		}
+		sec = &decoder.NasSecurity{
+			CipheringAlg: uint8(c.Uint("enc-alg")),
+			Overflow:     uint16(c.Uint("count-overflow")),
+			Direction:    security.DirectionDownlink,
+		}
+		copy(sec.KnasEnc[:], keyBytes)
+		switch c.String("direction") {
+		case "dl":
+		case "ul":
+			sec.Direction = security.DirectionUplink
+		default:
+			return fmt.Errorf("invalid direction:%v", c.String("direction"))
+		}
+	}
+
+	return decoder.NewDecoder(os.Stdout, sec).Decode(c.String("type"), pdu)
+}
+
+// benchAction measures the NGAP message rate, the concurrent UEs and the
+// GTP-U packet rate the simulator sustains on its own, so that the
+// bottlenecks of gnbsim may be told apart from those of the core
+func benchAction(c *cli.Context) error {
+	opts := &bench.Options{
+		Duration:     c.Duration("duration"),
+		StepDuration: c.Duration("step-duration"),
+		Gnbs:         c.Int("gnbs"),
+		MaxUes:       c.Int("max-ues"),
+		LatencyLimit: c.Duration("latency-limit"),
+		PayloadSize:  c.Int("payload-size"),
+		N3BatchSize:  c.Int("n3-batch-size"),
+	}
+	report, err := bench.Run(opts)
+	if err != nil {
+		return err
+	}
+	report.Print(os.Stdout, opts)
+	return nil
+}
+
+func regressedMark(regressed bool) string {
+	if regressed {
+		return "REGRESSED"
+	}
+	return ""
+}
+
+func versionAction(c *cli.Context) error {
+	fmt.Println(c.App.Name, "version", c.App.Version)
+	return nil
+}
+
+// shellAction launches the interactive shell. The UE configuration is taken
+// from the profile selected through the "profile" flag, or from the first
+// configured profile
+func shellAction(c *cli.Context) error {
+	err := initialize(c)
+	if err != nil {
+		return err
+	}
+
+	var template *profctx.Profile
+	name := c.String("profile")
+	for _, profile := range factory.AppConfig.Configuration.Profiles {
+		if name == "" || profile.Name == name {
+			template = profile
+			break
+		}
+	}
+
+	sh, err := shell.NewShell(template, os.Stdout)
+	if err != nil {
+		logger.AppLog.Errorln("Failed to create shell:", err)
+		return err
+	}
+
+	sh.Run(os.Stdin)
+	return nil
+}
+
+// Shutdown deregisters the active UEs so that they are not left dangling in
+// the core network once the application exits
+func Shutdown() {
+	deadline := factory.AppConfig.Configuration.ShutdownDeadline
+	if deadline == 0 {
+		deadline = factory.DEFAULT_SHUTDOWN_DEADLINE
+	}
+
+	count := simue.ShutdownAllSimUes(time.Duration(deadline) * time.Second)
+	if err := realuectx.FlushStores(); err != nil {
+		logger.AppLog.Errorln("FlushStores returned:", err)
+	}
+	if count != 0 {
+		logger.AppLog.Warnln(count, "SimUe(s) not terminated within the shutdown deadline of",
+			deadline, "seconds")
+		return
+	}
+	logger.AppLog.Infoln("All active SimUes terminated")
+}
+
+func getCliCommands() []cli.Command {
+	return []cli.Command{
+		{
+			Name:   "run",
+			Usage:  "Execute the enabled profiles",
+			Action: runAction,
+			Flags: append(getCliFlags(), cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the execution plan without connecting to the AMF",
+			}),
+		},
+		{
+			Name:   "validate",
+			Usage:  "Check the configuration file without connecting to the AMF",
+			Action: validateAction,
+			Flags: append(getCliFlags(), cli.BoolFlag{
+				Name:  "provisioning",
+				Usage: "Fetch the subscribers through the provisioning interface and check their keys",
+			}),
+		},
+		{
+			Name:   "preflight",
+			Usage:  "Check the AMF and UPF endpoints without executing the profiles",
+			Action: preflightAction,
+			Flags:  getCliFlags(),
+		},
+		{
+			Name:   "list-profiles",
+			Usage:  "List the configured profiles",
+			Action: listProfilesAction,
+			Flags:  getCliFlags(),
+		},
+		{
+			Name:   "version",
+			Usage:  "Print the version",
+			Action: versionAction,
+		},
+		{
+			Name:      "compare",
+			Usage:     "Report the regressions of a run against a baseline run",
+			ArgsUsage: "[baseline result file] [current result file]",
+			Action:    compareAction,
+			Flags: []cli.Flag{
+				cli.Float64Flag{
+					Name:  "latency-threshold",
+					Usage: "Increase in percent of the time taken by a procedure reported as regression",
+					Value: notifier.DEFAULT_LATENCY_THRESHOLD,
+				},
+				cli.Float64Flag{
+					Name:  "throughput-threshold",
+					Usage: "Decrease in percent of the throughput reported as regression",
+					Value: notifier.DEFAULT_THROUGHPUT_THRESHOLD,
+				},
+			},
+		},
+		{
+			Name:      "decode",
+			Usage:     "Print the breakdown of an NGAP PDU or NAS message captured as hex",
+			ArgsUsage: "[hex bytes]",
+			Action:    decodeAction,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "type",
+					Usage: "Type of the PDU: auto, ngap or nas",
+					Value: decoder.PDU_TYPE_AUTO,
+				},
+				cli.StringFlag{
+					Name:  "enc-key",
+					Usage: "NAS ciphering key (K_NASenc) in hex, to decipher the NAS messages",
+				},
+				cli.UintFlag{
+					Name:  "enc-alg",
+					Usage: "NAS ciphering algorithm: 0 (NEA0), 1 (NEA1), 2 (NEA2) or 3 (NEA3)",
+					Value: uint(security.AlgCiphering128NEA2),
+				},
+				cli.UintFlag{
+					Name:  "count-overflow",
+					Usage: "Overflow of the NAS COUNT, the sequence number is taken from the message",
+				},
+				cli.StringFlag{
+					Name:  "direction",
+					Usage: "Direction of the NAS messages: ul or dl",
+					Value: "dl",
+				},
+			},
+		},
+		{
+			Name:   "shell",
+			Usage:  "Interactively execute the procedures for a single UE",
+			Action: shellAction,
+			Flags: append(getCliFlags(), cli.StringFlag{
+				Name:  "profile",
+				Usage: "Name of the profile used for UE configuration",
+			}),
+		},
+		{
+			Name:   "bench",
+			Usage:  "Measure the limits of the simulator against a loopback AMF and UPF, without a core",
+			Action: benchAction,
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "duration",
+					Usage: "Duration of the NGAP and GTP-U rate measurements",
+					Value: bench.DEFAULT_DURATION,
+				},
+				cli.DurationFlag{
+					Name:  "step-duration",
+					Usage: "Duration of each step of the concurrent SimUe ramp",
+					Value: bench.DEFAULT_STEP_DURATION,
+				},
+				cli.IntFlag{
+					Name:  "gnbs",
+					Usage: "UEs sending NGAP messages, served by a single gNB and by a gNB each",
+					Value: bench.DEFAULT_GNBS,
+				},
+				cli.IntFlag{
+					Name:  "max-ues",
+					Usage: "Upper limit of the concurrent SimUe ramp",
+					Value: bench.DEFAULT_MAX_UES,
+				},
+				cli.DurationFlag{
+					Name:  "latency-limit",
+					Usage: "P99 NGAP round trip time beyond which the latency of the SimUes is degraded",
+					Value: bench.DEFAULT_LATENCY_LIMIT,
+				},
+				cli.IntFlag{
+					Name:  "payload-size",
+					Usage: "Octets of user data carried by each G-PDU",
+					Value: bench.DEFAULT_PAYLOAD_SIZE,
+				},
+				cli.IntFlag{
+					Name:  "n3-batch-size",
+					Usage: "GTP-U packets read and written per system call, measured along with unbatched I/O",
+					Value: bench.DEFAULT_N3_BATCH_SIZE,
+				},
+			},
+		},
+	}
+}
+
 func getCliFlags() []cli.Flag {
 	return []cli.Flag{
 		cli.StringFlag{
@@ -149,6 +812,46 @@ func ListenAndLogSummary() {
 
 		logger.AppSummaryLog.Infoln("Profile Name:", msg.ProfileName, ", Profile Type:", msg.ProfileType)
 		logger.AppSummaryLog.Infoln("Ue's Passed:", msg.UePassedCount, ", Ue's Failed:", msg.UeFailedCount)
+		if dp := msg.DataPlane; dp != nil {
+			logger.AppSummaryLog.Infoln("Data Plane, Ue's with user data:", dp.UeCount)
+			logger.AppSummaryLog.Infof("UL Packets: %v, UL Bytes: %v, UL Throughput: %.0f bps",
+				dp.UlPkts, dp.UlBytes, dp.UlThroughput)
+			logger.AppSummaryLog.Infof("DL Packets: %v, DL Bytes: %v, DL Throughput: %.0f bps",
+				dp.DlPkts, dp.DlBytes, dp.DlThroughput)
+			logger.AppSummaryLog.Infoln("RTT P50:", dp.RttP50, ", P90:", dp.RttP90,
+				", P99:", dp.RttP99, ", Jitter:", dp.Jitter)
+		}
+
+		for _, stage := range msg.StageTimings {
+			logger.AppSummaryLog.Infoln("Stage:", stage.Procedure, ", Count:",
+				stage.Count, ", Min:", stage.Min, ", Avg:", stage.Avg, ", Max:",
+				stage.Max)
+		}
+
+		for _, stage := range msg.LoadStages {
+			logger.AppSummaryLog.Infoln("Load Stage:", stage.Name, ", Duration:",
+				stage.Duration.Round(time.Millisecond), ", Ue's Started:",
+				stage.UeStartedCount, ", Passed:", stage.UePassedCount, ", Failed:",
+				stage.UeFailedCount, ", Skipped:", stage.UeSkippedCount,
+				", Max Active:", stage.MaxActiveUes)
+			logger.AppSummaryLog.Infoln("Load Stage:", stage.Name, ", Latency Avg:",
+				stage.AvgLatency, ", Max:", stage.MaxLatency)
+		}
+
+		for _, tag := range msg.Tags {
+			logger.AppSummaryLog.Infoln("Tag:", tag.Tag, ", Ue's Passed:",
+				tag.UePassedCount, ", Ue's Failed:", tag.UeFailedCount,
+				", Latency Avg:", tag.AvgLatency, ", Max:", tag.MaxLatency)
+		}
+
+		if msg.NwPduSessMods != 0 || msg.NwPduSessRels != 0 {
+			logger.AppSummaryLog.Infoln("PDU Sessions modified by network:",
+				msg.NwPduSessMods, ", released by network:", msg.NwPduSessRels)
+		}
+
+		if msg.Retries != 0 {
+			logger.AppSummaryLog.Infoln("Procedures retried:", msg.Retries)
+		}
 
 		if len(msg.ErrorList) != 0 {
 			result = "FAIL"
@@ -158,5 +861,144 @@ func ListenAndLogSummary() {
 			}
 		}
 		logger.AppSummaryLog.Infoln("Profile Status:", result)
+
+		err := notifier.NotifyProfileSummary(msg)
+		if err != nil {
+			logger.AppSummaryLog.Errorln("Failed to notify webhook:", err)
+		}
+
+		err = notifier.WriteResultFile(msg)
+		if err != nil {
+			logger.AppSummaryLog.Errorln("Failed to write result file:", err)
+		}
+
+		err = notifier.WriteResultCsv(msg)
+		if err != nil {
+			logger.AppSummaryLog.Errorln("Failed to write result csv file:", err)
+		}
+	}
+}
+
+// logN2Health logs the health of the N2 association of the gNB, the kernel
+// statistics are logged when available
+func logN2Health(gnbName string, h *gnbctx.N2HealthDump) {
+	logger.AppSummaryLog.Infof("gNB Name: %v, N2 Association Up: %v, Restarts: %v, "+
+		"Losses: %v, Last Reconnect Time: %vms, Max Reconnect Time: %vms", gnbName,
+		h.Up, h.Restarts, h.Losses, h.LastReconnectTime, h.MaxReconnectTime)
+	if h.Srtt != nil {
+		logger.AppSummaryLog.Infof("gNB Name: %v, N2 SRTT: %vms, RTO: %vms, "+
+			"Max RTO: %vms, Retransmitted Chunks: %v", gnbName, *h.Srtt, *h.Rto,
+			*h.MaxRto, *h.Retransmissions)
+	}
+}
+
+// ReportInterimSummaries periodically logs the results accumulated so far by
+// the enabled profiles, along with the NGAP message rate achieved by the gNBs
+// and the health of their N2 associations. The summaries are also added to
+// the result file and posted to the webhook when configured. This provides
+// visibility into long running soaks, even if the application terminates
+// before the profiles are complete. The stats are sampled through cursors of
+// their own, leaving the other consumers unaffected
+func ReportInterimSummaries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	pacerCursors := make(map[*gnbctx.NgapPacer]*gnbctx.NgapPacerCursor)
+	statsCursors := make(map[*profctx.ProfileStats]*profctx.StatsCursor)
+	for range ticker.C {
+		summary := &notifier.InterimSummary{
+			Event:    notifier.INTERIM_SUMMARY_EVENT,
+			Time:     time.Now(),
+			Interval: uint32(interval.Seconds()),
+		}
+
+		for _, gnb := range factory.AppConfig.Configuration.Gnbs {
+			interimGnb := notifier.InterimGnb{Name: gnb.GnbName}
+			if gnb.NgapPacer != nil {
+				cursor, ok := pacerCursors[gnb.NgapPacer]
+				if !ok {
+					cursor = gnb.NgapPacer.NewCursor()
+					pacerCursors[gnb.NgapPacer] = cursor
+				}
+
+				sample := cursor.Sample()
+				logger.AppSummaryLog.Infof("gNB Name: %v, Total NGAP Messages Sent: %v, "+
+					"Last %v, NGAP Messages Sent: %v, Rate: %.2f/s", gnb.GnbName,
+					sample.SentCount, interval, sample.IntvlSentCount, sample.IntvlRate)
+				interimGnb.NgapSentCount = sample.SentCount
+				interimGnb.IntvlNgapSentCount = sample.IntvlSentCount
+				interimGnb.IntvlNgapRate = sample.IntvlRate
+			}
+
+			for _, amf := range gnb.GetAmfs() {
+				health := amf.GetN2Health()
+				logN2Health(gnb.GnbName, health)
+				interimGnb.N2 = append(interimGnb.N2, health)
+			}
+			summary.Gnbs = append(summary.Gnbs, interimGnb)
+		}
+
+		for _, profile := range factory.AppConfig.Configuration.Profiles {
+			if !profile.Enable || profile.Stats == nil {
+				continue
+			}
+
+			cursor, ok := statsCursors[profile.Stats]
+			if !ok {
+				cursor = profile.Stats.NewCursor()
+				statsCursors[profile.Stats] = cursor
+			}
+
+			sample := cursor.Sample()
+			logger.AppSummaryLog.Infoln("Interim Summary, Profile Name:", profile.Name,
+				", Profile Type:", profile.ProfileType)
+			logger.AppSummaryLog.Infoln("Total Ue's Passed:", sample.UePassedCount,
+				", Total Ue's Failed:", sample.UeFailedCount)
+			logger.AppSummaryLog.Infof("Last %v, Ue's Passed: %v, Ue's Failed: %v, Success Rate: %.2f%%",
+				interval, sample.IntvlPassedCount, sample.IntvlFailedCount,
+				sample.IntvlSuccessRate)
+			if sample.IntvlLatencySample != 0 {
+				logger.AppSummaryLog.Infof("Last %v, Latency P50: %v, P90: %v, P99: %v",
+					interval, sample.IntvlLatencyP50, sample.IntvlLatencyP90,
+					sample.IntvlLatencyP99)
+			}
+			for _, tag := range sample.Tags {
+				logger.AppSummaryLog.Infoln("Tag:", tag.Tag, ", Total Ue's Passed:",
+					tag.UePassedCount, ", Total Ue's Failed:", tag.UeFailedCount)
+			}
+
+			interimProfile := notifier.InterimProfile{
+				ProfileName:      profile.Name,
+				ProfileType:      profile.ProfileType,
+				UePassedCount:    sample.UePassedCount,
+				UeFailedCount:    sample.UeFailedCount,
+				IntvlPassedCount: sample.IntvlPassedCount,
+				IntvlFailedCount: sample.IntvlFailedCount,
+				IntvlSuccessRate: sample.IntvlSuccessRate,
+				IntvlLatencyP50:  sample.IntvlLatencyP50.Milliseconds(),
+				IntvlLatencyP90:  sample.IntvlLatencyP90.Milliseconds(),
+				IntvlLatencyP99:  sample.IntvlLatencyP99.Milliseconds(),
+			}
+			for _, tag := range sample.Tags {
+				interimProfile.Tags = append(interimProfile.Tags, notifier.Tag{
+					Name:          tag.Tag,
+					UePassedCount: tag.UePassedCount,
+					UeFailedCount: tag.UeFailedCount,
+					AvgLatency:    tag.AvgLatency.Milliseconds(),
+					MaxLatency:    tag.MaxLatency.Milliseconds(),
+				})
+			}
+			summary.Profiles = append(summary.Profiles, interimProfile)
+		}
+
+		err := notifier.WriteInterimSummary(summary)
+		if err != nil {
+			logger.AppSummaryLog.Errorln("Failed to write result file:", err)
+		}
+
+		err = notifier.NotifyInterimSummary(summary)
+		if err != nil {
+			logger.AppSummaryLog.Errorln("Failed to notify webhook:", err)
+		}
 	}
 }
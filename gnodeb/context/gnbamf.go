@@ -25,6 +25,16 @@ type GnbAmf struct {
 	AmfIp         string `yaml:"ipAddr"`
 	AmfName       string
 	AmfPort       int `yaml:"port"`
+
+	// Additional AMF IP addresses for the SCTP association (multi-homing)
+	AmfSecondaryIps []string `yaml:"secondaryIpAddrs"`
+
+	// Number of outbound streams negotiated for the SCTP association
+	NumOutStreams uint16
+
+	// Health of the SCTP association across its restarts
+	N2Health N2Health
+
 	/* Relative AMF Capacity */
 	RelCap          int64
 	ServedGuamiList []models.Guami
@@ -32,6 +42,10 @@ type GnbAmf struct {
 	/*Socket Connection*/
 	Conn net.Conn
 
+	// DTLS connection over the SCTP association, through which the NGAP
+	// messages are sent and received when DTLS is established
+	Dtls net.Conn
+
 	/* logger */
 	Log *logrus.Entry
 }
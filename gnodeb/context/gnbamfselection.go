@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/omec-project/openapi/models"
+)
+
+// Policies applied when no AMF matches the UE
+const (
+	// UE is served by the default AMF
+	AMF_FALLBACK_DEFAULT string = "default"
+
+	// UE is served by the available AMF with the highest relative capacity
+	AMF_FALLBACK_CAPACITY string = "capacity"
+
+	// Connection of the UE is rejected
+	AMF_FALLBACK_REJECT string = "reject"
+)
+
+// AmfSelectionConfig holds the policy of the AMF selection, applied when
+// additional AMFs are configured
+type AmfSelectionConfig struct {
+	// Policy applied when no AMF matches the UE, defaults to
+	// AMF_FALLBACK_DEFAULT
+	Fallback string `yaml:"fallback"`
+}
+
+// Validate checks the AMF selection configuration
+func (c *AmfSelectionConfig) Validate() error {
+	switch c.Fallback {
+	case "", AMF_FALLBACK_DEFAULT, AMF_FALLBACK_CAPACITY, AMF_FALLBACK_REJECT:
+		return nil
+	}
+	return fmt.Errorf("invalid amf selection fallback:%v, valid values are %v, %v and %v",
+		c.Fallback, AMF_FALLBACK_DEFAULT, AMF_FALLBACK_CAPACITY, AMF_FALLBACK_REJECT)
+}
+
+// GetAmfs returns the default AMF followed by the additional AMFs
+func (gnb *GNodeB) GetAmfs() []*GnbAmf {
+	var amfs []*GnbAmf
+	if gnb.DefaultAmf != nil {
+		amfs = append(amfs, gnb.DefaultAmf)
+	}
+	return append(amfs, gnb.Amfs...)
+}
+
+// SelectAmf selects the AMF to which the initial message of the UE is sent,
+// among the AMFs with which NG Setup is complete, TS 23.501 Section 6.3.5.
+// A UE registered with a 5G-GUTI is served by the AMF serving its GUAMI, or
+// else by an AMF of the same AMF set. Other UEs are served by the AMFs
+// supporting the PLMN and the slice of the UE, selected in proportion to
+// their relative capacity. The fallback policy applies when no AMF matches
+func (gnb *GNodeB) SelectAmf(guami *models.Guami, plmn *models.PlmnId,
+	snssai *models.Snssai) (*GnbAmf, error) {
+
+	if len(gnb.Amfs) == 0 {
+		return gnb.DefaultAmf, nil
+	}
+
+	var available []*GnbAmf
+	for _, amf := range gnb.GetAmfs() {
+		if amf.GetNgSetupStatus() && amf.IsN2Up() {
+			available = append(available, amf)
+		}
+	}
+
+	if guami != nil {
+		if amf := selectAmfByGuami(available, guami, false); amf != nil {
+			return amf, nil
+		}
+		if amf := selectAmfByGuami(available, guami, true); amf != nil {
+			return amf, nil
+		}
+	}
+
+	var candidates []*GnbAmf
+	for _, amf := range available {
+		if amf.supportsSlice(plmn, snssai) {
+			candidates = append(candidates, amf)
+		}
+	}
+	if amf := selectAmfByCapacity(candidates, true); amf != nil {
+		return amf, nil
+	}
+
+	fallback := AMF_FALLBACK_DEFAULT
+	if gnb.AmfSelection != nil && gnb.AmfSelection.Fallback != "" {
+		fallback = gnb.AmfSelection.Fallback
+	}
+	gnb.Log.Infof("No AMF matching guami:%+v, plmn:%+v, snssai:%+v, applying fallback:%v",
+		guami, plmn, snssai, fallback)
+	switch fallback {
+	case AMF_FALLBACK_CAPACITY:
+		if amf := selectAmfByCapacity(available, false); amf != nil {
+			return amf, nil
+		}
+	case AMF_FALLBACK_DEFAULT:
+		return gnb.DefaultAmf, nil
+	}
+	return nil, fmt.Errorf("no amf available for the ue")
+}
+
+// SelectAmfInSet selects an AMF of the AMF set other than the provided AMF,
+// among the AMFs with which NG Setup is complete, in proportion to their
+// relative capacity. Used when the AMF reroutes the NAS message of a UE to
+// the AMF set, TS 23.502 Section 4.2.2.2.3
+func (gnb *GNodeB) SelectAmfInSet(amfSetId uint16, exclude *GnbAmf) (*GnbAmf, error) {
+	var candidates []*GnbAmf
+	for _, amf := range gnb.GetAmfs() {
+		if amf == exclude || !amf.GetNgSetupStatus() || !amf.IsN2Up() {
+			continue
+		}
+		for _, served := range amf.ServedGuamiList {
+			id, err := strconv.ParseUint(served.AmfId, 16, 24)
+			if err == nil && uint16(id>>6)&0x3ff == amfSetId {
+				candidates = append(candidates, amf)
+				break
+			}
+		}
+	}
+	if amf := selectAmfByCapacity(candidates, true); amf != nil {
+		return amf, nil
+	}
+	return nil, fmt.Errorf("no amf available in amf set:%v", amfSetId)
+}
+
+// selectAmfByGuami returns the AMF serving the GUAMI, or an AMF of the same
+// AMF set (AMF Region ID and AMF Set ID) when sameSet is true
+func selectAmfByGuami(amfs []*GnbAmf, guami *models.Guami, sameSet bool) *GnbAmf {
+	for _, amf := range amfs {
+		for _, served := range amf.ServedGuamiList {
+			if !isPlmnEqual(served.PlmnId, guami.PlmnId) {
+				continue
+			}
+			if sameSet && isSameAmfSet(served.AmfId, guami.AmfId) {
+				return amf
+			}
+			if !sameSet && strings.EqualFold(served.AmfId, guami.AmfId) {
+				return amf
+			}
+		}
+	}
+	return nil
+}
+
+// selectAmfByCapacity returns one of the AMFs drawn in proportion to their
+// relative capacity when weighted is true, or else the AMF with the highest
+// relative capacity. Nil if no AMF is provided
+func selectAmfByCapacity(amfs []*GnbAmf, weighted bool) *GnbAmf {
+	if len(amfs) == 0 {
+		return nil
+	}
+
+	var total int64
+	selected := amfs[0]
+	for _, amf := range amfs {
+		total += amf.RelCap
+		if amf.RelCap > selected.RelCap {
+			selected = amf
+		}
+	}
+	if !weighted || len(amfs) == 1 {
+		return selected
+	}
+	if total == 0 {
+		return amfs[rand.Intn(len(amfs))]
+	}
+
+	draw := rand.Int63n(total)
+	for _, amf := range amfs {
+		if draw < amf.RelCap {
+			return amf
+		}
+		draw -= amf.RelCap
+	}
+	return selected
+}
+
+// supportsSlice returns true if the AMF supports the PLMN, and the slice
+// when provided, as per its PLMN support list
+func (amf *GnbAmf) supportsSlice(plmn *models.PlmnId, snssai *models.Snssai) bool {
+	for _, item := range amf.PlmnSupportList {
+		if plmn != nil && !isPlmnEqual(&item.PlmnId, plmn) {
+			continue
+		}
+		if snssai == nil {
+			return true
+		}
+		for _, supported := range item.SNssaiList {
+			if supported.Sst == snssai.Sst &&
+				strings.EqualFold(supported.Sd, snssai.Sd) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isPlmnEqual(a, b *models.PlmnId) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Mcc == b.Mcc && a.Mnc == b.Mnc
+}
+
+// isSameAmfSet returns true if the AMF IDs share the AMF Region ID (8 bits)
+// and the AMF Set ID (10 bits), i.e. differ only in the AMF Pointer (6 bits)
+func isSameAmfSet(a, b string) bool {
+	idA, errA := strconv.ParseUint(a, 16, 24)
+	idB, errB := strconv.ParseUint(b, 16, 24)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return idA>>6 == idB>>6
+}
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/omec-project/openapi/models"
+)
+
+const (
+	MIN_GNB_ID_BIT_LENGTH uint64 = 22
+	MAX_GNB_ID_BIT_LENGTH uint64 = 32
+	NR_CELL_ID_BIT_LENGTH uint64 = 36
+
+	// Cell identity local to the gNB of the first cell created when no cells
+	// are configured
+	DEFAULT_LOCAL_CELL_ID uint64 = 1
+)
+
+// NrCell holds the configuration of a cell served by the gNodeB
+type NrCell struct {
+	// NR Cell Identity (36 bits, hex string). As per TS 38.300 Section 8.2,
+	// the leftmost gNB ID bit length bits must carry the gNB ID
+	NrCellId string `yaml:"nrCellId"`
+
+	// Tracking Area Code of the cell (3 bytes hex string), defaults to the
+	// first supported TA
+	Tac string `yaml:"tac"`
+
+	Nci      uint64
+	TacBytes []byte
+}
+
+// GetGnbId returns the gNB ID and its bit length after validating them
+func (gnb *GNodeB) GetGnbId() (uint64, uint64, error) {
+	gnbId := gnb.RanId.GNbId
+	if gnb.RanId.PlmnId == nil || gnbId == nil {
+		return 0, 0, fmt.Errorf("plmn id or gnb id not configured")
+	}
+
+	if gnbId.BitLength < int32(MIN_GNB_ID_BIT_LENGTH) ||
+		gnbId.BitLength > int32(MAX_GNB_ID_BIT_LENGTH) {
+		return 0, 0, fmt.Errorf("invalid gnb id bit length: %v, expected %v-%v",
+			gnbId.BitLength, MIN_GNB_ID_BIT_LENGTH, MAX_GNB_ID_BIT_LENGTH)
+	}
+	bitLength := uint64(gnbId.BitLength)
+
+	base, err := gnb.getGnbIdBase()
+	if err != nil {
+		return 0, 0, err
+	}
+	value, err := strconv.ParseUint(gnbId.GNBValue, base, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid gnb id: %v", gnbId.GNBValue)
+	}
+	if value >= 1<<bitLength {
+		return 0, 0, fmt.Errorf("gnb id: %v exceeds the bit length: %v",
+			gnbId.GNBValue, bitLength)
+	}
+
+	return value, bitLength, nil
+}
+
+// InitCells validates the configured cells and derives the NR Cell Identity
+// and TAC of each of them. When no cells are configured, a cell is created
+// for each of the supported TAs
+func (gnb *GNodeB) InitCells() error {
+	gnbId, bitLength, err := gnb.GetGnbId()
+	if err != nil {
+		return err
+	}
+
+	if len(gnb.Cells) == 0 {
+		nci := gnbId<<(NR_CELL_ID_BIT_LENGTH-bitLength) | DEFAULT_LOCAL_CELL_ID
+		for _, ta := range gnb.SupportedTaList {
+			gnb.Cells = append(gnb.Cells, &NrCell{
+				NrCellId: fmt.Sprintf("%09x", nci),
+				Tac:      ta.Tac,
+			})
+			nci++
+		}
+		if len(gnb.Cells) == 0 {
+			return fmt.Errorf("supported ta list not configured")
+		}
+	}
+
+	for _, cell := range gnb.Cells {
+		cell.Nci, err = strconv.ParseUint(cell.NrCellId, 16, 64)
+		if err != nil || cell.Nci >= 1<<NR_CELL_ID_BIT_LENGTH {
+			return fmt.Errorf("invalid nr cell id: %v", cell.NrCellId)
+		}
+		if cell.Nci>>(NR_CELL_ID_BIT_LENGTH-bitLength) != gnbId {
+			return fmt.Errorf("nr cell id: %v does not contain the gnb id: %v",
+				cell.NrCellId, gnb.RanId.GNbId.GNBValue)
+		}
+
+		tac := cell.Tac
+		if tac == "" {
+			if len(gnb.SupportedTaList) == 0 {
+				return fmt.Errorf("tac not configured for nr cell id: %v",
+					cell.NrCellId)
+			}
+			tac = gnb.SupportedTaList[0].Tac
+		}
+		cell.TacBytes, err = hex.DecodeString(tac)
+		if err != nil || len(cell.TacBytes) != 3 {
+			return fmt.Errorf("invalid tac: %v for nr cell id: %v", tac,
+				cell.NrCellId)
+		}
+		cell.Tac = tac
+	}
+
+	return gnb.validateRanNode()
+}
+
+// GetServingCell returns the cell to which a UE is attached. UEs are
+// distributed based on the RAN UE NGAP ID over the cells of the requested TA
+// which broadcast the PLMN selected by the UE. All the cells are considered
+// when neither the TA nor the PLMN is provided
+func (gnb *GNodeB) GetServingCell(ranUeNgapId int64, tac string,
+	plmn *models.PlmnId) (*NrCell, error) {
+
+	var cells []*NrCell
+	for _, cell := range gnb.Cells {
+		if tac != "" && !strings.EqualFold(cell.Tac, tac) {
+			continue
+		}
+		if plmn != nil && !gnb.IsPlmnBroadcast(cell.Tac, plmn) {
+			continue
+		}
+		cells = append(cells, cell)
+	}
+	if len(cells) == 0 {
+		return nil, fmt.Errorf("no cell serves the tac: %v, plmn id: %v",
+			tac, plmn)
+	}
+	return cells[ranUeNgapId%int64(len(cells))], nil
+}
+
+// GetCell returns the cell with the provided NR Cell Identity
+func (gnb *GNodeB) GetCell(nrCellId string) (*NrCell, error) {
+	for _, cell := range gnb.Cells {
+		if strings.EqualFold(cell.NrCellId, nrCellId) {
+			return cell, nil
+		}
+	}
+	return nil, fmt.Errorf("no cell found with nr cell id: %v", nrCellId)
+}
+
+// IsPlmnBroadcast checks if the PLMN is broadcast in the provided TA
+func (gnb *GNodeB) IsPlmnBroadcast(tac string, plmn *models.PlmnId) bool {
+	for _, ta := range gnb.SupportedTaList {
+		if !strings.EqualFold(ta.Tac, tac) {
+			continue
+		}
+		for _, item := range ta.BroadcastPLMNList {
+			if item.PlmnId.Mcc == plmn.Mcc && item.PlmnId.Mnc == plmn.Mnc {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -7,10 +7,13 @@ package context
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/omec-project/gnbsim/common"
 	"github.com/omec-project/gnbsim/logger"
 
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
 	"github.com/sirupsen/logrus"
 )
 
@@ -21,11 +24,95 @@ type GnbCpUe struct {
 	Amf         *GnbAmf
 	Gnb         *GNodeB
 
+	// Cell to which the UE is attached, reported in the User Location
+	// Information
+	Cell *NrCell
+
+	// PLMN selected by the UE
+	Plmn *models.PlmnId
+
+	// Time at which the UE entered the current cell
+	CellEntryTime time.Time
+
+	// Location reporting on change of serving cell requested by the AMF, nil
+	// when not active
+	LocationReportingRequest *ngapType.LocationReportingRequestType
+
+	// Scripted cell changes of the UE and the index of the next one to be
+	// applied. Changes are applied while CellChangeQuit is open
+	CellChanges    []common.CellChange
+	NextCellChange int
+	CellChangeQuit chan struct{}
+
+	// UE Radio Capability reported to the AMF. UeRadioCapabilityKnownToAmf
+	// is set when the AMF provides the capability in the Initial Context
+	// Setup Request, in which case gNB does not report it
+	UeRadioCapability           []byte
+	UeRadioCapabilityKnownToAmf bool
+
+	// UE Security Capabilities provided by the AMF, reported to the AMF in
+	// Path Switch Request after Xn handover
+	UeSecurityCapabilities *ngapType.UESecurityCapabilities
+
+	// Security Key (KgNB) and UE Aggregate Maximum Bit Rate in bps provided
+	// by the AMF, updated by the UE Context Modification procedure
+	SecurityKey []byte
+	UeAmbrUl    int64
+	UeAmbrDl    int64
+
+	// RRC Inactive Transition Report Request provided by the AMF in the
+	// Initial Context Setup Request or the UE Context Modification Request,
+	// nil when not requested, cancelled or once the single RRC connected
+	// state report is sent
+	RrcStateReportRequest *ngapType.RRCInactiveTransitionReportRequest
+
+	// Handover of the UE in progress, either as the source or the target
+	// gNB UE context. It is retained by the source until its context is
+	// released
+	Handover *Handover
+
 	// TODO: Sync map is not needed as it is handled single threaded
 	GnbUpUes sync.Map
 
 	WaitGrp sync.WaitGroup
 
+	// When set, gNB responds to the next Initial Context Setup Request with
+	// Initial Context Setup Failure carrying this cause
+	IcsFailureCause *ngapType.Cause
+
+	// When set, gNB responds to each UE Context Modification Request with UE
+	// Context Modification Failure carrying this cause
+	UeCtxModFailureCause *ngapType.Cause
+
+	// Indicates that the UE context is driven by the lightweight UE workers
+	// of a profile, along with the contexts of other UEs, rather than by a
+	// routine of its own. Handlers do not block the routine in this case
+	Lightweight bool
+
+	// Indicates that the UE is in RRC Inactive state. NGAP UE context and
+	// the user plane resources are retained in this state
+	RrcInactive bool
+
+	// Last activity of the UE and its inactivity timer, which is stopped by
+	// closing InactivityQuit. InactivityReleaseRequested is set once the
+	// release of the UE context is requested on the expiry of the timer
+	Activity                   *UeActivity
+	InactivityTimer            *time.Timer
+	InactivityQuit             chan struct{}
+	InactivityReleaseRequested bool
+
+	// Trace activated by the AMF for the UE, nil when no trace is active
+	Trace *ngapType.TraceActivation
+
+	// Periodic report of the secondary RAT data usage of the UE, which is
+	// stopped by closing UsageReportQuit
+	UsageReportTimer *time.Timer
+	UsageReportQuit  chan struct{}
+
+	// Timeline of the UE recording the NGAP messages, nil when the recording
+	// is not enabled
+	Timeline *common.Timeline
+
 	// GnbCpUe writes messages to UE on this channel
 	WriteUeChan chan common.InterfaceMessage
 
@@ -42,6 +129,7 @@ func NewGnbCpUe(ngapId int64, gnb *GNodeB, amf *GnbAmf) *GnbCpUe {
 	gnbue.Amf = amf
 	gnbue.Gnb = gnb
 	gnbue.ReadChan = make(chan common.InterfaceMessage, 5)
+	gnbue.Activity = &UeActivity{}
 	gnbue.Log = logger.GNodeBLog.WithFields(logrus.Fields{"subcategory": "GnbCpUe",
 		logger.FieldGnbUeNgapId: ngapId})
 	gnbue.Log.Traceln("Context Created")
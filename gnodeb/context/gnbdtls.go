@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+)
+
+// DtlsConfig protects the SCTP associations of the gNB with the AMFs using
+// DTLS, in the style of RFC 6083. The NGAP messages are carried as DTLS
+// records once the handshake completes
+type DtlsConfig struct {
+	// Certificate and key presented to the AMF, no certificate is presented
+	// when not configured
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+
+	// CA certificate used to verify the AMF certificate. The AMF certificate
+	// is not verified when not configured
+	CaFile string `yaml:"caFile"`
+
+	// Association continues over plain SCTP when the DTLS handshake fails,
+	// else the connection with the AMF fails
+	FallbackToSctp bool `yaml:"fallbackToSctp"`
+}
+
+// Validate checks the DTLS configuration
+func (c *DtlsConfig) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("dtls certFile and keyFile must be configured together")
+	}
+	return nil
+}
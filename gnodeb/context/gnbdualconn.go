@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Share (in percent) of the user data volume of the PDU sessions carried by
+// the secondary node when not configured
+const DEFAULT_SECONDARY_SHARE uint32 = 50
+
+// DualConnectivityConfig makes the gNB act as the master node of NR-DC with a
+// simulated secondary node, co-located with the gNB on N3. The secondary node
+// terminates an additional downlink tunnel of each PDU session, requested
+// through PDU Session Resource Modify Indication, and its share of the user
+// data volume is reported through Secondary RAT Data Usage Report
+type DualConnectivityConfig struct {
+	// Additional downlink tunnel of the secondary node requested for each
+	// PDU session once established
+	AdditionalTunnel bool `yaml:"additionalTunnel"`
+
+	// Interval (in seconds) at which the secondary RAT data usage of the PDU
+	// sessions of a connected UE is reported, disabled when not set
+	UsageReportInterval uint32 `yaml:"usageReportInterval"`
+
+	// Share (in percent) of the user data volume carried by the secondary
+	// node, defaults to DEFAULT_SECONDARY_SHARE
+	SecondaryShare *uint32 `yaml:"secondaryShare"`
+
+	// The usage of the PDU sessions being released is reported before
+	// responding to the PDU Session Resource Release Command and the UE
+	// Context Release Command
+	ReportOnRelease bool `yaml:"reportOnRelease"`
+
+	// Volume reported for each PDU session in place of the share of the
+	// volume measured, and the volume reported for each QoS flow keyed by
+	// the QFI. QoS flows are not reported individually when not configured
+	SessionVolume  *UsageVolume           `yaml:"sessionVolume"`
+	QosFlowVolumes map[int64]*UsageVolume `yaml:"qosFlowVolumes"`
+}
+
+// UsageVolume is the user data volume (in octets) reported per usage report
+type UsageVolume struct {
+	Ul uint64 `yaml:"ul"`
+	Dl uint64 `yaml:"dl"`
+}
+
+// Validate checks the dual connectivity configuration
+func (c *DualConnectivityConfig) Validate() error {
+	if c.SecondaryShare != nil && *c.SecondaryShare > 100 {
+		return fmt.Errorf("invalid secondary share:%v, must not exceed 100",
+			*c.SecondaryShare)
+	}
+	for qfi, volume := range c.QosFlowVolumes {
+		if qfi < 0 || qfi > 63 {
+			return fmt.Errorf("invalid qos flow volume qfi:%v, valid range is 0 to 63", qfi)
+		}
+		if volume == nil {
+			return fmt.Errorf("qos flow volume not configured for qfi:%v", qfi)
+		}
+	}
+	return nil
+}
+
+// IsUsageReported reports whether the secondary RAT data usage is reported,
+// periodically or on release
+func (c *DualConnectivityConfig) IsUsageReported() bool {
+	return c.UsageReportInterval != 0 || c.ReportOnRelease
+}
+
+// GetSecondaryShare returns the share (in percent) of the user data volume
+// carried by the secondary node
+func (c *DualConnectivityConfig) GetSecondaryShare() uint32 {
+	if c.SecondaryShare == nil {
+		return DEFAULT_SECONDARY_SHARE
+	}
+	return *c.SecondaryShare
+}
+
+// UsageCounter counts the user data volume of a PDU session since the last
+// usage report. It is updated by the GnbUpUe routine and read by the GnbCpUe
+// routine of the UE
+type UsageCounter struct {
+	// Octets, accessed atomically
+	ul uint64
+	dl uint64
+
+	// Start of the period being counted, accessed by GnbCpUe only
+	start time.Time
+}
+
+// UsagePeriod is the user data volume of a PDU session over a time period
+type UsagePeriod struct {
+	Start    time.Time
+	End      time.Time
+	UlOctets uint64
+	DlOctets uint64
+}
+
+func NewUsageCounter() *UsageCounter {
+	return &UsageCounter{start: time.Now()}
+}
+
+// AddUl counts the uplink octets
+func (c *UsageCounter) AddUl(octets int) {
+	if c != nil {
+		atomic.AddUint64(&c.ul, uint64(octets))
+	}
+}
+
+// AddDl counts the downlink octets
+func (c *UsageCounter) AddDl(octets int) {
+	if c != nil {
+		atomic.AddUint64(&c.dl, uint64(octets))
+	}
+}
+
+// Take returns the volume counted since the previous call, and starts
+// counting a new period
+func (c *UsageCounter) Take() UsagePeriod {
+	now := time.Now()
+	period := UsagePeriod{
+		Start:    c.start,
+		End:      now,
+		UlOctets: atomic.SwapUint64(&c.ul, 0),
+		DlOctets: atomic.SwapUint64(&c.dl, 0),
+	}
+	c.start = now
+	return period
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sort"
+)
+
+// GnbDump is the live state of a gNB and its UE contexts, serialized for
+// debugging stuck runs. The UE contexts are owned by their own routines,
+// hence the dump is a best effort snapshot which may be momentarily stale
+type GnbDump struct {
+	Name string       `json:"name"`
+	Ues  []*GnbUeDump `json:"ues"`
+
+	// Count of the messages quarantined by the gNB
+	QuarantinedMsgs uint64 `json:"quarantinedMsgs"`
+
+	// Count of the simulated restarts of the gNB
+	Restarts uint `json:"restarts"`
+
+	// Health of the SCTP association with the default AMF
+	N2 *N2HealthDump `json:"n2,omitempty"`
+}
+
+// GnbUeDump is the state of a gNB UE context
+type GnbUeDump struct {
+	GnbUeNgapId        int64                `json:"gnbUeNgapId"`
+	AmfUeNgapId        int64                `json:"amfUeNgapId"`
+	Supi               string               `json:"supi"`
+	NrCellId           string               `json:"nrCellId,omitempty"`
+	RrcInactive        bool                 `json:"rrcInactive"`
+	UeAmbrUl           int64                `json:"ueAmbrUl,omitempty"`
+	UeAmbrDl           int64                `json:"ueAmbrDl,omitempty"`
+	HandoverInProgress bool                 `json:"handoverInProgress"`
+	PduSessions        []*GnbPduSessionDump `json:"pduSessions"`
+}
+
+// GnbPduSessionDump is the user plane state of a PDU session of a gNB UE
+type GnbPduSessionDump struct {
+	PduSessId       int64  `json:"pduSessId"`
+	DlTeid          uint32 `json:"dlTeid"`
+	SecondaryDlTeid uint32 `json:"secondaryDlTeid,omitempty"`
+	UlTeid          uint32 `json:"ulTeid"`
+	Upf             string `json:"upf,omitempty"`
+}
+
+// GetDump returns the state of the gNB and its UE contexts, ordered by the
+// RAN UE NGAP ID
+func (gnb *GNodeB) GetDump() *GnbDump {
+	dump := &GnbDump{Name: gnb.GnbName, Ues: []*GnbUeDump{}}
+	dump.QuarantinedMsgs = gnb.GetQuarantinedCount()
+	dump.Restarts, _ = gnb.GetRestartCount()
+	if gnb.DefaultAmf != nil {
+		dump.N2 = gnb.DefaultAmf.GetN2Health()
+	}
+	if gnb.GnbUes == nil {
+		return dump
+	}
+
+	gnb.GnbUes.RangeGnbCpUes(func(gnbue *GnbCpUe) {
+		ueDump := &GnbUeDump{
+			GnbUeNgapId:        gnbue.GnbUeNgapId,
+			AmfUeNgapId:        gnbue.AmfUeNgapId,
+			Supi:               gnbue.Supi,
+			RrcInactive:        gnbue.RrcInactive,
+			UeAmbrUl:           gnbue.UeAmbrUl,
+			UeAmbrDl:           gnbue.UeAmbrDl,
+			HandoverInProgress: gnbue.Handover != nil,
+			PduSessions:        []*GnbPduSessionDump{},
+		}
+		if gnbue.Cell != nil {
+			ueDump.NrCellId = gnbue.Cell.NrCellId
+		}
+		gnbue.GnbUpUes.Range(func(key, value interface{}) bool {
+			upue := value.(*GnbUpUe)
+			sessDump := &GnbPduSessionDump{
+				PduSessId:       upue.PduSessId,
+				DlTeid:          upue.DlTeid,
+				SecondaryDlTeid: upue.SecondaryDlTeid,
+				UlTeid:          upue.UlTeid,
+			}
+			if upue.Upf != nil {
+				sessDump.Upf = upue.Upf.UpfIpString
+			}
+			ueDump.PduSessions = append(ueDump.PduSessions, sessDump)
+			return true
+		})
+		sort.Slice(ueDump.PduSessions, func(i, j int) bool {
+			return ueDump.PduSessions[i].PduSessId < ueDump.PduSessions[j].PduSessId
+		})
+		dump.Ues = append(dump.Ues, ueDump)
+	})
+
+	sort.Slice(dump.Ues, func(i, j int) bool {
+		return dump.Ues[i].GnbUeNgapId < dump.Ues[j].GnbUeNgapId
+	})
+	return dump
+}
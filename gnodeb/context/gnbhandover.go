@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/omec-project/gnbsim/common"
+
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// Handover types. Xn handover is performed between the gNB UE contexts and
+// completed with Path Switch Request, N2 handover is prepared and executed
+// through the AMF
+const (
+	HANDOVER_XN string = "xn"
+	HANDOVER_N2 string = "n2"
+)
+
+// Outcomes of N2 handover. The handover is executed on success, whereas the
+// source gNB cancels it once the Handover Command is received on cancel, and
+// the target gNB rejects the Handover Request on preparation failure
+const (
+	HANDOVER_OUTCOME_SUCCESS             string = "success"
+	HANDOVER_OUTCOME_CANCEL              string = "cancel"
+	HANDOVER_OUTCOME_PREPARATION_FAILURE string = "preparation-failure"
+)
+
+// Length of the handover identifier carried in the RRC container of the
+// source to target transparent container
+const HANDOVER_ID_LENGTH int = 8
+
+var (
+	// handovers tracks the handovers in progress, keyed by the handover
+	// identifier. It lets the target gNB correlate the Handover Request
+	// received from the AMF with the source gNB UE context
+	handovers      sync.Map
+	nextHandoverId uint64
+)
+
+// Handover holds the state of a UE moving from the source gNB UE context to
+// the target cell
+type Handover struct {
+	Id         uint64
+	Type       string
+	TargetGnb  *GNodeB
+	TargetCell *NrCell
+
+	// One of the handover outcomes, N2 handover only
+	Outcome string
+
+	// Source gNB UE context, set once the handover is initiated
+	Source *GnbCpUe
+
+	// NGAP causes of the Handover Required and the Handover Failure, the
+	// default causes are used when nil
+	RequiredCause *ngapType.Cause
+	FailureCause  *ngapType.Cause
+
+	// Target gNB UE context, created by the target gNB, and whether the UE
+	// is handed over to it. These are accessed from the source as well as
+	// the target gNB routines
+	target   *GnbCpUe
+	executed bool
+	lock     sync.Mutex
+}
+
+// HandoverMessage carries the handover between SimUe and the source and the
+// target gNB UE contexts
+type HandoverMessage struct {
+	common.DefaultMessage
+	Handover *Handover
+}
+
+// AddHandover assigns an identifier to the handover and tracks it until it
+// is removed
+func AddHandover(ho *Handover) {
+	ho.Id = atomic.AddUint64(&nextHandoverId, 1)
+	handovers.Store(ho.Id, ho)
+}
+
+// GetHandover returns the handover in progress with the provided identifier,
+// or nil if not found
+func GetHandover(id uint64) *Handover {
+	val, ok := handovers.Load(id)
+	if !ok {
+		return nil
+	}
+	return val.(*Handover)
+}
+
+// RemoveHandover stops tracking the handover
+func RemoveHandover(ho *Handover) {
+	handovers.Delete(ho.Id)
+}
+
+func (ho *Handover) SetTarget(target *GnbCpUe) {
+	ho.lock.Lock()
+	defer ho.lock.Unlock()
+	ho.target = target
+}
+
+func (ho *Handover) GetTarget() *GnbCpUe {
+	ho.lock.Lock()
+	defer ho.lock.Unlock()
+	return ho.target
+}
+
+// SetExecuted marks that the UE is handed over to the target gNB UE context,
+// after which the source no longer serves the UE
+func (ho *Handover) SetExecuted() {
+	ho.lock.Lock()
+	defer ho.lock.Unlock()
+	ho.executed = true
+}
+
+func (ho *Handover) IsExecuted() bool {
+	ho.lock.Lock()
+	defer ho.lock.Unlock()
+	return ho.executed
+}
+
+// IsIntraGnb reports whether the target cell is served by the source gNB
+func (ho *Handover) IsIntraGnb() bool {
+	return ho.Source != nil && ho.Source.Gnb == ho.TargetGnb
+}
+
+// GetRrcContainer returns the RRC container carried in the transparent
+// containers of N2 handover, which holds the handover identifier in place of
+// the RRC messages
+func (ho *Handover) GetRrcContainer() []byte {
+	b := make([]byte, HANDOVER_ID_LENGTH)
+	binary.BigEndian.PutUint64(b, ho.Id)
+	return b
+}
+
+// GetHandoverId returns the handover identifier held in the RRC container
+func GetHandoverId(rrcContainer []byte) (uint64, error) {
+	if len(rrcContainer) != HANDOVER_ID_LENGTH {
+		return 0, fmt.Errorf("invalid rrc container length:%v, expected:%v",
+			len(rrcContainer), HANDOVER_ID_LENGTH)
+	}
+	return binary.BigEndian.Uint64(rrcContainer), nil
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ResolveLocalAddrs takes the N2 and N3 IP addresses which are not configured
+// from the network interfaces to which the N2 and N3 sockets are bound
+func (gnb *GNodeB) ResolveLocalAddrs() (err error) {
+	if gnb.GnbN2Interface != "" && gnb.GnbN2Ip == "" {
+		gnb.GnbN2Ip, err = GetInterfaceIp(gnb.GnbN2Interface)
+		if err != nil {
+			return fmt.Errorf("n2 interface: %v", err)
+		}
+	}
+	if gnb.GnbN3Interface != "" && gnb.GnbN3Ip == "" {
+		gnb.GnbN3Ip, err = GetInterfaceIp(gnb.GnbN3Interface)
+		if err != nil {
+			return fmt.Errorf("n3 interface: %v", err)
+		}
+	}
+	return nil
+}
+
+// IsN3Ipv6 returns true if the N3 address of the gNB is an IPv6 address
+func (gnb *GNodeB) IsN3Ipv6() bool {
+	ip := net.ParseIP(gnb.GnbN3Ip)
+	return ip != nil && ip.To4() == nil
+}
+
+// GetInterfaceIp returns the first IPv4 address of the network interface, or
+// its first IPv6 address when it has no IPv4 address. Link local addresses
+// are skipped
+func GetInterfaceIp(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid interface %v: %v", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch addresses of interface %v: %v", name, err)
+	}
+
+	var ipv6 string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+		if ipv6 == "" {
+			ipv6 = ipNet.IP.String()
+		}
+	}
+	if ipv6 == "" {
+		return "", fmt.Errorf("no ip address assigned to interface %v", name)
+	}
+	return ipv6, nil
+}
+
+// BindToDevice returns the function binding a socket to the network
+// interface, as set on the Control of net.ListenConfig and net.Dialer. The
+// socket is not bound when the interface is empty
+func BindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	if iface == "" {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		ctrlErr := c.Control(func(fd uintptr) {
+			err = syscall.BindToDevice(int(fd), iface)
+		})
+		if ctrlErr != nil {
+			return ctrlErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to bind to interface %v: %v", iface, err)
+		}
+		return nil
+	}
+}
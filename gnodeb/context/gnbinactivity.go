@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// UeActivity records the time of the last user plane or NAS activity of a
+// UE. It is updated by the GnbCpUe and the GnbUpUe routines of the UE and
+// read by GnbCpUe once the inactivity timer expires
+type UeActivity struct {
+	// Unix time in nanoseconds, accessed atomically
+	last int64
+}
+
+// Touch records an activity of the UE
+func (a *UeActivity) Touch() {
+	if a != nil {
+		atomic.StoreInt64(&a.last, time.Now().UnixNano())
+	}
+}
+
+// GetIdleTime returns the time elapsed since the last activity of the UE
+func (a *UeActivity) GetIdleTime() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&a.last)))
+}
@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/util/test"
+)
+
+// N2Health tracks the SCTP association with the AMF across its restarts, so
+// that the N2 instability of the core is detected during long soak tests
+type N2Health struct {
+	lock sync.Mutex
+
+	// Socket of the association while it is up, through which the kernel
+	// statistics are queried. 0 when the statistics are not available, i.e.
+	// the association is not set up with the SCTP parameters
+	fd int
+	up bool
+
+	establishments uint
+	losses         uint
+
+	// Time at which the association went down, and the times taken to
+	// reestablish it
+	downSince     time.Time
+	lastReconnect time.Duration
+	maxReconnect  time.Duration
+}
+
+// N2HealthDump is the health of the SCTP association with the AMF. The
+// times are in milliseconds, the kernel statistics are omitted when not
+// available
+type N2HealthDump struct {
+	Amf string `json:"amf"`
+	Up  bool   `json:"up"`
+
+	// Count of the association restarts, and of the associations lost, i.e.
+	// terminated by the AMF or the network
+	Restarts uint `json:"restarts"`
+	Losses   uint `json:"losses"`
+
+	LastReconnectTime int64 `json:"lastReconnectTime,omitempty"`
+	MaxReconnectTime  int64 `json:"maxReconnectTime,omitempty"`
+
+	// Smoothed RTT, updated by the heartbeats, and the RTO of the primary
+	// path, the maximum RTO observed since the previous sample and the count
+	// of the retransmitted chunks
+	Srtt            *uint32 `json:"srtt,omitempty"`
+	Rto             *uint32 `json:"rto,omitempty"`
+	MaxRto          *uint64 `json:"maxRto,omitempty"`
+	Retransmissions *uint64 `json:"retransmissions,omitempty"`
+}
+
+// IsN2Up returns true while the association with the AMF is up
+func (amf *GnbAmf) IsN2Up() bool {
+	amf.N2Health.lock.Lock()
+	defer amf.N2Health.lock.Unlock()
+	return amf.N2Health.up
+}
+
+// SetN2Up records that the association with the AMF is established over the
+// provided socket, 0 if the socket is not known
+func (amf *GnbAmf) SetN2Up(fd int) {
+	h := &amf.N2Health
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.fd = fd
+	h.up = true
+	h.establishments++
+	if !h.downSince.IsZero() {
+		h.lastReconnect = time.Since(h.downSince)
+		if h.lastReconnect > h.maxReconnect {
+			h.maxReconnect = h.lastReconnect
+		}
+		h.downSince = time.Time{}
+	}
+}
+
+// SetN2Down records that the association with the AMF is terminated, lost
+// being set unless it is closed by the gNB
+func (amf *GnbAmf) SetN2Down(lost bool) {
+	h := &amf.N2Health
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if !h.up {
+		return
+	}
+	h.fd = 0
+	h.up = false
+	h.downSince = time.Now()
+	if lost {
+		h.losses++
+	}
+}
+
+// GetN2Health returns the health of the association with the AMF, along with
+// its kernel statistics while it is up
+func (amf *GnbAmf) GetN2Health() *N2HealthDump {
+	h := &amf.N2Health
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	dump := &N2HealthDump{
+		Amf:               amf.AmfIp,
+		Up:                h.up,
+		Losses:            h.losses,
+		LastReconnectTime: h.lastReconnect.Milliseconds(),
+		MaxReconnectTime:  h.maxReconnect.Milliseconds(),
+	}
+	if h.establishments > 1 {
+		dump.Restarts = h.establishments - 1
+	}
+	if h.fd == 0 {
+		return dump
+	}
+
+	stats, err := test.GetSctpAssocStats(h.fd)
+	if err != nil {
+		amf.Log.Warnln("GetSctpAssocStats returned:", err)
+		return dump
+	}
+	dump.Srtt = &stats.Srtt
+	dump.Rto = &stats.Rto
+	dump.MaxRto = &stats.MaxRto
+	dump.Retransmissions = &stats.RtxChunks
+	return dump
+}
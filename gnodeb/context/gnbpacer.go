@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sync"
+	"time"
+)
+
+// NgapRateLimitConfig limits the rate of the NGAP messages sent by the gNB
+// to the AMF, irrespective of the number of active UEs
+type NgapRateLimitConfig struct {
+	// Messages per second
+	Rate float64 `yaml:"rate"`
+
+	// Number of messages which may be sent back to back, defaults to 1
+	Burst uint32 `yaml:"burst"`
+}
+
+// NgapPacer paces the outgoing NGAP messages of a gNB through a token bucket
+// and counts the messages sent to report the achieved rate. Messages are not
+// paced when the rate limit is not configured
+type NgapPacer struct {
+	lock sync.Mutex
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// Cumulative count of the messages sent, and the time since which they
+	// are counted
+	sentCount uint64
+	start     time.Time
+}
+
+// NgapPacerCursor samples NgapPacer on behalf of a consumer. Each sample
+// holds the messages sent since the previous sample of the same cursor
+type NgapPacerCursor struct {
+	pacer *NgapPacer
+
+	// Count and time at the previous sample
+	sentCount uint64
+	last      time.Time
+}
+
+// NgapPacerSample is a point in time snapshot of NgapPacer
+type NgapPacerSample struct {
+	SentCount      uint64
+	IntvlSentCount uint64
+	IntvlRate      float64
+}
+
+func NewNgapPacer(config *NgapRateLimitConfig) *NgapPacer {
+	pacer := &NgapPacer{}
+	if config != nil && config.Rate > 0 {
+		pacer.rate = config.Rate
+		pacer.burst = float64(config.Burst)
+		if pacer.burst < 1 {
+			pacer.burst = 1
+		}
+	}
+	pacer.tokens = pacer.burst
+	pacer.last = time.Now()
+	pacer.start = pacer.last
+	return pacer
+}
+
+// Wait blocks until the message may be sent as per the rate limit, and
+// counts it as sent
+func (p *NgapPacer) Wait() {
+	p.lock.Lock()
+	p.sentCount++
+	if p.rate == 0 {
+		p.lock.Unlock()
+		return
+	}
+
+	now := time.Now()
+	p.tokens += now.Sub(p.last).Seconds() * p.rate
+	if p.tokens > p.burst {
+		p.tokens = p.burst
+	}
+	p.last = now
+
+	// Token is reserved right away, so that the concurrent senders are
+	// served in the order of arrival
+	p.tokens--
+	var wait time.Duration
+	if p.tokens < 0 {
+		wait = time.Duration(-p.tokens / p.rate * float64(time.Second))
+	}
+	p.lock.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// NewCursor returns a cursor sampling the message counts, its first sample
+// holds the messages sent since the pacer was created
+func (p *NgapPacer) NewCursor() *NgapPacerCursor {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return &NgapPacerCursor{pacer: p, last: p.start}
+}
+
+// Sample returns a snapshot of the message counts, along with the messages
+// sent since the previous sample of the cursor
+func (c *NgapPacerCursor) Sample() *NgapPacerSample {
+	p := c.pacer
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	sample := &NgapPacerSample{
+		SentCount:      p.sentCount,
+		IntvlSentCount: p.sentCount - c.sentCount,
+	}
+	if elapsed := now.Sub(c.last).Seconds(); elapsed > 0 {
+		sample.IntvlRate = float64(sample.IntvlSentCount) / elapsed
+	}
+
+	c.sentCount = p.sentCount
+	c.last = now
+	return sample
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"github.com/omec-project/gnbsim/common"
+)
+
+// FiveGSTmsi is the 5G-S-TMSI with which the AMF pages the UE, TS 23.003
+// Section 2.11
+type FiveGSTmsi struct {
+	AmfSetId   uint16
+	AmfPointer uint8
+	Tmsi       uint32
+}
+
+// AddPagingUe registers the UE in CM-IDLE state to be notified on the
+// provided channel when paged with the 5G-S-TMSI
+func (gnb *GNodeB) AddPagingUe(tmsi FiveGSTmsi, ch chan common.InterfaceMessage) {
+	gnb.pagingLock.Lock()
+	defer gnb.pagingLock.Unlock()
+
+	if gnb.pagingUes == nil {
+		gnb.pagingUes = make(map[FiveGSTmsi]chan common.InterfaceMessage)
+	}
+	gnb.pagingUes[tmsi] = ch
+}
+
+// RemovePagingUe stops notifying the UE of the paging
+func (gnb *GNodeB) RemovePagingUe(tmsi FiveGSTmsi) {
+	gnb.pagingLock.Lock()
+	defer gnb.pagingLock.Unlock()
+
+	delete(gnb.pagingUes, tmsi)
+}
+
+// GetPagingUe returns the channel of the UE listening for the paging with the
+// 5G-S-TMSI, nil if no such UE exists
+func (gnb *GNodeB) GetPagingUe(tmsi FiveGSTmsi) chan common.InterfaceMessage {
+	gnb.pagingLock.Lock()
+	defer gnb.pagingLock.Unlock()
+
+	return gnb.pagingUes[tmsi]
+}
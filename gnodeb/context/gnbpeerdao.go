@@ -35,7 +35,7 @@ func NewGnbPeerDao() *GnbPeerDao {
 
 // GetGnbUpf returns the GnbUpf instance corresponding to provided IP
 func (dao *GnbPeerDao) GetGnbUpf(ip string) *GnbUpf {
-	dao.Log.Infoln("Fetching GnbUpf corresponding to IP:", ip)
+	dao.Log.Traceln("Fetching GnbUpf corresponding to IP:", ip)
 	val, ok := dao.gnbUpfMap.Load(ip)
 	if ok {
 		return val.(*GnbUpf)
@@ -46,6 +46,12 @@ func (dao *GnbPeerDao) GetGnbUpf(ip string) *GnbUpf {
 }
 
 func (dao *GnbPeerDao) GetOrAddGnbUpf(ip string) (*GnbUpf, bool) {
+	// The UPF is added once and then looked up for every PDU session, hence
+	// the lock is only acquired if the UPF is not found
+	if val, ok := dao.gnbUpfMap.Load(ip); ok {
+		return val.(*GnbUpf), false
+	}
+
 	// Though it is a sync map, we need to acquire lock because this function
 	// can be called from multiple Go routines, in which case the fetch + add
 	// operation should be atomic
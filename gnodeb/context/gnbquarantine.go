@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sync"
+	"time"
+)
+
+// Maximum number of quarantined messages retained for inspection, the older
+// messages are dropped while the count keeps growing
+const MAX_QUARANTINED_MSGS int = 100
+
+// QuarantinedMsg is a message which failed to decode or crashed the routine
+// processing it, set aside instead of being processed further
+type QuarantinedMsg struct {
+	Time time.Time `json:"time"`
+
+	// RAN UE NGAP ID of the UE context processing the message, 0 if the
+	// message was not yet routed to a UE context
+	GnbUeNgapId int64  `json:"gnbUeNgapId,omitempty"`
+	Event       string `json:"event,omitempty"`
+	Reason      string `json:"reason"`
+
+	// Raw NGAP PDU, if the message was received over N2
+	Pdu []byte `json:"pdu,omitempty"`
+}
+
+// Quarantine holds the messages quarantined by a gNB and their count
+type Quarantine struct {
+	lock  sync.Mutex
+	count uint64
+	msgs  []*QuarantinedMsg
+}
+
+// QuarantineMsg quarantines a message and returns the count of the messages
+// quarantined by the gNB so far. The PDU is copied, as the received octets are
+// held in a buffer reused for the subsequent messages
+func (gnb *GNodeB) QuarantineMsg(msg *QuarantinedMsg) uint64 {
+	if msg.Pdu != nil {
+		msg.Pdu = append([]byte(nil), msg.Pdu...)
+	}
+
+	q := &gnb.Quarantine
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	msg.Time = time.Now()
+	q.count++
+	if len(q.msgs) == MAX_QUARANTINED_MSGS {
+		q.msgs = q.msgs[1:]
+	}
+	q.msgs = append(q.msgs, msg)
+	return q.count
+}
+
+// GetQuarantinedCount returns the count of the messages quarantined by the gNB
+func (gnb *GNodeB) GetQuarantinedCount() uint64 {
+	gnb.Quarantine.lock.Lock()
+	defer gnb.Quarantine.lock.Unlock()
+	return gnb.Quarantine.count
+}
+
+// GetQuarantinedMsgs returns the most recent messages quarantined by the gNB,
+// oldest first
+func (gnb *GNodeB) GetQuarantinedMsgs() []*QuarantinedMsg {
+	gnb.Quarantine.lock.Lock()
+	defer gnb.Quarantine.lock.Unlock()
+
+	msgs := make([]*QuarantinedMsg, len(gnb.Quarantine.msgs))
+	copy(msgs, gnb.Quarantine.msgs)
+	return msgs
+}
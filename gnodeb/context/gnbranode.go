@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Types of the RAN node presented to the AMF
+const (
+	RAN_NODE_TYPE_GNB    string = "gnb"
+	RAN_NODE_TYPE_GNB_CU string = "gnb-cu"
+)
+
+// Formats of the configured gNB ID value
+const (
+	GNB_ID_FORMAT_HEX     string = "hex"
+	GNB_ID_FORMAT_DECIMAL string = "decimal"
+)
+
+// RanNodeConfig selects how the gNB presents itself to the AMF. As a gNB-CU,
+// the gNB terminates NG on behalf of the gNB-DUs serving the configured cells,
+// TS 38.401 Section 6.1. NGAP carries no indication of the split, the AMF
+// identifies the gNB-CU by the Global RAN Node ID and the RAN node name
+type RanNodeConfig struct {
+	// gnb or gnb-cu, gnb when not configured. The cells served by the
+	// gNB-DUs are to be configured for a gNB-CU
+	Type string `yaml:"type"`
+
+	// RAN node name sent in the NG Setup Request, e.g. the gNB-CU name. The
+	// gNB name is sent when not configured
+	Name string `yaml:"name"`
+
+	// Format of the configured gNB ID value, hex or decimal. Operators
+	// commonly provision the gNB-CU identifiers in decimal. Hex when not
+	// configured
+	GnbIdFormat string `yaml:"gnbIdFormat"`
+
+	// NR Cell Identities of the cells whose TAs are advertised in the
+	// Supported TA List of the NG Setup Request, e.g. the cells of the
+	// gNB-DUs in service. The TAs of all the cells are advertised when not
+	// configured
+	NgSetupCells []string `yaml:"ngSetupCells"`
+}
+
+// validateRanNode checks the RAN node configuration, once the cells are
+// initialized
+func (gnb *GNodeB) validateRanNode() error {
+	ranNode := gnb.RanNode
+	if ranNode == nil {
+		return nil
+	}
+
+	switch ranNode.Type {
+	case "", RAN_NODE_TYPE_GNB:
+	case RAN_NODE_TYPE_GNB_CU:
+		if len(gnb.Cells) == 0 {
+			return fmt.Errorf("cells served by the gnb-du not configured for the gnb-cu")
+		}
+	default:
+		return fmt.Errorf("invalid ran node type:%v, valid values are %v and %v",
+			ranNode.Type, RAN_NODE_TYPE_GNB, RAN_NODE_TYPE_GNB_CU)
+	}
+
+	for _, nrCellId := range ranNode.NgSetupCells {
+		_, err := gnb.GetCell(nrCellId)
+		if err != nil {
+			return fmt.Errorf("invalid ng setup cell:%v", err)
+		}
+	}
+	return nil
+}
+
+// getGnbIdBase returns the base of the configured gNB ID value
+func (gnb *GNodeB) getGnbIdBase() (int, error) {
+	if gnb.RanNode == nil {
+		return 16, nil
+	}
+	switch gnb.RanNode.GnbIdFormat {
+	case "", GNB_ID_FORMAT_HEX:
+		return 16, nil
+	case GNB_ID_FORMAT_DECIMAL:
+		return 10, nil
+	}
+	return 0, fmt.Errorf("invalid gnb id format:%v, valid values are %v and %v",
+		gnb.RanNode.GnbIdFormat, GNB_ID_FORMAT_HEX, GNB_ID_FORMAT_DECIMAL)
+}
+
+// GetRanNodeName returns the RAN node name sent in the NG Setup Request
+func (gnb *GNodeB) GetRanNodeName() string {
+	if gnb.RanNode != nil && gnb.RanNode.Name != "" {
+		return gnb.RanNode.Name
+	}
+	return gnb.GnbName
+}
+
+// GetNgSetupTaList returns the TAs advertised in the NG Setup Request, the
+// supported TAs served by the NG Setup cells when configured
+func (gnb *GNodeB) GetNgSetupTaList() []SupportedTA {
+	if gnb.RanNode == nil || len(gnb.RanNode.NgSetupCells) == 0 {
+		return gnb.SupportedTaList
+	}
+
+	var taList []SupportedTA
+	for _, ta := range gnb.SupportedTaList {
+		for _, nrCellId := range gnb.RanNode.NgSetupCells {
+			cell, err := gnb.GetCell(nrCellId)
+			if err == nil && strings.EqualFold(cell.Tac, ta.Tac) {
+				taList = append(taList, ta)
+				break
+			}
+		}
+	}
+	return taList
+}
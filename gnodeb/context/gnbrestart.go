@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sync"
+)
+
+// RestartState tracks the simulated restarts of a gNB. New UE connections are
+// refused while the gNB is restarting
+type RestartState struct {
+	lock  sync.Mutex
+	count uint
+
+	// Closed once the restart in progress completes, nil when the gNB is
+	// not restarting
+	done chan struct{}
+
+	// Result of the last restart
+	err error
+}
+
+// BeginRestart marks the gNB as restarting and returns true. If the gNB is
+// already restarting, it returns false along with the channel closed once the
+// restart in progress completes
+func (gnb *GNodeB) BeginRestart() (bool, <-chan struct{}) {
+	r := &gnb.Restart
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.done != nil {
+		return false, r.done
+	}
+	r.done = make(chan struct{})
+	return true, nil
+}
+
+// EndRestart records the result of the restart and releases the requests
+// waiting for its completion
+func (gnb *GNodeB) EndRestart(err error) {
+	r := &gnb.Restart
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.count++
+	r.err = err
+	close(r.done)
+	r.done = nil
+}
+
+// IsRestarting returns true while the gNB is restarting
+func (gnb *GNodeB) IsRestarting() bool {
+	gnb.Restart.lock.Lock()
+	defer gnb.Restart.lock.Unlock()
+	return gnb.Restart.done != nil
+}
+
+// GetRestartCount returns the number of restarts of the gNB, and the result
+// of the last one
+func (gnb *GNodeB) GetRestartCount() (uint, error) {
+	gnb.Restart.lock.Lock()
+	defer gnb.Restart.lock.Unlock()
+	return gnb.Restart.count, gnb.Restart.err
+}
@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"reflect"
+
+	"github.com/omec-project/gnbsim/common"
+
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// RecordSentNgapMessage records the encoded NGAP message sent to the AMF in
+// the timeline of the UE. It is a no-op unless the timeline is enabled
+func (ctx *GnbCpUe) RecordSentNgapMessage(pkt []byte) {
+	if ctx.Timeline == nil {
+		return
+	}
+	name := "Unknown"
+	if pdu, err := ngap.Decoder(pkt); err == nil {
+		name = GetNgapMessageName(pdu)
+	}
+	ctx.Timeline.Record(common.TIMELINE_PROTOCOL_NGAP, common.TIMELINE_UPLINK,
+		name, len(pkt))
+}
+
+// RecordReceivedNgapMessage records the decoded NGAP message received from
+// the AMF in the timeline of the UE. The message is encoded again for its
+// size, hence only when the timeline is enabled
+func (ctx *GnbCpUe) RecordReceivedNgapMessage(pdu *ngapType.NGAPPDU) {
+	if ctx.Timeline == nil || pdu == nil {
+		return
+	}
+	size := 0
+	if pkt, err := ngap.Encoder(*pdu); err == nil {
+		size = len(pkt)
+	}
+	ctx.Timeline.Record(common.TIMELINE_PROTOCOL_NGAP, common.TIMELINE_DOWNLINK,
+		GetNgapMessageName(pdu), size)
+}
+
+// GetNgapMessageName returns the name of the NGAP message, i.e. the name of
+// the message field set in the value of the PDU, such as InitialUEMessage
+func GetNgapMessageName(pdu *ngapType.NGAPPDU) string {
+	var value interface{}
+	switch {
+	case pdu.InitiatingMessage != nil:
+		value = &pdu.InitiatingMessage.Value
+	case pdu.SuccessfulOutcome != nil:
+		value = &pdu.SuccessfulOutcome.Value
+	case pdu.UnsuccessfulOutcome != nil:
+		value = &pdu.UnsuccessfulOutcome.Value
+	default:
+		return "Unknown"
+	}
+
+	v := reflect.ValueOf(value).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Ptr && !field.IsNil() {
+			return v.Type().Field(i).Name
+		}
+	}
+	return "Unknown"
+}
@@ -15,11 +15,20 @@ import (
 //TODO: Need to seperate out the DAOs
 
 // GnbUeDao acts as a Data Access Object that stores and provides access to all
-// the GNodeB instances
+// the GNodeB instances. The maps are sync.Maps, as the UE contexts are added
+// once and then looked up concurrently by the workers, hence the lookups are
+// not serialized by a lock
 type GnbUeDao struct {
 	ngapIdGnbCpUeMap sync.Map
 	dlTeidGnbUpUeMap sync.Map
 
+	// GnbCpUe instances keyed by the AMF UE NGAP ID, recorded as the AMF
+	// assigns the IDs. Entries of the removed instances are deleted lazily.
+	// Writes are serialized by amfIdLock, so that an entry is not deleted
+	// once recorded again for another instance
+	amfIdGnbCpUeMap sync.Map
+	amfIdLock       sync.Mutex
+
 	/* logger */
 	Log *logrus.Entry
 	//TODO:
@@ -37,7 +46,7 @@ func NewGnbUeDao() *GnbUeDao {
 
 // GetGnbCpUe returns the GnbCpUe instance corresponding to provided NGAP ID
 func (dao *GnbUeDao) GetGnbCpUe(gnbUeNgapId int64) *GnbCpUe {
-	dao.Log.Infoln("Fetching GnbCpUe for RANUENGAPID:", gnbUeNgapId)
+	dao.Log.Traceln("Fetching GnbCpUe for RANUENGAPID:", gnbUeNgapId)
 	val, ok := dao.ngapIdGnbCpUeMap.Load(gnbUeNgapId)
 	if ok {
 		return val.(*GnbCpUe)
@@ -49,10 +58,68 @@ func (dao *GnbUeDao) GetGnbCpUe(gnbUeNgapId int64) *GnbCpUe {
 
 // AddGnbCpUe adds the GnbCpUe instance corresponding to provided NGAP ID
 func (dao *GnbUeDao) AddGnbCpUe(gnbUeNgapId int64, gnbue *GnbCpUe) {
-	dao.Log.Infoln("Adding new GnbCpUe for RANUENGAPID:", gnbUeNgapId)
+	dao.Log.Traceln("Adding new GnbCpUe for RANUENGAPID:", gnbUeNgapId)
 	dao.ngapIdGnbCpUeMap.Store(gnbUeNgapId, gnbue)
 }
 
+// RemoveGnbCpUe removes the GnbCpUe instance corresponding to provided NGAP
+// ID, unless the NGAP ID is already in use by another GnbCpUe instance
+func (dao *GnbUeDao) RemoveGnbCpUe(gnbUeNgapId int64, gnbue *GnbCpUe) {
+	dao.Log.Traceln("Removing GnbCpUe for RANUENGAPID:", gnbUeNgapId)
+	val, ok := dao.ngapIdGnbCpUeMap.Load(gnbUeNgapId)
+	if ok && val.(*GnbCpUe) == gnbue {
+		dao.ngapIdGnbCpUeMap.Delete(gnbUeNgapId)
+	}
+}
+
+// GetGnbCpUeByAmfUeNgapId returns the GnbCpUe instance corresponding to
+// provided AMF UE NGAP ID
+func (dao *GnbUeDao) GetGnbCpUeByAmfUeNgapId(amfUeNgapId int64) *GnbCpUe {
+	dao.Log.Traceln("Fetching GnbCpUe for AMFUENGAPID:", amfUeNgapId)
+	val, ok := dao.amfIdGnbCpUeMap.Load(amfUeNgapId)
+	if !ok {
+		dao.Log.Warnln("key not present:", amfUeNgapId)
+		return nil
+	}
+	gnbue := val.(*GnbCpUe)
+	cur, ok := dao.ngapIdGnbCpUeMap.Load(gnbue.GnbUeNgapId)
+	if ok && cur.(*GnbCpUe) == gnbue {
+		return gnbue
+	}
+
+	// Entry of the removed instance is deleted, unless the AMF UE NGAP ID was
+	// recorded meanwhile for another instance, which is then looked up
+	dao.amfIdLock.Lock()
+	val, ok = dao.amfIdGnbCpUeMap.Load(amfUeNgapId)
+	if ok && val.(*GnbCpUe) != gnbue {
+		dao.amfIdLock.Unlock()
+		return dao.GetGnbCpUeByAmfUeNgapId(amfUeNgapId)
+	}
+	if ok {
+		dao.amfIdGnbCpUeMap.Delete(amfUeNgapId)
+	}
+	dao.amfIdLock.Unlock()
+	dao.Log.Warnln("GnbCpUe removed for AMFUENGAPID:", amfUeNgapId)
+	return nil
+}
+
+// SetAmfUeNgapId records the GnbCpUe instance corresponding to provided AMF UE
+// NGAP ID
+func (dao *GnbUeDao) SetAmfUeNgapId(amfUeNgapId int64, gnbue *GnbCpUe) {
+	dao.Log.Traceln("Setting GnbCpUe for AMFUENGAPID:", amfUeNgapId)
+	dao.amfIdLock.Lock()
+	defer dao.amfIdLock.Unlock()
+	dao.amfIdGnbCpUeMap.Store(amfUeNgapId, gnbue)
+}
+
+// RangeGnbCpUes calls f for each of the GnbCpUe instances
+func (dao *GnbUeDao) RangeGnbCpUes(f func(gnbue *GnbCpUe)) {
+	dao.ngapIdGnbCpUeMap.Range(func(key, value interface{}) bool {
+		f(value.(*GnbCpUe))
+		return true
+	})
+}
+
 // GetGnbUpUe returns the GnbUpUe instance corresponding to provided TEID
 func (dao *GnbUeDao) GetGnbUpUe(teid uint32, downlink bool) *GnbUpUe {
 	dao.Log.Traceln("Fetching GnbUpUe for TEID:", teid, "Downlink:", downlink)
@@ -75,7 +142,7 @@ func (dao *GnbUeDao) GetGnbUpUe(teid uint32, downlink bool) *GnbUpUe {
 
 // AddGnbUpUe adds the GnbUpUe instance corresponding to provided TEID
 func (dao *GnbUeDao) AddGnbUpUe(teid uint32, downlink bool, gnbue *GnbUpUe) {
-	dao.Log.Infoln("Adding new GnbUpUe for TEID:", teid, "Downlink:", downlink)
+	dao.Log.Traceln("Adding new GnbUpUe for TEID:", teid, "Downlink:", downlink)
 	if downlink {
 		dao.dlTeidGnbUpUeMap.Store(teid, gnbue)
 	} else {
@@ -85,7 +152,7 @@ func (dao *GnbUeDao) AddGnbUpUe(teid uint32, downlink bool, gnbue *GnbUpUe) {
 
 // RemoveGnbUpUe removes the GnbUpUe instance corresponding to provided TEID
 func (dao *GnbUeDao) RemoveGnbUpUe(teid uint32, downlink bool) {
-	dao.Log.Infoln("Removing GnbUpUe for TEID:", teid, "Downlink:", downlink)
+	dao.Log.Traceln("Removing GnbUpUe for TEID:", teid, "Downlink:", downlink)
 	if downlink {
 		dao.dlTeidGnbUpUeMap.Delete(teid)
 	} else {
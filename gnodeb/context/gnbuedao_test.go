@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/omec-project/gnbsim/logger"
+)
+
+// UE contexts held by each goroutine of the benchmarks
+const benchUesPerWorker int64 = 1024
+
+// newBenchGnbCpUes returns the UE contexts of a worker, the NGAP IDs of the
+// workers being disjoint
+func newBenchGnbCpUes(worker int64) []*GnbCpUe {
+	gnbues := make([]*GnbCpUe, benchUesPerWorker)
+	for i := range gnbues {
+		gnbues[i] = NewGnbCpUe(worker*benchUesPerWorker+int64(i)+1, nil, nil)
+	}
+	return gnbues
+}
+
+// BenchmarkGnbUeDaoAddLookupDelete adds, looks up and removes the UE contexts
+// concurrently, as done by the gNB workers while the UEs come and go
+func BenchmarkGnbUeDaoAddLookupDelete(b *testing.B) {
+	logger.SetLogLevel("error")
+	dao := NewGnbUeDao()
+	var workers int64
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		gnbues := newBenchGnbCpUes(atomic.AddInt64(&workers, 1))
+		i := 0
+		for pb.Next() {
+			gnbue := gnbues[i%len(gnbues)]
+			i++
+
+			dao.AddGnbCpUe(gnbue.GnbUeNgapId, gnbue)
+			dao.SetAmfUeNgapId(gnbue.GnbUeNgapId, gnbue)
+			if dao.GetGnbCpUe(gnbue.GnbUeNgapId) != gnbue {
+				b.Error("GnbCpUe not found by RAN UE NGAP ID")
+				return
+			}
+			if dao.GetGnbCpUeByAmfUeNgapId(gnbue.GnbUeNgapId) != gnbue {
+				b.Error("GnbCpUe not found by AMF UE NGAP ID")
+				return
+			}
+			dao.RemoveGnbCpUe(gnbue.GnbUeNgapId, gnbue)
+		}
+	})
+}
+
+// BenchmarkGnbUeDaoLookup looks up the UE contexts concurrently, while a
+// share of them is added and removed
+func BenchmarkGnbUeDaoLookup(b *testing.B) {
+	logger.SetLogLevel("error")
+	dao := NewGnbUeDao()
+	var workers int64
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		gnbues := newBenchGnbCpUes(atomic.AddInt64(&workers, 1))
+		for _, gnbue := range gnbues {
+			dao.AddGnbCpUe(gnbue.GnbUeNgapId, gnbue)
+		}
+		i := 0
+		for pb.Next() {
+			gnbue := gnbues[i%len(gnbues)]
+			i++
+
+			// One in sixteen operations replaces the UE context
+			if i%16 == 0 {
+				dao.RemoveGnbCpUe(gnbue.GnbUeNgapId, gnbue)
+				dao.AddGnbCpUe(gnbue.GnbUeNgapId, gnbue)
+				continue
+			}
+			if dao.GetGnbCpUe(gnbue.GnbUeNgapId) != gnbue {
+				b.Error("GnbCpUe not found by RAN UE NGAP ID")
+				return
+			}
+		}
+	})
+}
+
+// TestGnbUeDaoConcurrent adds, looks up and removes the UE contexts from
+// concurrent goroutines, and checks that a removed context is not returned
+// by the lookups
+func TestGnbUeDaoConcurrent(t *testing.T) {
+	logger.SetLogLevel("error")
+	dao := NewGnbUeDao()
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for w := int64(0); w < 8; w++ {
+		wg.Add(1)
+		go func(gnbues []*GnbCpUe) {
+			defer wg.Done()
+			for _, gnbue := range gnbues {
+				dao.AddGnbCpUe(gnbue.GnbUeNgapId, gnbue)
+				dao.SetAmfUeNgapId(gnbue.GnbUeNgapId, gnbue)
+				if dao.GetGnbCpUe(gnbue.GnbUeNgapId) != gnbue {
+					errs <- "GnbCpUe not found by RAN UE NGAP ID"
+					return
+				}
+				dao.RemoveGnbCpUe(gnbue.GnbUeNgapId, gnbue)
+				if dao.GetGnbCpUeByAmfUeNgapId(gnbue.GnbUeNgapId) != nil {
+					errs <- "removed GnbCpUe found by AMF UE NGAP ID"
+					return
+				}
+			}
+		}(newBenchGnbCpUes(w))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	count := 0
+	dao.RangeGnbCpUes(func(gnbue *GnbCpUe) { count++ })
+	if count != 0 {
+		t.Errorf("%v GnbCpUe(s) left after removal", count)
+	}
+}
+
+// TestGnbUeDaoAmfUeNgapIdReassigned assigns the same AMF UE NGAP ID to the UE
+// contexts which come and go, while the ID is looked up concurrently, and
+// checks that the stale entries deleted by the lookups never remove the
+// entry of the live context
+func TestGnbUeDaoAmfUeNgapIdReassigned(t *testing.T) {
+	logger.SetLogLevel("error")
+	dao := NewGnbUeDao()
+	const amfUeNgapId int64 = 1
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					dao.GetGnbCpUeByAmfUeNgapId(amfUeNgapId)
+				}
+			}
+		}()
+	}
+
+	for _, gnbue := range newBenchGnbCpUes(0) {
+		dao.AddGnbCpUe(gnbue.GnbUeNgapId, gnbue)
+		dao.SetAmfUeNgapId(amfUeNgapId, gnbue)
+		if dao.GetGnbCpUeByAmfUeNgapId(amfUeNgapId) != gnbue {
+			t.Error("live GnbCpUe not found by AMF UE NGAP ID")
+			break
+		}
+		dao.RemoveGnbCpUe(gnbue.GnbUeNgapId, gnbue)
+	}
+	close(done)
+	wg.Wait()
+}
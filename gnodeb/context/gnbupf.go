@@ -33,7 +33,7 @@ type GnbUpf struct {
 func NewGnbUpf(ip string) *GnbUpf {
 	gnbupf := &GnbUpf{}
 
-	gnbupf.Log = logger.GNodeBLog.WithFields(logrus.Fields{"subcategory": "GnbUpf",
+	gnbupf.Log = logger.GnbUpLog.WithFields(logrus.Fields{"subcategory": "GnbUpf",
 		logger.FieldIp: ip})
 
 	ipPort := net.JoinHostPort(ip, strconv.Itoa(GTP_U_PORT))
@@ -24,6 +24,23 @@ type GnbUpUe struct {
 	QosFlows         map[int64]*ngapType.QosFlowSetupRequestItem
 	LastDataPktRecvd bool
 
+	// Set when the UE is handed over to another gNB, in which case the
+	// user plane of the UE is not terminated along with this context
+	HandedOver bool
+
+	// Activity of the UE, shared with its GnbCpUe
+	Activity *UeActivity
+
+	// Additional downlink tunnel terminated by the secondary node, and the
+	// user data volume counted for the secondary RAT data usage reports.
+	// Used with dual connectivity only
+	SecondaryDlTeid uint32
+	Usage           *UsageCounter
+
+	// Scratch buffer into which the uplink G-PDUs are encoded. It is reused
+	// across the packets as each packet is sent before the next is handled
+	UlPktBuf []byte
+
 	// GnbUpUe writes downlink packets to UE on this channel
 	WriteUeChan chan common.InterfaceMessage
 
@@ -40,6 +57,14 @@ type GnbUpUe struct {
 	Log *logrus.Entry
 }
 
+// UlTunnelUpdate directs GnbUpUe to send the uplink packets to the provided
+// UPF tunnel endpoint
+type UlTunnelUpdate struct {
+	common.DefaultMessage
+	UlTeid uint32
+	Upf    *GnbUpf
+}
+
 func NewGnbUpUe(dlTeid, ulTeid uint32, gnb *GNodeB) *GnbUpUe {
 	gnbue := GnbUpUe{}
 	gnbue.DlTeid = dlTeid
@@ -49,7 +74,7 @@ func NewGnbUpUe(dlTeid, ulTeid uint32, gnb *GNodeB) *GnbUpUe {
 	gnbue.ReadUlChan = make(chan common.InterfaceMessage, 10)
 	gnbue.ReadDlChan = make(chan common.InterfaceMessage, 10)
 	gnbue.ReadCmdChan = make(chan common.InterfaceMessage, 5)
-	gnbue.Log = logger.GNodeBLog.WithFields(logrus.Fields{"subcategory": "GnbUpUe",
+	gnbue.Log = logger.GnbUpLog.WithFields(logrus.Fields{"subcategory": "GnbUpUe",
 		logger.FieldDlTeid: dlTeid})
 	gnbue.Log.Traceln("Context Created")
 	return &gnbue
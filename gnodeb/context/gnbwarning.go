@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"time"
+)
+
+// Warning holds a public warning message (PWS) requested by the AMF through
+// the Write-Replace Warning procedure
+type Warning struct {
+	MessageIdentifier           uint16    `json:"messageIdentifier"`
+	SerialNumber                uint16    `json:"serialNumber"`
+	RepetitionPeriod            int64     `json:"repetitionPeriod"`
+	NumberOfBroadcastsRequested int64     `json:"numberOfBroadcastsRequested"`
+	WarningType                 string    `json:"warningType,omitempty"`
+	DataCodingScheme            string    `json:"dataCodingScheme,omitempty"`
+	Contents                    string    `json:"contents,omitempty"`
+	NrCellIds                   []string  `json:"nrCellIds"`
+	ReceivedAt                  time.Time `json:"receivedAt"`
+}
+
+// GetNumberOfBroadcasts returns the number of times the warning would have
+// been broadcast by now, as per the repetition period (in seconds)
+func (w *Warning) GetNumberOfBroadcasts(now time.Time) int64 {
+	count := int64(1)
+	if w.RepetitionPeriod != 0 {
+		count += int64(now.Sub(w.ReceivedAt)/time.Second) / w.RepetitionPeriod
+	}
+	if w.NumberOfBroadcastsRequested != 0 && count > w.NumberOfBroadcastsRequested {
+		count = w.NumberOfBroadcastsRequested
+	}
+	return count
+}
+
+// AddWarning stores the warning, replacing any existing warning with the same
+// message identifier. It returns false if the warning with the same message
+// identifier and serial number is already being broadcast
+func (gnb *GNodeB) AddWarning(warning *Warning) bool {
+	gnb.warningLock.Lock()
+	defer gnb.warningLock.Unlock()
+
+	if gnb.warnings == nil {
+		gnb.warnings = make(map[uint16]*Warning)
+	}
+	existing, ok := gnb.warnings[warning.MessageIdentifier]
+	if ok && existing.SerialNumber == warning.SerialNumber {
+		return false
+	}
+	gnb.warnings[warning.MessageIdentifier] = warning
+	return true
+}
+
+// RemoveWarning removes the warning with the provided message identifier and
+// serial number. It returns nil if no such warning exists
+func (gnb *GNodeB) RemoveWarning(msgId, serialNum uint16) *Warning {
+	gnb.warningLock.Lock()
+	defer gnb.warningLock.Unlock()
+
+	warning, ok := gnb.warnings[msgId]
+	if !ok || warning.SerialNumber != serialNum {
+		return nil
+	}
+	delete(gnb.warnings, msgId)
+	return warning
+}
+
+// RemoveAllWarnings removes and returns all the warnings
+func (gnb *GNodeB) RemoveAllWarnings() []*Warning {
+	gnb.warningLock.Lock()
+	defer gnb.warningLock.Unlock()
+
+	var warnings []*Warning
+	for _, warning := range gnb.warnings {
+		warnings = append(warnings, warning)
+	}
+	gnb.warnings = nil
+	return warnings
+}
+
+// GetWarnings returns the warnings currently being broadcast
+func (gnb *GNodeB) GetWarnings() []*Warning {
+	gnb.warningLock.Lock()
+	defer gnb.warningLock.Unlock()
+
+	warnings := make([]*Warning, 0, len(gnb.warnings))
+	for _, warning := range gnb.warnings {
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
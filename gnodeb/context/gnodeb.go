@@ -5,6 +5,9 @@
 package context
 
 import (
+	"sync"
+
+	"github.com/omec-project/gnbsim/common"
 	transport "github.com/omec-project/gnbsim/transportcommon"
 
 	"github.com/omec-project/idgenerator"
@@ -23,6 +26,8 @@ type GNodeB struct {
 	GnbName              string                 `yaml:"name"`
 	RanId                models.GlobalRanNodeId `yaml:"globalRanId"`
 	SupportedTaList      []SupportedTA          `yaml:"supportedTaList"`
+	Cells                []*NrCell              `yaml:"cells"`
+	RanNode              *RanNodeConfig         `yaml:"ranNode"`
 	GnbUes               *GnbUeDao
 	GnbPeers             *GnbPeerDao
 	RanUeNGAPIDGenerator *idgenerator.IDGenerator
@@ -34,6 +39,71 @@ type GNodeB struct {
 	/* Default AMF to connect to */
 	DefaultAmf *GnbAmf `yaml:"defaultAmf"`
 
+	// Additional AMFs to connect to, each over its own association. The AMF
+	// serving each UE is then selected as per its GUAMI, PLMN and slice
+	Amfs         []*GnbAmf           `yaml:"amfs"`
+	AmfSelection *AmfSelectionConfig `yaml:"amfSelection"`
+
+	// Directory to which the NGAP PDUs failing to decode are written for
+	// offline analysis. Disabled when empty
+	NgapDumpDir string `yaml:"ngapDumpDir"`
+
+	// Additional N2 interface IP addresses for the SCTP association with the
+	// AMF (multi-homing)
+	GnbN2SecondaryIps []string `yaml:"n2SecondaryIpAddrs"`
+
+	// Network interfaces to which the N2 (SCTP) and N3 (GTP-U) sockets are
+	// bound, so that the traffic of the gNB leaves through these interfaces
+	// irrespective of the routing table. The first IP address of the
+	// interface is used as the source address when n2IpAddr or n3IpAddr is
+	// not configured
+	GnbN2Interface string `yaml:"n2Interface"`
+	GnbN3Interface string `yaml:"n3Interface"`
+
+	// Tuning of the SCTP association with the AMF
+	Sctp *SctpConfig `yaml:"sctp"`
+
+	// DTLS protection of the SCTP associations with the AMFs, disabled when
+	// not configured
+	Dtls *DtlsConfig `yaml:"dtls"`
+
+	// Rate limit of the NGAP messages sent to the AMF, and the pacer which
+	// enforces it
+	NgapRateLimit *NgapRateLimitConfig `yaml:"ngapRateLimit"`
+	NgapPacer     *NgapPacer
+
+	// Number of GTP-U packets read and written per system call on N3, using
+	// recvmmsg and sendmmsg. Packets are read and written one at a time when
+	// not set
+	N3BatchSize int `yaml:"n3BatchSize"`
+
+	// Time (in seconds) without user plane or NAS activity after which gNB
+	// requests the release of the UE context with the user inactivity
+	// cause. The timer runs while the UE has user plane resources, disabled
+	// when not set
+	InactivityTimer uint32 `yaml:"inactivityTimer"`
+
+	// NR-DC with a simulated secondary node, disabled when not configured
+	DualConnectivity *DualConnectivityConfig `yaml:"dualConnectivity"`
+
+	// Cell Traffic Trace is sent to the AMF once a trace is activated for a
+	// UE, carrying the cell serving the UE
+	CellTrafficTrace bool `yaml:"cellTrafficTrace"`
+
+	// Public warning messages being broadcast, keyed by message identifier
+	warnings    map[uint16]*Warning
+	warningLock sync.Mutex
+
+	// UEs in CM-IDLE state listening for the paging, keyed by 5G-S-TMSI
+	pagingUes  map[FiveGSTmsi]chan common.InterfaceMessage
+	pagingLock sync.Mutex
+
+	// Messages which failed to decode or crashed the routine processing them
+	Quarantine Quarantine
+
+	// Simulated restarts of the gNB
+	Restart RestartState
+
 	/* Control Plane transport */
 	CpTransport transport.Transport
 
@@ -52,6 +122,35 @@ func (gnb *GNodeB) AllocateRanUeNgapID() (int64, error) {
 	return gnb.RanUeNGAPIDGenerator.Allocate()
 }
 
+// SctpConfig holds the SCTP association parameters. Parameters which are not
+// configured retain the defaults of the kernel
+type SctpConfig struct {
+	// Retransmission timeout values in milliseconds
+	RtoInitial uint32 `yaml:"rtoInitial"`
+	RtoMin     uint32 `yaml:"rtoMin"`
+	RtoMax     uint32 `yaml:"rtoMax"`
+
+	MaxInitRetransmits uint16 `yaml:"maxInitRetransmits"`
+
+	// Heartbeat interval in milliseconds
+	HeartbeatInterval uint32 `yaml:"heartbeatInterval"`
+
+	// Number of outbound streams and maximum number of inbound streams
+	NumStreams uint16 `yaml:"numStreams"`
+
+	// Policy for selecting the stream of the UE associated NGAP messages.
+	// Stream 0 is used for all the messages when not configured
+	StreamSelection string `yaml:"streamSelection"`
+}
+
+// Stream selection policies. Stream 0 is reserved for the non UE associated
+// signalling, UE associated signalling is distributed over the remaining
+// streams based on the hash of RAN UE NGAP ID
+const (
+	STREAM_SELECTION_SINGLE           string = "single"
+	STREAM_SELECTION_RAN_UE_NGAP_HASH string = "ranUeNgapIdHash"
+)
+
 type SupportedTA struct {
 	Tac               string              `yaml:"tac"`
 	BroadcastPLMNList []BroadcastPLMNItem `yaml:"broadcastPlmnList"`
@@ -7,7 +7,11 @@ package gnodeb
 import (
 	"fmt"
 	"log"
+	"net"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/omec-project/gnbsim/common"
 	"github.com/omec-project/gnbsim/factory"
@@ -34,22 +38,135 @@ func InitializeAllGnbs() error {
 	return nil
 }
 
+// ValidateAllGnbs checks the configuration of each of the gNodeBs, without
+// connecting to the AMF, and returns the errors found. The cells of the
+// gNodeBs are initialized as part of the validation
+func ValidateAllGnbs() []error {
+	gnbs := factory.AppConfig.Configuration.Gnbs
+	var names []string
+	for name := range gnbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	// gNBs bound to each N2 and N3 address, the gNBs must be bound to
+	// distinct addresses
+	n2Addrs := make(map[string]string)
+	n3Addrs := make(map[string]string)
+	for _, name := range names {
+		gnb := gnbs[name]
+		err := gnb.InitCells()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("gnb %v: %v", name, err))
+		}
+		err = gnb.ResolveLocalAddrs()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("gnb %v: %v", name, err))
+		}
+		if gnb.GnbN2Ip == "" {
+			errs = append(errs, fmt.Errorf("gnb %v: n2 ip address not configured", name))
+		}
+		// Ephemeral ports are allocated by the kernel
+		if gnb.GnbN2Ip != "" && gnb.GnbN2Port != 0 {
+			addr := net.JoinHostPort(gnb.GnbN2Ip, strconv.Itoa(gnb.GnbN2Port))
+			if other, ok := n2Addrs[addr]; ok {
+				errs = append(errs, fmt.Errorf("gnb %v: n2 address %v already used by gnb %v",
+					name, addr, other))
+			}
+			n2Addrs[addr] = name
+		}
+		if gnb.GnbN3Port != 0 {
+			addr := net.JoinHostPort(gnb.GnbN3Ip, strconv.Itoa(gnb.GnbN3Port))
+			if other, ok := n3Addrs[addr]; ok {
+				errs = append(errs, fmt.Errorf("gnb %v: n3 address %v already used by gnb %v",
+					name, addr, other))
+			}
+			n3Addrs[addr] = name
+		}
+		if gnb.NgapRateLimit != nil && gnb.NgapRateLimit.Rate < 0 {
+			errs = append(errs, fmt.Errorf("gnb %v: invalid ngap rate limit:%v", name,
+				gnb.NgapRateLimit.Rate))
+		}
+		if gnb.N3BatchSize < 0 {
+			errs = append(errs, fmt.Errorf("gnb %v: invalid n3 batch size:%v", name,
+				gnb.N3BatchSize))
+		}
+		if gnb.Dtls != nil {
+			err = gnb.Dtls.Validate()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("gnb %v: %v", name, err))
+			}
+		}
+		if gnb.DualConnectivity != nil {
+			err = gnb.DualConnectivity.Validate()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("gnb %v: %v", name, err))
+			}
+		}
+		amf := gnb.DefaultAmf
+		if amf != nil && amf.AmfIp == "" && amf.AmfHostName == "" {
+			errs = append(errs, fmt.Errorf("gnb %v: neither ip address nor host name "+
+				"configured for the default amf", name))
+		}
+		if len(gnb.Amfs) != 0 && amf == nil {
+			errs = append(errs, fmt.Errorf("gnb %v: default amf not configured, "+
+				"required along with additional amfs", name))
+		}
+		for i, amf := range gnb.Amfs {
+			if amf == nil || (amf.AmfIp == "" && amf.AmfHostName == "") {
+				errs = append(errs, fmt.Errorf("gnb %v: neither ip address nor host name "+
+					"configured for amf %v", name, i+1))
+			}
+		}
+		if gnb.AmfSelection != nil {
+			err = gnb.AmfSelection.Validate()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("gnb %v: %v", name, err))
+			}
+		}
+	}
+	return errs
+}
+
 // Init initializes the GNodeB struct var and connects to the default AMF
 func Init(gnb *gnbctx.GNodeB) error {
+	return initGnb(gnb, nil)
+}
+
+// initGnb initializes the gNodeB, recording the connection to the AMF and NG
+// Setup in the pre-flight report when provided
+func initGnb(gnb *gnbctx.GNodeB, report *PreflightReport) error {
 	gnb.Log = logger.GNodeBLog.WithField(logger.FieldGnb, gnb.GnbName)
 	gnb.Log.Traceln("Inititializing GNodeB")
+
+	err := gnb.ResolveLocalAddrs()
+	if err != nil {
+		gnb.Log.Errorln("ResolveLocalAddrs returned:", err)
+		return fmt.Errorf("invalid local address configuration")
+	}
 	gnb.Log.Infoln("GNodeB IP:", gnb.GnbN2Ip, "GNodeB Port:", gnb.GnbN2Port)
 
+	err = gnb.InitCells()
+	if err != nil {
+		gnb.Log.Errorln("InitCells returned:", err)
+		return fmt.Errorf("invalid cell configuration")
+	}
+	if gnb.RanNode != nil && gnb.RanNode.Type == gnbctx.RAN_NODE_TYPE_GNB_CU {
+		gnb.Log.Infoln("Presenting as gNB-CU, RAN node name:", gnb.GetRanNodeName())
+	}
+
+	gnb.NgapPacer = gnbctx.NewNgapPacer(gnb.NgapRateLimit)
 	gnb.CpTransport = transport.NewGnbCpTransport(gnb)
 	gnb.UpTransport = transport.NewGnbUpTransport(gnb)
-	err := gnb.UpTransport.Init()
+	err = gnb.UpTransport.Init()
 	if err != nil {
 		gnb.Log.Errorln("GnbUpTransport.Init returned", err)
 		return fmt.Errorf("failed to initialize user plane transport")
 	}
 	gnb.GnbUes = gnbctx.NewGnbUeDao()
 	gnb.GnbPeers = gnbctx.NewGnbPeerDao()
-	start, end := idrange.GetIdRange()
+	start, end := idrange.GetIdRange(gnb.GnbName)
 	gnb.RanUeNGAPIDGenerator = idgenerator.NewGenerator(int64(start), int64(end))
 	gnb.DlTeidGenerator = idgenerator.NewGenerator(int64(start), int64(end))
 
@@ -58,23 +175,42 @@ func Init(gnb *gnbctx.GNodeB) error {
 		return nil
 	}
 
-	gnb.DefaultAmf.Init()
+	for _, amf := range gnb.GetAmfs() {
+		err = connectAmf(gnb, amf, report)
+		if err != nil {
+			return err
+		}
+	}
+
+	gnb.Log.Traceln("GNodeB Initialized")
+	return nil
+}
 
-	err = gnb.CpTransport.ConnectToPeer(gnb.DefaultAmf)
+// connectAmf establishes the association with the AMF and performs NG Setup
+func connectAmf(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf, report *PreflightReport) error {
+	amf.Init()
+
+	start := time.Now()
+	err := gnb.CpTransport.ConnectToPeer(amf)
+	amfAddr := getAmfAddr(amf)
+	report.add(gnb, PREFLIGHT_AMF_SCTP, amfAddr, start, err)
 	if err != nil {
 		gnb.Log.Errorln("ConnectToPeer returned:", err)
 		return fmt.Errorf("failed to connect to amf")
 	}
 
-	successfulOutcome, err := PerformNgSetup(gnb, gnb.DefaultAmf)
-	if !successfulOutcome || err != nil {
+	start = time.Now()
+	successfulOutcome, err := PerformNgSetup(gnb, amf)
+	if err == nil && !successfulOutcome {
+		err = fmt.Errorf("ng setup failure received")
+	}
+	report.add(gnb, PREFLIGHT_NG_SETUP, amfAddr, start, err)
+	if err != nil {
 		gnb.Log.Errorln("PerformNgSetup returned:", err)
 		return fmt.Errorf("failed to perform ng setup procedure")
 	}
 
-	go gnb.CpTransport.ReceiveFromPeer(gnb.DefaultAmf)
-
-	gnb.Log.Traceln("GNodeB Initialized")
+	go gnb.CpTransport.ReceiveFromPeer(amf)
 	return nil
 }
 
@@ -83,6 +219,77 @@ func QuitGnb(gnb *gnbctx.GNodeB) {
 	close(gnb.Quit)
 }
 
+// Restart simulates the restart of the gNB. All the UE contexts are torn down
+// and the SCTP association with the AMF is closed without any NGAP signalling,
+// leaving the AMF to clean up the UE contexts. The association is then
+// reestablished, followed by NG Setup. A restart requested while the gNB is
+// restarting waits for the restart in progress to complete
+func Restart(gnb *gnbctx.GNodeB) error {
+	first, done := gnb.BeginRestart()
+	if !first {
+		gnb.Log.Infoln("gNB restart in progress, waiting for its completion")
+		<-done
+		_, err := gnb.GetRestartCount()
+		return err
+	}
+
+	err := restart(gnb)
+	if err != nil {
+		gnb.Log.Errorln("gNB restart failed:", err)
+	}
+	gnb.EndRestart(err)
+	return err
+}
+
+func restart(gnb *gnbctx.GNodeB) error {
+	gnb.Log.Infoln("Restarting gNB")
+
+	var wg sync.WaitGroup
+	gnb.GnbUes.RangeGnbCpUes(func(gnbue *gnbctx.GnbCpUe) {
+		wg.Add(1)
+		msg := &common.GnbRestartMessage{Done: &wg}
+		msg.Event = common.GNB_RESTART_EVENT
+		gnbue.ReadChan <- msg
+	})
+	wg.Wait()
+	gnb.Log.Infoln("All UE contexts torn down")
+
+	for _, amf := range gnb.GetAmfs() {
+		// Receive routine of the association terminates once it is closed
+		if amf.Dtls != nil {
+			amf.Dtls.Close()
+		}
+		if amf.Conn != nil {
+			err := amf.Conn.Close()
+			if err != nil {
+				gnb.Log.Warnln("Close returned:", err)
+			}
+		}
+		amf.SetNgSetupStatus(false)
+		amf.SetN2Down(false)
+		gnb.Log.Infoln("SCTP association with AMF closed, AMF IP:", amf.AmfIp)
+	}
+
+	for _, amf := range gnb.GetAmfs() {
+		err := gnb.CpTransport.ConnectToPeer(amf)
+		if err != nil {
+			gnb.Log.Errorln("ConnectToPeer returned:", err)
+			return fmt.Errorf("failed to connect to amf")
+		}
+
+		successfulOutcome, err := PerformNgSetup(gnb, amf)
+		if !successfulOutcome || err != nil {
+			gnb.Log.Errorln("PerformNgSetup returned:", err)
+			return fmt.Errorf("failed to perform ng setup procedure")
+		}
+
+		go gnb.CpTransport.ReceiveFromPeer(amf)
+	}
+
+	gnb.Log.Infoln("gNB restarted")
+	return nil
+}
+
 // PerformNGSetup sends the NGSetupRequest to the provided GnbAmf.
 // It waits for the response, process the response and informs whether it was
 // SuccessfulOutcome or UnsuccessfulOutcome
@@ -118,15 +325,11 @@ func PerformNgSetup(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf) (bool, error) {
 
 // RequestConnection should be called by UE that is willing to connect to this GNodeB
 func RequestConnection(gnb *gnbctx.GNodeB, uemsg *common.UuMessage) (chan common.InterfaceMessage, error) {
-	ranUeNgapID, err := gnb.AllocateRanUeNgapID()
+	gnbUe, err := newGnbCpUe(gnb, uemsg)
 	if err != nil {
-		gnb.Log.Errorln("AllocateRanUeNgapID returned:", err)
-		return nil, fmt.Errorf("failed to allocate ran ue ngap id")
+		return nil, err
 	}
 
-	gnbUe := gnbctx.NewGnbCpUe(ranUeNgapID, gnb, gnb.DefaultAmf)
-	gnb.GnbUes.AddGnbCpUe(ranUeNgapID, gnbUe)
-
 	// TODO: Launching a GO Routine for gNB and handling the waitgroup
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -140,3 +343,67 @@ func RequestConnection(gnb *gnbctx.GNodeB, uemsg *common.UuMessage) (chan common
 	ch <- uemsg
 	return ch, nil
 }
+
+// AttachUe connects a lightweight UE to the gNodeB. Unlike RequestConnection,
+// no routine is started for the UE context, the caller drives it by passing
+// the events read from its ReadChan to gnbcpueworker.HandleEvent
+func AttachUe(gnb *gnbctx.GNodeB, uemsg *common.UuMessage) (*gnbctx.GnbCpUe, error) {
+	gnbUe, err := newGnbCpUe(gnb, uemsg)
+	if err != nil {
+		return nil, err
+	}
+	gnbUe.Lightweight = true
+	gnbUe.ReadChan <- uemsg
+	return gnbUe, nil
+}
+
+// newGnbCpUe creates the context of a UE connecting to the gNodeB
+func newGnbCpUe(gnb *gnbctx.GNodeB, uemsg *common.UuMessage) (*gnbctx.GnbCpUe, error) {
+	if gnb.IsRestarting() {
+		return nil, fmt.Errorf("gnb restarting")
+	}
+
+	ranUeNgapID, err := gnb.AllocateRanUeNgapID()
+	if err != nil {
+		gnb.Log.Errorln("AllocateRanUeNgapID returned:", err)
+		return nil, fmt.Errorf("failed to allocate ran ue ngap id")
+	}
+
+	var cell *gnbctx.NrCell
+	if uemsg.NrCellId != "" {
+		cell, err = gnb.GetCell(uemsg.NrCellId)
+		if err != nil {
+			gnb.Log.Errorln("GetCell returned:", err)
+		}
+	} else {
+		cell, err = gnb.GetServingCell(ranUeNgapID, uemsg.Tac, uemsg.Plmn)
+		if err != nil {
+			gnb.Log.Errorln("GetServingCell returned:", err)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to select serving cell")
+	}
+
+	amf, err := gnb.SelectAmf(uemsg.Guami, uemsg.Plmn, uemsg.Snssai)
+	if err != nil {
+		gnb.Log.Errorln("SelectAmf returned:", err)
+		return nil, fmt.Errorf("failed to select amf")
+	}
+
+	gnbUe := gnbctx.NewGnbCpUe(ranUeNgapID, gnb, amf)
+	if amf != gnb.DefaultAmf {
+		gnbUe.Log.Infoln("Selected AMF:", amf.AmfName, "AMF IP:", amf.AmfIp)
+	}
+	gnbUe.Cell = cell
+	gnbUe.CellEntryTime = time.Now()
+	gnbUe.CellChanges = uemsg.CellChanges
+	gnbUe.UeRadioCapability = uemsg.UeRadioCapability
+	gnbUe.UeCtxModFailureCause = uemsg.UeCtxModFailureCause
+	gnbUe.Plmn = uemsg.Plmn
+	if gnbUe.Plmn == nil {
+		gnbUe.Plmn = gnb.RanId.PlmnId
+	}
+	gnb.GnbUes.AddGnbCpUe(ranUeNgapID, gnbUe)
+	return gnbUe, nil
+}
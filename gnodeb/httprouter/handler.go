@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package httprouter
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/gnbsim/factory"
+	"github.com/omec-project/gnbsim/gnodeb"
+	"github.com/omec-project/gnbsim/logger"
+	"github.com/omec-project/openapi/models"
+)
+
+// HTTPGetWarnings returns the public warning messages currently being
+// broadcast by the gNB
+func HTTPGetWarnings(c *gin.Context) {
+	gnbName := c.Param("gnbName")
+	logger.HttpLog.Infoln("GetWarnings API called for gNB:", gnbName)
+
+	gnb, err := factory.AppConfig.Configuration.GetGNodeB(gnbName)
+	if err != nil {
+		logger.HttpLog.Errorln("GetGNodeB failed:", err)
+		rsp := models.ProblemDetails{
+			Title:  "gNB not found",
+			Status: http.StatusNotFound,
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusNotFound, rsp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gnb.GetWarnings())
+}
+
+// HTTPGetQuarantine returns the count of the messages quarantined by the gNB
+// and the most recent of them
+func HTTPGetQuarantine(c *gin.Context) {
+	gnbName := c.Param("gnbName")
+	logger.HttpLog.Infoln("GetQuarantine API called for gNB:", gnbName)
+
+	gnb, err := factory.AppConfig.Configuration.GetGNodeB(gnbName)
+	if err != nil {
+		logger.HttpLog.Errorln("GetGNodeB failed:", err)
+		rsp := models.ProblemDetails{
+			Title:  "gNB not found",
+			Status: http.StatusNotFound,
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusNotFound, rsp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":    gnb.GetQuarantinedCount(),
+		"messages": gnb.GetQuarantinedMsgs(),
+	})
+}
+
+// HTTPRestartGnb restarts the gNB, tearing down the SCTP association and all
+// the UE contexts, and responds once the gNB is connected to the AMF again
+func HTTPRestartGnb(c *gin.Context) {
+	gnbName := c.Param("gnbName")
+	logger.HttpLog.Infoln("RestartGnb API called for gNB:", gnbName)
+
+	gnb, err := factory.AppConfig.Configuration.GetGNodeB(gnbName)
+	if err != nil {
+		logger.HttpLog.Errorln("GetGNodeB failed:", err)
+		rsp := models.ProblemDetails{
+			Title:  "gNB not found",
+			Status: http.StatusNotFound,
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusNotFound, rsp)
+		return
+	}
+
+	err = gnodeb.Restart(gnb)
+	if err != nil {
+		logger.HttpLog.Errorln("Restart failed:", err)
+		rsp := models.ProblemDetails{
+			Title:  "gNB restart failed",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, rsp)
+		return
+	}
+
+	count, _ := gnb.GetRestartCount()
+	c.JSON(http.StatusOK, gin.H{
+		"restarts": count,
+	})
+}
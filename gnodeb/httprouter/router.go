@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package httprouter
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Route is the information for every URI.
+type Route struct {
+	// Name is the name of this Route.
+	Name string
+	// Method is the string for the HTTP method. ex) GET, POST etc..
+	Method string
+	// Pattern is the pattern of the URI.
+	Pattern string
+	// HandlerFunc is the handler function of this route.
+	HandlerFunc gin.HandlerFunc
+}
+
+// Routes is the list of the generated Route.
+type Routes []Route
+
+func AddService(engine *gin.Engine) *gin.RouterGroup {
+	group := engine.Group("/gnbsim/v1")
+
+	for _, route := range routes {
+		switch route.Method {
+		case "GET":
+			group.GET(route.Pattern, route.HandlerFunc)
+		case "POST":
+			group.POST(route.Pattern, route.HandlerFunc)
+		}
+	}
+	return group
+}
+
+var routes = Routes{
+	{
+		"GetWarnings",
+		"GET",
+		"/gnbs/:gnbName/warnings",
+		HTTPGetWarnings,
+	},
+	{
+		"GetQuarantine",
+		"GET",
+		"/gnbs/:gnbName/quarantine",
+		HTTPGetQuarantine,
+	},
+	{
+		"RestartGnb",
+		"POST",
+		"/gnbs/:gnbName/restart",
+		HTTPRestartGnb,
+	},
+}
@@ -5,9 +5,7 @@
 package idrange
 
 import (
-	"math/rand"
-	"time"
-
+	"github.com/omec-project/gnbsim/common"
 	"github.com/omec-project/gnbsim/logger"
 )
 
@@ -26,12 +24,14 @@ const (
 	MAX_RANGE_BITS uint8 = 8
 )
 
+// GetIdRange returns a random ID range, drawn from the source derived from the
+// seed of the run and the provided key, e.g. the name of the gNB
 // TODO : add UT
-func GetIdRange() (start, end uint32) {
+func GetIdRange(key string) (start, end uint32) {
 	maxRangeSelectVal := (1 << MAX_RANGE_BITS) - 1
 	idBitCount := MAX_ID_BITS - MAX_RANGE_BITS
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	r := common.NewRand("idrange-" + key)
 	rangeSelectVal := uint32(r.Intn(maxRangeSelectVal))
 	logger.GNodeBLog.Infoln("Current range selector value:", rangeSelectVal)
 
@@ -5,17 +5,24 @@
 package ngap
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"time"
 
 	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
 	"github.com/omec-project/gnbsim/util/ngapTestpacket"
 
+	"github.com/omec-project/aper"
 	"github.com/omec-project/ngap"
 	"github.com/omec-project/ngap/ngapConvert"
 	"github.com/omec-project/ngap/ngapType"
 )
 
+// Seconds between the NTP epoch (1900) and the Unix epoch (1970)
+const NTP_UNIX_EPOCH_OFFSET int64 = 2208988800
+
 func GetNGSetupRequest(gnb *gnbctx.GNodeB) ([]byte, error) {
 
 	message := ngapTestpacket.BuildNGSetupRequest()
@@ -24,9 +31,16 @@ func GetNGSetupRequest(gnb *gnbctx.GNodeB) ([]byte, error) {
 	ie := message.InitiatingMessage.Value.NGSetupRequest.ProtocolIEs.List[0]
 	*(ie.Value.GlobalRANNodeID) = ngapConvert.RanIDToNgap(gnb.RanId)
 
+	// gNB ID is a number, hence it is right aligned within the bit string
+	gnbId, bitLength, err := gnb.GetGnbId()
+	if err != nil {
+		return nil, err
+	}
+	*ie.Value.GlobalRANNodeID.GlobalGNBID.GNBID.GNBID = toBitString(gnbId, bitLength)
+
 	// RANNodeName
 	ie = message.InitiatingMessage.Value.NGSetupRequest.ProtocolIEs.List[1]
-	ie.Value.RANNodeName.Value = gnb.GnbName
+	ie.Value.RANNodeName.Value = gnb.GetRanNodeName()
 
 	// TAC
 	ie = message.InitiatingMessage.Value.NGSetupRequest.ProtocolIEs.List[2]
@@ -35,7 +49,7 @@ func GetNGSetupRequest(gnb *gnbctx.GNodeB) ([]byte, error) {
 	// Clearing default entries.
 	supportedTaList.List = nil
 
-	for _, ta := range gnb.SupportedTaList {
+	for _, ta := range gnb.GetNgSetupTaList() {
 		tac, err := hex.DecodeString(ta.Tac)
 		if err != nil {
 			gnb.Log.Errorln("DecodeString returned:", err)
@@ -65,7 +79,325 @@ func GetNGSetupRequest(gnb *gnbctx.GNodeB) ([]byte, error) {
 	return ngap.Encoder(message)
 }
 
-func GetUEContextReleaseRequest(gnbue *gnbctx.GnbCpUe) ([]byte, error) {
+func GetInitialUEMessage(gnbue *gnbctx.GnbCpUe, nasPdu []byte) ([]byte, error) {
+	message := ngapTestpacket.BuildInitialUEMessage(gnbue.GnbUeNgapId, nasPdu, "")
+
+	ies := message.InitiatingMessage.Value.InitialUEMessage.ProtocolIEs
+	for _, ie := range ies.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDUserLocationInformation {
+			setUserLocationInformation(gnbue, ie.Value.UserLocationInformation)
+		}
+	}
+
+	return ngap.Encoder(message)
+}
+
+func GetUplinkNASTransport(gnbue *gnbctx.GnbCpUe, nasPdu []byte) ([]byte, error) {
+	message := ngapTestpacket.BuildUplinkNasTransport(gnbue.AmfUeNgapId,
+		gnbue.GnbUeNgapId, nasPdu)
+
+	ies := message.InitiatingMessage.Value.UplinkNASTransport.ProtocolIEs
+	for _, ie := range ies.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDUserLocationInformation {
+			setUserLocationInformation(gnbue, ie.Value.UserLocationInformation)
+		}
+	}
+
+	return ngap.Encoder(message)
+}
+
+func GetUEContextReleaseComplete(gnbue *gnbctx.GnbCpUe,
+	pduSessIds []int64) ([]byte, error) {
+
+	message := ngapTestpacket.BuildUEContextReleaseComplete(gnbue.AmfUeNgapId,
+		gnbue.GnbUeNgapId, pduSessIds)
+
+	ies := message.SuccessfulOutcome.Value.UEContextReleaseComplete.ProtocolIEs
+	for _, ie := range ies.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDUserLocationInformation {
+			setUserLocationInformation(gnbue, ie.Value.UserLocationInformation)
+		}
+	}
+
+	return ngap.Encoder(message)
+}
+
+func GetLocationReport(gnbue *gnbctx.GnbCpUe,
+	reqType *ngapType.LocationReportingRequestType) ([]byte, error) {
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeLocationReport
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentLocationReport
+	initiatingMessage.Value.LocationReport = new(ngapType.LocationReport)
+
+	ies := &initiatingMessage.Value.LocationReport.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.LocationReportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.LocationReportIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: gnbue.AmfUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.LocationReportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.LocationReportIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: gnbue.GnbUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// User Location Information
+	ie = ngapType.LocationReportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUserLocationInformation
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.LocationReportIEsPresentUserLocationInformation
+	ie.Value.UserLocationInformation = new(ngapType.UserLocationInformation)
+	setUserLocationInformation(gnbue, ie.Value.UserLocationInformation)
+	ies.List = append(ies.List, ie)
+
+	// Location Reporting Request Type, as received in the request
+	ie = ngapType.LocationReportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDLocationReportingRequestType
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.LocationReportIEsPresentLocationReportingRequestType
+	ie.Value.LocationReportingRequestType = reqType
+	ies.List = append(ies.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+func GetLocationReportingFailureIndication(gnbue *gnbctx.GnbCpUe,
+	cause *ngapType.Cause) ([]byte, error) {
+
+	message := ngapTestpacket.BuildLocationReportingFailureIndication()
+
+	ies := message.InitiatingMessage.Value.LocationReportingFailureIndication.ProtocolIEs
+	for _, ie := range ies.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			ie.Value.AMFUENGAPID.Value = gnbue.AmfUeNgapId
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			ie.Value.RANUENGAPID.Value = gnbue.GnbUeNgapId
+		case ngapType.ProtocolIEIDCause:
+			*ie.Value.Cause = *cause
+		}
+	}
+
+	return ngap.Encoder(message)
+}
+
+func GetUERadioCapabilityInfoIndication(gnbue *gnbctx.GnbCpUe) ([]byte, error) {
+	message := ngapTestpacket.BuildUERadioCapabilityInfoIndication()
+
+	ies := message.InitiatingMessage.Value.UERadioCapabilityInfoIndication.ProtocolIEs
+	for _, ie := range ies.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			ie.Value.AMFUENGAPID.Value = gnbue.AmfUeNgapId
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			ie.Value.RANUENGAPID.Value = gnbue.GnbUeNgapId
+		case ngapType.ProtocolIEIDUERadioCapability:
+			ie.Value.UERadioCapability.Value = gnbue.UeRadioCapability
+		}
+	}
+
+	return ngap.Encoder(message)
+}
+
+func GetUERadioCapabilityCheckResponse(gnbue *gnbctx.GnbCpUe,
+	imsVoiceSupported bool) ([]byte, error) {
+
+	message := ngapTestpacket.BuildUERadioCapabilityCheckResponse()
+
+	ies := message.SuccessfulOutcome.Value.UERadioCapabilityCheckResponse.ProtocolIEs
+	for _, ie := range ies.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			ie.Value.AMFUENGAPID.Value = gnbue.AmfUeNgapId
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			ie.Value.RANUENGAPID.Value = gnbue.GnbUeNgapId
+		case ngapType.ProtocolIEIDIMSVoiceSupportIndicator:
+			if imsVoiceSupported {
+				ie.Value.IMSVoiceSupportIndicator.Value =
+					ngapType.IMSVoiceSupportIndicatorPresentSupported
+			}
+		}
+	}
+
+	return ngap.Encoder(message)
+}
+
+func GetWriteReplaceWarningResponse(gnb *gnbctx.GNodeB,
+	msgId *ngapType.MessageIdentifier, serialNum *ngapType.SerialNumber,
+	cells []*gnbctx.NrCell) ([]byte, error) {
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentSuccessfulOutcome
+	pdu.SuccessfulOutcome = new(ngapType.SuccessfulOutcome)
+
+	successfulOutcome := pdu.SuccessfulOutcome
+	successfulOutcome.ProcedureCode.Value = ngapType.ProcedureCodeWriteReplaceWarning
+	successfulOutcome.Criticality.Value = ngapType.CriticalityPresentReject
+	successfulOutcome.Value.Present = ngapType.SuccessfulOutcomePresentWriteReplaceWarningResponse
+	successfulOutcome.Value.WriteReplaceWarningResponse = new(ngapType.WriteReplaceWarningResponse)
+
+	ies := &successfulOutcome.Value.WriteReplaceWarningResponse.ProtocolIEs
+
+	// Message Identifier
+	ie := ngapType.WriteReplaceWarningResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDMessageIdentifier
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.WriteReplaceWarningResponseIEsPresentMessageIdentifier
+	ie.Value.MessageIdentifier = msgId
+	ies.List = append(ies.List, ie)
+
+	// Serial Number
+	ie = ngapType.WriteReplaceWarningResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDSerialNumber
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.WriteReplaceWarningResponseIEsPresentSerialNumber
+	ie.Value.SerialNumber = serialNum
+	ies.List = append(ies.List, ie)
+
+	// Broadcast Completed Area List
+	if len(cells) != 0 {
+		cellList := new(ngapType.CellIDBroadcastNR)
+		for _, cell := range cells {
+			item := ngapType.CellIDBroadcastNRItem{}
+			item.NRCGI = getNrCgi(gnb, cell)
+			cellList.List = append(cellList.List, item)
+		}
+
+		ie = ngapType.WriteReplaceWarningResponseIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDBroadcastCompletedAreaList
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.WriteReplaceWarningResponseIEsPresentBroadcastCompletedAreaList
+		ie.Value.BroadcastCompletedAreaList = &ngapType.BroadcastCompletedAreaList{
+			Present:           ngapType.BroadcastCompletedAreaListPresentCellIDBroadcastNR,
+			CellIDBroadcastNR: cellList,
+		}
+		ies.List = append(ies.List, ie)
+	}
+
+	return ngap.Encoder(pdu)
+}
+
+func GetPWSCancelResponse(gnb *gnbctx.GNodeB,
+	msgId *ngapType.MessageIdentifier, serialNum *ngapType.SerialNumber,
+	cancelled []*gnbctx.Warning) ([]byte, error) {
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentSuccessfulOutcome
+	pdu.SuccessfulOutcome = new(ngapType.SuccessfulOutcome)
+
+	successfulOutcome := pdu.SuccessfulOutcome
+	successfulOutcome.ProcedureCode.Value = ngapType.ProcedureCodePWSCancel
+	successfulOutcome.Criticality.Value = ngapType.CriticalityPresentReject
+	successfulOutcome.Value.Present = ngapType.SuccessfulOutcomePresentPWSCancelResponse
+	successfulOutcome.Value.PWSCancelResponse = new(ngapType.PWSCancelResponse)
+
+	ies := &successfulOutcome.Value.PWSCancelResponse.ProtocolIEs
+
+	// Message Identifier
+	ie := ngapType.PWSCancelResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDMessageIdentifier
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PWSCancelResponseIEsPresentMessageIdentifier
+	ie.Value.MessageIdentifier = msgId
+	ies.List = append(ies.List, ie)
+
+	// Serial Number
+	ie = ngapType.PWSCancelResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDSerialNumber
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PWSCancelResponseIEsPresentSerialNumber
+	ie.Value.SerialNumber = serialNum
+	ies.List = append(ies.List, ie)
+
+	// Broadcast Cancelled Area List
+	cellList := new(ngapType.CellIDCancelledNR)
+	now := time.Now()
+	for _, warning := range cancelled {
+		for _, nrCellId := range warning.NrCellIds {
+			cell, err := gnb.GetCell(nrCellId)
+			if err != nil {
+				continue
+			}
+			item := ngapType.CellIDCancelledNRItem{}
+			item.NRCGI = getNrCgi(gnb, cell)
+			item.NumberOfBroadcasts.Value = warning.GetNumberOfBroadcasts(now)
+			cellList.List = append(cellList.List, item)
+		}
+	}
+	if len(cellList.List) != 0 {
+		ie = ngapType.PWSCancelResponseIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDBroadcastCancelledAreaList
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.PWSCancelResponseIEsPresentBroadcastCancelledAreaList
+		ie.Value.BroadcastCancelledAreaList = &ngapType.BroadcastCancelledAreaList{
+			Present:           ngapType.BroadcastCancelledAreaListPresentCellIDCancelledNR,
+			CellIDCancelledNR: cellList,
+		}
+		ies.List = append(ies.List, ie)
+	}
+
+	return ngap.Encoder(pdu)
+}
+
+// GetWarningAreaCells returns the gNB cells which belong to the warning area.
+// All the cells are returned when the warning area is not provided or is not
+// expressed in terms of NR cells or TAIs
+func GetWarningAreaCells(gnb *gnbctx.GNodeB,
+	areaList *ngapType.WarningAreaList) []*gnbctx.NrCell {
+
+	if areaList == nil {
+		return gnb.Cells
+	}
+
+	var cells []*gnbctx.NrCell
+	switch areaList.Present {
+	case ngapType.WarningAreaListPresentNRCGIListForWarning:
+		for _, cell := range gnb.Cells {
+			nci := toBitString(cell.Nci, gnbctx.NR_CELL_ID_BIT_LENGTH)
+			for _, nrCgi := range areaList.NRCGIListForWarning.List {
+				if bytes.Equal(nrCgi.NRCellIdentity.Value.Bytes, nci.Bytes) {
+					cells = append(cells, cell)
+					break
+				}
+			}
+		}
+	case ngapType.WarningAreaListPresentTAIListForWarning:
+		for _, cell := range gnb.Cells {
+			for _, tai := range areaList.TAIListForWarning.List {
+				if bytes.Equal(tai.TAC.Value, cell.TacBytes) {
+					cells = append(cells, cell)
+					break
+				}
+			}
+		}
+	default:
+		cells = gnb.Cells
+	}
+	return cells
+}
+
+func getNrCgi(gnb *gnbctx.GNodeB, cell *gnbctx.NrCell) ngapType.NRCGI {
+	nrCgi := ngapType.NRCGI{}
+	nrCgi.PLMNIdentity = ngapConvert.PlmnIdToNgap(*gnb.RanId.PlmnId)
+	nrCgi.NRCellIdentity.Value = toBitString(cell.Nci,
+		gnbctx.NR_CELL_ID_BIT_LENGTH)
+	return nrCgi
+}
+
+func GetUEContextReleaseRequest(gnbue *gnbctx.GnbCpUe,
+	cause *ngapType.Cause) ([]byte, error) {
 	var pduSessIds []int64
 	f := func(k interface{}, v interface{}) bool {
 		pduSessIds = append(pduSessIds, k.(int64))
@@ -81,7 +413,208 @@ func GetUEContextReleaseRequest(gnbue *gnbctx.GnbCpUe) ([]byte, error) {
 
 	// Cause
 	ie := lst[len(lst)-1]
-	ie.Value.Cause.RadioNetwork.Value = ngapType.CauseRadioNetworkPresentUserInactivity
+	if cause != nil {
+		ie.Value.Cause = cause
+	} else {
+		ie.Value.Cause.RadioNetwork.Value = ngapType.CauseRadioNetworkPresentUserInactivity
+	}
+
+	return ngap.Encoder(message)
+}
+
+func GetRRCInactiveTransitionReport(gnbue *gnbctx.GnbCpUe,
+	rrcState aper.Enumerated) ([]byte, error) {
+
+	message := ngapTestpacket.BuildRRCInactiveTransitionReport()
+
+	ies := message.InitiatingMessage.Value.RRCInactiveTransitionReport.ProtocolIEs
+	for _, ie := range ies.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			ie.Value.AMFUENGAPID.Value = gnbue.AmfUeNgapId
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			ie.Value.RANUENGAPID.Value = gnbue.GnbUeNgapId
+		case ngapType.ProtocolIEIDRRCState:
+			ie.Value.RRCState.Value = rrcState
+		case ngapType.ProtocolIEIDUserLocationInformation:
+			setUserLocationInformation(gnbue, ie.Value.UserLocationInformation)
+		}
+	}
+
+	return ngap.Encoder(message)
+}
+
+func GetInitialContextSetupFailure(gnbue *gnbctx.GnbCpUe, pduSessIds []int64,
+	cause *ngapType.Cause) ([]byte, error) {
+
+	message := ngapTestpacket.BuildInitialContextSetupFailure(gnbue.AmfUeNgapId,
+		gnbue.GnbUeNgapId)
+
+	ies := &message.UnsuccessfulOutcome.Value.InitialContextSetupFailure.ProtocolIEs
+	var lst []ngapType.InitialContextSetupFailureIEs
+	for _, ie := range ies.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDPDUSessionResourceFailedToSetupListCxtFail:
+			// Reporting all the PDU Sessions received in the request as failed
+			if len(pduSessIds) == 0 {
+				continue
+			}
+			failedList := ie.Value.PDUSessionResourceFailedToSetupListCxtFail
+			failedList.List = nil
+			for _, id := range pduSessIds {
+				item := ngapType.PDUSessionResourceFailedToSetupItemCxtFail{}
+				item.PDUSessionID.Value = id
+				item.PDUSessionResourceSetupUnsuccessfulTransfer =
+					ngapTestpacket.GetPDUSessionResourceSetupUnsucessfulTransfer()
+				failedList.List = append(failedList.List, item)
+			}
+		case ngapType.ProtocolIEIDCause:
+			if cause != nil {
+				ie.Value.Cause = cause
+			}
+		}
+		lst = append(lst, ie)
+	}
+	ies.List = lst
+
+	return ngap.Encoder(message)
+}
+
+// GetUEContextModificationResponse builds the UE Context Modification
+// Response, carrying the RRC state and location of the UE when reportRrcState
+// is set
+func GetUEContextModificationResponse(gnbue *gnbctx.GnbCpUe,
+	reportRrcState bool) ([]byte, error) {
+
+	message := ngapTestpacket.BuildUEContextModificationResponse(
+		gnbue.AmfUeNgapId, gnbue.GnbUeNgapId)
+
+	ies := &message.SuccessfulOutcome.Value.UEContextModificationResponse.ProtocolIEs
+	var lst []ngapType.UEContextModificationResponseIEs
+	for _, ie := range ies.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDRRCState:
+			if !reportRrcState {
+				continue
+			}
+			if gnbue.RrcInactive {
+				ie.Value.RRCState.Value = ngapType.RRCStatePresentInactive
+			}
+		case ngapType.ProtocolIEIDUserLocationInformation:
+			if !reportRrcState {
+				continue
+			}
+			setUserLocationInformation(gnbue, ie.Value.UserLocationInformation)
+		}
+		lst = append(lst, ie)
+	}
+	ies.List = lst
 
 	return ngap.Encoder(message)
 }
+
+func GetUEContextModificationFailure(gnbue *gnbctx.GnbCpUe,
+	cause *ngapType.Cause) ([]byte, error) {
+
+	message := ngapTestpacket.BuildUEContextModificationFailure(
+		gnbue.AmfUeNgapId, gnbue.GnbUeNgapId)
+
+	ies := message.UnsuccessfulOutcome.Value.UEContextModificationFailure.ProtocolIEs
+	for _, ie := range ies.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDCause && cause != nil {
+			ie.Value.Cause = cause
+		}
+	}
+
+	return ngap.Encoder(message)
+}
+
+// GetPDUSessionResourceModifyResponse builds the PDU Session Resource Modify
+// Response with the modified and the failed PDU sessions. Empty lists are
+// omitted
+func GetPDUSessionResourceModifyResponse(gnbue *gnbctx.GnbCpUe,
+	modifiedList []ngapType.PDUSessionResourceModifyItemModRes,
+	failedList []ngapType.PDUSessionResourceFailedToModifyItemModRes) (
+	[]byte, error) {
+
+	message := ngapTestpacket.BuildPDUSessionResourceModifyResponse(
+		gnbue.AmfUeNgapId, gnbue.GnbUeNgapId)
+
+	ies := &message.SuccessfulOutcome.Value.PDUSessionResourceModifyResponse.ProtocolIEs
+	var lst []ngapType.PDUSessionResourceModifyResponseIEs
+	for _, ie := range ies.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDPDUSessionResourceModifyListModRes:
+			if len(modifiedList) == 0 {
+				continue
+			}
+			ie.Value.PDUSessionResourceModifyListModRes.List = modifiedList
+		case ngapType.ProtocolIEIDPDUSessionResourceFailedToModifyListModRes:
+			if len(failedList) == 0 {
+				continue
+			}
+			ie.Value.PDUSessionResourceFailedToModifyListModRes.List = failedList
+		case ngapType.ProtocolIEIDUserLocationInformation:
+			setUserLocationInformation(gnbue, ie.Value.UserLocationInformation)
+		}
+		lst = append(lst, ie)
+	}
+	ies.List = lst
+
+	return ngap.Encoder(message)
+}
+
+// setUserLocationInformation fills the NR user location information with the
+// serving cell and the PLMN selected by the UE
+func setUserLocationInformation(gnbue *gnbctx.GnbCpUe,
+	uli *ngapType.UserLocationInformation) {
+
+	cell := gnbue.Cell
+	if cell == nil || gnbue.Plmn == nil {
+		return
+	}
+	plmnId := ngapConvert.PlmnIdToNgap(*gnbue.Plmn)
+
+	uliNr := new(ngapType.UserLocationInformationNR)
+	uliNr.NRCGI.PLMNIdentity = plmnId
+	uliNr.NRCGI.NRCellIdentity.Value = toBitString(cell.Nci,
+		gnbctx.NR_CELL_ID_BIT_LENGTH)
+	uliNr.TAI.PLMNIdentity = plmnId
+	uliNr.TAI.TAC.Value = cell.TacBytes
+	if !gnbue.CellEntryTime.IsZero() {
+		uliNr.TimeStamp = &ngapType.TimeStamp{
+			Value: toTimeStamp(gnbue.CellEntryTime),
+		}
+	}
+
+	uli.Present = ngapType.UserLocationInformationPresentUserLocationInformationNR
+	uli.UserLocationInformationEUTRA = nil
+	uli.UserLocationInformationN3IWF = nil
+	uli.UserLocationInformationNR = uliNr
+}
+
+// toTimeStamp encodes the provided time as the seconds part of the NTP
+// timestamp, TS 38.413 Section 9.3.1.75
+func toTimeStamp(t time.Time) []byte {
+	ntpSeconds := uint32(t.Unix() + NTP_UNIX_EPOCH_OFFSET)
+	timeStamp := make([]byte, 4)
+	binary.BigEndian.PutUint32(timeStamp, ntpSeconds)
+	return timeStamp
+}
+
+// toBitString encodes the provided value in a bit string of the given length,
+// most significant bit first
+func toBitString(value uint64, bitLength uint64) aper.BitString {
+	byteLen := (bitLength + 7) / 8
+	value <<= byteLen*8 - bitLength
+
+	bytes := make([]byte, byteLen)
+	for i := range bytes {
+		bytes[byteLen-1-uint64(i)] = byte(value >> (8 * uint64(i)))
+	}
+
+	return aper.BitString{
+		Bytes:     bytes,
+		BitLength: bitLength,
+	}
+}
@@ -0,0 +1,336 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ngap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+
+	"github.com/omec-project/aper"
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// Seconds between the NTP epoch (1900) and the Unix epoch (1970), the time
+// stamps of the secondary RAT data usage are NTP time stamps, TS 38.413
+// Section 9.3.1.95
+const NTP_EPOCH_OFFSET int64 = 2208988800
+
+// Highest length of an open type encoded without fragmentation, X.691
+// Section 11.9
+const MAX_UNFRAGMENTED_LENGTH int = 16383
+
+// Highest number of QoS flows in the QoS Flows Usage Report List, TS 38.413
+// Section 9.3.1.95
+const MAX_QOS_FLOWS_USAGE_REPORTS int = 64
+
+// SecondaryRatUsage is the user data volume of a PDU session carried by the
+// secondary node over a time period, along with that of its QoS flows
+// reported individually
+type SecondaryRatUsage struct {
+	PduSessId int64
+	Period    gnbctx.UsagePeriod
+	QosFlows  []QosFlowUsage
+}
+
+// QosFlowUsage is the user data volume of a QoS flow carried by the secondary
+// node over a time period
+type QosFlowUsage struct {
+	Qfi    int64
+	Period gnbctx.UsagePeriod
+}
+
+// GetPduSessionResourceModifyIndication builds the PDU Session Resource Modify
+// Indication requesting the additional downlink tunnels of the secondary
+// node for the PDU sessions. All the QoS flows of a PDU session are mapped to
+// both its downlink tunnels
+func GetPduSessionResourceModifyIndication(gnbue *gnbctx.GnbCpUe,
+	upUes []*gnbctx.GnbUpUe) ([]byte, error) {
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodePDUSessionResourceModifyIndication
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentPDUSessionResourceModifyIndication
+	initiatingMessage.Value.PDUSessionResourceModifyIndication = new(ngapType.PDUSessionResourceModifyIndication)
+
+	ies := &initiatingMessage.Value.PDUSessionResourceModifyIndication.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.PDUSessionResourceModifyIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceModifyIndicationIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: gnbue.AmfUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.PDUSessionResourceModifyIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceModifyIndicationIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: gnbue.GnbUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// PDU Session Resource Modify List
+	modifyList := new(ngapType.PDUSessionResourceModifyListModInd)
+	for _, upUe := range upUes {
+		var qosFlows ngapType.AssociatedQosFlowList
+		for _, qfi := range getQosFlowIds(upUe) {
+			item := ngapType.AssociatedQosFlowItem{}
+			item.QosFlowIdentifier.Value = qfi
+			qosFlows.List = append(qosFlows.List, item)
+		}
+
+		transfer := ngapType.PDUSessionResourceModifyIndicationTransfer{}
+		transfer.DLQosFlowPerTNLInformation.UPTransportLayerInformation =
+			getDlUpTnlInformation(upUe)
+		transfer.DLQosFlowPerTNLInformation.AssociatedQosFlowList = qosFlows
+
+		additional := ngapType.QosFlowPerTNLInformationItem{}
+		additional.QosFlowPerTNLInformation.UPTransportLayerInformation =
+			getUpTnlInformation(upUe.Gnb, upUe.SecondaryDlTeid)
+		additional.QosFlowPerTNLInformation.AssociatedQosFlowList = qosFlows
+		transfer.AdditionalDLQosFlowPerTNLInformation = &ngapType.QosFlowPerTNLInformationList{
+			List: []ngapType.QosFlowPerTNLInformationItem{additional},
+		}
+
+		encodedTransfer, err := aper.MarshalWithParams(transfer, "valueExt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode pdu session resource modify indication transfer: %v", err)
+		}
+
+		item := ngapType.PDUSessionResourceModifyItemModInd{}
+		item.PDUSessionID.Value = upUe.PduSessId
+		item.PDUSessionResourceModifyIndicationTransfer = encodedTransfer
+		modifyList.List = append(modifyList.List, item)
+	}
+
+	ie = ngapType.PDUSessionResourceModifyIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDPDUSessionResourceModifyListModInd
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceModifyIndicationIEsPresentPDUSessionResourceModifyListModInd
+	ie.Value.PDUSessionResourceModifyListModInd = modifyList
+	ies.List = append(ies.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// GetSecondaryRatDataUsageReport builds the Secondary RAT Data Usage Report
+// carrying the NR data usage of the PDU sessions. The NGAP library lacks the
+// reference values of this message and its IEs, and the constraints of the
+// usage report, hence it is encoded here, while the library encodes the IEs
+// it supports
+func GetSecondaryRatDataUsageReport(gnbue *gnbctx.GnbCpUe,
+	usages []SecondaryRatUsage) ([]byte, error) {
+
+	usageList := ngapType.PDUSessionResourceSecondaryRATUsageList{}
+	for _, usage := range usages {
+		item := ngapType.PDUSessionResourceSecondaryRATUsageItem{}
+		item.PDUSessionID.Value = usage.PduSessId
+		transfer, err := encodeSecondaryRatDataUsageReportTransfer(usage)
+		if err != nil {
+			return nil, err
+		}
+		item.SecondaryRATDataUsageReportTransfer = transfer
+		usageList.List = append(usageList.List, item)
+	}
+
+	amfUeNgapId, err := aper.Marshal(ngapType.AMFUENGAPID{Value: gnbue.AmfUeNgapId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode amf ue ngap id: %v", err)
+	}
+	ranUeNgapId, err := aper.Marshal(ngapType.RANUENGAPID{Value: gnbue.GnbUeNgapId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ran ue ngap id: %v", err)
+	}
+	encodedList, err := aper.Marshal(usageList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode secondary rat usage list: %v", err)
+	}
+
+	// SecondaryRATDataUsageReport, the extension bit is followed by the
+	// number of IEs
+	msg := &perEncoder{}
+	msg.putBits(0, 1)
+	msg.align()
+	msg.putBits(3, 16)
+	ies := []struct {
+		id          int64
+		criticality aper.Enumerated
+		value       []byte
+	}{
+		{ngapType.ProtocolIEIDAMFUENGAPID, ngapType.CriticalityPresentReject, amfUeNgapId},
+		{ngapType.ProtocolIEIDRANUENGAPID, ngapType.CriticalityPresentReject, ranUeNgapId},
+		{ngapType.ProtocolIEIDPDUSessionResourceSecondaryRATUsageList,
+			ngapType.CriticalityPresentIgnore, encodedList},
+	}
+	for _, ie := range ies {
+		msg.putBits(uint64(ie.id), 16)
+		msg.putBits(uint64(ie.criticality), 2)
+		err = msg.putOpenType(ie.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// NGAP-PDU, initiating message
+	pdu := &perEncoder{}
+	pdu.putBits(0, 1)
+	pdu.putBits(0, 2)
+	pdu.align()
+	pdu.putBits(uint64(ngapType.ProcedureCodeSecondaryRATDataUsageReport), 8)
+	pdu.putBits(uint64(ngapType.CriticalityPresentIgnore), 2)
+	err = pdu.putOpenType(msg.bytes)
+	if err != nil {
+		return nil, err
+	}
+	return pdu.bytes, nil
+}
+
+// encodeSecondaryRatDataUsageReportTransfer encodes the Secondary RAT Data
+// Usage Report Transfer with the NR usage of the PDU session, and of its QoS
+// flows if any, over a single time period
+func encodeSecondaryRatDataUsageReportTransfer(usage SecondaryRatUsage) ([]byte, error) {
+	qosFlows := len(usage.QosFlows)
+	if qosFlows > MAX_QOS_FLOWS_USAGE_REPORTS {
+		return nil, fmt.Errorf("qos flows usage reports:%v exceed %v", qosFlows,
+			MAX_QOS_FLOWS_USAGE_REPORTS)
+	}
+	e := &perEncoder{}
+
+	// SecondaryRATDataUsageReportTransfer: extension bit, Secondary RAT
+	// Usage Information present, IE extensions absent
+	e.putBits(0b010, 3)
+
+	// SecondaryRATUsageInformation: extension bit, PDU Session Usage Report
+	// present, QoS Flows Usage Report List present if any, IE extension
+	// absent
+	e.putBits(0b010, 3)
+	e.putBool(qosFlows != 0)
+	e.putBits(0, 1)
+
+	// PDUSessionUsageReport: extension bit, IE extensions absent, RAT Type
+	// nr with its extension bit
+	e.putBits(0b0000, 4)
+	e.putVolumeTimedReportList(usage.Period)
+
+	if qosFlows != 0 {
+		// QoSFlowsUsageReportList, the number of items
+		e.putBits(uint64(qosFlows-1), 6)
+		for _, qosFlow := range usage.QosFlows {
+			// QoSFlowsUsageReport-Item: extension bit, IE extensions
+			// absent, QFI with its extension bit, RAT Type nr with its
+			// extension bit
+			e.putBits(0b000, 3)
+			e.putBits(uint64(qosFlow.Qfi), 6)
+			e.putBits(0b00, 2)
+			e.putVolumeTimedReportList(qosFlow.Period)
+		}
+	}
+	return e.bytes, nil
+}
+
+// putVolumeTimedReportList appends the VolumeTimedReportList with the usage
+// over a single time period
+func (e *perEncoder) putVolumeTimedReportList(period gnbctx.UsagePeriod) {
+	// Number of items
+	e.putBits(0, 1)
+
+	// VolumeTimedReport-Item: extension bit, IE extensions absent, followed
+	// by the time stamps and the usage counts
+	e.putBits(0b00, 2)
+	e.putBytes(getNtpTimeStamp(period.Start))
+	e.putBytes(getNtpTimeStamp(period.End))
+	e.putUint64(period.UlOctets)
+	e.putUint64(period.DlOctets)
+}
+
+// getNtpTimeStamp returns the seconds part of the NTP time stamp of the time,
+// RFC 5905
+func getNtpTimeStamp(t time.Time) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()+NTP_EPOCH_OFFSET))
+	return b
+}
+
+// perEncoder encodes the ASN.1 types using the aligned variant of the packed
+// encoding rules, X.691
+type perEncoder struct {
+	bytes []byte
+
+	// Bits used in the last octet, 0 when octet aligned
+	bitOffset uint
+}
+
+// putBits appends the n least significant bits of the value
+func (e *perEncoder) putBits(value uint64, n uint) {
+	for i := n; i > 0; i-- {
+		if e.bitOffset == 0 {
+			e.bytes = append(e.bytes, 0)
+		}
+		if value>>(i-1)&1 == 1 {
+			e.bytes[len(e.bytes)-1] |= 0x80 >> e.bitOffset
+		}
+		e.bitOffset = (e.bitOffset + 1) % 8
+	}
+}
+
+// putBool appends a BOOLEAN, or a presence bit of an optional component
+func (e *perEncoder) putBool(value bool) {
+	if value {
+		e.putBits(1, 1)
+	} else {
+		e.putBits(0, 1)
+	}
+}
+
+// align pads the encoding to the octet boundary
+func (e *perEncoder) align() {
+	e.bitOffset = 0
+}
+
+// putBytes appends the octets, octet aligned
+func (e *perEncoder) putBytes(b []byte) {
+	e.align()
+	e.bytes = append(e.bytes, b...)
+}
+
+// putUint64 appends an INTEGER (0..18446744073709551615), its length in
+// octets as a constrained whole number followed by the minimum number of
+// octets, X.691 Section 12.2.6
+func (e *perEncoder) putUint64(value uint64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, value)
+	n := 8
+	for n > 1 && b[8-n] == 0 {
+		n--
+	}
+	e.putBits(uint64(n-1), 3)
+	e.putBytes(b[8-n:])
+}
+
+// putOpenType appends the encoding of an open type, preceded by its length
+func (e *perEncoder) putOpenType(value []byte) error {
+	length := len(value)
+	if length > MAX_UNFRAGMENTED_LENGTH {
+		return fmt.Errorf("open type length:%v exceeds %v", length,
+			MAX_UNFRAGMENTED_LENGTH)
+	}
+	e.align()
+	if length < 128 {
+		e.bytes = append(e.bytes, byte(length))
+	} else {
+		e.bytes = append(e.bytes, byte(0x80|length>>8), byte(length))
+	}
+	e.bytes = append(e.bytes, value...)
+	return nil
+}
@@ -0,0 +1,557 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ngap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/util/ngapTestpacket"
+
+	"github.com/omec-project/aper"
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapConvert"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// Maximum value of Time UE Stayed in Cell in seconds, TS 38.413 Section
+// 9.3.1.97
+const MAX_TIME_UE_STAYED_IN_CELL int64 = 4095
+
+// GetPathSwitchRequest builds the Path Switch Request sent by the target gNB
+// once the UE is handed over through Xn. All the PDU sessions of the UE are
+// requested to be switched to the downlink tunnels of the target gNB
+func GetPathSwitchRequest(gnbue *gnbctx.GnbCpUe,
+	sourceAmfUeNgapId int64) ([]byte, error) {
+
+	upUes := getGnbUpUes(gnbue)
+	if len(upUes) == 0 {
+		return nil, fmt.Errorf("no pdu session to be switched")
+	}
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodePathSwitchRequest
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentPathSwitchRequest
+	initiatingMessage.Value.PathSwitchRequest = new(ngapType.PathSwitchRequest)
+
+	ies := &initiatingMessage.Value.PathSwitchRequest.ProtocolIEs
+
+	// RAN UE NGAP ID
+	ie := ngapType.PathSwitchRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PathSwitchRequestIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: gnbue.GnbUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// Source AMF UE NGAP ID
+	ie = ngapType.PathSwitchRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDSourceAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PathSwitchRequestIEsPresentSourceAMFUENGAPID
+	ie.Value.SourceAMFUENGAPID = &ngapType.AMFUENGAPID{Value: sourceAmfUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// User Location Information
+	ie = ngapType.PathSwitchRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUserLocationInformation
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.PathSwitchRequestIEsPresentUserLocationInformation
+	ie.Value.UserLocationInformation = new(ngapType.UserLocationInformation)
+	setUserLocationInformation(gnbue, ie.Value.UserLocationInformation)
+	ies.List = append(ies.List, ie)
+
+	// UE Security Capabilities
+	ie = ngapType.PathSwitchRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUESecurityCapabilities
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.PathSwitchRequestIEsPresentUESecurityCapabilities
+	ie.Value.UESecurityCapabilities = getUeSecurityCapabilities(gnbue)
+	ies.List = append(ies.List, ie)
+
+	// PDU Session Resource to be Switched in Downlink List
+	switchedList := new(ngapType.PDUSessionResourceToBeSwitchedDLList)
+	for _, upUe := range upUes {
+		transfer := ngapType.PathSwitchRequestTransfer{}
+		transfer.DLNGUUPTNLInformation = getDlUpTnlInformation(upUe)
+		for _, qfi := range getQosFlowIds(upUe) {
+			item := ngapType.QosFlowAcceptedItem{}
+			item.QosFlowIdentifier.Value = qfi
+			transfer.QosFlowAcceptedList.List = append(
+				transfer.QosFlowAcceptedList.List, item)
+		}
+		encodedTransfer, err := aper.MarshalWithParams(transfer, "valueExt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode path switch request transfer: %v", err)
+		}
+
+		item := ngapType.PDUSessionResourceToBeSwitchedDLItem{}
+		item.PDUSessionID.Value = upUe.PduSessId
+		item.PathSwitchRequestTransfer = encodedTransfer
+		switchedList.List = append(switchedList.List, item)
+	}
+
+	ie = ngapType.PathSwitchRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDPDUSessionResourceToBeSwitchedDLList
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PathSwitchRequestIEsPresentPDUSessionResourceToBeSwitchedDLList
+	ie.Value.PDUSessionResourceToBeSwitchedDLList = switchedList
+	ies.List = append(ies.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// GetHandoverRequired builds the Handover Required sent by the source gNB to
+// initiate N2 handover towards the target cell. The RRC container of the
+// source to target transparent container carries the handover identifier,
+// which lets the target gNB correlate the Handover Request with the source
+func GetHandoverRequired(gnbue *gnbctx.GnbCpUe, ho *gnbctx.Handover) ([]byte, error) {
+
+	upUes := getGnbUpUes(gnbue)
+	if len(upUes) == 0 {
+		return nil, fmt.Errorf("no pdu session to be handed over")
+	}
+
+	targetGnb := ho.TargetGnb
+	gnbId, bitLength, err := targetGnb.GetGnbId()
+	if err != nil {
+		return nil, err
+	}
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeHandoverPreparation
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentHandoverRequired
+	initiatingMessage.Value.HandoverRequired = new(ngapType.HandoverRequired)
+
+	ies := &initiatingMessage.Value.HandoverRequired.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.HandoverRequiredIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverRequiredIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: gnbue.AmfUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.HandoverRequiredIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverRequiredIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: gnbue.GnbUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// Handover Type
+	ie = ngapType.HandoverRequiredIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDHandoverType
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverRequiredIEsPresentHandoverType
+	ie.Value.HandoverType = &ngapType.HandoverType{
+		Value: ngapType.HandoverTypePresentIntra5gs,
+	}
+	ies.List = append(ies.List, ie)
+
+	// Cause
+	ie = ngapType.HandoverRequiredIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDCause
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.HandoverRequiredIEsPresentCause
+	ie.Value.Cause = &ngapType.Cause{
+		Present: ngapType.CausePresentRadioNetwork,
+		RadioNetwork: &ngapType.CauseRadioNetwork{
+			Value: ngapType.CauseRadioNetworkPresentHandoverDesirableForRadioReason,
+		},
+	}
+	if ho.RequiredCause != nil {
+		ie.Value.Cause = ho.RequiredCause
+	}
+	ies.List = append(ies.List, ie)
+
+	// Target ID, the gNB ID is right aligned within the bit string
+	globalRanNodeId := ngapConvert.RanIDToNgap(targetGnb.RanId)
+	*globalRanNodeId.GlobalGNBID.GNBID.GNBID = toBitString(gnbId, bitLength)
+
+	targetRanNodeId := new(ngapType.TargetRANNodeID)
+	targetRanNodeId.GlobalRANNodeID = globalRanNodeId
+	targetRanNodeId.SelectedTAI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*gnbue.Plmn)
+	targetRanNodeId.SelectedTAI.TAC.Value = ho.TargetCell.TacBytes
+
+	ie = ngapType.HandoverRequiredIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDTargetID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverRequiredIEsPresentTargetID
+	ie.Value.TargetID = &ngapType.TargetID{
+		Present:         ngapType.TargetIDPresentTargetRANNodeID,
+		TargetRANNodeID: targetRanNodeId,
+	}
+	ies.List = append(ies.List, ie)
+
+	// PDU Session Resource List, Handover Required Transfer carries only
+	// optional IEs
+	hoRqdList := new(ngapType.PDUSessionResourceListHORqd)
+	infoList := new(ngapType.PDUSessionResourceInformationList)
+	for _, upUe := range upUes {
+		encodedTransfer, err := aper.MarshalWithParams(
+			ngapType.HandoverRequiredTransfer{}, "valueExt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode handover required transfer: %v", err)
+		}
+		item := ngapType.PDUSessionResourceItemHORqd{}
+		item.PDUSessionID.Value = upUe.PduSessId
+		item.HandoverRequiredTransfer = encodedTransfer
+		hoRqdList.List = append(hoRqdList.List, item)
+
+		infoItem := ngapType.PDUSessionResourceInformationItem{}
+		infoItem.PDUSessionID.Value = upUe.PduSessId
+		for _, qfi := range getQosFlowIds(upUe) {
+			qosItem := ngapType.QosFlowInformationItem{}
+			qosItem.QosFlowIdentifier.Value = qfi
+			infoItem.QosFlowInformationList.List = append(
+				infoItem.QosFlowInformationList.List, qosItem)
+		}
+		infoList.List = append(infoList.List, infoItem)
+	}
+
+	ie = ngapType.HandoverRequiredIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDPDUSessionResourceListHORqd
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverRequiredIEsPresentPDUSessionResourceListHORqd
+	ie.Value.PDUSessionResourceListHORqd = hoRqdList
+	ies.List = append(ies.List, ie)
+
+	// Source to Target Transparent Container
+	container := ngapType.SourceNGRANNodeToTargetNGRANNodeTransparentContainer{}
+	container.RRCContainer.Value = ho.GetRrcContainer()
+	container.PDUSessionResourceInformationList = infoList
+	targetNrCgi := getNrCgi(targetGnb, ho.TargetCell)
+	container.TargetCellID.Present = ngapType.NGRANCGIPresentNRCGI
+	container.TargetCellID.NRCGI = &targetNrCgi
+	container.UEHistoryInformation.List = append(
+		container.UEHistoryInformation.List, getLastVisitedCellItem(gnbue))
+
+	encodedContainer, err := aper.MarshalWithParams(container, "valueExt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode source to target transparent container: %v", err)
+	}
+
+	ie = ngapType.HandoverRequiredIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDSourceToTargetTransparentContainer
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverRequiredIEsPresentSourceToTargetTransparentContainer
+	ie.Value.SourceToTargetTransparentContainer = &ngapType.SourceToTargetTransparentContainer{
+		Value: encodedContainer,
+	}
+	ies.List = append(ies.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// GetHandoverRequestAcknowledge builds the Handover Request Acknowledge sent
+// by the target gNB, admitting the PDU sessions for which the user plane
+// resources are allocated
+func GetHandoverRequestAcknowledge(gnbue *gnbctx.GnbCpUe,
+	rrcContainer []byte) ([]byte, error) {
+
+	upUes := getGnbUpUes(gnbue)
+	if len(upUes) == 0 {
+		return nil, fmt.Errorf("no pdu session admitted")
+	}
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentSuccessfulOutcome
+	pdu.SuccessfulOutcome = new(ngapType.SuccessfulOutcome)
+
+	successfulOutcome := pdu.SuccessfulOutcome
+	successfulOutcome.ProcedureCode.Value = ngapType.ProcedureCodeHandoverResourceAllocation
+	successfulOutcome.Criticality.Value = ngapType.CriticalityPresentReject
+	successfulOutcome.Value.Present = ngapType.SuccessfulOutcomePresentHandoverRequestAcknowledge
+	successfulOutcome.Value.HandoverRequestAcknowledge = new(ngapType.HandoverRequestAcknowledge)
+
+	ies := &successfulOutcome.Value.HandoverRequestAcknowledge.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.HandoverRequestAcknowledgeIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.HandoverRequestAcknowledgeIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: gnbue.AmfUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.HandoverRequestAcknowledgeIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.HandoverRequestAcknowledgeIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: gnbue.GnbUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// PDU Session Resource Admitted List
+	admittedList := new(ngapType.PDUSessionResourceAdmittedList)
+	for _, upUe := range upUes {
+		transfer := ngapType.HandoverRequestAcknowledgeTransfer{}
+		transfer.DLNGUUPTNLInformation = getDlUpTnlInformation(upUe)
+		for _, qfi := range getQosFlowIds(upUe) {
+			item := ngapType.QosFlowItemWithDataForwarding{}
+			item.QosFlowIdentifier.Value = qfi
+			transfer.QosFlowSetupResponseList.List = append(
+				transfer.QosFlowSetupResponseList.List, item)
+		}
+		encodedTransfer, err := aper.MarshalWithParams(transfer, "valueExt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode handover request acknowledge transfer: %v", err)
+		}
+
+		item := ngapType.PDUSessionResourceAdmittedItem{}
+		item.PDUSessionID.Value = upUe.PduSessId
+		item.HandoverRequestAcknowledgeTransfer = encodedTransfer
+		admittedList.List = append(admittedList.List, item)
+	}
+
+	ie = ngapType.HandoverRequestAcknowledgeIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDPDUSessionResourceAdmittedList
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.HandoverRequestAcknowledgeIEsPresentPDUSessionResourceAdmittedList
+	ie.Value.PDUSessionResourceAdmittedList = admittedList
+	ies.List = append(ies.List, ie)
+
+	// Target to Source Transparent Container, the RRC container is returned
+	// as received from the source
+	container := ngapType.TargetNGRANNodeToSourceNGRANNodeTransparentContainer{}
+	container.RRCContainer.Value = rrcContainer
+	encodedContainer, err := aper.MarshalWithParams(container, "valueExt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode target to source transparent container: %v", err)
+	}
+
+	ie = ngapType.HandoverRequestAcknowledgeIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDTargetToSourceTransparentContainer
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverRequestAcknowledgeIEsPresentTargetToSourceTransparentContainer
+	ie.Value.TargetToSourceTransparentContainer = &ngapType.TargetToSourceTransparentContainer{
+		Value: encodedContainer,
+	}
+	ies.List = append(ies.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// GetHandoverFailure builds the Handover Failure sent by the target gNB when
+// it is unable to accept the handover
+func GetHandoverFailure(amfUeNgapId int64, cause *ngapType.Cause) ([]byte, error) {
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentUnsuccessfulOutcome
+	pdu.UnsuccessfulOutcome = new(ngapType.UnsuccessfulOutcome)
+
+	unsuccessfulOutcome := pdu.UnsuccessfulOutcome
+	unsuccessfulOutcome.ProcedureCode.Value = ngapType.ProcedureCodeHandoverResourceAllocation
+	unsuccessfulOutcome.Criticality.Value = ngapType.CriticalityPresentReject
+	unsuccessfulOutcome.Value.Present = ngapType.UnsuccessfulOutcomePresentHandoverFailure
+	unsuccessfulOutcome.Value.HandoverFailure = new(ngapType.HandoverFailure)
+
+	ies := &unsuccessfulOutcome.Value.HandoverFailure.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.HandoverFailureIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.HandoverFailureIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: amfUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// Cause
+	ie = ngapType.HandoverFailureIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDCause
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.HandoverFailureIEsPresentCause
+	ie.Value.Cause = cause
+	ies.List = append(ies.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// GetHandoverNotify builds the Handover Notify sent by the target gNB once
+// the UE has arrived in the target cell
+func GetHandoverNotify(gnbue *gnbctx.GnbCpUe) ([]byte, error) {
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeHandoverNotification
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentHandoverNotify
+	initiatingMessage.Value.HandoverNotify = new(ngapType.HandoverNotify)
+
+	ies := &initiatingMessage.Value.HandoverNotify.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.HandoverNotifyIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverNotifyIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: gnbue.AmfUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.HandoverNotifyIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverNotifyIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: gnbue.GnbUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// User Location Information
+	ie = ngapType.HandoverNotifyIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUserLocationInformation
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.HandoverNotifyIEsPresentUserLocationInformation
+	ie.Value.UserLocationInformation = new(ngapType.UserLocationInformation)
+	setUserLocationInformation(gnbue, ie.Value.UserLocationInformation)
+	ies.List = append(ies.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// GetHandoverCancel builds the Handover Cancel sent by the source gNB to
+// cancel the N2 handover in preparation or already prepared
+func GetHandoverCancel(gnbue *gnbctx.GnbCpUe, cause *ngapType.Cause) ([]byte, error) {
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeHandoverCancel
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentHandoverCancel
+	initiatingMessage.Value.HandoverCancel = new(ngapType.HandoverCancel)
+
+	ies := &initiatingMessage.Value.HandoverCancel.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.HandoverCancelIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverCancelIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: gnbue.AmfUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.HandoverCancelIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.HandoverCancelIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: gnbue.GnbUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// Cause
+	ie = ngapType.HandoverCancelIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDCause
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.HandoverCancelIEsPresentCause
+	ie.Value.Cause = cause
+	ies.List = append(ies.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// getGnbUpUes returns the user plane contexts of the UE, ordered by the PDU
+// session ID
+func getGnbUpUes(gnbue *gnbctx.GnbCpUe) []*gnbctx.GnbUpUe {
+	var upUes []*gnbctx.GnbUpUe
+	f := func(k interface{}, v interface{}) bool {
+		upUes = append(upUes, v.(*gnbctx.GnbUpUe))
+		return true
+	}
+	gnbue.GnbUpUes.Range(f)
+
+	sort.Slice(upUes, func(i, j int) bool {
+		return upUes[i].PduSessId < upUes[j].PduSessId
+	})
+	return upUes
+}
+
+func getQosFlowIds(upUe *gnbctx.GnbUpUe) []int64 {
+	var qfis []int64
+	for qfi := range upUe.QosFlows {
+		qfis = append(qfis, qfi)
+	}
+	sort.Slice(qfis, func(i, j int) bool { return qfis[i] < qfis[j] })
+	return qfis
+}
+
+// getDlUpTnlInformation returns the downlink tunnel of the PDU session, which
+// terminates at the N3 address of the gNB
+func getDlUpTnlInformation(upUe *gnbctx.GnbUpUe) ngapType.UPTransportLayerInformation {
+	return getUpTnlInformation(upUe.Gnb, upUe.DlTeid)
+}
+
+// getUpTnlInformation returns the tunnel with the TEID at the N3 address of
+// the gNB
+func getUpTnlInformation(gnb *gnbctx.GNodeB, dlTeid uint32) ngapType.UPTransportLayerInformation {
+	teid := make([]byte, 4)
+	binary.BigEndian.PutUint32(teid, dlTeid)
+
+	tnlInfo := ngapType.UPTransportLayerInformation{}
+	tnlInfo.Present = ngapType.UPTransportLayerInformationPresentGTPTunnel
+	tnlInfo.GTPTunnel = new(ngapType.GTPTunnel)
+	tnlInfo.GTPTunnel.GTPTEID.Value = teid
+	tnlInfo.GTPTunnel.TransportLayerAddress = ngapTestpacket.IpAddressToNgap(
+		gnb.GnbN3Ip)
+	return tnlInfo
+}
+
+// getUeSecurityCapabilities returns the UE Security Capabilities provided by
+// the AMF, or all the algorithms as supported if not provided
+func getUeSecurityCapabilities(gnbue *gnbctx.GnbCpUe) *ngapType.UESecurityCapabilities {
+	if gnbue.UeSecurityCapabilities != nil {
+		return gnbue.UeSecurityCapabilities
+	}
+
+	allAlgs := aper.BitString{Bytes: []byte{0xff, 0xff}, BitLength: 16}
+	caps := new(ngapType.UESecurityCapabilities)
+	caps.NRencryptionAlgorithms.Value = allAlgs
+	caps.NRintegrityProtectionAlgorithms.Value = allAlgs
+	caps.EUTRAencryptionAlgorithms.Value = allAlgs
+	caps.EUTRAintegrityProtectionAlgorithms.Value = allAlgs
+	return caps
+}
+
+// getLastVisitedCellItem returns the serving cell of the UE along with the
+// time for which the UE stayed in it, reported in the UE History Information
+func getLastVisitedCellItem(gnbue *gnbctx.GnbCpUe) ngapType.LastVisitedCellItem {
+	nrCgi := getNrCgi(gnbue.Gnb, gnbue.Cell)
+
+	cellInfo := new(ngapType.LastVisitedNGRANCellInformation)
+	cellInfo.GlobalCellID.Present = ngapType.NGRANCGIPresentNRCGI
+	cellInfo.GlobalCellID.NRCGI = &nrCgi
+	cellInfo.CellType.CellSize.Value = ngapType.CellSizePresentSmall
+
+	stayed := int64(time.Since(gnbue.CellEntryTime) / time.Second)
+	if stayed > MAX_TIME_UE_STAYED_IN_CELL {
+		stayed = MAX_TIME_UE_STAYED_IN_CELL
+	}
+	cellInfo.TimeUEStayedInCell.Value = stayed
+
+	item := ngapType.LastVisitedCellItem{}
+	item.LastVisitedCellInformation.Present = ngapType.LastVisitedCellInformationPresentNGRANCell
+	item.LastVisitedCellInformation.NGRANCell = cellInfo
+	return item
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ngap
+
+import (
+	"fmt"
+
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// GetReroutedInitialUEMessage builds the Initial UE Message sent to the AMF
+// selected from the AMF set indicated in the Reroute NAS Request. The message
+// is the Initial UE Message received in the request, carrying in addition the
+// AMF Set ID and the Allowed NSSAI when received, TS 38.413 Section 8.6.5
+func GetReroutedInitialUEMessage(ngapMessage []byte, amfSetId *ngapType.AMFSetID,
+	allowedNssai *ngapType.AllowedNSSAI) ([]byte, error) {
+
+	pdu, err := ngap.Decoder(ngapMessage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ngap message:%v", err)
+	}
+	if pdu.InitiatingMessage == nil ||
+		pdu.InitiatingMessage.Value.InitialUEMessage == nil {
+		return nil, fmt.Errorf("ngap message is not an initial ue message")
+	}
+
+	ies := &pdu.InitiatingMessage.Value.InitialUEMessage.ProtocolIEs
+	list := ies.List[:0]
+	for _, ie := range ies.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFSetID, ngapType.ProtocolIEIDAllowedNSSAI:
+			continue
+		}
+		list = append(list, ie)
+	}
+	ies.List = list
+
+	// AMF Set ID
+	if amfSetId != nil {
+		ie := ngapType.InitialUEMessageIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDAMFSetID
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.InitialUEMessageIEsPresentAMFSetID
+		ie.Value.AMFSetID = amfSetId
+		ies.List = append(ies.List, ie)
+	}
+
+	// Allowed NSSAI
+	if allowedNssai != nil {
+		ie := ngapType.InitialUEMessageIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDAllowedNSSAI
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.InitialUEMessageIEsPresentAllowedNSSAI
+		ie.Value.AllowedNSSAI = allowedNssai
+		ies.List = append(ies.List, ie)
+	}
+
+	return ngap.Encoder(*pdu)
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ngap
+
+import (
+	"fmt"
+
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// GetCellTrafficTrace builds the Cell Traffic Trace reporting the cell serving
+// the UE for the trace activated for it
+func GetCellTrafficTrace(gnbue *gnbctx.GnbCpUe) ([]byte, error) {
+	if gnbue.Trace == nil {
+		return nil, fmt.Errorf("no trace activated")
+	}
+	if gnbue.Cell == nil {
+		return nil, fmt.Errorf("serving cell not known")
+	}
+
+	pdu := ngapType.NGAPPDU{}
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeCellTrafficTrace
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentCellTrafficTrace
+	initiatingMessage.Value.CellTrafficTrace = new(ngapType.CellTrafficTrace)
+
+	ies := &initiatingMessage.Value.CellTrafficTrace.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.CellTrafficTraceIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.CellTrafficTraceIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: gnbue.AmfUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.CellTrafficTraceIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.CellTrafficTraceIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: gnbue.GnbUeNgapId}
+	ies.List = append(ies.List, ie)
+
+	// NG-RAN Trace ID
+	ie = ngapType.CellTrafficTraceIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNGRANTraceID
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.CellTrafficTraceIEsPresentNGRANTraceID
+	traceId := gnbue.Trace.NGRANTraceID
+	ie.Value.NGRANTraceID = &traceId
+	ies.List = append(ies.List, ie)
+
+	// NG-RAN CGI
+	ie = ngapType.CellTrafficTraceIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNGRANCGI
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.CellTrafficTraceIEsPresentNGRANCGI
+	nrCgi := getNrCgi(gnbue.Gnb, gnbue.Cell)
+	ie.Value.NGRANCGI = &ngapType.NGRANCGI{
+		Present: ngapType.NGRANCGIPresentNRCGI,
+		NRCGI:   &nrCgi,
+	}
+	ies.List = append(ies.List, ie)
+
+	// Trace Collection Entity IP Address
+	ie = ngapType.CellTrafficTraceIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDTraceCollectionEntityIPAddress
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.CellTrafficTraceIEsPresentTraceCollectionEntityIPAddress
+	tceAddr := gnbue.Trace.TraceCollectionEntityIPAddress
+	ie.Value.TraceCollectionEntityIPAddress = &tceAddr
+	ies.List = append(ies.List, ie)
+
+	return ngap.Encoder(pdu)
+}
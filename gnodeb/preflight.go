@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gnodeb
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/omec-project/gnbsim/factory"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/util/test"
+)
+
+// Checks of the pre-flight report
+const (
+	PREFLIGHT_GNB_INIT  = "gNB Init"
+	PREFLIGHT_AMF_SCTP  = "AMF SCTP"
+	PREFLIGHT_NG_SETUP  = "NG Setup"
+	PREFLIGHT_GTPU_ECHO = "GTP-U Echo"
+)
+
+// Sequence number of the GTP-U echo requests sent by the pre-flight checks,
+// and the size of the buffer into which the echo responses are read
+const (
+	PREFLIGHT_ECHO_SEQ_NUM uint16 = 1
+	MAX_GTPU_ECHO_LEN      int    = 512
+)
+
+// PreflightCheck is the result of a check of a gNodeB against an AMF or UPF
+// endpoint
+type PreflightCheck struct {
+	GnbName  string
+	Check    string
+	Target   string
+	Duration time.Duration
+
+	// nil if the check passed
+	Err error
+}
+
+// PreflightReport holds the results of the pre-flight checks, in the order
+// in which the checks were run
+type PreflightReport struct {
+	Checks []*PreflightCheck
+}
+
+// add records the result of a check started at the provided time. It is a
+// no-op when the report is nil, i.e. when the checks are not enabled
+func (r *PreflightReport) add(gnb *gnbctx.GNodeB, check, target string,
+	start time.Time, err error) {
+
+	if r == nil {
+		return
+	}
+	r.Checks = append(r.Checks, &PreflightCheck{
+		GnbName:  gnb.GnbName,
+		Check:    check,
+		Target:   target,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+// GetFailedCount returns the number of the checks which failed
+func (r *PreflightReport) GetFailedCount() int {
+	count := 0
+	for _, check := range r.Checks {
+		if check.Err != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// RunPreflightChecks initializes the gNodeBs and checks the SCTP association
+// with the AMF and NG Setup of each gNodeB, followed by the GTP-U echo with
+// each of the configured UPFs. Unlike InitializeAllGnbs, all the gNodeBs are
+// checked even if some fail, so that the report covers all the endpoints
+func RunPreflightChecks() *PreflightReport {
+	config := factory.AppConfig.Configuration
+	var names []string
+	for name := range config.Gnbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	timeout := config.Preflight.Timeout
+	if timeout == 0 {
+		timeout = factory.DEFAULT_PREFLIGHT_TIMEOUT
+	}
+
+	report := &PreflightReport{}
+	for _, name := range names {
+		gnb := config.Gnbs[name]
+		start := time.Now()
+		count := len(report.Checks)
+		err := initGnb(gnb, report)
+		if err != nil && len(report.Checks) == count {
+			// Failed before connecting to the AMF
+			report.add(gnb, PREFLIGHT_GNB_INIT, gnb.GnbN2Ip, start, err)
+		}
+
+		for _, upf := range config.Preflight.Upfs {
+			start := time.Now()
+			target, err := sendGtpuEcho(gnb, upf, time.Duration(timeout)*time.Second)
+			report.add(gnb, PREFLIGHT_GTPU_ECHO, target, start, err)
+		}
+	}
+	return report
+}
+
+// sendGtpuEcho sends a GTP-U echo request to the UPF from the N3 address of
+// the gNodeB and waits for the echo response. It returns the address of the
+// UPF
+func sendGtpuEcho(gnb *gnbctx.GNodeB, upf string, timeout time.Duration) (string, error) {
+	addr := upf
+	if _, _, err := net.SplitHostPort(upf); err != nil {
+		addr = net.JoinHostPort(upf, strconv.Itoa(gnbctx.GTP_U_PORT))
+	}
+	upfAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return addr, fmt.Errorf("invalid upf address:%v", err)
+	}
+
+	// Separate socket, so that the response is not handed over to the user
+	// plane transport of the gNodeB
+	dialer := net.Dialer{
+		LocalAddr: &net.UDPAddr{IP: net.ParseIP(gnb.GnbN3Ip)},
+		Control:   gnbctx.BindToDevice(gnb.GnbN3Interface),
+	}
+	conn, err := dialer.Dial("udp", upfAddr.String())
+	if err != nil {
+		return addr, fmt.Errorf("failed to create udp socket:%v", err)
+	}
+	defer conn.Close()
+
+	req, err := test.BuildEchoRequest(PREFLIGHT_ECHO_SEQ_NUM)
+	if err != nil {
+		return addr, fmt.Errorf("failed to build echo request:%v", err)
+	}
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return addr, err
+	}
+	_, err = conn.Write(req)
+	if err != nil {
+		return addr, fmt.Errorf("failed to send echo request:%v", err)
+	}
+
+	buf := make([]byte, MAX_GTPU_ECHO_LEN)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return addr, fmt.Errorf("no echo response:%v", err)
+		}
+		gtpPdu, err := test.DecodeGTPv1Header(buf[:n])
+		if err != nil {
+			continue
+		}
+		if gtpPdu.Hdr.MsgType == test.TYPE_ECHO_RESPONSE && gtpPdu.OptHdr != nil &&
+			gtpPdu.OptHdr.SeqNum == PREFLIGHT_ECHO_SEQ_NUM {
+			return addr, nil
+		}
+	}
+}
+
+// getAmfAddr returns the address of the AMF as reported in the pre-flight
+// report
+func getAmfAddr(amf *gnbctx.GnbAmf) string {
+	host := amf.AmfIp
+	if host == "" {
+		host = amf.AmfHostName
+	}
+	return net.JoinHostPort(host, strconv.Itoa(amf.AmfPort))
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"syscall"
 
 	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
@@ -23,6 +24,36 @@ import (
 // Need to check if NGAP may exceed this limit
 var MAX_SCTP_PKT_LEN int = 2048
 
+// sctpRecvBufPool holds the buffers into which the NGAP messages are read,
+// shared by the receive handlers of all the AMFs. A buffer is returned to the
+// pool once the message it holds is decoded and routed. The decoded NGAP
+// message does not refer to the buffer, since the APER decoder copies the
+// content of the open type fields, which carry all the NGAP IEs
+var sctpRecvBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, MAX_SCTP_PKT_LEN)
+		return &b
+	},
+}
+
+// readSctpMsg reads a message from the SCTP connection into a pooled buffer,
+// returning the buffer and the length of the message. The buffer is to be
+// released through releaseSctpBuf once the message is consumed
+func readSctpMsg(conn *sctp.SCTPConn) (*[]byte, int, error) {
+	buf := sctpRecvBufPool.Get().(*[]byte)
+	n, _, _, err := conn.SCTPRead(*buf)
+	if err != nil {
+		releaseSctpBuf(buf)
+		return nil, 0, err
+	}
+	return buf, n, nil
+}
+
+// releaseSctpBuf returns the buffer read by readSctpMsg to the pool
+func releaseSctpBuf(buf *[]byte) {
+	sctpRecvBufPool.Put(buf)
+}
+
 //TODO: Should have a context variable which when cancelled will result in
 // the termination of the ReceiveFromPeer handler
 
@@ -61,17 +92,106 @@ func (cpTprt *GnbCpTransport) ConnectToPeer(peer transportcommon.TransportPeer)
 		amf.AmfIp = addrs[0]
 	}
 
-	amf.Conn, err = test.ConnectToAmf(amf.AmfIp, gnb.GnbN2Ip, int(amf.AmfPort),
-		int(gnb.GnbN2Port))
+	// Associations with the additional AMFs are bound to an ephemeral port,
+	// the N2 port is bound by the association with the default AMF
+	localPort := gnb.GnbN2Port
+	if amf != gnb.DefaultAmf {
+		localPort = 0
+	}
+
+	amf.Dtls = nil
+	fd, err := connectAssociation(gnb, amf, localPort)
 	if err != nil {
-		return fmt.Errorf("failed to connect amf, ip: %v, port: %v, err: %v",
-			amf.AmfIp, amf.AmfPort, err)
+		return err
+	}
+
+	if gnb.Dtls != nil {
+		amf.Dtls, err = cpTprt.secureAssociation(amf)
+		if err != nil {
+			// Association carrying the failed handshake is not reused
+			amf.Conn.Close()
+			if !gnb.Dtls.FallbackToSctp {
+				return fmt.Errorf("failed to establish dtls with amf, ip: %v, err: %v",
+					amf.AmfIp, err)
+			}
+			cpTprt.Log.Warnln("Failed to establish DTLS, falling back to plain SCTP:", err)
+			fd, err = connectAssociation(gnb, amf, localPort)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
+	amf.SetN2Up(fd)
 	cpTprt.Log.Infoln("Connected to AMF, AMF IP:", amf.AmfIp, "AMF Port:", amf.AmfPort)
 	return
 }
 
+// connectAssociation establishes the SCTP association with the AMF, returning
+// the socket of the association when it is queried for its statistics
+func connectAssociation(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	localPort int) (int, error) {
+
+	// The socket of an IPv6 association is created with the IPv6 address
+	// family, which is taken care of by the multihomed connection
+	amfIp := net.ParseIP(amf.AmfIp)
+	ipv6 := amfIp != nil && amfIp.To4() == nil
+	var fd int
+	var err error
+	if len(amf.AmfSecondaryIps) == 0 && len(gnb.GnbN2SecondaryIps) == 0 &&
+		gnb.Sctp == nil && gnb.GnbN2Interface == "" && !ipv6 {
+		amf.Conn, err = test.ConnectToAmf(amf.AmfIp, gnb.GnbN2Ip, int(amf.AmfPort),
+			localPort)
+	} else {
+		amf.Conn, fd, err = connectToAmfMultihomed(gnb, amf, localPort)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect amf, ip: %v, port: %v, err: %v",
+			amf.AmfIp, amf.AmfPort, err)
+	}
+	return fd, nil
+}
+
+// connectToAmfMultihomed establishes the SCTP association using all the
+// configured addresses of the gNB and the AMF, along with the SCTP parameters
+// and the N2 interface. It returns the socket of the association as well
+func connectToAmfMultihomed(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	localPort int) (net.Conn, int, error) {
+	amfIps := append([]string{amf.AmfIp}, amf.AmfSecondaryIps...)
+
+	var gnbIps []string
+	if gnb.GnbN2Ip != "" {
+		gnbIps = append(gnbIps, gnb.GnbN2Ip)
+	}
+	gnbIps = append(gnbIps, gnb.GnbN2SecondaryIps...)
+
+	var params *test.SctpParams
+	if gnb.Sctp != nil {
+		params = &test.SctpParams{
+			RtoInitial:         gnb.Sctp.RtoInitial,
+			RtoMin:             gnb.Sctp.RtoMin,
+			RtoMax:             gnb.Sctp.RtoMax,
+			MaxInitRetransmits: gnb.Sctp.MaxInitRetransmits,
+			HeartbeatInterval:  gnb.Sctp.HeartbeatInterval,
+			NumStreams:         gnb.Sctp.NumStreams,
+		}
+	}
+	if gnb.GnbN2Interface != "" {
+		if params == nil {
+			params = &test.SctpParams{}
+		}
+		params.BindToDevice = gnb.GnbN2Interface
+	}
+
+	conn, fd, outStreams, err := test.ConnectToAmfMultihomed(amfIps, gnbIps,
+		amf.AmfPort, localPort, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	amf.NumOutStreams = outStreams
+	return conn, fd, nil
+}
+
 //TODO Should add timeout
 
 // SendToPeer sends an NGAP encoded packet to the specified AMF over the socket
@@ -87,17 +207,27 @@ func (cpTprt *GnbCpTransport) SendToPeerBlock(peer transportcommon.TransportPeer
 
 	amf := peer.(*gnbctx.GnbAmf)
 
-	recvMsg := make([]byte, MAX_SCTP_PKT_LEN)
 	conn := amf.Conn.(*sctp.SCTPConn)
 
-	n, _, _, err := conn.SCTPRead(recvMsg)
+	var buf *[]byte
+	var n int
+	if amf.Dtls != nil {
+		buf, n, err = readDtlsMsg(amf.Dtls)
+	} else {
+		buf, n, err = readSctpMsg(conn)
+	}
 	if err != nil {
 		cpTprt.Log.Errorln("SCTPRead returned :", err)
 		return nil, fmt.Errorf("failed to read from socket")
 	}
 
-	cpTprt.Log.Infof("Read %v bytes from %v\n", n, conn.RemoteAddr())
-	return recvMsg[:n], nil
+	// Response is returned to the caller, hence copied out of the buffer
+	recvMsg := make([]byte, n)
+	copy(recvMsg, (*buf)[:n])
+	releaseSctpBuf(buf)
+
+	cpTprt.Log.Infof("Read %v bytes from %v\n", len(recvMsg), conn.RemoteAddr())
+	return recvMsg, nil
 }
 
 // SendToPeer sends an NGAP encoded packet to the specified AMF over the socket
@@ -120,7 +250,12 @@ func (cpTprt *GnbCpTransport) SendToPeer(peer transportcommon.TransportPeer,
 		}
 	}()
 
-	if n, err := amf.Conn.Write(pkt); err != nil || n != len(pkt) {
+	conn := amf.Conn
+	if amf.Dtls != nil {
+		conn = amf.Dtls
+	}
+	cpTprt.GnbInstance.NgapPacer.Wait()
+	if n, err := conn.Write(pkt); err != nil || n != len(pkt) {
 		cpTprt.Log.Errorln("Write returned:", err)
 		return fmt.Errorf("failed to write on socket")
 	} else {
@@ -130,43 +265,116 @@ func (cpTprt *GnbCpTransport) SendToPeer(peer transportcommon.TransportPeer,
 	return
 }
 
+// SendUeAssociatedToPeer sends a UE associated NGAP encoded packet to the
+// specified AMF, on the stream selected as per the configured policy
+func (cpTprt *GnbCpTransport) SendUeAssociatedToPeer(peer transportcommon.TransportPeer,
+	ueId int64, pkt []byte) (err error) {
+
+	// Recorded before being sent, so that it precedes the response in the
+	// timeline of the UE
+	if gnbue := cpTprt.GnbInstance.GnbUes.GetGnbCpUe(ueId); gnbue != nil {
+		gnbue.RecordSentNgapMessage(pkt)
+	}
+
+	amf := peer.(*gnbctx.GnbAmf)
+	stream := cpTprt.selectStream(amf, ueId)
+	if stream == 0 {
+		return cpTprt.SendToPeer(peer, pkt)
+	}
+
+	err = cpTprt.CheckTransportParam(peer, pkt)
+	if err != nil {
+		return err
+	}
+
+	info := &sctp.SndRcvInfo{
+		Stream: stream,
+		PPID:   test.NgapPPID,
+	}
+	conn := amf.Conn.(*sctp.SCTPConn)
+	cpTprt.GnbInstance.NgapPacer.Wait()
+	if n, err := conn.SCTPWrite(pkt, info); err != nil || n != len(pkt) {
+		cpTprt.Log.Errorln("SCTPWrite returned:", err)
+		return fmt.Errorf("failed to write on socket")
+	} else {
+		cpTprt.Log.Infof("Wrote %v bytes on stream %v\n", n, stream)
+	}
+
+	return
+}
+
+// selectStream returns the stream for a UE associated message. Stream 0 is
+// reserved for the non UE associated signalling, TS 38.412 Section 7. The
+// DTLS records are all sent on stream 0, the DTLS connection being unaware of
+// the streams
+func (cpTprt *GnbCpTransport) selectStream(amf *gnbctx.GnbAmf, ueId int64) uint16 {
+	gnb := cpTprt.GnbInstance
+	if gnb.Sctp == nil || amf.NumOutStreams <= 1 || amf.Dtls != nil {
+		return 0
+	}
+
+	switch gnb.Sctp.StreamSelection {
+	case gnbctx.STREAM_SELECTION_RAN_UE_NGAP_HASH:
+		return 1 + uint16(ueId%int64(amf.NumOutStreams-1))
+	}
+	return 0
+}
+
 // ReceiveFromPeer continuously waits for an incoming message from the AMF
 // It then routes the message to the GnbAmfWorker
 func (cpTprt *GnbCpTransport) ReceiveFromPeer(peer transportcommon.TransportPeer) {
 	amf := peer.(*gnbctx.GnbAmf)
 
+	// Association is replaced when the gNB restarts, only the association
+	// read by this routine is closed
+	conn := amf.Conn.(*sctp.SCTPConn)
+	dtlsConn := amf.Dtls
 	defer func() {
-		if err := amf.Conn.Close(); err != nil && err != syscall.EBADF {
+		if err := conn.Close(); err != nil && err != syscall.EBADF {
 			cpTprt.Log.Errorln("Close returned:", err)
 		}
 
 	}()
 
-	conn := amf.Conn.(*sctp.SCTPConn)
 	for {
-		recvMsg := make([]byte, MAX_SCTP_PKT_LEN)
 		//TODO Handle notification, info
-		n, _, _, err := conn.SCTPRead(recvMsg)
+		var buf *[]byte
+		var n int
+		var err error
+		if dtlsConn != nil {
+			buf, n, err = readDtlsMsg(dtlsConn)
+		} else {
+			buf, n, err = readSctpMsg(conn)
+		}
 		if err != nil {
 			switch err {
 			case io.EOF, io.ErrUnexpectedEOF:
 				cpTprt.Log.Errorln("Read EOF from client")
+				amf.SetN2Down(true)
 				return
 			case syscall.EAGAIN:
 				cpTprt.Log.Warnln("SCTP read timeout")
 				continue
+			case syscall.EBADF:
+				cpTprt.Log.Infoln("SCTP association closed")
+				return
 			case syscall.EINTR:
 				cpTprt.Log.Warnln("SCTPRead: %+v\n", err)
 				continue
 			default:
 				cpTprt.Log.Errorln("Handle connection[addr: %+v] error: %+v\n", amf.Conn.RemoteAddr(), err)
+				amf.SetN2Down(true)
 				return
 			}
 		}
 
 		cpTprt.Log.Infof("Read %v bytes from %v\n", n, amf.GetIpAddr())
 		//TODO Post to gnbamfworker channel
-		gnbamfworker.HandleMessage(cpTprt.GnbInstance, amf, recvMsg[:n])
+		err = gnbamfworker.HandleMessage(cpTprt.GnbInstance, amf, (*buf)[:n])
+		releaseSctpBuf(buf)
+		if err != nil {
+			cpTprt.Log.Errorln("HandleMessage returned:", err)
+		}
 	}
 }
 
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transport
+
+import (
+	"testing"
+
+	"github.com/omec-project/gnbsim/util/ngapTestpacket"
+
+	"github.com/omec-project/ngap"
+)
+
+// recvNgapMsg returns an encoded NGAP message, standing in for a message read
+// from the AMF
+func recvNgapMsg(b *testing.B) []byte {
+	pkt, err := ngap.Encoder(ngapTestpacket.BuildUEContextReleaseRequest(1, 1,
+		[]int64{1}))
+	if err != nil {
+		b.Fatalf("failed to encode ngap message: %v", err)
+	}
+	return pkt
+}
+
+// BenchmarkRecvUnpooled reads each message into a buffer of its own, as done
+// before the receive buffers were pooled
+func BenchmarkRecvUnpooled(b *testing.B) {
+	pkt := recvNgapMsg(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := make([]byte, MAX_SCTP_PKT_LEN)
+		n := copy(buf, pkt)
+		if _, err := ngap.Decoder(buf[:n]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRecvPooledCopy reads each message into a pooled buffer and decodes
+// a copy of the message
+func BenchmarkRecvPooledCopy(b *testing.B) {
+	pkt := recvNgapMsg(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := sctpRecvBufPool.Get().(*[]byte)
+		n := copy(*buf, pkt)
+		recvMsg := make([]byte, n)
+		copy(recvMsg, (*buf)[:n])
+		releaseSctpBuf(buf)
+		if _, err := ngap.Decoder(recvMsg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRecvPooled reads each message into a pooled buffer and decodes the
+// message out of the buffer, as done by ReceiveFromPeer
+func BenchmarkRecvPooled(b *testing.B) {
+	pkt := recvNgapMsg(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := sctpRecvBufPool.Get().(*[]byte)
+		n := copy(*buf, pkt)
+		_, err := ngap.Decoder((*buf)[:n])
+		releaseSctpBuf(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestRecvPooledNoAlias checks that the decoded NGAP message does not refer
+// to the pooled buffer, which is reused once released
+func TestRecvPooledNoAlias(t *testing.T) {
+	nasPdu := []byte{0x7e, 0x00, 0x41}
+	msg := ngapTestpacket.BuildInitialUEMessage(1, nasPdu, "")
+	pkt, err := ngap.Encoder(msg)
+	if err != nil {
+		t.Fatalf("failed to encode ngap message: %v", err)
+	}
+
+	buf := make([]byte, len(pkt))
+	copy(buf, pkt)
+	pdu, err := ngap.Decoder(buf)
+	if err != nil {
+		t.Fatalf("failed to decode ngap message: %v", err)
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+
+	for _, ie := range pdu.InitiatingMessage.Value.InitialUEMessage.ProtocolIEs.List {
+		if ie.Value.NASPDU == nil {
+			continue
+		}
+		if string(ie.Value.NASPDU.Value) != string(nasPdu) {
+			t.Fatalf("decoded nas pdu %x changed with the buffer, expected %x",
+				ie.Value.NASPDU.Value, nasPdu)
+		}
+		return
+	}
+	t.Fatal("nas pdu not found in the decoded message")
+}
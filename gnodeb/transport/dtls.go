@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+
+	"github.com/pion/dtls/v2"
+)
+
+// Time within which the DTLS handshake with the AMF must complete
+const DTLS_HANDSHAKE_TIMEOUT time.Duration = 10 * time.Second
+
+// Largest DTLS record sent to the AMF. SCTP fragments the records, so that
+// these are not bound by the path MTU
+const DTLS_MAX_RECORD_LEN int = 16384
+
+// loadDtlsConfig builds the DTLS configuration of the association with the
+// AMF from the configured certificates
+func loadDtlsConfig(cfg *gnbctx.DtlsConfig, amf *gnbctx.GnbAmf) (*dtls.Config, error) {
+	dtlsCfg := &dtls.Config{
+		ExtendedMasterSecret: dtls.RequestExtendedMasterSecret,
+		MTU:                  DTLS_MAX_RECORD_LEN,
+		ConnectContextMaker: func() (context.Context, func()) {
+			return context.WithTimeout(context.Background(), DTLS_HANDSHAKE_TIMEOUT)
+		},
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %v", err)
+		}
+		dtlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CaFile == "" {
+		dtlsCfg.InsecureSkipVerify = true
+		return dtlsCfg, nil
+	}
+	ca, err := ioutil.ReadFile(cfg.CaFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ca certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid ca certificate: %v", cfg.CaFile)
+	}
+	dtlsCfg.RootCAs = pool
+	dtlsCfg.ServerName = amf.AmfHostName
+	if dtlsCfg.ServerName == "" {
+		dtlsCfg.ServerName = amf.AmfIp
+	}
+	return dtlsCfg, nil
+}
+
+// secureAssociation performs the DTLS handshake with the AMF over the SCTP
+// association, returning the DTLS connection through which the NGAP messages
+// are then sent and received
+func (cpTprt *GnbCpTransport) secureAssociation(amf *gnbctx.GnbAmf) (net.Conn, error) {
+	dtlsCfg, err := loadDtlsConfig(cpTprt.GnbInstance.Dtls, amf)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dtls.Client(amf.Conn, dtlsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("dtls handshake failed: %v", err)
+	}
+	cpTprt.Log.Infoln("DTLS established with AMF, AMF IP:", amf.AmfIp)
+	return conn, nil
+}
+
+// readDtlsMsg reads an NGAP message from the DTLS connection into a pooled
+// buffer, as readSctpMsg does from the SCTP connection
+func readDtlsMsg(conn net.Conn) (*[]byte, int, error) {
+	buf := sctpRecvBufPool.Get().(*[]byte)
+	n, err := conn.Read(*buf)
+	if err != nil {
+		releaseSctpBuf(buf)
+		return nil, 0, err
+	}
+	return buf, n, nil
+}
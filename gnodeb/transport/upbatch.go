@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transport
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+)
+
+// Number of packets which may be queued for the batched write on N3 before
+// the senders are blocked
+const UP_SEND_QUEUE_LEN int = 4096
+
+// upPkt is a GTP-U packet queued for the batched write
+type upPkt struct {
+	pkt  []byte
+	addr *net.UDPAddr
+}
+
+// receiveBatches reads the packets from the UPFs in batches, using a single
+// recvmmsg system call per batch on Linux. The packets of a batch are copied
+// into a single buffer, sized as per the received octets, so that there is
+// one allocation per batch instead of one per packet
+func (upTprt *GnbUpTransport) receiveBatches() {
+	batchSize := upTprt.GnbInstance.N3BatchSize
+	conn := ipv4.NewPacketConn(upTprt.Conn)
+
+	msgs := make([]ipv4.Message, batchSize)
+	for i := range msgs {
+		msgs[i].Buffers = [][]byte{make([]byte, MAX_UDP_PKT_LEN)}
+	}
+
+	for {
+		n, err := conn.ReadBatch(msgs, 0)
+		if err != nil {
+			upTprt.Log.Errorln("ReadBatch returned:", err)
+			continue
+		}
+		upTprt.Log.Traceln("Read", n, "packets")
+
+		total := 0
+		for _, msg := range msgs[:n] {
+			total += msg.N
+		}
+		buf := make([]byte, total)
+		for _, msg := range msgs[:n] {
+			pkt := buf[:msg.N:msg.N]
+			copy(pkt, msg.Buffers[0][:msg.N])
+			buf = buf[msg.N:]
+
+			srcAddr, ok := msg.Addr.(*net.UDPAddr)
+			if !ok {
+				upTprt.Log.Errorln("Unexpected source address:", msg.Addr)
+				continue
+			}
+			upTprt.forwardToUpf(pkt, srcAddr)
+		}
+	}
+}
+
+// sendBatches writes the queued packets to the UPFs in batches, using a
+// single sendmmsg system call per batch on Linux. The packets queued while a
+// batch is being written form the next batch, hence the packets are not
+// delayed when the load is low
+func (upTprt *GnbUpTransport) sendBatches() {
+	batchSize := upTprt.GnbInstance.N3BatchSize
+	conn := ipv4.NewPacketConn(upTprt.Conn)
+
+	msgs := make([]ipv4.Message, batchSize)
+	for i := range msgs {
+		msgs[i].Buffers = make([][]byte, 1)
+	}
+
+	for p := range upTprt.sendQueue {
+		count := 0
+		msgs[count].Buffers[0], msgs[count].Addr = p.pkt, p.addr
+		count++
+	collect:
+		for count < batchSize {
+			select {
+			case p = <-upTprt.sendQueue:
+				msgs[count].Buffers[0], msgs[count].Addr = p.pkt, p.addr
+				count++
+			default:
+				break collect
+			}
+		}
+
+		for sent := 0; sent < count; {
+			n, err := conn.WriteBatch(msgs[sent:count], 0)
+			if err != nil {
+				upTprt.Log.Errorln("WriteBatch returned:", err)
+				break
+			}
+			sent += n
+		}
+		upTprt.Log.Traceln("Sent", count, "packets")
+
+		// Packets are not retained once written
+		for i := 0; i < count; i++ {
+			msgs[i].Buffers[0], msgs[i].Addr = nil, nil
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package transport
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strconv"
@@ -30,6 +31,9 @@ type GnbUpTransport struct {
 	/* UDP Connection without any association with peers */
 	Conn *net.UDPConn
 
+	// Packets queued for the batched write, when batching is enabled
+	sendQueue chan *upPkt
+
 	/* logger */
 	Log *logrus.Entry
 }
@@ -37,7 +41,7 @@ type GnbUpTransport struct {
 func NewGnbUpTransport(gnb *gnbctx.GNodeB) *GnbUpTransport {
 	transport := &GnbUpTransport{}
 	transport.GnbInstance = gnb
-	transport.Log = logger.GNodeBLog.WithFields(logrus.Fields{"subcategory": "UserPlaneTransport"})
+	transport.Log = logger.GnbUpLog.WithFields(logrus.Fields{"subcategory": "UserPlaneTransport"})
 
 	return transport
 }
@@ -51,19 +55,28 @@ func (upTprt *GnbUpTransport) Init() error {
 		return fmt.Errorf("invalid ip or port: %v", ipPort)
 	}
 
-	upTprt.Conn, err = net.ListenUDP("udp", addr)
+	// Bound to the N3 interface when configured
+	lc := net.ListenConfig{Control: gnbctx.BindToDevice(gnb.GnbN3Interface)}
+	conn, err := lc.ListenPacket(context.Background(), "udp", addr.String())
 	if err != nil {
-		upTprt.Log.Errorln("ListenUDP returned:", err)
+		upTprt.Log.Errorln("ListenPacket returned:", err)
 		return fmt.Errorf("failed to create udp socket: %v", ipPort)
 	}
+	upTprt.Conn = conn.(*net.UDPConn)
 
+	if gnb.N3BatchSize > 1 {
+		upTprt.sendQueue = make(chan *upPkt, UP_SEND_QUEUE_LEN)
+		go upTprt.sendBatches()
+	}
 	go upTprt.ReceiveFromPeer(nil)
 
 	upTprt.Log.Infoln("User Plane transport listening on:", ipPort)
 	return nil
 }
 
-// SendToPeer sends a GTP-U encoded packet to the specified UPF over the socket
+// SendToPeer sends a GTP-U encoded packet to the specified UPF over the
+// socket. When batching is enabled the packet is queued for the batched
+// write, hence it must not be modified once handed over
 func (upTprt *GnbUpTransport) SendToPeer(peer transportcommon.TransportPeer,
 	pkt []byte) (err error) {
 
@@ -73,6 +86,10 @@ func (upTprt *GnbUpTransport) SendToPeer(peer transportcommon.TransportPeer,
 	}
 
 	upf := peer.(*gnbctx.GnbUpf)
+	if upTprt.sendQueue != nil {
+		upTprt.sendQueue <- &upPkt{pkt: pkt, addr: upf.UpfAddr}
+		return nil
+	}
 
 	pktLen := len(pkt)
 	n, err := upTprt.Conn.WriteTo(pkt, upf.UpfAddr)
@@ -82,7 +99,7 @@ func (upTprt *GnbUpTransport) SendToPeer(peer transportcommon.TransportPeer,
 	} else if n != pktLen {
 		return fmt.Errorf("total bytes:%v, written bytes:%v", pktLen, n)
 	} else {
-		upTprt.Log.Infof("Sent UDP Packet, length: %v bytes\n", n)
+		upTprt.Log.Tracef("Sent UDP Packet, length: %v bytes\n", n)
 	}
 
 	return
@@ -91,28 +108,44 @@ func (upTprt *GnbUpTransport) SendToPeer(peer transportcommon.TransportPeer,
 // ReceiveFromPeer continuously waits for an incoming message from the UPF
 // It then routes the message to the GnbUpfWorker
 func (upTprt *GnbUpTransport) ReceiveFromPeer(peer transportcommon.TransportPeer) {
+	if upTprt.GnbInstance.N3BatchSize > 1 {
+		upTprt.receiveBatches()
+		return
+	}
+
+	// Packets are read into a single buffer and only the received octets are
+	// handed over to the UPF worker, instead of a maximum sized buffer
+	// per packet
+	recvBuf := make([]byte, MAX_UDP_PKT_LEN)
 	for {
-		recvMsg := make([]byte, MAX_UDP_PKT_LEN)
 		//TODO Handle notification, info
-		n, srcAddr, err := upTprt.Conn.ReadFromUDP(recvMsg)
+		n, srcAddr, err := upTprt.Conn.ReadFromUDP(recvBuf)
 		if err != nil {
 			upTprt.Log.Errorln("ReadFromUDP returned:", err)
-		}
-		srcIp := srcAddr.IP.String()
-		upTprt.Log.Infof("Read %v bytes from %v:%v\n", n, srcIp, srcAddr.Port)
-
-		gnbupf := upTprt.GnbInstance.GnbPeers.GetGnbUpf(srcIp)
-		if gnbupf == nil {
-			upTprt.Log.Errorln("No UPF Context found corresponding to IP:", srcIp)
 			continue
 		}
-		tMsg := &common.TransportMessage{}
-		tMsg.RawPkt = recvMsg[:n]
-		gnbupf.ReadChan <- tMsg
-		upTprt.Log.Traceln("Forwarded UDP packet to UPF Worker")
+		pkt := make([]byte, n)
+		copy(pkt, recvBuf[:n])
+		upTprt.forwardToUpf(pkt, srcAddr)
 	}
 }
 
+// forwardToUpf routes the packet received from the UPF to the GnbUpfWorker
+func (upTprt *GnbUpTransport) forwardToUpf(pkt []byte, srcAddr *net.UDPAddr) {
+	srcIp := srcAddr.IP.String()
+	upTprt.Log.Tracef("Read %v bytes from %v:%v\n", len(pkt), srcIp, srcAddr.Port)
+
+	gnbupf := upTprt.GnbInstance.GnbPeers.GetGnbUpf(srcIp)
+	if gnbupf == nil {
+		upTprt.Log.Errorln("No UPF Context found corresponding to IP:", srcIp)
+		return
+	}
+	tMsg := &common.TransportMessage{}
+	tMsg.RawPkt = pkt
+	gnbupf.ReadChan <- tMsg
+	upTprt.Log.Traceln("Forwarded UDP packet to UPF Worker")
+}
+
 func (upTprt *GnbUpTransport) CheckTransportParam(peer transportcommon.TransportPeer,
 	pkt []byte) error {
 
@@ -137,6 +170,11 @@ func (upTprt *GnbUpTransport) SendToPeerBlock(peer transportcommon.TransportPeer
 	return nil, nil
 }
 
+func (upTprt *GnbUpTransport) SendUeAssociatedToPeer(peer transportcommon.TransportPeer,
+	ueId int64, pkt []byte) error {
+	return upTprt.SendToPeer(peer, pkt)
+}
+
 func (upTprt *GnbUpTransport) ConnectToPeer(peer transportcommon.TransportPeer) error {
 	return nil
 }
@@ -6,12 +6,20 @@
 package gnbamfworker
 
 import (
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"time"
+
 	"github.com/omec-project/gnbsim/common"
 	"github.com/omec-project/gnbsim/util/test"
 
 	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/gnodeb/ngap"
+	"github.com/omec-project/gnbsim/gnodeb/worker/gnbcpueworker"
 
 	amfctx "github.com/omec-project/amf/context"
+	"github.com/omec-project/aper"
 	"github.com/omec-project/ngap/ngapConvert"
 	"github.com/omec-project/ngap/ngapType"
 	"github.com/omec-project/openapi/models"
@@ -232,28 +240,80 @@ func HandleDownlinkNasTransport(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
 	}
 
 	amf.Log.Traceln("Handle Downlink NAS Transport")
+	var amfUeNgapId *ngapType.AMFUENGAPID
 	for i := 0; i < len(downlinkNasTransport.ProtocolIEs.List); i++ {
 		ie := downlinkNasTransport.ProtocolIEs.List[i]
-		if ie.Id.Value == ngapType.ProtocolIEIDRANUENGAPID {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDRANUENGAPID:
 			gnbUeNgapId = ie.Value.RANUENGAPID
 			amf.Log.Traceln("Decode IE RANUENGAPID")
 			if gnbUeNgapId == nil {
 				amf.Log.Errorln("RANUENGAPID is nil")
 				return
 			}
-			break
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			amfUeNgapId = ie.Value.AMFUENGAPID
+			amf.Log.Traceln("Decode IE AMFUENGAPID")
+			if amfUeNgapId == nil {
+				amf.Log.Errorln("AMFUENGAPID is nil")
+				return
+			}
 		}
 	}
-	ngapId := gnbUeNgapId.Value
-	gnbue := gnb.GnbUes.GetGnbCpUe(ngapId)
+
+	gnbue := getGnbCpUeForDownlink(gnb, amf, gnbUeNgapId, amfUeNgapId)
 	if gnbue == nil {
-		amf.Log.Errorln("No GnbUe found corresponding to RANUENGAPID:", ngapId)
 		return
 	}
 
 	SendToGnbUe(gnbue, common.DOWNLINK_NAS_TRANSPORT_EVENT, pdu)
 }
 
+// getGnbCpUeForDownlink returns the UE context to which a downlink message is
+// routed. The UE context is looked up by the RAN UE NGAP ID, and by the AMF UE
+// NGAP ID when the RAN UE NGAP ID is absent or unknown. The AMF UE NGAP ID is
+// recorded against the UE context once resolved
+func getGnbCpUeForDownlink(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	gnbUeNgapId *ngapType.RANUENGAPID,
+	amfUeNgapId *ngapType.AMFUENGAPID) *gnbctx.GnbCpUe {
+
+	var gnbue *gnbctx.GnbCpUe
+	if gnbUeNgapId != nil {
+		gnbue = gnb.GnbUes.GetGnbCpUe(gnbUeNgapId.Value)
+	}
+
+	if amfUeNgapId == nil {
+		if gnbUeNgapId == nil {
+			amf.Log.Errorln("Neither RANUENGAPID nor AMFUENGAPID present")
+		} else if gnbue == nil {
+			amf.Log.Errorln("No GnbUe found corresponding to RANUENGAPID:",
+				gnbUeNgapId.Value)
+		}
+		return gnbue
+	}
+
+	if gnbue == nil {
+		gnbue = gnb.GnbUes.GetGnbCpUeByAmfUeNgapId(amfUeNgapId.Value)
+		if gnbue == nil {
+			amf.Log.Errorln("No GnbUe found corresponding to AMFUENGAPID:",
+				amfUeNgapId.Value)
+			return nil
+		}
+		amf.Log.Warnln("Routed by AMFUENGAPID:", amfUeNgapId.Value,
+			"to GnbUe with RANUENGAPID:", gnbue.GnbUeNgapId)
+		return gnbue
+	}
+
+	prev := gnb.GnbUes.GetGnbCpUeByAmfUeNgapId(amfUeNgapId.Value)
+	if prev != nil && prev != gnbue {
+		amf.Log.Warnln("AMFUENGAPID:", amfUeNgapId.Value,
+			"moved from RANUENGAPID:", prev.GnbUeNgapId, "to RANUENGAPID:",
+			gnbue.GnbUeNgapId)
+	}
+	gnb.GnbUes.SetAmfUeNgapId(amfUeNgapId.Value, gnbue)
+	return gnbue
+}
+
 func HandleInitialContextSetupRequest(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
 	pdu *ngapType.NGAPPDU) {
 
@@ -468,3 +528,514 @@ func HandleUeCtxReleaseCommand(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
 
 	SendToGnbUe(gnbue, common.UE_CTX_RELEASE_COMMAND_EVENT, pdu)
 }
+
+func HandleLocationReportingControl(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	pdu *ngapType.NGAPPDU) {
+
+	amf.Log.Traceln("Processing Location Reporting Control")
+	if pdu == nil {
+		amf.Log.Errorln("NGAP Message is nil")
+		return
+	}
+	if gnb == nil {
+		amf.Log.Errorln("gNodeB context is nil")
+		return
+	}
+
+	initiatingMessage := pdu.InitiatingMessage
+	if initiatingMessage == nil {
+		amf.Log.Errorln("Initiating Message is nil")
+		return
+	}
+
+	locRepCtrl := initiatingMessage.Value.LocationReportingControl
+	if locRepCtrl == nil {
+		amf.Log.Errorln("LocationReportingControl is nil")
+		return
+	}
+
+	var ranUeNgapId *ngapType.RANUENGAPID
+	for _, ie := range locRepCtrl.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDRANUENGAPID {
+			ranUeNgapId = ie.Value.RANUENGAPID
+		}
+	}
+	if ranUeNgapId == nil {
+		amf.Log.Errorln("RANUENGAPID is nil")
+		return
+	}
+
+	gnbue := gnb.GnbUes.GetGnbCpUe(ranUeNgapId.Value)
+	if gnbue == nil {
+		amf.Log.Errorln("No GnbUe found corresponding to RANUENGAPID:",
+			ranUeNgapId.Value)
+		return
+	}
+
+	SendToGnbUe(gnbue, common.LOCATION_REPORTING_CONTROL_EVENT, pdu)
+}
+
+func HandleUeRadioCapabilityCheckRequest(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	pdu *ngapType.NGAPPDU) {
+
+	amf.Log.Traceln("Processing UE Radio Capability Check Request")
+	if pdu == nil {
+		amf.Log.Errorln("NGAP Message is nil")
+		return
+	}
+	if gnb == nil {
+		amf.Log.Errorln("gNodeB context is nil")
+		return
+	}
+
+	initiatingMessage := pdu.InitiatingMessage
+	if initiatingMessage == nil {
+		amf.Log.Errorln("Initiating Message is nil")
+		return
+	}
+
+	capCheckReq := initiatingMessage.Value.UERadioCapabilityCheckRequest
+	if capCheckReq == nil {
+		amf.Log.Errorln("UERadioCapabilityCheckRequest is nil")
+		return
+	}
+
+	var ranUeNgapId *ngapType.RANUENGAPID
+	for _, ie := range capCheckReq.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDRANUENGAPID {
+			ranUeNgapId = ie.Value.RANUENGAPID
+		}
+	}
+	if ranUeNgapId == nil {
+		amf.Log.Errorln("RANUENGAPID is nil")
+		return
+	}
+
+	gnbue := gnb.GnbUes.GetGnbCpUe(ranUeNgapId.Value)
+	if gnbue == nil {
+		amf.Log.Errorln("No GnbUe found corresponding to RANUENGAPID:",
+			ranUeNgapId.Value)
+		return
+	}
+
+	SendToGnbUe(gnbue, common.UE_RADIO_CAPABILITY_CHECK_REQUEST_EVENT, pdu)
+}
+
+func HandleUeCtxModificationRequest(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	pdu *ngapType.NGAPPDU) {
+
+	amf.Log.Traceln("Processing UE Context Modification Request")
+	if pdu == nil {
+		amf.Log.Errorln("NGAP Message is nil")
+		return
+	}
+	if gnb == nil {
+		amf.Log.Errorln("gNodeB context is nil")
+		return
+	}
+
+	initiatingMessage := pdu.InitiatingMessage
+	if initiatingMessage == nil {
+		amf.Log.Errorln("Initiating Message is nil")
+		return
+	}
+
+	ueCtxModReq := initiatingMessage.Value.UEContextModificationRequest
+	if ueCtxModReq == nil {
+		amf.Log.Errorln("UEContextModificationRequest is nil")
+		return
+	}
+
+	var ranUeNgapId *ngapType.RANUENGAPID
+	for _, ie := range ueCtxModReq.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDRANUENGAPID {
+			ranUeNgapId = ie.Value.RANUENGAPID
+		}
+	}
+	if ranUeNgapId == nil {
+		amf.Log.Errorln("RANUENGAPID is nil")
+		return
+	}
+
+	gnbue := gnb.GnbUes.GetGnbCpUe(ranUeNgapId.Value)
+	if gnbue == nil {
+		amf.Log.Errorln("No GnbUe found corresponding to RANUENGAPID:",
+			ranUeNgapId.Value)
+		return
+	}
+
+	SendToGnbUe(gnbue, common.UE_CTX_MODIFICATION_REQUEST_EVENT, pdu)
+}
+
+func HandlePduSessResourceModifyRequest(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	pdu *ngapType.NGAPPDU) {
+
+	amf.Log.Traceln("Processing PDU Session Resource Modify Request")
+	if pdu == nil {
+		amf.Log.Errorln("NGAP Message is nil")
+		return
+	}
+	if gnb == nil {
+		amf.Log.Errorln("gNodeB context is nil")
+		return
+	}
+
+	initiatingMessage := pdu.InitiatingMessage
+	if initiatingMessage == nil {
+		amf.Log.Errorln("Initiating Message is nil")
+		return
+	}
+
+	modifyReq := initiatingMessage.Value.PDUSessionResourceModifyRequest
+	if modifyReq == nil {
+		amf.Log.Errorln("PDUSessionResourceModifyRequest is nil")
+		return
+	}
+
+	var ranUeNgapId *ngapType.RANUENGAPID
+	for _, ie := range modifyReq.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDRANUENGAPID {
+			ranUeNgapId = ie.Value.RANUENGAPID
+		}
+	}
+	if ranUeNgapId == nil {
+		amf.Log.Errorln("RANUENGAPID is nil")
+		return
+	}
+
+	gnbue := gnb.GnbUes.GetGnbCpUe(ranUeNgapId.Value)
+	if gnbue == nil {
+		amf.Log.Errorln("No GnbUe found corresponding to RANUENGAPID:",
+			ranUeNgapId.Value)
+		return
+	}
+
+	SendToGnbUe(gnbue, common.PDU_SESS_RESOURCE_MODIFY_REQUEST_EVENT, pdu)
+}
+
+// HandleWriteReplaceWarningRequest stores the warning message, to be exposed
+// for inspection, and acknowledges the AMF with the cells in which the
+// warning is broadcast
+func HandleWriteReplaceWarningRequest(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	pdu *ngapType.NGAPPDU) {
+
+	amf.Log.Traceln("Processing Write-Replace Warning Request")
+	if pdu == nil || pdu.InitiatingMessage == nil {
+		amf.Log.Errorln("Initiating Message is nil")
+		return
+	}
+	req := pdu.InitiatingMessage.Value.WriteReplaceWarningRequest
+	if req == nil {
+		amf.Log.Errorln("WriteReplaceWarningRequest is nil")
+		return
+	}
+
+	var msgId *ngapType.MessageIdentifier
+	var serialNum *ngapType.SerialNumber
+	var areaList *ngapType.WarningAreaList
+	warning := &gnbctx.Warning{ReceivedAt: time.Now()}
+	for _, ie := range req.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDMessageIdentifier:
+			msgId = ie.Value.MessageIdentifier
+		case ngapType.ProtocolIEIDSerialNumber:
+			serialNum = ie.Value.SerialNumber
+		case ngapType.ProtocolIEIDWarningAreaList:
+			areaList = ie.Value.WarningAreaList
+		case ngapType.ProtocolIEIDRepetitionPeriod:
+			warning.RepetitionPeriod = ie.Value.RepetitionPeriod.Value
+		case ngapType.ProtocolIEIDNumberOfBroadcastsRequested:
+			warning.NumberOfBroadcastsRequested = ie.Value.NumberOfBroadcastsRequested.Value
+		case ngapType.ProtocolIEIDWarningType:
+			warning.WarningType = hex.EncodeToString(ie.Value.WarningType.Value)
+		case ngapType.ProtocolIEIDDataCodingScheme:
+			warning.DataCodingScheme = hex.EncodeToString(ie.Value.DataCodingScheme.Value.Bytes)
+		case ngapType.ProtocolIEIDWarningMessageContents:
+			warning.Contents = hex.EncodeToString(ie.Value.WarningMessageContents.Value)
+		}
+	}
+	if msgId == nil || serialNum == nil {
+		amf.Log.Errorln("Message Identifier or Serial Number not found")
+		return
+	}
+	warning.MessageIdentifier = getPwsIdentifier(msgId.Value.Bytes)
+	warning.SerialNumber = getPwsIdentifier(serialNum.Value.Bytes)
+
+	cells := ngap.GetWarningAreaCells(gnb, areaList)
+	for _, cell := range cells {
+		warning.NrCellIds = append(warning.NrCellIds, cell.NrCellId)
+	}
+
+	if gnb.AddWarning(warning) {
+		amf.Log.Infof("Broadcasting warning, message identifier: %v, serial number: %v, "+
+			"warning type: %v, data coding scheme: %v, contents: %v, cells: %v",
+			warning.MessageIdentifier, warning.SerialNumber, warning.WarningType,
+			warning.DataCodingScheme, warning.Contents, warning.NrCellIds)
+	} else {
+		amf.Log.Infof("Warning already being broadcast, message identifier: %v, serial number: %v",
+			warning.MessageIdentifier, warning.SerialNumber)
+	}
+
+	resp, err := ngap.GetWriteReplaceWarningResponse(gnb, msgId, serialNum, cells)
+	if err != nil {
+		amf.Log.Errorln("GetWriteReplaceWarningResponse failed:", err)
+		return
+	}
+	err = gnb.CpTransport.SendToPeer(amf, resp)
+	if err != nil {
+		amf.Log.Errorln("SendToPeer failed:", err)
+		return
+	}
+	amf.Log.Traceln("Sent Write-Replace Warning Response")
+}
+
+// HandlePwsCancelRequest stops the broadcast of the requested warning message,
+// or of all the warning messages, and reports the cancelled broadcasts
+func HandlePwsCancelRequest(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	pdu *ngapType.NGAPPDU) {
+
+	amf.Log.Traceln("Processing PWS Cancel Request")
+	if pdu == nil || pdu.InitiatingMessage == nil {
+		amf.Log.Errorln("Initiating Message is nil")
+		return
+	}
+	req := pdu.InitiatingMessage.Value.PWSCancelRequest
+	if req == nil {
+		amf.Log.Errorln("PWSCancelRequest is nil")
+		return
+	}
+
+	var msgId *ngapType.MessageIdentifier
+	var serialNum *ngapType.SerialNumber
+	var cancelAll bool
+	for _, ie := range req.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDMessageIdentifier:
+			msgId = ie.Value.MessageIdentifier
+		case ngapType.ProtocolIEIDSerialNumber:
+			serialNum = ie.Value.SerialNumber
+		case ngapType.ProtocolIEIDCancelAllWarningMessages:
+			cancelAll = true
+		}
+	}
+	if msgId == nil || serialNum == nil {
+		amf.Log.Errorln("Message Identifier or Serial Number not found")
+		return
+	}
+
+	var cancelled []*gnbctx.Warning
+	if cancelAll {
+		cancelled = gnb.RemoveAllWarnings()
+	} else {
+		warning := gnb.RemoveWarning(getPwsIdentifier(msgId.Value.Bytes),
+			getPwsIdentifier(serialNum.Value.Bytes))
+		if warning != nil {
+			cancelled = append(cancelled, warning)
+		}
+	}
+	for _, warning := range cancelled {
+		amf.Log.Infof("Cancelled warning, message identifier: %v, serial number: %v",
+			warning.MessageIdentifier, warning.SerialNumber)
+	}
+
+	resp, err := ngap.GetPWSCancelResponse(gnb, msgId, serialNum, cancelled)
+	if err != nil {
+		amf.Log.Errorln("GetPWSCancelResponse failed:", err)
+		return
+	}
+	err = gnb.CpTransport.SendToPeer(amf, resp)
+	if err != nil {
+		amf.Log.Errorln("SendToPeer failed:", err)
+		return
+	}
+	amf.Log.Traceln("Sent PWS Cancel Response")
+}
+
+// getPwsIdentifier converts the 16 bit Message Identifier or Serial Number
+func getPwsIdentifier(b []byte) uint16 {
+	if len(b) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+// HandlePaging notifies the paged UE, if the UE listens for the paging on this
+// gNB. The paging of the other UEs is ignored
+func HandlePaging(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	pdu *ngapType.NGAPPDU) {
+
+	amf.Log.Traceln("Processing Paging")
+	if pdu == nil || pdu.InitiatingMessage == nil {
+		amf.Log.Errorln("Initiating Message is nil")
+		return
+	}
+	paging := pdu.InitiatingMessage.Value.Paging
+	if paging == nil {
+		amf.Log.Errorln("Paging is nil")
+		return
+	}
+
+	var identity *ngapType.UEPagingIdentity
+	for _, ie := range paging.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDUEPagingIdentity {
+			identity = ie.Value.UEPagingIdentity
+		}
+	}
+	if identity == nil || identity.FiveGSTMSI == nil {
+		amf.Log.Errorln("UE Paging Identity not found")
+		return
+	}
+	tmsi, ok := getFiveGSTmsi(identity.FiveGSTMSI)
+	if !ok {
+		amf.Log.Errorln("Invalid 5G-S-TMSI in UE Paging Identity")
+		return
+	}
+
+	ch := gnb.GetPagingUe(tmsi)
+	if ch == nil {
+		amf.Log.Infof("Paged UE not found, 5G-S-TMSI: %+v", tmsi)
+		return
+	}
+	amf.Log.Infof("Paging UE, 5G-S-TMSI: %+v", tmsi)
+	msg := &common.UeMessage{}
+	msg.Event = common.PAGING_EVENT
+	select {
+	case ch <- msg:
+	default:
+		amf.Log.Warnf("Paging not delivered, UE busy, 5G-S-TMSI: %+v", tmsi)
+	}
+}
+
+// getFiveGSTmsi decodes the 5G-S-TMSI, the AMF Set ID and the AMF Pointer
+// being bit strings of 10 and 6 bits
+func getFiveGSTmsi(identity *ngapType.FiveGSTMSI) (tmsi gnbctx.FiveGSTmsi, ok bool) {
+	setId := identity.AMFSetID.Value.Bytes
+	pointer := identity.AMFPointer.Value.Bytes
+	tmsiVal := identity.FiveGTMSI.Value
+	if len(setId) < 2 || len(pointer) < 1 || len(tmsiVal) < 4 {
+		return tmsi, false
+	}
+	tmsi.AmfSetId = uint16(setId[0])<<2 | uint16(setId[1])>>6
+	tmsi.AmfPointer = pointer[0] >> 2
+	tmsi.Tmsi = binary.BigEndian.Uint32(tmsiVal)
+	return tmsi, true
+}
+
+// HandleHandoverRequest correlates the Handover Request with the handover in
+// progress through the RRC container carried in the source to target
+// transparent container, and creates the target gNB UE context for it
+func HandleHandoverRequest(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	pdu *ngapType.NGAPPDU) {
+
+	amf.Log.Traceln("Processing Handover Request")
+	if pdu == nil {
+		amf.Log.Errorln("NGAP Message is nil")
+		return
+	}
+	if gnb == nil {
+		amf.Log.Errorln("gNodeB context is nil")
+		return
+	}
+
+	initiatingMessage := pdu.InitiatingMessage
+	if initiatingMessage == nil {
+		amf.Log.Errorln("Initiating Message is nil")
+		return
+	}
+
+	hoReq := initiatingMessage.Value.HandoverRequest
+	if hoReq == nil {
+		amf.Log.Errorln("HandoverRequest is nil")
+		return
+	}
+
+	var amfUeNgapId *ngapType.AMFUENGAPID
+	var s2tContainer *ngapType.SourceToTargetTransparentContainer
+	for _, ie := range hoReq.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			amfUeNgapId = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDSourceToTargetTransparentContainer:
+			s2tContainer = ie.Value.SourceToTargetTransparentContainer
+		}
+	}
+	if amfUeNgapId == nil || s2tContainer == nil {
+		amf.Log.Errorln("Mandatory IEs missing in Handover Request")
+		return
+	}
+
+	var ho *gnbctx.Handover
+	container := ngapType.SourceNGRANNodeToTargetNGRANNodeTransparentContainer{}
+	err := aper.UnmarshalWithParams(s2tContainer.Value, &container, "valueExt")
+	if err != nil {
+		amf.Log.Errorln("Failed to decode source to target transparent container:", err)
+	} else {
+		hoId, err := gnbctx.GetHandoverId(container.RRCContainer.Value)
+		if err != nil {
+			amf.Log.Errorln("GetHandoverId failed:", err)
+		} else {
+			ho = gnbctx.GetHandover(hoId)
+		}
+	}
+
+	var target *gnbctx.GnbCpUe
+	if ho == nil || ho.TargetGnb != gnb {
+		amf.Log.Errorln("No handover in progress towards gNB:", gnb.GnbName)
+	} else {
+		target, err = gnbcpueworker.InitHandoverTarget(ho, amf)
+		if err != nil {
+			amf.Log.Errorln("InitHandoverTarget failed:", err)
+		}
+	}
+
+	if target == nil {
+		cause, _ := test.GetNgapCause("unknown-target-id")
+		sendMsg, err := ngap.GetHandoverFailure(amfUeNgapId.Value, cause)
+		if err != nil {
+			amf.Log.Errorln("GetHandoverFailure failed:", err)
+			return
+		}
+		err = gnb.CpTransport.SendToPeer(amf, sendMsg)
+		if err != nil {
+			amf.Log.Errorln("SendToPeer failed:", err)
+			return
+		}
+		amf.Log.Traceln("Sent Handover Failure to AMF")
+		return
+	}
+
+	SendToGnbUe(target, common.HANDOVER_REQUEST_EVENT, pdu)
+}
+
+// HandleUeAssociatedMessage routes a UE associated message to the gNB UE
+// context, based on the RAN UE NGAP ID. It is used for the outcome of the
+// procedures initiated by the gNB UE context, and for the requests which need
+// no processing by the gNB
+func HandleUeAssociatedMessage(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf,
+	pdu *ngapType.NGAPPDU, event common.EventType) {
+
+	amf.Log.Traceln("Processing", event)
+	if pdu == nil {
+		amf.Log.Errorln("NGAP Message is nil")
+		return
+	}
+	if gnb == nil {
+		amf.Log.Errorln("gNodeB context is nil")
+		return
+	}
+
+	ranUeNgapId := findRanUeNgapId(reflect.ValueOf(pdu))
+	if ranUeNgapId == nil {
+		amf.Log.Errorln("RANUENGAPID is nil")
+		return
+	}
+
+	gnbue := gnb.GnbUes.GetGnbCpUe(ranUeNgapId.Value)
+	if gnbue == nil {
+		amf.Log.Errorln("No GnbUe found corresponding to RANUENGAPID:",
+			ranUeNgapId.Value)
+		return
+	}
+
+	SendToGnbUe(gnbue, event, pdu)
+}
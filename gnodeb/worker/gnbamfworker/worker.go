@@ -5,22 +5,50 @@
 package gnbamfworker
 
 import (
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"time"
 
 	"github.com/omec-project/gnbsim/common"
 	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/logger"
 
 	"github.com/omec-project/ngap"
 	"github.com/omec-project/ngap/ngapType"
+	"github.com/sirupsen/logrus"
 )
 
 /* HandleMessage decodes an incoming NGAP message and routes it to the
- * corresponding handlers
+ * corresponding handlers. Messages which fail to decode or crash the handlers
+ * are quarantined, so that they don't bring down the gNB. The packet is held
+ * in a pooled buffer, it is not to be retained once the function returns
  */
-func HandleMessage(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf, pkt []byte) error {
+func HandleMessage(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf, pkt []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			reason := fmt.Sprintf("panic: %v", r)
+			count := gnb.QuarantineMsg(&gnbctx.QuarantinedMsg{
+				Reason: reason,
+				Pdu:    pkt,
+			})
+			gnb.Log.Errorf("Quarantined NGAP message (%v so far), %v\n%s", count,
+				reason, debug.Stack())
+			err = fmt.Errorf("NGAP message handling panicked: %v", r)
+		}
+	}()
+
 	// decoding the incoming packet
 	pdu, err := ngap.Decoder(pkt)
 	if err != nil {
+		ReportDecodeError(gnb, amf, pkt, pdu, err)
+		gnb.QuarantineMsg(&gnbctx.QuarantinedMsg{
+			Reason: fmt.Sprintf("decode error: %v", err),
+			Pdu:    pkt,
+		})
 		return fmt.Errorf("NGAP decode error : %+v", err)
 	}
 
@@ -42,6 +70,28 @@ func HandleMessage(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf, pkt []byte) error {
 			HandlePduSessResourceReleaseCommand(gnb, amf, pdu)
 		case ngapType.ProcedureCodeUEContextRelease:
 			HandleUeCtxReleaseCommand(gnb, amf, pdu)
+		case ngapType.ProcedureCodeLocationReportingControl:
+			HandleLocationReportingControl(gnb, amf, pdu)
+		case ngapType.ProcedureCodeUERadioCapabilityCheck:
+			HandleUeRadioCapabilityCheckRequest(gnb, amf, pdu)
+		case ngapType.ProcedureCodeWriteReplaceWarning:
+			HandleWriteReplaceWarningRequest(gnb, amf, pdu)
+		case ngapType.ProcedureCodePWSCancel:
+			HandlePwsCancelRequest(gnb, amf, pdu)
+		case ngapType.ProcedureCodeHandoverResourceAllocation:
+			HandleHandoverRequest(gnb, amf, pdu)
+		case ngapType.ProcedureCodeUEContextModification:
+			HandleUeCtxModificationRequest(gnb, amf, pdu)
+		case ngapType.ProcedureCodePDUSessionResourceModify:
+			HandlePduSessResourceModifyRequest(gnb, amf, pdu)
+		case ngapType.ProcedureCodePaging:
+			HandlePaging(gnb, amf, pdu)
+		case ngapType.ProcedureCodeTraceStart:
+			HandleUeAssociatedMessage(gnb, amf, pdu, common.TRACE_START_EVENT)
+		case ngapType.ProcedureCodeDeactivateTrace:
+			HandleUeAssociatedMessage(gnb, amf, pdu, common.DEACTIVATE_TRACE_EVENT)
+		case ngapType.ProcedureCodeRerouteNASRequest:
+			HandleUeAssociatedMessage(gnb, amf, pdu, common.REROUTE_NAS_REQUEST_EVENT)
 		}
 	case ngapType.NGAPPDUPresentSuccessfulOutcome:
 		successfulOutcome := pdu.SuccessfulOutcome
@@ -51,6 +101,15 @@ func HandleMessage(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf, pkt []byte) error {
 		switch successfulOutcome.ProcedureCode.Value {
 		case ngapType.ProcedureCodeNGSetup:
 			HandleNgSetupResponse(amf, pdu)
+		case ngapType.ProcedureCodeHandoverPreparation:
+			HandleUeAssociatedMessage(gnb, amf, pdu, common.HANDOVER_COMMAND_EVENT)
+		case ngapType.ProcedureCodePathSwitchRequest:
+			HandleUeAssociatedMessage(gnb, amf, pdu, common.PATH_SWITCH_REQUEST_ACK_EVENT)
+		case ngapType.ProcedureCodeHandoverCancel:
+			HandleUeAssociatedMessage(gnb, amf, pdu, common.HANDOVER_CANCEL_ACK_EVENT)
+		case ngapType.ProcedureCodePDUSessionResourceModifyIndication:
+			HandleUeAssociatedMessage(gnb, amf, pdu,
+				common.PDU_SESS_RESOURCE_MODIFY_CONFIRM_EVENT)
 		}
 	case ngapType.NGAPPDUPresentUnsuccessfulOutcome:
 		unsuccessfulOutcome := pdu.UnsuccessfulOutcome
@@ -60,6 +119,12 @@ func HandleMessage(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf, pkt []byte) error {
 		switch unsuccessfulOutcome.ProcedureCode.Value {
 		case ngapType.ProcedureCodeNGSetup:
 			HandleNgSetupFailure(amf, pdu)
+		case ngapType.ProcedureCodeHandoverPreparation:
+			HandleUeAssociatedMessage(gnb, amf, pdu,
+				common.HANDOVER_PREPARATION_FAILURE_EVENT)
+		case ngapType.ProcedureCodePathSwitchRequest:
+			HandleUeAssociatedMessage(gnb, amf, pdu,
+				common.PATH_SWITCH_REQUEST_FAILURE_EVENT)
 		}
 	}
 
@@ -70,5 +135,72 @@ func SendToGnbUe(gnbue *gnbctx.GnbCpUe, event common.EventType, ngapPdu *ngapTyp
 	amfmsg := common.N2Message{}
 	amfmsg.Event = event
 	amfmsg.NgapPdu = ngapPdu
+	gnbue.RecordReceivedNgapMessage(ngapPdu)
 	gnbue.ReadChan <- &amfmsg
 }
+
+// ReportDecodeError logs the NGAP PDU which failed to decode along with its
+// hex dump and the originating AMF. The PDU is correlated to the UE using the
+// RAN UE NGAP ID, if it was decoded before the failure. The raw bytes are also
+// written to a file when a dump directory is configured for the gNB
+func ReportDecodeError(gnb *gnbctx.GNodeB, amf *gnbctx.GnbAmf, pkt []byte,
+	pdu *ngapType.NGAPPDU, decodeErr error) {
+
+	log := gnb.Log.WithFields(logrus.Fields{
+		logger.FieldIp: amf.GetIpAddr(),
+		"amfname":      amf.AmfName,
+		"length":       len(pkt),
+	})
+
+	if pdu != nil {
+		if ranUeNgapId := findRanUeNgapId(reflect.ValueOf(pdu)); ranUeNgapId != nil {
+			log = log.WithField(logger.FieldGnbUeNgapId, ranUeNgapId.Value)
+			gnbue := gnb.GnbUes.GetGnbCpUe(ranUeNgapId.Value)
+			if gnbue != nil {
+				log = log.WithField(logger.FieldSupi, gnbue.Supi)
+			}
+		}
+	}
+
+	if gnb.NgapDumpDir != "" {
+		fileName := fmt.Sprintf("ngap-%v-%v-%v.bin", gnb.GnbName, amf.GetIpAddr(),
+			time.Now().Format("20060102T150405.000000000"))
+		filePath := filepath.Join(gnb.NgapDumpDir, fileName)
+		err := ioutil.WriteFile(filePath, pkt, 0644)
+		if err != nil {
+			log.Errorln("Failed to write NGAP PDU to file:", err)
+		} else {
+			log = log.WithField("file", filePath)
+		}
+	}
+
+	log.Errorf("NGAP decode error: %v, hex dump:\n%v", decodeErr, hex.Dump(pkt))
+}
+
+// findRanUeNgapId walks through a partially decoded NGAP PDU and returns the
+// first RAN UE NGAP ID found, or nil if none was decoded
+func findRanUeNgapId(v reflect.Value) *ngapType.RANUENGAPID {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || !v.CanInterface() {
+			return nil
+		}
+		if id, ok := v.Interface().(*ngapType.RANUENGAPID); ok {
+			return id
+		}
+		return findRanUeNgapId(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if id := findRanUeNgapId(v.Field(i)); id != nil {
+				return id
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if id := findRanUeNgapId(v.Index(i)); id != nil {
+				return id
+			}
+		}
+	}
+	return nil
+}
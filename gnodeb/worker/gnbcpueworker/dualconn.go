@@ -0,0 +1,255 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gnbcpueworker
+
+import (
+	"sort"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/gnodeb/ngap"
+	"github.com/omec-project/gnbsim/util/ngapTestpacket"
+
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// requestAdditionalTunnels allocates the downlink tunnels of the secondary
+// node for the PDU sessions established, and requests the AMF to add them
+// through PDU Session Resource Modify Indication
+func requestAdditionalTunnels(gnbue *gnbctx.GnbCpUe,
+	pduSessions []*ngapTestpacket.PduSession) {
+
+	dc := gnbue.Gnb.DualConnectivity
+	if dc == nil || !dc.AdditionalTunnel {
+		return
+	}
+
+	var upUes []*gnbctx.GnbUpUe
+	for _, pduSess := range pduSessions {
+		if !pduSess.Success {
+			continue
+		}
+		gnbUpUe, err := gnbue.GetGnbUpUe(pduSess.PduSessId)
+		if err != nil {
+			gnbue.Log.Errorln("Failed to fetch PDU session context:", err)
+			continue
+		}
+		dlteid, err := gnbue.Gnb.DlTeidGenerator.Allocate()
+		if err != nil {
+			gnbue.Log.Errorln("ID Generator Allocate() returned:", err)
+			continue
+		}
+		gnbUpUe.SecondaryDlTeid = uint32(dlteid)
+		gnbUpUe.Upf.GnbUpUes.AddGnbUpUe(gnbUpUe.SecondaryDlTeid, true, gnbUpUe)
+		upUes = append(upUes, gnbUpUe)
+		gnbue.Log.Infoln("Secondary node DL GTP-TEID:", dlteid,
+			"PDU Session ID:", gnbUpUe.PduSessId)
+	}
+	if len(upUes) == 0 {
+		return
+	}
+
+	sendMsg, err := ngap.GetPduSessionResourceModifyIndication(gnbue, upUes)
+	if err == nil {
+		err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+			gnbue.GnbUeNgapId, sendMsg)
+	}
+	if err != nil {
+		gnbue.Log.Errorln("Failed to send PDU Session Resource Modify Indication:", err)
+		for _, gnbUpUe := range upUes {
+			releaseSecondaryTunnel(gnbUpUe)
+		}
+		return
+	}
+	gnbue.Log.Traceln("Sent PDU Session Resource Modify Indication to AMF")
+}
+
+// HandlePduSessResourceModifyConfirm releases the additional downlink tunnels
+// of the PDU sessions which the network failed to modify
+func HandlePduSessResourceModifyConfirm(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	msg := intfcMsg.(*common.N2Message)
+	modifyCfm := msg.NgapPdu.SuccessfulOutcome.Value.PDUSessionResourceModifyConfirm
+	if modifyCfm == nil {
+		gnbue.Log.Errorln("PDUSessionResourceModifyConfirm is nil")
+		return
+	}
+
+	for _, ie := range modifyCfm.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDPDUSessionResourceModifyListModCfm:
+			if ie.Value.PDUSessionResourceModifyListModCfm == nil {
+				continue
+			}
+			for _, item := range ie.Value.PDUSessionResourceModifyListModCfm.List {
+				gnbue.Log.Infoln("Secondary node tunnel added, PDU Session ID:",
+					item.PDUSessionID.Value)
+			}
+		case ngapType.ProtocolIEIDPDUSessionResourceFailedToModifyListModCfm:
+			if ie.Value.PDUSessionResourceFailedToModifyListModCfm == nil {
+				continue
+			}
+			for _, item := range ie.Value.PDUSessionResourceFailedToModifyListModCfm.List {
+				pduSessId := item.PDUSessionID.Value
+				gnbue.Log.Warnln("Secondary node tunnel not added, PDU Session ID:",
+					pduSessId)
+				gnbUpUe, err := gnbue.GetGnbUpUe(pduSessId)
+				if err != nil {
+					gnbue.Log.Errorln("Failed to fetch PDU session context:", err)
+					continue
+				}
+				releaseSecondaryTunnel(gnbUpUe)
+			}
+		}
+	}
+}
+
+// releaseSecondaryTunnel releases the additional downlink tunnel of the PDU
+// session, if any
+func releaseSecondaryTunnel(gnbUpUe *gnbctx.GnbUpUe) {
+	if gnbUpUe.SecondaryDlTeid == 0 {
+		return
+	}
+	gnbUpUe.Upf.GnbUpUes.RemoveGnbUpUe(gnbUpUe.SecondaryDlTeid, true)
+	gnbUpUe.Gnb.DlTeidGenerator.FreeID(int64(gnbUpUe.SecondaryDlTeid))
+	gnbUpUe.SecondaryDlTeid = 0
+}
+
+// startUsageReports starts reporting the secondary RAT data usage of the UE
+// periodically, if configured for the gNB and not already started
+func startUsageReports(gnbue *gnbctx.GnbCpUe) {
+	dc := gnbue.Gnb.DualConnectivity
+	if dc == nil || dc.UsageReportInterval == 0 || gnbue.UsageReportQuit != nil {
+		return
+	}
+	gnbue.UsageReportQuit = make(chan struct{})
+	armUsageReport(gnbue)
+}
+
+// armUsageReport raises SECONDARY_RAT_USAGE_REPORT_EVENT once the report
+// interval expires, unless the reports are stopped meanwhile
+func armUsageReport(gnbue *gnbctx.GnbCpUe) {
+	interval := time.Duration(gnbue.Gnb.DualConnectivity.UsageReportInterval) *
+		time.Second
+	quit, ch := gnbue.UsageReportQuit, gnbue.ReadChan
+	gnbue.UsageReportTimer = time.AfterFunc(interval, func() {
+		msg := &common.DefaultMessage{}
+		msg.Event = common.SECONDARY_RAT_USAGE_REPORT_EVENT
+		select {
+		case <-quit:
+		case ch <- msg:
+		}
+	})
+}
+
+// stopUsageReports stops the periodic secondary RAT data usage reports of the
+// UE, if started
+func stopUsageReports(gnbue *gnbctx.GnbCpUe) {
+	if gnbue.UsageReportQuit != nil {
+		gnbue.UsageReportTimer.Stop()
+		close(gnbue.UsageReportQuit)
+		gnbue.UsageReportQuit = nil
+		gnbue.UsageReportTimer = nil
+	}
+}
+
+// HandleSecondaryRatUsageReport reports the usage of the secondary node by the
+// PDU sessions of the UE since the previous report
+func HandleSecondaryRatUsageReport(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	if gnbue.UsageReportQuit == nil {
+		// Stopped after the report was raised
+		return
+	}
+	armUsageReport(gnbue)
+	if !isServingUe(gnbue) {
+		return
+	}
+
+	var upUes []*gnbctx.GnbUpUe
+	f := func(k interface{}, v interface{}) bool {
+		upUes = append(upUes, v.(*gnbctx.GnbUpUe))
+		return true
+	}
+	gnbue.GnbUpUes.Range(f)
+	sendSecondaryRatUsageReport(gnbue, upUes)
+}
+
+// reportReleasedUsage reports the usage of the secondary node by the PDU
+// sessions being released since the previous report, if configured
+func reportReleasedUsage(gnbue *gnbctx.GnbCpUe, upUes []*gnbctx.GnbUpUe) {
+	dc := gnbue.Gnb.DualConnectivity
+	if dc == nil || !dc.ReportOnRelease || !isServingUe(gnbue) {
+		return
+	}
+	sendSecondaryRatUsageReport(gnbue, upUes)
+}
+
+// sendSecondaryRatUsageReport sends the Secondary RAT Data Usage Report with
+// the usage of the PDU sessions since the previous report. The share of the
+// volume measured is reported for a PDU session, unless a volume is
+// configured. The QoS flows of the PDU session with a volume configured are
+// reported individually
+func sendSecondaryRatUsageReport(gnbue *gnbctx.GnbCpUe, upUes []*gnbctx.GnbUpUe) {
+	dc := gnbue.Gnb.DualConnectivity
+	share := uint64(dc.GetSecondaryShare())
+	var usages []ngap.SecondaryRatUsage
+	for _, gnbUpUe := range upUes {
+		if gnbUpUe.Usage == nil {
+			continue
+		}
+		period := gnbUpUe.Usage.Take()
+		if dc.SessionVolume != nil {
+			period.UlOctets = dc.SessionVolume.Ul
+			period.DlOctets = dc.SessionVolume.Dl
+		} else {
+			period.UlOctets = period.UlOctets * share / 100
+			period.DlOctets = period.DlOctets * share / 100
+		}
+		usage := ngap.SecondaryRatUsage{
+			PduSessId: gnbUpUe.PduSessId,
+			Period:    period,
+		}
+		for qfi := range gnbUpUe.QosFlows {
+			volume, ok := dc.QosFlowVolumes[qfi]
+			if !ok {
+				continue
+			}
+			qosFlowPeriod := period
+			qosFlowPeriod.UlOctets = volume.Ul
+			qosFlowPeriod.DlOctets = volume.Dl
+			usage.QosFlows = append(usage.QosFlows, ngap.QosFlowUsage{
+				Qfi:    qfi,
+				Period: qosFlowPeriod,
+			})
+		}
+		sort.Slice(usage.QosFlows, func(i, j int) bool {
+			return usage.QosFlows[i].Qfi < usage.QosFlows[j].Qfi
+		})
+		usages = append(usages, usage)
+	}
+	if len(usages) == 0 {
+		return
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].PduSessId < usages[j].PduSessId
+	})
+
+	sendMsg, err := ngap.GetSecondaryRatDataUsageReport(gnbue, usages)
+	if err != nil {
+		gnbue.Log.Errorln("GetSecondaryRatDataUsageReport failed:", err)
+		return
+	}
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
+	if err != nil {
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		return
+	}
+	gnbue.Log.Traceln("Sent Secondary RAT Data Usage Report to AMF")
+}
@@ -13,7 +13,6 @@ import (
 	"github.com/omec-project/gnbsim/common"
 	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
 	"github.com/omec-project/gnbsim/gnodeb/ngap"
-	"github.com/omec-project/gnbsim/gnodeb/worker/gnbupfworker"
 	"github.com/omec-project/gnbsim/gnodeb/worker/gnbupueworker"
 	"github.com/omec-project/gnbsim/util/ngapTestpacket"
 	"github.com/omec-project/gnbsim/util/test"
@@ -36,20 +35,22 @@ func HandleConnectRequest(gnbue *gnbctx.GnbCpUe,
 	msg := intfcMsg.(*common.UuMessage)
 	gnbue.Supi = msg.Supi
 	gnbue.WriteUeChan = msg.CommChan
+	gnbue.Timeline = msg.Timeline
 }
 
 func HandleInitialUEMessage(gnbue *gnbctx.GnbCpUe,
 	intfcMsg common.InterfaceMessage) {
 
 	msg := intfcMsg.(*common.UuMessage)
-	sendMsg, err := test.GetInitialUEMessage(gnbue.GnbUeNgapId, msg.NasPdus[0], "")
+	sendMsg, err := ngap.GetInitialUEMessage(gnbue, msg.NasPdus[0])
 	if err != nil {
 		gnbue.Log.Errorln("GetInitialUEMessage failed:", err)
 		return
 	}
-	err = gnbue.Gnb.CpTransport.SendToPeer(gnbue.Amf, sendMsg)
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
 	if err != nil {
-		gnbue.Log.Errorln("SendToPeer failed:", err)
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
 		return
 	}
 
@@ -90,6 +91,7 @@ func HandleDownlinkNasTransport(gnbue *gnbctx.GnbCpUe,
 
 	//TODO: check what needs to be done with AmfUeNgapId on every DownlinkNasTransport message
 	gnbue.AmfUeNgapId = amfUeNgapId.Value
+	gnbue.Activity.Touch()
 	var pdus common.NasPduList
 	pdus = append(pdus, nasPdu.Value)
 	SendToUe(gnbue, common.DL_INFO_TRANSFER_EVENT, pdus)
@@ -99,15 +101,17 @@ func HandleUlInfoTransfer(gnbue *gnbctx.GnbCpUe,
 	intfcMsg common.InterfaceMessage) {
 
 	msg := intfcMsg.(*common.UuMessage)
+	gnbue.Activity.Touch()
 	gnbue.Log.Traceln("Creating Uplink NAS Transport Message")
-	sendMsg, err := test.GetUplinkNASTransport(gnbue.AmfUeNgapId, gnbue.GnbUeNgapId, msg.NasPdus[0])
+	sendMsg, err := ngap.GetUplinkNASTransport(gnbue, msg.NasPdus[0])
 	if err != nil {
 		gnbue.Log.Errorln("GetUplinkNASTransport failed:", err)
 		return
 	}
-	err = gnbue.Gnb.CpTransport.SendToPeer(gnbue.Amf, sendMsg)
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
 	if err != nil {
-		gnbue.Log.Errorln("SendToPeer failed:", err)
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
 		return
 	}
 
@@ -121,6 +125,8 @@ func HandleInitialContextSetupRequest(gnbue *gnbctx.GnbCpUe,
 	var amfUeNgapId *ngapType.AMFUENGAPID
 	var nasPdu *ngapType.NASPDU
 	var pduSessResourceSetupReqList *ngapType.PDUSessionResourceSetupListCxtReq
+	var ueRadioCapability *ngapType.UERadioCapability
+	var traceActivation *ngapType.TraceActivation
 
 	pdu := msg.NgapPdu
 
@@ -147,9 +153,52 @@ func HandleInitialContextSetupRequest(gnbue *gnbctx.GnbCpUe,
 				gnbue.Log.Errorln("PDUSessionResourceSetupListCxtReq is empty")
 				return
 			}
+		case ngapType.ProtocolIEIDUERadioCapability:
+			ueRadioCapability = ie.Value.UERadioCapability
+		case ngapType.ProtocolIEIDUESecurityCapabilities:
+			gnbue.UeSecurityCapabilities = ie.Value.UESecurityCapabilities
+		case ngapType.ProtocolIEIDSecurityKey:
+			if ie.Value.SecurityKey != nil {
+				gnbue.SecurityKey = ie.Value.SecurityKey.Value.Bytes
+			}
+		case ngapType.ProtocolIEIDUEAggregateMaximumBitRate:
+			if ambr := ie.Value.UEAggregateMaximumBitRate; ambr != nil {
+				gnbue.UeAmbrUl = ambr.UEAggregateMaximumBitRateUL.Value
+				gnbue.UeAmbrDl = ambr.UEAggregateMaximumBitRateDL.Value
+			}
+		case ngapType.ProtocolIEIDTraceActivation:
+			traceActivation = ie.Value.TraceActivation
+		case ngapType.ProtocolIEIDRRCInactiveTransitionReportRequest:
+			setRrcStateReportRequest(gnbue, ie.Value.RRCInactiveTransitionReportRequest)
 		}
 	}
 
+	if amfUeNgapId != nil {
+		gnbue.AmfUeNgapId = amfUeNgapId.Value
+	}
+
+	if traceActivation != nil {
+		startTrace(gnbue, traceActivation)
+	}
+
+	if ueRadioCapability != nil && len(ueRadioCapability.Value) != 0 {
+		gnbue.Log.Infoln("UE Radio Capability received from AMF, length:",
+			len(ueRadioCapability.Value))
+		gnbue.UeRadioCapability = ueRadioCapability.Value
+		gnbue.UeRadioCapabilityKnownToAmf = true
+	}
+
+	if gnbue.IcsFailureCause != nil {
+		var pduSessIds []int64
+		if pduSessResourceSetupReqList != nil {
+			for _, v := range pduSessResourceSetupReqList.List {
+				pduSessIds = append(pduSessIds, v.PDUSessionID.Value)
+			}
+		}
+		sendInitialContextSetupFailure(gnbue, pduSessIds)
+		return
+	}
+
 	if nasPdu.Value != nil {
 		var pdus common.NasPduList
 		pdus = append(pdus, nasPdu.Value)
@@ -183,11 +232,14 @@ func HandleInitialContextSetupRequest(gnbue *gnbctx.GnbCpUe,
 		return
 	}
 
-	err = gnbue.Gnb.CpTransport.SendToPeer(gnbue.Amf, resp)
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, resp)
 	if err != nil {
-		gnbue.Log.Errorln("SendToPeer failed:", err)
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
 		return
 	}
+
+	sendUeRadioCapabilityInfoIndication(gnbue)
 }
 
 // TODO: Error handling
@@ -271,6 +323,7 @@ func HandlePduSessResourceReleaseCommand(gnbue *gnbctx.GnbCpUe,
 		}
 	}
 
+	var released []*gnbctx.GnbUpUe
 	for _, item := range pduSessResourceToReleaseList.List {
 		resourceReleaseCmdTransfer := ngapType.PDUSessionResourceReleaseCommandTransfer{}
 		err := aper.UnmarshalWithParams(item.PDUSessionResourceReleaseCommandTransfer,
@@ -293,7 +346,9 @@ func HandlePduSessResourceReleaseCommand(gnbue *gnbctx.GnbCpUe,
 		}
 		terminateUpUeContext(upCtx)
 		gnbue.RemoveGnbUpUe(pduSessId)
+		released = append(released, upCtx)
 	}
+	reportReleasedUsage(gnbue, released)
 
 	if nasPdu.Value != nil {
 		var pdus common.NasPduList
@@ -309,9 +364,10 @@ func HandlePduSessResourceReleaseCommand(gnbue *gnbctx.GnbCpUe,
 		return
 	}
 
-	err = gnbue.Gnb.CpTransport.SendToPeer(gnbue.Amf, ngapPdu)
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, ngapPdu)
 	if err != nil {
-		gnbue.Log.Errorln("SendToPeer failed:", err)
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
 		return
 	}
 	gnbue.Log.Traceln("Sent PDU Session Resource Setup Response Message to AMF")
@@ -319,6 +375,197 @@ func HandlePduSessResourceReleaseCommand(gnbue *gnbctx.GnbCpUe,
 	SendToUe(gnbue, common.DATA_BEARER_RELEASE_REQUEST_EVENT, nil)
 }
 
+// HandlePduSessResourceModifyRequest applies the modifications requested by
+// the network to the user plane contexts of the PDU sessions, forwards the NAS
+// PDUs of the modified PDU sessions to the UE and responds with the modified
+// and the failed PDU sessions
+func HandlePduSessResourceModifyRequest(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	msg := intfcMsg.(*common.N2Message)
+	modifyReq := msg.NgapPdu.InitiatingMessage.Value.PDUSessionResourceModifyRequest
+
+	var modifyReqList *ngapType.PDUSessionResourceModifyListModReq
+	for _, ie := range modifyReq.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDPDUSessionResourceModifyListModReq {
+			modifyReqList = ie.Value.PDUSessionResourceModifyListModReq
+		}
+	}
+	if modifyReqList == nil || len(modifyReqList.List) == 0 {
+		gnbue.Log.Errorln("PDUSessionResourceModifyListModReq is empty")
+		return
+	}
+
+	var modifiedList []ngapType.PDUSessionResourceModifyItemModRes
+	var failedList []ngapType.PDUSessionResourceFailedToModifyItemModRes
+	var pdus common.NasPduList
+	for _, item := range modifyReqList.List {
+		transfer, err := modifyGnbUpUe(gnbue, item)
+		if err != nil {
+			gnbue.Log.Errorln("Failed to modify PDU Session ID:",
+				item.PDUSessionID.Value, "error:", err)
+			failed := ngapType.PDUSessionResourceFailedToModifyItemModRes{}
+			failed.PDUSessionID = item.PDUSessionID
+			failed.PDUSessionResourceModifyUnsuccessfulTransfer =
+				ngapTestpacket.GetPDUSessionResourceModifyUnsuccessfulTransfer()
+			failedList = append(failedList, failed)
+			continue
+		}
+
+		modified := ngapType.PDUSessionResourceModifyItemModRes{}
+		modified.PDUSessionID = item.PDUSessionID
+		modified.PDUSessionResourceModifyResponseTransfer = transfer
+		modifiedList = append(modifiedList, modified)
+		if item.NASPDU != nil && item.NASPDU.Value != nil {
+			pdus = append(pdus, item.NASPDU.Value)
+		}
+	}
+
+	if len(pdus) != 0 {
+		SendToUe(gnbue, common.DL_INFO_TRANSFER_EVENT, pdus)
+		gnbue.Log.Traceln("Sent DL Information Transfer Event to UE")
+	}
+
+	sendMsg, err := ngap.GetPDUSessionResourceModifyResponse(gnbue,
+		modifiedList, failedList)
+	if err != nil {
+		gnbue.Log.Errorln("GetPDUSessionResourceModifyResponse failed:", err)
+		return
+	}
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
+	if err != nil {
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		return
+	}
+	gnbue.Log.Traceln("Sent PDU Session Resource Modify Response to AMF")
+
+	if len(modifiedList) != 0 {
+		SendToUe(gnbue, common.DATA_BEARER_MODIFY_EVENT, nil)
+	}
+}
+
+// modifyGnbUpUe updates the user plane context of the PDU session as per the
+// PDU Session Resource Modify Request Transfer. It returns the encoded PDU
+// Session Resource Modify Response Transfer
+func modifyGnbUpUe(gnbue *gnbctx.GnbCpUe,
+	item ngapType.PDUSessionResourceModifyItemModReq) ([]byte, error) {
+
+	gnbupue, err := gnbue.GetGnbUpUe(item.PDUSessionID.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	modifyReqTransfer := ngapType.PDUSessionResourceModifyRequestTransfer{}
+	err = aper.UnmarshalWithParams(item.PDUSessionResourceModifyRequestTransfer,
+		&modifyReqTransfer, "valueExt")
+	if err != nil {
+		return nil, fmt.Errorf("UnmarshalWithParams returned: %v", err)
+	}
+
+	rspTransfer := ngapType.PDUSessionResourceModifyResponseTransfer{}
+	for _, ie := range modifyReqTransfer.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDPDUSessionAggregateMaximumBitRate:
+			if ambr := ie.Value.PDUSessionAggregateMaximumBitRate; ambr != nil {
+				gnbue.Log.Infoln("PDU Session AMBR modified, UL:",
+					ambr.PDUSessionAggregateMaximumBitRateUL.Value, "DL:",
+					ambr.PDUSessionAggregateMaximumBitRateDL.Value)
+			}
+		case ngapType.ProtocolIEIDULNGUUPTNLModifyList:
+			modifyList := ie.Value.ULNGUUPTNLModifyList
+			if modifyList == nil || len(modifyList.List) == 0 {
+				continue
+			}
+			ulTnlInfo := modifyList.List[0].ULNGUUPTNLInformation
+			gtpTunnel := ulTnlInfo.GTPTunnel
+			if gtpTunnel == nil {
+				return nil, fmt.Errorf("GTPTunnel is nil")
+			}
+			updateUlTunnel(gnbue, gnbupue, gtpTunnel)
+			rspTransfer.ULNGUUPTNLInformation = &ulTnlInfo
+		case ngapType.ProtocolIEIDQosFlowAddOrModifyRequestList:
+			if ie.Value.QosFlowAddOrModifyRequestList == nil {
+				continue
+			}
+			for _, qosFlowItem := range ie.Value.QosFlowAddOrModifyRequestList.List {
+				addOrModifyQosFlow(gnbue, gnbupue, qosFlowItem, &rspTransfer)
+			}
+		case ngapType.ProtocolIEIDQosFlowToReleaseList:
+			if ie.Value.QosFlowToReleaseList == nil {
+				continue
+			}
+			for _, qosFlowItem := range ie.Value.QosFlowToReleaseList.List {
+				qfi := qosFlowItem.QosFlowIdentifier.Value
+				gnbue.Log.Infoln("QoS Flow released, Id:", qfi)
+				delete(gnbupue.QosFlows, qfi)
+			}
+		}
+	}
+
+	return aper.MarshalWithParams(rspTransfer, "valueExt")
+}
+
+// updateUlTunnel directs the user plane context of the PDU session to send
+// the uplink packets to the modified UPF tunnel endpoint
+func updateUlTunnel(gnbue *gnbctx.GnbCpUe, gnbupue *gnbctx.GnbUpUe,
+	gtpTunnel *ngapType.GTPTunnel) {
+
+	upfIp := getUpfIp(gnbue, gtpTunnel.TransportLayerAddress)
+	msg := &gnbctx.UlTunnelUpdate{}
+	msg.Event = common.UL_TUNNEL_UPDATE_EVENT
+	msg.UlTeid = binary.BigEndian.Uint32(gtpTunnel.GTPTEID.Value)
+	msg.Upf = getGnbUpf(gnbue, upfIp)
+	gnbue.Log.Infoln("UL GTP-TEID modified:", msg.UlTeid, "UPF Endpoint IP:", upfIp)
+	gnbupue.ReadCmdChan <- msg
+}
+
+// addOrModifyQosFlow adds the QoS flow, or updates the QoS parameters of the
+// existing QoS flow, and records the outcome in the response transfer
+func addOrModifyQosFlow(gnbue *gnbctx.GnbCpUe, gnbupue *gnbctx.GnbUpUe,
+	item ngapType.QosFlowAddOrModifyRequestItem,
+	rspTransfer *ngapType.PDUSessionResourceModifyResponseTransfer) {
+
+	qfi := item.QosFlowIdentifier.Value
+	qosFlow, found := gnbupue.QosFlows[qfi]
+	if !found && item.QosFlowLevelQosParameters == nil {
+		// New QoS flow cannot be added without the QoS parameters
+		gnbue.Log.Errorln("QoS parameters missing for new QoS Flow Id:", qfi)
+		if rspTransfer.QosFlowFailedToAddOrModifyList == nil {
+			rspTransfer.QosFlowFailedToAddOrModifyList =
+				new(ngapType.QosFlowListWithCause)
+		}
+		failed := ngapType.QosFlowWithCauseItem{}
+		failed.QosFlowIdentifier = item.QosFlowIdentifier
+		failed.Cause.Present = ngapType.CausePresentProtocol
+		failed.Cause.Protocol = &ngapType.CauseProtocol{
+			Value: ngapType.CauseProtocolPresentSemanticError,
+		}
+		rspTransfer.QosFlowFailedToAddOrModifyList.List = append(
+			rspTransfer.QosFlowFailedToAddOrModifyList.List, failed)
+		return
+	}
+
+	if !found {
+		qosFlow = &ngapType.QosFlowSetupRequestItem{}
+		qosFlow.QosFlowIdentifier = item.QosFlowIdentifier
+		gnbupue.AddQosFlow(qfi, qosFlow)
+	}
+	if item.QosFlowLevelQosParameters != nil {
+		qosFlow.QosFlowLevelQosParameters = *item.QosFlowLevelQosParameters
+	}
+	gnbue.Log.Infoln("QoS Flow added or modified, Id:", qfi)
+
+	if rspTransfer.QosFlowAddOrModifyResponseList == nil {
+		rspTransfer.QosFlowAddOrModifyResponseList =
+			new(ngapType.QosFlowAddOrModifyResponseList)
+	}
+	rspItem := ngapType.QosFlowAddOrModifyResponseItem{}
+	rspItem.QosFlowIdentifier = item.QosFlowIdentifier
+	rspTransfer.QosFlowAddOrModifyResponseList.List = append(
+		rspTransfer.QosFlowAddOrModifyResponseList.List, rspItem)
+}
+
 func HandleDataBearerSetupResponse(gnbue *gnbctx.GnbCpUe,
 	intfcMsg common.InterfaceMessage) {
 
@@ -338,6 +585,10 @@ func HandleDataBearerSetupResponse(gnbue *gnbctx.GnbCpUe,
 			// Thus will help avoid lock unlock operation on per downlink message
 			gnbUpUe.Upf.GnbUpUes.AddGnbUpUe(gnbUpUe.DlTeid, true, gnbUpUe)
 			gnbUpUe.WriteUeChan = item.CommChan
+			gnbUpUe.Activity = gnbue.Activity
+			if dc := gnbue.Gnb.DualConnectivity; dc != nil && dc.IsUsageReported() {
+				gnbUpUe.Usage = gnbctx.NewUsageCounter()
+			}
 			gnbue.WaitGrp.Add(1)
 			go func() {
 				defer gnbue.WaitGrp.Done()
@@ -346,6 +597,15 @@ func HandleDataBearerSetupResponse(gnbue *gnbctx.GnbCpUe,
 		}
 		pduSessions = append(pduSessions, pduSess)
 	}
+	if len(msg.DBParams) != 0 {
+		startInactivityTimer(gnbue)
+		startUsageReports(gnbue)
+	}
+
+	if msg.TriggeringEvent == common.TRIGGER_HANDOVER_EVENT {
+		completeHandover(gnbue)
+		return
+	}
 
 	var ngapPdu []byte
 	var err error
@@ -366,12 +626,18 @@ func HandleDataBearerSetupResponse(gnbue *gnbctx.GnbCpUe,
 		}
 	}
 
-	err = gnbue.Gnb.CpTransport.SendToPeer(gnbue.Amf, ngapPdu)
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, ngapPdu)
 	if err != nil {
-		gnbue.Log.Errorln("SendToPeer failed:", err)
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
 		return
 	}
 	gnbue.Log.Traceln("Sent PDU Session Resource Setup Response Message to AMF")
+
+	if msg.TriggeringEvent == common.INITIAL_CTX_SETUP_REQUEST_EVENT {
+		sendUeRadioCapabilityInfoIndication(gnbue)
+	}
+	requestAdditionalTunnels(gnbue, pduSessions)
 }
 
 func HandleUeCtxReleaseCommand(gnbue *gnbctx.GnbCpUe,
@@ -382,6 +648,9 @@ func HandleUeCtxReleaseCommand(gnbue *gnbctx.GnbCpUe,
 	var amfUeNgapId ngapType.AMFUENGAPID
 	var cause *ngapType.Cause
 
+	stopInactivityTimer(gnbue)
+	stopUsageReports(gnbue)
+
 	pdu := msg.NgapPdu
 
 	initiatingMessage := pdu.InitiatingMessage
@@ -414,22 +683,25 @@ func HandleUeCtxReleaseCommand(gnbue *gnbctx.GnbCpUe,
 	}
 
 	var pduSessIds []int64
+	var upUes []*gnbctx.GnbUpUe
 	f := func(k interface{}, v interface{}) bool {
 		pduSessIds = append(pduSessIds, k.(int64))
+		upUes = append(upUes, v.(*gnbctx.GnbUpUe))
 		return true
 	}
 	gnbue.GnbUpUes.Range(f)
+	reportReleasedUsage(gnbue, upUes)
 
-	ngapPdu, err := test.GetUEContextReleaseComplete(gnbue.AmfUeNgapId,
-		gnbue.GnbUeNgapId, pduSessIds)
+	ngapPdu, err := ngap.GetUEContextReleaseComplete(gnbue, pduSessIds)
 	if err != nil {
 		fmt.Println("Failed to create UE Context Release Complete message")
 		return
 	}
 
-	err = gnbue.Gnb.CpTransport.SendToPeer(gnbue.Amf, ngapPdu)
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, ngapPdu)
 	if err != nil {
-		gnbue.Log.Errorln("SendToPeer failed:", err)
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
 		return
 	}
 	gnbue.Log.Traceln("Sent UE Context Release Complete Message to AMF")
@@ -438,10 +710,19 @@ func HandleUeCtxReleaseCommand(gnbue *gnbctx.GnbCpUe,
 	quitEvt.Event = common.QUIT_EVENT
 	gnbue.ReadChan <- quitEvt
 
+	// Source gNB UE context is released once the UE is handed over, which
+	// doesn't release the connection of the UE
+	if !isServingUe(gnbue) {
+		gnbue.Log.Infoln("UE context released after handover")
+		return
+	}
+
 	req := &common.UuMessage{}
 	req.Event = common.CONNECTION_RELEASE_REQUEST_EVENT
 	if causeNum == ngapType.CauseNasPresentDeregister {
 		req.TriggeringEvent = common.DEREG_REQUEST_UE_ORIG_EVENT
+	} else if gnbue.InactivityReleaseRequested {
+		req.TriggeringEvent = common.INACTIVITY_TIMER_EXPIRY_EVENT
 	} else {
 		req.TriggeringEvent = common.TRIGGER_AN_RELEASE_EVENT
 	}
@@ -452,26 +733,129 @@ func HandleUeCtxReleaseCommand(gnbue *gnbctx.GnbCpUe,
 func HandleRanConnectionRelease(gnbue *gnbctx.GnbCpUe,
 	intfcMsg common.InterfaceMessage) {
 
-	// Todo: The cause for the RAN connection release should be sent by the
-	// Sim-UE, which should receive it through configuration
+	msg := intfcMsg.(*common.UeMessage)
 	gnbue.Log.Traceln("Handling RAN Connection Release Event")
 
 	gnbue.Log.Traceln("Creating UE Context Release Request")
 
-	sendMsg, err := ngap.GetUEContextReleaseRequest(gnbue)
+	sendMsg, err := ngap.GetUEContextReleaseRequest(gnbue, msg.NgapCause)
 	if err != nil {
 		gnbue.Log.Errorln("GetUplinkNASTransport failed:", err)
 		return
 	}
-	err = gnbue.Gnb.CpTransport.SendToPeer(gnbue.Amf, sendMsg)
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
 	if err != nil {
-		gnbue.Log.Errorln("SendToPeer failed:", err)
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
 		return
 	}
 
 	gnbue.Log.Traceln("Sent Uplink NAS Transport Message to AMF")
 }
 
+func HandleTriggerInitialCtxSetupFailure(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	msg := intfcMsg.(*common.UeMessage)
+	gnbue.IcsFailureCause = msg.NgapCause
+	if gnbue.IcsFailureCause == nil {
+		gnbue.IcsFailureCause, _ = test.GetNgapCause("radio-resources-not-available")
+	}
+	gnbue.Log.Traceln("Initial Context Setup Request will be failed")
+}
+
+func sendInitialContextSetupFailure(gnbue *gnbctx.GnbCpUe, pduSessIds []int64) {
+	gnbue.Log.Traceln("Creating Initial Context Setup Failure")
+
+	sendMsg, err := ngap.GetInitialContextSetupFailure(gnbue, pduSessIds,
+		gnbue.IcsFailureCause)
+	gnbue.IcsFailureCause = nil
+	if err != nil {
+		gnbue.Log.Errorln("GetInitialContextSetupFailure failed:", err)
+		return
+	}
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
+	if err != nil {
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		return
+	}
+
+	gnbue.Log.Traceln("Sent Initial Context Setup Failure Message to AMF")
+}
+
+func HandleRrcStateTransition(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	inactive := intfcMsg.GetEventType() == common.TRIGGER_RRC_INACTIVE_TRANSITION_EVENT
+	if gnbue.RrcInactive == inactive {
+		gnbue.Log.Warnln("UE is already in the requested RRC state, inactive:",
+			inactive)
+	}
+
+	rrcState := ngapType.RRCStatePresentConnected
+	if inactive {
+		rrcState = ngapType.RRCStatePresentInactive
+	}
+
+	// RRC state transition is reported only as requested by the AMF, a
+	// single RRC connected state report being sent once the UE is connected
+	// again, TS 38.413 Section 8.3.5
+	report := false
+	if req := gnbue.RrcStateReportRequest; req != nil {
+		switch req.Value {
+		case ngapType.RRCInactiveTransitionReportRequestPresentSubsequentStateTransitionReport:
+			report = true
+		case ngapType.RRCInactiveTransitionReportRequestPresentSingleRrcConnectedStateReport:
+			report = !inactive
+		}
+	}
+
+	if report {
+		gnbue.Log.Traceln("Creating RRC Inactive Transition Report")
+		sendMsg, err := ngap.GetRRCInactiveTransitionReport(gnbue, rrcState)
+		if err != nil {
+			gnbue.Log.Errorln("GetRRCInactiveTransitionReport failed:", err)
+			return
+		}
+		err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+			gnbue.GnbUeNgapId, sendMsg)
+		if err != nil {
+			gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+			return
+		}
+		gnbue.Log.Traceln("Sent RRC Inactive Transition Report Message to AMF")
+
+		if gnbue.RrcStateReportRequest.Value ==
+			ngapType.RRCInactiveTransitionReportRequestPresentSingleRrcConnectedStateReport {
+			gnbue.RrcStateReportRequest = nil
+		}
+	} else {
+		gnbue.Log.Traceln("RRC Inactive Transition Report not requested by AMF")
+	}
+
+	gnbue.RrcInactive = inactive
+	SendToUe(gnbue, common.RRC_INACTIVE_TRANSITION_REPORT_EVENT, nil)
+}
+
+// setRrcStateReportRequest records the RRC Inactive Transition Report Request
+// received from the AMF, a cancel report stopping the reporting
+func setRrcStateReportRequest(gnbue *gnbctx.GnbCpUe,
+	req *ngapType.RRCInactiveTransitionReportRequest) {
+
+	if req == nil {
+		return
+	}
+	if req.Value == ngapType.RRCInactiveTransitionReportRequestPresentCancelReport {
+		gnbue.Log.Traceln("RRC Inactive Transition Report cancelled by AMF")
+		gnbue.RrcStateReportRequest = nil
+		return
+	}
+	gnbue.Log.Traceln("RRC Inactive Transition Report requested by AMF, mode:",
+		req.Value)
+	gnbue.RrcStateReportRequest = req
+}
+
 func ProcessPduSessResourceSetupList(gnbue *gnbctx.GnbCpUe,
 	lst []pduSessResourceSetupItem, event common.EventType) {
 	//var pduSessions []ngapTestpacket.PduSession
@@ -480,103 +864,16 @@ func ProcessPduSessResourceSetupList(gnbue *gnbctx.GnbCpUe,
 	var nasPdus common.NasPduList
 
 	for _, item := range lst {
-
-		resourceSetupRequestTransfer := ngapType.PDUSessionResourceSetupRequestTransfer{}
-		err := aper.UnmarshalWithParams(item.PDUSessionResourceSetupRequestTransfer,
-			&resourceSetupRequestTransfer, "valueExt")
+		gnbupue, pduSess, err := setupGnbUpUe(gnbue, item)
 		if err != nil {
-			gnbue.Log.Errorln("UnmarshalWithParams returned:", err)
+			gnbue.Log.Errorln("setupGnbUpUe failed:", err)
 			return
 		}
 
-		var gtpTunnel *ngapType.GTPTunnel
-		var pduSessType *ngapType.PDUSessionType
-		var qosFlowSetupReqList *ngapType.QosFlowSetupRequestList
-		for _, ie := range resourceSetupRequestTransfer.ProtocolIEs.List {
-			switch ie.Id.Value {
-			case ngapType.ProtocolIEIDULNGUUPTNLInformation:
-				gtpTunnel = ie.Value.ULNGUUPTNLInformation.GTPTunnel
-				if gtpTunnel == nil {
-					gnbue.Log.Errorln("GTPTunnel is nil")
-					return
-				}
-			case ngapType.ProtocolIEIDPDUSessionType:
-				pduSessType = ie.Value.PDUSessionType
-				if pduSessType == nil {
-					gnbue.Log.Errorln("PDUSessionType is nil")
-					return
-				}
-			case ngapType.ProtocolIEIDQosFlowSetupRequestList:
-				qosFlowSetupReqList = ie.Value.QosFlowSetupRequestList
-				if qosFlowSetupReqList == nil || len(qosFlowSetupReqList.List) == 0 {
-					gnbue.Log.Errorln("QosFlowSetupRequestList is empty")
-					return
-				}
-			}
-		}
-
-		ulteid := binary.BigEndian.Uint32(gtpTunnel.GTPTEID.Value)
-		dlteid, err := gnbue.Gnb.DlTeidGenerator.Allocate()
-		if err != nil {
-			gnbue.Log.Errorln("ID Generator Allocate() returned:", err)
-			return
-		}
-		upfIp, _ := ngapConvert.IPAddressToString(gtpTunnel.TransportLayerAddress)
-
-		gnbupue := gnbctx.NewGnbUpUe(uint32(dlteid), ulteid, gnbue.Gnb)
-		gnbupue.Snssai = ngapConvert.SNssaiToModels(item.SNSSAI)
-		gnbupue.PduSessId = item.PDUSessionID.Value
-		gnbupue.PduSessType = test.PDUSessionTypeToModels(*pduSessType)
-		pduSess := &ngapTestpacket.PduSession{}
-		pduSess.PduSessId = gnbupue.PduSessId
-		pduSess.Teid = gnbupue.DlTeid
-
-		gnbue.Log.Infoln("PDU Session ID:", gnbupue.PduSessId)
-		gnbue.Log.Infoln("S-NSSAI - SST: ", gnbupue.Snssai.Sst)
-		gnbue.Log.Infoln("S-NSSAI - SD: ", gnbupue.Snssai.Sd)
-		gnbue.Log.Infoln("UL GTP-TEID: ", ulteid)
-		gnbue.Log.Infoln("DL GTP-TEID: ", dlteid)
-		gnbue.Log.Infoln("UPF Endpoint IP: ", upfIp)
-		gnbue.Log.Infoln("PDU Session Type: ", gnbupue.PduSessType)
-
-		var qosFlowId int64
-		var qosChar ngapType.QosCharacteristics
-		var arp ngapType.AllocationAndRetentionPriority
-		var nonDynamic5QI *ngapType.NonDynamic5QIDescriptor
-		for _, qosFlowSetupReqItem := range qosFlowSetupReqList.List {
-			qosFlowId = qosFlowSetupReqItem.QosFlowIdentifier.Value
-			qosChar = qosFlowSetupReqItem.QosFlowLevelQosParameters.QosCharacteristics
-			arp = qosFlowSetupReqItem.QosFlowLevelQosParameters.AllocationAndRetentionPriority
-
-			gnbue.Log.Infoln("QoS Flow Id:", qosFlowId)
-			if qosChar.Present == ngapType.QosCharacteristicsPresentNonDynamic5QI {
-				nonDynamic5QI = qosChar.NonDynamic5QI
-				if nonDynamic5QI == nil {
-					gnbue.Log.Errorln("NonDynamic5QI is nil")
-					return
-				}
-				gnbue.Log.Infoln("Non Dynamic 5QI:", nonDynamic5QI.FiveQI.Value)
-			}
-			gnbue.Log.Infoln("ARP Priority Level:", arp.PriorityLevelARP.Value)
-			gnbue.Log.Infoln("Pre-emption Capability:", arp.PreEmptionCapability.Value)
-			gnbue.Log.Infoln("Pre-emption Vulnerability:", arp.PreEmptionVulnerability.Value)
-
-			pduSess.SuccessQfiList = append(pduSess.SuccessQfiList, qosFlowId)
-			gnbupue.AddQosFlow(qosFlowId, &qosFlowSetupReqItem)
-		}
-
-		pduSess.Success = true
 		if item.NASPDU != nil {
 			nasPdus = append(nasPdus, item.NASPDU.Value)
 		}
 
-		gnbupf, created := gnbue.Gnb.GnbPeers.GetOrAddGnbUpf(upfIp)
-		if created {
-			go gnbupfworker.Init(gnbupf)
-		}
-		gnbupue.Upf = gnbupf
-		gnbue.AddGnbUpUe(gnbupue.PduSessId, gnbupue)
-
 		//pduSessions = append(pduSessions, pduSess)
 		dbParam := &common.DataBearerParams{}
 		dbParam.CommChan = gnbupue.ReadUlChan
@@ -589,19 +886,444 @@ func ProcessPduSessResourceSetupList(gnbue *gnbctx.GnbCpUe,
 		gnbue.Log.Traceln("Sent DL Information Transfer Event to UE")
 	}
 
-	/* TODO: To be fixed, currently Data Bearer Setup Event may get processed
-	 * before the pdu sessions are established on the UE side
-	 */
-	time.Sleep(500 * time.Millisecond)
 	uemsg := common.UuMessage{}
 	uemsg.Event = common.DATA_BEARER_SETUP_REQUEST_EVENT
 	uemsg.DBParams = dbParamSet
 	uemsg.TriggeringEvent = event
+
+	/* TODO: To be fixed, currently Data Bearer Setup Event may get processed
+	 * before the pdu sessions are established on the UE side
+	 */
+	if gnbue.Lightweight {
+		// Routine is shared with other UEs, the event is delayed without
+		// blocking it
+		ch := gnbue.WriteUeChan
+		time.AfterFunc(500*time.Millisecond, func() {
+			ch <- &uemsg
+		})
+		return
+	}
+	time.Sleep(500 * time.Millisecond)
 	gnbue.WriteUeChan <- &uemsg
 }
 
+// setupGnbUpUe creates the user plane context of the PDU session as per the
+// PDU Session Resource Setup Request Transfer
+func setupGnbUpUe(gnbue *gnbctx.GnbCpUe, item pduSessResourceSetupItem) (
+	*gnbctx.GnbUpUe, *ngapTestpacket.PduSession, error) {
+
+	resourceSetupRequestTransfer := ngapType.PDUSessionResourceSetupRequestTransfer{}
+	err := aper.UnmarshalWithParams(item.PDUSessionResourceSetupRequestTransfer,
+		&resourceSetupRequestTransfer, "valueExt")
+	if err != nil {
+		return nil, nil, fmt.Errorf("UnmarshalWithParams returned: %v", err)
+	}
+
+	var gtpTunnel *ngapType.GTPTunnel
+	var pduSessType *ngapType.PDUSessionType
+	var qosFlowSetupReqList *ngapType.QosFlowSetupRequestList
+	for _, ie := range resourceSetupRequestTransfer.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDULNGUUPTNLInformation:
+			gtpTunnel = ie.Value.ULNGUUPTNLInformation.GTPTunnel
+			if gtpTunnel == nil {
+				return nil, nil, fmt.Errorf("GTPTunnel is nil")
+			}
+		case ngapType.ProtocolIEIDPDUSessionType:
+			pduSessType = ie.Value.PDUSessionType
+			if pduSessType == nil {
+				return nil, nil, fmt.Errorf("PDUSessionType is nil")
+			}
+		case ngapType.ProtocolIEIDQosFlowSetupRequestList:
+			qosFlowSetupReqList = ie.Value.QosFlowSetupRequestList
+			if qosFlowSetupReqList == nil || len(qosFlowSetupReqList.List) == 0 {
+				return nil, nil, fmt.Errorf("QosFlowSetupRequestList is empty")
+			}
+		}
+	}
+	if gtpTunnel == nil || pduSessType == nil || qosFlowSetupReqList == nil {
+		return nil, nil, fmt.Errorf("mandatory IEs missing")
+	}
+
+	ulteid := binary.BigEndian.Uint32(gtpTunnel.GTPTEID.Value)
+	dlteid, err := gnbue.Gnb.DlTeidGenerator.Allocate()
+	if err != nil {
+		return nil, nil, fmt.Errorf("ID Generator Allocate() returned: %v", err)
+	}
+	upfIp := getUpfIp(gnbue, gtpTunnel.TransportLayerAddress)
+
+	gnbupue := gnbctx.NewGnbUpUe(uint32(dlteid), ulteid, gnbue.Gnb)
+	gnbupue.Snssai = ngapConvert.SNssaiToModels(item.SNSSAI)
+	gnbupue.PduSessId = item.PDUSessionID.Value
+	gnbupue.PduSessType = test.PDUSessionTypeToModels(*pduSessType)
+	pduSess := &ngapTestpacket.PduSession{}
+	pduSess.PduSessId = gnbupue.PduSessId
+	pduSess.Teid = gnbupue.DlTeid
+
+	gnbue.Log.Infoln("PDU Session ID:", gnbupue.PduSessId)
+	gnbue.Log.Infoln("S-NSSAI - SST: ", gnbupue.Snssai.Sst)
+	gnbue.Log.Infoln("S-NSSAI - SD: ", gnbupue.Snssai.Sd)
+	gnbue.Log.Infoln("UL GTP-TEID: ", ulteid)
+	gnbue.Log.Infoln("DL GTP-TEID: ", dlteid)
+	gnbue.Log.Infoln("UPF Endpoint IP: ", upfIp)
+	gnbue.Log.Infoln("PDU Session Type: ", gnbupue.PduSessType)
+
+	var qosFlowId int64
+	var qosChar ngapType.QosCharacteristics
+	var arp ngapType.AllocationAndRetentionPriority
+	var nonDynamic5QI *ngapType.NonDynamic5QIDescriptor
+	for _, qosFlowSetupReqItem := range qosFlowSetupReqList.List {
+		qosFlowId = qosFlowSetupReqItem.QosFlowIdentifier.Value
+		qosChar = qosFlowSetupReqItem.QosFlowLevelQosParameters.QosCharacteristics
+		arp = qosFlowSetupReqItem.QosFlowLevelQosParameters.AllocationAndRetentionPriority
+
+		gnbue.Log.Infoln("QoS Flow Id:", qosFlowId)
+		if qosChar.Present == ngapType.QosCharacteristicsPresentNonDynamic5QI {
+			nonDynamic5QI = qosChar.NonDynamic5QI
+			if nonDynamic5QI == nil {
+				gnbue.Gnb.DlTeidGenerator.FreeID(dlteid)
+				return nil, nil, fmt.Errorf("NonDynamic5QI is nil")
+			}
+			gnbue.Log.Infoln("Non Dynamic 5QI:", nonDynamic5QI.FiveQI.Value)
+		}
+		gnbue.Log.Infoln("ARP Priority Level:", arp.PriorityLevelARP.Value)
+		gnbue.Log.Infoln("Pre-emption Capability:", arp.PreEmptionCapability.Value)
+		gnbue.Log.Infoln("Pre-emption Vulnerability:", arp.PreEmptionVulnerability.Value)
+
+		pduSess.SuccessQfiList = append(pduSess.SuccessQfiList, qosFlowId)
+		qosFlow := qosFlowSetupReqItem
+		gnbupue.AddQosFlow(qosFlowId, &qosFlow)
+	}
+
+	pduSess.Success = true
+
+	gnbupue.Upf = getGnbUpf(gnbue, upfIp)
+	gnbue.AddGnbUpUe(gnbupue.PduSessId, gnbupue)
+	return gnbupue, pduSess, nil
+}
+
+func HandleLocationReportingControl(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	msg := intfcMsg.(*common.N2Message)
+	locRepCtrl := msg.NgapPdu.InitiatingMessage.Value.LocationReportingControl
+
+	var reqType *ngapType.LocationReportingRequestType
+	for _, ie := range locRepCtrl.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDLocationReportingRequestType {
+			reqType = ie.Value.LocationReportingRequestType
+		}
+	}
+	if reqType == nil {
+		gnbue.Log.Errorln("Location Reporting Request Type not found")
+		return
+	}
+
+	gnbue.Log.Infoln("Location reporting requested, event type:",
+		reqType.EventType.Value)
+
+	switch reqType.EventType.Value {
+	case ngapType.EventTypePresentDirect:
+		sendLocationReport(gnbue, reqType)
+	case ngapType.EventTypePresentChangeOfServeCell:
+		gnbue.LocationReportingRequest = reqType
+		sendLocationReport(gnbue, reqType)
+		startCellChanges(gnbue)
+	case ngapType.EventTypePresentStopChangeOfServeCell,
+		ngapType.EventTypePresentCancelLocationReportingForTheUe:
+		gnbue.LocationReportingRequest = nil
+		stopCellChanges(gnbue)
+	case ngapType.EventTypePresentStopUePresenceInAreaOfInterest:
+		// Reporting on the area of interest is never activated
+	default:
+		gnbue.Log.Warnln("Unsupported location reporting event type:",
+			reqType.EventType.Value)
+		cause := &ngapType.Cause{
+			Present: ngapType.CausePresentMisc,
+			Misc: &ngapType.CauseMisc{
+				Value: ngapType.CauseMiscPresentUnspecified,
+			},
+		}
+		sendMsg, err := ngap.GetLocationReportingFailureIndication(gnbue, cause)
+		if err != nil {
+			gnbue.Log.Errorln("GetLocationReportingFailureIndication failed:", err)
+			return
+		}
+		err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+			gnbue.GnbUeNgapId, sendMsg)
+		if err != nil {
+			gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+			return
+		}
+		gnbue.Log.Traceln("Sent Location Reporting Failure Indication to AMF")
+	}
+}
+
+// sendUeRadioCapabilityInfoIndication reports the configured UE Radio
+// Capability to the AMF, unless the AMF already provided it
+func sendUeRadioCapabilityInfoIndication(gnbue *gnbctx.GnbCpUe) {
+	if len(gnbue.UeRadioCapability) == 0 || gnbue.UeRadioCapabilityKnownToAmf {
+		return
+	}
+
+	sendMsg, err := ngap.GetUERadioCapabilityInfoIndication(gnbue)
+	if err != nil {
+		gnbue.Log.Errorln("GetUERadioCapabilityInfoIndication failed:", err)
+		return
+	}
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
+	if err != nil {
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		return
+	}
+	gnbue.UeRadioCapabilityKnownToAmf = true
+	gnbue.Log.Traceln("Sent UE Radio Capability Info Indication to AMF")
+}
+
+// HandleUeRadioCapabilityCheckRequest responds with the IMS voice support of
+// the UE. IMS voice is considered supported when a UE Radio Capability is
+// available, either in the request or with the gNB
+func HandleUeRadioCapabilityCheckRequest(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	msg := intfcMsg.(*common.N2Message)
+	capCheckReq := msg.NgapPdu.InitiatingMessage.Value.UERadioCapabilityCheckRequest
+
+	capability := gnbue.UeRadioCapability
+	for _, ie := range capCheckReq.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDUERadioCapability &&
+			ie.Value.UERadioCapability != nil {
+			capability = ie.Value.UERadioCapability.Value
+		}
+	}
+	imsVoiceSupported := len(capability) != 0
+	gnbue.Log.Infoln("UE Radio Capability check, IMS voice supported:",
+		imsVoiceSupported)
+
+	sendMsg, err := ngap.GetUERadioCapabilityCheckResponse(gnbue, imsVoiceSupported)
+	if err != nil {
+		gnbue.Log.Errorln("GetUERadioCapabilityCheckResponse failed:", err)
+		return
+	}
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
+	if err != nil {
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		return
+	}
+	gnbue.Log.Traceln("Sent UE Radio Capability Check Response to AMF")
+}
+
+// HandleUeCtxModificationRequest updates the UE context with the Security Key,
+// UE Aggregate Maximum Bit Rate, UE Security Capabilities, AMF UE NGAP ID and
+// RRC Inactive Transition Report Request provided by the AMF. The request is
+// rejected when the profile directs gNB to do so
+func HandleUeCtxModificationRequest(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	msg := intfcMsg.(*common.N2Message)
+	ueCtxModReq := msg.NgapPdu.InitiatingMessage.Value.UEContextModificationRequest
+
+	if gnbue.UeCtxModFailureCause != nil {
+		sendMsg, err := ngap.GetUEContextModificationFailure(gnbue,
+			gnbue.UeCtxModFailureCause)
+		if err != nil {
+			gnbue.Log.Errorln("GetUEContextModificationFailure failed:", err)
+			return
+		}
+		err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+			gnbue.GnbUeNgapId, sendMsg)
+		if err != nil {
+			gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+			return
+		}
+		gnbue.Log.Traceln("Sent UE Context Modification Failure to AMF")
+		return
+	}
+
+	var rrcStateReportRequest *ngapType.RRCInactiveTransitionReportRequest
+	for _, ie := range ueCtxModReq.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDSecurityKey:
+			if ie.Value.SecurityKey != nil {
+				gnbue.SecurityKey = ie.Value.SecurityKey.Value.Bytes
+				gnbue.Log.Infoln("Security Key updated by AMF")
+			}
+		case ngapType.ProtocolIEIDUEAggregateMaximumBitRate:
+			if ambr := ie.Value.UEAggregateMaximumBitRate; ambr != nil {
+				gnbue.UeAmbrUl = ambr.UEAggregateMaximumBitRateUL.Value
+				gnbue.UeAmbrDl = ambr.UEAggregateMaximumBitRateDL.Value
+				gnbue.Log.Infoln("UE-AMBR updated by AMF, UL:",
+					gnbue.UeAmbrUl, "DL:", gnbue.UeAmbrDl)
+			}
+		case ngapType.ProtocolIEIDUESecurityCapabilities:
+			if ie.Value.UESecurityCapabilities != nil {
+				gnbue.UeSecurityCapabilities = ie.Value.UESecurityCapabilities
+			}
+		case ngapType.ProtocolIEIDNewAMFUENGAPID:
+			if ie.Value.NewAMFUENGAPID != nil {
+				gnbue.AmfUeNgapId = ie.Value.NewAMFUENGAPID.Value
+				gnbue.Log.Infoln("AMF UE NGAP ID updated to:",
+					gnbue.AmfUeNgapId)
+			}
+		case ngapType.ProtocolIEIDRRCInactiveTransitionReportRequest:
+			rrcStateReportRequest = ie.Value.RRCInactiveTransitionReportRequest
+		}
+	}
+
+	// RRC state is reported in the response when requested by the AMF. A
+	// single RRC connected state report is complete if the UE is connected
+	reportRrcState := false
+	if rrcStateReportRequest != nil {
+		setRrcStateReportRequest(gnbue, rrcStateReportRequest)
+		reportRrcState = gnbue.RrcStateReportRequest != nil
+		if reportRrcState && !gnbue.RrcInactive &&
+			rrcStateReportRequest.Value ==
+				ngapType.RRCInactiveTransitionReportRequestPresentSingleRrcConnectedStateReport {
+			gnbue.RrcStateReportRequest = nil
+		}
+	}
+
+	sendMsg, err := ngap.GetUEContextModificationResponse(gnbue, reportRrcState)
+	if err != nil {
+		gnbue.Log.Errorln("GetUEContextModificationResponse failed:", err)
+		return
+	}
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
+	if err != nil {
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		return
+	}
+	gnbue.Log.Traceln("Sent UE Context Modification Response to AMF")
+}
+
+// HandleCellChange moves the UE to the cell of the next scripted cell change
+// and reports the new location to the AMF
+func HandleCellChange(gnbue *gnbctx.GnbCpUe, intfcMsg common.InterfaceMessage) {
+	if gnbue.NextCellChange >= len(gnbue.CellChanges) {
+		return
+	}
+	change := gnbue.CellChanges[gnbue.NextCellChange]
+	gnbue.NextCellChange++
+
+	cell, err := gnbue.Gnb.GetCell(change.NrCellId)
+	if err != nil {
+		gnbue.Log.Errorln("GetCell failed:", err)
+		return
+	}
+	moveToCell(gnbue, cell)
+}
+
+// moveToCell moves the UE to the provided cell of the gNB and reports the new
+// location to the AMF if requested
+func moveToCell(gnbue *gnbctx.GnbCpUe, cell *gnbctx.NrCell) {
+	gnbue.Cell = cell
+	gnbue.CellEntryTime = time.Now()
+	gnbue.Log.Infoln("UE moved to cell, NR Cell Identity:", cell.NrCellId)
+
+	if gnbue.LocationReportingRequest != nil {
+		sendLocationReport(gnbue, gnbue.LocationReportingRequest)
+	}
+}
+
+func sendLocationReport(gnbue *gnbctx.GnbCpUe,
+	reqType *ngapType.LocationReportingRequestType) {
+
+	sendMsg, err := ngap.GetLocationReport(gnbue, reqType)
+	if err != nil {
+		gnbue.Log.Errorln("GetLocationReport failed:", err)
+		return
+	}
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
+	if err != nil {
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		return
+	}
+	gnbue.Log.Traceln("Sent Location Report to AMF")
+}
+
+// startCellChanges triggers the pending scripted cell changes of the UE, each
+// after its configured delay
+func startCellChanges(gnbue *gnbctx.GnbCpUe) {
+	if gnbue.CellChangeQuit != nil ||
+		gnbue.NextCellChange >= len(gnbue.CellChanges) {
+		return
+	}
+
+	gnbue.CellChangeQuit = make(chan struct{})
+	changes := gnbue.CellChanges[gnbue.NextCellChange:]
+	go func(quit chan struct{}, ch chan common.InterfaceMessage) {
+		for _, change := range changes {
+			select {
+			case <-quit:
+				return
+			case <-time.After(time.Duration(change.Delay) * time.Millisecond):
+			}
+
+			msg := &common.DefaultMessage{}
+			msg.Event = common.TRIGGER_CELL_CHANGE_EVENT
+			select {
+			case <-quit:
+				return
+			case ch <- msg:
+			}
+		}
+	}(gnbue.CellChangeQuit, gnbue.ReadChan)
+}
+
+func stopCellChanges(gnbue *gnbctx.GnbCpUe) {
+	if gnbue.CellChangeQuit != nil {
+		close(gnbue.CellChangeQuit)
+		gnbue.CellChangeQuit = nil
+	}
+}
+
+// HandleGnbRestart tears down the UE context as the gNB restarts. No NGAP
+// message is sent, the AMF is left to release the UE context on losing the
+// SCTP association. UE is notified of the loss of its connection
+func HandleGnbRestart(gnbue *gnbctx.GnbCpUe, intfcMsg common.InterfaceMessage) {
+	msg := intfcMsg.(*common.GnbRestartMessage)
+	defer msg.Done.Done()
+
+	if isServingUe(gnbue) && gnbue.WriteUeChan != nil {
+		req := &common.UuMessage{}
+		req.Event = common.CONNECTION_RELEASE_REQUEST_EVENT
+		req.TriggeringEvent = common.GNB_RESTART_EVENT
+		gnbue.WriteUeChan <- req
+	}
+
+	HandleQuitEvent(gnbue, intfcMsg)
+	gnbue.Log.Infoln("UE context torn down as gNB restarted")
+}
+
 func HandleQuitEvent(gnbue *gnbctx.GnbCpUe, intfcMsg common.InterfaceMessage) {
+	stopCellChanges(gnbue)
+	stopInactivityTimer(gnbue)
+	stopUsageReports(gnbue)
+	if ho := gnbue.Handover; ho != nil {
+		if ho.Source != gnbue && !ho.IsExecuted() {
+			// User plane routines of the target are not started until the
+			// handover is executed
+			f := func(k interface{}, v interface{}) bool {
+				releaseGnbUpUe(gnbue, v.(*gnbctx.GnbUpUe))
+				return true
+			}
+			gnbue.GnbUpUes.Range(f)
+		} else if ho.Source == gnbue && ho.IsExecuted() {
+			f := func(k interface{}, v interface{}) bool {
+				v.(*gnbctx.GnbUpUe).HandedOver = true
+				return true
+			}
+			gnbue.GnbUpUes.Range(f)
+		}
+	}
 	terminateUpUeContexts(gnbue)
+	// Removed before the ID is freed, so that the ID is not reallocated while
+	// still mapped to this context
+	gnbue.Gnb.GnbUes.RemoveGnbCpUe(gnbue.GnbUeNgapId, gnbue)
 	gnbue.Gnb.RanUeNGAPIDGenerator.FreeID(gnbue.GnbUeNgapId)
 	gnbue.WaitGrp.Wait()
 	gnbue.Log.Infoln("gNB Control-Plane UE context terminated")
@@ -621,4 +1343,5 @@ func terminateUpUeContext(upCtx *gnbctx.GnbUpUe) {
 	msg.Event = common.QUIT_EVENT
 	upCtx.ReadCmdChan <- msg
 	upCtx.Upf.GnbUpUes.RemoveGnbUpUe(upCtx.DlTeid, true)
+	releaseSecondaryTunnel(upCtx)
 }
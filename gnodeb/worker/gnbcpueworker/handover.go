@@ -0,0 +1,576 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gnbcpueworker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/gnodeb/ngap"
+	"github.com/omec-project/gnbsim/gnodeb/worker/gnbupfworker"
+	"github.com/omec-project/gnbsim/util/ngapTestpacket"
+	"github.com/omec-project/gnbsim/util/test"
+
+	"github.com/omec-project/aper"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// InitHandoverTarget creates the gNB UE context of the target gNB for the
+// handover, which serves the UE once the handover is executed, and starts its
+// routine
+func InitHandoverTarget(ho *gnbctx.Handover,
+	amf *gnbctx.GnbAmf) (*gnbctx.GnbCpUe, error) {
+
+	source := ho.Source
+	targetGnb := ho.TargetGnb
+	ranUeNgapId, err := targetGnb.AllocateRanUeNgapID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate ran ue ngap id: %v", err)
+	}
+
+	target := gnbctx.NewGnbCpUe(ranUeNgapId, targetGnb, amf)
+	target.Supi = source.Supi
+	target.WriteUeChan = source.WriteUeChan
+	target.Timeline = source.Timeline
+	target.Plmn = source.Plmn
+	target.Cell = ho.TargetCell
+	target.UeRadioCapability = source.UeRadioCapability
+	target.UeRadioCapabilityKnownToAmf = source.UeRadioCapabilityKnownToAmf
+	target.UeSecurityCapabilities = source.UeSecurityCapabilities
+	target.Handover = ho
+	ho.SetTarget(target)
+	targetGnb.GnbUes.AddGnbCpUe(ranUeNgapId, target)
+
+	go Init(target)
+	return target, nil
+}
+
+// HandleTriggerHandover initiates the handover of the UE to the target cell.
+// UE simply moves to the target cell when it is served by the same gNB
+func HandleTriggerHandover(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	ho := intfcMsg.(*gnbctx.HandoverMessage).Handover
+	ho.Source = gnbue
+
+	if ho.IsIntraGnb() {
+		moveToCell(gnbue, ho.TargetCell)
+		sendHandoverResult(gnbue, ho, common.HANDOVER_COMPLETE_EVENT, nil)
+		return
+	}
+
+	if gnbue.Handover != nil {
+		sendHandoverResult(gnbue, ho, common.HANDOVER_FAILURE_EVENT,
+			fmt.Errorf("handover already in progress"))
+		return
+	}
+	if !hasGnbUpUes(gnbue) {
+		sendHandoverResult(gnbue, ho, common.HANDOVER_FAILURE_EVENT,
+			fmt.Errorf("no pdu session to be handed over"))
+		return
+	}
+
+	gnbue.Log.Infoln("Initiating", ho.Type, "handover to gNB:",
+		ho.TargetGnb.GnbName, "NR Cell Identity:", ho.TargetCell.NrCellId)
+	stopCellChanges(gnbue)
+	gnbue.Handover = ho
+
+	if ho.Type == gnbctx.HANDOVER_N2 {
+		gnbctx.AddHandover(ho)
+		sendMsg, err := ngap.GetHandoverRequired(gnbue, ho)
+		if err == nil {
+			err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+				gnbue.GnbUeNgapId, sendMsg)
+		}
+		if err != nil {
+			gnbue.Log.Errorln("Failed to send Handover Required:", err)
+			abortHandover(gnbue, err)
+			return
+		}
+		gnbue.Log.Traceln("Sent Handover Required to AMF")
+		return
+	}
+
+	target, err := InitHandoverTarget(ho, ho.TargetGnb.DefaultAmf)
+	if err != nil {
+		gnbue.Log.Errorln("InitHandoverTarget failed:", err)
+		abortHandover(gnbue, err)
+		return
+	}
+	// Target gNB reports the AMF UE NGAP ID of the source in Path Switch
+	// Request
+	target.AmfUeNgapId = gnbue.AmfUeNgapId
+
+	msg := &gnbctx.HandoverMessage{Handover: ho}
+	msg.Event = common.XN_HANDOVER_REQUEST_EVENT
+	target.ReadChan <- msg
+}
+
+// HandleXnHandoverRequest allocates the user plane resources of the target
+// gNB for the PDU sessions of the UE and requests the AMF to switch the
+// downlink tunnels towards the target gNB
+func HandleXnHandoverRequest(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	source := gnbue.Handover.Source
+	var err error
+	f := func(k interface{}, v interface{}) bool {
+		err = copyGnbUpUe(gnbue, v.(*gnbctx.GnbUpUe))
+		return err == nil
+	}
+	source.GnbUpUes.Range(f)
+	if err != nil {
+		gnbue.Log.Errorln("copyGnbUpUe failed:", err)
+		failXnHandover(gnbue, err)
+		return
+	}
+
+	sendMsg, err := ngap.GetPathSwitchRequest(gnbue, gnbue.AmfUeNgapId)
+	if err == nil {
+		err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+			gnbue.GnbUeNgapId, sendMsg)
+	}
+	if err != nil {
+		gnbue.Log.Errorln("Failed to send Path Switch Request:", err)
+		failXnHandover(gnbue, err)
+		return
+	}
+	gnbue.Log.Traceln("Sent Path Switch Request to AMF")
+}
+
+func HandlePathSwitchRequestAck(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	msg := intfcMsg.(*common.N2Message)
+	pathSwitchReqAck := msg.NgapPdu.SuccessfulOutcome.Value.PathSwitchRequestAcknowledge
+
+	var amfUeNgapId *ngapType.AMFUENGAPID
+	var switchedList *ngapType.PDUSessionResourceSwitchedList
+	for _, ie := range pathSwitchReqAck.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			amfUeNgapId = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDPDUSessionResourceSwitchedList:
+			switchedList = ie.Value.PDUSessionResourceSwitchedList
+		}
+	}
+	if amfUeNgapId == nil || switchedList == nil {
+		gnbue.Log.Errorln("Mandatory IEs missing in Path Switch Request Acknowledge")
+		failXnHandover(gnbue, fmt.Errorf("invalid path switch request acknowledge"))
+		return
+	}
+	gnbue.AmfUeNgapId = amfUeNgapId.Value
+
+	// Uplink tunnel of a PDU session changes if provided
+	switched := make(map[int64]bool)
+	for _, item := range switchedList.List {
+		pduSessId := item.PDUSessionID.Value
+		gnbUpUe, err := gnbue.GetGnbUpUe(pduSessId)
+		if err != nil {
+			gnbue.Log.Warnln("Switched PDU session not found:", err)
+			continue
+		}
+		switched[pduSessId] = true
+
+		transfer := ngapType.PathSwitchRequestAcknowledgeTransfer{}
+		err = aper.UnmarshalWithParams(item.PathSwitchRequestAcknowledgeTransfer,
+			&transfer, "valueExt")
+		if err != nil {
+			gnbue.Log.Warnln("UnmarshalWithParams returned:", err)
+			continue
+		}
+		tnlInfo := transfer.ULNGUUPTNLInformation
+		if tnlInfo == nil || tnlInfo.GTPTunnel == nil {
+			continue
+		}
+		gnbUpUe.UlTeid = binary.BigEndian.Uint32(tnlInfo.GTPTunnel.GTPTEID.Value)
+		upfIp := getUpfIp(gnbue, tnlInfo.GTPTunnel.TransportLayerAddress)
+		gnbUpUe.Upf = getGnbUpf(gnbue, upfIp)
+		gnbue.Log.Infoln("Uplink tunnel switched, PDU Session ID:", pduSessId,
+			"UL GTP-TEID:", gnbUpUe.UlTeid, "UPF Endpoint IP:", upfIp)
+	}
+
+	// PDU sessions which are not switched are released by the network
+	f := func(k interface{}, v interface{}) bool {
+		if !switched[k.(int64)] {
+			gnbue.Log.Warnln("PDU session not switched, PDU Session ID:", k)
+			releaseGnbUpUe(gnbue, v.(*gnbctx.GnbUpUe))
+		}
+		return true
+	}
+	gnbue.GnbUpUes.Range(f)
+
+	switchUeToTarget(gnbue)
+}
+
+func HandlePathSwitchRequestFailure(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	gnbue.Log.Errorln("Path Switch Request failed")
+	failXnHandover(gnbue, fmt.Errorf("path switch request failed"))
+}
+
+// HandleHandoverRequest allocates the user plane resources of the target gNB
+// for the PDU sessions to be handed over through N2, and acknowledges the
+// AMF with the admitted PDU sessions
+func HandleHandoverRequest(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	msg := intfcMsg.(*common.N2Message)
+	hoReq := msg.NgapPdu.InitiatingMessage.Value.HandoverRequest
+
+	var setupList *ngapType.PDUSessionResourceSetupListHOReq
+	for _, ie := range hoReq.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			if ie.Value.AMFUENGAPID != nil {
+				gnbue.AmfUeNgapId = ie.Value.AMFUENGAPID.Value
+			}
+		case ngapType.ProtocolIEIDUESecurityCapabilities:
+			if ie.Value.UESecurityCapabilities != nil {
+				gnbue.UeSecurityCapabilities = ie.Value.UESecurityCapabilities
+			}
+		case ngapType.ProtocolIEIDPDUSessionResourceSetupListHOReq:
+			setupList = ie.Value.PDUSessionResourceSetupListHOReq
+		}
+	}
+
+	if gnbue.Handover.Outcome == gnbctx.HANDOVER_OUTCOME_PREPARATION_FAILURE {
+		gnbue.Log.Infoln("Rejecting Handover Request as requested")
+		sendHandoverFailure(gnbue)
+		return
+	}
+
+	if setupList != nil {
+		for _, v := range setupList.List {
+			item := pduSessResourceSetupItem{}
+			item.PDUSessionID = v.PDUSessionID
+			item.SNSSAI = v.SNSSAI
+			item.PDUSessionResourceSetupRequestTransfer = v.HandoverRequestTransfer
+			_, _, err := setupGnbUpUe(gnbue, item)
+			if err != nil {
+				gnbue.Log.Warnln("PDU session not admitted, PDU Session ID:",
+					v.PDUSessionID.Value, "error:", err)
+			}
+		}
+	}
+
+	sendMsg, err := ngap.GetHandoverRequestAcknowledge(gnbue,
+		gnbue.Handover.GetRrcContainer())
+	if err != nil {
+		gnbue.Log.Errorln("GetHandoverRequestAcknowledge failed:", err)
+		sendHandoverFailure(gnbue)
+		return
+	}
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
+	if err != nil {
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		return
+	}
+	gnbue.Log.Traceln("Sent Handover Request Acknowledge to AMF")
+}
+
+// HandleHandoverCommand executes the N2 handover, the UE is handed over to
+// the target gNB UE context
+func HandleHandoverCommand(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	ho := gnbue.Handover
+	if ho == nil || ho.GetTarget() == nil {
+		gnbue.Log.Errorln("Handover Command received without handover in progress")
+		return
+	}
+
+	if ho.Outcome == gnbctx.HANDOVER_OUTCOME_CANCEL {
+		cancelHandover(gnbue)
+		return
+	}
+
+	gnbue.Log.Infoln("Handover Command received, handing over UE to gNB:",
+		ho.TargetGnb.GnbName)
+	msg := &gnbctx.HandoverMessage{Handover: ho}
+	msg.Event = common.HANDOVER_EXECUTION_EVENT
+	ho.GetTarget().ReadChan <- msg
+}
+
+func HandleHandoverExecution(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	switchUeToTarget(gnbue)
+}
+
+func HandleHandoverPreparationFailure(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	msg := intfcMsg.(*common.N2Message)
+	hoPrepFailure := msg.NgapPdu.UnsuccessfulOutcome.Value.HandoverPreparationFailure
+
+	err := fmt.Errorf("handover preparation failed")
+	for _, ie := range hoPrepFailure.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDCause && ie.Value.Cause != nil {
+			present, value := test.PrintAndGetCause(ie.Value.Cause)
+			err = fmt.Errorf("handover preparation failed, cause present:%v, value:%v",
+				present, value)
+		}
+	}
+	ho := gnbue.Handover
+	if ho != nil && ho.Outcome == gnbctx.HANDOVER_OUTCOME_PREPARATION_FAILURE {
+		gnbue.Log.Infoln(err, "as requested")
+		completeAbortedHandover(gnbue)
+		return
+	}
+	gnbue.Log.Errorln(err)
+	abortHandover(gnbue, err)
+}
+
+// cancelHandover cancels the prepared N2 handover instead of executing it,
+// the AMF then releases the target gNB UE context
+func cancelHandover(gnbue *gnbctx.GnbCpUe) {
+	gnbue.Log.Infoln("Handover Command received, cancelling handover to gNB:",
+		gnbue.Handover.TargetGnb.GnbName)
+	cause, _ := test.GetNgapCause("handover-cancelled")
+	sendMsg, err := ngap.GetHandoverCancel(gnbue, cause)
+	if err == nil {
+		err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+			gnbue.GnbUeNgapId, sendMsg)
+	}
+	if err != nil {
+		gnbue.Log.Errorln("Failed to send Handover Cancel:", err)
+		abortHandover(gnbue, err)
+		return
+	}
+	gnbue.Log.Traceln("Sent Handover Cancel to AMF")
+}
+
+func HandleHandoverCancelAck(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	ho := gnbue.Handover
+	if ho == nil || ho.Outcome != gnbctx.HANDOVER_OUTCOME_CANCEL {
+		gnbue.Log.Errorln("Handover Cancel Acknowledge received without handover being cancelled")
+		return
+	}
+	gnbue.Log.Infoln("Handover cancelled")
+	completeAbortedHandover(gnbue)
+}
+
+// HandleHandoverFailure handles the failure of the Xn handover reported by
+// the target gNB UE context
+func HandleHandoverFailure(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	abortHandover(gnbue, intfcMsg.GetErrorMsg())
+}
+
+// switchUeToTarget moves the UE to the target gNB UE context and sets up the
+// data bearers of the UE towards the target gNB
+func switchUeToTarget(gnbue *gnbctx.GnbCpUe) {
+	ho := gnbue.Handover
+	ho.SetExecuted()
+	gnbue.CellEntryTime = time.Now()
+
+	msg := &gnbctx.HandoverMessage{Handover: ho}
+	msg.Event = common.HANDOVER_SWITCH_EVENT
+	gnbue.WriteUeChan <- msg
+
+	var dbParamSet []*common.DataBearerParams
+	f := func(k interface{}, v interface{}) bool {
+		gnbUpUe := v.(*gnbctx.GnbUpUe)
+		pduSess := &ngapTestpacket.PduSession{}
+		pduSess.PduSessId = gnbUpUe.PduSessId
+		pduSess.Teid = gnbUpUe.DlTeid
+		pduSess.Success = true
+		for qfi := range gnbUpUe.QosFlows {
+			pduSess.SuccessQfiList = append(pduSess.SuccessQfiList, qfi)
+		}
+
+		dbParam := &common.DataBearerParams{}
+		dbParam.CommChan = gnbUpUe.ReadUlChan
+		dbParam.PduSess = pduSess
+		dbParamSet = append(dbParamSet, dbParam)
+		return true
+	}
+	gnbue.GnbUpUes.Range(f)
+
+	if len(dbParamSet) == 0 {
+		completeHandover(gnbue)
+		return
+	}
+
+	uemsg := &common.UuMessage{}
+	uemsg.Event = common.DATA_BEARER_SETUP_REQUEST_EVENT
+	uemsg.DBParams = dbParamSet
+	uemsg.TriggeringEvent = common.TRIGGER_HANDOVER_EVENT
+	gnbue.WriteUeChan <- uemsg
+}
+
+// completeHandover completes the handover once the data bearers of the UE are
+// set up with the target gNB. Source gNB UE context is released right away
+// for Xn handover, whereas the AMF releases it for N2 handover
+func completeHandover(gnbue *gnbctx.GnbCpUe) {
+	ho := gnbue.Handover
+	if ho.Type == gnbctx.HANDOVER_N2 {
+		sendMsg, err := ngap.GetHandoverNotify(gnbue)
+		if err != nil {
+			gnbue.Log.Errorln("GetHandoverNotify failed:", err)
+		} else {
+			err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+				gnbue.GnbUeNgapId, sendMsg)
+			if err != nil {
+				gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+			} else {
+				gnbue.Log.Traceln("Sent Handover Notify to AMF")
+			}
+		}
+	} else {
+		quitEvt := &common.DefaultMessage{}
+		quitEvt.Event = common.QUIT_EVENT
+		ho.Source.ReadChan <- quitEvt
+	}
+
+	gnbctx.RemoveHandover(ho)
+	gnbue.Handover = nil
+	gnbue.Log.Infoln("Handover complete, NR Cell Identity:", gnbue.Cell.NrCellId)
+	sendHandoverResult(gnbue, ho, common.HANDOVER_COMPLETE_EVENT, nil)
+}
+
+// abortHandover clears the handover in progress at the source gNB UE context
+// and reports the failure to the UE, which continues to be served by the
+// source
+func abortHandover(gnbue *gnbctx.GnbCpUe, err error) {
+	ho := gnbue.Handover
+	if ho == nil {
+		return
+	}
+	gnbctx.RemoveHandover(ho)
+	gnbue.Handover = nil
+	sendHandoverResult(gnbue, ho, common.HANDOVER_FAILURE_EVENT, err)
+}
+
+// completeAbortedHandover clears the handover which is cancelled or fails the
+// preparation as requested, and reports it to the UE, which continues to be
+// served by the source
+func completeAbortedHandover(gnbue *gnbctx.GnbCpUe) {
+	ho := gnbue.Handover
+	gnbctx.RemoveHandover(ho)
+	gnbue.Handover = nil
+	sendHandoverResult(gnbue, ho, common.HANDOVER_ABORTED_EVENT, nil)
+}
+
+// failXnHandover reports the failure of the Xn handover to the source gNB UE
+// context and terminates the target gNB UE context
+func failXnHandover(gnbue *gnbctx.GnbCpUe, err error) {
+	msg := &gnbctx.HandoverMessage{Handover: gnbue.Handover}
+	msg.Event = common.HANDOVER_FAILURE_EVENT
+	msg.Error = err
+	gnbue.Handover.Source.ReadChan <- msg
+
+	quitEvt := &common.DefaultMessage{}
+	quitEvt.Event = common.QUIT_EVENT
+	gnbue.ReadChan <- quitEvt
+}
+
+// sendHandoverFailure rejects the N2 handover and terminates the target gNB
+// UE context
+func sendHandoverFailure(gnbue *gnbctx.GnbCpUe) {
+	cause := gnbue.Handover.FailureCause
+	if cause == nil {
+		cause, _ = test.GetNgapCause("radio-resources-not-available")
+	}
+	sendMsg, err := ngap.GetHandoverFailure(gnbue.AmfUeNgapId, cause)
+	if err != nil {
+		gnbue.Log.Errorln("GetHandoverFailure failed:", err)
+	} else {
+		err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+			gnbue.GnbUeNgapId, sendMsg)
+		if err != nil {
+			gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		} else {
+			gnbue.Log.Traceln("Sent Handover Failure to AMF")
+		}
+	}
+
+	quitEvt := &common.DefaultMessage{}
+	quitEvt.Event = common.QUIT_EVENT
+	gnbue.ReadChan <- quitEvt
+}
+
+func sendHandoverResult(gnbue *gnbctx.GnbCpUe, ho *gnbctx.Handover,
+	event common.EventType, err error) {
+
+	msg := &gnbctx.HandoverMessage{Handover: ho}
+	msg.Event = event
+	msg.Error = err
+	gnbue.WriteUeChan <- msg
+}
+
+// isServingUe reports whether the gNB UE context serves the UE. During a
+// handover, the source serves the UE until the handover is executed, after
+// which the target does
+func isServingUe(gnbue *gnbctx.GnbCpUe) bool {
+	ho := gnbue.Handover
+	if ho == nil {
+		return true
+	}
+	return (ho.Source == gnbue) != ho.IsExecuted()
+}
+
+// copyGnbUpUe creates the user plane context of the target gNB for the PDU
+// session of the source, with a downlink tunnel of the target gNB
+func copyGnbUpUe(gnbue *gnbctx.GnbCpUe, src *gnbctx.GnbUpUe) error {
+	dlteid, err := gnbue.Gnb.DlTeidGenerator.Allocate()
+	if err != nil {
+		return fmt.Errorf("ID Generator Allocate() returned: %v", err)
+	}
+
+	gnbUpUe := gnbctx.NewGnbUpUe(uint32(dlteid), src.UlTeid, gnbue.Gnb)
+	gnbUpUe.PduSessId = src.PduSessId
+	gnbUpUe.Snssai = src.Snssai
+	gnbUpUe.PduSessType = src.PduSessType
+	for qfi, qosFlow := range src.QosFlows {
+		gnbUpUe.AddQosFlow(qfi, qosFlow)
+	}
+	gnbUpUe.Upf = getGnbUpf(gnbue, src.Upf.GetIpAddr())
+	gnbue.AddGnbUpUe(gnbUpUe.PduSessId, gnbUpUe)
+	return nil
+}
+
+// releaseGnbUpUe releases the user plane context of the PDU session which is
+// not yet started
+func releaseGnbUpUe(gnbue *gnbctx.GnbCpUe, gnbUpUe *gnbctx.GnbUpUe) {
+	gnbue.Gnb.DlTeidGenerator.FreeID(int64(gnbUpUe.DlTeid))
+	gnbue.RemoveGnbUpUe(gnbUpUe.PduSessId)
+}
+
+func getGnbUpf(gnbue *gnbctx.GnbCpUe, upfIp string) *gnbctx.GnbUpf {
+	gnbupf, created := gnbue.Gnb.GnbPeers.GetOrAddGnbUpf(upfIp)
+	if created {
+		go gnbupfworker.Init(gnbupf)
+	}
+	return gnbupf
+}
+
+// getUpfIp returns the UPF address of the GTP tunnel, of the same address
+// family as the N3 address of the gNB when both IPv4 and IPv6 are provided
+func getUpfIp(gnbue *gnbctx.GnbCpUe, addr ngapType.TransportLayerAddress) string {
+	upfIp, err := ngapTestpacket.NgapToIpAddress(addr, gnbue.Gnb.IsN3Ipv6())
+	if err != nil {
+		gnbue.Log.Errorln("Failed to decode UPF transport layer address:", err)
+	}
+	return upfIp
+}
+
+func hasGnbUpUes(gnbue *gnbctx.GnbCpUe) bool {
+	found := false
+	gnbue.GnbUpUes.Range(func(k interface{}, v interface{}) bool {
+		found = true
+		return false
+	})
+	return found
+}
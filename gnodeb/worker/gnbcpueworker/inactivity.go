@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gnbcpueworker
+
+import (
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/gnodeb/ngap"
+	"github.com/omec-project/gnbsim/util/test"
+)
+
+// startInactivityTimer starts the inactivity timer of the UE, if configured
+// for the gNB and not already running
+func startInactivityTimer(gnbue *gnbctx.GnbCpUe) {
+	timeout := time.Duration(gnbue.Gnb.InactivityTimer) * time.Second
+	if timeout == 0 || gnbue.InactivityQuit != nil {
+		return
+	}
+	gnbue.Activity.Touch()
+	gnbue.InactivityQuit = make(chan struct{})
+	armInactivityTimer(gnbue, timeout)
+	gnbue.Log.Traceln("Inactivity timer started,", timeout)
+}
+
+// armInactivityTimer raises INACTIVITY_TIMER_EXPIRY_EVENT once the duration
+// expires, unless the timer is stopped meanwhile
+func armInactivityTimer(gnbue *gnbctx.GnbCpUe, duration time.Duration) {
+	quit, ch := gnbue.InactivityQuit, gnbue.ReadChan
+	gnbue.InactivityTimer = time.AfterFunc(duration, func() {
+		msg := &common.DefaultMessage{}
+		msg.Event = common.INACTIVITY_TIMER_EXPIRY_EVENT
+		select {
+		case <-quit:
+		case ch <- msg:
+		}
+	})
+}
+
+// stopInactivityTimer stops the inactivity timer of the UE, if running
+func stopInactivityTimer(gnbue *gnbctx.GnbCpUe) {
+	if gnbue.InactivityQuit != nil {
+		gnbue.InactivityTimer.Stop()
+		close(gnbue.InactivityQuit)
+		gnbue.InactivityQuit = nil
+		gnbue.InactivityTimer = nil
+	}
+}
+
+// HandleInactivityTimerExpiry requests the release of the UE context with the
+// user inactivity cause, once the UE is inactive for the configured time. The
+// timer is restarted for the remaining time if the UE was active meanwhile,
+// and while the UE is in RRC Inactive state or is being handed over
+func HandleInactivityTimerExpiry(gnbue *gnbctx.GnbCpUe,
+	intfcMsg common.InterfaceMessage) {
+
+	if gnbue.InactivityQuit == nil {
+		// Stopped after the expiry was raised
+		return
+	}
+
+	timeout := time.Duration(gnbue.Gnb.InactivityTimer) * time.Second
+	idle := gnbue.Activity.GetIdleTime()
+	if idle < timeout || gnbue.RrcInactive || gnbue.Handover != nil {
+		remaining := timeout - idle
+		if remaining <= 0 {
+			remaining = timeout
+		}
+		armInactivityTimer(gnbue, remaining)
+		return
+	}
+	stopInactivityTimer(gnbue)
+
+	gnbue.Log.Infoln("UE inactive for", idle.Round(time.Second),
+		", requesting UE context release")
+	cause, _ := test.GetNgapCause("user-inactivity")
+	sendMsg, err := ngap.GetUEContextReleaseRequest(gnbue, cause)
+	if err != nil {
+		gnbue.Log.Errorln("GetUEContextReleaseRequest failed:", err)
+		return
+	}
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+		gnbue.GnbUeNgapId, sendMsg)
+	if err != nil {
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		return
+	}
+	gnbue.InactivityReleaseRequested = true
+	gnbue.Log.Traceln("Sent UE Context Release Request to AMF")
+}
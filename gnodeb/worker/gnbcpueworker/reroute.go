@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gnbcpueworker
+
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/gnodeb/ngap"
+
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// HandleRerouteNasRequest sends the Initial UE Message received in the
+// Reroute NAS Request to an AMF of the indicated AMF set, over the
+// association with that AMF. The UE is then served by the new AMF, TS 23.502
+// Section 4.2.2.2.3. The UE is failed and its context released when the
+// message can't be rerouted
+func HandleRerouteNasRequest(gnbue *gnbctx.GnbCpUe, intfcMsg common.InterfaceMessage) {
+	msg := intfcMsg.(*common.N2Message)
+	rerouteNasReq := msg.NgapPdu.InitiatingMessage.Value.RerouteNASRequest
+	if rerouteNasReq == nil {
+		failRerouteNasRequest(gnbue, fmt.Errorf("reroute nas request is nil"))
+		return
+	}
+
+	var ngapMessage []byte
+	var amfSetId *ngapType.AMFSetID
+	var allowedNssai *ngapType.AllowedNSSAI
+	for _, ie := range rerouteNasReq.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDNGAPMessage:
+			if ie.Value.NGAPMessage != nil {
+				ngapMessage = *ie.Value.NGAPMessage
+			}
+		case ngapType.ProtocolIEIDAMFSetID:
+			amfSetId = ie.Value.AMFSetID
+		case ngapType.ProtocolIEIDAllowedNSSAI:
+			allowedNssai = ie.Value.AllowedNSSAI
+		}
+	}
+	if len(ngapMessage) == 0 || amfSetId == nil {
+		failRerouteNasRequest(gnbue, fmt.Errorf("ngap message or amf set id "+
+			"not received in reroute nas request"))
+		return
+	}
+
+	// AMF Set ID is a 10 bit string
+	var setId uint16
+	if b := amfSetId.Value.Bytes; len(b) == 2 {
+		setId = uint16(b[0])<<2 | uint16(b[1])>>6
+	}
+
+	target, err := gnbue.Gnb.SelectAmfInSet(setId, gnbue.Amf)
+	if err != nil {
+		gnbue.Log.Errorln("SelectAmfInSet returned:", err)
+		failRerouteNasRequest(gnbue, err)
+		return
+	}
+
+	sendMsg, err := ngap.GetReroutedInitialUEMessage(ngapMessage, amfSetId,
+		allowedNssai)
+	if err != nil {
+		gnbue.Log.Errorln("GetReroutedInitialUEMessage failed:", err)
+		failRerouteNasRequest(gnbue, err)
+		return
+	}
+
+	gnbue.Log.Infof("Rerouting NAS message to AMF set: %v, AMF: %v, AMF IP: %v",
+		setId, target.AmfName, target.AmfIp)
+	gnbue.Amf = target
+	gnbue.AmfUeNgapId = 0
+	err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(target, gnbue.GnbUeNgapId,
+		sendMsg)
+	if err != nil {
+		gnbue.Log.Errorln("SendUeAssociatedToPeer failed:", err)
+		failRerouteNasRequest(gnbue, err)
+		return
+	}
+	gnbue.Log.Traceln("Sent rerouted Initial UE Message to AMF")
+}
+
+// failRerouteNasRequest reports the failure to reroute the NAS message to the
+// UE, which fails its procedure, and terminates the gNB UE context as the UE
+// is no longer served by any AMF
+func failRerouteNasRequest(gnbue *gnbctx.GnbCpUe, err error) {
+	gnbue.Log.Errorln("Failed to reroute NAS message:", err)
+	if gnbue.WriteUeChan != nil {
+		msg := &common.UuMessage{}
+		msg.Event = common.ERROR_EVENT
+		msg.Error = fmt.Errorf("failed to reroute nas message:%v", err)
+		gnbue.WriteUeChan <- msg
+	}
+
+	quitEvt := &common.DefaultMessage{}
+	quitEvt.Event = common.QUIT_EVENT
+	gnbue.ReadChan <- quitEvt
+}
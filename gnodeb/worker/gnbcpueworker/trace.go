@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gnbcpueworker
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/gnodeb/ngap"
+
+	"github.com/omec-project/ngap/ngapConvert"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// Interfaces to trace, in the order of the bits of Interfaces To Trace, TS
+// 38.413 Section 9.3.1.14
+var traceInterfaces = []string{"NG-C", "Xn-C", "Uu", "F1-C", "E1"}
+
+// Trace depths, in the order of the values of Trace Depth, TS 38.413 Section
+// 9.3.1.14
+var traceDepths = []string{"minimum", "medium", "maximum",
+	"minimumWithoutVendorSpecificExtension",
+	"mediumWithoutVendorSpecificExtension",
+	"maximumWithoutVendorSpecificExtension"}
+
+// HandleTraceStart activates the trace requested by the AMF for the UE
+func HandleTraceStart(gnbue *gnbctx.GnbCpUe, intfcMsg common.InterfaceMessage) {
+	msg := intfcMsg.(*common.N2Message)
+	traceStart := msg.NgapPdu.InitiatingMessage.Value.TraceStart
+	if traceStart == nil {
+		gnbue.Log.Errorln("TraceStart is nil")
+		return
+	}
+
+	for _, ie := range traceStart.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDTraceActivation &&
+			ie.Value.TraceActivation != nil {
+			startTrace(gnbue, ie.Value.TraceActivation)
+			return
+		}
+	}
+	gnbue.Log.Errorln("Trace Activation not received in Trace Start")
+}
+
+// HandleDeactivateTrace deactivates the trace of the UE identified by the
+// NG-RAN Trace ID
+func HandleDeactivateTrace(gnbue *gnbctx.GnbCpUe, intfcMsg common.InterfaceMessage) {
+	msg := intfcMsg.(*common.N2Message)
+	deactivateTrace := msg.NgapPdu.InitiatingMessage.Value.DeactivateTrace
+	if deactivateTrace == nil {
+		gnbue.Log.Errorln("DeactivateTrace is nil")
+		return
+	}
+
+	var traceId *ngapType.NGRANTraceID
+	for _, ie := range deactivateTrace.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDNGRANTraceID {
+			traceId = ie.Value.NGRANTraceID
+		}
+	}
+	if traceId == nil {
+		gnbue.Log.Errorln("NG-RAN Trace ID not received in Deactivate Trace")
+		return
+	}
+
+	if gnbue.Trace == nil ||
+		!bytes.Equal(gnbue.Trace.NGRANTraceID.Value, traceId.Value) {
+		gnbue.Log.Warnln("Deactivate Trace received for inactive trace, NG-RAN Trace ID:",
+			hex.EncodeToString(traceId.Value))
+		return
+	}
+	gnbue.Trace = nil
+	gnbue.Log.Infoln("Trace deactivated, NG-RAN Trace ID:",
+		hex.EncodeToString(traceId.Value))
+}
+
+// startTrace logs the trace activation parameters and keeps the trace active
+// for the UE. The Cell Traffic Trace is sent to the AMF if configured for the
+// gNB
+func startTrace(gnbue *gnbctx.GnbCpUe, activation *ngapType.TraceActivation) {
+	var interfaces []string
+	bits := activation.InterfacesToTrace.Value
+	for i, name := range traceInterfaces {
+		if uint64(i) < bits.BitLength && bits.Bytes[i/8]&(0x80>>uint(i%8)) != 0 {
+			interfaces = append(interfaces, name)
+		}
+	}
+
+	depth := "unknown"
+	if d := int(activation.TraceDepth.Value); d < len(traceDepths) {
+		depth = traceDepths[d]
+	}
+
+	ipv4, ipv6 := ngapConvert.IPAddressToString(activation.TraceCollectionEntityIPAddress)
+	tceAddr := ipv4
+	if tceAddr == "" {
+		tceAddr = ipv6
+	}
+
+	if gnbue.Trace != nil {
+		gnbue.Log.Infoln("Replacing active trace, NG-RAN Trace ID:",
+			hex.EncodeToString(gnbue.Trace.NGRANTraceID.Value))
+	}
+	gnbue.Trace = activation
+	gnbue.Log.Infof("Trace activated, NG-RAN Trace ID: %v, interfaces: [%v], depth: %v, trace collection entity: %v",
+		hex.EncodeToString(activation.NGRANTraceID.Value),
+		strings.Join(interfaces, ","), depth, tceAddr)
+
+	if !gnbue.Gnb.CellTrafficTrace {
+		return
+	}
+	sendMsg, err := ngap.GetCellTrafficTrace(gnbue)
+	if err == nil {
+		err = gnbue.Gnb.CpTransport.SendUeAssociatedToPeer(gnbue.Amf,
+			gnbue.GnbUeNgapId, sendMsg)
+	}
+	if err != nil {
+		gnbue.Log.Errorln("Failed to send Cell Traffic Trace:", err)
+		return
+	}
+	gnbue.Log.Traceln("Sent Cell Traffic Trace to AMF")
+}
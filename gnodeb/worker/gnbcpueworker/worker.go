@@ -5,6 +5,9 @@
 package gnbcpueworker
 
 import (
+	"fmt"
+	"runtime/debug"
+
 	"github.com/omec-project/gnbsim/common"
 	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
 )
@@ -16,42 +19,117 @@ func Init(gnbue *gnbctx.GnbCpUe) {
 func HandleEvents(gnbue *gnbctx.GnbCpUe) (err error) {
 
 	for msg := range gnbue.ReadChan {
-		evt := msg.GetEventType()
-		gnbue.Log.Infoln("Handling event:", evt)
-
-		switch msg.GetEventType() {
-		case common.CONNECTION_REQUEST_EVENT:
-			HandleConnectRequest(gnbue, msg)
-		case common.REG_REQUEST_EVENT, common.SERVICE_REQUEST_EVENT:
-			HandleInitialUEMessage(gnbue, msg)
-		case common.UL_INFO_TRANSFER_EVENT:
-			HandleUlInfoTransfer(gnbue, msg)
-		case common.DATA_BEARER_SETUP_RESPONSE_EVENT:
-			HandleDataBearerSetupResponse(gnbue, msg)
-		case common.DOWNLINK_NAS_TRANSPORT_EVENT:
-			HandleDownlinkNasTransport(gnbue, msg)
-		case common.INITIAL_CTX_SETUP_REQUEST_EVENT:
-			HandleInitialContextSetupRequest(gnbue, msg)
-		case common.PDU_SESS_RESOURCE_SETUP_REQUEST_EVENT:
-			HandlePduSessResourceSetupRequest(gnbue, msg)
-		case common.PDU_SESS_RESOURCE_RELEASE_COMMAND_EVENT:
-			HandlePduSessResourceReleaseCommand(gnbue, msg)
-		case common.UE_CTX_RELEASE_COMMAND_EVENT:
-			HandleUeCtxReleaseCommand(gnbue, msg)
-		case common.TRIGGER_AN_RELEASE_EVENT:
-			HandleRanConnectionRelease(gnbue, msg)
-		case common.QUIT_EVENT:
-			HandleQuitEvent(gnbue, msg)
+		if HandleEvent(gnbue, msg) {
 			return
-		default:
-			gnbue.Log.Infoln("Event", evt, "is not supported")
 		}
-
-		// TODO: Need to return and handle errors from handlers
 	}
 	return nil
 }
 
+// HandleEvent routes an event to the corresponding handler and returns true
+// once the UE context is to be terminated. An event which crashes the handler
+// is quarantined, the UE context continues with the next event
+func HandleEvent(gnbue *gnbctx.GnbCpUe, msg common.InterfaceMessage) (quit bool) {
+	evt := msg.GetEventType()
+	defer func() {
+		if r := recover(); r != nil {
+			reason := fmt.Sprintf("panic: %v", r)
+			count := gnbue.Gnb.QuarantineMsg(&gnbctx.QuarantinedMsg{
+				GnbUeNgapId: gnbue.GnbUeNgapId,
+				Event:       evt.String(),
+				Reason:      reason,
+			})
+			gnbue.Log.Errorf("Quarantined event %v (%v so far), %v\n%s", evt,
+				count, reason, debug.Stack())
+			quit = false
+		}
+	}()
+
+	gnbue.Log.Infoln("Handling event:", evt)
+
+	switch evt {
+	case common.CONNECTION_REQUEST_EVENT:
+		HandleConnectRequest(gnbue, msg)
+	case common.REG_REQUEST_EVENT, common.SERVICE_REQUEST_EVENT,
+		common.DEREG_REQUEST_UE_ORIG_EVENT:
+		HandleInitialUEMessage(gnbue, msg)
+	case common.UL_INFO_TRANSFER_EVENT:
+		HandleUlInfoTransfer(gnbue, msg)
+	case common.DATA_BEARER_SETUP_RESPONSE_EVENT:
+		HandleDataBearerSetupResponse(gnbue, msg)
+	case common.DOWNLINK_NAS_TRANSPORT_EVENT:
+		HandleDownlinkNasTransport(gnbue, msg)
+	case common.INITIAL_CTX_SETUP_REQUEST_EVENT:
+		HandleInitialContextSetupRequest(gnbue, msg)
+	case common.PDU_SESS_RESOURCE_SETUP_REQUEST_EVENT:
+		HandlePduSessResourceSetupRequest(gnbue, msg)
+	case common.PDU_SESS_RESOURCE_RELEASE_COMMAND_EVENT:
+		HandlePduSessResourceReleaseCommand(gnbue, msg)
+	case common.PDU_SESS_RESOURCE_MODIFY_REQUEST_EVENT:
+		HandlePduSessResourceModifyRequest(gnbue, msg)
+	case common.UE_CTX_RELEASE_COMMAND_EVENT:
+		HandleUeCtxReleaseCommand(gnbue, msg)
+	case common.TRIGGER_AN_RELEASE_EVENT:
+		HandleRanConnectionRelease(gnbue, msg)
+	case common.TRIGGER_INITIAL_CTX_SETUP_FAILURE_EVENT:
+		HandleTriggerInitialCtxSetupFailure(gnbue, msg)
+	case common.TRIGGER_RRC_INACTIVE_TRANSITION_EVENT,
+		common.TRIGGER_RRC_RESUME_EVENT:
+		HandleRrcStateTransition(gnbue, msg)
+	case common.LOCATION_REPORTING_CONTROL_EVENT:
+		HandleLocationReportingControl(gnbue, msg)
+	case common.UE_RADIO_CAPABILITY_CHECK_REQUEST_EVENT:
+		HandleUeRadioCapabilityCheckRequest(gnbue, msg)
+	case common.UE_CTX_MODIFICATION_REQUEST_EVENT:
+		HandleUeCtxModificationRequest(gnbue, msg)
+	case common.TRIGGER_CELL_CHANGE_EVENT:
+		HandleCellChange(gnbue, msg)
+	case common.INACTIVITY_TIMER_EXPIRY_EVENT:
+		HandleInactivityTimerExpiry(gnbue, msg)
+	case common.SECONDARY_RAT_USAGE_REPORT_EVENT:
+		HandleSecondaryRatUsageReport(gnbue, msg)
+	case common.PDU_SESS_RESOURCE_MODIFY_CONFIRM_EVENT:
+		HandlePduSessResourceModifyConfirm(gnbue, msg)
+	case common.TRACE_START_EVENT:
+		HandleTraceStart(gnbue, msg)
+	case common.DEACTIVATE_TRACE_EVENT:
+		HandleDeactivateTrace(gnbue, msg)
+	case common.REROUTE_NAS_REQUEST_EVENT:
+		HandleRerouteNasRequest(gnbue, msg)
+	case common.TRIGGER_HANDOVER_EVENT:
+		HandleTriggerHandover(gnbue, msg)
+	case common.XN_HANDOVER_REQUEST_EVENT:
+		HandleXnHandoverRequest(gnbue, msg)
+	case common.PATH_SWITCH_REQUEST_ACK_EVENT:
+		HandlePathSwitchRequestAck(gnbue, msg)
+	case common.PATH_SWITCH_REQUEST_FAILURE_EVENT:
+		HandlePathSwitchRequestFailure(gnbue, msg)
+	case common.HANDOVER_REQUEST_EVENT:
+		HandleHandoverRequest(gnbue, msg)
+	case common.HANDOVER_COMMAND_EVENT:
+		HandleHandoverCommand(gnbue, msg)
+	case common.HANDOVER_EXECUTION_EVENT:
+		HandleHandoverExecution(gnbue, msg)
+	case common.HANDOVER_PREPARATION_FAILURE_EVENT:
+		HandleHandoverPreparationFailure(gnbue, msg)
+	case common.HANDOVER_CANCEL_ACK_EVENT:
+		HandleHandoverCancelAck(gnbue, msg)
+	case common.HANDOVER_FAILURE_EVENT:
+		HandleHandoverFailure(gnbue, msg)
+	case common.GNB_RESTART_EVENT:
+		HandleGnbRestart(gnbue, msg)
+		return true
+	case common.QUIT_EVENT:
+		HandleQuitEvent(gnbue, msg)
+		return true
+	default:
+		gnbue.Log.Infoln("Event", evt, "is not supported")
+	}
+
+	// TODO: Need to return and handle errors from handlers
+	return false
+}
+
 func SendToUe(gnbue *gnbctx.GnbCpUe, event common.EventType, nasPdus common.NasPduList) {
 	gnbue.Log.Traceln("Sending event", event, "to SimUe")
 	uemsg := common.UuMessage{}
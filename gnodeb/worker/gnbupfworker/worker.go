@@ -17,7 +17,7 @@ import (
 
 func Init(gnbUpf *gnbctx.GnbUpf) {
 	if gnbUpf == nil {
-		logger.GNodeBLog.Errorln("GnbUpf context is nil")
+		logger.GnbUpLog.Errorln("GnbUpf context is nil")
 		return
 	}
 	for {
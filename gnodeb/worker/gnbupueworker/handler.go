@@ -22,16 +22,30 @@ func HandleUlMessage(gnbue *gnbctx.GnbUpUe, msg common.InterfaceMessage) (err er
 	}
 
 	userDataMsg := msg.(*common.UserDataMessage)
-	encodedMsg, err := test.BuildGpduMessage(userDataMsg.Payload, gnbue.UlTeid)
+
+	// The packets written in batches are retained by the transport, hence
+	// the scratch buffer is only reused when written one at a time
+	var buf []byte
+	reuse := gnbue.Gnb.N3BatchSize <= 1
+	if reuse {
+		buf = gnbue.UlPktBuf[:0]
+	}
+	encodedMsg, err := test.AppendGpduMessage(buf, userDataMsg.Payload,
+		gnbue.UlTeid)
 	if err != nil {
-		gnbue.Log.Errorln("BuildGpduMessage() returned:", err)
+		gnbue.Log.Errorln("AppendGpduMessage() returned:", err)
 		return fmt.Errorf("failed to encode gpdu")
 	}
+	if reuse {
+		gnbue.UlPktBuf = encodedMsg
+	}
 	err = gnbue.Gnb.UpTransport.SendToPeer(gnbue.Upf, encodedMsg)
 	if err != nil {
 		gnbue.Log.Errorln("UP Transport SendToPeer() returned:", err)
 		return fmt.Errorf("failed to send gpdu")
 	}
+	gnbue.Activity.Touch()
+	gnbue.Usage.AddUl(len(userDataMsg.Payload))
 	gnbue.Log.Traceln("Sent UL Packet from UE to UPF")
 	return nil
 }
@@ -65,6 +79,8 @@ func HandleDlMessage(gnbue *gnbctx.GnbUpUe, intfcMsg common.InterfaceMessage) (e
 		}
 	}
 
+	gnbue.Activity.Touch()
+	gnbue.Usage.AddDl(len(ueDataMsg.Payload))
 	ueDataMsg.Event = common.DL_UE_DATA_TRANSFER_EVENT
 	gnbue.WriteUeChan <- ueDataMsg
 	gnbue.Log.Infoln("Sent DL user data packet to UE")
@@ -72,10 +88,24 @@ func HandleDlMessage(gnbue *gnbctx.GnbUpUe, intfcMsg common.InterfaceMessage) (e
 	return nil
 }
 
+// HandleUlTunnelUpdate switches the uplink tunnel of the PDU session to the
+// UPF tunnel endpoint modified by the network
+func HandleUlTunnelUpdate(gnbue *gnbctx.GnbUpUe, intfcMsg common.InterfaceMessage) {
+	msg := intfcMsg.(*gnbctx.UlTunnelUpdate)
+	gnbue.UlTeid = msg.UlTeid
+	gnbue.Upf = msg.Upf
+	gnbue.Log.Infoln("Uplink tunnel updated, UL GTP-TEID:", gnbue.UlTeid,
+		"UPF Endpoint IP:", gnbue.Upf.GetIpAddr())
+}
+
 func HandleQuitEvent(gnbue *gnbctx.GnbUpUe, intfcMsg common.InterfaceMessage) (err error) {
-	userDataMsg := &common.UserDataMessage{}
-	userDataMsg.Event = common.LAST_DATA_PKT_EVENT
-	gnbue.WriteUeChan <- userDataMsg
+	// Once handed over, downlink packets of the UE are sent by the target
+	// gNB, which also ends the downlink
+	if !gnbue.HandedOver {
+		userDataMsg := &common.UserDataMessage{}
+		userDataMsg.Event = common.LAST_DATA_PKT_EVENT
+		gnbue.WriteUeChan <- userDataMsg
+	}
 	gnbue.WriteUeChan = nil
 
 	// Drain all the messages until END MARKER is received.
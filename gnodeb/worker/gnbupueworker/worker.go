@@ -36,6 +36,8 @@ func HandleEvents(gnbue *gnbctx.GnbUpUe) {
 			evt := msg.GetEventType()
 			gnbue.Log.Infoln("Handling:", evt)
 			switch evt {
+			case common.UL_TUNNEL_UPDATE_EVENT:
+				HandleUlTunnelUpdate(gnbue, msg)
 			case common.QUIT_EVENT:
 				HandleQuitEvent(gnbue, msg)
 				return
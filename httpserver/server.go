@@ -13,6 +13,7 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/omec-project/gnbsim/factory"
+	gnbrouter "github.com/omec-project/gnbsim/gnodeb/httprouter"
 	"github.com/omec-project/gnbsim/logger"
 	profilerouter "github.com/omec-project/gnbsim/profile/httprouter"
 	"github.com/omec-project/http2_util"
@@ -44,6 +45,7 @@ func StartHttpServer() (err error) {
 
 	// Register routes
 	profilerouter.AddService(router)
+	gnbrouter.AddService(router)
 
 	config := factory.AppConfig.Configuration
 	serverAddr := config.Server.IpAddr + ":" + config.Server.Port
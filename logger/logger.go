@@ -7,7 +7,9 @@
 package logger
 
 import (
+	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	formatter "github.com/antonfisher/nested-logrus-formatter"
@@ -16,7 +18,6 @@ import (
 )
 
 var (
-	log           *logrus.Logger
 	summaryLog    *logrus.Logger
 	AppLog        *logrus.Entry
 	AppSummaryLog *logrus.Entry
@@ -24,6 +25,7 @@ var (
 	SimUeLog      *logrus.Entry
 	ProfileLog    *logrus.Entry
 	GNodeBLog     *logrus.Entry
+	GnbUpLog      *logrus.Entry
 	CfgLog        *logrus.Entry
 	UtilLog       *logrus.Entry
 	GtpLog        *logrus.Entry
@@ -43,13 +45,77 @@ const (
 	FieldIp          string = "ip"
 )
 
+// Modules whose log level may be set independently of the global log level
+const (
+	MODULE_APP     string = "app"
+	MODULE_CFG     string = "cfg"
+	MODULE_GNB     string = "gnb"
+	MODULE_GTPU    string = "gtpu"
+	MODULE_HTTP    string = "http"
+	MODULE_NAS     string = "nas"
+	MODULE_NGAP    string = "ngap"
+	MODULE_PROFILE string = "profile"
+	MODULE_SIMUE   string = "simue"
+	MODULE_UTIL    string = "util"
+)
+
+var modules = []string{MODULE_APP, MODULE_CFG, MODULE_GNB, MODULE_GTPU,
+	MODULE_HTTP, MODULE_NAS, MODULE_NGAP, MODULE_PROFILE, MODULE_SIMUE,
+	MODULE_UTIL}
+
+// moduleLogger is the logger of a module, or of a module within a profile
+type moduleLogger struct {
+	module  string
+	profile string
+	logger  *logrus.Logger
+}
+
+// ProfileLogs are the logs of a profile and of its UEs, whose level may be
+// set for the profile in place of the level of their modules
+type ProfileLogs struct {
+	Profile *logrus.Entry
+	SimUe   *logrus.Entry
+	RealUe  *logrus.Entry
+}
+
+// LogLevels are the global log level and the levels which override it for
+// modules and profiles
+type LogLevels struct {
+	Global   string            `json:"global"`
+	Modules  map[string]string `json:"modules,omitempty"`
+	Profiles map[string]string `json:"profiles,omitempty"`
+}
+
+// levels holds the log levels and the loggers to which they apply. The level
+// of a logger is that of its profile if set, otherwise that of its module if
+// set, otherwise the global level
+var levels = struct {
+	sync.Mutex
+	global       logrus.Level
+	modules      map[string]logrus.Level
+	profiles     map[string]logrus.Level
+	reportCaller bool
+
+	loggers     []*moduleLogger
+	profileLogs map[string]*ProfileLogs
+}{
+	global:      logrus.InfoLevel,
+	modules:     make(map[string]logrus.Level),
+	profiles:    make(map[string]logrus.Level),
+	profileLogs: make(map[string]*ProfileLogs),
+}
+
+// Formatter and file hook shared by the loggers of the modules
+var (
+	logFormatter logrus.Formatter
+	selfLogHook  logrus.Hook
+)
+
 func init() {
-	log = logrus.New()
 	summaryLog = logrus.New()
-	log.SetReportCaller(false)
 	summaryLog.SetReportCaller(false)
 
-	log.Formatter = &formatter.Formatter{
+	logFormatter = &formatter.Formatter{
 		TimestampFormat: time.RFC3339,
 		TrimMessages:    true,
 		NoFieldsSpace:   true,
@@ -66,10 +132,10 @@ func init() {
 		FieldsOrder:     []string{"component", "category"},
 	}
 
-	selfLogHook, err := logger_util.NewFileHook("gnbsim.log",
+	hook, err := logger_util.NewFileHook("gnbsim.log",
 		os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o666)
 	if err == nil {
-		log.Hooks.Add(selfLogHook)
+		selfLogHook = hook
 	}
 
 	summaryLogHook, err := logger_util.NewFileHook("summary.log",
@@ -78,29 +144,188 @@ func init() {
 		summaryLog.Hooks.Add(summaryLogHook)
 	}
 
-	AppLog = log.WithFields(logrus.Fields{"component": "GNBSIM", "category": "App"})
+	newEntry := func(module, category string) *logrus.Entry {
+		return newModuleLogger(module, "").WithFields(
+			logrus.Fields{"component": "GNBSIM", "category": category})
+	}
+
+	AppLog = newEntry(MODULE_APP, "App")
 	AppSummaryLog = summaryLog.WithFields(logrus.Fields{"component": "GNBSIM", "category": "Summary"})
-	RealUeLog = log.WithFields(logrus.Fields{"component": "GNBSIM", "category": "RealUe"})
-	SimUeLog = log.WithFields(logrus.Fields{"component": "GNBSIM", "category": "SimUe"})
-	ProfileLog = log.WithFields(logrus.Fields{"component": "GNBSIM", "category": "Profile"})
-	GNodeBLog = log.WithFields(logrus.Fields{"component": "GNBSIM", "category": "GNodeB"})
-	GinLog = log.WithFields(logrus.Fields{"component": "GNBSIM", "category": "Gin"})
-	HttpLog = log.WithFields(logrus.Fields{"component": "GNBSIM", "category": "HTTP"})
-	CfgLog = log.WithFields(logrus.Fields{"component": "GNBSIM", "category": "CFG"})
-	UtilLog = log.WithFields(logrus.Fields{"component": "GNBSIM", "category": "Util"})
-	GtpLog = UtilLog.WithField("subcategory", "GTP")
-	NgapLog = UtilLog.WithField("subcategory", "NGAP")
+	RealUeLog = newEntry(MODULE_NAS, "RealUe")
+	SimUeLog = newEntry(MODULE_SIMUE, "SimUe")
+	ProfileLog = newEntry(MODULE_PROFILE, "Profile")
+	GNodeBLog = newEntry(MODULE_GNB, "GNodeB")
+	GnbUpLog = newEntry(MODULE_GTPU, "GNodeB")
+	httpLogger := newModuleLogger(MODULE_HTTP, "")
+	GinLog = httpLogger.WithFields(logrus.Fields{"component": "GNBSIM", "category": "Gin"})
+	HttpLog = httpLogger.WithFields(logrus.Fields{"component": "GNBSIM", "category": "HTTP"})
+	CfgLog = newEntry(MODULE_CFG, "CFG")
+	UtilLog = newEntry(MODULE_UTIL, "Util")
+	GtpLog = newEntry(MODULE_GTPU, "Util").WithField("subcategory", "GTP")
+	NgapLog = newEntry(MODULE_NGAP, "Util").WithField("subcategory", "NGAP")
 	PsuppLog = UtilLog.WithField("subcategory", "PSUPP")
 }
 
+// newModuleLogger creates a logger of the module, of the module within the
+// profile if provided. It is expected to be called with the levels locked,
+// unless called during init
+func newModuleLogger(module, profile string) *logrus.Logger {
+	l := logrus.New()
+	l.Formatter = logFormatter
+	l.SetReportCaller(levels.reportCaller)
+	if selfLogHook != nil {
+		l.Hooks.Add(selfLogHook)
+	}
+	ml := &moduleLogger{module: module, profile: profile, logger: l}
+	levels.loggers = append(levels.loggers, ml)
+	applyLevel(ml)
+	return l
+}
+
+// applyLevel sets the level of the logger, expected to be called with the
+// levels locked
+func applyLevel(ml *moduleLogger) {
+	lvl := levels.global
+	if l, ok := levels.modules[ml.module]; ok {
+		lvl = l
+	}
+	if l, ok := levels.profiles[ml.profile]; ok && ml.profile != "" {
+		lvl = l
+	}
+	ml.logger.SetLevel(lvl)
+}
+
+// applyLevels sets the level of all the loggers, expected to be called with
+// the levels locked
+func applyLevels() {
+	for _, ml := range levels.loggers {
+		applyLevel(ml)
+	}
+}
+
+// GetProfileLogs returns the logs of the profile and of its UEs
+func GetProfileLogs(profile string) *ProfileLogs {
+	levels.Lock()
+	defer levels.Unlock()
+
+	logs, ok := levels.profileLogs[profile]
+	if ok {
+		return logs
+	}
+	newEntry := func(module, category string) *logrus.Entry {
+		return newModuleLogger(module, profile).WithFields(
+			logrus.Fields{"component": "GNBSIM", "category": category})
+	}
+	logs = &ProfileLogs{
+		Profile: newEntry(MODULE_PROFILE, "Profile"),
+		SimUe:   newEntry(MODULE_SIMUE, "SimUe"),
+		RealUe:  newEntry(MODULE_NAS, "RealUe"),
+	}
+	levels.profileLogs[profile] = logs
+	return logs
+}
+
 func SetLogLevel(level string) {
-	lvl, err := logrus.ParseLevel(level)
+	err := SetGlobalLogLevel(level)
 	if err != nil {
 		AppLog.Fatalln("Failed to parse log level:", err)
 	}
-	log.SetLevel(lvl)
+}
+
+// SetGlobalLogLevel sets the level of the modules and profiles for which no
+// level is set
+func SetGlobalLogLevel(level string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	levels.Lock()
+	defer levels.Unlock()
+	levels.global = lvl
+	applyLevels()
+	return nil
+}
+
+// SetModuleLogLevel sets the log level of the module, overriding the global
+// level. The override is removed when the level is empty
+func SetModuleLogLevel(module, level string) error {
+	if !isModule(module) {
+		return fmt.Errorf("invalid log module:%v, valid modules are %v", module,
+			modules)
+	}
+	return setLevel(levels.modules, module, level)
+}
+
+// SetProfileLogLevel sets the log level of the profile and of its UEs,
+// overriding the levels of their modules. The override is removed when the
+// level is empty
+func SetProfileLogLevel(profile, level string) error {
+	if profile == "" {
+		return fmt.Errorf("profile name not provided")
+	}
+	return setLevel(levels.profiles, profile, level)
+}
+
+// ValidateLogLevel checks the log level, which may be empty
+func ValidateLogLevel(level string) error {
+	if level == "" {
+		return nil
+	}
+	_, err := logrus.ParseLevel(level)
+	return err
+}
+
+// GetLogLevels returns the log levels currently set
+func GetLogLevels() *LogLevels {
+	levels.Lock()
+	defer levels.Unlock()
+
+	result := &LogLevels{
+		Global:   levels.global.String(),
+		Modules:  make(map[string]string, len(levels.modules)),
+		Profiles: make(map[string]string, len(levels.profiles)),
+	}
+	for module, lvl := range levels.modules {
+		result.Modules[module] = lvl.String()
+	}
+	for profile, lvl := range levels.profiles {
+		result.Profiles[profile] = lvl.String()
+	}
+	return result
+}
+
+// setLevel sets or removes the level keyed in the overrides
+func setLevel(overrides map[string]logrus.Level, key, level string) error {
+	levels.Lock()
+	defer levels.Unlock()
+
+	if level == "" {
+		delete(overrides, key)
+	} else {
+		lvl, err := logrus.ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		overrides[key] = lvl
+	}
+	applyLevels()
+	return nil
+}
+
+func isModule(module string) bool {
+	for _, m := range modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
 }
 
 func SetReportCaller(set bool) {
-	log.SetReportCaller(set)
+	levels.Lock()
+	defer levels.Unlock()
+	levels.reportCaller = set
+	for _, ml := range levels.loggers {
+		ml.logger.SetReportCaller(set)
+	}
 }
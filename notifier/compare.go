@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notifier
+
+import "sort"
+
+// Default thresholds, in percent, beyond which the latency increase or the
+// throughput decrease is reported as a regression
+const (
+	DEFAULT_LATENCY_THRESHOLD    float64 = 10
+	DEFAULT_THROUGHPUT_THRESHOLD float64 = 10
+)
+
+// ProfileComparison is the comparison of the results of a profile across two
+// runs
+type ProfileComparison struct {
+	ProfileName string
+
+	// Profile executed in the baseline run but not in the current run
+	Missing bool
+
+	BaselineResult string
+	CurrentResult  string
+
+	// SUPIs which failed in the current run but not in the baseline run, and
+	// those which no longer fail
+	NewlyFailed []string
+	NewlyPassed []string
+
+	Stages     []StageDelta
+	Throughput []ThroughputDelta
+
+	Regressed bool
+}
+
+// StageDelta is the change in the average time taken to complete a procedure.
+// Times are in microseconds
+type StageDelta struct {
+	Procedure string
+	Baseline  int64
+	Current   int64
+	Change    float64
+	Regressed bool
+}
+
+// ThroughputDelta is the change in the UL or DL throughput, in bits per
+// second
+type ThroughputDelta struct {
+	Direction string
+	Baseline  float64
+	Current   float64
+	Change    float64
+	Regressed bool
+}
+
+// CompareRunResults compares the results of the current run against those of
+// the baseline run, profile by profile. A profile regresses if it is not
+// executed or fails in the current run, if any UE newly fails, or if the time
+// taken by a procedure increases or the throughput decreases beyond the
+// thresholds (in percent)
+func CompareRunResults(baseline, current *RunResult, latencyThreshold,
+	throughputThreshold float64) []*ProfileComparison {
+
+	currentProfiles := make(map[string]*ProfileSummary)
+	for _, profile := range current.Profiles {
+		currentProfiles[profile.ProfileName] = profile
+	}
+
+	var comparisons []*ProfileComparison
+	for _, base := range baseline.Profiles {
+		cmp := &ProfileComparison{
+			ProfileName:    base.ProfileName,
+			BaselineResult: base.Result,
+		}
+		comparisons = append(comparisons, cmp)
+
+		cur, ok := currentProfiles[base.ProfileName]
+		if !ok {
+			cmp.Missing = true
+			cmp.Regressed = true
+			continue
+		}
+		cmp.CurrentResult = cur.Result
+		if base.Result == RESULT_PASS && cur.Result != RESULT_PASS {
+			cmp.Regressed = true
+		}
+
+		compareUeResults(cmp, base, cur)
+		compareStages(cmp, base, cur, latencyThreshold)
+		compareThroughput(cmp, base, cur, throughputThreshold)
+	}
+	return comparisons
+}
+
+func compareUeResults(cmp *ProfileComparison, base, cur *ProfileSummary) {
+	baseResults := make(map[string]string)
+	for _, ueResult := range base.UeResults {
+		baseResults[ueResult.Supi] = ueResult.Result
+	}
+
+	for _, ueResult := range cur.UeResults {
+		baseResult, ok := baseResults[ueResult.Supi]
+		switch {
+		case ueResult.Result == RESULT_FAIL && baseResult != RESULT_FAIL:
+			cmp.NewlyFailed = append(cmp.NewlyFailed, ueResult.Supi)
+		case ok && ueResult.Result == RESULT_PASS && baseResult == RESULT_FAIL:
+			cmp.NewlyPassed = append(cmp.NewlyPassed, ueResult.Supi)
+		}
+	}
+	sort.Strings(cmp.NewlyFailed)
+	sort.Strings(cmp.NewlyPassed)
+	if len(cmp.NewlyFailed) != 0 {
+		cmp.Regressed = true
+	}
+}
+
+func compareStages(cmp *ProfileComparison, base, cur *ProfileSummary,
+	threshold float64) {
+
+	curStages := make(map[string]Stage)
+	for _, stage := range cur.Stages {
+		curStages[stage.Procedure] = stage
+	}
+
+	for _, stage := range base.Stages {
+		curStage, ok := curStages[stage.Procedure]
+		if !ok {
+			continue
+		}
+		delta := StageDelta{
+			Procedure: stage.Procedure,
+			Baseline:  stage.Avg,
+			Current:   curStage.Avg,
+			Change:    getChange(float64(stage.Avg), float64(curStage.Avg)),
+		}
+		if delta.Change > threshold {
+			delta.Regressed = true
+			cmp.Regressed = true
+		}
+		cmp.Stages = append(cmp.Stages, delta)
+	}
+}
+
+func compareThroughput(cmp *ProfileComparison, base, cur *ProfileSummary,
+	threshold float64) {
+
+	if base.DataPlane == nil || cur.DataPlane == nil {
+		return
+	}
+
+	deltas := []ThroughputDelta{
+		{
+			Direction: "UL",
+			Baseline:  base.DataPlane.UlThroughput,
+			Current:   cur.DataPlane.UlThroughput,
+		},
+		{
+			Direction: "DL",
+			Baseline:  base.DataPlane.DlThroughput,
+			Current:   cur.DataPlane.DlThroughput,
+		},
+	}
+	for _, delta := range deltas {
+		delta.Change = getChange(delta.Baseline, delta.Current)
+		if -delta.Change > threshold {
+			delta.Regressed = true
+			cmp.Regressed = true
+		}
+		cmp.Throughput = append(cmp.Throughput, delta)
+	}
+}
+
+// getChange returns the change from the baseline value in percent, 0 when the
+// baseline value is 0
+func getChange(baseline, current float64) float64 {
+	if baseline == 0 {
+		return 0
+	}
+	return (current - baseline) * 100 / baseline
+}
@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notifier
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/factory"
+)
+
+// Columns of the CSV file preceding the time taken by each procedure
+var csvColumns = []string{"imsi", "profile", "result", "procedure", "error",
+	"duration_ms", "retries", "tags", "ul_bytes", "dl_bytes"}
+
+// csvRow is the result of a UE written to the CSV file
+type csvRow struct {
+	profile string
+	result  common.UeResult
+}
+
+var (
+	csvLock sync.Mutex
+	csvRows []csvRow
+
+	// Procedures executed by the UEs, in the order in which they were first
+	// seen. Each has a column giving the time it took
+	csvProcedures []string
+)
+
+// WriteResultCsv adds the results of the UEs of the completed profile to the
+// results of the run and rewrites the configured CSV file, with one row per
+// UE. Each procedure executed has a column giving the time it took in
+// milliseconds, summed up if executed more than once by a UE. It is a no-op
+// when the CSV file is not configured
+func WriteResultCsv(msg *common.SummaryMessage) error {
+	path := factory.AppConfig.Configuration.ResultCsvFile
+	if path == "" {
+		return nil
+	}
+
+	csvLock.Lock()
+	defer csvLock.Unlock()
+
+	for _, result := range msg.UeResults {
+		csvRows = append(csvRows, csvRow{profile: msg.ProfileName, result: result})
+		for _, t := range result.StageTimes {
+			addCsvProcedure(t.Procedure.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := append(append([]string{}, csvColumns...), csvProcedures...)
+	for i := len(csvColumns); i < len(header); i++ {
+		header[i] += "_ms"
+	}
+	err := w.Write(header)
+	if err != nil {
+		return fmt.Errorf("failed to encode csv file: %v", err)
+	}
+	for _, row := range csvRows {
+		err = w.Write(getCsvRecord(row))
+		if err != nil {
+			return fmt.Errorf("failed to encode csv file: %v", err)
+		}
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return fmt.Errorf("failed to encode csv file: %v", err)
+	}
+
+	// File is replaced at once so that it is never read partially written
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write csv file: %v", err)
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return fmt.Errorf("failed to write csv file: %v", err)
+	}
+	return nil
+}
+
+// addCsvProcedure adds a column for the procedure, unless already added
+func addCsvProcedure(procedure string) {
+	for _, p := range csvProcedures {
+		if p == procedure {
+			return
+		}
+	}
+	csvProcedures = append(csvProcedures, procedure)
+}
+
+// getCsvRecord returns the fields of the row, in the order of the columns
+func getCsvRecord(row csvRow) []string {
+	r := row.result
+	status, errStr := RESULT_PASS, ""
+	if r.Error != nil {
+		status, errStr = RESULT_FAIL, r.Error.Error()
+	}
+	var ulBytes, dlBytes uint64
+	if r.DataStats != nil {
+		ulBytes, dlBytes = r.DataStats.UlBytes, r.DataStats.DlBytes
+	}
+
+	record := []string{
+		strings.TrimPrefix(r.Supi, "imsi-"),
+		row.profile,
+		status,
+		r.Procedure,
+		errStr,
+		strconv.FormatInt(r.Duration.Milliseconds(), 10),
+		strconv.FormatUint(uint64(r.Retries), 10),
+		strings.Join(r.Tags, ";"),
+		strconv.FormatUint(ulBytes, 10),
+		strconv.FormatUint(dlBytes, 10),
+	}
+
+	times := make(map[string]time.Duration, len(r.StageTimes))
+	for _, t := range r.StageTimes {
+		times[t.Procedure.String()] += t.Duration
+	}
+	for _, procedure := range csvProcedures {
+		field := ""
+		if d, ok := times[procedure]; ok {
+			field = strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+		}
+		record = append(record, field)
+	}
+	return record
+}
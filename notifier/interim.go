@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notifier
+
+import (
+	"time"
+
+	"github.com/omec-project/gnbsim/factory"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+)
+
+// Event of the interim summaries posted to the webhook, distinguishing them
+// from the profile summaries
+const INTERIM_SUMMARY_EVENT string = "interimSummary"
+
+// Number of the latest interim summaries kept in the result file, so that the
+// file and the time taken to rewrite it do not grow with the length of soaks
+const MAX_INTERIM_SUMMARIES int = 100
+
+// InterimSummary is the JSON form of the results accumulated so far by the
+// enabled profiles, reported periodically during long running soaks. Interval
+// is in seconds
+type InterimSummary struct {
+	Event    string           `json:"event"`
+	Time     time.Time        `json:"time"`
+	Interval uint32           `json:"interval"`
+	Gnbs     []InterimGnb     `json:"gnbs,omitempty"`
+	Profiles []InterimProfile `json:"profiles,omitempty"`
+}
+
+// InterimGnb is the NGAP message rate achieved by a gNB since the previous
+// interim summary, in messages per second, and the health of its N2
+// associations
+type InterimGnb struct {
+	Name               string                 `json:"name"`
+	NgapSentCount      uint64                 `json:"ngapSentCount"`
+	IntvlNgapSentCount uint64                 `json:"intvlNgapSentCount"`
+	IntvlNgapRate      float64                `json:"intvlNgapRate"`
+	N2                 []*gnbctx.N2HealthDump `json:"n2,omitempty"`
+}
+
+// InterimProfile is the result of a profile so far, along with the result of
+// the UEs completed since the previous interim summary. Latencies are in
+// milliseconds
+type InterimProfile struct {
+	ProfileName      string  `json:"profileName"`
+	ProfileType      string  `json:"profileType"`
+	UePassedCount    uint    `json:"uePassedCount"`
+	UeFailedCount    uint    `json:"ueFailedCount"`
+	IntvlPassedCount uint    `json:"intvlPassedCount"`
+	IntvlFailedCount uint    `json:"intvlFailedCount"`
+	IntvlSuccessRate float64 `json:"intvlSuccessRate"`
+	IntvlLatencyP50  int64   `json:"intvlLatencyP50,omitempty"`
+	IntvlLatencyP90  int64   `json:"intvlLatencyP90,omitempty"`
+	IntvlLatencyP99  int64   `json:"intvlLatencyP99,omitempty"`
+	Tags             []Tag   `json:"tags,omitempty"`
+}
+
+// NotifyInterimSummary posts the interim summary to the configured webhook.
+// It is a no-op when the webhook is not configured or does not receive the
+// interim summaries
+func NotifyInterimSummary(summary *InterimSummary) error {
+	webhook := factory.AppConfig.Configuration.Webhook
+	if webhook == nil || !webhook.InterimSummaries {
+		return nil
+	}
+	return postToWebhook(webhook, summary, "interim summary")
+}
+
+// WriteInterimSummary adds the interim summary to the results of the run and
+// rewrites the configured result file, so that the file reflects the progress
+// of the run even if the application terminates before the profiles are
+// complete. Only the latest MAX_INTERIM_SUMMARIES are kept. It is a no-op
+// when the result file is not configured
+func WriteInterimSummary(summary *InterimSummary) error {
+	path := factory.AppConfig.Configuration.ResultFile
+	if path == "" {
+		return nil
+	}
+
+	runResultLock.Lock()
+	defer runResultLock.Unlock()
+
+	if len(runResult.Interim) == MAX_INTERIM_SUMMARIES {
+		copy(runResult.Interim, runResult.Interim[1:])
+		runResult.Interim = runResult.Interim[:MAX_INTERIM_SUMMARIES-1]
+	}
+	runResult.Interim = append(runResult.Interim, summary)
+	return writeRunResult(path)
+}
@@ -0,0 +1,276 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/factory"
+)
+
+// Result of a profile or of a UE as reported to the webhook
+const (
+	RESULT_PASS string = "PASS"
+	RESULT_FAIL string = "FAIL"
+)
+
+// ProfileSummary is the JSON body posted to the webhook once a profile is
+// complete
+type ProfileSummary struct {
+	ProfileName   string     `json:"profileName"`
+	ProfileType   string     `json:"profileType"`
+	Result        string     `json:"result"`
+	UePassedCount uint       `json:"uePassedCount"`
+	UeFailedCount uint       `json:"ueFailedCount"`
+	Errors        []string   `json:"errors,omitempty"`
+	StartTime     time.Time  `json:"startTime"`
+	EndTime       time.Time  `json:"endTime"`
+	UeResults     []UeResult `json:"ueResults,omitempty"`
+	DataPlane     *DataPlane `json:"dataPlane,omitempty"`
+
+	// PDU sessions modified and released by the network outside of the
+	// procedures of the profile
+	NwPduSessMods uint `json:"nwPduSessMods,omitempty"`
+	NwPduSessRels uint `json:"nwPduSessRels,omitempty"`
+
+	// Failed procedures retried by the UEs
+	Retries uint `json:"retries,omitempty"`
+
+	Stages []Stage `json:"stages,omitempty"`
+
+	LoadStages []LoadStage `json:"loadStages,omitempty"`
+
+	Tags []Tag `json:"tags,omitempty"`
+}
+
+// Tag is the result of the UEs carrying a tag. Latencies are in milliseconds
+type Tag struct {
+	Name          string `json:"name"`
+	UePassedCount uint   `json:"uePassedCount"`
+	UeFailedCount uint   `json:"ueFailedCount"`
+	AvgLatency    int64  `json:"avgLatency"`
+	MaxLatency    int64  `json:"maxLatency"`
+}
+
+// LoadStage is the result of the UEs started during a stage of the load
+// schedule. Duration and latencies are in milliseconds
+type LoadStage struct {
+	Name           string `json:"name"`
+	Duration       int64  `json:"duration"`
+	UeStartedCount uint   `json:"ueStartedCount"`
+	UePassedCount  uint   `json:"uePassedCount"`
+	UeFailedCount  uint   `json:"ueFailedCount"`
+	UeSkippedCount uint   `json:"ueSkippedCount"`
+	MaxActiveUes   uint   `json:"maxActiveUes"`
+	AvgLatency     int64  `json:"avgLatency"`
+	MaxLatency     int64  `json:"maxLatency"`
+}
+
+// Stage is the time taken to complete a procedure across the UEs of the
+// profile. Times are in microseconds
+type Stage struct {
+	Procedure string `json:"procedure"`
+	Count     uint   `json:"count"`
+	Min       int64  `json:"min"`
+	Avg       int64  `json:"avg"`
+	Max       int64  `json:"max"`
+}
+
+// DataPlane are the user plane KPIs of the profile or of a UE. Throughput is
+// in bits per second, RTTs and jitter are in microseconds
+type DataPlane struct {
+	UlPackets    uint64  `json:"ulPackets"`
+	UlBytes      uint64  `json:"ulBytes"`
+	DlPackets    uint64  `json:"dlPackets"`
+	DlBytes      uint64  `json:"dlBytes"`
+	UlThroughput float64 `json:"ulThroughput"`
+	DlThroughput float64 `json:"dlThroughput"`
+	RttP50       int64   `json:"rttP50,omitempty"`
+	RttP90       int64   `json:"rttP90,omitempty"`
+	RttP99       int64   `json:"rttP99,omitempty"`
+	Jitter       int64   `json:"jitter,omitempty"`
+}
+
+// UeResult is the result of a single UE, included in ProfileSummary when
+// requested. Duration is in milliseconds
+type UeResult struct {
+	Supi     string `json:"supi"`
+	Result   string `json:"result"`
+	Error    string `json:"error,omitempty"`
+	Duration int64  `json:"duration"`
+	Retries  uint   `json:"retries,omitempty"`
+
+	// Tags of the UE, by which the results may be filtered
+	Tags []string `json:"tags,omitempty"`
+
+	// Procedure failed by the UE
+	Procedure string `json:"procedure,omitempty"`
+
+	DataPlane *DataPlane `json:"dataPlane,omitempty"`
+}
+
+// NotifyProfileSummary posts the summary of the completed profile to the
+// configured webhook. It is a no-op when the webhook is not configured
+func NotifyProfileSummary(msg *common.SummaryMessage) error {
+	webhook := factory.AppConfig.Configuration.Webhook
+	if webhook == nil {
+		return nil
+	}
+
+	summary := GetProfileSummary(msg)
+	if !webhook.IncludeUeResults {
+		// Collected for the result file only
+		summary.UeResults = nil
+	}
+	return postToWebhook(webhook, summary, "profile summary")
+}
+
+// postToWebhook posts the JSON form of the summary to the webhook, desc
+// describing the summary in the errors
+func postToWebhook(webhook *factory.Webhook, summary interface{}, desc string) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to encode %v: %v", desc, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range webhook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	timeout := webhook.Timeout
+	if timeout == 0 {
+		timeout = factory.DEFAULT_WEBHOOK_TIMEOUT
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post %v: %v", desc, err)
+	}
+	defer rsp.Body.Close()
+
+	// Response body is drained so that the connection may be reused
+	_, _ = io.Copy(ioutil.Discard, rsp.Body)
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status: %v", rsp.Status)
+	}
+	return nil
+}
+
+// GetProfileSummary converts the summary of the completed profile to its JSON
+// form
+func GetProfileSummary(msg *common.SummaryMessage) *ProfileSummary {
+	summary := &ProfileSummary{
+		ProfileName:   msg.ProfileName,
+		ProfileType:   msg.ProfileType,
+		Result:        RESULT_PASS,
+		UePassedCount: msg.UePassedCount,
+		UeFailedCount: msg.UeFailedCount,
+		StartTime:     msg.StartTime,
+		EndTime:       msg.EndTime,
+		NwPduSessMods: msg.NwPduSessMods,
+		NwPduSessRels: msg.NwPduSessRels,
+		Retries:       msg.Retries,
+	}
+	if len(msg.ErrorList) != 0 {
+		summary.Result = RESULT_FAIL
+		for _, err := range msg.ErrorList {
+			summary.Errors = append(summary.Errors, err.Error())
+		}
+	}
+
+	if dp := msg.DataPlane; dp != nil {
+		summary.DataPlane = &DataPlane{
+			UlPackets:    dp.UlPkts,
+			UlBytes:      dp.UlBytes,
+			DlPackets:    dp.DlPkts,
+			DlBytes:      dp.DlBytes,
+			UlThroughput: dp.UlThroughput,
+			DlThroughput: dp.DlThroughput,
+			RttP50:       dp.RttP50.Microseconds(),
+			RttP90:       dp.RttP90.Microseconds(),
+			RttP99:       dp.RttP99.Microseconds(),
+			Jitter:       dp.Jitter.Microseconds(),
+		}
+	}
+
+	for _, stage := range msg.StageTimings {
+		summary.Stages = append(summary.Stages, Stage{
+			Procedure: stage.Procedure,
+			Count:     stage.Count,
+			Min:       stage.Min.Microseconds(),
+			Avg:       stage.Avg.Microseconds(),
+			Max:       stage.Max.Microseconds(),
+		})
+	}
+
+	for _, stage := range msg.LoadStages {
+		summary.LoadStages = append(summary.LoadStages, LoadStage{
+			Name:           stage.Name,
+			Duration:       stage.Duration.Milliseconds(),
+			UeStartedCount: stage.UeStartedCount,
+			UePassedCount:  stage.UePassedCount,
+			UeFailedCount:  stage.UeFailedCount,
+			UeSkippedCount: stage.UeSkippedCount,
+			MaxActiveUes:   stage.MaxActiveUes,
+			AvgLatency:     stage.AvgLatency.Milliseconds(),
+			MaxLatency:     stage.MaxLatency.Milliseconds(),
+		})
+	}
+
+	for _, tag := range msg.Tags {
+		summary.Tags = append(summary.Tags, Tag{
+			Name:          tag.Tag,
+			UePassedCount: tag.UePassedCount,
+			UeFailedCount: tag.UeFailedCount,
+			AvgLatency:    tag.AvgLatency.Milliseconds(),
+			MaxLatency:    tag.MaxLatency.Milliseconds(),
+		})
+	}
+
+	for _, ueResult := range msg.UeResults {
+		result := UeResult{
+			Supi:      ueResult.Supi,
+			Result:    RESULT_PASS,
+			Duration:  ueResult.Duration.Milliseconds(),
+			Retries:   ueResult.Retries,
+			Tags:      ueResult.Tags,
+			Procedure: ueResult.Procedure,
+		}
+		if ueResult.Error != nil {
+			result.Result = RESULT_FAIL
+			result.Error = ueResult.Error.Error()
+		}
+		if s := ueResult.DataStats; s != nil {
+			ul, dl := s.GetThroughput()
+			rtts := s.GetRttPercentiles(50, 90, 99)
+			result.DataPlane = &DataPlane{
+				UlPackets:    s.UlPkts,
+				UlBytes:      s.UlBytes,
+				DlPackets:    s.DlPkts,
+				DlBytes:      s.DlBytes,
+				UlThroughput: ul,
+				DlThroughput: dl,
+				RttP50:       rtts[0].Microseconds(),
+				RttP90:       rtts[1].Microseconds(),
+				RttP99:       rtts[2].Microseconds(),
+				Jitter:       s.Jitter.Microseconds(),
+			}
+		}
+		summary.UeResults = append(summary.UeResults, result)
+	}
+	return summary
+}
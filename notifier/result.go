@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/factory"
+)
+
+// RunResult is the content of the result file of a run, holding the summary
+// of each profile in the order in which the profiles completed, and the
+// latest interim summaries reported so far
+type RunResult struct {
+	StartTime time.Time         `json:"startTime"`
+	Profiles  []*ProfileSummary `json:"profiles"`
+	Interim   []*InterimSummary `json:"interimSummaries,omitempty"`
+}
+
+var (
+	runResultLock sync.Mutex
+	runResult     = &RunResult{StartTime: time.Now()}
+)
+
+// WriteResultFile adds the summary of the completed profile to the results of
+// the run and rewrites the configured result file, so that the file holds the
+// results of the profiles completed so far. It is a no-op when the result
+// file is not configured
+func WriteResultFile(msg *common.SummaryMessage) error {
+	path := factory.AppConfig.Configuration.ResultFile
+	if path == "" {
+		return nil
+	}
+
+	runResultLock.Lock()
+	defer runResultLock.Unlock()
+
+	runResult.Profiles = append(runResult.Profiles, GetProfileSummary(msg))
+	return writeRunResult(path)
+}
+
+// writeRunResult rewrites the result file with the results of the run,
+// expected to be called with runResultLock held
+func writeRunResult(path string) error {
+	body, err := json.MarshalIndent(runResult, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run result: %v", err)
+	}
+
+	// File is replaced at once so that it is never read partially written
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, body, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write result file: %v", err)
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return fmt.Errorf("failed to write result file: %v", err)
+	}
+	return nil
+}
+
+// ReadResultFile reads the result file of a run
+func ReadResultFile(path string) (*RunResult, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read result file: %v", err)
+	}
+
+	result := &RunResult{}
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode result file %v: %v", path, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/util/test"
+)
+
+// Events on which the UE may abort the ongoing registration with a
+// Deregistration Request
+var deregOnEvents = []common.EventType{
+	common.AUTH_REQUEST_EVENT,
+	common.SEC_MOD_COMMAND_EVENT,
+	common.REG_ACCEPT_EVENT,
+}
+
+// AbnormalBehaviour makes the UE deviate from the expected NAS signalling, to
+// test the handling of abnormal UE behaviour by the AMF. The profile is
+// complete for a UE once it has deviated
+type AbnormalBehaviour struct {
+	// 5GMM cause with which the Security Mode Command is rejected. Refer
+	// test.GetCause5GMM() for the supported cause names
+	SecModRejectCause string `yaml:"secModRejectCause" json:"secModRejectCause"`
+
+	// Registration Accept is not acknowledged with Registration Complete
+	OmitRegComplete bool `yaml:"omitRegComplete" json:"omitRegComplete"`
+
+	// Event on which a Deregistration Request is sent instead of the
+	// expected response, one of AUTHENTICATION-REQUEST-EVENT,
+	// SECURITY-MODE-COMMAND-EVENT or REGESTRATION-ACCEPT-EVENT
+	DeregOnEvent string `yaml:"deregOnEvent" json:"deregOnEvent"`
+}
+
+// GetSecModRejectCause returns the 5GMM cause with which the Security Mode
+// Command is rejected, 0 if not configured
+func (a *AbnormalBehaviour) GetSecModRejectCause() (uint8, error) {
+	if a.SecModRejectCause == "" {
+		return 0, nil
+	}
+	return test.GetCause5GMM(a.SecModRejectCause)
+}
+
+// GetDeregOnEvent returns the event on which the Deregistration Request is
+// sent, 0 if not configured
+func (a *AbnormalBehaviour) GetDeregOnEvent() (common.EventType, error) {
+	if a.DeregOnEvent == "" {
+		return 0, nil
+	}
+	event, err := common.GetEventType(a.DeregOnEvent)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range deregOnEvents {
+		if e == event {
+			return event, nil
+		}
+	}
+	return 0, fmt.Errorf("deregistration not supported on event:%v",
+		a.DeregOnEvent)
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/omec-project/gnbsim/common"
+)
+
+// CallFlowConfig records the NAS and NGAP message sequence of a passing UE
+// run into a file, or verifies the message sequence of each UE of the profile
+// against the recorded one, for fast regression detection of the core. The
+// UEs run with their own identities and keys, only the message names are
+// compared. The recorded sequence is not replayed: the UEs are driven by the
+// profile as in any other run, which is expected to send the same sequence
+type CallFlowConfig struct {
+	// File in which the call flow of the first passing UE is recorded
+	Record string `yaml:"record" json:"record"`
+
+	// File of the recorded call flow. The UEs whose call flow differs from
+	// it fail with a diff of the first mismatching messages
+	Verify string `yaml:"verify" json:"verify"`
+
+	// Call flow loaded from the verify file
+	expected *common.CallFlow
+
+	mu       sync.Mutex
+	recorded bool
+}
+
+// Validate checks the call flow configuration and loads the verify file
+func (c *CallFlowConfig) Validate() error {
+	switch {
+	case c.Record == "" && c.Verify == "":
+		return fmt.Errorf("call flow record or verify file not configured")
+	case c.Record != "" && c.Verify != "":
+		return fmt.Errorf("call flow record and verify are mutually exclusive")
+	case c.Verify == "" || c.expected != nil:
+		return nil
+	}
+
+	expected, err := common.ReadCallFlow(c.Verify)
+	if err != nil {
+		return err
+	}
+	c.expected = expected
+	return nil
+}
+
+// GetExpected returns the call flow loaded from the verify file, nil in the
+// record mode
+func (c *CallFlowConfig) GetExpected() *common.CallFlow {
+	return c.expected
+}
+
+// ClaimRecord returns true once, for the first passing UE whose call flow is
+// to be recorded
+func (c *CallFlowConfig) ClaimRecord() bool {
+	if c.Record == "" {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.recorded {
+		return false
+	}
+	c.recorded = true
+	return true
+}
+
+// ReleaseRecord releases the claim of a UE which failed to record its call
+// flow, so that the call flow of the next passing UE is recorded instead
+func (c *CallFlowConfig) ReleaseRecord() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recorded = false
+}
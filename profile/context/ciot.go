@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+)
+
+// CiotConfig makes the UE behave as a CIoT capable UE, such as an NB-IoT
+// device. The CIoT 5GS optimizations supported by the UE are indicated in the
+// 5GMM capability of the Registration Request, TS 24.501 Section 9.11.3.1
+type CiotConfig struct {
+	// Control plane CIoT 5GS optimization (5G-CP CIoT), user data carried
+	// over NAS
+	ControlPlane bool `yaml:"controlPlane" json:"controlPlane"`
+
+	// IP header compression for control plane CIoT 5GS optimization
+	// (5G-IPHC-CP CIoT)
+	HeaderCompression bool `yaml:"headerCompression" json:"headerCompression"`
+
+	// N3 data transfer, user plane resources may be established even though
+	// control plane CIoT 5GS optimization is used
+	N3Data bool `yaml:"n3Data" json:"n3Data"`
+
+	// Restriction on use of enhanced coverage (RestrictEC)
+	RestrictEc bool `yaml:"restrictEc" json:"restrictEc"`
+
+	// User data of the PDU session to the DNN of the profile is carried in
+	// the CIoT user data container of the UL and DL NAS Transport instead
+	// of GTP-U. The network is expected to establish the PDU session as
+	// control plane only
+	DataOverNas bool `yaml:"dataOverNas" json:"dataOverNas"`
+}
+
+// Validate checks the CIoT configuration
+func (c *CiotConfig) Validate() error {
+	if c.HeaderCompression && !c.ControlPlane {
+		return fmt.Errorf("header compression requires control plane ciot optimization")
+	}
+	if c.N3Data && !c.ControlPlane {
+		return fmt.Errorf("n3 data transfer requires control plane ciot optimization")
+	}
+	if c.DataOverNas && !c.ControlPlane {
+		return fmt.Errorf("data over nas requires control plane ciot optimization")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+)
+
+// DataPlaneCollector aggregates the user plane KPIs reported by the UEs of a
+// profile
+type DataPlaneCollector struct {
+	lock    sync.Mutex
+	ueCount int
+	total   common.DataPlaneStats
+}
+
+// Record adds the user plane KPIs of a UE
+func (c *DataPlaneCollector) Record(stats *common.DataPlaneStats) {
+	if stats == nil || stats.UlPkts == 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ueCount++
+	c.total.Merge(stats)
+}
+
+// Summary returns the aggregated user plane KPIs, throughput being computed
+// over the provided duration of the profile. Returns nil if none of the UEs
+// generated user data
+func (c *DataPlaneCollector) Summary(duration time.Duration) *common.DataPlaneSummary {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.ueCount == 0 {
+		return nil
+	}
+	summary := &common.DataPlaneSummary{
+		UeCount: c.ueCount,
+		UlPkts:  c.total.UlPkts,
+		UlBytes: c.total.UlBytes,
+		DlPkts:  c.total.DlPkts,
+		DlBytes: c.total.DlBytes,
+		Jitter:  c.total.Jitter,
+	}
+	if duration > 0 {
+		secs := duration.Seconds()
+		summary.UlThroughput = float64(c.total.UlBytes) * 8 / secs
+		summary.DlThroughput = float64(c.total.DlBytes) * 8 / secs
+	}
+
+	rtts := c.total.GetRttPercentiles(50, 90, 99)
+	summary.RttP50, summary.RttP90, summary.RttP99 = rtts[0], rtts[1], rtts[2]
+	return summary
+}
@@ -0,0 +1,301 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Function of the Lua script of the event hook called on the events
+const LUA_HOOK_FUNCTION string = "on_event"
+
+// Default time allowed for the hook to decide on an event, in seconds
+const DEFAULT_HOOK_TIMEOUT int = 5
+
+// Actions which the hook may decide on an event
+const (
+	HOOK_ACTION_CONTINUE   string = "continue"
+	HOOK_ACTION_SKIP       string = "skip"
+	HOOK_ACTION_DEREGISTER string = "deregister"
+	HOOK_ACTION_COMPLETE   string = "complete"
+	HOOK_ACTION_FAIL       string = "fail"
+)
+
+// EventHook decides the action of the UEs on the configured events, so that
+// custom scenarios are scripted without modifying the procedures of gnbsim.
+// The hook is either an in-process handler registered by name or an embedded
+// Lua script, both of which may inspect and modify the message of the event,
+// or an external script. The external script is started once for the profile
+// and serves all the UEs: it reads one event per line as a JSON object on
+// stdin, and writes the action to be taken as a JSON object on one line of
+// stdout, carrying the id of the event, e.g. {"id": 7, "action":
+// "deregister"}. The events of the UEs are written as they occur, the script
+// may respond to them in any order. The action is one of "continue"
+// (default, the event is handled as usual), "skip" (the event is dropped),
+// "deregister" (the ongoing procedure is aborted with a Deregistration
+// Request), "complete" (the profile is complete for the UE) or "fail" (the
+// UE fails with the provided reason). The UE waits for the decision, hence
+// the hook is expected to decide promptly
+type EventHook struct {
+	// Name of the in-process handler, exclusive with Command and Lua
+	Handler string `yaml:"handler" json:"handler"`
+
+	// Lua script embedded in gnbsim, exclusive with Handler and Command. The
+	// script defines the on_event(req, msg) function, called with the event
+	// and the message of the event, which it may modify, and returning the
+	// action and the reason. Each UE runs the script in its own Lua state
+	Lua string `yaml:"lua" json:"lua"`
+
+	// Script and its arguments
+	Command string   `yaml:"command" json:"command"`
+	Args    []string `yaml:"args" json:"args"`
+
+	// Events on which the script is run
+	Events []string `yaml:"events" json:"events"`
+
+	// Time allowed for the script to decide on an event in seconds,
+	// DEFAULT_HOOK_TIMEOUT if not configured. The UE fails if the script does
+	// not decide in time, a late response is discarded
+	Timeout int `yaml:"timeout" json:"timeout"`
+
+	events map[common.EventType]bool
+
+	// Lua script compiled once, loaded into the Lua state of each UE
+	luaProto *lua.FunctionProto
+
+	// Script process, started on the first event. Its responses are routed
+	// by id to the UEs waiting for them in pending, whose channels are closed
+	// when the process exits
+	lock    sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	pending map[uint64]chan []byte
+	lastId  uint64
+}
+
+// Validate checks the handler, the command or the Lua script, which is
+// compiled, and the events, which are saved for lookup. The handler name is
+// checked against the registered handlers by the profile validation
+func (h *EventHook) Validate() error {
+	configured := 0
+	for _, hook := range []string{h.Handler, h.Command, h.Lua} {
+		if hook != "" {
+			configured++
+		}
+	}
+	switch {
+	case configured == 0:
+		return fmt.Errorf("event hook handler, command or lua not configured")
+	case configured > 1:
+		return fmt.Errorf("event hook handler, command and lua are mutually exclusive")
+	case h.Command != "":
+		if _, err := exec.LookPath(h.Command); err != nil {
+			return fmt.Errorf("invalid event hook command:%v", err)
+		}
+	case h.Lua != "" && h.luaProto == nil:
+		proto, err := compileLua(h.Lua)
+		if err != nil {
+			return err
+		}
+		h.luaProto = proto
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("invalid event hook timeout:%v", h.Timeout)
+	}
+	if len(h.Events) == 0 {
+		return fmt.Errorf("event hook events not configured")
+	}
+
+	h.events = make(map[common.EventType]bool)
+	for _, name := range h.Events {
+		event, err := common.GetEventType(name)
+		if err != nil {
+			return err
+		}
+		if event == common.ERROR_EVENT || event == common.QUIT_EVENT {
+			return fmt.Errorf("event hook not supported on event:%v", name)
+		}
+		h.events[event] = true
+	}
+	return nil
+}
+
+// compileLua parses and compiles the Lua script of the event hook
+func compileLua(path string) (*lua.FunctionProto, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event hook lua script:%v", err)
+	}
+	defer file.Close()
+
+	chunk, err := parse.Parse(bufio.NewReader(file), path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event hook lua script:%v", err)
+	}
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event hook lua script:%v", err)
+	}
+	return proto, nil
+}
+
+// GetLuaProto returns the compiled Lua script, nil if not configured
+func (h *EventHook) GetLuaProto() *lua.FunctionProto {
+	return h.luaProto
+}
+
+// HasEvent returns true if the script is run on the event
+func (h *EventHook) HasEvent(event common.EventType) bool {
+	return h.events[event]
+}
+
+// GetTimeout returns the time allowed for the script
+func (h *EventHook) GetTimeout() time.Duration {
+	if h.Timeout == 0 {
+		return time.Duration(DEFAULT_HOOK_TIMEOUT) * time.Second
+	}
+	return time.Duration(h.Timeout) * time.Second
+}
+
+// NextRequestId returns the id of the next request to the script, by which
+// its response is matched
+func (h *EventHook) NextRequestId() uint64 {
+	return atomic.AddUint64(&h.lastId, 1)
+}
+
+// RunScript writes the JSON encoded request carrying the id on a line to the
+// script, starting the script if not running, and returns the line of the
+// response carrying the same id. Only the write is serialized, the UEs wait
+// for their responses concurrently
+func (h *EventHook) RunScript(id uint64, req []byte) ([]byte, error) {
+	h.lock.Lock()
+	if h.cmd == nil {
+		err := h.startScript()
+		if err != nil {
+			h.lock.Unlock()
+			return nil, err
+		}
+	}
+
+	rspChan := make(chan []byte, 1)
+	h.pending[id] = rspChan
+	_, err := h.stdin.Write(append(req, '\n'))
+	if err != nil {
+		h.stopScript()
+		h.lock.Unlock()
+		return nil, fmt.Errorf("failed to write to event hook:%v", err)
+	}
+	h.lock.Unlock()
+
+	timer := time.NewTimer(h.GetTimeout())
+	defer timer.Stop()
+	select {
+	case rsp, ok := <-rspChan:
+		if !ok {
+			return nil, fmt.Errorf("event hook exited")
+		}
+		return rsp, nil
+	case <-timer.C:
+		h.lock.Lock()
+		delete(h.pending, id)
+		h.lock.Unlock()
+		return nil, fmt.Errorf("event hook did not respond within %v",
+			h.GetTimeout())
+	}
+}
+
+// Close stops the script, once the profile is complete
+func (h *EventHook) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.cmd != nil {
+		h.stopScript()
+	}
+}
+
+// startScript starts the script along with the routine reading its
+// responses, expected to be called with the lock held
+func (h *EventHook) startScript() error {
+	cmd := exec.Command(h.Command, h.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start event hook:%v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start event hook:%v", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start event hook:%v", err)
+	}
+
+	h.cmd = cmd
+	h.stdin = stdin
+	h.pending = make(map[uint64]chan []byte)
+	go h.readResponses(cmd, stdout)
+	return nil
+}
+
+// readResponses routes the responses of the script to the UEs waiting for
+// them, until the script exits. Responses without a pending id are discarded
+func (h *EventHook) readResponses(cmd *exec.Cmd, stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		var rsp struct {
+			Id uint64 `json:"id"`
+		}
+		if json.Unmarshal(line, &rsp) != nil {
+			continue
+		}
+
+		h.lock.Lock()
+		rspChan, ok := h.pending[rsp.Id]
+		delete(h.pending, rsp.Id)
+		h.lock.Unlock()
+		if ok {
+			rspChan <- line
+		}
+	}
+
+	// Script is restarted on the next event, unless already replaced
+	h.lock.Lock()
+	if h.cmd == cmd {
+		h.stopScript()
+	}
+	h.lock.Unlock()
+}
+
+// stopScript kills the script and fails the requests pending with it.
+// Expected to be called with the lock held
+func (h *EventHook) stopScript() {
+	h.stdin.Close()
+	_ = h.cmd.Process.Kill()
+	_ = h.cmd.Wait()
+
+	for _, rspChan := range h.pending {
+		close(rspChan)
+	}
+	h.cmd = nil
+	h.stdin = nil
+	h.pending = nil
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/omec-project/gnbsim/common"
+)
+
+// Impairment simulates the radio conditions of the UEs. Each procedure of a
+// UE fails with the configured probability as if the radio link is lost, the
+// next NAS message from the network is dropped and the gNB releases the UE
+// context with the radio link failure cause. The procedures in which the
+// network sends no NAS message are not impaired
+type Impairment struct {
+	// Probability, from 0 to 1, with which a procedure fails
+	FailureProbability float64 `yaml:"failureProbability" json:"failureProbability"`
+
+	// Procedures which may fail, all the procedures when not configured
+	Procedures []string `yaml:"procedures" json:"procedures"`
+}
+
+// Validate checks the impairment configuration
+func (i *Impairment) Validate() error {
+	if i.FailureProbability < 0 || i.FailureProbability > 1 {
+		return fmt.Errorf("invalid failure probability:%v, valid range is 0 to 1",
+			i.FailureProbability)
+	}
+	for _, name := range i.Procedures {
+		_, err := common.GetProcedureType(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsProcedureFailed draws whether the procedure fails, using the random
+// source of the UE
+func (i *Impairment) IsProcedureFailed(proc common.ProcedureType, r *rand.Rand) bool {
+	if i.FailureProbability == 0 {
+		return false
+	}
+	if len(i.Procedures) != 0 {
+		found := false
+		for _, name := range i.Procedures {
+			if p, _ := common.GetProcedureType(name); p == proc {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.Float64() < i.FailureProbability
+}
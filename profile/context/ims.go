@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+)
+
+// UE's usage settings, TS 24.501 Section 9.11.3.55
+const (
+	USAGE_SETTING_VOICE_CENTRIC = "voice-centric"
+	USAGE_SETTING_DATA_CENTRIC  = "data-centric"
+)
+
+// ImsConfig makes the UE behave as an IMS voice capable UE, without an IMS
+// client. The PDU session to the IMS DNN is established once the PDU session
+// to the DNN of the profile is established, requesting the P-CSCF addresses
+// in the protocol configuration options
+type ImsConfig struct {
+	// UE's usage setting sent in the Registration Request, voice-centric or
+	// data-centric. Not sent when not configured
+	UsageSetting string `yaml:"usageSetting" json:"usageSetting"`
+
+	// DNN of the IMS PDU session, not established when not configured
+	Dnn string `yaml:"dnn" json:"dnn"`
+
+	// The IMS PDU session fails to establish if the network provides no
+	// P-CSCF address
+	ExpectPcscf bool `yaml:"expectPcscf" json:"expectPcscf"`
+}
+
+// Validate checks the IMS configuration
+func (i *ImsConfig) Validate() error {
+	_, err := i.GetUsageSetting()
+	if err != nil {
+		return err
+	}
+	if i.ExpectPcscf && i.Dnn == "" {
+		return fmt.Errorf("ims dnn not configured, required to expect the p-cscf address")
+	}
+	return nil
+}
+
+// GetUsageSetting returns the value of the UE's usage setting IE, nil if the
+// IE is not to be sent
+func (i *ImsConfig) GetUsageSetting() (*uint8, error) {
+	var value uint8
+	switch i.UsageSetting {
+	case "":
+		return nil, nil
+	case USAGE_SETTING_VOICE_CENTRIC:
+		value = 0
+	case USAGE_SETTING_DATA_CENTRIC:
+		value = 1
+	default:
+		return nil, fmt.Errorf("invalid usage setting:%v, valid values are %v and %v",
+			i.UsageSetting, USAGE_SETTING_VOICE_CENTRIC, USAGE_SETTING_DATA_CENTRIC)
+	}
+	return &value, nil
+}
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Upper limit on the number of IMSIs expanded from a range or a pattern
+const MAX_IMSI_LIST_LENGTH uint64 = 1000000
+
+// GetImsis returns the IMSIs allocated to the UEs of the profile, either
+// expanded from the Imsis list or the UeCount consecutive IMSIs starting at
+// StartImsi
+func (p *Profile) GetImsis() ([]string, error) {
+	if len(p.Imsis) == 0 {
+		return getImsiRange(p.StartImsi, p.UeCount)
+	}
+
+	var imsis []string
+	for _, entry := range p.Imsis {
+		expanded, err := expandImsiEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		imsis = append(imsis, expanded...)
+	}
+	return imsis, nil
+}
+
+// expandImsiEntry expands an entry of the Imsis list, which is either an
+// IMSI, a range "<first>-<last>" or a pattern "<prefix>{<first>-<last>}"
+func expandImsiEntry(entry string) ([]string, error) {
+	entry = strings.TrimSpace(entry)
+	if open := strings.Index(entry, "{"); open != -1 {
+		if !strings.HasSuffix(entry, "}") {
+			return nil, fmt.Errorf("invalid imsi pattern:%v", entry)
+		}
+		prefix := entry[:open]
+		first, last, err := splitImsiRange(entry[open+1 : len(entry)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid imsi pattern:%v, %v", entry, err)
+		}
+		return getImsiRange(prefix+first, countImsiRange(first, last))
+	}
+
+	if strings.Contains(entry, "-") {
+		first, last, err := splitImsiRange(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid imsi range:%v, %v", entry, err)
+		}
+		return getImsiRange(first, countImsiRange(first, last))
+	}
+
+	if _, err := strconv.ParseUint(entry, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid imsi value:%v", entry)
+	}
+	return []string{entry}, nil
+}
+
+// splitImsiRange parses "<first>-<last>", where both the values have the same
+// number of digits and first does not exceed last
+func splitImsiRange(r string) (first, last string, err error) {
+	bounds := strings.Split(r, "-")
+	if len(bounds) != 2 {
+		return "", "", fmt.Errorf("expected <first>-<last>")
+	}
+	first, last = strings.TrimSpace(bounds[0]), strings.TrimSpace(bounds[1])
+	if len(first) != len(last) {
+		return "", "", fmt.Errorf("%v and %v differ in the number of digits",
+			first, last)
+	}
+	f, err := strconv.ParseUint(first, 10, 64)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid value:%v", first)
+	}
+	l, err := strconv.ParseUint(last, 10, 64)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid value:%v", last)
+	}
+	if f > l {
+		return "", "", fmt.Errorf("%v exceeds %v", first, last)
+	}
+	if l-f >= MAX_IMSI_LIST_LENGTH {
+		return "", "", fmt.Errorf("range exceeds %v imsis", MAX_IMSI_LIST_LENGTH)
+	}
+	return first, last, nil
+}
+
+// countImsiRange returns the number of values in a range validated by
+// splitImsiRange
+func countImsiRange(first, last string) int {
+	f, _ := strconv.ParseUint(first, 10, 64)
+	l, _ := strconv.ParseUint(last, 10, 64)
+	return int(l-f) + 1
+}
+
+// getImsiRange returns count consecutive IMSIs starting at start, retaining
+// the number of digits of start
+func getImsiRange(start string, count int) ([]string, error) {
+	imsi, err := strconv.ParseUint(start, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid imsi value:%v", start)
+	}
+	imsis := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		imsis = append(imsis, fmt.Sprintf("%0*d", len(start), imsi+uint64(i)))
+	}
+	return imsis, nil
+}
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+)
+
+// Presence of the UE in the LADN service area
+const (
+	// UE is within the service area if its TAI is part of the LADN service
+	// area provided by the network
+	LADN_PRESENCE_AUTO string = "auto"
+
+	// UE considers itself within, or outside, the service area irrespective
+	// of its TAI
+	LADN_PRESENCE_IN  string = "in"
+	LADN_PRESENCE_OUT string = "out"
+)
+
+// LadnConfig treats the DNN of the profile as a LADN DNN. The UE requests
+// the PDU session only when it is within the LADN service area, as provided
+// by the network in Registration Accept or Configuration Update Command
+type LadnConfig struct {
+	// auto (default), in or out
+	Presence string `yaml:"presence" json:"presence"`
+
+	// Set to request the PDU session even when outside the LADN service
+	// area, to test the enforcement by the network. Usually combined with
+	// expectedPduSessEstRejectCause: out-of-ladn-service-area
+	RequestOutside bool `yaml:"requestOutside" json:"requestOutside"`
+}
+
+// GetPresence returns the configured presence in the LADN service area
+func (l *LadnConfig) GetPresence() (string, error) {
+	switch l.Presence {
+	case "", LADN_PRESENCE_AUTO:
+		return LADN_PRESENCE_AUTO, nil
+	case LADN_PRESENCE_IN, LADN_PRESENCE_OUT:
+		return l.Presence, nil
+	}
+	return "", fmt.Errorf("invalid ladn presence:%v", l.Presence)
+}
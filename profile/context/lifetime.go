@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Distributions from which the session lifetime is drawn
+const (
+	DISTRIBUTION_FIXED       string = "fixed"
+	DISTRIBUTION_UNIFORM     string = "uniform"
+	DISTRIBUTION_EXPONENTIAL string = "exponential"
+)
+
+// Actions taken by the UE once the session lifetime expires
+const (
+	END_ACTION_DEREGISTER string = "deregister"
+	END_ACTION_RELEASE    string = "release"
+)
+
+// SessionLifetime models the time for which each UE keeps its PDU session
+// alive, generating intermittent uplink traffic, before releasing it or
+// deregistering. All the durations are in seconds
+type SessionLifetime struct {
+	// One of "fixed" (default), "uniform" or "exponential"
+	Distribution string `yaml:"distribution" json:"distribution"`
+
+	// Lifetime for the fixed distribution, mean lifetime for the exponential
+	// distribution
+	Duration uint32 `yaml:"duration" json:"duration"`
+
+	// Bounds of the uniform distribution. MaxDuration also caps the lifetime
+	// drawn from the exponential distribution
+	MinDuration uint32 `yaml:"minDuration" json:"minDuration"`
+	MaxDuration uint32 `yaml:"maxDuration" json:"maxDuration"`
+
+	// Idle time between the bursts of uplink traffic, each burst consists of
+	// dataPktCount packets. No traffic is generated when set to 0
+	ThinkTime uint32 `yaml:"thinkTime" json:"thinkTime"`
+
+	// "deregister" (default) or "release" the PDU session, in which case the
+	// UE remains registered
+	EndAction string `yaml:"endAction" json:"endAction"`
+}
+
+// Validate checks the session lifetime model and returns the longest
+// lifetime it may produce
+func (l *SessionLifetime) Validate() (time.Duration, error) {
+	var max uint32
+	switch l.Distribution {
+	case "", DISTRIBUTION_FIXED:
+		max = l.Duration
+	case DISTRIBUTION_UNIFORM:
+		if l.MinDuration > l.MaxDuration {
+			return 0, fmt.Errorf("session lifetime min duration:%v exceeds max duration:%v",
+				l.MinDuration, l.MaxDuration)
+		}
+		max = l.MaxDuration
+	case DISTRIBUTION_EXPONENTIAL:
+		if l.MaxDuration == 0 {
+			return 0, fmt.Errorf("max duration required for exponential session lifetime")
+		}
+		max = l.MaxDuration
+	default:
+		return 0, fmt.Errorf("unsupported session lifetime distribution:%v",
+			l.Distribution)
+	}
+
+	switch l.EndAction {
+	case "", END_ACTION_DEREGISTER, END_ACTION_RELEASE:
+	default:
+		return 0, fmt.Errorf("unsupported session lifetime end action:%v",
+			l.EndAction)
+	}
+
+	return time.Duration(max) * time.Second, nil
+}
+
+// GetDuration draws the lifetime of a PDU session from the distribution,
+// using the provided source
+func (l *SessionLifetime) GetDuration(r *rand.Rand) time.Duration {
+	var seconds float64
+	switch l.Distribution {
+	case DISTRIBUTION_UNIFORM:
+		seconds = float64(l.MinDuration) +
+			r.Float64()*float64(l.MaxDuration-l.MinDuration)
+	case DISTRIBUTION_EXPONENTIAL:
+		seconds = r.ExpFloat64() * float64(l.Duration)
+		if seconds > float64(l.MaxDuration) {
+			seconds = float64(l.MaxDuration)
+		}
+	default:
+		seconds = float64(l.Duration)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"time"
+)
+
+// LoadStage is a stage of the load schedule of a profile. During the stage,
+// either the configured number of UEs are kept executing, a UE being started
+// as soon as another completes, or the UEs are started at the configured
+// arrival rate. No UE is started during a stage which configures neither,
+// letting the UEs in flight complete
+type LoadStage struct {
+	// Name of the stage in the summary, e.g. ramp-up or spike
+	Name string `yaml:"name" json:"name"`
+
+	// Duration of the stage in seconds
+	Duration uint32 `yaml:"duration" json:"duration"`
+
+	// Number of UEs kept executing during the stage
+	ActiveUes int `yaml:"activeUes" json:"activeUes"`
+
+	// Number of UEs started per second during the stage
+	ArrivalRate float64 `yaml:"arrivalRate" json:"arrivalRate"`
+}
+
+// Validate checks the load stage, the number of UEs kept executing is limited
+// by the number of IMSIs of the profile
+func (s *LoadStage) Validate(imsiCount int) error {
+	if s.Duration == 0 {
+		return fmt.Errorf("load stage duration not configured")
+	}
+	if s.ActiveUes < 0 {
+		return fmt.Errorf("invalid load stage active ues:%v", s.ActiveUes)
+	}
+	if s.ArrivalRate < 0 {
+		return fmt.Errorf("invalid load stage arrival rate:%v", s.ArrivalRate)
+	}
+	if s.ActiveUes != 0 && s.ArrivalRate != 0 {
+		return fmt.Errorf("both active ues and arrival rate configured for load stage")
+	}
+	if s.ActiveUes > imsiCount {
+		return fmt.Errorf("load stage active ues:%v exceed the number of imsis:%v",
+			s.ActiveUes, imsiCount)
+	}
+	return nil
+}
+
+// GetDuration returns the duration of the stage
+func (s *LoadStage) GetDuration() time.Duration {
+	return time.Duration(s.Duration) * time.Second
+}
+
+// GetArrivalInterval returns the interval between the UEs started during the
+// stage, 0 if the UEs are not started at an arrival rate
+func (s *LoadStage) GetArrivalInterval() time.Duration {
+	if s.ArrivalRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / s.ArrivalRate)
+}
+
+// GetName returns the name of the stage, numbered as per its index when not
+// configured
+func (s *LoadStage) GetName(index int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("stage%v", index+1)
+}
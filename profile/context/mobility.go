@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Procedures through which the UE moves to the target cell of a mobility step
+const (
+	// Handover over Xn, completed with Path Switch Request
+	MOBILITY_XN string = "xn"
+
+	// Handover through the AMF
+	MOBILITY_N2 string = "n2"
+
+	// UE releases the connection and performs mobility registration update
+	// in the target cell
+	MOBILITY_REGISTRATION string = "registration"
+)
+
+// Outcomes of the N2 handover of a mobility step. The negative outcomes leave
+// the UE in the source cell, and the step passes once the handover is
+// aborted as expected
+const (
+	// Handover is executed
+	MOBILITY_OUTCOME_SUCCESS string = "success"
+
+	// Source gNB sends Handover Cancel once the Handover Command is received
+	MOBILITY_OUTCOME_CANCEL string = "cancel"
+
+	// Target gNB rejects the Handover Request with Handover Failure, the AMF
+	// then responds the source gNB with Handover Preparation Failure
+	MOBILITY_OUTCOME_PREPARATION_FAILURE string = "preparation-failure"
+)
+
+// MobilityStep moves the UE to the target cell, after the delay (in
+// milliseconds) since the previous step. A connected UE is handed over,
+// whereas an idle UE re-registers in the target cell. Moving to another cell
+// of the serving gNB does not involve the network
+type MobilityStep struct {
+	Delay uint32 `yaml:"delay" json:"delay"`
+
+	// Target gNB, defaults to the serving gNB
+	GnbName string `yaml:"gnbName" json:"gnbName"`
+
+	// NR Cell Identity of the target cell, defaults to the first cell of the
+	// target gNB
+	NrCellId string `yaml:"nrCellId" json:"nrCellId"`
+
+	// One of "xn" (default), "n2" or "registration"
+	Procedure string `yaml:"procedure" json:"procedure"`
+
+	// One of "success" (default), "cancel" or "preparation-failure", the
+	// negative outcomes apply to the "n2" procedure only
+	Outcome string `yaml:"outcome" json:"outcome"`
+}
+
+// GetProcedure returns the procedure through which the UE moves to the target
+// cell
+func (s *MobilityStep) GetProcedure() (string, error) {
+	switch strings.ToLower(s.Procedure) {
+	case "", MOBILITY_XN:
+		return MOBILITY_XN, nil
+	case MOBILITY_N2:
+		return MOBILITY_N2, nil
+	case MOBILITY_REGISTRATION:
+		return MOBILITY_REGISTRATION, nil
+	default:
+		return "", fmt.Errorf("invalid mobility procedure: %v", s.Procedure)
+	}
+}
+
+// GetOutcome returns the expected outcome of the handover to the target cell
+func (s *MobilityStep) GetOutcome() (string, error) {
+	var outcome string
+	switch strings.ToLower(s.Outcome) {
+	case "", MOBILITY_OUTCOME_SUCCESS:
+		return MOBILITY_OUTCOME_SUCCESS, nil
+	case MOBILITY_OUTCOME_CANCEL:
+		outcome = MOBILITY_OUTCOME_CANCEL
+	case MOBILITY_OUTCOME_PREPARATION_FAILURE:
+		outcome = MOBILITY_OUTCOME_PREPARATION_FAILURE
+	default:
+		return "", fmt.Errorf("invalid mobility outcome: %v", s.Outcome)
+	}
+
+	procedure, err := s.GetProcedure()
+	if err != nil {
+		return "", err
+	}
+	if procedure != MOBILITY_N2 {
+		return "", fmt.Errorf("mobility outcome: %v requires procedure: %v",
+			outcome, MOBILITY_N2)
+	}
+	return outcome, nil
+}
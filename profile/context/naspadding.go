@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+)
+
+// Upper limit on the size to which a NAS message is padded, the payload
+// container and the protocol configuration options carry up to 65535 octets
+const MAX_NAS_PADDED_SIZE = 65535
+
+// NasPaddingConfig pads the NAS messages sent by the UEs to the configured
+// sizes, to test the handling of large NAS PDUs and NAS message containers by
+// the AMF and the SMF. A message already larger than the configured size is
+// sent as is
+type NasPaddingConfig struct {
+	// Size (in octets) of the plain Registration Request, padded with a
+	// zero filled payload container
+	RegistrationRequestSize int `yaml:"registrationRequestSize" json:"registrationRequestSize"`
+
+	// Size (in octets) of the plain UL NAS Transport carrying the PDU Session
+	// Establishment Request, padded with operator specific containers in the
+	// protocol configuration options, which the SMF ignores
+	PduSessEstRequestSize int `yaml:"pduSessEstRequestSize" json:"pduSessEstRequestSize"`
+}
+
+// Validate checks the NAS padding configuration
+func (n *NasPaddingConfig) Validate() error {
+	for _, size := range []int{n.RegistrationRequestSize, n.PduSessEstRequestSize} {
+		if size < 0 || size > MAX_NAS_PADDED_SIZE {
+			return fmt.Errorf("invalid nas padded size:%v, valid range is 0 to %v",
+				size, MAX_NAS_PADDED_SIZE)
+		}
+	}
+	return nil
+}
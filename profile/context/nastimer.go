@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"time"
+)
+
+// Default values (in seconds) of the UE NAS timers, TS 24.501 Section 10.2
+const (
+	DEFAULT_T3502 uint32 = 720
+	DEFAULT_T3510 uint32 = 15
+	DEFAULT_T3511 uint32 = 10
+	DEFAULT_T3521 uint32 = 15
+)
+
+// Maximum number of registration attempts before T3502 is started, and of
+// Deregistration Request transmissions before the deregistration is aborted,
+// TS 24.501 Sections 5.5.1.2.7 and 5.5.2.2.6
+const (
+	MAX_REG_ATTEMPTS   int = 5
+	MAX_DEREG_ATTEMPTS int = 5
+)
+
+// NasTimers enables the UE NAS timers guarding the Registration and
+// Deregistration Requests. The values are in seconds, the defaults of TS
+// 24.501 apply to the timers which are not configured. T3502 provided by the
+// network in the Registration Accept or Reject takes precedence over the
+// configured value
+type NasTimers struct {
+	T3502 uint32 `yaml:"t3502" json:"t3502"`
+	T3510 uint32 `yaml:"t3510" json:"t3510"`
+	T3511 uint32 `yaml:"t3511" json:"t3511"`
+	T3521 uint32 `yaml:"t3521" json:"t3521"`
+
+	// Registration attempts after which T3502 is started instead of T3511,
+	// MAX_REG_ATTEMPTS when not configured
+	MaxRegAttempts int `yaml:"maxRegAttempts" json:"maxRegAttempts"`
+}
+
+// Validate checks the NAS timer configuration
+func (t *NasTimers) Validate() error {
+	if t.MaxRegAttempts < 0 {
+		return fmt.Errorf("invalid max registration attempts:%v", t.MaxRegAttempts)
+	}
+	return nil
+}
+
+// GetT3502 returns the T3502 value, the value provided by the network (in
+// seconds) when not 0
+func (t *NasTimers) GetT3502(nwValue uint32) time.Duration {
+	if nwValue != 0 {
+		return time.Duration(nwValue) * time.Second
+	}
+	return getTimerValue(t.T3502, DEFAULT_T3502)
+}
+
+// GetT3510 returns the T3510 value
+func (t *NasTimers) GetT3510() time.Duration {
+	return getTimerValue(t.T3510, DEFAULT_T3510)
+}
+
+// GetT3511 returns the T3511 value
+func (t *NasTimers) GetT3511() time.Duration {
+	return getTimerValue(t.T3511, DEFAULT_T3511)
+}
+
+// GetT3521 returns the T3521 value
+func (t *NasTimers) GetT3521() time.Duration {
+	return getTimerValue(t.T3521, DEFAULT_T3521)
+}
+
+// GetMaxRegAttempts returns the number of registration attempts after which
+// T3502 is started
+func (t *NasTimers) GetMaxRegAttempts() int {
+	if t.MaxRegAttempts == 0 {
+		return MAX_REG_ATTEMPTS
+	}
+	return t.MaxRegAttempts
+}
+
+func getTimerValue(value, defaultValue uint32) time.Duration {
+	if value == 0 {
+		value = defaultValue
+	}
+	return time.Duration(value) * time.Second
+}
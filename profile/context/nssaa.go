@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/omec-project/openapi/models"
+)
+
+// NssaaSlice configures the EAP credentials with which the UEs authenticate
+// for a slice subject to network slice-specific authentication. The slice is
+// included in the Requested NSSAI. EAP-Request/Identity is answered with the
+// identity, while EAP-MD5-Challenge is answered using the password
+type NssaaSlice struct {
+	SNssai   *models.Snssai `yaml:"sNssai" json:"sNssai"`
+	Identity string         `yaml:"identity" json:"identity"`
+	Password string         `yaml:"password" json:"password"`
+
+	// Set when the slice authentication server is expected to reject the
+	// credentials
+	ExpectFailure bool `yaml:"expectFailure" json:"expectFailure"`
+}
+
+// Validate checks the network slice-specific authentication configuration
+func (n *NssaaSlice) Validate() error {
+	if n.SNssai == nil {
+		return fmt.Errorf("nssaa s-nssai not configured")
+	}
+	if n.SNssai.Sst < 0 || n.SNssai.Sst > 255 {
+		return fmt.Errorf("invalid nssaa sst:%v", n.SNssai.Sst)
+	}
+	if n.SNssai.Sd != "" {
+		sd, err := hex.DecodeString(n.SNssai.Sd)
+		if err != nil || len(sd) != 3 {
+			return fmt.Errorf("invalid nssaa sd:%v", n.SNssai.Sd)
+		}
+	}
+	if n.Identity == "" {
+		return fmt.Errorf("nssaa identity not configured")
+	}
+	return nil
+}
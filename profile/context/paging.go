@@ -0,0 +1,16 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+// PagingConfig makes the UE in CM-IDLE state deliberately ignore the paging
+// by the network, to test the paging retransmission and the downlink data
+// notification failure handling in the core. The downlink data triggering the
+// paging is to be sent to the UE from the data network, e.g. ping to the UE
+// address
+type PagingConfig struct {
+	// Number of paging attempts ignored before the UE responds with Service
+	// Request, the UE responds to the first paging when not configured
+	IgnoreCount uint `yaml:"ignoreCount" json:"ignoreCount"`
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/omec-project/nas/nasMessage"
+)
+
+// Items of the protocol configuration options which may be requested in the
+// PDU Session Establishment Request, TS 24.008 Section 10.5.6.3
+const (
+	PCO_DNS_IPV4   = "dns-ipv4"
+	PCO_DNS_IPV6   = "dns-ipv6"
+	PCO_PCSCF_IPV4 = "pcscf-ipv4"
+	PCO_PCSCF_IPV6 = "pcscf-ipv6"
+	PCO_MTU        = "mtu"
+)
+
+var pcoRequestIds = map[string]uint16{
+	PCO_DNS_IPV4:   nasMessage.DNSServerIPv4AddressRequestUL,
+	PCO_DNS_IPV6:   nasMessage.DNSServerIPv6AddressRequestUL,
+	PCO_PCSCF_IPV4: nasMessage.PCSCFIPv4AddressRequestUL,
+	PCO_PCSCF_IPV6: nasMessage.PCSCFIPv6AddressRequestUL,
+	PCO_MTU:        nasMessage.IPv4LinkMTURequestUL,
+}
+
+// PcoConfig selects the items requested in the extended protocol
+// configuration options of the PDU Session Establishment Request, and the
+// values expected in the PDU Session Establishment Accept
+type PcoConfig struct {
+	// Items requested, the DNS server addresses are requested when not
+	// configured
+	Request []string `yaml:"request" json:"request"`
+
+	// Addresses expected to be provided by the network, not validated when
+	// not configured
+	ExpectedDnsServers   []string `yaml:"expectedDnsServers" json:"expectedDnsServers"`
+	ExpectedPcscfServers []string `yaml:"expectedPcscfServers" json:"expectedPcscfServers"`
+
+	// IPv4 link MTU expected to be provided by the network, not validated
+	// when 0
+	ExpectedMtu uint16 `yaml:"expectedMtu" json:"expectedMtu"`
+}
+
+// Validate checks the protocol configuration options configuration
+func (p *PcoConfig) Validate() error {
+	_, err := p.GetRequestIds()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.GetExpectedDnsServers()
+	if err != nil {
+		return err
+	}
+	if len(p.ExpectedDnsServers) != 0 &&
+		!p.isRequested(PCO_DNS_IPV4) && !p.isRequested(PCO_DNS_IPV6) {
+		return fmt.Errorf("dns server addresses not requested, required to expect them")
+	}
+
+	_, err = p.GetExpectedPcscfServers()
+	if err != nil {
+		return err
+	}
+	if len(p.ExpectedPcscfServers) != 0 &&
+		!p.isRequested(PCO_PCSCF_IPV4) && !p.isRequested(PCO_PCSCF_IPV6) {
+		return fmt.Errorf("p-cscf addresses not requested, required to expect them")
+	}
+
+	if p.ExpectedMtu != 0 && !p.isRequested(PCO_MTU) {
+		return fmt.Errorf("mtu not requested, required to expect it")
+	}
+	return nil
+}
+
+// GetRequestIds returns the container identifiers of the items requested
+func (p *PcoConfig) GetRequestIds() ([]uint16, error) {
+	request := p.Request
+	if len(request) == 0 {
+		request = []string{PCO_DNS_IPV4, PCO_DNS_IPV6}
+	}
+
+	var ids []uint16
+	for _, item := range request {
+		id, ok := pcoRequestIds[item]
+		if !ok {
+			return nil, fmt.Errorf("invalid pco item:%v, valid values are %v, %v, %v, %v and %v",
+				item, PCO_DNS_IPV4, PCO_DNS_IPV6, PCO_PCSCF_IPV4, PCO_PCSCF_IPV6, PCO_MTU)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// GetExpectedDnsServers returns the DNS server addresses expected
+func (p *PcoConfig) GetExpectedDnsServers() ([]net.IP, error) {
+	return parseIpAddrs(p.ExpectedDnsServers)
+}
+
+// GetExpectedPcscfServers returns the P-CSCF addresses expected
+func (p *PcoConfig) GetExpectedPcscfServers() ([]net.IP, error) {
+	return parseIpAddrs(p.ExpectedPcscfServers)
+}
+
+func (p *PcoConfig) isRequested(item string) bool {
+	if len(p.Request) == 0 {
+		return item == PCO_DNS_IPV4 || item == PCO_DNS_IPV6
+	}
+	for _, r := range p.Request {
+		if r == item {
+			return true
+		}
+	}
+	return false
+}
+
+func parseIpAddrs(addrs []string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip address:%v", addr)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
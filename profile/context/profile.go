@@ -6,18 +6,34 @@
 package context
 
 import (
+	"encoding/hex"
 	"fmt"
+	"net"
+	"strconv"
+	"sync"
 
 	"github.com/omec-project/gnbsim/common"
 	"github.com/omec-project/gnbsim/logger"
+	"github.com/omec-project/gnbsim/realue/util"
 
+	"github.com/omec-project/nas/nasMessage"
 	"github.com/omec-project/openapi/models"
 	"github.com/sirupsen/logrus"
 )
 
 const PER_USER_TIMEOUT uint32 = 100 //seconds
+
+// Software version number of the IMEISVs generated from the TAC
+const DEFAULT_IMEI_SVN = "01"
+
+// Maximum length of the value of 5GMM capability IE, TS 24.501 Section 9.11.3.1
+const MAX_CAPABILITY_5GMM_LENGTH = 13
+
 var SummaryChan = make(chan common.InterfaceMessage)
 
+// abortLock guards the AbortChan of the profiles against being closed twice
+var abortLock sync.Mutex
+
 type Profile struct {
 	ProfileType    string         `yaml:"profileType" json:"profileType"`
 	Name           string         `yaml:"profileName" json:"profileName"`
@@ -36,20 +52,337 @@ type Profile struct {
 	SNssai         *models.Snssai `yaml:"sNssai" json:"sNssai"`
 	ExecInParallel bool           `yaml:"execInParallel" json:"execInParallel"`
 
-	Events     map[common.EventType]common.EventType
+	// Names of the profiles which must complete before the profile starts,
+	// when the profiles are executed in parallel
+	StartAfter []string `yaml:"startAfter" json:"startAfter"`
+
+	// Explicit IMSIs of the UEs, used instead of StartImsi. Each entry is an
+	// IMSI, an inclusive range of IMSIs such as
+	// "208930000000001-208930000000100", or a pattern such as
+	// "20893000000{0001-1000}". UeCount, when set, must match the number of
+	// IMSIs
+	Imsis []string `yaml:"imsis" json:"imsis"`
+
+	// Provisioning interface of the core from which the UEs and their keys
+	// are discovered, refer ProvisioningConfig
+	Provisioning *ProvisioningConfig `yaml:"provisioning" json:"provisioning"`
+
+	// Keys of the subscribers discovered through the provisioning interface,
+	// keyed by the IMSI. Carried to the workers along with the share of the
+	// IMSIs, so that the workers do not query the provisioning interface
+	Subscribers map[string]*Subscriber `yaml:"-" json:"subscribers,omitempty"`
+
+	// Lightweight UE mode, trading the per UE fidelity for the memory when
+	// scale testing the UE contexts of the AMF. The UEs are started in one
+	// burst and their results are collected by a single routine, with no
+	// NAS retransmission timer, step delay or timeline per UE, and no user
+	// data generated. The SimUe, RealUe and gNB UE contexts of the UEs are
+	// driven by one worker routine per CPU, instead of three routines per UE
+	// each holding a stack of at least 2 KiB, grown by the handlers. The
+	// memory held per UE in either mode is reported by
+	// `go test -run none -bench UeMemory ./profile`
+	Lightweight bool `yaml:"lightweight" json:"lightweight"`
+
+	// Time (in milliseconds) waited between the completion of a procedure
+	// and the start of the next one, counted in the per user timeout. Waits
+	// before specific procedures, keyed by the procedure name, override it
+	StepDelay uint32            `yaml:"stepDelay" json:"stepDelay"`
+	Waits     map[string]uint32 `yaml:"waits" json:"waits"`
+
+	// NGAP causes used by gNB while executing the negative test procedures.
+	// Refer test.GetNgapCause() for the supported cause names, any cause may
+	// be provided as "<group>:<value>" as well
+	IcsFailureCause  string `yaml:"icsFailureCause" json:"icsFailureCause"`
+	UeCtxRelReqCause string `yaml:"ueCtxRelReqCause" json:"ueCtxRelReqCause"`
+
+	// NGAP cause with which gNB rejects the UE Context Modification Requests
+	// from the AMF, accepted when not configured
+	UeCtxModFailureCause string `yaml:"ueCtxModFailureCause" json:"ueCtxModFailureCause"`
+
+	// NGAP cause of the UE Context Release Request sent by gNB once the
+	// radio link of the UE is lost, radio-link-failure when not configured
+	RadioLinkFailureCause string `yaml:"radioLinkFailureCause" json:"radioLinkFailureCause"`
+
+	// NGAP causes of the Handover Required sent by the source gNB and of the
+	// Handover Failure sent by the target gNB during N2 handover,
+	// handover-desirable-for-radio-reason and radio-resources-not-available
+	// when not configured
+	HandoverRequiredCause string `yaml:"handoverRequiredCause" json:"handoverRequiredCause"`
+	HandoverFailureCause  string `yaml:"handoverFailureCause" json:"handoverFailureCause"`
+
+	// Time (in seconds) for which the UE stays in RRC Inactive state before
+	// resuming
+	RrcInactiveDuration uint32 `yaml:"rrcInactiveDuration" json:"rrcInactiveDuration"`
+
+	// Optional assertions on the PDU Session Establishment Accept. UE fails
+	// if the allocated UE IP address does not belong to the subnet (CIDR
+	// notation) or if the Session-AMBR does not match, e.g. "100 Mbps"
+	ExpectedUeIpSubnet  string       `yaml:"expectedUeIpSubnet" json:"expectedUeIpSubnet"`
+	ExpectedSessionAmbr *models.Ambr `yaml:"expectedSessionAmbr" json:"expectedSessionAmbr"`
+
+	// 5GSM cause with which the PDU Session Establishment is expected to be
+	// rejected. The profile is complete once the expected reject is received,
+	// and the UE fails if the session is accepted instead. Refer
+	// test.GetCause5GSM() for the supported cause names
+	ExpectedPduSessEstRejectCause string `yaml:"expectedPduSessEstRejectCause" json:"expectedPduSessEstRejectCause"`
+
+	// 3GPP release (15, 16 or 17) emulated by the UE, it decides the optional
+	// IEs included in Registration Request. Optional IEs are excluded when
+	// not configured
+	NasRelease uint8 `yaml:"nasRelease" json:"nasRelease"`
+
+	// IMEISV (16 digits) of the first UE, the serial number is incremented
+	// for each subsequent UE. Alternatively, the IMEISVs are generated from
+	// the type allocation code (8 digits) with the serial number taken from
+	// the last 6 digits of the IMSI. IMEISV is sent when requested by the AMF
+	Imeisv  string `yaml:"imeisv" json:"imeisv"`
+	ImeiTac string `yaml:"imeiTac" json:"imeiTac"`
+
+	// Value octets of the 5GMM capability IE (hex string, up to 13 octets),
+	// overriding the capability derived from the NAS release
+	Capability5GMM string `yaml:"capability5GMM" json:"capability5GMM"`
+
+	// S1 mode support indicated in the 5GMM capability, overriding the
+	// configured or derived capability. When enabled the S1 UE network
+	// capability is included as well, as done by UEs capable of EPS
+	// interworking
+	S1Mode *bool `yaml:"s1Mode" json:"s1Mode"`
+
+	// 5GS registration type ("initial", "mobility", "periodic" or
+	// "emergency") of the Registration Requests sent by the UEs, initial if
+	// not configured. Mobility registration updating as the first
+	// registration simulates a UE moving in from EPS
+	RegistrationType string `yaml:"registrationType" json:"registrationType"`
+
+	// Registration options. UE requests MICO mode if enabled, follow-on
+	// request pending is indicated unless explicitly disabled
+	MicoMode        bool  `yaml:"micoMode" json:"micoMode"`
+	FollowOnRequest *bool `yaml:"followOnRequest" json:"followOnRequest"`
+
+	// Registration type ("initial" or "emergency") with which the UE
+	// reattempts the registration once, when rejected. Not reattempted when
+	// not configured, or while the T3346 back-off timer runs
+	RegRejectRetryType string `yaml:"regRejectRetryType" json:"regRejectRetryType"`
+
+	// File in which the SQN of each UE is saved after successful
+	// authentication, written once the profile is complete or the
+	// application is terminated. A saved SQN takes precedence over
+	// sequenceNumber, so that the subsequent runs continue from it. Setting
+	// sequenceNumber ahead of the network triggers SQN resynchronization
+	SqnStore string `yaml:"sqnStore" json:"sqnStore"`
+
+	// File in which the security context (ngKSI, K_AMF, NAS COUNTs and
+	// 5G-GUTI) of each UE is saved when it terminates, written once the
+	// profile is complete or the application is terminated. The saved
+	// context is restored when the UE is created, so that it re-registers
+	// using the existing context
+	SecurityCtxStore string `yaml:"securityCtxStore" json:"securityCtxStore"`
+
+	// Runs the UEs with the null integrity and ciphering algorithms (NIA0 and
+	// NEA0), the only algorithms indicated in the UE security capability. For
+	// debugging, the network must permit the null algorithms
+	NullSecurity bool `yaml:"nullSecurity" json:"nullSecurity"`
+
+	// Logs the plain NAS messages sent and received by the UEs, i.e. before
+	// ciphering and after deciphering, in hex along with the decoded form
+	LogNasPayloads bool `yaml:"logNasPayloads" json:"logNasPayloads"`
+
+	// Records the NAS and NGAP messages of each UE for failure analysis,
+	// not recorded when not configured
+	Timeline *TimelineConfig `yaml:"timeline" json:"timeline"`
+
+	// Records or verifies the call flow of the UEs, the messages are recorded
+	// in the timeline of each UE
+	CallFlow *CallFlowConfig `yaml:"callFlow" json:"callFlow"`
+
+	// Pads the NAS messages sent by the UEs to large sizes, not padded when
+	// not configured
+	NasPadding *NasPaddingConfig `yaml:"nasPadding" json:"nasPadding"`
+
+	// Optional assertions on the Registration Accept. UE fails if the MICO
+	// mode grant or the T3512 value (in seconds) does not match
+	ExpectedMicoGranted *bool  `yaml:"expectedMicoGranted" json:"expectedMicoGranted"`
+	ExpectedT3512       uint32 `yaml:"expectedT3512" json:"expectedT3512"`
+
+	// Expected ("golden") IE values of the Registration Accept and PDU
+	// Session Establishment Accept. UE fails with a diff of the mismatching
+	// IEs
+	Golden *common.GoldenIes `yaml:"golden" json:"golden"`
+
+	// TACs of the TAs in which the UEs camp, assigned to the UEs in round
+	// robin order. UEs are distributed over all the gNB cells when not
+	// configured
+	Tacs []string `yaml:"tacs" json:"tacs"`
+
+	// PLMN selected by the UEs, it must be broadcast by the gNB in the TAs of
+	// the UEs. Defaults to the home PLMN (plmnId), a different PLMN simulates
+	// roaming UEs
+	ServingPlmn *models.PlmnId `yaml:"servingPlmnId" json:"servingPlmnId"`
+
+	// Cell changes applied to each UE, one after another, while the AMF has
+	// requested location reporting on change of serving cell
+	CellChanges []common.CellChange `yaml:"cellChanges" json:"cellChanges"`
+
+	// Hex encoded UE Radio Capability (UE radio capability information as per
+	// TS 38.331) reported by gNB in UE Radio Capability Info Indication, when
+	// not provided by the AMF in the Initial Context Setup Request
+	UeRadioCapability string `yaml:"ueRadioCapability" json:"ueRadioCapability"`
+
+	// Name of the UE pool to which the registered UEs are added once the
+	// profile is complete, instead of being terminated
+	PublishUePool string `yaml:"publishUePool" json:"publishUePool"`
+
+	// Name of the UE pool from which the UEs are taken, instead of creating
+	// new UEs. The UEs are already registered, hence the registration
+	// procedure is skipped. Up to ueCount UEs are taken, all the UEs of the
+	// pool when ueCount is 0
+	UePool string `yaml:"uePool" json:"uePool"`
+
+	// Session lifetime model of the sessionlifetime profile type
+	SessionLifetime *SessionLifetime `yaml:"sessionLifetime" json:"sessionLifetime"`
+
+	// Mobility steps of the mobility profile type, executed by each UE one
+	// after another once its PDU session is established
+	Mobility []MobilityStep `yaml:"mobility" json:"mobility"`
+
+	// Time (in seconds) within which the whole profile must complete. The UEs
+	// still executing are failed once it expires. No limit when set to 0
+	ProfileTimeout uint32 `yaml:"profileTimeout" json:"profileTimeout"`
+
+	// Overrides of the expected transitions of the event map, keyed by the
+	// name of the triggering event, e.g. replying to Security Mode Command
+	// with Security Mode Reject:
+	//   SECURITY-MODE-COMMAND-EVENT: SECURITY-MODE-REJECT-EVENT
+	EventOverrides map[string]string `yaml:"events" json:"events"`
+
+	// SMS over NAS, used by the sms profile type
+	Sms *SmsConfig `yaml:"sms" json:"sms"`
+
+	// Slices subject to network slice-specific authentication, used by the
+	// nssaa profile type
+	Nssaa []*NssaaSlice `yaml:"nssaa" json:"nssaa"`
+
+	// Paging attempts ignored by the UE, used by the paging profile type
+	Paging *PagingConfig `yaml:"paging" json:"paging"`
+
+	// Treats the DNN as a LADN DNN, the PDU session is only established
+	// within the LADN service area
+	Ladn *LadnConfig `yaml:"ladn" json:"ladn"`
+
+	// Flows of the uplink user data, varied across the UEs
+	Traffic *TrafficConfig `yaml:"traffic" json:"traffic"`
+
+	// PDU session IDs indicated with pending uplink data in the Service
+	// Request, all the PDU sessions of the UE are indicated if not set
+	UplinkDataPduSessions []int64 `yaml:"uplinkDataPduSessions" json:"uplinkDataPduSessions"`
+
+	// Deviations of the UE from the expected NAS signalling
+	Abnormal *AbnormalBehaviour `yaml:"abnormal" json:"abnormal"`
+
+	// Procedures failing at random as if the radio link is lost, no
+	// procedure fails when not configured
+	Impairment *Impairment `yaml:"impairment" json:"impairment"`
+
+	// Retries of the procedures failing due to a timeout or a reject, the UE
+	// fails on the first failure when not configured
+	RetryPolicy *RetryPolicy `yaml:"retryPolicy" json:"retryPolicy"`
+
+	// Items requested in the protocol configuration options of the PDU
+	// Session Establishment Request and the values expected in the Accept
+	Pco *PcoConfig `yaml:"pco" json:"pco"`
+
+	// IMS voice capability of the UE and the PDU session to the IMS DNN
+	Ims *ImsConfig `yaml:"ims" json:"ims"`
+
+	// CIoT 5GS optimizations indicated in the 5GMM capability, overriding
+	// the configured or derived capability
+	Ciot *CiotConfig `yaml:"ciot" json:"ciot"`
+
+	// UE NAS timers retransmitting the Registration and Deregistration
+	// Requests which are not answered, disabled when not configured
+	NasTimers *NasTimers `yaml:"nasTimers" json:"nasTimers"`
+
+	// Steps of the scenario profile type
+	Scenario []*ScenarioStep `yaml:"scenario" json:"scenario"`
+
+	// Script run on the configured events, deciding the action of the UE
+	EventHook *EventHook `yaml:"eventHook" json:"eventHook"`
+
+	// Stages of load executed one after another, the IMSIs of the profile
+	// being reused once the UEs complete. UEs are executed once each as per
+	// execInParallel when not configured
+	LoadSchedule []*LoadStage `yaml:"loadSchedule" json:"loadSchedule"`
+
+	// Log level of the profile and of its UEs, in place of the levels of
+	// their modules. Also settable at runtime through the API
+	LogLevel string `yaml:"logLevel" json:"logLevel"`
+
+	// Tags assigned to subsets of the UEs, by which the results are broken
+	// down
+	Tags []*UeTag `yaml:"tags" json:"tags"`
+
+	// Tags of each UE keyed by IMSI, expanded from Tags
+	ueTags map[string][]string
+
+	Events     map[common.EventType]common.EventType `yaml:"-" json:"-"`
 	Procedures []common.ProcedureType
 
+	// Results accumulated while the profile is executing
+	Stats *ProfileStats `yaml:"-" json:"-"`
+
+	// User plane KPIs reported by the UEs
+	DataPlane *DataPlaneCollector `yaml:"-" json:"-"`
+
+	// Closed when the profile timeout expires or the application is
+	// interrupted, through Abort
+	AbortChan chan struct{} `yaml:"-" json:"-"`
+	aborted   bool
+
 	// Profile routine reads messages from other entities on this channel
 	// Entities can be SimUe, Main routine.
-	ReadChan chan *common.ProfileMessage
+	ReadChan chan *common.ProfileMessage `yaml:"-" json:"-"`
 
 	/* logger */
-	Log *logrus.Entry
+	Log *logrus.Entry `yaml:"-" json:"-"`
+}
+
+// InitAbort creates the AbortChan of the profile about to be executed. It is
+// closed already if the profile was aborted, so that no UE is started
+func (profile *Profile) InitAbort() {
+	abortLock.Lock()
+	defer abortLock.Unlock()
+	profile.AbortChan = make(chan struct{})
+	if profile.aborted {
+		close(profile.AbortChan)
+	}
+}
+
+// Abort closes the AbortChan of the profile, the UEs in flight fail and no
+// other UE is started. Profile is aborted once, the next calls are ignored
+func (profile *Profile) Abort() {
+	abortLock.Lock()
+	defer abortLock.Unlock()
+	if profile.aborted {
+		return
+	}
+	profile.aborted = true
+	if profile.AbortChan != nil {
+		close(profile.AbortChan)
+	}
 }
 
 func (profile *Profile) Init() {
 	profile.ReadChan = make(chan *common.ProfileMessage)
-	profile.Log = logger.ProfileLog.WithField(logger.FieldProfile, profile.Name)
+	profile.Log = logger.GetProfileLogs(profile.Name).Profile.WithField(
+		logger.FieldProfile, profile.Name)
+	if profile.LogLevel != "" {
+		err := logger.SetProfileLogLevel(profile.Name, profile.LogLevel)
+		if err != nil {
+			profile.Log.Errorln("Failed to set log level:", err)
+		}
+	}
+	profile.Stats = &ProfileStats{}
+	profile.DataPlane = &DataPlaneCollector{}
 
 	profile.Log.Traceln("profile initialized ", profile.Name, ", Enable ", profile.Enable)
 }
@@ -99,3 +432,131 @@ func (p *Profile) GetNextProcedure(currentProcedure common.ProcedureType) common
 
 	return nextProcedure
 }
+
+// GetExpectedUeIpSubnet returns the subnet to which the UE IP address is
+// expected to belong, or nil if not configured
+func (p *Profile) GetExpectedUeIpSubnet() (*net.IPNet, error) {
+	if p.ExpectedUeIpSubnet == "" {
+		return nil, nil
+	}
+	_, subnet, err := net.ParseCIDR(p.ExpectedUeIpSubnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expected ue ip subnet:%v", err)
+	}
+	return subnet, nil
+}
+
+// GetExpectedSessionAmbr returns the expected uplink and downlink Session-AMBR
+// in Kbps. A value of 0 indicates that the bit rate is not to be validated
+func (p *Profile) GetExpectedSessionAmbr() (ul, dl uint64, err error) {
+	if p.ExpectedSessionAmbr == nil {
+		return 0, 0, nil
+	}
+	if p.ExpectedSessionAmbr.Uplink != "" {
+		ul, err = util.ParseBitRate(p.ExpectedSessionAmbr.Uplink)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid expected uplink session ambr:%v", err)
+		}
+	}
+	if p.ExpectedSessionAmbr.Downlink != "" {
+		dl, err = util.ParseBitRate(p.ExpectedSessionAmbr.Downlink)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid expected downlink session ambr:%v", err)
+		}
+	}
+	return ul, dl, nil
+}
+
+// GetTac returns the TAC of the TA in which the UE, with the given index
+// within the profile, camps. It returns an empty string if not configured
+func (p *Profile) GetTac(ueIndex int) string {
+	if len(p.Tacs) == 0 {
+		return ""
+	}
+	return p.Tacs[ueIndex%len(p.Tacs)]
+}
+
+// GetServingPlmn returns the PLMN selected by the UEs
+func (p *Profile) GetServingPlmn() *models.PlmnId {
+	if p.ServingPlmn == nil {
+		return p.Plmn
+	}
+	return p.ServingPlmn
+}
+
+// GetRegRejectRetryType returns the 5GS registration type with which the
+// rejected registration is reattempted, 0 if not configured
+func (p *Profile) GetRegRejectRetryType() (uint8, error) {
+	switch p.RegRejectRetryType {
+	case "":
+		return 0, nil
+	case "initial":
+		return nasMessage.RegistrationType5GSInitialRegistration, nil
+	case "emergency":
+		return nasMessage.RegistrationType5GSEmergencyRegistration, nil
+	}
+	return 0, fmt.Errorf("unsupported registration reject retry type:%v",
+		p.RegRejectRetryType)
+}
+
+// GetRegistrationType returns the 5GS registration type of the Registration
+// Requests, 0 if not configured
+func (p *Profile) GetRegistrationType() (uint8, error) {
+	switch p.RegistrationType {
+	case "":
+		return 0, nil
+	case "initial":
+		return nasMessage.RegistrationType5GSInitialRegistration, nil
+	case "mobility":
+		return nasMessage.RegistrationType5GSMobilityRegistrationUpdating, nil
+	case "periodic":
+		return nasMessage.RegistrationType5GSPeriodicRegistrationUpdating, nil
+	case "emergency":
+		return nasMessage.RegistrationType5GSEmergencyRegistration, nil
+	}
+	return 0, fmt.Errorf("unsupported registration type:%v", p.RegistrationType)
+}
+
+// GetImeisv returns the IMEISV of the UE at the provided index within the
+// profile, or an empty string if neither IMEISV nor TAC is configured
+func (p *Profile) GetImeisv(ueIndex int, imsi string) string {
+	if p.Imeisv != "" {
+		snr, _ := strconv.Atoi(p.Imeisv[8:14])
+		snr = (snr + ueIndex) % 1000000
+		return fmt.Sprintf("%v%06d%v", p.Imeisv[:8], snr, p.Imeisv[14:])
+	}
+	if p.ImeiTac != "" {
+		for len(imsi) < 6 {
+			imsi = "0" + imsi
+		}
+		return p.ImeiTac + imsi[len(imsi)-6:] + DEFAULT_IMEI_SVN
+	}
+	return ""
+}
+
+// GetCapability5GMM returns the decoded 5GMM capability. It returns nil if
+// not configured
+func (p *Profile) GetCapability5GMM() ([]byte, error) {
+	if p.Capability5GMM == "" {
+		return nil, nil
+	}
+	capability, err := hex.DecodeString(p.Capability5GMM)
+	if err != nil || len(capability) > MAX_CAPABILITY_5GMM_LENGTH {
+		return nil, fmt.Errorf("invalid 5gmm capability:%v, expected up to %v hex encoded octets",
+			p.Capability5GMM, MAX_CAPABILITY_5GMM_LENGTH)
+	}
+	return capability, nil
+}
+
+// GetUeRadioCapability returns the decoded UE Radio Capability. It returns nil
+// if not configured
+func (p *Profile) GetUeRadioCapability() ([]byte, error) {
+	if p.UeRadioCapability == "" {
+		return nil, nil
+	}
+	capability, err := hex.DecodeString(p.UeRadioCapability)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ue radio capability:%v", err)
+	}
+	return capability, nil
+}
@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omec-project/openapi/models"
+)
+
+// Path of the subscriber API of the provisioning interface (webconsole), which
+// lists the provisioned subscribers and returns the data of a subscriber
+// appended with its UE ID
+const PROVISIONING_SUBSCRIBER_PATH = "/api/subscriber"
+
+// Timeout (in seconds) of the requests to the provisioning interface when not
+// configured
+const DEFAULT_PROVISIONING_TIMEOUT uint32 = 5
+
+// ProvisioningConfig discovers the UEs of the profile from the provisioning
+// interface of the core, instead of duplicating the subscriber data in the
+// configuration. The IMSIs are taken from the subscribers of the home PLMN,
+// and the keys and the SQN of each UE from its authentication subscription
+type ProvisioningConfig struct {
+	// Base URL of the provisioning interface, e.g. http://webui:5000
+	Url string `yaml:"url" json:"url"`
+
+	// Timeout (in seconds) of each request, defaults to
+	// DEFAULT_PROVISIONING_TIMEOUT
+	Timeout uint32 `yaml:"timeout" json:"timeout"`
+}
+
+// Subscriber holds the keys of a provisioned subscriber, hex encoded
+type Subscriber struct {
+	Key    string `json:"key"`
+	Opc    string `json:"opc"`
+	SeqNum string `json:"sequenceNumber"`
+}
+
+// provisionedUe is an entry of the subscriber list of the provisioning
+// interface
+type provisionedUe struct {
+	PlmnId string `json:"plmnID"`
+	UeId   string `json:"ueId"`
+}
+
+// provisionedSubsData is the part of the subscriber data returned by the
+// provisioning interface used by the UEs
+type provisionedSubsData struct {
+	AuthenticationSubscription *models.AuthenticationSubscription `json:"AuthenticationSubscription"`
+}
+
+// Validate checks the provisioning configuration
+func (c *ProvisioningConfig) Validate() error {
+	if c.Url == "" {
+		return fmt.Errorf("provisioning url not configured")
+	}
+	u, err := url.Parse(c.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid provisioning url:%v", c.Url)
+	}
+	return nil
+}
+
+// LoadProvisionedSubscribers discovers the subscribers of the UEs through the
+// provisioning interface, once. When neither StartImsi nor Imsis is
+// configured, the UEs are the provisioned subscribers of the home PLMN in the
+// order of the IMSIs, up to UeCount when configured. Otherwise the keys of
+// the configured IMSIs are fetched, each of which must be provisioned
+func (p *Profile) LoadProvisionedSubscribers() error {
+	if p.Provisioning == nil || p.Subscribers != nil {
+		return nil
+	}
+	c := p.Provisioning
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+
+	if p.StartImsi == "" && len(p.Imsis) == 0 {
+		if p.Plmn == nil {
+			return fmt.Errorf("plmn id not configured")
+		}
+		imsis, err := c.getProvisionedImsis(p.Plmn.Mcc + p.Plmn.Mnc)
+		if err != nil {
+			return err
+		}
+		if len(imsis) == 0 {
+			return fmt.Errorf("no subscriber provisioned for plmn id:%v",
+				p.Plmn.Mcc+p.Plmn.Mnc)
+		}
+		if p.UeCount > len(imsis) {
+			return fmt.Errorf("ue count:%v exceeds the %v provisioned subscribers",
+				p.UeCount, len(imsis))
+		}
+		if p.UeCount > 0 {
+			imsis = imsis[:p.UeCount]
+		}
+		p.Imsis = imsis
+	}
+
+	imsis, err := p.GetImsis()
+	if err != nil {
+		return err
+	}
+	subscribers := make(map[string]*Subscriber, len(imsis))
+	for _, imsi := range imsis {
+		subscriber, err := c.getSubscriber(imsi)
+		if err != nil {
+			return fmt.Errorf("failed to fetch subscriber imsi-%v:%v", imsi, err)
+		}
+		subscribers[imsi] = subscriber
+	}
+	p.Subscribers = subscribers
+	return nil
+}
+
+// GetSubscriber returns the provisioned keys of the UE with the IMSI, nil
+// when the UEs are not discovered through the provisioning interface
+func (p *Profile) GetSubscriber(imsi string) *Subscriber {
+	return p.Subscribers[imsi]
+}
+
+// getProvisionedImsis returns the sorted IMSIs of the provisioned subscribers
+// of the PLMN
+func (c *ProvisioningConfig) getProvisionedImsis(plmnId string) ([]string, error) {
+	var ues []provisionedUe
+	err := c.get(PROVISIONING_SUBSCRIBER_PATH, &ues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch subscriber list:%v", err)
+	}
+
+	var imsis []string
+	for _, ue := range ues {
+		imsi := strings.TrimPrefix(ue.UeId, "imsi-")
+		if imsi == ue.UeId || !strings.HasPrefix(imsi, plmnId) {
+			continue
+		}
+		imsis = append(imsis, imsi)
+	}
+	sort.Strings(imsis)
+	return imsis, nil
+}
+
+// getSubscriber fetches the authentication subscription of the subscriber
+func (c *ProvisioningConfig) getSubscriber(imsi string) (*Subscriber, error) {
+	data := &provisionedSubsData{}
+	err := c.get(PROVISIONING_SUBSCRIBER_PATH+"/imsi-"+imsi, data)
+	if err != nil {
+		return nil, err
+	}
+
+	authSubs := data.AuthenticationSubscription
+	if authSubs == nil || authSubs.PermanentKey == nil {
+		return nil, fmt.Errorf("authentication subscription not provisioned")
+	}
+	subscriber := &Subscriber{
+		Key:    authSubs.PermanentKey.PermanentKeyValue,
+		SeqNum: authSubs.SequenceNumber,
+	}
+	if authSubs.Opc != nil {
+		subscriber.Opc = authSubs.Opc.OpcValue
+	}
+	return subscriber, nil
+}
+
+// get sends a GET request to the provisioning interface and decodes the JSON
+// response into rsp
+func (c *ProvisioningConfig) get(path string, rsp interface{}) error {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DEFAULT_PROVISIONING_TIMEOUT
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	httpRsp, err := client.Get(strings.TrimSuffix(c.Url, "/") + path)
+	if err != nil {
+		return err
+	}
+	defer httpRsp.Body.Close()
+
+	body, err := ioutil.ReadAll(httpRsp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if httpRsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("provisioning interface returned status: %v",
+			httpRsp.Status)
+	}
+	err = json.Unmarshal(body, rsp)
+	if err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
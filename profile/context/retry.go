@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+)
+
+// Default backoff (in milliseconds) before the first retry of a failed
+// procedure, and the factor by which it grows for each following retry
+const (
+	DEFAULT_RETRY_BACKOFF    uint32  = 1000
+	DEFAULT_RETRY_MULTIPLIER float64 = 2
+)
+
+// RetryPolicy retries the procedures of the UE which fail due to a timeout or
+// a reject with a cause allowing the retry, before the UE is marked failed.
+// The backoff before each retry grows exponentially, the back-off timer
+// provided by the network in the reject takes precedence when longer
+type RetryPolicy struct {
+	// Retries of a procedure after which the UE fails
+	MaxRetries int `yaml:"maxRetries" json:"maxRetries"`
+
+	// Backoff before the first retry and the maximum backoff, in
+	// milliseconds. The backoff is not capped when MaxBackoff is 0
+	InitialBackoff uint32 `yaml:"initialBackoff" json:"initialBackoff"`
+	MaxBackoff     uint32 `yaml:"maxBackoff" json:"maxBackoff"`
+
+	// Factor by which the backoff grows for each retry,
+	// DEFAULT_RETRY_MULTIPLIER when not configured
+	Multiplier float64 `yaml:"multiplier" json:"multiplier"`
+
+	// Procedures which are retried, all the procedures when not configured
+	Procedures []string `yaml:"procedures" json:"procedures"`
+}
+
+// Validate checks the retry policy configuration
+func (r *RetryPolicy) Validate() error {
+	if r.MaxRetries < 0 {
+		return fmt.Errorf("invalid max retries:%v", r.MaxRetries)
+	}
+	if r.Multiplier != 0 && r.Multiplier < 1 {
+		return fmt.Errorf("invalid retry multiplier:%v, must be at least 1",
+			r.Multiplier)
+	}
+	if r.MaxBackoff != 0 && r.MaxBackoff < r.getInitialBackoff() {
+		return fmt.Errorf("max backoff:%v less than initial backoff:%v",
+			r.MaxBackoff, r.getInitialBackoff())
+	}
+	for _, name := range r.Procedures {
+		_, err := common.GetProcedureType(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsRetried returns true if the failed procedure is to be retried, given the
+// count of retries already made
+func (r *RetryPolicy) IsRetried(proc common.ProcedureType, retries int) bool {
+	if retries >= r.MaxRetries {
+		return false
+	}
+	if len(r.Procedures) == 0 {
+		return true
+	}
+	for _, name := range r.Procedures {
+		if p, _ := common.GetProcedureType(name); p == proc {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBackoff returns the backoff before the retry, numbered from 1
+func (r *RetryPolicy) GetBackoff(retry int) time.Duration {
+	multiplier := r.Multiplier
+	if multiplier == 0 {
+		multiplier = DEFAULT_RETRY_MULTIPLIER
+	}
+
+	backoff := float64(r.getInitialBackoff())
+	for i := 1; i < retry; i++ {
+		backoff *= multiplier
+		if r.MaxBackoff != 0 && backoff >= float64(r.MaxBackoff) {
+			break
+		}
+	}
+	if r.MaxBackoff != 0 && backoff > float64(r.MaxBackoff) {
+		backoff = float64(r.MaxBackoff)
+	}
+	return time.Duration(backoff) * time.Millisecond
+}
+
+func (r *RetryPolicy) getInitialBackoff() uint32 {
+	if r.InitialBackoff == 0 {
+		return DEFAULT_RETRY_BACKOFF
+	}
+	return r.InitialBackoff
+}
@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/common"
+)
+
+// ScenarioStep is a step of the scenario profile type. The UE executes the
+// procedure of the step, expecting the configured responses of the network.
+// The step passes once the procedure completes within the allowed time and
+// the assertions hold
+type ScenarioStep struct {
+	// Procedure executed by the UE, e.g. REGISTRATION-PROCEDURE
+	Procedure string `yaml:"procedure" json:"procedure"`
+
+	// Expected responses of the network, keyed by the name of the
+	// triggering event, as for the event overrides of the profile
+	Expect map[string]string `yaml:"expect" json:"expect"`
+
+	// Time (in seconds) within which the procedure must complete, not
+	// limited when set to 0. A procedure which does not complete at all is
+	// failed by the per user timeout
+	Within uint32 `yaml:"within" json:"within"`
+
+	// Assertions on the state of the UE once the procedure completes
+	Assert *ScenarioAssert `yaml:"assert" json:"assert"`
+
+	// Time (in milliseconds) waited before the procedure is started,
+	// overriding the step delay of the profile. Not applied to the first step
+	Wait uint32 `yaml:"wait" json:"wait"`
+}
+
+// ScenarioAssert are the assertions of a scenario step on the values
+// provided by the network, only the configured values are asserted
+type ScenarioAssert struct {
+	Registered  *bool   `yaml:"registered" json:"registered"`
+	MicoGranted *bool   `yaml:"micoGranted" json:"micoGranted"`
+	SmsAllowed  *bool   `yaml:"smsAllowed" json:"smsAllowed"`
+	T3512       *uint32 `yaml:"t3512" json:"t3512"`
+}
+
+// CompileScenario returns the procedures of the scenario steps, and the
+// expected transitions of the event map as configured by the steps. The
+// event map being common to the steps, a triggering event may not expect
+// different responses in different steps
+func (p *Profile) CompileScenario() ([]common.ProcedureType,
+	map[common.EventType]common.EventType, error) {
+	if len(p.Scenario) == 0 {
+		return nil, nil, fmt.Errorf("scenario steps not configured")
+	}
+
+	procedures := make([]common.ProcedureType, 0, len(p.Scenario))
+	events := make(map[common.EventType]common.EventType)
+	for i, step := range p.Scenario {
+		procedure, err := common.GetProcedureType(step.Procedure)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scenario step %v: %v", i+1, err)
+		}
+		if procedure == common.SESSION_HOLD_PROCEDURE && p.SessionLifetime == nil {
+			return nil, nil, fmt.Errorf("scenario step %v: session lifetime not configured", i+1)
+		}
+		procedures = append(procedures, procedure)
+
+		for trigger, expected := range step.Expect {
+			triggerEvent, err := common.GetEventType(trigger)
+			if err != nil {
+				return nil, nil, fmt.Errorf("scenario step %v: %v", i+1, err)
+			}
+			expectedEvent, err := common.GetEventType(expected)
+			if err != nil {
+				return nil, nil, fmt.Errorf("scenario step %v: %v", i+1, err)
+			}
+			if e, ok := events[triggerEvent]; ok && e != expectedEvent {
+				return nil, nil, fmt.Errorf("scenario step %v: conflicting expectation on %v, %v and %v",
+					i+1, trigger, e, expected)
+			}
+			events[triggerEvent] = expectedEvent
+		}
+	}
+	return procedures, events, nil
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/realue/sms"
+)
+
+// SmsConfig configures SMS over NAS. UEs request SMS over NAS during the
+// registration when configured. The sms profile type sends a mobile
+// originated SMS and waits for the mobile terminated SMSs, which are
+// acknowledged by the UEs
+type SmsConfig struct {
+	// Addresses (digits) of the SMSC and of the recipient of the mobile
+	// originated SMS
+	Smsc        string `yaml:"smsc" json:"smsc"`
+	Destination string `yaml:"destination" json:"destination"`
+
+	// Text of the mobile originated SMS, in the GSM 7 bit default alphabet
+	Text string `yaml:"text" json:"text"`
+
+	// Number of mobile terminated SMSs each UE waits for once the mobile
+	// originated SMS is acknowledged
+	MtSmsCount int `yaml:"mtSmsCount" json:"mtSmsCount"`
+}
+
+// Validate checks the SMS configuration
+func (s *SmsConfig) Validate() error {
+	err := sms.ValidateAddress(s.Smsc)
+	if err != nil {
+		return fmt.Errorf("invalid smsc: %v", err)
+	}
+	err = sms.ValidateAddress(s.Destination)
+	if err != nil {
+		return fmt.Errorf("invalid sms destination: %v", err)
+	}
+	err = sms.ValidateText(s.Text)
+	if err != nil {
+		return fmt.Errorf("invalid sms text: %v", err)
+	}
+	if s.MtSmsCount < 0 {
+		return fmt.Errorf("invalid mt sms count:%v", s.MtSmsCount)
+	}
+	return nil
+}
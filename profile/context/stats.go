@@ -0,0 +1,297 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/stats"
+)
+
+// Latencies retained while no cursor samples the stats, the oldest are
+// dropped beyond it
+const MAX_UNSAMPLED_LATENCIES = 100000
+
+// ProfileStats accumulates the per UE results of a profile while it is
+// executing. It is periodically sampled through cursors to report interim
+// summaries during long running soaks
+type ProfileStats struct {
+	lock sync.Mutex
+
+	// Cumulative counters since the profile was started
+	UePassedCount uint
+	UeFailedCount uint
+
+	// PDU sessions modified and released by the network outside of the
+	// procedures of the profile
+	NwPduSessMods uint
+	NwPduSessRels uint
+
+	// Failed procedures retried by the UEs
+	Retries uint
+
+	// Time taken by each of the procedures, in the order in which the
+	// procedures were first completed
+	stageTimings []*common.StageTiming
+	stageTotals  []time.Duration
+
+	// Results of the tagged UEs, keyed by tag
+	tagResults map[string]*common.TagSummary
+	tagTotals  map[string]time.Duration
+
+	// Latencies of the UEs not yet sampled by all the cursors, latencyBase
+	// being the position of the first of them since the profile was started
+	latencies   []time.Duration
+	latencyBase int
+	cursors     []*StatsCursor
+}
+
+// StatsCursor samples ProfileStats on behalf of a consumer. Each sample holds
+// the results since the previous sample of the same cursor, so that the
+// consumers sample the stats independently
+type StatsCursor struct {
+	stats *ProfileStats
+
+	// Counters and position in the latencies at the previous sample
+	passedCount uint
+	failedCount uint
+	latencyPos  int
+}
+
+// StatsSample is a point in time snapshot of ProfileStats
+type StatsSample struct {
+	UePassedCount      uint
+	UeFailedCount      uint
+	IntvlPassedCount   uint
+	IntvlFailedCount   uint
+	IntvlSuccessRate   float64
+	IntvlLatencyP50    time.Duration
+	IntvlLatencyP90    time.Duration
+	IntvlLatencyP99    time.Duration
+	IntvlLatencySample int
+
+	// Cumulative results of the tagged UEs
+	Tags []common.TagSummary
+}
+
+// RecordResult updates the stats with the result of a single UE execution,
+// including the results of the tags of the UE
+func (s *ProfileStats) RecordResult(tags []string, passed bool,
+	latency time.Duration) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if passed {
+		s.UePassedCount++
+	} else {
+		s.UeFailedCount++
+	}
+	s.latencies = append(s.latencies, latency)
+	if len(s.cursors) == 0 && len(s.latencies) > MAX_UNSAMPLED_LATENCIES {
+		s.trimLatencies(len(s.latencies) - MAX_UNSAMPLED_LATENCIES)
+	}
+
+	if len(tags) == 0 {
+		return
+	}
+	if s.tagResults == nil {
+		s.tagResults = make(map[string]*common.TagSummary)
+		s.tagTotals = make(map[string]time.Duration)
+	}
+	for _, tag := range tags {
+		result, ok := s.tagResults[tag]
+		if !ok {
+			result = &common.TagSummary{Tag: tag}
+			s.tagResults[tag] = result
+		}
+		if passed {
+			result.UePassedCount++
+		} else {
+			result.UeFailedCount++
+		}
+		s.tagTotals[tag] += latency
+		result.AvgLatency = s.tagTotals[tag] /
+			time.Duration(result.UePassedCount+result.UeFailedCount)
+		if latency > result.MaxLatency {
+			result.MaxLatency = latency
+		}
+	}
+	stats.RecordTagResult(tags, passed)
+}
+
+// RecordNwPduSessEvents updates the stats with the PDU sessions modified and
+// released by the network during a single UE execution
+func (s *ProfileStats) RecordNwPduSessEvents(mods, rels uint) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.NwPduSessMods += mods
+	s.NwPduSessRels += rels
+}
+
+// RecordRetries updates the stats with the failed procedures retried during a
+// single UE execution
+func (s *ProfileStats) RecordRetries(retries uint) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Retries += retries
+}
+
+// RecordStageTimes updates the stats with the time taken by a single UE to
+// complete each of the procedures
+func (s *ProfileStats) RecordStageTimes(times []common.StageTime) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, t := range times {
+		name := t.Procedure.String()
+		i := 0
+		for i < len(s.stageTimings) && s.stageTimings[i].Procedure != name {
+			i++
+		}
+		if i == len(s.stageTimings) {
+			s.stageTimings = append(s.stageTimings,
+				&common.StageTiming{Procedure: name, Min: t.Duration})
+			s.stageTotals = append(s.stageTotals, 0)
+		}
+
+		timing := s.stageTimings[i]
+		timing.Count++
+		s.stageTotals[i] += t.Duration
+		timing.Avg = s.stageTotals[i] / time.Duration(timing.Count)
+		if t.Duration < timing.Min {
+			timing.Min = t.Duration
+		}
+		if t.Duration > timing.Max {
+			timing.Max = t.Duration
+		}
+	}
+}
+
+// GetStageTimings returns the time taken by each of the procedures
+func (s *ProfileStats) GetStageTimings() []common.StageTiming {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	timings := make([]common.StageTiming, 0, len(s.stageTimings))
+	for _, timing := range s.stageTimings {
+		timings = append(timings, *timing)
+	}
+	return timings
+}
+
+// GetTagSummaries returns the results of the tagged UEs, sorted by tag
+func (s *ProfileStats) GetTagSummaries() []common.TagSummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.getTagSummaries()
+}
+
+// getTagSummaries is GetTagSummaries, expected to be called with the stats
+// locked
+func (s *ProfileStats) getTagSummaries() []common.TagSummary {
+	if len(s.tagResults) == 0 {
+		return nil
+	}
+	summaries := make([]common.TagSummary, 0, len(s.tagResults))
+	for _, result := range s.tagResults {
+		summaries = append(summaries, *result)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Tag < summaries[j].Tag
+	})
+	return summaries
+}
+
+// NewCursor returns a cursor sampling the stats. Its first sample holds the
+// results since the profile was started, the latencies being limited to the
+// latest MAX_UNSAMPLED_LATENCIES
+func (s *ProfileStats) NewCursor() *StatsCursor {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cursor := &StatsCursor{stats: s, latencyPos: s.latencyBase}
+	s.cursors = append(s.cursors, cursor)
+	return cursor
+}
+
+// Sample returns a snapshot of the current stats, along with the results
+// since the previous sample of the cursor. The stats sampled by the other
+// cursors are not affected
+func (c *StatsCursor) Sample() *StatsSample {
+	s := c.stats
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sample := &StatsSample{
+		UePassedCount:    s.UePassedCount,
+		UeFailedCount:    s.UeFailedCount,
+		IntvlPassedCount: s.UePassedCount - c.passedCount,
+		IntvlFailedCount: s.UeFailedCount - c.failedCount,
+		Tags:             s.getTagSummaries(),
+	}
+
+	total := sample.IntvlPassedCount + sample.IntvlFailedCount
+	if total != 0 {
+		sample.IntvlSuccessRate = float64(sample.IntvlPassedCount) * 100 /
+			float64(total)
+	}
+
+	pos := c.latencyPos
+	if pos < s.latencyBase {
+		pos = s.latencyBase
+	}
+	latencies := make([]time.Duration, len(s.latencies)-(pos-s.latencyBase))
+	copy(latencies, s.latencies[pos-s.latencyBase:])
+	sample.IntvlLatencySample = len(latencies)
+	if len(latencies) != 0 {
+		sort.Slice(latencies, func(i, j int) bool {
+			return latencies[i] < latencies[j]
+		})
+		sample.IntvlLatencyP50 = percentile(latencies, 50)
+		sample.IntvlLatencyP90 = percentile(latencies, 90)
+		sample.IntvlLatencyP99 = percentile(latencies, 99)
+	}
+
+	c.passedCount = s.UePassedCount
+	c.failedCount = s.UeFailedCount
+	c.latencyPos = s.latencyBase + len(s.latencies)
+
+	// Latencies sampled by all the cursors are no longer retained
+	minPos := c.latencyPos
+	for _, cursor := range s.cursors {
+		if cursor.latencyPos < minPos {
+			minPos = cursor.latencyPos
+		}
+	}
+	s.trimLatencies(minPos - s.latencyBase)
+
+	return sample
+}
+
+// trimLatencies drops the oldest count latencies, expected to be called with
+// the stats locked
+func (s *ProfileStats) trimLatencies(count int) {
+	if count <= 0 {
+		return
+	}
+	s.latencies = append(s.latencies[:0], s.latencies[count:]...)
+	s.latencyBase += count
+}
+
+// percentile expects the provided list to be sorted in ascending order
+func percentile(sorted []time.Duration, p int) time.Duration {
+	index := (len(sorted)*p+99)/100 - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+)
+
+// ValidateWaits checks the procedures for which the waits are configured
+func (p *Profile) ValidateWaits() error {
+	for name := range p.Waits {
+		_, err := common.GetProcedureType(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStepDelay returns the time to be waited before the procedure is started.
+// For the scenario profile type, the wait of the scenario step at the
+// provided index takes precedence
+func (p *Profile) GetStepDelay(proc common.ProcedureType, scenarioStep int) time.Duration {
+	if len(p.Scenario) != 0 && scenarioStep < len(p.Scenario) &&
+		p.Scenario[scenarioStep].Wait != 0 {
+		return time.Duration(p.Scenario[scenarioStep].Wait) * time.Millisecond
+	}
+	if wait, ok := p.Waits[proc.String()]; ok {
+		return time.Duration(wait) * time.Millisecond
+	}
+	return time.Duration(p.StepDelay) * time.Millisecond
+}
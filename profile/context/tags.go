@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UeTag assigns a tag to a subset of the UEs of the profile, e.g. slice-a or
+// heavy-traffic. The results of the UEs are broken down by tag in the
+// summary and the metrics, a UE may carry several tags
+type UeTag struct {
+	Name string `yaml:"name" json:"name"`
+
+	// IMSIs of the UEs carrying the tag, each entry is an IMSI, a range or a
+	// pattern as in the Imsis list of the profile
+	Imsis []string `yaml:"imsis" json:"imsis"`
+}
+
+// LoadUeTags validates the tags of the profile and expands their IMSIs
+func (p *Profile) LoadUeTags() error {
+	ueTags := make(map[string][]string)
+	names := make(map[string]bool, len(p.Tags))
+	for _, tag := range p.Tags {
+		if tag.Name == "" {
+			return fmt.Errorf("ue tag name not configured")
+		}
+		if names[tag.Name] {
+			return fmt.Errorf("duplicate ue tag:%v", tag.Name)
+		}
+		names[tag.Name] = true
+		if len(tag.Imsis) == 0 {
+			return fmt.Errorf("imsis not configured for ue tag:%v", tag.Name)
+		}
+
+		for _, entry := range tag.Imsis {
+			imsis, err := expandImsiEntry(entry)
+			if err != nil {
+				return fmt.Errorf("ue tag %v: %v", tag.Name, err)
+			}
+			for _, imsi := range imsis {
+				tags := ueTags[imsi]
+				// Entries of the same tag may overlap
+				if len(tags) == 0 || tags[len(tags)-1] != tag.Name {
+					ueTags[imsi] = append(tags, tag.Name)
+				}
+			}
+		}
+	}
+	p.ueTags = ueTags
+	return nil
+}
+
+// GetUeTags returns the tags of the UE, in the order of the tags configured
+func (p *Profile) GetUeTags(supi string) []string {
+	return p.ueTags[strings.TrimPrefix(supi, "imsi-")]
+}
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+)
+
+// Entries retained per UE when the limit is not configured
+const DEFAULT_TIMELINE_MAX_ENTRIES = 1000
+
+// TimelineConfig enables the recording of the NAS and NGAP messages of each
+// UE, with their direction and size. The timelines are retained once the UEs
+// terminate, and exported over the HTTP interface as JSON or PlantUML
+type TimelineConfig struct {
+	// Entries retained per UE, the oldest entries are dropped beyond it.
+	// Defaults to DEFAULT_TIMELINE_MAX_ENTRIES
+	MaxEntries int `yaml:"maxEntries" json:"maxEntries"`
+}
+
+// Validate checks the timeline configuration
+func (t *TimelineConfig) Validate() error {
+	if t.MaxEntries < 0 {
+		return fmt.Errorf("invalid timeline max entries:%v", t.MaxEntries)
+	}
+	return nil
+}
+
+// GetMaxEntries returns the entries retained per UE
+func (t *TimelineConfig) GetMaxEntries() int {
+	if t.MaxEntries == 0 {
+		return DEFAULT_TIMELINE_MAX_ENTRIES
+	}
+	return t.MaxEntries
+}
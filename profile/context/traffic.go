@@ -0,0 +1,228 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Protocols of the generated uplink user data packets
+const (
+	TRAFFIC_PROTOCOL_ICMP string = "icmp"
+	TRAFFIC_PROTOCOL_UDP  string = "udp"
+	TRAFFIC_PROTOCOL_HTTP string = "http"
+	TRAFFIC_PROTOCOL_DNS  string = "dns"
+)
+
+// DnsRecordTypes maps the supported DNS record types of the queries to their
+// values, RFC 1035 and RFC 3596
+var DnsRecordTypes = map[string]uint16{
+	"A":     1,
+	"NS":    2,
+	"CNAME": 5,
+	"SOA":   6,
+	"PTR":   12,
+	"MX":    15,
+	"TXT":   16,
+	"AAAA":  28,
+	"SRV":   33,
+}
+
+// TrafficConfig varies the flows of the uplink user data across the UEs, so
+// that the UPF sees traffic from many flows. Each entry of the lists is a
+// single value or an inclusive range, e.g. "10.0.0.1-10.0.0.100" or
+// "5000-5999". UE n uses the nth value of each list, wrapping around
+type TrafficConfig struct {
+	// One of "icmp" (default, echo requests), "udp", "http" (GET requests,
+	// each over a new TCP connection) or "dns" (queries)
+	Protocol string `yaml:"protocol" json:"protocol"`
+
+	// Destination IPs, the resolvers for DNS, defaultAs is used if not
+	// configured
+	DestinationIps []string `yaml:"destinationIps" json:"destinationIps"`
+
+	// Source and destination ports, 10000 and 9 (discard), or 80 for HTTP
+	// and 53 for DNS, are used if not configured
+	SourcePorts      []string `yaml:"sourcePorts" json:"sourcePorts"`
+	DestinationPorts []string `yaml:"destinationPorts" json:"destinationPorts"`
+
+	// Path of the HTTP GET requests, "/" if not configured
+	HttpPath string `yaml:"httpPath" json:"httpPath"`
+
+	// Names and record types of the DNS queries, the queries cycle through
+	// the names for each of the record types. Record type A is queried if
+	// not configured
+	DnsNames       []string `yaml:"dnsNames" json:"dnsNames"`
+	DnsRecordTypes []string `yaml:"dnsRecordTypes" json:"dnsRecordTypes"`
+}
+
+// TrafficFlow is the flow of the uplink user data generated by a UE. The
+// destination IP is empty if not configured, in which case defaultAs is used
+type TrafficFlow struct {
+	Protocol      string
+	DestinationIp string
+	SrcPort       uint16
+	DstPort       uint16
+	HttpPath      string
+	DnsNames      []string
+	DnsTypes      []uint16
+}
+
+const (
+	DEFAULT_TRAFFIC_SRC_PORT uint16 = 10000
+	DEFAULT_TRAFFIC_DST_PORT uint16 = 9
+	DEFAULT_HTTP_DST_PORT    uint16 = 80
+	DEFAULT_DNS_DST_PORT     uint16 = 53
+)
+
+// valueRange is an inclusive range of IPs or ports, the IPs being held as
+// integers
+type valueRange struct {
+	start uint64
+	count uint64
+}
+
+// Validate checks the protocol and the lists of IPs and ports
+func (t *TrafficConfig) Validate() error {
+	switch t.Protocol {
+	case "", TRAFFIC_PROTOCOL_ICMP, TRAFFIC_PROTOCOL_UDP, TRAFFIC_PROTOCOL_HTTP:
+	case TRAFFIC_PROTOCOL_DNS:
+		if len(t.DnsNames) == 0 {
+			return fmt.Errorf("dns names not configured")
+		}
+		for _, name := range t.DnsNames {
+			if name == "" || len(name) > 253 {
+				return fmt.Errorf("invalid dns name:%v", name)
+			}
+		}
+		for _, rrType := range t.DnsRecordTypes {
+			if _, ok := DnsRecordTypes[strings.ToUpper(rrType)]; !ok {
+				return fmt.Errorf("unsupported dns record type:%v", rrType)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported traffic protocol:%v", t.Protocol)
+	}
+	if _, err := parseRanges(t.DestinationIps, parseIpv4); err != nil {
+		return fmt.Errorf("invalid traffic destination ips: %v", err)
+	}
+	if _, err := parseRanges(t.SourcePorts, parsePort); err != nil {
+		return fmt.Errorf("invalid traffic source ports: %v", err)
+	}
+	if _, err := parseRanges(t.DestinationPorts, parsePort); err != nil {
+		return fmt.Errorf("invalid traffic destination ports: %v", err)
+	}
+	return nil
+}
+
+// GetTrafficFlow returns the flow of the uplink user data of the UE, nil if
+// the traffic is not configured in which case the UE pings defaultAs
+func (p *Profile) GetTrafficFlow(ueIndex int) *TrafficFlow {
+	t := p.Traffic
+	if t == nil {
+		return nil
+	}
+
+	// Profile is validated before the UEs are created
+	flow := &TrafficFlow{
+		Protocol: t.Protocol,
+		SrcPort:  DEFAULT_TRAFFIC_SRC_PORT,
+		DstPort:  DEFAULT_TRAFFIC_DST_PORT,
+	}
+	if flow.Protocol == "" {
+		flow.Protocol = TRAFFIC_PROTOCOL_ICMP
+	}
+	if flow.Protocol == TRAFFIC_PROTOCOL_HTTP {
+		flow.DstPort = DEFAULT_HTTP_DST_PORT
+		flow.HttpPath = t.HttpPath
+		if flow.HttpPath == "" {
+			flow.HttpPath = "/"
+		}
+	}
+	if flow.Protocol == TRAFFIC_PROTOCOL_DNS {
+		flow.DstPort = DEFAULT_DNS_DST_PORT
+		flow.DnsNames = t.DnsNames
+		for _, rrType := range t.DnsRecordTypes {
+			flow.DnsTypes = append(flow.DnsTypes, DnsRecordTypes[strings.ToUpper(rrType)])
+		}
+		if len(flow.DnsTypes) == 0 {
+			flow.DnsTypes = []uint16{DnsRecordTypes["A"]}
+		}
+	}
+	if ips, _ := parseRanges(t.DestinationIps, parseIpv4); ips != nil {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, uint32(getValue(ips, ueIndex)))
+		flow.DestinationIp = ip.String()
+	}
+	if ports, _ := parseRanges(t.SourcePorts, parsePort); ports != nil {
+		flow.SrcPort = uint16(getValue(ports, ueIndex))
+	}
+	if ports, _ := parseRanges(t.DestinationPorts, parsePort); ports != nil {
+		flow.DstPort = uint16(getValue(ports, ueIndex))
+	}
+	return flow
+}
+
+// parseRanges parses the entries, each a single value or an inclusive range
+// of values
+func parseRanges(entries []string, parse func(string) (uint64, error)) ([]valueRange, error) {
+	var ranges []valueRange
+	for _, entry := range entries {
+		bounds := strings.SplitN(entry, "-", 2)
+		start, err := parse(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = parse(strings.TrimSpace(bounds[1]))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid range:%v", entry)
+		}
+		ranges = append(ranges, valueRange{start: start, count: end - start + 1})
+	}
+	return ranges, nil
+}
+
+// getValue returns the value at the index, wrapping around, across the
+// ranges
+func getValue(ranges []valueRange, index int) uint64 {
+	var total uint64
+	for _, r := range ranges {
+		total += r.count
+	}
+	i := uint64(index) % total
+	for _, r := range ranges {
+		if i < r.count {
+			return r.start + i
+		}
+		i -= r.count
+	}
+	return ranges[0].start
+}
+
+func parseIpv4(s string) (uint64, error) {
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return 0, fmt.Errorf("invalid ipv4 address:%v", s)
+	}
+	return uint64(binary.BigEndian.Uint32(ip)), nil
+}
+
+func parsePort(s string) (uint64, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || port == 0 {
+		return 0, fmt.Errorf("invalid port:%v", s)
+	}
+	return port, nil
+}
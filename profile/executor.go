@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package profile
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/omec-project/gnbsim/coordinator"
+	"github.com/omec-project/gnbsim/factory"
+	"github.com/omec-project/gnbsim/logger"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+)
+
+// ueBudget limits the number of UEs executing the profiles at a time, across
+// all the profiles. Unlimited when nil
+var ueBudget chan struct{}
+
+// ExecuteAllProfiles executes the enabled profiles and waits for them to
+// complete. Profiles are executed one after another in the configured order,
+// or concurrently when executed in parallel, in which case a profile starts
+// only once the profiles it is ordered after are complete. The number of UEs
+// executing at a time is capped by the configured budget. In coordinator mode
+// the UEs of each profile are executed by the workers instead
+func ExecuteAllProfiles() {
+	config := factory.AppConfig.Configuration
+	if config.MaxConcurrentUes > 0 {
+		ueBudget = make(chan struct{}, config.MaxConcurrentUes)
+		logger.AppLog.Infoln("UEs executing at a time capped to",
+			config.MaxConcurrentUes)
+	}
+
+	executeProfile := ExecuteProfile
+	if config.Coordinator != nil {
+		executeProfile = coordinator.ExecuteProfile
+		logger.AppLog.Infoln("Coordinator mode, profiles executed by the workers")
+	}
+
+	doneChans := make(map[string]chan struct{})
+	for _, profile := range config.Profiles {
+		if profile.Enable {
+			doneChans[profile.Name] = make(chan struct{})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, profile := range config.Profiles {
+		if !profile.Enable {
+			continue
+		}
+		wg.Add(1)
+		go func(profile *profctx.Profile) {
+			defer wg.Done()
+			defer close(doneChans[profile.Name])
+			for _, name := range profile.StartAfter {
+				if done, ok := doneChans[name]; ok {
+					profile.Log.Infoln("waiting for profile", name, "to complete")
+					<-done
+				}
+			}
+			executeProfile(profile, profctx.SummaryChan)
+		}(profile)
+
+		if !config.ExecInParallel {
+			wg.Wait()
+		}
+	}
+	wg.Wait()
+}
+
+// AbortAllProfiles aborts the enabled profiles, as on the expiry of their
+// profile timeout. The profiles executing fail their UEs in flight and report
+// their summaries, the others report their UEs as not executed
+func AbortAllProfiles() {
+	for _, profile := range factory.AppConfig.Configuration.Profiles {
+		if profile.Enable {
+			profile.Abort()
+		}
+	}
+}
+
+// acquireUeBudget waits until the UE may execute within the budget, it returns
+// false if the profile is aborted meanwhile
+func acquireUeBudget(profile *profctx.Profile) bool {
+	if ueBudget == nil {
+		return true
+	}
+	select {
+	case ueBudget <- struct{}{}:
+		return true
+	case <-profile.AbortChan:
+		return false
+	}
+}
+
+// releaseUeBudget returns the budget held by a UE once it is complete
+func releaseUeBudget() {
+	if ueBudget != nil {
+		<-ueBudget
+	}
+}
+
+// ValidateProfileOrder checks that the profiles refer to the existing profiles
+// in the ordering constraints, and that the constraints are satisfiable. When
+// the profiles are executed sequentially, the profiles are expected to be
+// configured after the ones they are ordered after
+func ValidateProfileOrder() []error {
+	config := factory.AppConfig.Configuration
+	var errs []error
+	index := make(map[string]int)
+	for i, profile := range config.Profiles {
+		index[profile.Name] = i
+	}
+
+	for i, profile := range config.Profiles {
+		for _, name := range profile.StartAfter {
+			j, ok := index[name]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("profile %v: start after unknown profile %v",
+					profile.Name, name))
+			case j == i:
+				errs = append(errs, fmt.Errorf("profile %v: start after itself",
+					profile.Name))
+			case j > i && !config.ExecInParallel:
+				errs = append(errs, fmt.Errorf("profile %v: start after profile %v configured later, profiles executed sequentially",
+					profile.Name, name))
+			}
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+
+	// Depth first search for the cycles in the ordering constraints
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var visit func(profile *profctx.Profile) bool
+	visit = func(profile *profctx.Profile) bool {
+		switch state[profile.Name] {
+		case visiting:
+			return false
+		case visited:
+			return true
+		}
+		state[profile.Name] = visiting
+		for _, name := range profile.StartAfter {
+			if !visit(config.Profiles[index[name]]) {
+				return false
+			}
+		}
+		state[profile.Name] = visited
+		return true
+	}
+	for _, profile := range config.Profiles {
+		if state[profile.Name] == unvisited && !visit(profile) {
+			errs = append(errs, fmt.Errorf("profile %v: cyclic start after order",
+				profile.Name))
+			break
+		}
+	}
+	return errs
+}
@@ -6,12 +6,16 @@
 package httprouter
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/omec-project/gnbsim/common"
 	"github.com/omec-project/gnbsim/logger"
+	"github.com/omec-project/gnbsim/notifier"
 	profile "github.com/omec-project/gnbsim/profile"
 	profCtx "github.com/omec-project/gnbsim/profile/context"
+	"github.com/omec-project/gnbsim/simue"
 	"github.com/omec-project/openapi"
 	"github.com/omec-project/openapi/models"
 )
@@ -49,5 +53,92 @@ func HTTPExecuteProfile(c *gin.Context) {
 	logger.HttpLog.Debugf("%#v", prof)
 
 	prof.Init()
-	go profile.ExecuteProfile(&prof, profCtx.SummaryChan)
+	if c.Query("wait") != "true" {
+		go profile.ExecuteProfile(&prof, profCtx.SummaryChan)
+		return
+	}
+
+	// Responds with the summary once the profile is complete, as requested by
+	// the coordinator. The summary is logged by the worker as well
+	summaryChan := make(chan common.InterfaceMessage, 1)
+	profile.ExecuteProfile(&prof, summaryChan)
+	msg := (<-summaryChan).(*common.SummaryMessage)
+	profCtx.SummaryChan <- msg
+	c.JSON(http.StatusOK, notifier.GetProfileSummary(msg))
+}
+
+// HTTPGetStateDump returns the live state of the active UEs and the gNBs
+func HTTPGetStateDump(c *gin.Context) {
+	logger.HttpLog.Infoln("GetStateDump API called")
+	c.JSON(http.StatusOK, simue.GetStateDump())
+}
+
+// HTTPGetTimeline returns the timelines of the UEs selected by the supi query
+// parameters, of all the recorded UEs when none is selected. The format query
+// parameter selects json, the default, or plantuml
+func HTTPGetTimeline(c *gin.Context) {
+	logger.HttpLog.Infoln("GetTimeline API called")
+	timelines := simue.GetUeTimelines(c.QueryArray("supi"))
+	switch format := c.DefaultQuery("format", simue.TIMELINE_FORMAT_JSON); format {
+	case simue.TIMELINE_FORMAT_JSON:
+		c.JSON(http.StatusOK, timelines)
+	case simue.TIMELINE_FORMAT_PLANTUML:
+		c.String(http.StatusOK, simue.GetTimelinePlantUml(timelines))
+	default:
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: "invalid timeline format: " + format,
+		}
+		logger.HttpLog.Errorln(rsp.Detail)
+		c.JSON(http.StatusBadRequest, rsp)
+	}
+}
+
+// LogLevelRequest sets the log level of a module, of a profile and its UEs,
+// or the global log level when neither is provided. An empty level removes
+// the level set for the module or the profile
+type LogLevelRequest struct {
+	Level   string `json:"level"`
+	Module  string `json:"module"`
+	Profile string `json:"profile"`
+}
+
+// HTTPGetLogLevels returns the global log level and the levels set for the
+// modules and the profiles
+func HTTPGetLogLevels(c *gin.Context) {
+	logger.HttpLog.Infoln("GetLogLevels API called")
+	c.JSON(http.StatusOK, logger.GetLogLevels())
+}
+
+// HTTPSetLogLevel sets a log level at runtime
+func HTTPSetLogLevel(c *gin.Context) {
+	logger.HttpLog.Infoln("SetLogLevel API called")
+	var req LogLevelRequest
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		switch {
+		case req.Module != "" && req.Profile != "":
+			err = fmt.Errorf("module and profile are mutually exclusive")
+		case req.Module != "":
+			err = logger.SetModuleLogLevel(req.Module, req.Level)
+		case req.Profile != "":
+			err = logger.SetProfileLogLevel(req.Profile, req.Level)
+		default:
+			err = logger.SetGlobalLogLevel(req.Level)
+		}
+	}
+	if err != nil {
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: err.Error(),
+		}
+		logger.HttpLog.Errorln(rsp.Detail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+	logger.HttpLog.Infof("Log level set to %q, module:%q, profile:%q",
+		req.Level, req.Module, req.Profile)
+	c.JSON(http.StatusOK, logger.GetLogLevels())
 }
@@ -76,4 +76,32 @@ var routes = Routes{
 		"/executeProfile",
 		HTTPExecuteProfile,
 	},
+
+	{
+		"GetStateDump",
+		"GET",
+		"/dump",
+		HTTPGetStateDump,
+	},
+
+	{
+		"GetTimeline",
+		"GET",
+		"/timeline",
+		HTTPGetTimeline,
+	},
+
+	{
+		"GetLogLevels",
+		"GET",
+		"/logLevel",
+		HTTPGetLogLevels,
+	},
+
+	{
+		"SetLogLevel",
+		"PUT",
+		"/logLevel",
+		HTTPSetLogLevel,
+	},
 }
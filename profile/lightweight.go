@@ -0,0 +1,326 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package profile
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/gnodeb/worker/gnbcpueworker"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	"github.com/omec-project/gnbsim/profile/util"
+	"github.com/omec-project/gnbsim/realue"
+	"github.com/omec-project/gnbsim/simue"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+const (
+	// Interval at which the UEs in flight are checked against the per user
+	// timeout in the lightweight mode
+	LIGHTWEIGHT_SWEEP_INTERVAL = time.Second
+
+	// Longest wait of a lightweight UE worker between two passes over its
+	// UEs, while none of them has an event pending
+	LIGHTWEIGHT_MAX_IDLE_WAIT = time.Millisecond
+
+	// UEs queued to a lightweight UE worker before the burst waits for it
+	LIGHTWEIGHT_WORKER_QUEUE = 64
+)
+
+// lightweightUe is a UE in flight in the lightweight mode
+type lightweightUe struct {
+	simUe *simuectx.SimUe
+	start time.Time
+}
+
+// drivenUe holds the contexts of a UE driven by a lightweight UE worker, and
+// whether each of them has terminated
+type drivenUe struct {
+	simUe      *simuectx.SimUe
+	gnbUe      *gnbctx.GnbCpUe
+	simUeDone  bool
+	realUeDone bool
+	gnbUeDone  bool
+}
+
+// step passes at most one pending event to each of the contexts of the UE and
+// returns true if any event was pending. The events of the contexts which have
+// terminated are discarded, so that no handler blocks on sending to them
+func (ue *drivenUe) step() (pending bool) {
+	select {
+	case msg := <-ue.simUe.ReadChan:
+		pending = true
+		if !ue.simUeDone {
+			ue.simUeDone = simue.HandleEvent(ue.simUe, msg)
+		}
+	default:
+	}
+
+	select {
+	case msg := <-ue.simUe.RealUe.ReadChan:
+		pending = true
+		if !ue.realUeDone {
+			ue.realUeDone = realue.HandleEvent(ue.simUe.RealUe, msg)
+		}
+	default:
+	}
+
+	select {
+	case msg := <-ue.gnbUe.ReadChan:
+		pending = true
+		if !ue.gnbUeDone {
+			ue.gnbUeDone = gnbcpueworker.HandleEvent(ue.gnbUe, msg)
+		}
+	default:
+	}
+	return pending
+}
+
+func (ue *drivenUe) done() bool {
+	return ue.simUeDone && ue.realUeDone && ue.gnbUeDone
+}
+
+// lightweightWorker drives the state machines of its share of the UEs from a
+// single routine, in place of the SimUe, RealUe and gNB UE routines of each
+// UE. The contexts of a UE exchange one event at a time, the buffers of their
+// channels absorb the sends between them, so that a handler does not block
+// on a context driven by the same worker
+type lightweightWorker struct {
+	// UEs assigned to the worker, closed at the end of the burst
+	addChan chan *drivenUe
+
+	ues []*drivenUe
+}
+
+func newLightweightWorker() *lightweightWorker {
+	return &lightweightWorker{
+		addChan: make(chan *drivenUe, LIGHTWEIGHT_WORKER_QUEUE),
+	}
+}
+
+// run passes the pending events to the UEs of the worker in turns, until all
+// the UEs assigned to it have terminated. The worker waits increasingly
+// longer, up to LIGHTWEIGHT_MAX_IDLE_WAIT, while its UEs are idle
+func (w *lightweightWorker) run() {
+	var idle time.Duration
+	for w.accept() || len(w.ues) != 0 {
+		pending := false
+		ues := w.ues[:0]
+		for _, ue := range w.ues {
+			if ue.step() {
+				pending = true
+			}
+			if ue.done() {
+				simue.Detach(ue.simUe)
+				continue
+			}
+			ues = append(ues, ue)
+		}
+		for i := len(ues); i < len(w.ues); i++ {
+			w.ues[i] = nil
+		}
+		w.ues = ues
+
+		if pending {
+			idle = 0
+			continue
+		}
+		idle = 2*idle + 10*time.Microsecond
+		if idle > LIGHTWEIGHT_MAX_IDLE_WAIT {
+			idle = LIGHTWEIGHT_MAX_IDLE_WAIT
+		}
+		time.Sleep(idle)
+	}
+}
+
+// accept adds the UEs assigned to the worker since the previous pass. Returns
+// false once no more UE is to be assigned
+func (w *lightweightWorker) accept() bool {
+	for w.addChan != nil {
+		select {
+		case ue, ok := <-w.addChan:
+			if !ok {
+				w.addChan = nil
+				return false
+			}
+			w.ues = append(w.ues, ue)
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// executeLightweight executes the UEs of the profile in the lightweight mode.
+// The UEs are started in one burst by a single routine, within the UE budget,
+// and their results are collected by the calling routine. Unlike
+// ExecuteSimUe, no routine or timer is held per UE while it executes. The UEs
+// are driven by one lightweight UE worker per CPU and the per user timeout is
+// enforced by periodically sweeping the UEs in flight
+func executeLightweight(profile *profctx.Profile, gnb *gnbctx.GNodeB,
+	imsis []string, summary *common.SummaryMessage, collectUeResults bool) {
+
+	var mu sync.Mutex
+	inFlight := make(map[string]*lightweightUe, len(imsis))
+
+	workers := make([]*lightweightWorker, runtime.NumCPU())
+	var workerWg sync.WaitGroup
+	for i := range workers {
+		workers[i] = newLightweightWorker()
+		workerWg.Add(1)
+		go func(w *lightweightWorker) {
+			defer workerWg.Done()
+			w.run()
+		}(workers[i])
+	}
+
+	// Count of the UEs started, sent once the burst is over
+	started := make(chan int, 1)
+	go func() {
+		count := 0
+		for i, imsi := range imsis {
+			if isAborted(profile) || !acquireUeBudget(profile) {
+				break
+			}
+			simUe := simuectx.NewSimUe("imsi-"+imsi, gnb, profile)
+			simUe.Tac = profile.GetTac(i)
+			simUe.RealUe.Imeisv = profile.GetImeisv(i, imsi)
+
+			mu.Lock()
+			inFlight[simUe.Supi] = &lightweightUe{simUe: simUe, start: time.Now()}
+			mu.Unlock()
+
+			count++
+			gnbUe := simue.Attach(simUe)
+			if gnbUe == nil {
+				continue
+			}
+			workers[i%len(workers)].addChan <- &drivenUe{simUe: simUe, gnbUe: gnbUe}
+			util.SendToSimUe(simUe, common.PROFILE_START_EVENT)
+		}
+		for _, w := range workers {
+			close(w.addChan)
+		}
+		started <- count
+	}()
+
+	recordResult := func(result common.UeResult) {
+		releaseUeBudget()
+		result.Tags = profile.GetUeTags(result.Supi)
+		profile.Stats.RecordResult(result.Tags, result.Error == nil, result.Duration)
+		if result.Error != nil {
+			profile.Log.Infoln("Result: FAIL,", result.Error)
+			summary.UeFailedCount++
+			summary.ErrorList = append(summary.ErrorList, result.Error)
+		} else {
+			profile.Log.Debugf("Result: PASS, imsi:%v, retries:%v", result.Supi,
+				result.Retries)
+			summary.UePassedCount++
+		}
+		if collectUeResults {
+			summary.UeResults = append(summary.UeResults, result)
+		}
+	}
+
+	// failInFlight fails the UEs in flight selected by the filter, the UEs are
+	// requested to quit
+	failInFlight := func(filter func(ue *lightweightUe) bool) int {
+		var failed []*lightweightUe
+		mu.Lock()
+		for supi, ue := range inFlight {
+			if filter(ue) {
+				failed = append(failed, ue)
+				delete(inFlight, supi)
+			}
+		}
+		mu.Unlock()
+
+		for _, ue := range failed {
+			util.SendToSimUe(ue.simUe, common.QUIT_EVENT)
+			recordResult(common.UeResult{
+				Supi:     ue.simUe.Supi,
+				Error:    fmt.Errorf("imsi:%v, profile timeout", ue.simUe.Supi),
+				Duration: time.Since(ue.start),
+			})
+		}
+		return len(failed)
+	}
+
+	timeout := time.Duration(profile.PerUserTimeout) * time.Second
+	sweep := time.NewTicker(LIGHTWEIGHT_SWEEP_INTERVAL)
+	defer sweep.Stop()
+	abortChan := profile.AbortChan
+
+	total, completed := -1, 0
+	for total == -1 || completed < total {
+		select {
+		case total = <-started:
+			started = nil
+			if notExecuted := len(imsis) - total; notExecuted != 0 {
+				err := fmt.Errorf("profile timeout, %v ues not executed", notExecuted)
+				summary.UeFailedCount += uint(notExecuted)
+				summary.ErrorList = append(summary.ErrorList, err)
+			}
+
+		case msg := <-profile.ReadChan:
+			mu.Lock()
+			ue, ok := inFlight[msg.Supi]
+			delete(inFlight, msg.Supi)
+			mu.Unlock()
+			if !ok {
+				// Result of a UE which already timed out
+				continue
+			}
+
+			profile.Stats.RecordNwPduSessEvents(msg.NwPduSessMods, msg.NwPduSessRels)
+			profile.Stats.RecordStageTimes(msg.StageTimes)
+			profile.Stats.RecordRetries(msg.Retries)
+			result := common.UeResult{
+				Supi:       msg.Supi,
+				Duration:   time.Since(ue.start),
+				Retries:    msg.Retries,
+				StageTimes: msg.StageTimes,
+			}
+			if msg.Event == common.PROFILE_FAIL_EVENT {
+				result.Error = fmt.Errorf("imsi:%v, procedure:%v, retries:%v, error:%v",
+					msg.Supi, msg.Proc, msg.Retries, msg.Error)
+				result.Procedure = msg.Proc.String()
+			}
+			recordResult(result)
+			completed++
+
+		case now := <-sweep.C:
+			completed += failInFlight(func(ue *lightweightUe) bool {
+				return now.Sub(ue.start) >= timeout
+			})
+
+		case <-abortChan:
+			abortChan = nil
+			completed += failInFlight(func(ue *lightweightUe) bool {
+				return true
+			})
+		}
+	}
+
+	// Results of the UEs which timed out are discarded until the workers
+	// complete, so that no worker blocks on them. The UEs failed on abort
+	// were requested to quit, hence the workers complete once aborted as well
+	workersDone := make(chan struct{})
+	go func() {
+		workerWg.Wait()
+		close(workersDone)
+	}()
+	for {
+		select {
+		case <-workersDone:
+			return
+		case <-profile.ReadChan:
+		}
+	}
+}
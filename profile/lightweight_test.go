@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package profile
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/logger"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// Number of UEs whose memory is measured, built once per benchmark
+const BENCH_UE_COUNT int = 10000
+
+// newBenchDrivenUes returns the contexts of the UEs of a lightweight profile,
+// as held by the lightweight UE workers
+func newBenchDrivenUes(count int) []*drivenUe {
+	profile := &profctx.Profile{
+		Name:   "bench",
+		Key:    "5122250214c33e723a5dd523fc145fc0",
+		Opc:    "981d464c7c52eb6e5036234984ad0bcf",
+		SeqNum: "16f3b3f70fc2",
+	}
+	gnb := &gnbctx.GNodeB{}
+	ues := make([]*drivenUe, count)
+	for i := range ues {
+		ues[i] = &drivenUe{
+			simUe: simuectx.NewSimUe(fmt.Sprintf("imsi-20893%010d", i), gnb, profile),
+			gnbUe: gnbctx.NewGnbCpUe(int64(i)+1, gnb, nil),
+		}
+	}
+	return ues
+}
+
+// memInUse returns the heap and the stack memory in use, once collected
+func memInUse() int64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapInuse + stats.StackInuse)
+}
+
+// BenchmarkLightweightUeMemory reports the memory held per UE in the
+// lightweight mode, in which the UE holds its contexts and no routine
+func BenchmarkLightweightUeMemory(b *testing.B) {
+	logger.SetLogLevel("error")
+	before := memInUse()
+	ues := newBenchDrivenUes(BENCH_UE_COUNT)
+
+	var inUse int64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inUse = memInUse() - before
+	}
+	b.ReportMetric(float64(inUse)/float64(BENCH_UE_COUNT), "bytes/ue")
+	runtime.KeepAlive(ues)
+}
+
+// BenchmarkRoutineUeMemory reports the memory held per UE when its SimUe,
+// RealUe and gNB UE contexts are driven by a routine each, as outside the
+// lightweight mode. The routines are parked on their channels, the stack
+// grown by the handlers is not accounted
+func BenchmarkRoutineUeMemory(b *testing.B) {
+	logger.SetLogLevel("error")
+	before := memInUse()
+	ues := newBenchDrivenUes(BENCH_UE_COUNT)
+
+	var wg sync.WaitGroup
+	drain := func(ch chan common.InterfaceMessage) {
+		defer wg.Done()
+		for range ch {
+		}
+	}
+	for _, ue := range ues {
+		wg.Add(3)
+		go drain(ue.simUe.ReadChan)
+		go drain(ue.simUe.RealUe.ReadChan)
+		go drain(ue.gnbUe.ReadChan)
+	}
+
+	var inUse int64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inUse = memInUse() - before
+	}
+	b.ReportMetric(float64(inUse)/float64(BENCH_UE_COUNT), "bytes/ue")
+
+	for _, ue := range ues {
+		close(ue.simUe.ReadChan)
+		close(ue.simUe.RealUe.ReadChan)
+		close(ue.gnbUe.ReadChan)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package profile
+
+import (
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	"github.com/omec-project/gnbsim/simue"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// loadUeResult is the result of a UE started by the load schedule
+type loadUeResult struct {
+	stage   int
+	ueIndex int
+	result  common.UeResult
+}
+
+// executeLoadSchedule executes the UEs of the profile as per the stages of its
+// load schedule, one stage after another. An IMSI is executed by one UE at a
+// time, and is reused once the UE completes. The UEs still executing once the
+// last stage ends are waited for. The results are accounted to the stage
+// during which the UEs were started
+func executeLoadSchedule(profile *profctx.Profile, gnb *gnbctx.GNodeB,
+	imsis []string, summary *common.SummaryMessage, collectUeResults bool) {
+
+	stages := make([]common.LoadStageSummary, len(profile.LoadSchedule))
+	for i, loadStage := range profile.LoadSchedule {
+		stages[i].Name = loadStage.GetName(i)
+	}
+	totalLatencies := make([]time.Duration, len(profile.LoadSchedule))
+
+	// Buffered for all the IMSIs, so that the UEs never block on reporting
+	// their results
+	results := make(chan *loadUeResult, len(imsis))
+	idle := make([]int, 0, len(imsis))
+	for i := range imsis {
+		idle = append(idle, i)
+	}
+	active := 0
+	var ueWg sync.WaitGroup
+
+	startUe := func(stage int) {
+		if len(idle) == 0 {
+			stages[stage].UeSkippedCount++
+			return
+		}
+		if !acquireUeBudget(profile) {
+			return
+		}
+		ueIndex := idle[0]
+		idle = idle[1:]
+		active++
+		stages[stage].UeStartedCount++
+		if uint(active) > stages[stage].MaxActiveUes {
+			stages[stage].MaxActiveUes = uint(active)
+		}
+
+		simUe := simuectx.NewSimUe("imsi-"+imsis[ueIndex], gnb, profile)
+		simUe.Tac = profile.GetTac(ueIndex)
+		simUe.TrafficFlow = profile.GetTrafficFlow(ueIndex)
+		simUe.RealUe.Imeisv = profile.GetImeisv(ueIndex, imsis[ueIndex])
+		ueWg.Add(1)
+		go func() {
+			defer ueWg.Done()
+			simue.Init(simUe)
+		}()
+
+		go func() {
+			defer releaseUeBudget()
+			results <- &loadUeResult{
+				stage:   stage,
+				ueIndex: ueIndex,
+				result:  ExecuteSimUe(profile, simUe, simUe.Supi),
+			}
+		}()
+	}
+
+	recordResult := func(loadResult *loadUeResult) {
+		active--
+		idle = append(idle, loadResult.ueIndex)
+
+		result := loadResult.result
+		stage := &stages[loadResult.stage]
+		if result.Error != nil {
+			stage.UeFailedCount++
+			summary.UeFailedCount++
+			summary.ErrorList = append(summary.ErrorList, result.Error)
+		} else {
+			stage.UePassedCount++
+			summary.UePassedCount++
+		}
+		totalLatencies[loadResult.stage] += result.Duration
+		if result.Duration > stage.MaxLatency {
+			stage.MaxLatency = result.Duration
+		}
+		if collectUeResults {
+			result.Tags = profile.GetUeTags(result.Supi)
+			summary.UeResults = append(summary.UeResults, result)
+		}
+	}
+
+	for i, loadStage := range profile.LoadSchedule {
+		if isAborted(profile) {
+			break
+		}
+		profile.Log.Infoln("load stage:", stages[i].Name, ", duration:",
+			loadStage.GetDuration(), ", active ues:", loadStage.ActiveUes,
+			", arrival rate:", loadStage.ArrivalRate)
+
+		fillActiveUes := func() {
+			for active < loadStage.ActiveUes && len(idle) != 0 &&
+				!isAborted(profile) {
+				startUe(i)
+			}
+		}
+
+		stageStart := time.Now()
+		stageTimer := time.NewTimer(loadStage.GetDuration())
+		var ticker *time.Ticker
+		var arrivals <-chan time.Time
+		if interval := loadStage.GetArrivalInterval(); interval != 0 {
+			ticker = time.NewTicker(interval)
+			arrivals = ticker.C
+		}
+		fillActiveUes()
+
+	stageLoop:
+		for {
+			select {
+			case result := <-results:
+				recordResult(result)
+				fillActiveUes()
+			case <-arrivals:
+				startUe(i)
+			case <-stageTimer.C:
+				break stageLoop
+			case <-profile.AbortChan:
+				stageTimer.Stop()
+				break stageLoop
+			}
+		}
+		if ticker != nil {
+			ticker.Stop()
+		}
+		stages[i].Duration = time.Since(stageStart)
+	}
+
+	// UEs of an aborted profile complete on the abort as well
+	for active != 0 {
+		recordResult(<-results)
+	}
+	waitForSimUes(profile, &ueWg)
+
+	for i := range stages {
+		completed := stages[i].UePassedCount + stages[i].UeFailedCount
+		if completed != 0 {
+			stages[i].AvgLatency = totalLatencies[i] / time.Duration(completed)
+		}
+	}
+	summary.LoadStages = stages
+}
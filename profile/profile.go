@@ -7,28 +7,56 @@ package profile
 
 import (
 	"fmt"
-	"strconv"
 	"sync"
 	"time"
 
 	"github.com/omec-project/gnbsim/common"
 	"github.com/omec-project/gnbsim/factory"
+	"github.com/omec-project/gnbsim/logger"
 	profctx "github.com/omec-project/gnbsim/profile/context"
 	"github.com/omec-project/gnbsim/profile/util"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
 	"github.com/omec-project/gnbsim/simue"
 	simuectx "github.com/omec-project/gnbsim/simue/context"
 )
 
 //profile names
 const (
-	REGISTER                string = "register"
-	PDU_SESS_EST            string = "pdusessest"
-	DEREGISTER              string = "deregister"
-	AN_RELEASE              string = "anrelease"
-	UE_TRIGG_SERVICE_REQ    string = "uetriggservicereq"
-	NW_TRIGG_UE_DEREG       string = "nwtriggeruedereg"
-	UE_REQ_PDU_SESS_RELEASE string = "uereqpdusessrelease"
-	NW_REQ_PDU_SESS_RELEASE string = "nwreqpdusessrelease"
+	REGISTER                  string = "register"
+	PDU_SESS_EST              string = "pdusessest"
+	DEREGISTER                string = "deregister"
+	AN_RELEASE                string = "anrelease"
+	UE_TRIGG_SERVICE_REQ      string = "uetriggservicereq"
+	NW_TRIGG_UE_DEREG         string = "nwtriggeruedereg"
+	UE_REQ_PDU_SESS_RELEASE   string = "uereqpdusessrelease"
+	NW_REQ_PDU_SESS_RELEASE   string = "nwreqpdusessrelease"
+	UL_DATA_TRIGG_SERVICE_REQ string = "uldatatriggservicereq"
+	INIT_CTX_SETUP_FAILURE    string = "initctxsetupfailure"
+	RRC_INACTIVE              string = "rrcinactive"
+	SESSION_LIFETIME          string = "sessionlifetime"
+	MOBILITY                  string = "mobility"
+	POWER_OFF_DEREG           string = "poweroffdereg"
+	UE_DISAPPEAR              string = "uedisappear"
+	SMS                       string = "sms"
+	NSSAA                     string = "nssaa"
+
+	// UE ignores the paging for the downlink data a configured number of
+	// times before responding, to test the paging retransmission and the
+	// downlink data notification failure handling in the core
+	PAGING string = "paging"
+
+	// Registration, PDU session, user data, AN release, service request and
+	// deregistration in one pass, for a basic sanity check of the core
+	FULL_FLOW string = "fullflow"
+
+	// Restart of the gNB mid-run, after which the UEs re-register
+	GNB_RESTART string = "gnbrestart"
+
+	// Procedures and expectations are as per the scenario steps
+	SCENARIO string = "scenario"
+
+	// Procedures are driven one at a time through the interactive shell
+	INTERACTIVE string = "interactive"
 )
 
 func InitializeAllProfiles() {
@@ -37,23 +65,101 @@ func InitializeAllProfiles() {
 	}
 }
 
+// LoadAllProvisionedSubscribers discovers the UEs of the profiles configured
+// with the provisioning interface and returns the errors found
+func LoadAllProvisionedSubscribers() []error {
+	var errs []error
+	for _, profile := range factory.AppConfig.Configuration.Profiles {
+		if profile.Provisioning == nil {
+			continue
+		}
+		err := profile.LoadProvisionedSubscribers()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profile %v: %v", profile.Name, err))
+			continue
+		}
+		logger.AppLog.Infoln("profile", profile.Name, "discovered",
+			len(profile.Subscribers), "subscribers through the provisioning interface")
+	}
+	return errs
+}
+
+// InitProfile initializes the event map and procedure list of the profile as
+// per its profile type, applying the event overrides configured in the profile
+func InitProfile(profile *profctx.Profile) error {
+	err := initEventMap(profile)
+	if err != nil {
+		return err
+	}
+	err = applyEventOverrides(profile)
+	if err != nil {
+		return err
+	}
+	return initProcedureList(profile)
+}
+
+// applyEventOverrides replaces the expected transitions of the event map with
+// the ones configured in the profile
+func applyEventOverrides(profile *profctx.Profile) error {
+	if profile.Abnormal != nil && profile.Abnormal.SecModRejectCause != "" {
+		profile.Events[common.SEC_MOD_COMMAND_EVENT] = common.SEC_MOD_REJECT_EVENT
+	}
+	for trigger, expected := range profile.EventOverrides {
+		triggerEvent, err := common.GetEventType(trigger)
+		if err != nil {
+			return fmt.Errorf("invalid event override:%v", err)
+		}
+		expectedEvent, err := common.GetEventType(expected)
+		if err != nil {
+			return fmt.Errorf("invalid event override for %v:%v", trigger, err)
+		}
+		profile.Events[triggerEvent] = expectedEvent
+	}
+	return nil
+}
+
 func ExecuteProfile(profile *profctx.Profile, summaryChan chan common.InterfaceMessage) {
 	summary := &common.SummaryMessage{
 		ProfileType: profile.ProfileType,
 		ProfileName: profile.Name,
 		ErrorList:   make([]error, 0, 10),
+		StartTime:   time.Now(),
 	}
 
 	defer func() {
+		summary.EndTime = time.Now()
+		if profile.DataPlane != nil {
+			summary.DataPlane = profile.DataPlane.Summary(
+				summary.EndTime.Sub(summary.StartTime))
+		}
+		if profile.Stats != nil {
+			summary.NwPduSessMods = profile.Stats.NwPduSessMods
+			summary.NwPduSessRels = profile.Stats.NwPduSessRels
+			summary.Retries = profile.Stats.Retries
+			summary.StageTimings = profile.Stats.GetStageTimings()
+			summary.Tags = profile.Stats.GetTagSummaries()
+		}
+		if err := realuectx.FlushStores(); err != nil {
+			profile.Log.Errorln("FlushStores returned:", err)
+		}
+		if profile.EventHook != nil {
+			profile.EventHook.Close()
+		}
 		summaryChan <- summary
 	}()
 
-	err := initEventMap(profile)
+	webhook := factory.AppConfig.Configuration.Webhook
+	collectUeResults := (webhook != nil && webhook.IncludeUeResults) ||
+		factory.AppConfig.Configuration.ResultFile != "" ||
+		factory.AppConfig.Configuration.ResultCsvFile != ""
+
+	err := profile.LoadProvisionedSubscribers()
 	if err != nil {
 		summary.ErrorList = append(summary.ErrorList, err)
 		return
 	}
-	err = initProcedureList(profile)
+
+	err = ValidateProfile(profile)
 	if err != nil {
 		summary.ErrorList = append(summary.ErrorList, err)
 		return
@@ -66,11 +172,24 @@ func ExecuteProfile(profile *profctx.Profile, summaryChan chan common.InterfaceM
 		return
 	}
 
-	imsi, err := strconv.Atoi(profile.StartImsi)
-	if err != nil {
-		err = fmt.Errorf("invalid imsi value:%v", profile.StartImsi)
-		summary.ErrorList = append(summary.ErrorList, err)
-		return
+	var imsis []string
+	var pooledSimUes []*simuectx.SimUe
+	ueCount := profile.UeCount
+	if profile.UePool != "" {
+		pooledSimUes = simue.AcquireFromUePool(profile.UePool, profile.UeCount)
+		if len(pooledSimUes) == 0 {
+			err = fmt.Errorf("no ue available in ue pool:%v", profile.UePool)
+			summary.ErrorList = append(summary.ErrorList, err)
+			return
+		}
+		ueCount = len(pooledSimUes)
+	} else {
+		imsis, err = profile.GetImsis()
+		if err != nil {
+			summary.ErrorList = append(summary.ErrorList, err)
+			return
+		}
+		ueCount = len(imsis)
 	}
 
 	profile.Log.Infoln("executing profile:", profile.Name,
@@ -80,70 +199,210 @@ func ExecuteProfile(profile *profctx.Profile, summaryChan chan common.InterfaceM
 		profile.PerUserTimeout = profctx.PER_USER_TIMEOUT
 	}
 
-	var wg sync.WaitGroup
+	profile.InitAbort()
+	if profile.ProfileTimeout != 0 {
+		timeout := time.Duration(profile.ProfileTimeout) * time.Second
+		timer := time.AfterFunc(timeout, func() {
+			profile.Log.Errorln("profile timeout expired, aborting the ues in flight")
+			profile.Abort()
+		})
+		defer timer.Stop()
+	}
+
+	if len(profile.LoadSchedule) != 0 {
+		executeLoadSchedule(profile, gnb, imsis, summary, collectUeResults)
+		if isAborted(profile) {
+			discardResults(profile)
+		}
+		return
+	}
+
+	if profile.Lightweight {
+		executeLightweight(profile, gnb, imsis, summary, collectUeResults)
+		if isAborted(profile) {
+			discardResults(profile)
+		}
+		return
+	}
+
+	// wg tracks the UEs executing the profile, ueWg tracks the SimUe routines
+	// which are not waited for once the profile times out
+	var wg, ueWg sync.WaitGroup
 	var Mu sync.Mutex
 	// Currently executing profile for one IMSI at a time
-	for count := 1; count <= profile.UeCount; count++ {
-		imsiStr := "imsi-" + strconv.Itoa(imsi)
-		simUe := simuectx.NewSimUe(imsiStr, gnb, profile)
-		imsi++
+	for count := 1; count <= ueCount; count++ {
+		// Waits for the UEs of the other profiles to complete, when the
+		// budget of UEs executing at a time is exhausted
+		if isAborted(profile) || !acquireUeBudget(profile) {
+			err = fmt.Errorf("profile timeout, %v ues not executed",
+				ueCount-count+1)
+			Mu.Lock()
+			summary.UeFailedCount += uint(ueCount - count + 1)
+			summary.ErrorList = append(summary.ErrorList, err)
+			Mu.Unlock()
+			break
+		}
 
-		wg.Add(1)
-		go func(simUe *simuectx.SimUe) {
-			defer wg.Done()
-			simue.Init(simUe)
-		}(simUe)
+		var simUe *simuectx.SimUe
+		if pooledSimUes != nil {
+			simUe = pooledSimUes[count-1]
+			simUe.AttachProfile(profile)
+			simUe.TrafficFlow = profile.GetTrafficFlow(count - 1)
+		} else {
+			simUe = simuectx.NewSimUe("imsi-"+imsis[count-1], gnb, profile)
+			simUe.Tac = profile.GetTac(count - 1)
+			simUe.TrafficFlow = profile.GetTrafficFlow(count - 1)
+			simUe.RealUe.Imeisv = profile.GetImeisv(count-1, imsis[count-1])
+
+			if profile.PublishUePool != "" {
+				// SimUe outlives the profile once added to the UE pool
+				go simue.Init(simUe)
+			} else {
+				ueWg.Add(1)
+				go func(simUe *simuectx.SimUe) {
+					defer ueWg.Done()
+					simue.Init(simUe)
+				}(simUe)
+			}
+		}
 
 		wg.Add(1)
 		go func(simUe *simuectx.SimUe) {
 			defer wg.Done()
-			err := ExecuteSimUe(profile, simUe, imsiStr)
+			defer releaseUeBudget()
+			result := ExecuteSimUe(profile, simUe, simUe.Supi)
 			Mu.Lock()
-			if err != nil {
+			if result.Error != nil {
 				summary.UeFailedCount++
-				summary.ErrorList = append(summary.ErrorList, err)
+				summary.ErrorList = append(summary.ErrorList, result.Error)
 			} else {
 				summary.UePassedCount++
 			}
+			if collectUeResults {
+				result.Tags = profile.GetUeTags(simUe.Supi)
+				summary.UeResults = append(summary.UeResults, result)
+			}
 			Mu.Unlock()
 		}(simUe)
 
 		if profile.ExecInParallel == false {
 			wg.Wait()
+			waitForSimUes(profile, &ueWg)
 		}
 	}
 	if profile.ExecInParallel == true {
 		wg.Wait()
+		waitForSimUes(profile, &ueWg)
+	}
+
+	if isAborted(profile) {
+		discardResults(profile)
+	}
+}
+
+// discardResults discards the results still sent by the aborted SimUes, so
+// that they do not block
+func discardResults(profile *profctx.Profile) {
+	go func(ch chan *common.ProfileMessage) {
+		for range ch {
+		}
+	}(profile.ReadChan)
+}
+
+func isAborted(profile *profctx.Profile) bool {
+	select {
+	case <-profile.AbortChan:
+		return true
+	default:
+		return false
 	}
 }
 
-func ExecuteSimUe(profile *profctx.Profile, simUe *simuectx.SimUe, imsiStr string) error {
+// waitForSimUes waits for the SimUe routines to terminate, or for the profile
+// timeout to expire
+func waitForSimUes(profile *profctx.Profile, ueWg *sync.WaitGroup) {
+	doneChan := make(chan struct{})
+	go func() {
+		ueWg.Wait()
+		close(doneChan)
+	}()
 
-	var err error
+	select {
+	case <-doneChan:
+	case <-profile.AbortChan:
+	}
+}
 
+// ExecuteSimUe starts the profile on the UE and waits for its result, which
+// includes the time taken by the UE to complete the profile and each of the
+// procedures, and the count of the failed procedures retried by the UE
+func ExecuteSimUe(profile *profctx.Profile, simUe *simuectx.SimUe,
+	imsiStr string) common.UeResult {
+
+	// Data plane stats, retries, stage times and procedure are those reported
+	// by the UE in its result
+	result := common.UeResult{Supi: imsiStr}
+
+	// Result is read on a channel of the UE, so that it is not taken by
+	// another UE of the profile executing in parallel. Buffered, so that the
+	// UE does not block on reporting a result no longer waited for
+	resultChan := make(chan *common.ProfileMessage, 1)
+	simUe.WriteProfileChan = resultChan
 	util.SendToSimUe(simUe, common.PROFILE_START_EVENT)
 
+	startTime := time.Now()
 	timeout := time.Duration(profile.PerUserTimeout) * time.Second
 	ticker := time.NewTicker(timeout)
 
 	select {
 	case <-ticker.C:
-		err = fmt.Errorf("imsi:%v, profile timeout", imsiStr)
-		profile.Log.Infoln("Result: FAIL,", err)
+		result.Error = fmt.Errorf("imsi:%v, profile timeout", imsiStr)
+		profile.Log.Infoln("Result: FAIL,", result.Error)
+		util.SendToSimUe(simUe, common.QUIT_EVENT)
+
+	case <-profile.AbortChan:
+		result.Error = fmt.Errorf("imsi:%v, profile timeout", imsiStr)
+		profile.Log.Infoln("Result: FAIL,", result.Error)
 		util.SendToSimUe(simUe, common.QUIT_EVENT)
 
-	case msg := <-profile.ReadChan:
+	case msg := <-resultChan:
+		result.Supi = msg.Supi
+		result.DataStats = msg.DataStats
+		result.Retries = msg.Retries
+		result.StageTimes = msg.StageTimes
+		profile.Stats.RecordNwPduSessEvents(msg.NwPduSessMods, msg.NwPduSessRels)
+		profile.Stats.RecordStageTimes(msg.StageTimes)
+		profile.Stats.RecordRetries(msg.Retries)
+		if len(msg.PagingTimes) != 0 {
+			profile.Log.Infof("Paging, imsi:%v, attempts:%v, times:%v", msg.Supi,
+				len(msg.PagingTimes), msg.PagingTimes)
+		}
 		switch msg.Event {
 		case common.PROFILE_PASS_EVENT:
-			profile.Log.Infoln("Result: PASS, imsi:", msg.Supi)
+			profile.Log.Infof("Result: PASS, imsi:%v, retries:%v", msg.Supi,
+				msg.Retries)
 		case common.PROFILE_FAIL_EVENT:
-			err := fmt.Errorf("imsi:%v, procedure:%v, error:%v", msg.Supi, msg.Proc, msg.Error)
-			profile.Log.Infoln("Result: FAIL,", err)
+			result.Error = fmt.Errorf("imsi:%v, procedure:%v, retries:%v, error:%v",
+				msg.Supi, msg.Proc, msg.Retries, msg.Error)
+			result.Procedure = msg.Proc.String()
+			profile.Log.Infoln("Result: FAIL,", result.Error)
 		}
 	}
 	ticker.Stop()
+	result.Duration = time.Since(startTime)
+	profile.Stats.RecordResult(profile.GetUeTags(result.Supi), result.Error == nil,
+		result.Duration)
+	profile.DataPlane.Record(result.DataStats)
+	if dataStats := result.DataStats; dataStats != nil {
+		ul, dl := dataStats.GetThroughput()
+		rtts := dataStats.GetRttPercentiles(50, 99)
+		profile.Log.Infof("Data plane, imsi:%v, UL: %v packets %.0f bps, "+
+			"DL: %v packets %.0f bps, RTT P50: %v, P99: %v, jitter: %v", result.Supi,
+			dataStats.UlPkts, ul, dataStats.DlPkts, dl, rtts[0], rtts[1],
+			dataStats.Jitter)
+	}
 	time.Sleep(2 * time.Second)
-	return err
+	return result
 }
 
 func initEventMap(profile *profctx.Profile) error {
@@ -178,7 +437,76 @@ func initEventMap(profile *profctx.Profile) error {
 			common.PDU_SESS_REL_COMMAND_EVENT: common.PDU_SESS_REL_COMPLETE_EVENT,
 			common.PROFILE_PASS_EVENT:         common.QUIT_EVENT,
 		}
-	case DEREGISTER:
+	case SESSION_LIFETIME:
+		profile.Events = map[common.EventType]common.EventType{
+			common.REG_REQUEST_EVENT:           common.AUTH_REQUEST_EVENT,
+			common.AUTH_REQUEST_EVENT:          common.AUTH_RESPONSE_EVENT,
+			common.SEC_MOD_COMMAND_EVENT:       common.SEC_MOD_COMPLETE_EVENT,
+			common.REG_ACCEPT_EVENT:            common.REG_COMPLETE_EVENT,
+			common.PDU_SESS_EST_REQUEST_EVENT:  common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_EST_ACCEPT_EVENT:   common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_REL_REQUEST_EVENT:  common.PDU_SESS_REL_COMMAND_EVENT,
+			common.PDU_SESS_REL_COMMAND_EVENT:  common.PDU_SESS_REL_COMPLETE_EVENT,
+			common.DEREG_REQUEST_UE_ORIG_EVENT: common.DEREG_ACCEPT_UE_ORIG_EVENT,
+			common.PROFILE_PASS_EVENT:          common.QUIT_EVENT,
+		}
+	case MOBILITY:
+		profile.Events = map[common.EventType]common.EventType{
+			common.REG_REQUEST_EVENT:           common.AUTH_REQUEST_EVENT,
+			common.AUTH_REQUEST_EVENT:          common.AUTH_RESPONSE_EVENT,
+			common.SEC_MOD_COMMAND_EVENT:       common.SEC_MOD_COMPLETE_EVENT,
+			common.REG_ACCEPT_EVENT:            common.REG_COMPLETE_EVENT,
+			common.PDU_SESS_EST_REQUEST_EVENT:  common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_EST_ACCEPT_EVENT:   common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.TRIGGER_AN_RELEASE_EVENT:    common.CONNECTION_RELEASE_REQUEST_EVENT,
+			common.DEREG_REQUEST_UE_ORIG_EVENT: common.DEREG_ACCEPT_UE_ORIG_EVENT,
+			common.PROFILE_PASS_EVENT:          common.QUIT_EVENT,
+		}
+	case POWER_OFF_DEREG:
+		// No Deregistration Accept is expected for switch off
+		profile.Events = map[common.EventType]common.EventType{
+			common.REG_REQUEST_EVENT:          common.AUTH_REQUEST_EVENT,
+			common.AUTH_REQUEST_EVENT:         common.AUTH_RESPONSE_EVENT,
+			common.SEC_MOD_COMMAND_EVENT:      common.SEC_MOD_COMPLETE_EVENT,
+			common.REG_ACCEPT_EVENT:           common.REG_COMPLETE_EVENT,
+			common.PDU_SESS_EST_REQUEST_EVENT: common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_EST_ACCEPT_EVENT:  common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PROFILE_PASS_EVENT:         common.QUIT_EVENT,
+		}
+	case SMS, NSSAA:
+		profile.Events = map[common.EventType]common.EventType{
+			common.REG_REQUEST_EVENT:           common.AUTH_REQUEST_EVENT,
+			common.AUTH_REQUEST_EVENT:          common.AUTH_RESPONSE_EVENT,
+			common.SEC_MOD_COMMAND_EVENT:       common.SEC_MOD_COMPLETE_EVENT,
+			common.REG_ACCEPT_EVENT:            common.REG_COMPLETE_EVENT,
+			common.DEREG_REQUEST_UE_ORIG_EVENT: common.DEREG_ACCEPT_UE_ORIG_EVENT,
+			common.PROFILE_PASS_EVENT:          common.QUIT_EVENT,
+		}
+	case UE_DISAPPEAR:
+		profile.Events = map[common.EventType]common.EventType{
+			common.REG_REQUEST_EVENT:          common.AUTH_REQUEST_EVENT,
+			common.AUTH_REQUEST_EVENT:         common.AUTH_RESPONSE_EVENT,
+			common.SEC_MOD_COMMAND_EVENT:      common.SEC_MOD_COMPLETE_EVENT,
+			common.REG_ACCEPT_EVENT:           common.REG_COMPLETE_EVENT,
+			common.PDU_SESS_EST_REQUEST_EVENT: common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_EST_ACCEPT_EVENT:  common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.TRIGGER_AN_RELEASE_EVENT:   common.CONNECTION_RELEASE_REQUEST_EVENT,
+			common.PROFILE_PASS_EVENT:         common.QUIT_EVENT,
+		}
+	case FULL_FLOW:
+		profile.Events = map[common.EventType]common.EventType{
+			common.REG_REQUEST_EVENT:           common.AUTH_REQUEST_EVENT,
+			common.AUTH_REQUEST_EVENT:          common.AUTH_RESPONSE_EVENT,
+			common.SEC_MOD_COMMAND_EVENT:       common.SEC_MOD_COMPLETE_EVENT,
+			common.REG_ACCEPT_EVENT:            common.REG_COMPLETE_EVENT,
+			common.PDU_SESS_EST_REQUEST_EVENT:  common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_EST_ACCEPT_EVENT:   common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.TRIGGER_AN_RELEASE_EVENT:    common.CONNECTION_RELEASE_REQUEST_EVENT,
+			common.SERVICE_REQUEST_EVENT:       common.SERVICE_ACCEPT_EVENT,
+			common.DEREG_REQUEST_UE_ORIG_EVENT: common.DEREG_ACCEPT_UE_ORIG_EVENT,
+			common.PROFILE_PASS_EVENT:          common.QUIT_EVENT,
+		}
+	case DEREGISTER, GNB_RESTART:
 		profile.Events = map[common.EventType]common.EventType{
 			common.REG_REQUEST_EVENT:           common.AUTH_REQUEST_EVENT,
 			common.AUTH_REQUEST_EVENT:          common.AUTH_RESPONSE_EVENT,
@@ -200,7 +528,7 @@ func initEventMap(profile *profctx.Profile) error {
 			common.TRIGGER_AN_RELEASE_EVENT:   common.CONNECTION_RELEASE_REQUEST_EVENT,
 			common.PROFILE_PASS_EVENT:         common.QUIT_EVENT,
 		}
-	case UE_TRIGG_SERVICE_REQ:
+	case UE_TRIGG_SERVICE_REQ, UL_DATA_TRIGG_SERVICE_REQ, PAGING:
 		profile.Events = map[common.EventType]common.EventType{
 			common.REG_REQUEST_EVENT:          common.AUTH_REQUEST_EVENT,
 			common.AUTH_REQUEST_EVENT:         common.AUTH_RESPONSE_EVENT,
@@ -212,6 +540,30 @@ func initEventMap(profile *profctx.Profile) error {
 			common.TRIGGER_AN_RELEASE_EVENT:   common.CONNECTION_RELEASE_REQUEST_EVENT,
 			common.PROFILE_PASS_EVENT:         common.QUIT_EVENT,
 		}
+	case INIT_CTX_SETUP_FAILURE:
+		profile.Events = map[common.EventType]common.EventType{
+			common.REG_REQUEST_EVENT:                       common.AUTH_REQUEST_EVENT,
+			common.AUTH_REQUEST_EVENT:                      common.AUTH_RESPONSE_EVENT,
+			common.SEC_MOD_COMMAND_EVENT:                   common.SEC_MOD_COMPLETE_EVENT,
+			common.REG_ACCEPT_EVENT:                        common.REG_COMPLETE_EVENT,
+			common.PDU_SESS_EST_REQUEST_EVENT:              common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_EST_ACCEPT_EVENT:               common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.TRIGGER_AN_RELEASE_EVENT:                common.CONNECTION_RELEASE_REQUEST_EVENT,
+			common.TRIGGER_INITIAL_CTX_SETUP_FAILURE_EVENT: common.CONNECTION_RELEASE_REQUEST_EVENT,
+			common.PROFILE_PASS_EVENT:                      common.QUIT_EVENT,
+		}
+	case RRC_INACTIVE:
+		profile.Events = map[common.EventType]common.EventType{
+			common.REG_REQUEST_EVENT:                     common.AUTH_REQUEST_EVENT,
+			common.AUTH_REQUEST_EVENT:                    common.AUTH_RESPONSE_EVENT,
+			common.SEC_MOD_COMMAND_EVENT:                 common.SEC_MOD_COMPLETE_EVENT,
+			common.REG_ACCEPT_EVENT:                      common.REG_COMPLETE_EVENT,
+			common.PDU_SESS_EST_REQUEST_EVENT:            common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_EST_ACCEPT_EVENT:             common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.TRIGGER_RRC_INACTIVE_TRANSITION_EVENT: common.RRC_INACTIVE_TRANSITION_REPORT_EVENT,
+			common.TRIGGER_RRC_RESUME_EVENT:              common.RRC_INACTIVE_TRANSITION_REPORT_EVENT,
+			common.PROFILE_PASS_EVENT:                    common.QUIT_EVENT,
+		}
 	case NW_TRIGG_UE_DEREG:
 		profile.Events = map[common.EventType]common.EventType{
 			common.REG_REQUEST_EVENT:           common.AUTH_REQUEST_EVENT,
@@ -234,6 +586,53 @@ func initEventMap(profile *profctx.Profile) error {
 			common.PDU_SESS_REL_COMMAND_EVENT: common.PDU_SESS_REL_COMPLETE_EVENT,
 			common.PROFILE_PASS_EVENT:         common.QUIT_EVENT,
 		}
+	case INTERACTIVE:
+		profile.Events = map[common.EventType]common.EventType{
+			common.REG_REQUEST_EVENT:                       common.AUTH_REQUEST_EVENT,
+			common.AUTH_REQUEST_EVENT:                      common.AUTH_RESPONSE_EVENT,
+			common.SEC_MOD_COMMAND_EVENT:                   common.SEC_MOD_COMPLETE_EVENT,
+			common.REG_ACCEPT_EVENT:                        common.REG_COMPLETE_EVENT,
+			common.PDU_SESS_EST_REQUEST_EVENT:              common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_EST_ACCEPT_EVENT:               common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_REL_REQUEST_EVENT:              common.PDU_SESS_REL_COMMAND_EVENT,
+			common.PDU_SESS_REL_COMMAND_EVENT:              common.PDU_SESS_REL_COMPLETE_EVENT,
+			common.DEREG_REQUEST_UE_ORIG_EVENT:             common.DEREG_ACCEPT_UE_ORIG_EVENT,
+			common.DEREG_REQUEST_UE_TERM_EVENT:             common.DEREG_ACCEPT_UE_TERM_EVENT,
+			common.SERVICE_REQUEST_EVENT:                   common.SERVICE_ACCEPT_EVENT,
+			common.TRIGGER_AN_RELEASE_EVENT:                common.CONNECTION_RELEASE_REQUEST_EVENT,
+			common.TRIGGER_INITIAL_CTX_SETUP_FAILURE_EVENT: common.CONNECTION_RELEASE_REQUEST_EVENT,
+			common.TRIGGER_RRC_INACTIVE_TRANSITION_EVENT:   common.RRC_INACTIVE_TRANSITION_REPORT_EVENT,
+			common.TRIGGER_RRC_RESUME_EVENT:                common.RRC_INACTIVE_TRANSITION_REPORT_EVENT,
+			// UE remains active, waiting for the next command
+			common.PROFILE_PASS_EVENT: common.PROFILE_PASS_EVENT,
+		}
+	case SCENARIO:
+		profile.Events = map[common.EventType]common.EventType{
+			common.REG_REQUEST_EVENT:                       common.AUTH_REQUEST_EVENT,
+			common.AUTH_REQUEST_EVENT:                      common.AUTH_RESPONSE_EVENT,
+			common.SEC_MOD_COMMAND_EVENT:                   common.SEC_MOD_COMPLETE_EVENT,
+			common.REG_ACCEPT_EVENT:                        common.REG_COMPLETE_EVENT,
+			common.PDU_SESS_EST_REQUEST_EVENT:              common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_EST_ACCEPT_EVENT:               common.PDU_SESS_EST_ACCEPT_EVENT,
+			common.PDU_SESS_REL_REQUEST_EVENT:              common.PDU_SESS_REL_COMMAND_EVENT,
+			common.PDU_SESS_REL_COMMAND_EVENT:              common.PDU_SESS_REL_COMPLETE_EVENT,
+			common.DEREG_REQUEST_UE_ORIG_EVENT:             common.DEREG_ACCEPT_UE_ORIG_EVENT,
+			common.DEREG_REQUEST_UE_TERM_EVENT:             common.DEREG_ACCEPT_UE_TERM_EVENT,
+			common.SERVICE_REQUEST_EVENT:                   common.SERVICE_ACCEPT_EVENT,
+			common.TRIGGER_AN_RELEASE_EVENT:                common.CONNECTION_RELEASE_REQUEST_EVENT,
+			common.TRIGGER_INITIAL_CTX_SETUP_FAILURE_EVENT: common.CONNECTION_RELEASE_REQUEST_EVENT,
+			common.TRIGGER_RRC_INACTIVE_TRANSITION_EVENT:   common.RRC_INACTIVE_TRANSITION_REPORT_EVENT,
+			common.TRIGGER_RRC_RESUME_EVENT:                common.RRC_INACTIVE_TRANSITION_REPORT_EVENT,
+			common.PROFILE_PASS_EVENT:                      common.QUIT_EVENT,
+		}
+		// Expectations of the steps are compiled into the event map
+		_, events, err := profile.CompileScenario()
+		if err != nil {
+			return err
+		}
+		for trigger, expected := range events {
+			profile.Events[trigger] = expected
+		}
 	default:
 		return fmt.Errorf("profile type not supported: %v", profile.ProfileType)
 	}
@@ -250,6 +649,80 @@ func initProcedureList(profile *profctx.Profile) error {
 			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
 			common.USER_DATA_PKT_GENERATION_PROCEDURE,
 		}
+	case SESSION_LIFETIME:
+		if profile.SessionLifetime == nil {
+			return fmt.Errorf("session lifetime not configured")
+		}
+		endProcedure := common.UE_INITIATED_DEREGISTRATION_PROCEDURE
+		if profile.SessionLifetime.EndAction == profctx.END_ACTION_RELEASE {
+			endProcedure = common.UE_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE
+		}
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+			common.SESSION_HOLD_PROCEDURE,
+			endProcedure,
+		}
+	case MOBILITY:
+		if len(profile.Mobility) == 0 {
+			return fmt.Errorf("mobility not configured")
+		}
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+			common.USER_DATA_PKT_GENERATION_PROCEDURE,
+			common.MOBILITY_PROCEDURE,
+			common.UE_INITIATED_DEREGISTRATION_PROCEDURE,
+		}
+	case POWER_OFF_DEREG:
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+			common.USER_DATA_PKT_GENERATION_PROCEDURE,
+			common.UE_POWER_OFF_DEREGISTRATION_PROCEDURE,
+		}
+	case SMS:
+		if profile.Sms == nil {
+			return fmt.Errorf("sms not configured")
+		}
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.SMS_PROCEDURE,
+			common.UE_INITIATED_DEREGISTRATION_PROCEDURE,
+		}
+	case NSSAA:
+		if len(profile.Nssaa) == 0 {
+			return fmt.Errorf("nssaa not configured")
+		}
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.NSSAA_PROCEDURE,
+			common.UE_INITIATED_DEREGISTRATION_PROCEDURE,
+		}
+	case UE_DISAPPEAR:
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+			common.USER_DATA_PKT_GENERATION_PROCEDURE,
+			common.UE_DISAPPEARANCE_PROCEDURE,
+		}
+	case FULL_FLOW:
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+			common.USER_DATA_PKT_GENERATION_PROCEDURE,
+			common.AN_RELEASE_PROCEDURE,
+			common.UE_TRIGGERED_SERVICE_REQUEST_PROCEDURE,
+			common.UE_INITIATED_DEREGISTRATION_PROCEDURE,
+		}
+	case GNB_RESTART:
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+			common.USER_DATA_PKT_GENERATION_PROCEDURE,
+			common.GNB_RESTART_PROCEDURE,
+			common.UE_INITIATED_DEREGISTRATION_PROCEDURE,
+		}
 	case DEREGISTER:
 		profile.Procedures = []common.ProcedureType{
 			common.REGISTRATION_PROCEDURE,
@@ -272,6 +745,38 @@ func initProcedureList(profile *profctx.Profile) error {
 			common.AN_RELEASE_PROCEDURE,
 			common.UE_TRIGGERED_SERVICE_REQUEST_PROCEDURE,
 		}
+	case UL_DATA_TRIGG_SERVICE_REQ:
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+			common.USER_DATA_PKT_GENERATION_PROCEDURE,
+			common.AN_RELEASE_PROCEDURE,
+			common.UL_DATA_TRIGGERED_SERVICE_REQUEST_PROCEDURE,
+		}
+	case PAGING:
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+			common.USER_DATA_PKT_GENERATION_PROCEDURE,
+			common.AN_RELEASE_PROCEDURE,
+			common.NW_TRIGGERED_SERVICE_REQUEST_PROCEDURE,
+		}
+	case INIT_CTX_SETUP_FAILURE:
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+			common.USER_DATA_PKT_GENERATION_PROCEDURE,
+			common.AN_RELEASE_PROCEDURE,
+			common.INITIAL_CTX_SETUP_FAILURE_PROCEDURE,
+		}
+	case RRC_INACTIVE:
+		profile.Procedures = []common.ProcedureType{
+			common.REGISTRATION_PROCEDURE,
+			common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+			common.RRC_INACTIVE_TRANSITION_PROCEDURE,
+			common.RRC_RESUME_PROCEDURE,
+			common.USER_DATA_PKT_GENERATION_PROCEDURE,
+		}
 	case NW_TRIGG_UE_DEREG:
 		profile.Procedures = []common.ProcedureType{
 			common.REGISTRATION_PROCEDURE,
@@ -293,6 +798,15 @@ func initProcedureList(profile *profctx.Profile) error {
 			common.USER_DATA_PKT_GENERATION_PROCEDURE,
 			common.NW_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE,
 		}
+	case INTERACTIVE:
+		// Procedures are executed as and when directed by the shell
+		profile.Procedures = nil
+	case SCENARIO:
+		procedures, _, err := profile.CompileScenario()
+		if err != nil {
+			return err
+		}
+		profile.Procedures = procedures
 	default:
 		return fmt.Errorf("profile type not supported: %v", profile.ProfileType)
 	}
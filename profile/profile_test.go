@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package profile
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/logger"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// fakeSimUe stands in for the SimUe routine, it reports the result once the
+// profile is started on the UE and the delay has passed
+func fakeSimUe(simUe *simuectx.SimUe, delay time.Duration, event common.EventType,
+	retries uint) {
+
+	<-simUe.ReadChan
+	time.Sleep(delay)
+	msg := &common.ProfileMessage{}
+	msg.Event = event
+	msg.Supi = simUe.Supi
+	msg.Retries = retries
+	if event == common.PROFILE_FAIL_EVENT {
+		msg.Error = fmt.Errorf("failed")
+	}
+	simUe.WriteProfileChan <- msg
+}
+
+// TestExecuteSimUeParallel verifies that the UEs executing the profile in
+// parallel each get their own result, whichever completes first
+func TestExecuteSimUeParallel(t *testing.T) {
+	logger.SetLogLevel("error")
+	profile := &profctx.Profile{
+		Name:           "parallel",
+		Key:            "5122250214c33e723a5dd523fc145fc0",
+		Opc:            "981d464c7c52eb6e5036234984ad0bcf",
+		SeqNum:         "16f3b3f70fc2",
+		PerUserTimeout: 10,
+	}
+	profile.Init()
+	gnb := &gnbctx.GNodeB{}
+
+	tests := []struct {
+		supi    string
+		delay   time.Duration
+		event   common.EventType
+		retries uint
+	}{
+		{"imsi-208930000000001", 500 * time.Millisecond, common.PROFILE_FAIL_EVENT, 2},
+		{"imsi-208930000000002", 0, common.PROFILE_PASS_EVENT, 0},
+	}
+
+	results := make([]common.UeResult, len(tests))
+	var wg sync.WaitGroup
+	for i, tc := range tests {
+		simUe := simuectx.NewSimUe(tc.supi, gnb, profile)
+		go fakeSimUe(simUe, tc.delay, tc.event, tc.retries)
+		wg.Add(1)
+		go func(i int, simUe *simuectx.SimUe) {
+			defer wg.Done()
+			results[i] = ExecuteSimUe(profile, simUe, simUe.Supi)
+		}(i, simUe)
+	}
+	wg.Wait()
+
+	for i, tc := range tests {
+		result := results[i]
+		if result.Supi != tc.supi {
+			t.Errorf("result of %v has supi %v", tc.supi, result.Supi)
+		}
+		failed := tc.event == common.PROFILE_FAIL_EVENT
+		if (result.Error != nil) != failed {
+			t.Errorf("result of %v has error %v, expected failure: %v", tc.supi,
+				result.Error, failed)
+		}
+		if result.Retries != tc.retries {
+			t.Errorf("result of %v has %v retries, expected %v", tc.supi,
+				result.Retries, tc.retries)
+		}
+	}
+}
@@ -0,0 +1,751 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package profile
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/factory"
+	"github.com/omec-project/gnbsim/logger"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+	"github.com/omec-project/gnbsim/simue"
+	"github.com/omec-project/gnbsim/util/test"
+)
+
+const (
+	MAX_IMSI_LENGTH int = 15
+
+	// Number of digits of the IMEISV and of the type allocation code
+	IMEISV_LENGTH   int = 16
+	IMEI_TAC_LENGTH int = 8
+
+	// Lengths in bytes of the hex encoded subscriber keys
+	KEY_LENGTH     int = 16
+	OPC_LENGTH     int = 16
+	SEQ_NUM_LENGTH int = 6
+)
+
+// ValidateAllProfiles validates each of the configured profiles and returns
+// the errors found. The cells of the gNodeBs are expected to be initialized
+func ValidateAllProfiles() []error {
+	var errs []error
+	publishedPools := make(map[string]bool)
+	for _, profile := range factory.AppConfig.Configuration.Profiles {
+		err := ValidateProfile(profile)
+		if err == nil && profile.UePool != "" && !publishedPools[profile.UePool] {
+			err = fmt.Errorf("ue pool %v not published by an earlier profile",
+				profile.UePool)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profile %v: %v", profile.Name, err))
+		}
+		if profile.PublishUePool != "" {
+			publishedPools[profile.PublishUePool] = true
+		}
+	}
+	errs = append(errs, ValidateProfileOrder()...)
+	if len(errs) == 0 {
+		errs = ValidateImsiOverlap()
+	}
+	return errs
+}
+
+// imsiRange is the inclusive range of the IMSIs allocated by a profile
+type imsiRange struct {
+	profile *profctx.Profile
+	first   uint64
+	last    uint64
+}
+
+// ValidateImsiOverlap checks that the enabled profiles do not allocate the
+// same IMSIs when the profiles are executed in parallel. Profiles taking UEs
+// from a pool do not allocate IMSIs. With AutoOffsetImsi set, the range of a
+// profile using the start imsi is moved past the ranges of the earlier
+// profiles it overlaps with.
+// The IMSI ranges of the individual profiles are expected to be valid
+func ValidateImsiOverlap() []error {
+	config := factory.AppConfig.Configuration
+	if !config.ExecInParallel {
+		return nil
+	}
+
+	var errs []error
+	var ranges []imsiRange
+	for _, profile := range config.Profiles {
+		if !profile.Enable || profile.UePool != "" {
+			continue
+		}
+
+		// IMSIs listed explicitly are expected to match the provisioned
+		// subscribers, hence not moved
+		if len(profile.Imsis) != 0 {
+			imsis, err := profile.GetImsis()
+			if err != nil {
+				continue
+			}
+			listRanges := getImsiListRanges(profile, imsis)
+			for _, r := range listRanges {
+				if conflict := findImsiOverlap(ranges, r); conflict != nil {
+					errs = append(errs, imsiOverlapError(r, conflict))
+					break
+				}
+			}
+			ranges = append(ranges, listRanges...)
+			continue
+		}
+
+		first, err := strconv.ParseUint(profile.StartImsi, 10, 64)
+		if err != nil || profile.UeCount <= 0 {
+			continue
+		}
+		r := imsiRange{
+			profile: profile,
+			first:   first,
+			last:    first + uint64(profile.UeCount) - 1,
+		}
+
+		for {
+			conflict := findImsiOverlap(ranges, r)
+			if conflict == nil {
+				break
+			}
+			if !config.AutoOffsetImsi {
+				errs = append(errs, imsiOverlapError(r, conflict))
+				break
+			}
+			r.first = conflict.last + 1
+			r.last = r.first + uint64(profile.UeCount) - 1
+		}
+
+		if r.first != first {
+			startImsi := fmt.Sprintf("%0*d", len(profile.StartImsi), r.first)
+			logger.ProfileLog.WithField(logger.FieldProfile, profile.Name).
+				Infof("start imsi moved from %v to %v to avoid the overlapping imsi ranges",
+					profile.StartImsi, startImsi)
+			profile.StartImsi = startImsi
+			err = validateImsiRange(profile)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("profile %v: %v", profile.Name, err))
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return errs
+}
+
+// getImsiListRanges coalesces the consecutive IMSIs of the imsi list into
+// ranges
+func getImsiListRanges(profile *profctx.Profile, imsis []string) []imsiRange {
+	var values []uint64
+	for _, imsi := range imsis {
+		value, err := strconv.ParseUint(imsi, 10, 64)
+		if err == nil {
+			values = append(values, value)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	var ranges []imsiRange
+	for _, value := range values {
+		if n := len(ranges); n != 0 && ranges[n-1].last+1 == value {
+			ranges[n-1].last = value
+			continue
+		}
+		ranges = append(ranges, imsiRange{profile: profile, first: value, last: value})
+	}
+	return ranges
+}
+
+func imsiOverlapError(r imsiRange, conflict *imsiRange) error {
+	return fmt.Errorf("profile %v: imsi range %v-%v overlaps with the imsi range %v-%v of profile %v",
+		r.profile.Name, r.first, r.last, conflict.first, conflict.last,
+		conflict.profile.Name)
+}
+
+func findImsiOverlap(ranges []imsiRange, r imsiRange) *imsiRange {
+	for i := range ranges {
+		if r.first <= ranges[i].last && ranges[i].first <= r.last {
+			return &ranges[i]
+		}
+	}
+	return nil
+}
+
+// ValidateProfile initializes the event map and procedure list of the profile
+// and checks its configuration, including the references to the gNodeB
+func ValidateProfile(profile *profctx.Profile) error {
+	err := InitProfile(profile)
+	if err != nil {
+		return err
+	}
+
+	gnb, err := factory.AppConfig.Configuration.GetGNodeB(profile.GnbName)
+	if err != nil {
+		return fmt.Errorf("Failed to fetch gNB context: %v", err)
+	}
+
+	// UEs taken from a pool retain the identity and keys assigned by the
+	// profile which created them
+	if profile.UePool == "" {
+		err = validateUeIdentity(profile)
+		if err != nil {
+			return err
+		}
+	} else if profile.UeCount < 0 {
+		return fmt.Errorf("invalid ue count:%v", profile.UeCount)
+	}
+
+	for _, cause := range []string{profile.IcsFailureCause,
+		profile.UeCtxRelReqCause, profile.UeCtxModFailureCause,
+		profile.RadioLinkFailureCause, profile.HandoverRequiredCause,
+		profile.HandoverFailureCause} {
+		if cause == "" {
+			continue
+		}
+		_, err = test.GetNgapCause(cause)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = profile.ValidateWaits()
+	if err != nil {
+		return err
+	}
+
+	if profile.ExpectedPduSessEstRejectCause != "" {
+		_, err = test.GetCause5GSM(profile.ExpectedPduSessEstRejectCause)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = profile.GetExpectedUeIpSubnet()
+	if err != nil {
+		return err
+	}
+	_, _, err = profile.GetExpectedSessionAmbr()
+	if err != nil {
+		return err
+	}
+
+	switch profile.NasRelease {
+	case 0, realuectx.NAS_RELEASE_15, realuectx.NAS_RELEASE_16, realuectx.NAS_RELEASE_17:
+	default:
+		return fmt.Errorf("unsupported nas release:%v", profile.NasRelease)
+	}
+
+	tacs := profile.Tacs
+	if len(tacs) == 0 {
+		tacs = []string{""}
+	}
+	for _, tac := range tacs {
+		_, err = gnb.GetServingCell(0, tac, profile.GetServingPlmn())
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, change := range profile.CellChanges {
+		_, err = gnb.GetCell(change.NrCellId)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = profile.GetRegRejectRetryType()
+	if err != nil {
+		return err
+	}
+
+	_, err = profile.GetRegistrationType()
+	if err != nil {
+		return err
+	}
+
+	_, err = profile.GetUeRadioCapability()
+	if err != nil {
+		return err
+	}
+
+	err = validateImeisv(profile)
+	if err != nil {
+		return err
+	}
+	_, err = profile.GetCapability5GMM()
+	if err != nil {
+		return err
+	}
+
+	err = validateMobility(profile, gnb.GnbName)
+	if err != nil {
+		return err
+	}
+
+	err = profile.LoadUeTags()
+	if err != nil {
+		return err
+	}
+
+	err = logger.ValidateLogLevel(profile.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level:%v", err)
+	}
+
+	if profile.Sms != nil {
+		err = profile.Sms.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, slice := range profile.Nssaa {
+		err = slice.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.Ladn != nil {
+		presence, err := profile.Ladn.GetPresence()
+		if err != nil {
+			return err
+		}
+		if presence == profctx.LADN_PRESENCE_AUTO && len(profile.Tacs) == 0 {
+			return fmt.Errorf("tacs not configured, required to find the ladn presence")
+		}
+	}
+
+	if profile.Traffic != nil {
+		err = profile.Traffic.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range profile.UplinkDataPduSessions {
+		if id < 1 || id > 15 {
+			return fmt.Errorf("invalid uplink data pdu session id:%v, valid range is 1 to 15", id)
+		}
+	}
+
+	if profile.Abnormal != nil {
+		_, err = profile.Abnormal.GetSecModRejectCause()
+		if err != nil {
+			return err
+		}
+		_, err = profile.Abnormal.GetDeregOnEvent()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.Impairment != nil {
+		err = profile.Impairment.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.RetryPolicy != nil {
+		err = profile.RetryPolicy.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.Pco != nil {
+		err = profile.Pco.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.Ims != nil {
+		err = profile.Ims.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.Ciot != nil {
+		err = profile.Ciot.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.Timeline != nil {
+		err = profile.Timeline.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.CallFlow != nil {
+		err = profile.CallFlow.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.NasPadding != nil {
+		err = profile.NasPadding.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.Golden != nil {
+		err = profile.Golden.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.NasTimers != nil {
+		err = profile.NasTimers.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.EventHook != nil {
+		err = profile.EventHook.Validate()
+		if err != nil {
+			return err
+		}
+		handler := profile.EventHook.Handler
+		if handler != "" && simue.GetEventHook(handler) == nil {
+			return fmt.Errorf("event hook handler not registered:%v", handler)
+		}
+	}
+
+	if len(profile.LoadSchedule) != 0 {
+		if profile.UePool != "" || profile.PublishUePool != "" {
+			return fmt.Errorf("load schedule not supported with ue pool")
+		}
+
+		// Stages are checked against the number of UEs, known once the
+		// subscribers are discovered
+		if !subscribersPending(profile) {
+			imsis, err := profile.GetImsis()
+			if err != nil {
+				return err
+			}
+			for i, stage := range profile.LoadSchedule {
+				err = stage.Validate(len(imsis))
+				if err != nil {
+					return fmt.Errorf("load stage %v: %v", i+1, err)
+				}
+			}
+		}
+	}
+
+	if profile.Lightweight {
+		err = validateLightweight(profile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.SessionLifetime != nil {
+		maxLifetime, err := profile.SessionLifetime.Validate()
+		if err != nil {
+			return err
+		}
+		timeout := profile.PerUserTimeout
+		if timeout == 0 {
+			timeout = profctx.PER_USER_TIMEOUT
+		}
+		if maxLifetime >= time.Duration(timeout)*time.Second {
+			return fmt.Errorf("session lifetime:%v exceeds per user timeout:%v seconds",
+				maxLifetime, timeout)
+		}
+	}
+	return nil
+}
+
+// subscribersPending tells whether the UEs of the profile are the subscribers
+// discovered through the provisioning interface, not fetched yet
+func subscribersPending(profile *profctx.Profile) bool {
+	return profile.Provisioning != nil && profile.Subscribers == nil &&
+		profile.StartImsi == "" && len(profile.Imsis) == 0
+}
+
+func validateUeIdentity(profile *profctx.Profile) error {
+	// Subscribers are not fetched when the configuration is validated
+	// offline, their keys are checked once fetched at run time
+	if profile.Provisioning != nil && profile.Subscribers == nil {
+		err := profile.Provisioning.Validate()
+		if err != nil || subscribersPending(profile) {
+			return err
+		}
+		return validateImsiRange(profile)
+	}
+
+	err := validateImsiRange(profile)
+	if err != nil {
+		return err
+	}
+	if profile.Provisioning != nil {
+		return validateSubscribers(profile)
+	}
+
+	err = validateHexValue("key", profile.Key, KEY_LENGTH)
+	if err != nil {
+		return err
+	}
+	err = validateHexValue("opc", profile.Opc, OPC_LENGTH)
+	if err != nil {
+		return err
+	}
+	if profile.SeqNum != "" {
+		return validateHexValue("sequence number", profile.SeqNum, SEQ_NUM_LENGTH)
+	}
+	return nil
+}
+
+// validateSubscribers checks that the keys of each UE are discovered through
+// the provisioning interface
+func validateSubscribers(profile *profctx.Profile) error {
+	err := profile.Provisioning.Validate()
+	if err != nil {
+		return err
+	}
+	imsis, err := profile.GetImsis()
+	if err != nil {
+		return err
+	}
+	for _, imsi := range imsis {
+		subscriber := profile.GetSubscriber(imsi)
+		if subscriber == nil {
+			return fmt.Errorf("subscriber imsi-%v not discovered through the provisioning interface",
+				imsi)
+		}
+		err = validateHexValue("key", subscriber.Key, KEY_LENGTH)
+		if err == nil {
+			err = validateHexValue("opc", subscriber.Opc, OPC_LENGTH)
+		}
+		if err == nil && subscriber.SeqNum != "" {
+			err = validateHexValue("sequence number", subscriber.SeqNum, SEQ_NUM_LENGTH)
+		}
+		if err != nil {
+			return fmt.Errorf("subscriber imsi-%v: %v", imsi, err)
+		}
+	}
+	return nil
+}
+
+// validateImsiRange checks that all the IMSIs allocated to the UEs of the
+// profile are valid
+func validateImsiRange(profile *profctx.Profile) error {
+	if len(profile.Imsis) != 0 {
+		return validateImsiList(profile)
+	}
+
+	imsi, err := strconv.ParseUint(profile.StartImsi, 10, 64)
+	if err != nil || len(profile.StartImsi) > MAX_IMSI_LENGTH {
+		return fmt.Errorf("invalid imsi value:%v, expected up to %v digits",
+			profile.StartImsi, MAX_IMSI_LENGTH)
+	}
+	if profile.UeCount <= 0 {
+		return fmt.Errorf("invalid ue count:%v, expected a positive value",
+			profile.UeCount)
+	}
+
+	lastImsi := fmt.Sprintf("%0*d", len(profile.StartImsi),
+		imsi+uint64(profile.UeCount)-1)
+	if len(lastImsi) > MAX_IMSI_LENGTH {
+		return fmt.Errorf("imsi range starting at %v exceeds %v digits for ue count:%v",
+			profile.StartImsi, MAX_IMSI_LENGTH, profile.UeCount)
+	}
+
+	if profile.Plmn == nil {
+		return fmt.Errorf("plmn id not configured")
+	}
+	homePlmn := profile.Plmn.Mcc + profile.Plmn.Mnc
+	for _, imsi := range []string{profile.StartImsi, lastImsi} {
+		if !strings.HasPrefix(imsi, homePlmn) {
+			return fmt.Errorf("imsi value:%v does not start with the plmn id:%v",
+				imsi, homePlmn)
+		}
+	}
+	return nil
+}
+
+// validateImsiList checks the IMSIs expanded from the imsi list of the
+// profile, which replaces the start imsi
+func validateImsiList(profile *profctx.Profile) error {
+	if profile.StartImsi != "" {
+		return fmt.Errorf("start imsi and imsi list are mutually exclusive")
+	}
+	imsis, err := profile.GetImsis()
+	if err != nil {
+		return err
+	}
+	if len(imsis) == 0 {
+		return fmt.Errorf("imsi list is empty")
+	}
+	if profile.UeCount != 0 && profile.UeCount != len(imsis) {
+		return fmt.Errorf("ue count:%v does not match the %v imsis in the imsi list",
+			profile.UeCount, len(imsis))
+	}
+
+	if profile.Plmn == nil {
+		return fmt.Errorf("plmn id not configured")
+	}
+	homePlmn := profile.Plmn.Mcc + profile.Plmn.Mnc
+	seen := make(map[string]bool)
+	for _, imsi := range imsis {
+		if len(imsi) > MAX_IMSI_LENGTH {
+			return fmt.Errorf("invalid imsi value:%v, expected up to %v digits",
+				imsi, MAX_IMSI_LENGTH)
+		}
+		if !strings.HasPrefix(imsi, homePlmn) {
+			return fmt.Errorf("imsi value:%v does not start with the plmn id:%v",
+				imsi, homePlmn)
+		}
+		if seen[imsi] {
+			return fmt.Errorf("imsi value:%v repeated in the imsi list", imsi)
+		}
+		seen[imsi] = true
+	}
+	return nil
+}
+
+// validateImeisv checks the IMEISV or the TAC from which the IMEISVs of the
+// UEs are generated
+func validateImeisv(profile *profctx.Profile) error {
+	if profile.Imeisv != "" && profile.ImeiTac != "" {
+		return fmt.Errorf("imeisv and imei tac are mutually exclusive")
+	}
+	for _, v := range []struct {
+		name   string
+		value  string
+		length int
+	}{
+		{"imeisv", profile.Imeisv, IMEISV_LENGTH},
+		{"imei tac", profile.ImeiTac, IMEI_TAC_LENGTH},
+	} {
+		if v.value == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(v.value, 10, 64); err != nil || len(v.value) != v.length {
+			return fmt.Errorf("invalid %v:%v, expected %v digits", v.name,
+				v.value, v.length)
+		}
+	}
+	return nil
+}
+
+// validateMobility checks that the target gNB and cell of each mobility step
+// exist, and that the steps complete within the per user timeout
+func validateMobility(profile *profctx.Profile, servingGnbName string) error {
+	var total time.Duration
+	for i, step := range profile.Mobility {
+		_, err := step.GetProcedure()
+		if err != nil {
+			return fmt.Errorf("mobility step %v: %v", i+1, err)
+		}
+		outcome, err := step.GetOutcome()
+		if err != nil {
+			return fmt.Errorf("mobility step %v: %v", i+1, err)
+		}
+
+		// Target gNB defaults to the one serving the UE after the previous
+		// step
+		targetGnbName := servingGnbName
+		if step.GnbName != "" {
+			targetGnbName = step.GnbName
+		}
+		gnb, err := factory.AppConfig.Configuration.GetGNodeB(targetGnbName)
+		if err != nil {
+			return fmt.Errorf("mobility step %v: %v", i+1, err)
+		}
+		if step.NrCellId != "" {
+			_, err = gnb.GetCell(step.NrCellId)
+		} else if len(gnb.Cells) == 0 {
+			err = fmt.Errorf("no cell configured for gnb:%v", targetGnbName)
+		}
+		if err != nil {
+			return fmt.Errorf("mobility step %v: %v", i+1, err)
+		}
+		if outcome != profctx.MOBILITY_OUTCOME_SUCCESS &&
+			targetGnbName == servingGnbName {
+			return fmt.Errorf("mobility step %v: outcome:%v requires a target gnb other than the serving gnb:%v",
+				i+1, outcome, servingGnbName)
+		}
+
+		// UE remains in the source cell when the handover is aborted
+		if outcome == profctx.MOBILITY_OUTCOME_SUCCESS {
+			servingGnbName = targetGnbName
+		}
+		total += time.Duration(step.Delay) * time.Millisecond
+	}
+
+	timeout := profile.PerUserTimeout
+	if timeout == 0 {
+		timeout = profctx.PER_USER_TIMEOUT
+	}
+	if total >= time.Duration(timeout)*time.Second {
+		return fmt.Errorf("mobility duration:%v exceeds per user timeout:%v seconds",
+			total, timeout)
+	}
+	return nil
+}
+
+// validateLightweight checks that the profile relies on none of the per UE
+// fidelity dropped in the lightweight mode
+func validateLightweight(profile *profctx.Profile) error {
+	switch {
+	case profile.UePool != "" || profile.PublishUePool != "":
+		return fmt.Errorf("lightweight mode not supported with ue pool")
+	case len(profile.LoadSchedule) != 0:
+		return fmt.Errorf("lightweight mode not supported with load schedule")
+	case profile.SessionLifetime != nil:
+		return fmt.Errorf("lightweight mode not supported with session lifetime")
+	case profile.Timeline != nil:
+		return fmt.Errorf("lightweight mode not supported with timeline")
+	case profile.CallFlow != nil:
+		return fmt.Errorf("lightweight mode not supported with call flow")
+	case len(profile.CellChanges) != 0 || len(profile.Mobility) != 0:
+		return fmt.Errorf("lightweight mode not supported with cell changes or mobility")
+	case profile.ProfileType == INTERACTIVE, profile.ProfileType == RRC_INACTIVE,
+		profile.ProfileType == MOBILITY, profile.ProfileType == GNB_RESTART:
+		return fmt.Errorf("lightweight mode not supported by profile type:%v",
+			profile.ProfileType)
+	}
+
+	// UEs share the routines of the lightweight UE workers, the procedures
+	// waiting in the UE routine or starting routines of their own are not
+	// supported
+	for _, step := range profile.Scenario {
+		procedure, _ := common.GetProcedureType(step.Procedure)
+		switch procedure {
+		case common.RRC_RESUME_PROCEDURE, common.MOBILITY_PROCEDURE,
+			common.GNB_RESTART_PROCEDURE:
+			return fmt.Errorf("lightweight mode not supported with scenario procedure:%v",
+				step.Procedure)
+		}
+	}
+	return nil
+}
+
+func validateHexValue(name, value string, length int) error {
+	b, err := hex.DecodeString(value)
+	if err != nil || len(b) != length {
+		return fmt.Errorf("invalid %v:%v, expected %v hex digits", name, value,
+			2*length)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"github.com/omec-project/nas/nasType"
+)
+
+// Bits of the first value octet of the 5GMM capability IE, TS 24.501 Section
+// 9.11.3.1, indicating the CIoT 5GS optimizations supported by the UE
+const (
+	CAPABILITY_5GMM_RESTRICT_EC uint8 = 0x08
+	CAPABILITY_5GMM_CP_CIOT     uint8 = 0x10
+	CAPABILITY_5GMM_N3_DATA     uint8 = 0x20
+	CAPABILITY_5GMM_IPHC_CP     uint8 = 0x40
+)
+
+// CiotCapability holds the CIoT 5GS optimizations indicated by the UE, and
+// whether the user data of the PDU session to the DNN of the profile is
+// carried over NAS
+type CiotCapability struct {
+	ControlPlane      bool
+	HeaderCompression bool
+	N3Data            bool
+	RestrictEc        bool
+	DataOverNas       bool
+}
+
+// apply sets the CIoT bits of the 5GMM capability as per the capability of
+// the UE, clearing those of the optimizations not supported
+func (c *CiotCapability) apply(capability5GMM *nasType.Capability5GMM) {
+	bits := []struct {
+		mask      uint8
+		supported bool
+	}{
+		{CAPABILITY_5GMM_RESTRICT_EC, c.RestrictEc},
+		{CAPABILITY_5GMM_CP_CIOT, c.ControlPlane},
+		{CAPABILITY_5GMM_N3_DATA, c.N3Data},
+		{CAPABILITY_5GMM_IPHC_CP, c.HeaderCompression},
+	}
+	for _, bit := range bits {
+		if bit.supported {
+			capability5GMM.Octet[0] |= bit.mask
+		} else {
+			capability5GMM.Octet[0] &^= bit.mask
+		}
+	}
+}
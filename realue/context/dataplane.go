@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+)
+
+// Gain of the interarrival jitter estimator, RFC 3550 Section 6.4.1
+const JITTER_GAIN time.Duration = 16
+
+// StartBurst starts measuring the user plane KPIs of a burst of user data
+func (pduSess *PduSession) StartBurst() {
+	pduSess.DataStats = common.DataPlaneStats{}
+	pduSess.BurstStart = time.Now()
+	pduSess.EchoSendTimes = make(map[int]time.Time)
+	pduSess.PrevRtt = 0
+}
+
+// EndBurst returns the user plane KPIs of the burst of user data
+func (pduSess *PduSession) EndBurst() *common.DataPlaneStats {
+	stats := pduSess.DataStats
+	stats.Duration = time.Since(pduSess.BurstStart)
+	return &stats
+}
+
+// RecordUlPkt records an uplink packet of the provided length
+func (pduSess *PduSession) RecordUlPkt(length int) {
+	pduSess.DataStats.UlPkts++
+	pduSess.DataStats.UlBytes += uint64(length)
+}
+
+// RecordDlPkt records a downlink packet of the provided length
+func (pduSess *PduSession) RecordDlPkt(length int) {
+	pduSess.DataStats.DlPkts++
+	pduSess.DataStats.DlBytes += uint64(length)
+}
+
+// RecordEchoRequest records the uplink echo request, or DNS query, with the
+// sequence number, so that the round trip time is measured once the reply is
+// received
+func (pduSess *PduSession) RecordEchoRequest(seq int, length int) {
+	pduSess.RecordUlPkt(length)
+	if pduSess.EchoSendTimes != nil {
+		// Sequence number is 16 bits on the wire
+		pduSess.EchoSendTimes[seq&0xffff] = time.Now()
+	}
+}
+
+// RecordEchoReply records the round trip time of the echo request, or DNS
+// query, with the sequence number
+func (pduSess *PduSession) RecordEchoReply(seq int) {
+	sent, ok := pduSess.EchoSendTimes[seq&0xffff]
+	if !ok {
+		return
+	}
+	delete(pduSess.EchoSendTimes, seq&0xffff)
+	pduSess.RecordRtt(time.Since(sent))
+}
+
+// RecordRtt records the round trip time and updates the jitter estimate
+func (pduSess *PduSession) RecordRtt(rtt time.Duration) {
+	stats := &pduSess.DataStats
+	stats.Rtts = append(stats.Rtts, rtt)
+	if pduSess.PrevRtt != 0 {
+		d := rtt - pduSess.PrevRtt
+		if d < 0 {
+			d = -d
+		}
+		stats.Jitter += (d - stats.Jitter) / JITTER_GAIN
+	}
+	pduSess.PrevRtt = rtt
+}
@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"strings"
+
+	"github.com/omec-project/openapi/models"
+)
+
+// NssaaCredentials are the EAP credentials with which the UE authenticates for
+// the S-NSSAI during the network slice-specific authentication. The
+// authentication is expected to fail when ExpectFailure is set
+type NssaaCredentials struct {
+	SNssai        models.Snssai
+	Identity      string
+	Password      string
+	ExpectFailure bool
+}
+
+// GetNssaaCredentials returns the EAP credentials for the S-NSSAI, or nil if
+// none are configured
+func (ue *RealUe) GetNssaaCredentials(snssai models.Snssai) *NssaaCredentials {
+	for _, c := range ue.NssaaCredentials {
+		if c.SNssai.Sst == snssai.Sst &&
+			strings.EqualFold(c.SNssai.Sd, snssai.Sd) {
+			return c
+		}
+	}
+	return nil
+}
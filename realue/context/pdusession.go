@@ -5,15 +5,26 @@
 package context
 
 import (
+	"fmt"
+	"math/rand"
 	"net"
+	"time"
 
 	"github.com/omec-project/gnbsim/common"
 	"github.com/omec-project/gnbsim/logger"
+	"github.com/omec-project/gnbsim/realue/tcp"
 
 	"github.com/omec-project/openapi/models"
 	"github.com/sirupsen/logrus"
 )
 
+// PDU session IDs of the PDU session to the DNN of the profile and of the PDU
+// session to the IMS DNN
+const (
+	DEFAULT_PDU_SESSION_ID int64 = 10
+	IMS_PDU_SESSION_ID     int64 = 11
+)
+
 /* PduSession represents a PDU Session in Real UE. It listens for DL user data
  * packets from the gNB and also writes UL packets to gNB on the command of
  * Real UE control plane
@@ -29,11 +40,58 @@ type PduSession struct {
 	SeqNum           int
 	ReqDataPktCount  int
 	DefaultAs        string
+	SrcPort          uint16
+	DstPort          uint16
 	TxDataPktCount   int
 	RxDataPktCount   int
 	LastDataPktRecvd bool
+
+	// User plane KPIs of the current burst of user data, the time the burst
+	// started, the send time of the outstanding echo requests keyed by
+	// sequence number and the last round trip time
+	DataStats     common.DataPlaneStats
+	BurstStart    time.Time
+	EchoSendTimes map[int]time.Time
+	PrevRtt       time.Duration
+
+	// Source of the random values drawn for the PDU session, e.g. the
+	// initial sequence numbers of the TCP connections
+	Rand *rand.Rand
+
+	// TCP connection of the ongoing HTTP request, the time the connection
+	// was initiated and the path requested
+	TcpConn      *tcp.Conn
+	TcpConnStart time.Time
+	HttpPath     string
+
+	// Protocol of the user data, the names and record types of the DNS
+	// queries, and the name and record type of the outstanding query
+	Protocol     string
+	DnsNames     []string
+	DnsTypes     []uint16
+	DnsQueryName string
+	DnsQueryType uint16
+
 	// Inidicates that a Go routine already exists for this PDU Session
 	Launched bool
+
+	// DNN of the PDU Session as confirmed by the network
+	Dnn string
+
+	// Indicates the PDU session to the IMS DNN, which carries no user data
+	// generated by the simulator, and the P-CSCF addresses provided by the
+	// network
+	Ims        bool
+	PcscfAddrs []net.IP
+
+	// Indicates that the user data is carried over NAS in the CIoT user data
+	// container, the uplink packets written to WriteGnbChan are relayed to
+	// RealUe instead of the gNB
+	DataOverNas bool
+
+	// Session-AMBR in Kbps as authorized by the network
+	UlAmbr uint64
+	DlAmbr uint64
 	/* uplink packets are written to gNB UE user plane context on this channel */
 	WriteGnbChan chan common.InterfaceMessage
 
@@ -53,6 +111,7 @@ type PduSession struct {
 func NewPduSession(realUe *RealUe, pduSessId int64) *PduSession {
 	pduSess := PduSession{}
 	pduSess.PduSessId = pduSessId
+	pduSess.Rand = common.NewRand(fmt.Sprintf("%v-%v", realUe.Supi, pduSessId))
 	pduSess.ReadDlChan = make(chan common.InterfaceMessage, 10)
 	pduSess.ReadCmdChan = make(chan common.InterfaceMessage, 10)
 	pduSess.Log = realUe.Log.WithFields(logrus.Fields{"subcategory": "PduSession",
@@ -6,8 +6,11 @@
 package context
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"net"
 	"regexp"
 	"sync"
 
@@ -23,6 +26,21 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// FC value for K_AMF to K_AMF' derivation, TS 33.501 Annex A.13
+const FC_FOR_KAMF_PRIME_DERIVATION = "72"
+
+// 3GPP releases whose NAS behaviour can be emulated by the UE. Release 0
+// retains the minimal Registration Request without the optional IEs
+const (
+	NAS_RELEASE_15 uint8 = 15
+	NAS_RELEASE_16 uint8 = 16
+	NAS_RELEASE_17 uint8 = 17
+)
+
+// IMEISV sent in the Security Mode Complete on request of the AMF when none
+// is configured for the UE
+const DEFAULT_IMEISV = "1110000000000000"
+
 // RealUe represents a Real UE
 type RealUe struct {
 	Supi               string
@@ -46,6 +64,145 @@ type RealUe struct {
 	PduSessions        map[int64]*PduSession
 	WaitGrp            sync.WaitGroup
 
+	// PLMN selected by the UE. It differs from the home PLMN when the UE is
+	// roaming
+	ServingPlmn *models.PlmnId
+
+	// Key set derived during an authentication procedure, which is yet to be
+	// taken into use by a Security Mode Command
+	NonCurrentKamf  []uint8
+	NonCurrentNgKsi models.NgKsi
+
+	// K_AUSF derived during the last authentication, it protects the SOR and
+	// UE parameters update transparent containers
+	Kausf []uint8
+
+	// Indicates that a 5G NAS security context has been activated
+	SecurityCtxAvailable bool
+
+	// Indicates that the UE has no N1 NAS signalling connection
+	CmIdle bool
+
+	// PDU sessions indicated in the Uplink Data Status of the Service Request,
+	// all the PDU sessions when empty. Reactivation holds the PDU sessions
+	// whose user plane resources are requested to be re-established by the
+	// ongoing Service Request
+	UplinkDataPduSessions []int64
+	Reactivation          []int64
+
+	// Plain Service Request of the ongoing service request procedure. It is
+	// carried in the NAS message container of the Security Mode Complete
+	// when the network re-authenticates the UE during the procedure
+	ServiceRequestPdu []byte
+
+	// Data packet generation request received while in CM-IDLE state. It is
+	// served once the user plane resources are re-established through a
+	// Service Request
+	PendingDataPktGenReq common.InterfaceMessage
+
+	// Optional assertions on the PDU Session Establishment Accept. Expected
+	// Session-AMBR is in Kbps, 0 indicates that it is not to be validated
+	ExpectedUeIpSubnet *net.IPNet
+	ExpectedUlAmbr     uint64
+	ExpectedDlAmbr     uint64
+
+	// Container identifiers of the items requested in the protocol
+	// configuration options, the default items are requested when empty.
+	// Expected values are not validated when empty or 0
+	PcoRequestIds        []uint16
+	ExpectedDnsServers   []net.IP
+	ExpectedPcscfServers []net.IP
+	ExpectedMtu          uint16
+
+	// 3GPP release which decides the optional IEs included in the NAS
+	// messages
+	NasRelease uint8
+
+	// IMEISV (16 digits) sent when requested by the AMF, DEFAULT_IMEISV is
+	// sent when empty
+	Imeisv string
+
+	// Value octets of the 5GMM capability IE, overriding the capability
+	// derived from the NAS release when set
+	Capability5GMM []byte
+
+	// S1 mode support overriding that of the 5GMM capability, not
+	// overridden when nil
+	S1Mode *bool
+
+	// CIoT 5GS optimizations overriding those of the 5GMM capability, not
+	// overridden when nil
+	Ciot *CiotCapability
+
+	// Registration options requested by the UE and the corresponding
+	// response of the network. T3512 is in seconds, 0 if not provided.
+	// Registration type is that of the last Registration Request, the
+	// configured type being used unless directed otherwise, initial
+	// registration if not configured
+	MicoRequested     bool
+	FollowOnRequest   bool
+	MicoGranted       bool
+	T3512             uint32
+	RegistrationType  uint8
+	ConfiguredRegType uint8
+
+	// Optional assertions on the Registration Accept. Expected T3512 is in
+	// seconds, 0 indicates that it is not to be validated
+	ExpectedMicoGranted *bool
+	ExpectedT3512       uint32
+
+	// Expected IE values of the key downlink NAS messages, not compared when
+	// nil
+	GoldenIes *common.GoldenIes
+
+	// SMS over NAS requested during registration, and the response of the
+	// network. SMS message reference and CP transaction identifier are
+	// incremented for each mobile originated SMS
+	SmsRequested   bool
+	SmsAllowed     bool
+	Smsc           string
+	SmsDestination string
+	SmsText        string
+	SmsMr          uint8
+	SmsTio         uint8
+
+	// UE's usage setting sent in the Registration Request, not sent when nil.
+	// The PDU session to the IMS DNN requests the P-CSCF addresses, it is
+	// not established when the IMS DNN is empty
+	UsageSetting *uint8
+	ImsDnn       string
+	ExpectPcscf  bool
+
+	// EAP credentials for the slices subject to network slice-specific
+	// authentication. These slices are included in the Requested NSSAI
+	NssaaCredentials []*NssaaCredentials
+
+	// 5GMM cause with which the Security Mode Command is rejected, when
+	// configured in the profile
+	SecModRejectCause uint8
+
+	// SQN store file in which the SQN is saved after each successful
+	// authentication, not saved when empty
+	SqnStore string
+
+	// Security context store file in which the security context is saved
+	// when the UE terminates, not saved when empty
+	SecurityCtxStore string
+
+	// Logs the plain NAS messages sent and received, in hex along with the
+	// decoded form
+	LogNasPayloads bool
+
+	// Sizes (in octets) to which the plain Registration Request and the UL
+	// NAS Transport carrying the PDU Session Establishment Request are
+	// padded, not padded when zero
+	RegRequestSize        int
+	PduSessEstRequestSize int
+
+	// Timeline recording the NAS messages sent and received, shared with the
+	// gNB UE contexts. Nil when the recording is not enabled
+	Timeline *common.Timeline
+
 	//RealUe writes messages to SimUE on this channel
 	WriteSimUeChan chan common.InterfaceMessage
 
@@ -70,6 +227,7 @@ func NewRealUe(supi string, cipheringAlg, integrityAlg uint8,
 	ue.Dnn = Dnn
 	ue.SNssai = SNssai
 	ue.Plmn = plmnid
+	ue.ServingPlmn = plmnid
 	ue.WriteSimUeChan = simuechan
 	ue.PduSessions = make(map[int64]*PduSession)
 	ue.ReadChan = make(chan common.InterfaceMessage, 5)
@@ -110,8 +268,11 @@ func (ue *RealUe) GetUESecurityCapability() (UESecurityCapability *nasType.UESec
 	return
 }
 
+// DeriveRESstarAndSetKey returns RES* and derives K_AMF. If the received SQN
+// is not fresh it returns the AUTS for resynchronization instead, TS 33.102
+// Section 6.3.3
 func (ue *RealUe) DeriveRESstarAndSetKey(
-	autn, rand []byte, snName string) []byte {
+	autn, rand []byte, snName string) (resStar []byte, auts []byte) {
 
 	authSubs := ue.AuthenticationSubs
 
@@ -162,6 +323,13 @@ func (ue *RealUe) DeriveRESstarAndSetKey(
 		rcvSQN[i] = ak[i] ^ autn[i]
 	}
 
+	// SQN is fresh when it exceeds the SQN of the UE, TS 33.102 Annex C
+	sqnMs, err := hex.DecodeString(authSubs.SequenceNumber)
+	if err == nil && len(sqnMs) == len(rcvSQN) && bytes.Compare(rcvSQN, sqnMs) <= 0 {
+		ue.Log.Infof("Received SQN:%x not fresh, SQN of UE:%x", rcvSQN, sqnMs)
+		return nil, ue.generateAuts(opc, k, rand, sqnMs, akStar)
+	}
+
 	authSubs.SequenceNumber = hex.EncodeToString(rcvSQN)
 
 	// Todo : Figure 9 of 33.102 shows that we can use the SQN received from the
@@ -181,12 +349,29 @@ func (ue *RealUe) DeriveRESstarAndSetKey(
 	P1 := rand
 	P2 := res
 
+	// The derived K_AMF is taken into use only once the network activates it
+	// through a Security Mode Command
 	ue.DerivateKamf(key, snName, rcvSQN, ak)
-	ue.DerivateAlgKey()
 	kdfVal_for_resStar :=
 		UeauCommon.GetKDFValue(key, FC, P0, UeauCommon.KDFLen(P0), P1, UeauCommon.KDFLen(P1), P2, UeauCommon.KDFLen(P2))
-	return kdfVal_for_resStar[len(kdfVal_for_resStar)/2:]
+	return kdfVal_for_resStar[len(kdfVal_for_resStar)/2:], nil
+
+}
 
+// generateAuts returns AUTS = SQN_MS xor AK* || MAC-S, where MAC-S is
+// computed with the dummy AMF, TS 33.102 Section 6.3.3
+func (ue *RealUe) generateAuts(opc, k, rand, sqnMs, akStar []byte) []byte {
+	macA, macS := make([]byte, 8), make([]byte, 8)
+	err := milenage.F1(opc, k, rand, sqnMs, []byte{0x00, 0x00}, macA, macS)
+	if err != nil {
+		ue.Log.Fatalf("milenage F1 error: %+v", err)
+	}
+
+	auts := make([]byte, 0, 14)
+	for i := 0; i < 6; i++ {
+		auts = append(auts, sqnMs[i]^akStar[i])
+	}
+	return append(auts, macS...)
 }
 
 func (ue *RealUe) DerivateKamf(key []byte, snName string, SQN, AK []byte) {
@@ -199,6 +384,7 @@ func (ue *RealUe) DerivateKamf(key []byte, snName string, SQN, AK []byte) {
 	}
 	P1 := SQNxorAK
 	Kausf := UeauCommon.GetKDFValue(key, FC, P0, UeauCommon.KDFLen(P0), P1, UeauCommon.KDFLen(P1))
+	ue.Kausf = Kausf
 	P0 = []byte(snName)
 	Kseaf := UeauCommon.GetKDFValue(Kausf, UeauCommon.FC_FOR_KSEAF_DERIVATION, P0, UeauCommon.KDFLen(P0))
 
@@ -213,7 +399,41 @@ func (ue *RealUe) DerivateKamf(key []byte, snName string, SQN, AK []byte) {
 	P1 = []byte{0x00, 0x00}
 	L1 := UeauCommon.KDFLen(P1)
 
-	ue.Kamf = UeauCommon.GetKDFValue(Kseaf, UeauCommon.FC_FOR_KAMF_DERIVATION, P0, L0, P1, L1)
+	ue.NonCurrentKamf = UeauCommon.GetKDFValue(Kseaf, UeauCommon.FC_FOR_KAMF_DERIVATION, P0, L0, P1, L1)
+}
+
+// DerivateHorizontalKamf derives K_AMF' from the current K_AMF as defined in
+// TS 33.501 Annex A.13. It is used when the network indicates K_AMF change
+// through a Security Mode Command
+func (ue *RealUe) DerivateHorizontalKamf(direction uint8, count uint32) {
+	P0 := []byte{direction}
+	L0 := UeauCommon.KDFLen(P0)
+	P1 := make([]byte, 4)
+	binary.BigEndian.PutUint32(P1, count)
+	L1 := UeauCommon.KDFLen(P1)
+
+	ue.Kamf = UeauCommon.GetKDFValue(ue.Kamf, FC_FOR_KAMF_PRIME_DERIVATION, P0, L0, P1, L1)
+}
+
+// ActivateSecurityContext takes the key set identified by the provided ngKSI
+// into use along with the provided NAS security algorithms, and refreshes
+// K_NASint and K_NASenc accordingly
+func (ue *RealUe) ActivateSecurityContext(ngKsi models.NgKsi, cipheringAlg,
+	integrityAlg uint8) error {
+
+	if ue.NonCurrentKamf != nil && ngKsi == ue.NonCurrentNgKsi {
+		ue.Kamf = ue.NonCurrentKamf
+		ue.NgKsi = ue.NonCurrentNgKsi
+		ue.NonCurrentKamf = nil
+	} else if !ue.SecurityCtxAvailable || ngKsi != ue.NgKsi {
+		return fmt.Errorf("no key set available for ngKSI: %v", ngKsi.Ksi)
+	}
+
+	ue.CipheringAlg = cipheringAlg
+	ue.IntegrityAlg = integrityAlg
+	ue.DerivateAlgKey()
+	ue.SecurityCtxAvailable = true
+	return nil
 }
 
 // Algorithm key Derivation function defined in TS 33.501 Annex A.9
@@ -237,12 +457,55 @@ func (ue *RealUe) DerivateAlgKey() {
 	copy(ue.KnasInt[:], kint[16:32])
 }
 
+// Get5GMMCapability returns the 5GMM capability IE. TS 24.501 Section 9.11.3.1
+// extends the IE by an octet in Rel-16 and Rel-17, the UE claims support for
+// none of the features indicated by these octets unless the capability is
+// configured
 func (ue *RealUe) Get5GMMCapability() (capability5GMM *nasType.Capability5GMM) {
-	return &nasType.Capability5GMM{
-		Iei:   nasMessage.RegistrationRequestCapability5GMMType,
-		Len:   1,
-		Octet: [13]uint8{0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	if len(ue.Capability5GMM) != 0 {
+		capability5GMM = &nasType.Capability5GMM{
+			Iei: nasMessage.RegistrationRequestCapability5GMMType,
+			Len: uint8(len(ue.Capability5GMM)),
+		}
+		copy(capability5GMM.Octet[:], ue.Capability5GMM)
+	} else {
+		length := uint8(1)
+		switch ue.NasRelease {
+		case NAS_RELEASE_16:
+			length = 2
+		case NAS_RELEASE_17:
+			length = 3
+		}
+
+		capability5GMM = &nasType.Capability5GMM{
+			Iei:   nasMessage.RegistrationRequestCapability5GMMType,
+			Len:   length,
+			Octet: [13]uint8{0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		}
+	}
+
+	if ue.S1Mode != nil {
+		var s1Mode uint8
+		if *ue.S1Mode {
+			s1Mode = 1
+		}
+		capability5GMM.SetS1Mode(s1Mode)
+	}
+
+	if ue.Ciot != nil {
+		ue.Ciot.apply(capability5GMM)
 	}
+	return capability5GMM
+}
+
+// GetS1UENetworkCapability returns the S1 UE network capability IE, TS 24.301
+// Section 9.9.3.34, indicating support for EEA0-EEA3 and EIA0-EIA3
+func (ue *RealUe) GetS1UENetworkCapability() *nasType.S1UENetworkCapability {
+	capability := nasType.NewS1UENetworkCapability(
+		nasMessage.RegistrationRequestS1UENetworkCapabilityType)
+	capability.SetLen(2)
+	capability.Buffer = []uint8{0xf0, 0xf0}
+	return capability
 }
 
 // GetPduSession returns the PduSession instance corresponding to provided PDU Sess ID
@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/omec-project/openapi/models"
+)
+
+// securityCtxStore is the content of a security context store file, loaded
+// once and updated in memory by the UEs
+type securityCtxStore struct {
+	states map[string]*SecurityCtxState
+	dirty  bool
+
+	// Error loading the file, in which case the file is not rewritten
+	err error
+}
+
+var (
+	// securityCtxStoreMutex serializes the accesses to the security context
+	// stores by the UEs
+	securityCtxStoreMutex sync.Mutex
+	securityCtxStores     = make(map[string]*securityCtxStore)
+)
+
+// SecurityCtxState is the 5G NAS security context of a UE along with its
+// 5G-GUTI, as saved in the security context store
+type SecurityCtxState struct {
+	Ksi          int32  `json:"ksi"`
+	Tsc          string `json:"tsc"`
+	Kamf         string `json:"kamf"`
+	CipheringAlg uint8  `json:"cipheringAlg"`
+	IntegrityAlg uint8  `json:"integrityAlg"`
+	ULCount      uint32 `json:"ulCount"`
+	DLCount      uint32 `json:"dlCount"`
+	Guti         string `json:"guti"`
+}
+
+// SaveSecurityCtx saves the current security context of the UE against its
+// SUPI in the security context store. The store file is written by
+// FlushStores
+func (ue *RealUe) SaveSecurityCtx(path string) error {
+	if !ue.SecurityCtxAvailable {
+		return fmt.Errorf("no security context available")
+	}
+
+	state := &SecurityCtxState{
+		Ksi:          ue.NgKsi.Ksi,
+		Tsc:          string(ue.NgKsi.Tsc),
+		Kamf:         hex.EncodeToString(ue.Kamf),
+		CipheringAlg: ue.CipheringAlg,
+		IntegrityAlg: ue.IntegrityAlg,
+		ULCount:      ue.ULCount.Get(),
+		DLCount:      ue.DLCount.Get(),
+		Guti:         ue.Guti,
+	}
+
+	securityCtxStoreMutex.Lock()
+	defer securityCtxStoreMutex.Unlock()
+
+	store := getSecurityCtxStore(path)
+	if store.err != nil {
+		return store.err
+	}
+	store.states[ue.Supi] = state
+	store.dirty = true
+	return nil
+}
+
+// RestoreSecurityCtx activates the security context saved for the UE in the
+// security context store. Returns false if no context is saved
+func (ue *RealUe) RestoreSecurityCtx(path string) (bool, error) {
+	securityCtxStoreMutex.Lock()
+	store := getSecurityCtxStore(path)
+	state, ok := store.states[ue.Supi]
+	securityCtxStoreMutex.Unlock()
+	if store.err != nil {
+		return false, store.err
+	}
+	if !ok {
+		return false, nil
+	}
+	kamf, err := hex.DecodeString(state.Kamf)
+	if err != nil || len(kamf) != 32 {
+		return false, fmt.Errorf("invalid kamf:%v", state.Kamf)
+	}
+
+	ue.NgKsi = models.NgKsi{Ksi: state.Ksi, Tsc: models.ScType(state.Tsc)}
+	ue.Kamf = kamf
+	ue.CipheringAlg = state.CipheringAlg
+	ue.IntegrityAlg = state.IntegrityAlg
+	ue.ULCount.Set(uint16(state.ULCount>>8), uint8(state.ULCount))
+	ue.DLCount.Set(uint16(state.DLCount>>8), uint8(state.DLCount))
+	ue.Guti = state.Guti
+	ue.DerivateAlgKey()
+	ue.SecurityCtxAvailable = true
+	return true, nil
+}
+
+// flushSecurityCtxStores writes the updated security context stores to their
+// files
+func flushSecurityCtxStores() error {
+	securityCtxStoreMutex.Lock()
+	defer securityCtxStoreMutex.Unlock()
+
+	for path, store := range securityCtxStores {
+		if !store.dirty {
+			continue
+		}
+		err := writeStoreFile(path, store.states)
+		if err != nil {
+			return fmt.Errorf("failed to write security context store: %v", err)
+		}
+		store.dirty = false
+	}
+	return nil
+}
+
+// getSecurityCtxStore returns the security context store of the file,
+// reading the file on the first access. Expected to be called with
+// securityCtxStoreMutex held
+func getSecurityCtxStore(path string) *securityCtxStore {
+	if store, ok := securityCtxStores[path]; ok {
+		return store
+	}
+
+	store := &securityCtxStore{states: make(map[string]*SecurityCtxState)}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		store.err = fmt.Errorf("failed to read security context store: %v", err)
+	} else if err == nil {
+		err = json.Unmarshal(b, &store.states)
+		if err != nil {
+			store.err = fmt.Errorf("failed to decode security context store %v: %v",
+				path, err)
+		}
+	}
+	securityCtxStores[path] = store
+	return store
+}
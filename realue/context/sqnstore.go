@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// sqnStore is the content of an SQN store file, loaded once and updated in
+// memory by the UEs. The hex encoded SQNs are stored against the SUPIs
+type sqnStore struct {
+	sqns  map[string]string
+	dirty bool
+
+	// Error loading the file, in which case the file is not rewritten
+	err error
+}
+
+var (
+	// sqnStoreMutex serializes the accesses to the SQN stores by the UEs
+	sqnStoreMutex sync.Mutex
+	sqnStores     = make(map[string]*sqnStore)
+)
+
+// LoadSqn returns the SQN stored for the SUPI in the SQN store file. Returns
+// false if the SQN is not available
+func LoadSqn(path, supi string) (string, bool) {
+	sqnStoreMutex.Lock()
+	defer sqnStoreMutex.Unlock()
+
+	store := getSqnStore(path)
+	if store.err != nil {
+		return "", false
+	}
+	sqn, ok := store.sqns[supi]
+	return sqn, ok
+}
+
+// StoreSqn stores the SQN of the SUPI in the SQN store. The store file is
+// written by FlushStores, creating the file if it does not exist
+func StoreSqn(path, supi, sqn string) error {
+	sqnStoreMutex.Lock()
+	defer sqnStoreMutex.Unlock()
+
+	store := getSqnStore(path)
+	if store.err != nil {
+		return store.err
+	}
+	store.sqns[supi] = sqn
+	store.dirty = true
+	return nil
+}
+
+// flushSqnStores writes the updated SQN stores to their files
+func flushSqnStores() error {
+	sqnStoreMutex.Lock()
+	defer sqnStoreMutex.Unlock()
+
+	for path, store := range sqnStores {
+		if !store.dirty {
+			continue
+		}
+		err := writeStoreFile(path, store.sqns)
+		if err != nil {
+			return fmt.Errorf("failed to write sqn store: %v", err)
+		}
+		store.dirty = false
+	}
+	return nil
+}
+
+// getSqnStore returns the SQN store of the file, reading the file on the
+// first access. Expected to be called with sqnStoreMutex held
+func getSqnStore(path string) *sqnStore {
+	if store, ok := sqnStores[path]; ok {
+		return store
+	}
+
+	store := &sqnStore{sqns: make(map[string]string)}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		store.err = fmt.Errorf("failed to read sqn store: %v", err)
+	} else if err == nil {
+		err = json.Unmarshal(b, &store.sqns)
+		if err != nil {
+			store.err = fmt.Errorf("failed to decode sqn store %v: %v", path, err)
+		}
+	}
+	sqnStores[path] = store
+	return store
+}
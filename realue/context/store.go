@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// FlushStores writes the stores updated by the UEs to their files. The stores
+// are held in memory while the UEs execute, and are expected to be flushed
+// once the profiles are complete and before the application exits
+func FlushStores() error {
+	err := flushSqnStores()
+	if err != nil {
+		return err
+	}
+	return flushSecurityCtxStores()
+}
+
+// writeStoreFile writes the store as JSON, readable only by the owner since
+// the stores hold the key material of the UEs. The file is replaced at once
+// so that it is never read partially written
+func writeStoreFile(path string, store interface{}) error {
+	b, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"github.com/omec-project/UeauCommon"
+)
+
+// FC values for the derivation of the MACs protecting the SOR and UE
+// parameters update transparent containers, TS 33.501 Annex A.17 to A.20
+const (
+	FC_FOR_SOR_MAC_IAUSF_DERIVATION = "77"
+	FC_FOR_SOR_MAC_IUE_DERIVATION   = "78"
+	FC_FOR_UPU_MAC_IAUSF_DERIVATION = "79"
+	FC_FOR_UPU_MAC_IUE_DERIVATION   = "7A"
+)
+
+// Value of the SOR and UE parameters update acknowledgement used as input to
+// the derivation of SOR-MAC-IUE and UPU-MAC-IUE
+const UE_PARAMS_ACKNOWLEDGEMENT uint8 = 0x01
+
+// GetSorMacIausf returns the SOR-MAC-IAUSF expected for the SOR header,
+// CounterSOR and the optional steering list, TS 33.501 Annex A.17
+func (ue *RealUe) GetSorMacIausf(header uint8, counter, list []byte) []byte {
+	P0 := []byte{header}
+	P1 := counter
+	params := [][]byte{P0, UeauCommon.KDFLen(P0), P1, UeauCommon.KDFLen(P1)}
+	if len(list) != 0 {
+		params = append(params, list, UeauCommon.KDFLen(list))
+	}
+	return getMac(UeauCommon.GetKDFValue(ue.Kausf,
+		FC_FOR_SOR_MAC_IAUSF_DERIVATION, params...))
+}
+
+// GetSorMacIue returns the SOR-MAC-IUE acknowledging the SOR information,
+// TS 33.501 Annex A.18
+func (ue *RealUe) GetSorMacIue(counter []byte) []byte {
+	P0 := []byte{UE_PARAMS_ACKNOWLEDGEMENT}
+	P1 := counter
+	return getMac(UeauCommon.GetKDFValue(ue.Kausf, FC_FOR_SOR_MAC_IUE_DERIVATION,
+		P0, UeauCommon.KDFLen(P0), P1, UeauCommon.KDFLen(P1)))
+}
+
+// GetUpuMacIausf returns the UPU-MAC-IAUSF expected for the UE parameters
+// update data and CounterUPU, TS 33.501 Annex A.19
+func (ue *RealUe) GetUpuMacIausf(data, counter []byte) []byte {
+	P0 := data
+	P1 := counter
+	return getMac(UeauCommon.GetKDFValue(ue.Kausf, FC_FOR_UPU_MAC_IAUSF_DERIVATION,
+		P0, UeauCommon.KDFLen(P0), P1, UeauCommon.KDFLen(P1)))
+}
+
+// GetUpuMacIue returns the UPU-MAC-IUE acknowledging the UE parameters
+// update, TS 33.501 Annex A.20
+func (ue *RealUe) GetUpuMacIue(counter []byte) []byte {
+	P0 := []byte{UE_PARAMS_ACKNOWLEDGEMENT}
+	P1 := counter
+	return getMac(UeauCommon.GetKDFValue(ue.Kausf, FC_FOR_UPU_MAC_IUE_DERIVATION,
+		P0, UeauCommon.KDFLen(P0), P1, UeauCommon.KDFLen(P1)))
+}
+
+// getMac returns the 128 least significant bits of the KDF output
+func getMac(kdfValue []byte) []byte {
+	return kdfValue[len(kdfValue)-16:]
+}
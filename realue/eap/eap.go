@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package eap
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// EAP codes, RFC 3748 Section 4
+	CODE_REQUEST  uint8 = 1
+	CODE_RESPONSE uint8 = 2
+	CODE_SUCCESS  uint8 = 3
+	CODE_FAILURE  uint8 = 4
+
+	// EAP types supported by the UE, RFC 3748 Section 5
+	TYPE_IDENTITY      uint8 = 1
+	TYPE_NAK           uint8 = 3
+	TYPE_MD5_CHALLENGE uint8 = 4
+
+	// Length of the code, identifier and length fields
+	HEADER_LENGTH int = 4
+)
+
+// Packet is an EAP packet, RFC 3748 Section 4. Type and data are only present
+// in requests and responses
+type Packet struct {
+	Code       uint8
+	Identifier uint8
+	Type       uint8
+	Data       []byte
+}
+
+// Encode returns the encoded EAP packet
+func (p *Packet) Encode() []byte {
+	length := HEADER_LENGTH
+	if p.Code == CODE_REQUEST || p.Code == CODE_RESPONSE {
+		length += 1 + len(p.Data)
+	}
+
+	b := make([]byte, HEADER_LENGTH, length)
+	b[0] = p.Code
+	b[1] = p.Identifier
+	binary.BigEndian.PutUint16(b[2:], uint16(length))
+	if p.Code == CODE_REQUEST || p.Code == CODE_RESPONSE {
+		b = append(b, p.Type)
+		b = append(b, p.Data...)
+	}
+	return b
+}
+
+// Decode decodes the EAP packet received from the network
+func Decode(b []byte) (*Packet, error) {
+	if len(b) < HEADER_LENGTH {
+		return nil, fmt.Errorf("eap packet too short: %v octets", len(b))
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if length < HEADER_LENGTH || length > len(b) {
+		return nil, fmt.Errorf("invalid eap packet length: %v", length)
+	}
+
+	p := &Packet{
+		Code:       b[0],
+		Identifier: b[1],
+	}
+	switch p.Code {
+	case CODE_REQUEST, CODE_RESPONSE:
+		if length == HEADER_LENGTH {
+			return nil, fmt.Errorf("eap packet without type")
+		}
+		p.Type = b[HEADER_LENGTH]
+		p.Data = b[HEADER_LENGTH+1 : length]
+	case CODE_SUCCESS, CODE_FAILURE:
+	default:
+		return nil, fmt.Errorf("unsupported eap code: %v", p.Code)
+	}
+	return p, nil
+}
+
+// GetResponse returns the response of the UE to the EAP request. The identity
+// is returned for EAP-Request/Identity, while MD5-Challenge is answered using
+// the password, RFC 3748 Section 5.4. Other methods are refused with a Nak
+// proposing MD5-Challenge
+func GetResponse(req *Packet, identity, password string) (*Packet, error) {
+	if req.Code != CODE_REQUEST {
+		return nil, fmt.Errorf("unexpected eap code: %v", req.Code)
+	}
+
+	rsp := &Packet{
+		Code:       CODE_RESPONSE,
+		Identifier: req.Identifier,
+		Type:       req.Type,
+	}
+	switch req.Type {
+	case TYPE_IDENTITY:
+		rsp.Data = []byte(identity)
+	case TYPE_MD5_CHALLENGE:
+		if len(req.Data) == 0 || len(req.Data) < 1+int(req.Data[0]) {
+			return nil, fmt.Errorf("invalid md5-challenge value size")
+		}
+		challenge := req.Data[1 : 1+int(req.Data[0])]
+		rsp.Data = append([]byte{md5.Size}, getMd5Value(req.Identifier,
+			password, challenge)...)
+	case TYPE_NAK:
+		return nil, fmt.Errorf("unexpected eap nak request")
+	default:
+		rsp.Type = TYPE_NAK
+		rsp.Data = []byte{TYPE_MD5_CHALLENGE}
+	}
+	return rsp, nil
+}
+
+// getMd5Value returns the MD5 hash of the identifier, the password and the
+// challenge, RFC 1994 Section 4.1
+func getMd5Value(identifier uint8, password string, challenge []byte) []byte {
+	h := md5.New()
+	h.Write([]byte{identifier})
+	h.Write([]byte(password))
+	h.Write(challenge)
+	return h.Sum(nil)
+}
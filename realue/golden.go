@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package realue
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/omec-project/gnbsim/common"
+
+	"github.com/omec-project/nas/nasConvert"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/nas/nasType"
+	"github.com/omec-project/openapi/models"
+)
+
+// ieDiff collects the mismatches between the golden and the received IE
+// values, one pair of lines per IE
+type ieDiff []string
+
+func (d *ieDiff) compare(ie string, expected, received interface{}) {
+	exp := fmt.Sprintf("%v", expected)
+	recv := fmt.Sprintf("%v", received)
+	if exp != recv {
+		*d = append(*d, fmt.Sprintf("-%v: %v", ie, exp),
+			fmt.Sprintf("+%v: %v", ie, recv))
+	}
+}
+
+func (d ieDiff) toError(msgName string) error {
+	if len(d) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%v does not match golden values:\n%v", msgName,
+		strings.Join(d, "\n"))
+}
+
+// compareGoldenRegAccept compares the Registration Accept with the golden IE
+// values
+func compareGoldenRegAccept(golden *common.GoldenRegAccept,
+	msg *nasMessage.RegistrationAccept) error {
+
+	var diff ieDiff
+	if golden.AllowedNssai != nil {
+		var allowed []models.Snssai
+		if msg.AllowedNSSAI != nil {
+			var err error
+			allowed, err = getAllowedNssai(msg.AllowedNSSAI)
+			if err != nil {
+				return err
+			}
+		}
+		diff.compare("allowedNssai", formatSnssaiList(golden.AllowedNssai),
+			formatSnssaiList(allowed))
+	}
+
+	if golden.TaiListLength != nil {
+		var length int
+		if msg.TAIList != nil {
+			var err error
+			length, err = getTaiListLength(msg.TAIList.Buffer)
+			if err != nil {
+				return err
+			}
+		}
+		diff.compare("taiListLength", *golden.TaiListLength, length)
+	}
+
+	if features := golden.NetworkFeatureSupport; features != nil {
+		recv := msg.NetworkFeatureSupport5GS
+		if recv == nil {
+			// Absent IE is equivalent to all the features unsupported
+			recv = &nasType.NetworkFeatureSupport5GS{Len: 2, Octet: [3]uint8{}}
+		}
+		compareFeatureBit(&diff, "imsVoPs3gpp", features.ImsVoPs3gpp, recv.GetIMSVoPS3GPP())
+		compareFeatureBit(&diff, "imsVoPsN3gpp", features.ImsVoPsN3gpp, recv.GetIMSVoPSN3GPP())
+		compareFeatureBit(&diff, "emc", features.Emc, recv.GetEMC())
+		compareFeatureBit(&diff, "emf", features.Emf, recv.GetEMF())
+		compareFeatureBit(&diff, "iwkN26", features.IwkN26, recv.GetIWKN26())
+		compareFeatureBit(&diff, "mpsi", features.Mpsi, recv.GetMPSI())
+		compareFeatureBit(&diff, "emcn3", features.Emcn3, recv.GetEMCN())
+		compareFeatureBit(&diff, "mcsi", features.Mcsi, recv.GetMCSI())
+	}
+	return diff.toError("registration accept")
+}
+
+// compareGoldenPduSessEstAccept compares the PDU Session Establishment Accept
+// with the golden IE values
+func compareGoldenPduSessEstAccept(golden *common.GoldenPduSessEstAccept,
+	msg *nasMessage.PDUSessionEstablishmentAccept) error {
+
+	var diff ieDiff
+	if golden.PduSessionType != "" {
+		diff.compare("pduSessionType", strings.ToUpper(golden.PduSessionType),
+			nasConvert.PDUSessionTypeToModels(msg.GetPDUSessionType()))
+	}
+	if golden.SscMode != nil {
+		diff.compare("sscMode", *golden.SscMode, msg.GetSSCMode())
+	}
+	if golden.SNssai != nil {
+		var snssai []models.Snssai
+		if msg.SNSSAI != nil {
+			snssai = append(snssai, nasConvert.SnssaiToModels(msg.SNSSAI))
+		}
+		diff.compare("sNssai", formatSnssaiList([]models.Snssai{*golden.SNssai}),
+			formatSnssaiList(snssai))
+	}
+	if golden.Dnn != "" {
+		var dnn string
+		if msg.DNN != nil {
+			dnn = string(msg.DNN.GetDNN())
+		}
+		diff.compare("dnn", golden.Dnn, dnn)
+	}
+	return diff.toError("pdu session establishment accept")
+}
+
+func compareFeatureBit(diff *ieDiff, ie string, expected *uint8, received uint8) {
+	if expected != nil {
+		diff.compare("networkFeatureSupport."+ie, *expected, received)
+	}
+}
+
+// getAllowedNssai decodes the S-NSSAIs of the Allowed NSSAI, which are
+// encoded the same as those of the Requested NSSAI, TS 24.501 Section 9.11.3.37
+func getAllowedNssai(nssai *nasType.AllowedNSSAI) ([]models.Snssai, error) {
+	requested := &nasType.RequestedNSSAI{
+		Len:    nssai.GetLen(),
+		Buffer: nssai.GetSNSSAIValue(),
+	}
+	mappings, err := nasConvert.RequestedNssaiToModels(requested)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode allowed nssai:%v", err)
+	}
+	snssais := make([]models.Snssai, 0, len(mappings))
+	for _, mapping := range mappings {
+		if mapping.ServingSnssai != nil {
+			snssais = append(snssais, *mapping.ServingSnssai)
+		}
+	}
+	return snssais, nil
+}
+
+// getTaiListLength returns the number of TAIs in the value part of the 5GS
+// tracking area identity list, TS 24.501 Section 9.11.3.9
+func getTaiListLength(buf []byte) (int, error) {
+	var length int
+	for offset := 0; offset < len(buf); {
+		listType := (buf[offset] >> 5) & 0x03
+		elements := int(buf[offset]&0x1f) + 1
+		var size int
+		switch listType {
+		case 0x00:
+			// PLMN followed by the TACs of the elements
+			size = 1 + 3 + 3*elements
+		case 0x01:
+			// PLMN followed by the first of the consecutive TACs
+			size = 1 + 3 + 3
+		case 0x02:
+			// PLMN and TAC of each element
+			size = 1 + 6*elements
+		default:
+			return 0, fmt.Errorf("invalid type of partial tai list:%v", listType)
+		}
+		offset += size
+		if offset > len(buf) {
+			return 0, fmt.Errorf("truncated partial tai list")
+		}
+		length += elements
+	}
+	return length, nil
+}
+
+// formatSnssaiList formats the S-NSSAIs as sorted SST-SD values, so that the
+// lists compare irrespective of the order
+func formatSnssaiList(snssais []models.Snssai) string {
+	values := make([]string, 0, len(snssais))
+	for _, snssai := range snssais {
+		value := fmt.Sprintf("%v", snssai.Sst)
+		if snssai.Sd != "" {
+			value += "-" + strings.ToLower(snssai.Sd)
+		}
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return "[" + strings.Join(values, " ") + "]"
+}
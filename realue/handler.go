@@ -7,6 +7,8 @@ package realue
 import (
 	"fmt"
 	"net"
+	"sort"
+	"strings"
 
 	"github.com/omec-project/gnbsim/common"
 	realuectx "github.com/omec-project/gnbsim/realue/context"
@@ -25,15 +27,25 @@ import (
 
 //TODO Remove the hardcoding
 const (
-	SN_NAME                        string = "5G:mnc093.mcc208.3gppnetwork.org"
-	SWITCH_OFF                     uint8  = 0
-	REQUEST_TYPE_EXISTING_PDU_SESS uint8  = 0x02
+	SWITCH_OFF                     uint8 = 0
+	POWER_OFF                      uint8 = 1
+	REQUEST_TYPE_EXISTING_PDU_SESS uint8 = 0x02
+
+	// DIRECTION parameter for K_AMF' derivation, TS 33.501 Annex A.13
+	KAMF_DERIVATION_DIRECTION_IDLE uint8 = 0x00
 )
 
 func HandleRegRequestEvent(ue *realuectx.RealUe,
 	msg common.InterfaceMessage) (err error) {
 
-	ueSecurityCapability := ue.GetUESecurityCapability()
+	ue.ServiceRequestPdu = nil
+	ue.RegistrationType = nasMessage.RegistrationType5GSInitialRegistration
+	if ue.ConfiguredRegType != 0 {
+		ue.RegistrationType = ue.ConfiguredRegType
+	}
+	if m, ok := msg.(*common.UeMessage); ok && m.RegistrationType != 0 {
+		ue.RegistrationType = m.RegistrationType
+	}
 
 	ue.Suci, err = util.SupiToSuci(ue.Supi, ue.Plmn)
 	if err != nil {
@@ -45,9 +57,33 @@ func HandleRegRequestEvent(ue *realuectx.RealUe,
 		Buffer: ue.Suci,
 	}
 
+	// UE having a valid security context identifies itself with the 5G-GUTI
+	// and integrity protects the Registration Request, TS 24.501 Section
+	// 4.4.6
+	reRegistration := ue.SecurityCtxAvailable && ue.Guti != ""
+	if reRegistration {
+		gutiNas := nasConvert.GutiToNas(ue.Guti)
+		mobileId5GS = nasType.MobileIdentity5GS{
+			Len:    11, // 5g-guti
+			Buffer: gutiNas.Octet[:],
+		}
+	}
+
 	ue.Log.Traceln("Generating Registration Request Message")
-	nasPdu := nasTestpacket.GetRegistrationRequest(nasMessage.RegistrationType5GSInitialRegistration,
-		mobileId5GS, nil, ueSecurityCapability, nil, nil, nil)
+	nasPdu, err := realue_nas.GetRegistrationRequest(ue, mobileId5GS)
+	if err != nil {
+		ue.Log.Errorln("GetRegistrationRequest returned:", err)
+		return fmt.Errorf("failed to create registration request")
+	}
+
+	if reRegistration {
+		nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
+			nas.SecurityHeaderTypeIntegrityProtected, true)
+		if err != nil {
+			ue.Log.Errorln("EncodeNasPduWithSecurity() returned:", err)
+			return fmt.Errorf("failed to protect registration request")
+		}
+	}
 
 	m := formUuMessage(common.REG_REQUEST_EVENT, nasPdu)
 	SendToSimUe(ue, m)
@@ -63,39 +99,118 @@ func HandleAuthResponseEvent(ue *realuectx.RealUe,
 	ue.Log.Traceln("Processing corresponding Authentication Request Message")
 	authReq := msg.NasMsg.AuthenticationRequest
 
-	ue.NgKsi = nasConvert.SpareHalfOctetAndNgksiToModels(authReq.SpareHalfOctetAndNgksi)
+	ue.NonCurrentNgKsi = nasConvert.SpareHalfOctetAndNgksiToModels(authReq.SpareHalfOctetAndNgksi)
 
 	rand := authReq.GetRANDValue()
 	autn := authReq.GetAUTN()
-	resStat := ue.DeriveRESstarAndSetKey(autn[:], rand[:], SN_NAME)
+	snName := util.GetServingNetworkName(ue.ServingPlmn)
+	resStat, auts := ue.DeriveRESstarAndSetKey(autn[:], rand[:], snName)
 
 	// TODO: Parse Auth Request IEs and update the RealUE Context
 
-	// Now generate NAS Authentication Response
-	ue.Log.Traceln("Generating Authentication Reponse Message")
-	nasPdu := nasTestpacket.GetAuthenticationResponse(resStat, "")
+	event := common.AUTH_RESPONSE_EVENT
+	var nasPdu []byte
+	if auts != nil {
+		// Network re-runs the authentication once it resynchronizes the SQN
+		ue.Log.Infoln("Generating Authentication Failure Message, synch failure")
+		event = common.AUTH_FAILURE_EVENT
+		nasPdu = nasTestpacket.GetAuthenticationFailure(nasMessage.Cause5GMMSynchFailure, auts)
+	} else {
+		ue.Log.Traceln("Generating Authentication Reponse Message")
+		nasPdu = nasTestpacket.GetAuthenticationResponse(resStat, "")
+		if ue.SqnStore != "" {
+			sqn := ue.AuthenticationSubs.SequenceNumber
+			if err := realuectx.StoreSqn(ue.SqnStore, ue.Supi, sqn); err != nil {
+				ue.Log.Warnln("StoreSqn returned:", err)
+			}
+		}
+	}
+
+	// During re-authentication the response is protected using the current
+	// security context, the new key set is activated later by the network
+	if ue.SecurityCtxAvailable {
+		nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
+			nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
+		if err != nil {
+			ue.Log.Errorln("EncodeNasPduWithSecurity() returned:", err)
+			return fmt.Errorf("failed to encrypt authentication response message")
+		}
+	}
 
-	m := formUuMessage(common.AUTH_RESPONSE_EVENT, nasPdu)
+	m := formUuMessage(event, nasPdu)
 	SendToSimUe(ue, m)
-	ue.Log.Traceln("Sent Authentication Reponse Message to SimUe")
+	ue.Log.Traceln("Sent", event, "to SimUe")
 	return nil
 }
 
 func HandleSecModCompleteEvent(ue *realuectx.RealUe,
-	msg common.InterfaceMessage) (err error) {
+	intfcMsg common.InterfaceMessage) (err error) {
 
-	//TODO: Process corresponding Security Mode Command first
+	// First process the corresponding Security Mode Command
+	msg := intfcMsg.(*common.UeMessage)
+	secModCmd := msg.NasMsg.SecurityModeCommand
+	if secModCmd == nil {
+		ue.Log.Errorln("SecurityModeCommand is nil")
+		return fmt.Errorf("invalid NAS Message")
+	}
 
-	mobileId5GS := nasType.MobileIdentity5GS{
-		Len:    uint16(len(ue.Suci)), // suci
-		Buffer: ue.Suci,
+	// Uplink NAS COUNT of the last uplink NAS message sent, required for
+	// horizontal K_AMF derivation
+	ulCount := ue.ULCount.Get()
+	if ulCount != 0 {
+		ulCount--
+	}
+
+	reRegistration := ue.SecurityCtxAvailable
+	ngKsi := nasConvert.SpareHalfOctetAndNgksiToModels(secModCmd.SpareHalfOctetAndNgksi)
+	algs := secModCmd.SelectedNASSecurityAlgorithms
+	err = ue.ActivateSecurityContext(ngKsi, algs.GetTypeOfCipheringAlgorithm(),
+		algs.GetTypeOfIntegrityProtectionAlgorithm())
+	if err != nil {
+		ue.Log.Errorln("ActivateSecurityContext returned:", err)
+		return fmt.Errorf("failed to activate security context")
 	}
-	registrationRequestWith5GMM := nasTestpacket.GetRegistrationRequest(
-		nasMessage.RegistrationType5GSInitialRegistration, mobileId5GS, nil,
-		ue.GetUESecurityCapability(), ue.Get5GMMCapability(), nil, nil)
+
+	includeNasContainer := !reRegistration
+	addSecInfo := secModCmd.Additional5GSecurityInformation
+	if addSecInfo != nil {
+		if addSecInfo.GetHDP() == 1 {
+			ue.Log.Infoln("K_AMF change requested, deriving K_AMF' using UL NAS COUNT:", ulCount)
+			ue.DerivateHorizontalKamf(KAMF_DERIVATION_DIRECTION_IDLE, ulCount)
+			ue.DerivateAlgKey()
+		}
+		if addSecInfo.GetRINMR() == 1 {
+			includeNasContainer = true
+		}
+	}
+	ue.Log.Infoln("Activated NAS security context, ngKSI:", ue.NgKsi.Ksi,
+		"Ciphering Alg:", ue.CipheringAlg, "Integrity Alg:", ue.IntegrityAlg)
+
+	var nasMessageContainer []byte
+	if includeNasContainer && ue.ServiceRequestPdu != nil {
+		// Re-authenticated during the service request, the initial NAS
+		// message is the Service Request, TS 24.501 Section 5.4.2.3
+		nasMessageContainer = ue.ServiceRequestPdu
+	} else if includeNasContainer {
+		mobileId5GS := nasType.MobileIdentity5GS{
+			Len:    uint16(len(ue.Suci)), // suci
+			Buffer: ue.Suci,
+		}
+		nasMessageContainer = nasTestpacket.GetRegistrationRequest(
+			ue.RegistrationType, mobileId5GS, nil,
+			ue.GetUESecurityCapability(), ue.Get5GMMCapability(), nil, nil)
+	}
+
+	imeisvRequested := secModCmd.IMEISVRequest != nil &&
+		secModCmd.IMEISVRequest.GetIMEISVRequestValue() == nasMessage.IMEISVRequested
 
 	ue.Log.Traceln("Generating Security Mode Complete Message")
-	nasPdu := nasTestpacket.GetSecurityModeComplete(registrationRequestWith5GMM)
+	nasPdu, err := realue_nas.GetSecurityModeComplete(ue, imeisvRequested,
+		nasMessageContainer)
+	if err != nil {
+		ue.Log.Errorln("GetSecurityModeComplete() returned:", err)
+		return fmt.Errorf("failed to create security mode complete message")
+	}
 
 	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
 		nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext,
@@ -111,6 +226,26 @@ func HandleSecModCompleteEvent(ue *realuectx.RealUe,
 	return nil
 }
 
+// HandleSecModRejectEvent rejects the Security Mode Command, when configured
+// in the profile. The Security Mode Reject is sent without security
+// protection, as the security context is not activated
+func HandleSecModRejectEvent(ue *realuectx.RealUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	cause := ue.SecModRejectCause
+	if cause == 0 {
+		cause = nasMessage.Cause5GMMSecurityModeRejectedUnspecified
+	}
+	ue.Log.Infoln("Generating Security Mode Reject Message, 5gmm cause:",
+		nasMessage.Cause5GMMToString(cause))
+	nasPdu := nasTestpacket.GetSecurityModeReject(cause)
+
+	m := formUuMessage(common.SEC_MOD_REJECT_EVENT, nasPdu)
+	SendToSimUe(ue, m)
+	ue.Log.Traceln("Sent Security Mode Reject Message to SimUe")
+	return nil
+}
+
 func HandleRegCompleteEvent(ue *realuectx.RealUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
@@ -124,8 +259,56 @@ func HandleRegCompleteEvent(ue *realuectx.RealUe,
 
 	_, ue.Guti = nasConvert.GutiToString(guti)
 
+	ue.MicoGranted = msg.MICOIndication != nil
+	ue.T3512 = 0
+	if msg.T3512Value != nil {
+		ue.T3512, _ = util.GetGprsTimer3Seconds(msg.T3512Value.GetUnit(),
+			msg.T3512Value.GetTimerValue())
+	}
+	ue.Log.Infoln("MICO mode granted:", ue.MicoGranted, ", T3512:", ue.T3512, "seconds")
+
+	// Reported for probing the EPS interworking support of the network, TS
+	// 24.501 Section 9.11.3.5
+	if features := msg.NetworkFeatureSupport5GS; features != nil {
+		ue.Log.Infoln("Network feature support, interworking without N26:",
+			features.GetIWKN26() == 1, ", IMS voice over PS (3GPP):",
+			features.GetIMSVoPS3GPP() == 1, ", emergency services fallback:",
+			features.GetEMF())
+	} else {
+		ue.Log.Infoln("Network feature support not provided")
+	}
+
+	if ue.SmsRequested {
+		ue.SmsAllowed = msg.RegistrationResult5GS.GetSMSAllowed() == 1
+		ue.Log.Infoln("SMS over NAS allowed:", ue.SmsAllowed)
+	}
+
+	if ue.ExpectedMicoGranted != nil && *ue.ExpectedMicoGranted != ue.MicoGranted {
+		return fmt.Errorf("mico mode granted mismatch, expected:%v, received:%v",
+			*ue.ExpectedMicoGranted, ue.MicoGranted)
+	}
+	if ue.ExpectedT3512 != 0 && ue.ExpectedT3512 != ue.T3512 {
+		return fmt.Errorf("t3512 mismatch, expected:%v seconds, received:%v seconds",
+			ue.ExpectedT3512, ue.T3512)
+	}
+	if ue.GoldenIes != nil && ue.GoldenIes.RegistrationAccept != nil {
+		err = compareGoldenRegAccept(ue.GoldenIes.RegistrationAccept, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	var sorAck []byte
+	if msg.SORTransparentContainer != nil {
+		sorAck, err = handleSorContainer(ue,
+			msg.SORTransparentContainer.GetSORContent())
+		if err != nil {
+			return err
+		}
+	}
+
 	ue.Log.Traceln("Generating Registration Complete Message")
-	nasPdu := nasTestpacket.GetRegistrationComplete(nil)
+	nasPdu := nasTestpacket.GetRegistrationComplete(sorAck)
 	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
 		nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
 	if err != nil {
@@ -142,23 +325,45 @@ func HandleRegCompleteEvent(ue *realuectx.RealUe,
 func HandleDeregRequestEvent(ue *realuectx.RealUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
-	if ue.Guti == "" {
+	// UE aborting the ongoing registration is yet to be allocated a GUTI,
+	// it identifies itself with the SUCI
+	var mobileIdentity5GS nasType.MobileIdentity5GS
+	if ue.Guti != "" {
+		gutiNas := nasConvert.GutiToNas(ue.Guti)
+		mobileIdentity5GS = nasType.MobileIdentity5GS{
+			Len:    11, // 5g-guti
+			Buffer: gutiNas.Octet[:],
+		}
+	} else if ue.Suci != nil {
+		mobileIdentity5GS = nasType.MobileIdentity5GS{
+			Len:    uint16(len(ue.Suci)), // suci
+			Buffer: ue.Suci,
+		}
+	} else {
 		ue.Log.Errorln("guti not allocated")
 		return fmt.Errorf("failed to create deregistration request: guti not unallocated")
 	}
-	gutiNas := nasConvert.GutiToNas(ue.Guti)
-	mobileIdentity5GS := nasType.MobileIdentity5GS{
-		Len:    11, // 5g-guti
-		Buffer: gutiNas.Octet[:],
-	}
 
+	// Deregistration Request is sent without security protection before the
+	// security context is activated
+	ngKsi := uint8(nasMessage.NasKeySetIdentifierNoKeyIsAvailable)
+	if ue.SecurityCtxAvailable {
+		ngKsi = uint8(ue.NgKsi.Ksi)
+	}
+	switchOff := SWITCH_OFF
+	if m, ok := intfcMsg.(*common.UeMessage); ok && m.SwitchOff {
+		ue.Log.Infoln("Generating Deregistration Request for switch off")
+		switchOff = POWER_OFF
+	}
 	nasPdu := nasTestpacket.GetDeregistrationRequest(nasMessage.AccessType3GPP,
-		SWITCH_OFF, uint8(ue.NgKsi.Ksi), mobileIdentity5GS)
-	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
-		nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
-	if err != nil {
-		ue.Log.Errorln("EncodeNasPduWithSecurity() returned:", err)
-		return fmt.Errorf("failed to encrypt deregistration request message")
+		switchOff, ngKsi, mobileIdentity5GS)
+	if ue.SecurityCtxAvailable {
+		nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
+			nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
+		if err != nil {
+			ue.Log.Errorln("EncodeNasPduWithSecurity() returned:", err)
+			return fmt.Errorf("failed to encrypt deregistration request message")
+		}
 	}
 
 	m := formUuMessage(common.DEREG_REQUEST_UE_ORIG_EVENT, nasPdu)
@@ -174,8 +379,22 @@ func HandlePduSessEstRequestEvent(ue *realuectx.RealUe,
 	// 	Sst: 1,
 	// 	Sd:  "010203",
 	// }
-	nasPdu := nasTestpacket.GetUlNasTransport_PduSessionEstablishmentRequest(10,
-		nasMessage.ULNASTransportRequestTypeInitialRequest, ue.Dnn, ue.SNssai)
+	var nasPdu []byte
+	if m, ok := msg.(*common.UeMessage); ok && m.Ims {
+		ue.Log.Infoln("Requesting PDU session to IMS DNN:", ue.ImsDnn)
+		nasPdu, err = realue_nas.GetUlNasTransportPduSessEstRequest(ue,
+			uint8(realuectx.IMS_PDU_SESSION_ID), ue.ImsDnn, imsPcoRequestIds)
+	} else if len(ue.PcoRequestIds) != 0 {
+		nasPdu, err = realue_nas.GetUlNasTransportPduSessEstRequest(ue,
+			uint8(realuectx.DEFAULT_PDU_SESSION_ID), ue.Dnn, ue.PcoRequestIds)
+	} else {
+		nasPdu = nasTestpacket.GetUlNasTransport_PduSessionEstablishmentRequest(
+			uint8(realuectx.DEFAULT_PDU_SESSION_ID),
+			nasMessage.ULNASTransportRequestTypeInitialRequest, ue.Dnn, ue.SNssai)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to build pdu session establishment request:%v", err)
+	}
 
 	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
 		nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
@@ -206,24 +425,116 @@ func HandlePduSessEstAcceptEvent(ue *realuectx.RealUe,
 		pduAddr = net.IPv4(ip[0], ip[1], ip[2], ip[3])
 	}
 
-	pduSess := realuectx.NewPduSession(ue, int64(nasMsg.PDUSessionID.Octet))
+	pduSessId := int64(nasMsg.PDUSessionID.Octet)
+	ims := ue.ImsDnn != "" && pduSessId == realuectx.IMS_PDU_SESSION_ID
+
+	// DNN IE is optional in the Accept, when absent the requested DNN is
+	// considered to be accepted
+	reqDnn := ue.Dnn
+	if ims {
+		reqDnn = ue.ImsDnn
+	}
+	dnn := reqDnn
+	if nasMsg.DNN != nil {
+		dnn = string(nasMsg.DNN.GetDNN())
+		if reqDnn != "" && !strings.EqualFold(dnn, reqDnn) {
+			return fmt.Errorf("dnn mismatch, requested:%v, received:%v", reqDnn, dnn)
+		}
+	}
+
+	sessAmbr := nasMsg.SessionAMBR
+	ulAmbr := util.GetSessionAmbrKbps(sessAmbr.GetUnitForSessionAMBRForUplink(),
+		sessAmbr.GetSessionAMBRForUplink())
+	dlAmbr := util.GetSessionAmbrKbps(sessAmbr.GetUnitForSessionAMBRForDownlink(),
+		sessAmbr.GetSessionAMBRForDownlink())
+
+	pco, err := decodePco(nasMsg.ExtendedProtocolConfigurationOptions)
+	if err != nil {
+		return err
+	}
+
+	// Assertions of the profile apply to the PDU session to the DNN of the
+	// profile
+	if ims {
+		if ue.ExpectPcscf && len(pco.pcscfAddrs) == 0 {
+			return fmt.Errorf("no p-cscf address received for ims dnn:%v", dnn)
+		}
+	} else {
+		err = validatePduSessEstAccept(ue, pduAddr, ulAmbr, dlAmbr)
+		if err != nil {
+			return err
+		}
+		err = validatePco(ue, pco)
+		if err != nil {
+			return err
+		}
+		if ue.GoldenIes != nil && ue.GoldenIes.PduSessEstAccept != nil {
+			err = compareGoldenPduSessEstAccept(ue.GoldenIes.PduSessEstAccept, nasMsg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	pduSess := realuectx.NewPduSession(ue, pduSessId)
 	pduSess.PduSessType = pduSessType
 	pduSess.SscMode = nasMsg.GetSSCMode()
 	pduSess.PduAddress = pduAddr
+	pduSess.Dnn = dnn
+	pduSess.UlAmbr = ulAmbr
+	pduSess.DlAmbr = dlAmbr
+	pduSess.Ims = ims
+	pduSess.PcscfAddrs = pco.pcscfAddrs
 	pduSess.WriteUeChan = ue.ReadChan
 	ue.AddPduSession(int64(pduSess.PduSessId), pduSess)
 	ue.Log.Infoln("PDU Session ID:", pduSess.PduSessId)
 	ue.Log.Infoln("PDU Session Type:", pduSess.PduSessType)
 	ue.Log.Infoln("SSC Mode:", pduSess.SscMode)
 	ue.Log.Infoln("PDU Address:", pduAddr.String())
+	ue.Log.Infoln("DNN:", pduSess.Dnn)
+	ue.Log.Infof("Session AMBR, Uplink: %v Kbps, Downlink: %v Kbps", ulAmbr, dlAmbr)
+	if len(pco.dnsServers) != 0 {
+		ue.Log.Infoln("DNS Server Addresses:", pco.dnsServers)
+	}
+	if len(pco.pcscfAddrs) != 0 {
+		ue.Log.Infoln("P-CSCF Addresses:", pco.pcscfAddrs)
+	}
+	if pco.mtu != 0 {
+		ue.Log.Infoln("IPv4 Link MTU:", pco.mtu)
+	}
+
+	if !ims && ue.Ciot != nil && ue.Ciot.DataOverNas {
+		setupNasDataPath(ue, pduSess)
+	}
 
 	return nil
 }
 
+// validatePduSessEstAccept checks the parameters received in PDU Session
+// Establishment Accept against the assertions configured for the UE
+func validatePduSessEstAccept(ue *realuectx.RealUe, pduAddr net.IP,
+	ulAmbr, dlAmbr uint64) error {
+
+	if ue.ExpectedUeIpSubnet != nil && !ue.ExpectedUeIpSubnet.Contains(pduAddr) {
+		return fmt.Errorf("ue ip address:%v does not belong to expected subnet:%v",
+			pduAddr, ue.ExpectedUeIpSubnet)
+	}
+	if ue.ExpectedUlAmbr != 0 && ue.ExpectedUlAmbr != ulAmbr {
+		return fmt.Errorf("uplink session ambr mismatch, expected:%v Kbps, received:%v Kbps",
+			ue.ExpectedUlAmbr, ulAmbr)
+	}
+	if ue.ExpectedDlAmbr != 0 && ue.ExpectedDlAmbr != dlAmbr {
+		return fmt.Errorf("downlink session ambr mismatch, expected:%v Kbps, received:%v Kbps",
+			ue.ExpectedDlAmbr, dlAmbr)
+	}
+	return nil
+}
+
 func HandlePduSessReleaseRequestEvent(ue *realuectx.RealUe,
 	msg common.InterfaceMessage) (err error) {
 
-	nasPdu := nasTestpacket.GetUlNasTransport_PduSessionReleaseRequest(10)
+	nasPdu := nasTestpacket.GetUlNasTransport_PduSessionReleaseRequest(
+		uint8(realuectx.DEFAULT_PDU_SESSION_ID))
 
 	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
 		nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
@@ -255,9 +566,8 @@ func HandlePduSessReleaseCompleteEvent(ue *realuectx.RealUe,
 		return fmt.Errorf("failed to fetch PDU session:%v", err)
 	}
 
-	quitMsg := &common.UeMessage{}
-	quitMsg.Event = common.QUIT_EVENT
-	pduSess.ReadCmdChan <- quitMsg
+	// Released PDU session is no longer indicated in the PDU Session Status
+	releasePduSession(ue, pduSess)
 
 	nasPdu := nasTestpacket.GetUlNasTransport_PduSessionReleaseComplete(pduSessId,
 		REQUEST_TYPE_EXISTING_PDU_SESS, "", nil)
@@ -274,10 +584,63 @@ func HandlePduSessReleaseCompleteEvent(ue *realuectx.RealUe,
 	return nil
 }
 
+// HandlePduSessModCompleteEvent applies the Session-AMBR modified by the
+// network to the PDU session and completes the PDU Session Modification
+func HandlePduSessModCompleteEvent(ue *realuectx.RealUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UeMessage)
+	nasMsg := msg.NasMsg.PDUSessionModificationCommand
+	if nasMsg == nil {
+		ue.Log.Errorln("PDUSessionModificationCommand is nil")
+		return fmt.Errorf("invalid NAS Message")
+	}
+
+	pduSessId := nasMsg.PDUSessionID.Octet
+	ue.Log.Infoln("PDU Session Modification Command, PDU Session ID:", pduSessId)
+
+	pduSess, err := ue.GetPduSession(int64(pduSessId))
+	if err != nil {
+		return fmt.Errorf("failed to fetch PDU session:%v", err)
+	}
+
+	if sessAmbr := nasMsg.SessionAMBR; sessAmbr != nil {
+		pduSess.UlAmbr = util.GetSessionAmbrKbps(sessAmbr.GetUnitForSessionAMBRForUplink(),
+			sessAmbr.GetSessionAMBRForUplink())
+		pduSess.DlAmbr = util.GetSessionAmbrKbps(sessAmbr.GetUnitForSessionAMBRForDownlink(),
+			sessAmbr.GetSessionAMBRForDownlink())
+		ue.Log.Infof("Session AMBR modified, Uplink: %v Kbps, Downlink: %v Kbps",
+			pduSess.UlAmbr, pduSess.DlAmbr)
+	}
+
+	nasPdu, err := realue_nas.GetUlNasTransportPduSessModComplete(pduSessId)
+	if err != nil {
+		return fmt.Errorf("failed to create PDU Session Modification Complete:%v", err)
+	}
+
+	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
+		nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt PDU Session Modification Complete:%v", err)
+	}
+
+	m := formUuMessage(common.PDU_SESS_MOD_COMPLETE_EVENT, nasPdu)
+	SendToSimUe(ue, m)
+	return nil
+}
+
 func HandleDataBearerSetupRequestEvent(ue *realuectx.RealUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
 	msg := intfcMsg.(*common.UuMessage)
+	if ue.CmIdle && ue.Reactivation != nil {
+		err = validateReactivation(ue, msg.DBParams)
+		ue.Reactivation = nil
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, item := range msg.DBParams {
 		/* Currently gNB also adds failed pdu session ids in the list.
 		   pdu sessions are marked failed during decoding. real ue simply
@@ -314,13 +677,34 @@ func HandleDataBearerSetupRequestEvent(ue *realuectx.RealUe,
 	rsp.DBParams = msg.DBParams
 	rsp.TriggeringEvent = msg.TriggeringEvent
 	ue.WriteSimUeChan <- rsp
+
+	ue.CmIdle = false
+	if ue.PendingDataPktGenReq != nil {
+		ue.Log.Infoln("User plane re-established, sending pending uplink data")
+		pendingMsg := ue.PendingDataPktGenReq
+		ue.PendingDataPktGenReq = nil
+		return HandleDataPktGenRequestEvent(ue, pendingMsg)
+	}
 	return nil
 }
 
 func HandleDataPktGenRequestEvent(ue *realuectx.RealUe,
 	msg common.InterfaceMessage) (err error) {
 
+	// TS 23.502 Section 4.2.3.2, uplink user data pending in CM-IDLE state
+	// triggers a UE initiated Service Request. The data is sent once the
+	// user plane resources are re-established
+	if ue.CmIdle {
+		ue.Log.Infoln("Uplink data pending in idle mode, initiating Service Request")
+		ue.PendingDataPktGenReq = msg
+		return HandleServiceRequestEvent(ue, msg)
+	}
+
+	// User data is not generated over the PDU session to the IMS DNN
 	for _, v := range ue.PduSessions {
+		if v.Ims {
+			continue
+		}
 		v.ReadCmdChan <- msg
 	}
 
@@ -337,10 +721,15 @@ func HandleConnectionReleaseRequestEvent(ue *realuectx.RealUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 	msg := intfcMsg.(*common.UuMessage)
 
+	// User data carried over NAS is not bound to the user plane resources
 	for _, pdusess := range ue.PduSessions {
+		if pdusess.DataOverNas {
+			continue
+		}
 		pdusess.ReadCmdChan <- msg
 	}
 
+	ue.CmIdle = true
 	return nil
 }
 
@@ -352,6 +741,13 @@ func HandleErrorEvent(ue *realuectx.RealUe,
 }
 
 func HandleQuitEvent(ue *realuectx.RealUe, intfcMsg common.InterfaceMessage) (err error) {
+	if ue.SecurityCtxStore != "" && ue.SecurityCtxAvailable {
+		if err := ue.SaveSecurityCtx(ue.SecurityCtxStore); err != nil {
+			ue.Log.Warnln("SaveSecurityCtx returned:", err)
+		} else {
+			ue.Log.Infoln("Saved security context, ngKSI:", ue.NgKsi.Ksi)
+		}
+	}
 	ue.WriteSimUeChan = nil
 	for _, pdusess := range ue.PduSessions {
 		pdusess.ReadCmdChan <- intfcMsg
@@ -367,7 +763,26 @@ func HandleDlInfoTransferEvent(ue *realuectx.RealUe,
 
 	msg := intfcMsg.(*common.UuMessage)
 	for _, pdu := range msg.NasPdus {
-		nasMsg, err := realue_nas.NASDecode(ue, nas.GetSecurityHeaderType(pdu), pdu)
+		securityHeaderType := nas.GetSecurityHeaderType(pdu) & 0x0f
+		plainPdu, err := realue_nas.UnprotectNasPdu(ue, securityHeaderType, pdu)
+		if err != nil {
+			ue.Log.Errorln("Failed to decode dowlink NAS Message due to", err)
+			return err
+		}
+
+		// Network slice-specific authentication messages are not supported
+		// by the NAS library
+		if realue_nas.IsNssaaMessage(plainPdu) {
+			err = handleNssaa(ue, plainPdu)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		nasMsg := nas.NewMessage()
+		nasMsg.SecurityHeaderType = securityHeaderType
+		err = nasMsg.PlainNasDecode(&plainPdu)
 		if err != nil {
 			ue.Log.Errorln("Failed to decode dowlink NAS Message due to", err)
 			return err
@@ -383,6 +798,30 @@ func HandleDlInfoTransferEvent(ue *realuectx.RealUe,
 				return fmt.Errorf("payload container length is 0")
 			}
 			buffer := payload.Buffer[:payload.Len]
+			containerType := nasMsg.GmmMessage.DLNASTransport.
+				SpareHalfOctetAndPayloadContainerType.GetPayloadContainerType()
+			if containerType == nasMessage.PayloadContainerTypeSMS {
+				err = handleDlSms(ue, buffer)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if containerType == realue_nas.PAYLOAD_CONTAINER_TYPE_CIOT_USER_DATA {
+				err = handleDlNasData(ue, nasMsg.GmmMessage.DLNASTransport, buffer)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if containerType == nasMessage.PayloadContainerTypeSOR ||
+				containerType == nasMessage.PayloadContainerTypeUEParameterUpdate {
+				err = handleDlUeParams(ue, containerType, buffer)
+				if err != nil {
+					return err
+				}
+				continue
+			}
 			m := nas.NewMessage()
 			err := m.PlainNasDecode(&buffer)
 			if err != nil {
@@ -412,10 +851,17 @@ func HandleDlInfoTransferEvent(ue *realuectx.RealUe,
 func HandleServiceRequestEvent(ue *realuectx.RealUe,
 	msg common.InterfaceMessage) (err error) {
 
-	nasPdu, err := realue_nas.GetServiceRequest(ue)
+	// TS 24.501 Section 5.6.1.2, service type is mobile terminated services
+	// when responding to the paging
+	serviceType := nasMessage.ServiceTypeData
+	if m, ok := msg.(*common.UeMessage); ok && m.PagingResponse {
+		serviceType = nasMessage.ServiceTypeMobileTerminatedServices
+	}
+	nasPdu, err := realue_nas.GetServiceRequest(ue, serviceType)
 	if err != nil {
 		return fmt.Errorf("failed to handle service request event: %v", err)
 	}
+	ue.ServiceRequestPdu = append([]byte(nil), nasPdu...)
 
 	// TS 24.501 Section 4.4.6 - Protection of Initial NAS signalling messages
 	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
@@ -424,11 +870,92 @@ func HandleServiceRequestEvent(ue *realuectx.RealUe,
 		return fmt.Errorf("failed to encode with security: %v", err)
 	}
 
+	ue.Reactivation = util.GetPduSessionIds(realue_nas.GetUplinkDataBitmap(ue))
+	ue.Log.Infoln("Requesting user plane reactivation, PDU Session IDs:",
+		ue.Reactivation)
+
 	m := formUuMessage(common.SERVICE_REQUEST_EVENT, nasPdu)
 	SendToSimUe(ue, m)
 	return nil
 }
 
+// HandleServiceAcceptEvent synchronizes the PDU sessions with the network as
+// per the PDU Session Status of the Service Accept, and reports the PDU
+// sessions whose user plane reactivation failed, TS 24.501 Section 5.6.1.4.1
+func HandleServiceAcceptEvent(ue *realuectx.RealUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UeMessage).NasMsg.ServiceAccept
+	if msg == nil {
+		return fmt.Errorf("invalid NAS Message")
+	}
+	ue.ServiceRequestPdu = nil
+
+	if status := msg.PDUSessionStatus; status != nil {
+		active := util.GetPduSessionIds(status.Buffer)
+		ue.Log.Infoln("PDU sessions active in the network:", active)
+		for id, pduSess := range ue.PduSessions {
+			if !containsPduSessionId(active, id) {
+				ue.Log.Infoln("PDU session not active in the network, released locally, PDU Session ID:", id)
+				releasePduSession(ue, pduSess)
+			}
+		}
+	}
+
+	if result := msg.PDUSessionReactivationResult; result != nil {
+		for _, id := range util.GetPduSessionIds(result.Buffer) {
+			ue.Log.Warnln("User plane reactivation failed, PDU Session ID:", id)
+		}
+	}
+
+	// User data carried over NAS needs no user plane resources, the pending
+	// uplink data is sent once the connection is established
+	if ue.PendingDataPktGenReq != nil && ue.Ciot != nil && ue.Ciot.DataOverNas {
+		ue.Log.Infoln("Connection established, sending pending uplink data over NAS")
+		ue.CmIdle = false
+		pendingMsg := ue.PendingDataPktGenReq
+		ue.PendingDataPktGenReq = nil
+		return HandleDataPktGenRequestEvent(ue, pendingMsg)
+	}
+	return nil
+}
+
+// validateReactivation checks that the network re-establishes the user plane
+// resources of only the PDU sessions requested in the Service Request
+func validateReactivation(ue *realuectx.RealUe, dbParams []*common.DataBearerParams) error {
+	var reactivated []int64
+	for _, item := range dbParams {
+		id := item.PduSess.PduSessId
+		if !containsPduSessionId(ue.Reactivation, id) {
+			return fmt.Errorf("user plane reactivated for pdu session not requested, pdu session id:%v", id)
+		}
+		reactivated = append(reactivated, id)
+	}
+	for _, id := range ue.Reactivation {
+		if !containsPduSessionId(reactivated, id) {
+			ue.Log.Warnln("User plane not reactivated, PDU Session ID:", id)
+		}
+	}
+	return nil
+}
+
+// releasePduSession releases the PDU session locally in the UE
+func releasePduSession(ue *realuectx.RealUe, pduSess *realuectx.PduSession) {
+	quitMsg := &common.UeMessage{}
+	quitMsg.Event = common.QUIT_EVENT
+	pduSess.ReadCmdChan <- quitMsg
+	delete(ue.PduSessions, pduSess.PduSessId)
+}
+
+func containsPduSessionId(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
 func HandleNwDeregAcceptEvent(ue *realuectx.RealUe, msg common.InterfaceMessage) (err error) {
 	ue.Log.Traceln("Generating Dereg Accept Message")
 	nasPdu := nasTestpacket.GetDeregistrationAccept()
@@ -446,3 +973,32 @@ func HandleNwDeregAcceptEvent(ue *realuectx.RealUe, msg common.InterfaceMessage)
 	ue.Log.Traceln("Sent Dereg Accept UE Terminated Message to SimUe")
 	return nil
 }
+
+// HandleUeStateQueryEvent completes the state of the UE filled in by SimUe and
+// notifies the querier
+func HandleUeStateQueryEvent(ue *realuectx.RealUe, intfcMsg common.InterfaceMessage) {
+	msg := intfcMsg.(*common.UeStateMessage)
+	state := msg.State
+	state.Guti = ue.Guti
+	state.NgKsi = ue.NgKsi.Ksi
+	state.SecurityCtxAvailable = ue.SecurityCtxAvailable
+	state.UlCount = ue.ULCount.Get()
+	state.DlCount = ue.DLCount.Get()
+	state.CmIdle = ue.CmIdle
+	state.MicoGranted = ue.MicoGranted
+	state.T3512 = ue.T3512
+	for id, pduSess := range ue.PduSessions {
+		state.PduSessions = append(state.PduSessions, common.PduSessionState{
+			PduSessId:  id,
+			PduAddress: pduSess.PduAddress,
+			Dnn:        pduSess.Dnn,
+			SscMode:    pduSess.SscMode,
+			UlAmbr:     pduSess.UlAmbr,
+			DlAmbr:     pduSess.DlAmbr,
+		})
+	}
+	sort.Slice(state.PduSessions, func(i, j int) bool {
+		return state.PduSessions[i].PduSessId < state.PduSessions[j].PduSessId
+	})
+	close(msg.Done)
+}
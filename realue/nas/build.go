@@ -5,19 +5,22 @@
 package nas
 
 import (
-	"bytes"
-	"fmt"
-
 	realuectx "github.com/omec-project/gnbsim/realue/context"
 	"github.com/omec-project/gnbsim/util/nastestpacket"
 
 	"github.com/omec-project/nas/nasConvert"
 	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/nas/nasTestpacket"
+	"github.com/omec-project/nas/nasType"
 )
 
-func GetServiceRequest(ue *realuectx.RealUe) ([]byte, error) {
+// Payload container type of the user data carried over NAS, TS 24.501
+// Section 9.11.3.40, not defined by the NAS library
+const PAYLOAD_CONTAINER_TYPE_CIOT_USER_DATA uint8 = 0x08
+
+func GetServiceRequest(ue *realuectx.RealUe, serviceType uint8) ([]byte, error) {
 
-	nasMsg := nastestpacket.BuildServiceRequest(nasMessage.ServiceTypeData)
+	nasMsg := nastestpacket.BuildServiceRequest(serviceType)
 	serviceRequest := nasMsg.GmmMessage.ServiceRequest
 
 	guti := nasConvert.GutiToNas(ue.Guti)
@@ -27,11 +30,299 @@ func GetServiceRequest(ue *realuectx.RealUe) ([]byte, error) {
 	serviceRequest.SetTMSI5G(guti.GetTMSI5G())
 	serviceRequest.SetNasKeySetIdentifiler(uint8(ue.NgKsi.Ksi))
 
-	data := new(bytes.Buffer)
-	err := nasMsg.GmmMessageEncode(data)
+	// TS 24.501 Section 5.6.1.2, UE indicates the PDU sessions with pending
+	// uplink user data along with all the PDU sessions active in the UE
+	ulDataBitmap := GetUplinkDataBitmap(ue)
+	serviceRequest.UplinkDataStatus = nasType.NewUplinkDataStatus(
+		nasMessage.ServiceRequestUplinkDataStatusType)
+	serviceRequest.UplinkDataStatus.SetLen(uint8(len(ulDataBitmap)))
+	serviceRequest.UplinkDataStatus.Buffer = ulDataBitmap
+
+	psiBitmap := GetPduSessionIdBitmap(ue)
+	serviceRequest.PDUSessionStatus = nasType.NewPDUSessionStatus(
+		nasMessage.ServiceRequestPDUSessionStatusType)
+	serviceRequest.PDUSessionStatus.SetLen(uint8(len(psiBitmap)))
+	serviceRequest.PDUSessionStatus.Buffer = psiBitmap
+
+	return encodeGmmMessage(nasMsg)
+}
+
+// GetRegistrationRequest returns the initial Registration Request. Optional IEs
+// are included as per the 3GPP release and the registration options
+// configured for the UE. The message is padded to the configured size with a
+// zero filled payload container
+func GetRegistrationRequest(ue *realuectx.RealUe,
+	mobileIdentity nasType.MobileIdentity5GS) ([]byte, error) {
+
+	var followOnRequest uint8
+	if ue.FollowOnRequest {
+		followOnRequest = 1
+	}
+
+	nasMsg := nastestpacket.BuildRegistrationRequest(ue.RegistrationType,
+		mobileIdentity, followOnRequest)
+	registrationRequest := nasMsg.GmmMessage.RegistrationRequest
+	if ue.SecurityCtxAvailable {
+		registrationRequest.NgksiAndRegistrationType5GS.SetNasKeySetIdentifiler(
+			uint8(ue.NgKsi.Ksi))
+	}
+
+	registrationRequest.UESecurityCapability = ue.GetUESecurityCapability()
+	registrationRequest.RequestedNSSAI = GetRequestedNSSAI(ue)
+	if ue.NasRelease != 0 || len(ue.Capability5GMM) != 0 || ue.S1Mode != nil ||
+		ue.Ciot != nil {
+		registrationRequest.Capability5GMM = ue.Get5GMMCapability()
+	}
+	if ue.S1Mode != nil && *ue.S1Mode {
+		registrationRequest.S1UENetworkCapability = ue.GetS1UENetworkCapability()
+	}
+
+	if ue.MicoRequested {
+		registrationRequest.MICOIndication = nasType.NewMICOIndication(
+			nasMessage.RegistrationRequestMICOIndicationType)
+	}
+
+	if ue.SmsRequested {
+		registrationRequest.UpdateType5GS = nasType.NewUpdateType5GS(
+			nasMessage.RegistrationRequestUpdateType5GSType)
+		registrationRequest.UpdateType5GS.SetLen(1)
+		registrationRequest.UpdateType5GS.SetSMSRequested(1)
+	}
+
+	if ue.UsageSetting != nil {
+		registrationRequest.UesUsageSetting = nasType.NewUesUsageSetting(
+			nasMessage.RegistrationRequestUesUsageSettingType)
+		registrationRequest.UesUsageSetting.SetLen(1)
+		registrationRequest.UesUsageSetting.SetUesUsageSetting(*ue.UsageSetting)
+	}
+
+	nasPdu, err := encodeGmmMessage(nasMsg)
+	if err != nil || len(nasPdu)+TLV_E_HEADER_LEN > ue.RegRequestSize {
+		return nasPdu, err
+	}
+	registrationRequest.PayloadContainer = nasType.NewPayloadContainer(
+		nasMessage.RegistrationRequestPayloadContainerType)
+	registrationRequest.PayloadContainer.SetLen(
+		uint16(ue.RegRequestSize - len(nasPdu) - TLV_E_HEADER_LEN))
+	return encodeGmmMessage(nasMsg)
+}
+
+// GetSecurityModeComplete returns the Security Mode Complete, carrying the
+// IMEISV when requested by the AMF and the NAS message container if provided
+func GetSecurityModeComplete(ue *realuectx.RealUe, imeisvRequested bool,
+	nasMessageContainer []byte) ([]byte, error) {
+
+	nasMsg := nastestpacket.BuildSecurityModeComplete()
+	securityModeComplete := nasMsg.GmmMessage.SecurityModeComplete
+	if imeisvRequested {
+		imeisv := ue.Imeisv
+		if imeisv == "" {
+			imeisv = realuectx.DEFAULT_IMEISV
+		}
+		securityModeComplete.IMEISV = GetImeisv(imeisv)
+	}
+
+	if nasMessageContainer != nil {
+		securityModeComplete.NASMessageContainer = nasType.NewNASMessageContainer(
+			nasMessage.SecurityModeCompleteNASMessageContainerType)
+		securityModeComplete.NASMessageContainer.SetLen(uint16(len(nasMessageContainer)))
+		securityModeComplete.NASMessageContainer.SetNASMessageContainerContents(nasMessageContainer)
+	}
+
+	return encodeGmmMessage(nasMsg)
+}
+
+// GetUlNasTransportSms returns the UL NAS Transport carrying the SMS message
+func GetUlNasTransportSms(payload []byte) ([]byte, error) {
+	return GetUlNasTransport(nasMessage.PayloadContainerTypeSMS, payload)
+}
+
+// GetUlNasTransport returns the UL NAS Transport carrying the payload of the
+// provided payload container type
+func GetUlNasTransport(payloadContainerType uint8, payload []byte) ([]byte, error) {
+
+	nasMsg := nastestpacket.BuildUlNasTransport(payloadContainerType, payload)
+
+	return encodeGmmMessage(nasMsg)
+}
+
+// GetUlNasTransportCiotUserData returns the UL NAS Transport carrying the
+// uplink user data of the PDU session in the CIoT user data container
+func GetUlNasTransportCiotUserData(pduSessId uint8, data []byte) ([]byte, error) {
+
+	nasMsg := nastestpacket.BuildUlNasTransport(
+		PAYLOAD_CONTAINER_TYPE_CIOT_USER_DATA, data)
+
+	ulNasTransport := nasMsg.GmmMessage.ULNASTransport
+	ulNasTransport.PduSessionID2Value = nasType.NewPduSessionID2Value(
+		nasMessage.ULNASTransportPduSessionID2ValueType)
+	ulNasTransport.PduSessionID2Value.SetPduSessionID2Value(pduSessId)
+
+	return encodeGmmMessage(nasMsg)
+}
+
+// GetUlNasTransportPduSessModComplete returns the UL NAS Transport carrying
+// the PDU Session Modification Complete for the PDU session
+func GetUlNasTransportPduSessModComplete(pduSessId uint8) ([]byte, error) {
+
+	payload := nasTestpacket.GetPduSessionModificationComplete(pduSessId)
+	nasMsg := nastestpacket.BuildUlNasTransport(
+		nasMessage.PayloadContainerTypeN1SMInfo, payload)
+
+	ulNasTransport := nasMsg.GmmMessage.ULNASTransport
+	ulNasTransport.PduSessionID2Value = nasType.NewPduSessionID2Value(
+		nasMessage.ULNASTransportPduSessionID2ValueType)
+	ulNasTransport.PduSessionID2Value.SetPduSessionID2Value(pduSessId)
+
+	return encodeGmmMessage(nasMsg)
+}
+
+// GetUlNasTransportPduSessEstRequest returns the UL NAS Transport carrying
+// the PDU Session Establishment Request for the PDU session to the DNN. The
+// items of the provided container identifiers are requested in the protocol
+// configuration options, along with the IP address allocation via NAS. The
+// message is padded to the configured size with padding containers in the
+// protocol configuration options
+func GetUlNasTransportPduSessEstRequest(ue *realuectx.RealUe, pduSessId uint8,
+	dnn string, pcoRequestIds []uint16) ([]byte, error) {
+
+	pco := nasConvert.NewProtocolConfigurationOptions()
+	pco.AddIPAddressAllocationViaNASSignallingUL()
+	for _, id := range pcoRequestIds {
+		unit := nasConvert.NewProtocolOrContainerUnit()
+		unit.ProtocolOrContainerID = id
+		pco.ProtocolOrContainerList = append(pco.ProtocolOrContainerList, unit)
+	}
+
+	nasPdu, err := getUlNasTransportPduSessEstRequest(ue, pduSessId, dnn, pco)
+	if err != nil || len(nasPdu) >= ue.PduSessEstRequestSize {
+		return nasPdu, err
+	}
+	addPcoPadding(pco, ue.PduSessEstRequestSize-len(nasPdu))
+	return getUlNasTransportPduSessEstRequest(ue, pduSessId, dnn, pco)
+}
+
+// getUlNasTransportPduSessEstRequest returns the UL NAS Transport carrying
+// the PDU Session Establishment Request with the protocol configuration
+// options
+func getUlNasTransportPduSessEstRequest(ue *realuectx.RealUe, pduSessId uint8,
+	dnn string, pco *nasConvert.ProtocolConfigurationOptions) ([]byte, error) {
+
+	payload, err := encodeGsmMessage(
+		nastestpacket.BuildPduSessionEstablishmentRequest(pduSessId, pco.Marshal()))
 	if err != nil {
-		return nil, fmt.Errorf("encode failed:", err)
+		return nil, err
+	}
+
+	nasMsg := nastestpacket.BuildUlNasTransport(
+		nasMessage.PayloadContainerTypeN1SMInfo, payload)
+
+	ulNasTransport := nasMsg.GmmMessage.ULNASTransport
+	ulNasTransport.PduSessionID2Value = nasType.NewPduSessionID2Value(
+		nasMessage.ULNASTransportPduSessionID2ValueType)
+	ulNasTransport.PduSessionID2Value.SetPduSessionID2Value(pduSessId)
+	ulNasTransport.RequestType = nasType.NewRequestType(
+		nasMessage.ULNASTransportRequestTypeType)
+	ulNasTransport.RequestType.SetRequestTypeValue(
+		nasMessage.ULNASTransportRequestTypeInitialRequest)
+	if dnn != "" {
+		ulNasTransport.DNN = nasType.NewDNN(nasMessage.ULNASTransportDNNType)
+		ulNasTransport.DNN.SetLen(uint8(len(dnn)))
+		ulNasTransport.DNN.SetDNN([]byte(dnn))
+	}
+	if ue.SNssai != nil {
+		snssai := nasConvert.SnssaiToNas(*ue.SNssai)
+		ulNasTransport.SNSSAI = nasType.NewSNSSAI(nasMessage.ULNASTransportSNSSAIType)
+		ulNasTransport.SNSSAI.SetLen(snssai[0])
+		copy(ulNasTransport.SNSSAI.Octet[:], snssai[1:])
+	}
+
+	return encodeGmmMessage(nasMsg)
+}
+
+// GetImeisv returns the IMEISV IE for the 16 digit IMEISV, encoded as the
+// 5GS mobile identity, TS 24.501 Section 9.11.3.4
+func GetImeisv(imeisv string) *nasType.IMEISV {
+	digits := make([]uint8, len(imeisv))
+	for i := range imeisv {
+		digits[i] = imeisv[i] - '0'
+	}
+
+	ie := nasType.NewIMEISV(nasMessage.SecurityModeCompleteIMEISVType)
+	var oddEven uint8
+	if len(digits)%2 == 1 {
+		oddEven = 1
+	}
+	ie.Octet[0] = digits[0]<<4 | oddEven<<3 | nasMessage.MobileIdentity5GSTypeImeisv
+
+	// Remaining digits are packed two per octet, the lower nibble first. The
+	// upper nibble of the last octet is filled with 0xf if left unused
+	length := 1
+	for i := 1; i < len(digits); i += 2 {
+		high := uint8(0x0f)
+		if i+1 < len(digits) {
+			high = digits[i+1]
+		}
+		ie.Octet[length] = high<<4 | digits[i]
+		length++
+	}
+	ie.SetLen(uint16(length))
+	return ie
+}
+
+// GetPduSessionIdBitmap returns the two octet PSI bitmap used by the PDU
+// session status and uplink data status IEs, TS 24.501 Section 9.11.3.44
+func GetPduSessionIdBitmap(ue *realuectx.RealUe) []uint8 {
+	bitmap := []uint8{0x00, 0x00}
+	for id := range ue.PduSessions {
+		if id <= 0 || id > 15 {
+			continue
+		}
+		bitmap[id/8] |= 1 << uint(id%8)
+	}
+	return bitmap
+}
+
+// GetUplinkDataBitmap returns the PSI bitmap of the PDU sessions with pending
+// uplink user data, for which the user plane resources are to be
+// re-established. It covers all the PDU sessions of the UE unless restricted
+// to specific PDU sessions
+func GetUplinkDataBitmap(ue *realuectx.RealUe) []uint8 {
+	if len(ue.UplinkDataPduSessions) == 0 {
+		return GetPduSessionIdBitmap(ue)
+	}
+
+	bitmap := []uint8{0x00, 0x00}
+	for _, id := range ue.UplinkDataPduSessions {
+		if _, ok := ue.PduSessions[id]; !ok || id <= 0 || id > 15 {
+			continue
+		}
+		bitmap[id/8] |= 1 << uint(id%8)
+	}
+	return bitmap
+}
+
+// GetRequestedNSSAI returns the Requested NSSAI IE carrying the S-NSSAI of the
+// UE, if a release is configured, and the S-NSSAIs subject to network
+// slice-specific authentication. Returns nil if there is no S-NSSAI to request
+func GetRequestedNSSAI(ue *realuectx.RealUe) *nasType.RequestedNSSAI {
+	var snssai []uint8
+	ueSNssai := ue.NasRelease != 0 && ue.SNssai != nil
+	if ueSNssai {
+		snssai = nasConvert.SnssaiToNas(*ue.SNssai)
+	}
+	for _, c := range ue.NssaaCredentials {
+		if ueSNssai && c.SNssai == *ue.SNssai {
+			continue
+		}
+		snssai = append(snssai, nasConvert.SnssaiToNas(c.SNssai)...)
+	}
+	if len(snssai) == 0 {
+		return nil
 	}
 
-	return data.Bytes(), nil
+	nssai := nasType.NewRequestedNSSAI(nasMessage.RegistrationRequestRequestedNSSAIType)
+	nssai.SetLen(uint8(len(snssai)))
+	nssai.SetSNSSAIValue(snssai)
+	return nssai
 }
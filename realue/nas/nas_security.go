@@ -17,18 +17,19 @@ import (
 	"github.com/omec-project/ngap/ngapType"
 )
 
+// Length of the security protected 5GS NAS message header: EPD, security
+// header type, message authentication code and sequence number
+const SECURITY_HEADER_LEN int = 7
+
+// EncodeNasPduWithSecurity security protects the plain NAS message when the
+// security context is available. The message is protected as encoded,
+// instead of being decoded and encoded again through the NAS library
 func EncodeNasPduWithSecurity(ue *realuectx.RealUe, pdu []byte, securityHeaderType uint8,
 	securityContextAvailable bool) ([]byte, error) {
-	m := nas.NewMessage()
-	err := m.PlainNasDecode(&pdu)
-	if err != nil {
-		return nil, err
-	}
-	m.SecurityHeader = nas.SecurityHeader{
-		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
-		SecurityHeaderType:    securityHeaderType,
+	if !securityContextAvailable {
+		return pdu, nil
 	}
-	return NASEncode(ue, m, securityContextAvailable)
+	return ProtectPlainNasPdu(ue, pdu, securityHeaderType)
 }
 
 func GetNasPdu(ue *realuectx.RealUe, msg *ngapType.DownlinkNASTransport) (m *nas.Message) {
@@ -80,67 +81,77 @@ func NASEncode(ue *realuectx.RealUe, msg *nas.Message, securityContextAvailable
 
 	if !securityContextAvailable {
 		return msg.PlainNasEncode()
-	} else {
-		needCiphering := false
-		switch msg.SecurityHeader.SecurityHeaderType {
-		case nas.SecurityHeaderTypeIntegrityProtected:
-			ue.Log.Debugln("Security header type: Integrity Protected")
-		case nas.SecurityHeaderTypeIntegrityProtectedAndCiphered:
-			ue.Log.Debugln("Security header type: Integrity Protected And Ciphered")
-			needCiphering = true
-		case nas.SecurityHeaderTypeIntegrityProtectedWithNew5gNasSecurityContext:
-			ue.Log.Debugln("Security header type: Integrity Protected With New 5G Security Context")
-			ue.ULCount.Set(0, 0)
-			ue.DLCount.Set(0, 0)
-		case nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext:
-			ue.Log.Debugln("Security header type: Integrity Protected With New 5G Security Context")
-			ue.ULCount.Set(0, 0)
-			ue.DLCount.Set(0, 0)
-			needCiphering = true
-		default:
-			return nil, fmt.Errorf("Wrong security header type: 0x%0x", msg.SecurityHeader.SecurityHeaderType)
-		}
+	}
 
-		payload, err = msg.PlainNasEncode()
-		if err != nil {
-			return nil, fmt.Errorf("plain nas encode failed: %+v", err)
-		}
+	// Plain message is encoded into a pooled buffer, out of which the
+	// protected message is built
+	return encodePlainNasMessage(msg, func(plain []byte) ([]byte, error) {
+		return ProtectPlainNasPdu(ue, plain, msg.SecurityHeader.SecurityHeaderType)
+	})
+}
 
-		if needCiphering {
-			ue.Log.Debugf("Encrypt NAS message (algorithm: %+v, DLCount: 0x%0x)", ue.CipheringAlg, ue.DLCount.Get())
-			ue.Log.Tracef("NAS ciphering key: %0x", ue.KnasEnc)
-			// TODO: Support for ue has nas connection in both accessType
-			if err = security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.ULCount.Get(), security.Bearer3GPP,
-				security.DirectionUplink, payload); err != nil {
-				return nil, fmt.Errorf("Encrypt error: %+v", err)
-			}
-		}
-		// add sequence number
-		payload = append([]byte{ue.ULCount.SQN()}, payload[:]...)
+// ProtectPlainNasPdu integrity protects, and ciphers if required by the
+// security header type, the plain NAS message. It serves the messages which
+// cannot be encoded by the NAS library. The plain NAS message is not modified
+func ProtectPlainNasPdu(ue *realuectx.RealUe, payload []byte,
+	securityHeaderType uint8) ([]byte, error) {
+
+	LogNasPayload(ue, DIRECTION_UPLINK, payload)
+	RecordNasMessage(ue, DIRECTION_UPLINK, payload, SECURITY_HEADER_LEN+len(payload))
+
+	needCiphering := false
+	switch securityHeaderType {
+	case nas.SecurityHeaderTypeIntegrityProtected:
+		ue.Log.Debugln("Security header type: Integrity Protected")
+	case nas.SecurityHeaderTypeIntegrityProtectedAndCiphered:
+		ue.Log.Debugln("Security header type: Integrity Protected And Ciphered")
+		needCiphering = true
+	case nas.SecurityHeaderTypeIntegrityProtectedWithNew5gNasSecurityContext:
+		ue.Log.Debugln("Security header type: Integrity Protected With New 5G Security Context")
+		ue.ULCount.Set(0, 0)
+		ue.DLCount.Set(0, 0)
+	case nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext:
+		ue.Log.Debugln("Security header type: Integrity Protected With New 5G Security Context")
+		ue.ULCount.Set(0, 0)
+		ue.DLCount.Set(0, 0)
+		needCiphering = true
+	default:
+		return nil, fmt.Errorf("Wrong security header type: 0x%0x", securityHeaderType)
+	}
 
-		mac32, err := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, ue.ULCount.Get(),
-			security.Bearer3GPP, security.DirectionUplink, payload)
-		if err != nil {
-			return nil, fmt.Errorf("nas mac calcuate failed: %+v", err)
+	// The protected message is built in a single buffer: EPD, security
+	// header type, MAC, sequence number and the plain NAS message, which is
+	// ciphered in place
+	pdu := make([]byte, SECURITY_HEADER_LEN+len(payload))
+	pdu[0] = nasMessage.Epd5GSMobilityManagementMessage
+	pdu[1] = securityHeaderType
+	pdu[SECURITY_HEADER_LEN-1] = ue.ULCount.SQN()
+	copy(pdu[SECURITY_HEADER_LEN:], payload)
+
+	if needCiphering {
+		ue.Log.Debugf("Encrypt NAS message (algorithm: %+v, DLCount: 0x%0x)", ue.CipheringAlg, ue.DLCount.Get())
+		ue.Log.Tracef("NAS ciphering key: %0x", ue.KnasEnc)
+		// TODO: Support for ue has nas connection in both accessType
+		if err := security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.ULCount.Get(), security.Bearer3GPP,
+			security.DirectionUplink, pdu[SECURITY_HEADER_LEN:]); err != nil {
+			return nil, fmt.Errorf("Encrypt error: %+v", err)
 		}
+	}
 
-		// Add mac value
-		payload = append(mac32, payload[:]...)
-		// Add EPD and Security Type
-		msgSecurityHeader := []byte{msg.SecurityHeader.ProtocolDiscriminator, msg.SecurityHeader.SecurityHeaderType}
-		payload = append(msgSecurityHeader, payload[:]...)
-
-		// Increase UL Count
-		ue.ULCount.AddOne()
+	mac32, err := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, ue.ULCount.Get(),
+		security.Bearer3GPP, security.DirectionUplink, pdu[SECURITY_HEADER_LEN-1:])
+	if err != nil {
+		return nil, fmt.Errorf("nas mac calcuate failed: %+v", err)
 	}
-	return payload, err
+	copy(pdu[2:SECURITY_HEADER_LEN-1], mac32)
+	payload = pdu
+
+	// Increase UL Count
+	ue.ULCount.AddOne()
+	return payload, nil
 }
 
 func NASDecode(ue *realuectx.RealUe, securityHeaderType uint8, payload []byte) (msg *nas.Message, err error) {
-	if ue == nil {
-		err = fmt.Errorf("amfUe is nil")
-		return
-	}
 	if payload == nil {
 		err = fmt.Errorf("Nas payload is empty")
 		return
@@ -148,21 +159,38 @@ func NASDecode(ue *realuectx.RealUe, securityHeaderType uint8, payload []byte) (
 
 	msg = new(nas.Message)
 	msg.SecurityHeaderType = uint8(nas.GetSecurityHeaderType(payload) & 0x0f)
-	if securityHeaderType == nas.SecurityHeaderTypePlainNas {
-		err = msg.PlainNasDecode(&payload)
-		return
-	} else if ue.IntegrityAlg == security.AlgIntegrity128NIA0 {
-		ue.Log.Debugln("decode payload is ", payload)
-		// remove header
-		payload = payload[3:]
-
-		if err = security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.DLCount.Get(), security.Bearer3GPP,
-			security.DirectionDownlink, payload); err != nil {
-			return nil, err
-		}
+	payload, err = UnprotectNasPdu(ue, securityHeaderType, payload)
+	if err != nil {
+		return nil, err
+	}
+	err = msg.PlainNasDecode(&payload)
+	return msg, err
+}
 
-		err = msg.PlainNasDecode(&payload)
-		return
+// UnprotectNasPdu verifies the integrity of the NAS message received from
+// the network, and deciphers it if ciphered, returning the plain NAS message.
+// It serves the messages which cannot be decoded by the NAS library
+func UnprotectNasPdu(ue *realuectx.RealUe, securityHeaderType uint8, payload []byte) ([]byte, error) {
+	size := len(payload)
+	payload, err := unprotectNasPdu(ue, securityHeaderType, payload)
+	if err != nil {
+		return nil, err
+	}
+	LogNasPayload(ue, DIRECTION_DOWNLINK, payload)
+	RecordNasMessage(ue, DIRECTION_DOWNLINK, payload, size)
+	return payload, nil
+}
+
+func unprotectNasPdu(ue *realuectx.RealUe, securityHeaderType uint8, payload []byte) ([]byte, error) {
+	if ue == nil {
+		return nil, fmt.Errorf("amfUe is nil")
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("Nas payload is empty")
+	}
+
+	if securityHeaderType == nas.SecurityHeaderTypePlainNas {
+		return payload, nil
 	} else { // Security protected NAS message
 		securityHeader := payload[0:6]
 		sequenceNumber := payload[6]
@@ -172,7 +200,7 @@ func NASDecode(ue *realuectx.RealUe, securityHeaderType uint8, payload []byte) (
 
 		// a security protected NAS message must be integrity protected, and ciphering is optional
 		ciphered := false
-		switch msg.SecurityHeaderType {
+		switch securityHeaderType & 0x0f {
 		case nas.SecurityHeaderTypeIntegrityProtected:
 			ue.Log.Debugln("Security header type: Integrity Protected")
 		case nas.SecurityHeaderTypeIntegrityProtectedAndCiphered:
@@ -186,7 +214,7 @@ func NASDecode(ue *realuectx.RealUe, securityHeaderType uint8, payload []byte) (
 			ciphered = true
 			ue.DLCount.Set(0, 0)
 		default:
-			return nil, fmt.Errorf("Wrong security header type: 0x%0x", msg.SecurityHeader.SecurityHeaderType)
+			return nil, fmt.Errorf("Wrong security header type: 0x%0x", securityHeaderType)
 		}
 		// Caculate ul count
 		if ue.DLCount.SQN() > sequenceNumber {
@@ -194,30 +222,32 @@ func NASDecode(ue *realuectx.RealUe, securityHeaderType uint8, payload []byte) (
 		}
 		ue.DLCount.SetSQN(sequenceNumber)
 
-		ue.Log.Infof("Calculate NAS MAC (algorithm: %+v, DLCount: 0x%0x)", ue.IntegrityAlg, ue.DLCount.Get())
-		ue.Log.Infof("NAS integrity key: %0x", ue.KnasInt)
+		// MAC is not calculated with the null integrity algorithm, the
+		// header carries the sequence number all the same
+		if ue.IntegrityAlg != security.AlgIntegrity128NIA0 {
+			ue.Log.Infof("Calculate NAS MAC (algorithm: %+v, DLCount: 0x%0x)", ue.IntegrityAlg, ue.DLCount.Get())
+			ue.Log.Infof("NAS integrity key: %0x", ue.KnasInt)
 
-		mac32, errNas := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, ue.DLCount.Get(), security.Bearer3GPP,
-			security.DirectionDownlink, payload)
-		if errNas != nil {
-			return nil, errNas
-		}
-		if !reflect.DeepEqual(mac32, receivedMac32) {
-			fmt.Printf("NAS MAC verification failed(0x%x != 0x%x)", mac32, receivedMac32)
-		} else {
-			fmt.Printf("cmac value: 0x%x\n", mac32)
+			mac32, errNas := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, ue.DLCount.Get(), security.Bearer3GPP,
+				security.DirectionDownlink, payload)
+			if errNas != nil {
+				return nil, errNas
+			}
+			if !reflect.DeepEqual(mac32, receivedMac32) {
+				fmt.Printf("NAS MAC verification failed(0x%x != 0x%x)", mac32, receivedMac32)
+			} else {
+				fmt.Printf("cmac value: 0x%x\n", mac32)
+			}
 		}
 
 		// remove sequece Number
 		payload = payload[1:]
 		if ciphered {
-			if err = security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.DLCount.Get(), security.Bearer3GPP,
+			if err := security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.DLCount.Get(), security.Bearer3GPP,
 				security.DirectionDownlink, payload); err != nil {
 				return nil, err
 			}
 		}
-
-		err = msg.PlainNasDecode(&payload)
-		return msg, err
+		return payload, nil
 	}
 }
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package nas
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/omec-project/gnbsim/common"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+
+	"github.com/omec-project/nas"
+)
+
+// Directions of the logged NAS messages
+const (
+	DIRECTION_UPLINK   = common.TIMELINE_UPLINK
+	DIRECTION_DOWNLINK = common.TIMELINE_DOWNLINK
+)
+
+// LogNasPayload logs the plain NAS message, i.e. after deciphering in the
+// downlink and before ciphering in the uplink, in hex along with its decoded
+// form. It is a no-op unless enabled for the UE
+func LogNasPayload(ue *realuectx.RealUe, direction string, pdu []byte) {
+	if !ue.LogNasPayloads {
+		return
+	}
+	ue.Log.Infof("%v NAS message: %x", direction, pdu)
+	ue.Log.Infof("%v NAS message decoded: %v", direction, DecodeNasPayload(pdu))
+}
+
+// RecordNasMessage records the plain NAS message in the timeline of the UE.
+// The size is that of the message as sent or received, i.e. including the
+// security header. It is a no-op unless the timeline is enabled for the UE
+func RecordNasMessage(ue *realuectx.RealUe, direction string, pdu []byte, size int) {
+	if ue.Timeline == nil {
+		return
+	}
+	name, _, err := DecodeNasMessage(pdu)
+	if err != nil {
+		name = "Unknown"
+	}
+	ue.Timeline.Record(common.TIMELINE_PROTOCOL_NAS, direction, name, size)
+}
+
+// DecodeNasPayload returns the name of the plain NAS message along with its
+// IEs as JSON
+func DecodeNasPayload(pdu []byte) string {
+	name, body, err := DecodeNasMessage(pdu)
+	if err != nil {
+		return fmt.Sprintf("<not decoded: %v>", err)
+	}
+
+	ies, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Sprintf("%v <not encoded: %v>", name, err)
+	}
+	return fmt.Sprintf("%v %s", name, ies)
+}
+
+// DecodeNasMessage decodes the plain NAS message, it returns the name of the
+// message along with the decoded message
+func DecodeNasMessage(pdu []byte) (string, interface{}, error) {
+	// Decoded from a copy, as the NAS library refers to the buffer
+	buf := append([]byte(nil), pdu...)
+	msg := nas.NewMessage()
+	err := msg.PlainNasDecode(&buf)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var name string
+	var body interface{}
+	switch {
+	case msg.GmmMessage != nil:
+		name, body = getSetMessage(msg.GmmMessage)
+	case msg.GsmMessage != nil:
+		name, body = getSetMessage(msg.GsmMessage)
+	}
+	if body == nil {
+		return "", nil, fmt.Errorf("unknown message")
+	}
+	return name, body, nil
+}
+
+// getSetMessage returns the name and the value of the message set in the
+// GmmMessage or GsmMessage, which hold one pointer field per message type
+func getSetMessage(msg interface{}) (string, interface{}) {
+	v := reflect.ValueOf(msg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Ptr && !field.IsNil() {
+			return v.Type().Field(i).Name, field.Interface()
+		}
+	}
+	return "", nil
+}
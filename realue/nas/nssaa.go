@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package nas
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasConvert"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/openapi/models"
+)
+
+// Message types of the network slice-specific authentication messages, TS
+// 24.501 Section 9.7. These are not supported by the NAS library, hence are
+// encoded and decoded here
+const (
+	MsgTypeNssaaCommand  uint8 = 80
+	MsgTypeNssaaComplete uint8 = 81
+	MsgTypeNssaaResult   uint8 = 82
+)
+
+// NssaaMessage is a network slice-specific authentication message, TS 24.501
+// Section 8.2.31 to 8.2.33. Each message carries the S-NSSAI being
+// authenticated and the EAP message
+type NssaaMessage struct {
+	MessageType uint8
+	SNssai      models.Snssai
+	EapMessage  []byte
+}
+
+// IsNssaaMessage returns true if the plain NAS message is a network
+// slice-specific authentication message
+func IsNssaaMessage(b []byte) bool {
+	if len(b) < 3 || b[0] != nasMessage.Epd5GSMobilityManagementMessage {
+		return false
+	}
+	return b[2] >= MsgTypeNssaaCommand && b[2] <= MsgTypeNssaaResult
+}
+
+// DecodeNssaaMessage decodes the plain network slice-specific authentication
+// message received from the network
+func DecodeNssaaMessage(b []byte) (*NssaaMessage, error) {
+	if !IsNssaaMessage(b) {
+		return nil, fmt.Errorf("not a network slice-specific authentication message")
+	}
+	m := &NssaaMessage{MessageType: b[2]}
+	b = b[3:]
+
+	// S-NSSAI, LV
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return nil, fmt.Errorf("invalid s-nssai length")
+	}
+	snssai := b[1 : 1+int(b[0])]
+	switch len(snssai) {
+	case 1, 2:
+		// SST with optional mapped HPLMN SST
+		m.SNssai.Sst = int32(snssai[0])
+	case 4, 5, 8:
+		// SST and SD with optional mapped HPLMN SST and SD
+		m.SNssai.Sst = int32(snssai[0])
+		m.SNssai.Sd = hex.EncodeToString(snssai[1:4])
+	default:
+		return nil, fmt.Errorf("invalid s-nssai length: %v", len(snssai))
+	}
+	b = b[1+int(b[0]):]
+
+	// EAP message, LV-E
+	if len(b) < 2 {
+		return nil, fmt.Errorf("missing eap message")
+	}
+	length := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+length {
+		return nil, fmt.Errorf("invalid eap message length")
+	}
+	m.EapMessage = b[2 : 2+length]
+	return m, nil
+}
+
+// GetNssaaComplete returns the plain Network Slice-Specific Authentication
+// Complete carrying the EAP response for the S-NSSAI
+func GetNssaaComplete(snssai models.Snssai, eapMessage []byte) []byte {
+	b := []byte{
+		nasMessage.Epd5GSMobilityManagementMessage,
+		nas.SecurityHeaderTypePlainNas,
+		MsgTypeNssaaComplete,
+	}
+	b = append(b, nasConvert.SnssaiToNas(snssai)...)
+
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(eapMessage)))
+	b = append(b, length...)
+	return append(b, eapMessage...)
+}
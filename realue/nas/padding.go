@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package nas
+
+import (
+	"github.com/omec-project/nas/nasConvert"
+)
+
+// Length of the IEI and the length field of a type 6 (TLV-E) IE
+const TLV_E_HEADER_LEN = 3
+
+// Length of the identifier and the length field of a container of the
+// protocol configuration options, and the upper limit on its contents
+const (
+	PCO_CONTAINER_HEADER_LEN   = 3
+	MAX_PCO_CONTAINER_CONTENTS = 255
+)
+
+// Identifier of the containers padding the protocol configuration options,
+// from the range reserved for operator specific use, TS 24.008 Section
+// 10.5.6.3
+const PCO_PADDING_CONTAINER_ID uint16 = 0xff00
+
+// addPcoPadding grows the protocol configuration options by padLen octets
+// with zero filled padding containers. Up to 2 octets are left out when
+// padLen is less than the length of the container header
+func addPcoPadding(pco *nasConvert.ProtocolConfigurationOptions, padLen int) {
+	for padLen >= PCO_CONTAINER_HEADER_LEN {
+		contentsLen := padLen - PCO_CONTAINER_HEADER_LEN
+		if contentsLen > MAX_PCO_CONTAINER_CONTENTS {
+			contentsLen = MAX_PCO_CONTAINER_CONTENTS
+			// Leaves room for the header of the next container
+			if rest := padLen - PCO_CONTAINER_HEADER_LEN - contentsLen; rest < PCO_CONTAINER_HEADER_LEN {
+				contentsLen -= PCO_CONTAINER_HEADER_LEN - rest
+			}
+		}
+
+		unit := nasConvert.NewProtocolOrContainerUnit()
+		unit.ProtocolOrContainerID = PCO_PADDING_CONTAINER_ID
+		unit.LengthOfContents = uint8(contentsLen)
+		unit.Contents = make([]byte, contentsLen)
+		pco.ProtocolOrContainerList = append(pco.ProtocolOrContainerList, unit)
+		padLen -= PCO_CONTAINER_HEADER_LEN + contentsLen
+	}
+}
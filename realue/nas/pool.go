@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package nas
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/omec-project/nas"
+)
+
+// Encoded NAS messages larger than this are not retained in the pool, to
+// avoid holding on to the memory of the occasional large message
+const MAX_POOLED_BUF_LEN int = 4096
+
+// encodeBufPool holds the buffers into which the NAS messages are encoded,
+// shared by all the UEs to avoid growing a new buffer for every message
+var encodeBufPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// encodeGmmMessage encodes the 5GMM message using a pooled buffer. The
+// encoded message is copied out, as the buffer is reused once returned
+func encodeGmmMessage(nasMsg *nas.Message) ([]byte, error) {
+	return encodeMessage(nasMsg.GmmMessageEncode, copyEncoded)
+}
+
+// encodeGsmMessage encodes the 5GSM message using a pooled buffer
+func encodeGsmMessage(nasMsg *nas.Message) ([]byte, error) {
+	return encodeMessage(nasMsg.GsmMessageEncode, copyEncoded)
+}
+
+// encodePlainNasMessage encodes the 5GMM or 5GSM message using a pooled
+// buffer and returns the result of consume on the encoded message
+func encodePlainNasMessage(nasMsg *nas.Message,
+	consume func(encoded []byte) ([]byte, error)) ([]byte, error) {
+
+	switch {
+	case nasMsg.GmmMessage != nil:
+		return encodeMessage(nasMsg.GmmMessageEncode, consume)
+	case nasMsg.GsmMessage != nil:
+		return encodeMessage(nasMsg.GsmMessageEncode, consume)
+	}
+	return nil, fmt.Errorf("Gmm/Gsm Message are both empty in Nas Message Encode")
+}
+
+// encodeMessage encodes the message into a pooled buffer and returns the
+// result of consume on the encoded message. The encoded message is not to be
+// retained by consume, as the buffer is reused once returned
+func encodeMessage(encode func(buffer *bytes.Buffer) error,
+	consume func(encoded []byte) ([]byte, error)) ([]byte, error) {
+
+	data := encodeBufPool.Get().(*bytes.Buffer)
+	data.Reset()
+	defer func() {
+		if data.Cap() <= MAX_POOLED_BUF_LEN {
+			encodeBufPool.Put(data)
+		}
+	}()
+
+	err := encode(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode failed: %v", err)
+	}
+	return consume(data.Bytes())
+}
+
+func copyEncoded(encoded []byte) ([]byte, error) {
+	pdu := make([]byte, len(encoded))
+	copy(pdu, encoded)
+	return pdu, nil
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package realue
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/omec-project/gnbsim/common"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+	realue_nas "github.com/omec-project/gnbsim/realue/nas"
+	"github.com/omec-project/gnbsim/realue/worker/pdusessworker"
+
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasMessage"
+)
+
+// setupNasDataPath launches the PDU session whose user data is carried over
+// NAS, TS 24.501 Section 5.4.5. The uplink packets of the PDU session are
+// relayed to RealUe, which sends them in UL NAS Transport. SimUe is notified
+// in place of the data bearer setup, as no user plane resources are set up
+func setupNasDataPath(ue *realuectx.RealUe, pduSess *realuectx.PduSession) {
+	pduSess.DataOverNas = true
+	pduSess.Launched = true
+	ue.WaitGrp.Add(1)
+	go pdusessworker.Init(pduSess, &ue.WaitGrp)
+
+	ulChan := make(chan common.InterfaceMessage, 10)
+	ue.WaitGrp.Add(1)
+	go relayNasUlData(ue, pduSess, ulChan, &ue.WaitGrp)
+
+	initMsg := &common.UeMessage{}
+	initMsg.Event = common.INIT_EVENT
+	initMsg.CommChan = ulChan
+	pduSess.ReadCmdChan <- initMsg
+
+	ue.Log.Infoln("User data carried over NAS, PDU Session ID:", pduSess.PduSessId)
+	m := &common.UeMessage{}
+	m.Event = common.NAS_DATA_PATH_SETUP_EVENT
+	SendToSimUe(ue, m)
+}
+
+// relayNasUlData tags the uplink packets of the PDU session with the PDU
+// session ID and hands them over to RealUe. Once the PDU session ends its
+// uplink, the end is returned on the downlink as done by the gNB
+func relayNasUlData(ue *realuectx.RealUe, pduSess *realuectx.PduSession,
+	ulChan chan common.InterfaceMessage, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+	for msg := range ulChan {
+		if msg.GetEventType() == common.LAST_DATA_PKT_EVENT {
+			pduSess.ReadDlChan <- msg
+			return
+		}
+		dataMsg := msg.(*common.UserDataMessage)
+		dataMsg.PduSessId = pduSess.PduSessId
+		ue.ReadChan <- dataMsg
+	}
+}
+
+// HandleUlUeDataTransferEvent sends the uplink user data in the CIoT user
+// data container of UL NAS Transport
+func HandleUlUeDataTransferEvent(ue *realuectx.RealUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UserDataMessage)
+	nasPdu, err := realue_nas.GetUlNasTransportCiotUserData(
+		uint8(msg.PduSessId), msg.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to create ul nas transport: %v", err)
+	}
+	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
+		nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt ul nas transport: %v", err)
+	}
+
+	m := formUuMessage(common.NAS_DATA_UL_TRANSPORT_EVENT, nasPdu)
+	SendToSimUe(ue, m)
+	return nil
+}
+
+// handleDlNasData hands over the downlink user data received in the CIoT user
+// data container of DL NAS Transport to the PDU session
+func handleDlNasData(ue *realuectx.RealUe, dlNasTransport *nasMessage.DLNASTransport,
+	payload []byte) error {
+
+	if dlNasTransport.PduSessionID2Value == nil {
+		return fmt.Errorf("pdu session id not received with ciot user data")
+	}
+	pduSessId := int64(dlNasTransport.PduSessionID2Value.GetPduSessionID2Value())
+	pduSess, err := ue.GetPduSession(pduSessId)
+	if err != nil {
+		return fmt.Errorf("ciot user data received for unknown pdu session:%v", err)
+	}
+	if !pduSess.DataOverNas {
+		return fmt.Errorf("ciot user data received for pdu session:%v not carrying data over nas",
+			pduSessId)
+	}
+
+	dataMsg := &common.UserDataMessage{}
+	dataMsg.Event = common.DL_UE_DATA_TRANSFER_EVENT
+	dataMsg.Payload = append([]byte(nil), payload...)
+	dataMsg.PduSessId = pduSessId
+	pduSess.ReadDlChan <- dataMsg
+	return nil
+}
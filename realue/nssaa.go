@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package realue
+
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/common"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+	"github.com/omec-project/gnbsim/realue/eap"
+	realue_nas "github.com/omec-project/gnbsim/realue/nas"
+
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasConvert"
+	"github.com/omec-project/nas/nasTestpacket"
+)
+
+// handleNssaa handles the network slice-specific authentication message,
+// TS 24.501 Section 5.4.7. EAP requests are answered using the credentials
+// configured for the S-NSSAI, while the result is reported to SimUe
+func handleNssaa(ue *realuectx.RealUe, pdu []byte) error {
+	msg, err := realue_nas.DecodeNssaaMessage(pdu)
+	if err != nil {
+		return fmt.Errorf("failed to decode nssaa message: %v", err)
+	}
+	creds := ue.GetNssaaCredentials(msg.SNssai)
+	if creds == nil {
+		return fmt.Errorf("no nssaa credentials for s-nssai, sst:%v, sd:%v",
+			msg.SNssai.Sst, msg.SNssai.Sd)
+	}
+	pkt, err := eap.Decode(msg.EapMessage)
+	if err != nil {
+		return fmt.Errorf("failed to decode eap message: %v", err)
+	}
+
+	switch msg.MessageType {
+	case realue_nas.MsgTypeNssaaCommand:
+		ue.Log.Infoln("Received NSSAA Command, sst:", msg.SNssai.Sst, "sd:",
+			msg.SNssai.Sd, "eap type:", pkt.Type)
+		rsp, err := eap.GetResponse(pkt, creds.Identity, creds.Password)
+		if err != nil {
+			return err
+		}
+		nasPdu := realue_nas.GetNssaaComplete(msg.SNssai, rsp.Encode())
+		nasPdu, err = realue_nas.ProtectPlainNasPdu(ue, nasPdu,
+			nas.SecurityHeaderTypeIntegrityProtectedAndCiphered)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt nssaa complete: %v", err)
+		}
+		m := formUuMessage(common.NSSAA_COMPLETE_EVENT, nasPdu)
+		SendToSimUe(ue, m)
+	case realue_nas.MsgTypeNssaaResult:
+		success := pkt.Code == eap.CODE_SUCCESS
+		ue.Log.Infoln("Received NSSAA Result, sst:", msg.SNssai.Sst, "sd:",
+			msg.SNssai.Sd, "success:", success)
+		if success == creds.ExpectFailure {
+			return fmt.Errorf("nssaa result mismatch, sst:%v, sd:%v, expected failure:%v",
+				msg.SNssai.Sst, msg.SNssai.Sd, creds.ExpectFailure)
+		}
+		m := &common.UeMessage{}
+		m.Event = common.NSSAA_RESULT_EVENT
+		SendToSimUe(ue, m)
+	default:
+		return fmt.Errorf("unexpected nssaa message type: %v", msg.MessageType)
+	}
+	return nil
+}
+
+// HandleConfigUpdateCommandEvent logs the allowed and rejected NSSAI of the
+// Configuration Update Command, which follows the network slice-specific
+// authentication, and sends Configuration Update Complete when requested
+func HandleConfigUpdateCommandEvent(ue *realuectx.RealUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UeMessage).NasMsg.ConfigurationUpdateCommand
+	if msg.AllowedNSSAI != nil {
+		ue.Log.Infof("Allowed NSSAI: %x", msg.AllowedNSSAI.GetSNSSAIValue())
+	}
+	if msg.RejectedNSSAI != nil {
+		ue.Log.Infof("Rejected NSSAI: %x", msg.RejectedNSSAI.GetRejectedNSSAIContents())
+	}
+	if msg.GUTI5G != nil {
+		_, ue.Guti = nasConvert.GutiToString(msg.GUTI5G.Octet[:])
+	}
+
+	if msg.ConfigurationUpdateIndication == nil ||
+		msg.ConfigurationUpdateIndication.GetACK() == 0 {
+		return nil
+	}
+
+	nasPdu := nasTestpacket.GetConfigurationUpdateComplete()
+	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
+		nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt configuration update complete: %v", err)
+	}
+
+	m := formUuMessage(common.CONFIG_UPDATE_COMPLETE_EVENT, nasPdu)
+	SendToSimUe(ue, m)
+	ue.Log.Traceln("Sent Configuration Update Complete Message to SimUe")
+	return nil
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package realue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+
+	"github.com/omec-project/nas/nasConvert"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/nas/nasType"
+)
+
+// Items requested in the protocol configuration options of the PDU session to
+// the IMS DNN
+var imsPcoRequestIds = []uint16{
+	nasMessage.DNSServerIPv4AddressRequestUL,
+	nasMessage.DNSServerIPv6AddressRequestUL,
+	nasMessage.PCSCFIPv4AddressRequestUL,
+	nasMessage.PCSCFIPv6AddressRequestUL,
+}
+
+// pcoValues holds the items of interest provided by the network in the
+// protocol configuration options
+type pcoValues struct {
+	dnsServers []net.IP
+	pcscfAddrs []net.IP
+	mtu        uint16
+}
+
+// decodePco returns the items carried in the extended protocol configuration
+// options of the PDU Session Establishment Accept
+func decodePco(epco *nasType.ExtendedProtocolConfigurationOptions) (*pcoValues, error) {
+	values := &pcoValues{}
+	if epco == nil {
+		return values, nil
+	}
+
+	pco := nasConvert.NewProtocolConfigurationOptions()
+	err := pco.UnMarshal(epco.GetExtendedProtocolConfigurationOptionsContents())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode protocol configuration options:%v", err)
+	}
+
+	for _, unit := range pco.ProtocolOrContainerList {
+		switch unit.ProtocolOrContainerID {
+		case nasMessage.DNSServerIPv4AddressDL, nasMessage.DNSServerIPv6AddressDL:
+			if ip := getPcoIpAddr(unit); ip != nil {
+				values.dnsServers = append(values.dnsServers, ip)
+			}
+		case nasMessage.PCSCFIPv4AddressDL, nasMessage.PCSCFIPv6AddressDL:
+			if ip := getPcoIpAddr(unit); ip != nil {
+				values.pcscfAddrs = append(values.pcscfAddrs, ip)
+			}
+		case nasMessage.IPv4LinkMTUDL:
+			if len(unit.Contents) == 2 {
+				values.mtu = binary.BigEndian.Uint16(unit.Contents)
+			}
+		}
+	}
+	return values, nil
+}
+
+// getPcoIpAddr returns the address carried in the container, nil if the
+// length of the contents matches neither an IPv4 nor an IPv6 address
+func getPcoIpAddr(unit *nasConvert.ProtocolOrContainerUnit) net.IP {
+	switch len(unit.Contents) {
+	case net.IPv4len, net.IPv6len:
+		return net.IP(unit.Contents)
+	}
+	return nil
+}
+
+// validatePco checks the items provided by the network against the values
+// expected for the UE
+func validatePco(ue *realuectx.RealUe, values *pcoValues) error {
+	for _, ip := range ue.ExpectedDnsServers {
+		if !containsIp(values.dnsServers, ip) {
+			return fmt.Errorf("dns server address mismatch, expected:%v, received:%v",
+				ue.ExpectedDnsServers, values.dnsServers)
+		}
+	}
+	for _, ip := range ue.ExpectedPcscfServers {
+		if !containsIp(values.pcscfAddrs, ip) {
+			return fmt.Errorf("p-cscf address mismatch, expected:%v, received:%v",
+				ue.ExpectedPcscfServers, values.pcscfAddrs)
+		}
+	}
+	if ue.ExpectedMtu != 0 && ue.ExpectedMtu != values.mtu {
+		return fmt.Errorf("mtu mismatch, expected:%v, received:%v",
+			ue.ExpectedMtu, values.mtu)
+	}
+	return nil
+}
+
+func containsIp(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,75 +7,105 @@ package realue
 import (
 	"github.com/omec-project/gnbsim/common"
 	realuectx "github.com/omec-project/gnbsim/realue/context"
+	realue_nas "github.com/omec-project/gnbsim/realue/nas"
 	"github.com/omec-project/gnbsim/util/test"
+
+	"github.com/omec-project/nas"
 )
 
 func Init(ue *realuectx.RealUe) {
 
-	ue.AuthenticationSubs = test.GetAuthSubscription(ue.Key, ue.Opc, "", ue.SeqNum)
+	Setup(ue)
 
 	HandleEvents(ue)
 }
 
+// Setup prepares the RealUe for handling its events
+func Setup(ue *realuectx.RealUe) {
+	ue.AuthenticationSubs = test.GetAuthSubscription(ue.Key, ue.Opc, "", ue.SeqNum)
+}
+
 func HandleEvents(ue *realuectx.RealUe) (err error) {
 
 	for msg := range ue.ReadChan {
-		event := msg.GetEventType()
-		ue.Log.Infoln("Handling:", event)
-
-		switch event {
-		case common.REG_REQUEST_EVENT:
-			err = HandleRegRequestEvent(ue, msg)
-		case common.AUTH_RESPONSE_EVENT:
-			err = HandleAuthResponseEvent(ue, msg)
-		case common.SEC_MOD_COMPLETE_EVENT:
-			err = HandleSecModCompleteEvent(ue, msg)
-		case common.REG_COMPLETE_EVENT:
-			err = HandleRegCompleteEvent(ue, msg)
-		case common.DEREG_REQUEST_UE_ORIG_EVENT:
-			err = HandleDeregRequestEvent(ue, msg)
-		case common.DL_INFO_TRANSFER_EVENT:
-			err = HandleDlInfoTransferEvent(ue, msg)
-		case common.PDU_SESS_EST_REQUEST_EVENT:
-			err = HandlePduSessEstRequestEvent(ue, msg)
-		case common.PDU_SESS_REL_REQUEST_EVENT:
-			err = HandlePduSessReleaseRequestEvent(ue, msg)
-		case common.PDU_SESS_REL_COMPLETE_EVENT:
-			err = HandlePduSessReleaseCompleteEvent(ue, msg)
-		case common.PDU_SESS_EST_ACCEPT_EVENT:
-			err = HandlePduSessEstAcceptEvent(ue, msg)
-		case common.DATA_BEARER_SETUP_REQUEST_EVENT:
-			err = HandleDataBearerSetupRequestEvent(ue, msg)
-		case common.DATA_PKT_GEN_REQUEST_EVENT:
-			err = HandleDataPktGenRequestEvent(ue, msg)
-		case common.DATA_PKT_GEN_SUCCESS_EVENT:
-			err = HandleDataPktGenSuccessEvent(ue, msg)
-		case common.SERVICE_REQUEST_EVENT:
-			err = HandleServiceRequestEvent(ue, msg)
-		case common.CONNECTION_RELEASE_REQUEST_EVENT:
-			err = HandleConnectionReleaseRequestEvent(ue, msg)
-		case common.DEREG_ACCEPT_UE_TERM_EVENT:
-			err = HandleNwDeregAcceptEvent(ue, msg)
-		case common.ERROR_EVENT:
-			HandleErrorEvent(ue, msg)
-		case common.QUIT_EVENT:
-			HandleQuitEvent(ue, msg)
+		if HandleEvent(ue, msg) {
 			return nil
-		default:
-			ue.Log.Warnln("Event", event, "is not supported")
 		}
+	}
+	return nil
+}
 
-		if err != nil {
-			ue.Log.Errorln("real ue failed:", event, ":", err)
-			msg := &common.UeMessage{}
-			msg.Error = err
-			msg.Event = common.ERROR_EVENT
-			err = nil
-			HandleErrorEvent(ue, msg)
-		}
+// HandleEvent routes an event to the corresponding handler and returns true
+// once the RealUe has terminated
+func HandleEvent(ue *realuectx.RealUe, msg common.InterfaceMessage) (quit bool) {
+	var err error
+	event := msg.GetEventType()
+	ue.Log.Infoln("Handling:", event)
+
+	switch event {
+	case common.REG_REQUEST_EVENT:
+		err = HandleRegRequestEvent(ue, msg)
+	case common.AUTH_RESPONSE_EVENT:
+		err = HandleAuthResponseEvent(ue, msg)
+	case common.SEC_MOD_COMPLETE_EVENT:
+		err = HandleSecModCompleteEvent(ue, msg)
+	case common.SEC_MOD_REJECT_EVENT:
+		err = HandleSecModRejectEvent(ue, msg)
+	case common.REG_COMPLETE_EVENT:
+		err = HandleRegCompleteEvent(ue, msg)
+	case common.DEREG_REQUEST_UE_ORIG_EVENT:
+		err = HandleDeregRequestEvent(ue, msg)
+	case common.DL_INFO_TRANSFER_EVENT:
+		err = HandleDlInfoTransferEvent(ue, msg)
+	case common.PDU_SESS_EST_REQUEST_EVENT:
+		err = HandlePduSessEstRequestEvent(ue, msg)
+	case common.PDU_SESS_REL_REQUEST_EVENT:
+		err = HandlePduSessReleaseRequestEvent(ue, msg)
+	case common.PDU_SESS_REL_COMPLETE_EVENT:
+		err = HandlePduSessReleaseCompleteEvent(ue, msg)
+	case common.PDU_SESS_MOD_COMPLETE_EVENT:
+		err = HandlePduSessModCompleteEvent(ue, msg)
+	case common.PDU_SESS_EST_ACCEPT_EVENT:
+		err = HandlePduSessEstAcceptEvent(ue, msg)
+	case common.DATA_BEARER_SETUP_REQUEST_EVENT:
+		err = HandleDataBearerSetupRequestEvent(ue, msg)
+	case common.DATA_PKT_GEN_REQUEST_EVENT:
+		err = HandleDataPktGenRequestEvent(ue, msg)
+	case common.DATA_PKT_GEN_SUCCESS_EVENT:
+		err = HandleDataPktGenSuccessEvent(ue, msg)
+	case common.UL_UE_DATA_TRANSFER_EVENT:
+		err = HandleUlUeDataTransferEvent(ue, msg)
+	case common.SERVICE_REQUEST_EVENT:
+		err = HandleServiceRequestEvent(ue, msg)
+	case common.SERVICE_ACCEPT_EVENT:
+		err = HandleServiceAcceptEvent(ue, msg)
+	case common.CONNECTION_RELEASE_REQUEST_EVENT:
+		err = HandleConnectionReleaseRequestEvent(ue, msg)
+	case common.DEREG_ACCEPT_UE_TERM_EVENT:
+		err = HandleNwDeregAcceptEvent(ue, msg)
+	case common.MO_SMS_REQUEST_EVENT:
+		err = HandleMoSmsRequestEvent(ue, msg)
+	case common.CONFIG_UPDATE_COMMAND_EVENT:
+		err = HandleConfigUpdateCommandEvent(ue, msg)
+	case common.UE_STATE_QUERY_EVENT:
+		HandleUeStateQueryEvent(ue, msg)
+	case common.ERROR_EVENT:
+		HandleErrorEvent(ue, msg)
+	case common.QUIT_EVENT:
+		HandleQuitEvent(ue, msg)
+		return true
+	default:
+		ue.Log.Warnln("Event", event, "is not supported")
 	}
 
-	return nil
+	if err != nil {
+		ue.Log.Errorln("real ue failed:", event, ":", err)
+		msg := &common.UeMessage{}
+		msg.Error = err
+		msg.Event = common.ERROR_EVENT
+		HandleErrorEvent(ue, msg)
+	}
+	return false
 }
 
 func formUuMessage(event common.EventType, nasPdu []byte) *common.UuMessage {
@@ -89,5 +119,16 @@ func SendToSimUe(ue *realuectx.RealUe,
 	msg common.InterfaceMessage) {
 
 	ue.Log.Traceln("Sending", msg.GetEventType(), "to SimUe")
+	uuMsg, ok := msg.(*common.UuMessage)
+	if ok && (ue.LogNasPayloads || ue.Timeline != nil) {
+		// Security protected messages are logged and recorded before being
+		// protected
+		for _, pdu := range uuMsg.NasPdus {
+			if nas.GetSecurityHeaderType(pdu)&0x0f == nas.SecurityHeaderTypePlainNas {
+				realue_nas.LogNasPayload(ue, realue_nas.DIRECTION_UPLINK, pdu)
+				realue_nas.RecordNasMessage(ue, realue_nas.DIRECTION_UPLINK, pdu, len(pdu))
+			}
+		}
+	}
 	ue.WriteSimUeChan <- msg
 }
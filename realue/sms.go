@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package realue
+
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/common"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+	realue_nas "github.com/omec-project/gnbsim/realue/nas"
+	"github.com/omec-project/gnbsim/realue/sms"
+
+	"github.com/omec-project/nas"
+)
+
+// Number of transaction identifier values available to the UE for the CP
+// transactions it originates, TS 24.007 Section 11.2.3.1.3
+const SMS_TIO_COUNT uint8 = 7
+
+// HandleMoSmsRequestEvent sends the configured mobile originated SMS to the
+// SMSC, TS 24.011 Section 5.3.1
+func HandleMoSmsRequestEvent(ue *realuectx.RealUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	if !ue.SmsAllowed {
+		return fmt.Errorf("sms over nas not allowed by the network")
+	}
+
+	tpdu, err := sms.GetSmsSubmit(ue.SmsMr, ue.SmsDestination, ue.SmsText)
+	if err != nil {
+		return fmt.Errorf("failed to create sms-submit: %v", err)
+	}
+	rp := &sms.RpMessage{
+		MessageType:        sms.RP_DATA_MS_TO_NW,
+		MessageReference:   ue.SmsMr,
+		DestinationAddress: ue.Smsc,
+		UserData:           tpdu,
+	}
+	rpdu, err := rp.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to create rp-data: %v", err)
+	}
+	cp := &sms.CpMessage{
+		Tio:         ue.SmsTio,
+		MessageType: sms.CP_DATA,
+		UserData:    rpdu,
+	}
+	ue.SmsMr++
+	ue.SmsTio = (ue.SmsTio + 1) % SMS_TIO_COUNT
+
+	ue.Log.Infoln("Sending MO SMS to:", ue.SmsDestination, "via SMSC:", ue.Smsc)
+	return sendSms(ue, common.MO_SMS_REQUEST_EVENT, cp)
+}
+
+// handleDlSms handles the SMS message received in DL NAS Transport. Each
+// CP-DATA is acknowledged with CP-ACK. A mobile terminated SMS is further
+// acknowledged with RP-ACK, TS 24.011 Section 5.3.2
+func handleDlSms(ue *realuectx.RealUe, payload []byte) error {
+	cp, err := sms.DecodeCpMessage(payload)
+	if err != nil {
+		return fmt.Errorf("failed to decode cp message: %v", err)
+	}
+
+	switch cp.MessageType {
+	case sms.CP_ACK:
+		ue.Log.Traceln("Received CP-ACK, TIO:", cp.Tio)
+		return nil
+	case sms.CP_ERROR:
+		return fmt.Errorf("received cp-error, cause:%v", cp.Cause)
+	}
+
+	// Messages of a transaction are sent with the complementary TI flag
+	ack := &sms.CpMessage{
+		TiFlag:      !cp.TiFlag,
+		Tio:         cp.Tio,
+		MessageType: sms.CP_ACK,
+	}
+	err = sendSms(ue, common.SMS_UL_TRANSPORT_EVENT, ack)
+	if err != nil {
+		return err
+	}
+
+	rp, err := sms.DecodeRpMessage(cp.UserData)
+	if err != nil {
+		return fmt.Errorf("failed to decode rp message: %v", err)
+	}
+
+	switch rp.MessageType {
+	case sms.RP_ACK_NW_TO_MS:
+		ue.Log.Infoln("MO SMS acknowledged by the SMSC, message reference:",
+			rp.MessageReference)
+		m := &common.UeMessage{}
+		m.Event = common.MO_SMS_COMPLETE_EVENT
+		SendToSimUe(ue, m)
+		return nil
+	case sms.RP_ERROR_NW_TO_MS:
+		return fmt.Errorf("mo sms rejected by the smsc, rp cause:%v", rp.Cause)
+	}
+
+	deliver, err := sms.DecodeSmsDeliver(rp.UserData)
+	if err != nil {
+		return fmt.Errorf("failed to decode sms-deliver: %v", err)
+	}
+	ue.Log.Infoln("Received MT SMS from:", deliver.OriginatorAddress, "text:",
+		deliver.Text)
+
+	rpAck := &sms.RpMessage{
+		MessageType:      sms.RP_ACK_MS_TO_NW,
+		MessageReference: rp.MessageReference,
+	}
+	rpdu, err := rpAck.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to create rp-ack: %v", err)
+	}
+	cpData := &sms.CpMessage{
+		TiFlag:      !cp.TiFlag,
+		Tio:         cp.Tio,
+		MessageType: sms.CP_DATA,
+		UserData:    rpdu,
+	}
+	err = sendSms(ue, common.SMS_UL_TRANSPORT_EVENT, cpData)
+	if err != nil {
+		return err
+	}
+
+	m := &common.UeMessage{}
+	m.Event = common.MT_SMS_RECEIVED_EVENT
+	SendToSimUe(ue, m)
+	return nil
+}
+
+// sendSms sends the CP message to SimUe, in UL NAS Transport
+func sendSms(ue *realuectx.RealUe, event common.EventType,
+	cp *sms.CpMessage) error {
+
+	nasPdu, err := realue_nas.GetUlNasTransportSms(cp.Encode())
+	if err != nil {
+		return fmt.Errorf("failed to create ul nas transport: %v", err)
+	}
+	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
+		nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt ul nas transport: %v", err)
+	}
+
+	m := formUuMessage(event, nasPdu)
+	SendToSimUe(ue, m)
+	return nil
+}
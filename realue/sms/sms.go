@@ -0,0 +1,447 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sms
+
+import (
+	"fmt"
+)
+
+const (
+	// Protocol discriminator of the SMS messages, TS 24.007 Section 11.2.3.1.1
+	PD_SMS uint8 = 0x09
+
+	// CP message types, TS 24.011 Section 8.1.3
+	CP_DATA  uint8 = 0x01
+	CP_ACK   uint8 = 0x04
+	CP_ERROR uint8 = 0x10
+
+	// RP message types, TS 24.011 Section 8.2.2
+	RP_DATA_MS_TO_NW  uint8 = 0x00
+	RP_DATA_NW_TO_MS  uint8 = 0x01
+	RP_ACK_MS_TO_NW   uint8 = 0x02
+	RP_ACK_NW_TO_MS   uint8 = 0x03
+	RP_ERROR_MS_TO_NW uint8 = 0x04
+	RP_ERROR_NW_TO_MS uint8 = 0x05
+
+	// TP message type indicators, TS 23.040 Section 9.2.3.1
+	TP_MTI_SMS_DELIVER uint8 = 0x00
+	TP_MTI_SMS_SUBMIT  uint8 = 0x01
+
+	// Type of number and numbering plan identification of the addresses,
+	// international number in ISDN numbering plan
+	TON_NPI_INTERNATIONAL uint8 = 0x91
+
+	// Maximum length of the user data of a single SMS, in septets
+	MAX_TEXT_LENGTH int = 160
+
+	// Maximum number of digits of an address, TS 24.011 Section 8.2.5.1
+	MAX_ADDRESS_DIGITS int = 20
+)
+
+// CpMessage is a message of the short message control protocol, TS 24.011
+// Section 7.2. The transaction identifier flag is set in the messages sent by
+// the side which did not originate the transaction
+type CpMessage struct {
+	TiFlag      bool
+	Tio         uint8
+	MessageType uint8
+
+	// RPDU carried by CP-DATA
+	UserData []byte
+
+	// Cause carried by CP-ERROR
+	Cause uint8
+}
+
+// RpMessage is a message of the short message relay protocol, TS 24.011
+// Section 7.3. Addresses are only present in RP-DATA, while the cause is only
+// present in RP-ERROR
+type RpMessage struct {
+	MessageType        uint8
+	MessageReference   uint8
+	OriginatorAddress  string
+	DestinationAddress string
+	Cause              uint8
+
+	// TPDU carried by RP-DATA, and optionally by RP-ACK and RP-ERROR
+	UserData []byte
+}
+
+// SmsDeliver holds the fields of the SMS-DELIVER TPDU of interest to the UE
+type SmsDeliver struct {
+	OriginatorAddress string
+	Text              string
+}
+
+// Encode returns the encoded CP message
+func (m *CpMessage) Encode() []byte {
+	octet := m.Tio<<4 | PD_SMS
+	if m.TiFlag {
+		octet |= 0x80
+	}
+	b := []byte{octet, m.MessageType}
+	switch m.MessageType {
+	case CP_DATA:
+		b = append(b, uint8(len(m.UserData)))
+		b = append(b, m.UserData...)
+	case CP_ERROR:
+		b = append(b, m.Cause)
+	}
+	return b
+}
+
+// DecodeCpMessage decodes the CP message received from the network
+func DecodeCpMessage(b []byte) (*CpMessage, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("cp message too short: %v octets", len(b))
+	}
+	if b[0]&0x0f != PD_SMS {
+		return nil, fmt.Errorf("invalid protocol discriminator: %v", b[0]&0x0f)
+	}
+
+	m := &CpMessage{
+		TiFlag:      b[0]&0x80 != 0,
+		Tio:         (b[0] >> 4) & 0x07,
+		MessageType: b[1],
+	}
+	switch m.MessageType {
+	case CP_DATA:
+		if len(b) < 3 || len(b) < 3+int(b[2]) {
+			return nil, fmt.Errorf("invalid cp-data user data length")
+		}
+		m.UserData = b[3 : 3+int(b[2])]
+	case CP_ACK:
+	case CP_ERROR:
+		if len(b) < 3 {
+			return nil, fmt.Errorf("cp-error without cause")
+		}
+		m.Cause = b[2]
+	default:
+		return nil, fmt.Errorf("unsupported cp message type: %v", m.MessageType)
+	}
+	return m, nil
+}
+
+// Encode returns the encoded RP message. Only the messages sent by the UE are
+// supported
+func (m *RpMessage) Encode() ([]byte, error) {
+	b := []byte{m.MessageType, m.MessageReference}
+	switch m.MessageType {
+	case RP_DATA_MS_TO_NW:
+		// Originator address is not included by the UE
+		b = append(b, 0)
+		da, err := encodeRpAddress(m.DestinationAddress)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, da...)
+		b = append(b, uint8(len(m.UserData)))
+		b = append(b, m.UserData...)
+	case RP_ACK_MS_TO_NW:
+	case RP_ERROR_MS_TO_NW:
+		b = append(b, 1, m.Cause)
+	default:
+		return nil, fmt.Errorf("unsupported rp message type: %v", m.MessageType)
+	}
+	return b, nil
+}
+
+// DecodeRpMessage decodes the RP message received from the network
+func DecodeRpMessage(b []byte) (*RpMessage, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("rp message too short: %v octets", len(b))
+	}
+
+	m := &RpMessage{
+		MessageType:      b[0] & 0x07,
+		MessageReference: b[1],
+	}
+	b = b[2:]
+	var err error
+	switch m.MessageType {
+	case RP_DATA_NW_TO_MS:
+		m.OriginatorAddress, b, err = decodeRpAddress(b)
+		if err != nil {
+			return nil, err
+		}
+		m.DestinationAddress, b, err = decodeRpAddress(b)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return nil, fmt.Errorf("invalid rp-data user data length")
+		}
+		m.UserData = b[1 : 1+int(b[0])]
+	case RP_ACK_NW_TO_MS:
+	case RP_ERROR_NW_TO_MS:
+		if len(b) < 2 || b[0] == 0 {
+			return nil, fmt.Errorf("rp-error without cause")
+		}
+		m.Cause = b[1] & 0x7f
+	default:
+		return nil, fmt.Errorf("unsupported rp message type: %v", m.MessageType)
+	}
+	return m, nil
+}
+
+// GetSmsSubmit returns the SMS-SUBMIT TPDU carrying the text, encoded in the
+// GSM 7 bit default alphabet, TS 23.040 Section 9.2.2.2
+func GetSmsSubmit(messageReference uint8, destination, text string) ([]byte, error) {
+	septets, err := encodeGsm7Bit(text)
+	if err != nil {
+		return nil, err
+	}
+	da, err := encodeTpAddress(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	// No validity period, reply path or status report requested
+	b := []byte{TP_MTI_SMS_SUBMIT, messageReference}
+	b = append(b, da...)
+	// Protocol identifier and data coding scheme, GSM 7 bit default alphabet
+	b = append(b, 0x00, 0x00)
+	b = append(b, uint8(len(septets)))
+	b = append(b, packSeptets(septets)...)
+	return b, nil
+}
+
+// DecodeSmsDeliver decodes the SMS-DELIVER TPDU, TS 23.040 Section 9.2.2.1.
+// Text not encoded in the GSM 7 bit default alphabet is returned hex encoded
+func DecodeSmsDeliver(b []byte) (*SmsDeliver, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("sms-deliver too short: %v octets", len(b))
+	}
+	if b[0]&0x03 != TP_MTI_SMS_DELIVER {
+		return nil, fmt.Errorf("unexpected tp message type: %v", b[0]&0x03)
+	}
+	udhi := b[0]&0x40 != 0
+
+	deliver := &SmsDeliver{}
+	digits := int(b[1])
+	addrLen := 2 + (digits+1)/2
+	if len(b) < 1+addrLen {
+		return nil, fmt.Errorf("invalid tp originating address")
+	}
+	deliver.OriginatorAddress = decodeBcd(b[3:1+addrLen], digits)
+	b = b[1+addrLen:]
+
+	// Protocol identifier, data coding scheme, service centre time stamp and
+	// user data length
+	if len(b) < 10 {
+		return nil, fmt.Errorf("sms-deliver too short")
+	}
+	dcs := b[1]
+	udl := int(b[9])
+	ud := b[10:]
+
+	// Coding groups 00xx with the alphabet bits set to 00 indicate the GSM 7
+	// bit default alphabet, TS 23.038 Section 4
+	if dcs&0xc0 != 0 || dcs&0x0c != 0 {
+		if len(ud) < udl {
+			return nil, fmt.Errorf("invalid tp user data length")
+		}
+		deliver.Text = fmt.Sprintf("%x", ud[:udl])
+		return deliver, nil
+	}
+
+	septets := unpackSeptets(ud, udl)
+	if udhi && len(ud) > 0 {
+		// User data header is padded to a septet boundary
+		udhSeptets := ((int(ud[0])+1)*8 + 6) / 7
+		if udhSeptets > len(septets) {
+			return nil, fmt.Errorf("invalid tp user data header length")
+		}
+		septets = septets[udhSeptets:]
+	}
+	deliver.Text = decodeGsm7Bit(septets)
+	return deliver, nil
+}
+
+// ValidateAddress checks that the address consists of up to
+// MAX_ADDRESS_DIGITS digits
+func ValidateAddress(address string) error {
+	if address == "" || len(address) > MAX_ADDRESS_DIGITS {
+		return fmt.Errorf("invalid address:%v, expected 1 to %v digits",
+			address, MAX_ADDRESS_DIGITS)
+	}
+	for _, c := range address {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("invalid address:%v, expected digits only", address)
+		}
+	}
+	return nil
+}
+
+// ValidateText checks that the text fits in a single SMS encoded in the GSM 7
+// bit default alphabet
+func ValidateText(text string) error {
+	_, err := encodeGsm7Bit(text)
+	return err
+}
+
+// encodeRpAddress returns the RP address IE with the length octet, TS 24.011
+// Section 8.2.5.1
+func encodeRpAddress(address string) ([]byte, error) {
+	err := ValidateAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	bcd := encodeBcd(address)
+	b := []byte{uint8(1 + len(bcd)), TON_NPI_INTERNATIONAL}
+	return append(b, bcd...), nil
+}
+
+// decodeRpAddress decodes the RP address IE with the length octet and returns
+// the octets following it
+func decodeRpAddress(b []byte) (string, []byte, error) {
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return "", nil, fmt.Errorf("invalid rp address length")
+	}
+	length := int(b[0])
+	if length == 0 {
+		return "", b[1:], nil
+	}
+	return decodeBcd(b[2:1+length], 2*(length-1)), b[1+length:], nil
+}
+
+// encodeTpAddress returns the TP address, TS 23.040 Section 9.1.2.5. The
+// length is the number of digits
+func encodeTpAddress(address string) ([]byte, error) {
+	err := ValidateAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	b := []byte{uint8(len(address)), TON_NPI_INTERNATIONAL}
+	return append(b, encodeBcd(address)...), nil
+}
+
+// encodeBcd encodes the digits in semi-octets, padding the odd number of
+// digits with 0xf
+func encodeBcd(digits string) []byte {
+	b := make([]byte, (len(digits)+1)/2)
+	for i := range b {
+		low := digits[2*i] - '0'
+		high := uint8(0x0f)
+		if 2*i+1 < len(digits) {
+			high = digits[2*i+1] - '0'
+		}
+		b[i] = high<<4 | low
+	}
+	return b
+}
+
+// decodeBcd decodes up to maxDigits semi-octets, stopping at the 0xf filler
+func decodeBcd(b []byte, maxDigits int) string {
+	digits := make([]byte, 0, maxDigits)
+	for _, octet := range b {
+		for _, d := range []uint8{octet & 0x0f, octet >> 4} {
+			if d > 9 || len(digits) == maxDigits {
+				return string(digits)
+			}
+			digits = append(digits, '0'+d)
+		}
+	}
+	return string(digits)
+}
+
+// gsm7BitChars maps the characters of the GSM 7 bit default alphabet which
+// differ from ASCII, TS 23.038 Section 6.2.1. The printable ASCII characters
+// not listed here, other than those in gsm7BitUnsupported, are encoded as is
+var gsm7BitChars = map[rune]uint8{
+	'@':  0x00,
+	'$':  0x02,
+	'_':  0x11,
+	'\n': 0x0a,
+	'\r': 0x0d,
+}
+
+// Printable ASCII characters which are not part of the default alphabet or
+// require the escape extension
+const gsm7BitUnsupported = "`[\\]^{|}~"
+
+func encodeGsm7Bit(text string) ([]uint8, error) {
+	var septets []uint8
+	for _, c := range text {
+		if septet, ok := gsm7BitChars[c]; ok {
+			septets = append(septets, septet)
+			continue
+		}
+		if !isGsm7BitAscii(c) {
+			return nil, fmt.Errorf("character %q not supported in gsm 7 bit default alphabet", c)
+		}
+		septets = append(septets, uint8(c))
+	}
+	if len(septets) > MAX_TEXT_LENGTH {
+		return nil, fmt.Errorf("text too long:%v characters, up to %v supported",
+			len(septets), MAX_TEXT_LENGTH)
+	}
+	return septets, nil
+}
+
+func decodeGsm7Bit(septets []uint8) string {
+	text := make([]rune, 0, len(septets))
+	for _, septet := range septets {
+		c := rune(septet)
+		if !isGsm7BitAscii(c) {
+			c = '?'
+		}
+		for r, s := range gsm7BitChars {
+			if s == septet {
+				c = r
+				break
+			}
+		}
+		text = append(text, c)
+	}
+	return string(text)
+}
+
+// isGsm7BitAscii checks if the character is encoded as is in the default
+// alphabet
+func isGsm7BitAscii(c rune) bool {
+	if c < 0x20 || c > 0x7e {
+		return false
+	}
+	if _, ok := gsm7BitChars[c]; ok {
+		return false
+	}
+	for _, r := range gsm7BitUnsupported {
+		if r == c {
+			return false
+		}
+	}
+	return true
+}
+
+// packSeptets packs the septets into octets, TS 23.038 Section 6.1.2.1.1
+func packSeptets(septets []uint8) []byte {
+	b := make([]byte, (len(septets)*7+7)/8)
+	for i, septet := range septets {
+		bit := i * 7
+		b[bit/8] |= septet << (bit % 8)
+		if bit%8 > 1 {
+			b[bit/8+1] |= septet >> (8 - bit%8)
+		}
+	}
+	return b
+}
+
+// unpackSeptets unpacks up to count septets from the octets
+func unpackSeptets(b []byte, count int) []uint8 {
+	if maxCount := len(b) * 8 / 7; count > maxCount {
+		count = maxCount
+	}
+	septets := make([]uint8, count)
+	for i := range septets {
+		bit := i * 7
+		septet := b[bit/8] >> (bit % 8)
+		if bit%8 > 1 {
+			septet |= b[bit/8+1] << (8 - bit%8)
+		}
+		septets[i] = septet & 0x7f
+	}
+	return septets
+}
@@ -0,0 +1,248 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/ipv4"
+)
+
+// Minimal TCP client, RFC 793, sufficient for a request response exchange
+// over the PDU session. The path through the UPF is expected to be lossless,
+// segments are neither retransmitted nor reordered. Losses are detected by
+// the profile timeout
+
+// TCP header flags
+const (
+	FLAG_FIN uint8 = 0x01
+	FLAG_SYN uint8 = 0x02
+	FLAG_RST uint8 = 0x04
+	FLAG_PSH uint8 = 0x08
+	FLAG_ACK uint8 = 0x10
+)
+
+const (
+	IP_PROTOCOL_TCP  int    = 6
+	IPV4_HEADER_LEN  int    = 20
+	TCP_HEADER_LEN   int    = 20
+	TCP_MSS_OPT_LEN  int    = 4
+	TCP_WINDOW       uint16 = 65535
+	TCP_MSS          uint16 = 1360
+	TCP_OPT_KIND_MSS uint8  = 2
+	TCP_OPT_LEN_MSS  uint8  = 4
+)
+
+// Connection states
+const (
+	STATE_CLOSED = iota
+	STATE_SYN_SENT
+	STATE_ESTABLISHED
+	STATE_LAST_ACK
+)
+
+// Conn is a TCP connection initiated by the UE. Packets to be sent are
+// returned as IPv4 packets, to be sent over the PDU session
+type Conn struct {
+	Src     net.IP
+	Dst     net.IP
+	SrcPort uint16
+	DstPort uint16
+
+	State  int
+	sndNxt uint32
+	rcvNxt uint32
+
+	// Data received from the peer, until the peer closes the connection
+	Received []byte
+}
+
+func NewConn(src, dst net.IP, srcPort, dstPort uint16, iss uint32) *Conn {
+	return &Conn{
+		Src:     src.To4(),
+		Dst:     dst.To4(),
+		SrcPort: srcPort,
+		DstPort: dstPort,
+		sndNxt:  iss,
+	}
+}
+
+// Connect returns the SYN opening the connection
+func (c *Conn) Connect() ([]byte, error) {
+	if c.State != STATE_CLOSED {
+		return nil, fmt.Errorf("connection already open")
+	}
+	mss := make([]byte, TCP_MSS_OPT_LEN)
+	mss[0], mss[1] = TCP_OPT_KIND_MSS, TCP_OPT_LEN_MSS
+	binary.BigEndian.PutUint16(mss[2:], TCP_MSS)
+
+	pkt := c.buildPacket(FLAG_SYN, mss, nil)
+	c.sndNxt++
+	c.State = STATE_SYN_SENT
+	return pkt, nil
+}
+
+// Send returns the segments carrying the data
+func (c *Conn) Send(data []byte) ([][]byte, error) {
+	if c.State != STATE_ESTABLISHED {
+		return nil, fmt.Errorf("connection not established")
+	}
+	var pkts [][]byte
+	for len(data) != 0 {
+		n := len(data)
+		if n > int(TCP_MSS) {
+			n = int(TCP_MSS)
+		}
+		pkt := c.buildPacket(FLAG_ACK|FLAG_PSH, nil, data[:n])
+		c.sndNxt += uint32(n)
+		pkts = append(pkts, pkt)
+		data = data[n:]
+	}
+	return pkts, nil
+}
+
+// Handle processes the TCP segment received from the peer, and returns the
+// packets to be sent in response. The connection is established once the
+// SYN-ACK is received, and closed once the peer has closed it and the FIN of
+// the UE is acknowledged
+func (c *Conn) Handle(segment []byte) ([][]byte, error) {
+	if len(segment) < TCP_HEADER_LEN {
+		return nil, fmt.Errorf("tcp segment too short")
+	}
+	seq := binary.BigEndian.Uint32(segment[4:])
+	ack := binary.BigEndian.Uint32(segment[8:])
+	dataOffset := int(segment[12]>>4) * 4
+	flags := segment[13]
+	if dataOffset < TCP_HEADER_LEN || dataOffset > len(segment) {
+		return nil, fmt.Errorf("invalid tcp data offset:%v", dataOffset)
+	}
+	payload := segment[dataOffset:]
+
+	if flags&FLAG_RST != 0 {
+		c.State = STATE_CLOSED
+		return nil, fmt.Errorf("connection reset by peer")
+	}
+
+	switch c.State {
+	case STATE_SYN_SENT:
+		if flags&(FLAG_SYN|FLAG_ACK) != FLAG_SYN|FLAG_ACK || ack != c.sndNxt {
+			return nil, fmt.Errorf("unexpected segment in syn-sent, flags:0x%x", flags)
+		}
+		c.rcvNxt = seq + 1
+		c.State = STATE_ESTABLISHED
+		pkt := c.buildPacket(FLAG_ACK, nil, nil)
+		return [][]byte{pkt}, nil
+
+	case STATE_ESTABLISHED:
+		if seq != c.rcvNxt {
+			// Out of order segment, the expected segment is re-requested
+			pkt := c.buildPacket(FLAG_ACK, nil, nil)
+			return [][]byte{pkt}, nil
+		}
+		c.Received = append(c.Received, payload...)
+		c.rcvNxt += uint32(len(payload))
+
+		if flags&FLAG_FIN != 0 {
+			// Peer closed the connection, the UE closes its side
+			c.rcvNxt++
+			pkt := c.buildPacket(FLAG_FIN|FLAG_ACK, nil, nil)
+			c.sndNxt++
+			c.State = STATE_LAST_ACK
+			return [][]byte{pkt}, nil
+		}
+		if len(payload) == 0 {
+			return nil, nil
+		}
+		pkt := c.buildPacket(FLAG_ACK, nil, nil)
+		return [][]byte{pkt}, nil
+
+	case STATE_LAST_ACK:
+		if flags&FLAG_ACK != 0 && ack == c.sndNxt {
+			c.State = STATE_CLOSED
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected segment, connection closed")
+}
+
+// Matches returns true if the TCP segment belongs to the connection
+func (c *Conn) Matches(segment []byte) bool {
+	if len(segment) < TCP_HEADER_LEN {
+		return false
+	}
+	return binary.BigEndian.Uint16(segment[0:]) == c.DstPort &&
+		binary.BigEndian.Uint16(segment[2:]) == c.SrcPort
+}
+
+// buildPacket returns the IPv4 packet carrying the TCP segment
+func (c *Conn) buildPacket(flags uint8, options []byte, data []byte) []byte {
+	tcpLen := TCP_HEADER_LEN + len(options) + len(data)
+	ipv4hdr := ipv4.Header{
+		Version:  4,
+		Len:      IPV4_HEADER_LEN,
+		Protocol: IP_PROTOCOL_TCP,
+		TotalLen: IPV4_HEADER_LEN + tcpLen,
+		TTL:      64,
+		Src:      c.Src,
+		Dst:      c.Dst,
+		ID:       1,
+	}
+
+	pkt := make([]byte, IPV4_HEADER_LEN+tcpLen)
+	copy(pkt, ipv4HeaderBytes(&ipv4hdr))
+	binary.BigEndian.PutUint16(pkt[10:], checksum(pkt[:IPV4_HEADER_LEN]))
+	seg := pkt[IPV4_HEADER_LEN:]
+	binary.BigEndian.PutUint16(seg[0:], c.SrcPort)
+	binary.BigEndian.PutUint16(seg[2:], c.DstPort)
+	binary.BigEndian.PutUint32(seg[4:], c.sndNxt)
+	if flags&FLAG_ACK != 0 {
+		binary.BigEndian.PutUint32(seg[8:], c.rcvNxt)
+	}
+	seg[12] = uint8((TCP_HEADER_LEN+len(options))/4) << 4
+	seg[13] = flags
+	binary.BigEndian.PutUint16(seg[14:], TCP_WINDOW)
+	copy(seg[TCP_HEADER_LEN:], options)
+	copy(seg[TCP_HEADER_LEN+len(options):], data)
+
+	pseudo := make([]byte, 12)
+	copy(pseudo[0:], c.Src)
+	copy(pseudo[4:], c.Dst)
+	pseudo[9] = uint8(IP_PROTOCOL_TCP)
+	binary.BigEndian.PutUint16(pseudo[10:], uint16(tcpLen))
+	binary.BigEndian.PutUint16(seg[16:], checksum(pseudo, seg))
+	return pkt
+}
+
+// ipv4HeaderBytes returns the encoded IPv4 header without checksum
+func ipv4HeaderBytes(h *ipv4.Header) []byte {
+	b := make([]byte, IPV4_HEADER_LEN)
+	b[0] = uint8(h.Version<<4 | h.Len>>2)
+	binary.BigEndian.PutUint16(b[2:], uint16(h.TotalLen))
+	binary.BigEndian.PutUint16(b[4:], uint16(h.ID))
+	b[8] = uint8(h.TTL)
+	b[9] = uint8(h.Protocol)
+	copy(b[12:], h.Src.To4())
+	copy(b[16:], h.Dst.To4())
+	return b
+}
+
+// checksum returns the internet checksum over the provided buffers, RFC 1071
+func checksum(bufs ...[]byte) uint16 {
+	var sum uint32
+	for _, b := range bufs {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(b[i])<<8 | uint32(b[i+1])
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
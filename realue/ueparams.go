@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package realue
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/omec-project/gnbsim/common"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+	realue_nas "github.com/omec-project/gnbsim/realue/nas"
+
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasMessage"
+)
+
+// Fields of the SOR and UE parameters update transparent containers, TS 24.501
+// Section 9.11.3.51 and 9.11.3.53A. Both the containers begin with a header,
+// followed by a 16 octet MAC and a 2 octet counter, unless acknowledging
+const (
+	SOR_DATA_TYPE_ACK     uint8 = 0x01
+	SOR_LIST_INDICATION   uint8 = 0x02
+	SOR_ACK_REQUESTED     uint8 = 0x08
+	UPU_DATA_TYPE_ACK     uint8 = 0x01
+	UPU_ACK_REQUESTED     uint8 = 0x02
+	UPU_REG_REQUESTED     uint8 = 0x04
+	UE_PARAMS_MAC_LENGTH  int   = 16
+	UE_PARAMS_DATA_OFFSET int   = 1 + UE_PARAMS_MAC_LENGTH + 2
+)
+
+// handleSorContainer verifies the integrity of the SOR transparent container
+// received from the network and returns the acknowledgement, or nil if not
+// requested. The integrity is not verified, nor is the acknowledgement
+// generated, when K_AUSF is not available
+func handleSorContainer(ue *realuectx.RealUe, container []byte) ([]byte, error) {
+	if len(container) < UE_PARAMS_DATA_OFFSET {
+		return nil, fmt.Errorf("sor transparent container too short: %v octets",
+			len(container))
+	}
+	header := container[0]
+	if header&SOR_DATA_TYPE_ACK != 0 {
+		return nil, fmt.Errorf("unexpected sor acknowledgement")
+	}
+	mac := container[1 : 1+UE_PARAMS_MAC_LENGTH]
+	counter := container[1+UE_PARAMS_MAC_LENGTH : UE_PARAMS_DATA_OFFSET]
+	list := container[UE_PARAMS_DATA_OFFSET:]
+	ue.Log.Infof("Received SOR transparent container, list indication:%v, ack requested:%v, counter:%x, list:%x",
+		header&SOR_LIST_INDICATION != 0, header&SOR_ACK_REQUESTED != 0, counter, list)
+
+	if ue.Kausf == nil {
+		ue.Log.Warnln("K_AUSF not available, SOR integrity not verified")
+		return nil, nil
+	}
+	expected := ue.GetSorMacIausf(header, counter, list)
+	if !bytes.Equal(mac, expected) {
+		return nil, fmt.Errorf("sor-mac-iausf mismatch, expected:%x, received:%x",
+			expected, mac)
+	}
+	ue.Log.Infoln("SOR integrity verified")
+
+	if header&SOR_ACK_REQUESTED == 0 {
+		return nil, nil
+	}
+	ack := []byte{SOR_DATA_TYPE_ACK}
+	return append(ack, ue.GetSorMacIue(counter)...), nil
+}
+
+// handleUpuContainer verifies the integrity of the UE parameters update
+// transparent container received from the network and returns the
+// acknowledgement, or nil if not requested. The integrity is not verified,
+// nor is the acknowledgement generated, when K_AUSF is not available
+func handleUpuContainer(ue *realuectx.RealUe, container []byte) ([]byte, error) {
+	if len(container) < UE_PARAMS_DATA_OFFSET {
+		return nil, fmt.Errorf("ue parameters update transparent container too short: %v octets",
+			len(container))
+	}
+	header := container[0]
+	if header&UPU_DATA_TYPE_ACK != 0 {
+		return nil, fmt.Errorf("unexpected ue parameters update acknowledgement")
+	}
+	mac := container[1 : 1+UE_PARAMS_MAC_LENGTH]
+	counter := container[1+UE_PARAMS_MAC_LENGTH : UE_PARAMS_DATA_OFFSET]
+	data := container[UE_PARAMS_DATA_OFFSET:]
+	ue.Log.Infof("Received UE parameters update transparent container, ack requested:%v, re-registration requested:%v, counter:%x, data:%x",
+		header&UPU_ACK_REQUESTED != 0, header&UPU_REG_REQUESTED != 0, counter, data)
+
+	if ue.Kausf == nil {
+		ue.Log.Warnln("K_AUSF not available, UE parameters update integrity not verified")
+		return nil, nil
+	}
+	expected := ue.GetUpuMacIausf(data, counter)
+	if !bytes.Equal(mac, expected) {
+		return nil, fmt.Errorf("upu-mac-iausf mismatch, expected:%x, received:%x",
+			expected, mac)
+	}
+	ue.Log.Infoln("UE parameters update integrity verified")
+
+	if header&UPU_ACK_REQUESTED == 0 {
+		return nil, nil
+	}
+	ack := []byte{UPU_DATA_TYPE_ACK}
+	return append(ack, ue.GetUpuMacIue(counter)...), nil
+}
+
+// handleDlUeParams handles the SOR or UE parameters update transparent
+// container received in DL NAS Transport, acknowledging it in UL NAS
+// Transport when requested
+func handleDlUeParams(ue *realuectx.RealUe, containerType uint8,
+	container []byte) error {
+
+	var ack []byte
+	var err error
+	if containerType == nasMessage.PayloadContainerTypeSOR {
+		ack, err = handleSorContainer(ue, container)
+	} else {
+		ack, err = handleUpuContainer(ue, container)
+	}
+	if err != nil || ack == nil {
+		return err
+	}
+
+	nasPdu, err := realue_nas.GetUlNasTransport(containerType, ack)
+	if err != nil {
+		return fmt.Errorf("failed to create ul nas transport: %v", err)
+	}
+	nasPdu, err = realue_nas.EncodeNasPduWithSecurity(ue, nasPdu,
+		nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt ul nas transport: %v", err)
+	}
+
+	m := formUuMessage(common.UL_NAS_TRANSPORT_EVENT, nasPdu)
+	SendToSimUe(ue, m)
+	ue.Log.Infoln("Sent acknowledgement of payload container type:", containerType)
+	return nil
+}
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package util
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/omec-project/nas/nasConvert"
+	"github.com/omec-project/openapi/models"
+)
+
+// Types of the partial tracking area identity lists, TS 24.501 Section
+// 9.11.3.9
+const (
+	TAI_LIST_TYPE_TACS_ONE_PLMN             uint8 = 0x00
+	TAI_LIST_TYPE_CONSECUTIVE_TACS_ONE_PLMN uint8 = 0x01
+	TAI_LIST_TYPE_TAIS_MULTIPLE_PLMNS       uint8 = 0x02
+)
+
+// DecodeLadnInformation returns the LADN service area, the list of TAIs,
+// of each DNN in the value of the LADN information IE, TS 24.501 Section
+// 9.11.3.30
+func DecodeLadnInformation(buf []byte) (map[string][]models.Tai, error) {
+	ladns := make(map[string][]models.Tai)
+	for len(buf) != 0 {
+		if len(buf) < 1+int(buf[0]) {
+			return nil, fmt.Errorf("invalid ladn dnn length")
+		}
+		dnn := decodeDnn(buf[1 : 1+int(buf[0])])
+		buf = buf[1+int(buf[0]):]
+
+		if len(buf) < 1 || len(buf) < 1+int(buf[0]) {
+			return nil, fmt.Errorf("invalid ladn tai list length, dnn:%v", dnn)
+		}
+		tais, err := DecodeTaiList(buf[1 : 1+int(buf[0])])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ladn tai list, dnn:%v: %v", dnn, err)
+		}
+		buf = buf[1+int(buf[0]):]
+		ladns[dnn] = tais
+	}
+	return ladns, nil
+}
+
+// DecodeTaiList returns the TAIs in the value of the 5GS tracking area
+// identity list IE, TS 24.501 Section 9.11.3.9
+func DecodeTaiList(buf []byte) ([]models.Tai, error) {
+	var tais []models.Tai
+	for len(buf) != 0 {
+		listType := (buf[0] >> 5) & 0x03
+		count := int(buf[0]&0x1f) + 1
+		buf = buf[1:]
+
+		switch listType {
+		case TAI_LIST_TYPE_TACS_ONE_PLMN:
+			if len(buf) < 3+3*count {
+				return nil, fmt.Errorf("partial tai list too short")
+			}
+			plmn := decodePlmnId(buf[:3])
+			for i := 0; i < count; i++ {
+				tac := hex.EncodeToString(buf[3+3*i : 6+3*i])
+				tais = append(tais, models.Tai{PlmnId: plmn, Tac: tac})
+			}
+			buf = buf[3+3*count:]
+		case TAI_LIST_TYPE_CONSECUTIVE_TACS_ONE_PLMN:
+			if len(buf) < 6 {
+				return nil, fmt.Errorf("partial tai list too short")
+			}
+			plmn := decodePlmnId(buf[:3])
+			tac := uint32(buf[3])<<16 | uint32(buf[4])<<8 | uint32(buf[5])
+			for i := 0; i < count; i++ {
+				tais = append(tais, models.Tai{
+					PlmnId: plmn,
+					Tac:    fmt.Sprintf("%06x", tac+uint32(i)),
+				})
+			}
+			buf = buf[6:]
+		case TAI_LIST_TYPE_TAIS_MULTIPLE_PLMNS:
+			if len(buf) < 6*count {
+				return nil, fmt.Errorf("partial tai list too short")
+			}
+			for i := 0; i < count; i++ {
+				tais = append(tais, models.Tai{
+					PlmnId: decodePlmnId(buf[6*i : 6*i+3]),
+					Tac:    hex.EncodeToString(buf[6*i+3 : 6*i+6]),
+				})
+			}
+			buf = buf[6*count:]
+		default:
+			return nil, fmt.Errorf("unsupported partial tai list type:%v", listType)
+		}
+	}
+	return tais, nil
+}
+
+// decodeDnn returns the DNN encoded as the APN labels, TS 23.003 Section
+// 9.1. The value is taken as is when not encoded as labels, as done by some
+// networks
+func decodeDnn(buf []byte) string {
+	var labels []string
+	for i := 0; i < len(buf); {
+		length := int(buf[i])
+		if length == 0 || i+1+length > len(buf) {
+			return string(buf)
+		}
+		labels = append(labels, string(buf[i+1:i+1+length]))
+		i += 1 + length
+	}
+	return strings.Join(labels, ".")
+}
+
+func decodePlmnId(buf []byte) *models.PlmnId {
+	plmn := nasConvert.PlmnIDToString(buf)
+	return &models.PlmnId{Mcc: plmn[:3], Mnc: plmn[3:]}
+}
@@ -5,9 +5,13 @@
 package util
 
 import (
+	"encoding/binary"
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/omec-project/nas/nasConvert"
+	"github.com/omec-project/nas/nasMessage"
 	"github.com/omec-project/openapi/models"
 	"github.com/yerden/go-util/bcd"
 )
@@ -18,10 +22,28 @@ const (
 	PROTECTION_SCHEME_ID uint8 = 0x00 // null scheme
 	PUBLIC_KEY_ID        uint8 = 0x00
 	SUCI_LEN             uint8 = 22
+
+	// Not defined by the NAS library, TS 24.008 section 10.5.7.4a
+	GPRS_TIMER3_UNIT_MULTIPLES_OF_320_HOURS uint8 = 0x06
+
+	// GPRS Timer 2 units, TS 24.008 section 10.5.7.4
+	GPRS_TIMER2_UNIT_MULTIPLES_OF_2_SECONDS uint8 = 0x00
+	GPRS_TIMER2_UNIT_MULTIPLES_OF_1_MINUTE  uint8 = 0x01
+	GPRS_TIMER2_UNIT_MULTIPLES_OF_DECIHOURS uint8 = 0x02
 )
 
 var ROUTING_INDICATOR []uint8 = []uint8{0xf0, 0xff}
 
+// multipliers for converting bit rates to Kbps
+var bitRateUnits = map[string]float64{
+	"bps":  0.001,
+	"Kbps": 1,
+	"Mbps": 1e3,
+	"Gbps": 1e6,
+	"Tbps": 1e9,
+	"Pbps": 1e12,
+}
+
 func SupiToSuci(supi string, plmnid *models.PlmnId) ([]byte, error) {
 	index := strings.Index(supi, "-")
 	if index < 0 {
@@ -31,43 +53,31 @@ func SupiToSuci(supi string, plmnid *models.PlmnId) ([]byte, error) {
 	// extracting imsi part after "imsi-"
 	imsi := supi[(index + 1):]
 
-	if !strings.Contains(imsi, plmnid.Mcc) {
-		return nil, fmt.Errorf("mcc not found in imsi")
+	// MCC and MNC of the home network are the leading digits of the imsi
+	if len(plmnid.Mcc) != 3 || (len(plmnid.Mnc) != 2 && len(plmnid.Mnc) != 3) {
+		return nil, fmt.Errorf("invalid home plmn id, mcc:%v, mnc:%v",
+			plmnid.Mcc, plmnid.Mnc)
 	}
-
-	index = strings.Index(imsi, plmnid.Mnc)
-	if index < 0 {
-		return nil, fmt.Errorf("mnc not found in imsi")
+	if !strings.HasPrefix(imsi, plmnid.Mcc+plmnid.Mnc) {
+		return nil, fmt.Errorf("imsi does not start with the home plmn id")
 	}
-	index += len(plmnid.Mnc)
 	// extracting msin from imsi
-	msin := imsi[index:]
+	msin := imsi[len(plmnid.Mcc)+len(plmnid.Mnc):]
 
 	suci := make([]uint8, 0, SUCI_LEN)
 	// creating octet 4 of 5GS mobile identity info
 	octet := (SUPI_FORMAT << 4) | ID_TYPE
 	suci = append(suci, octet)
 
-	enc := bcd.NewEncoder(bcd.Telephony)
-	bcdMcc := make([]byte, bcd.EncodedLen(len(plmnid.Mcc)))
-	_, err := enc.Encode(bcdMcc, []byte(plmnid.Mcc))
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode mcc in bcd format:%v", err)
-	}
-	suci = append(suci, bcdMcc...)
-
-	bcdMnc := make([]byte, bcd.EncodedLen(len(plmnid.Mnc)))
-	_, err = enc.Encode(bcdMnc, []byte(plmnid.Mnc))
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode mnc in bcd format:%v", err)
-	}
-	suci = append(suci, bcdMnc...)
+	// MNC digit 3 shares the octet with MCC digit 3, TS 24.501 Figure 9.11.3.4.3
+	suci = append(suci, nasConvert.PlmnIDToNas(*plmnid)...)
 	suci = append(suci, ROUTING_INDICATOR...)
 	suci = append(suci, PROTECTION_SCHEME_ID)
 	suci = append(suci, PUBLIC_KEY_ID)
 
+	enc := bcd.NewEncoder(bcd.Telephony)
 	bcdMsin := make([]byte, bcd.EncodedLen(len(msin)))
-	_, err = enc.Encode(bcdMsin, []byte(msin))
+	_, err := enc.Encode(bcdMsin, []byte(msin))
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode msin in bcd format:%v", err)
 	}
@@ -75,3 +85,113 @@ func SupiToSuci(supi string, plmnid *models.PlmnId) ([]byte, error) {
 
 	return suci, nil
 }
+
+// ParseBitRate converts a bit rate in the format used by the openapi models,
+// e.g. "100 Mbps", to Kbps
+func ParseBitRate(bitRate string) (uint64, error) {
+	fields := strings.Fields(bitRate)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("invalid bit rate:%v, expected format is <value> <unit>", bitRate)
+	}
+
+	multiplier, ok := bitRateUnits[fields[1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid bit rate unit:%v", fields[1])
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid bit rate value:%v", fields[0])
+	}
+	return uint64(value * multiplier), nil
+}
+
+// GetSessionAmbrKbps converts the Session-AMBR unit and value, as encoded in
+// TS 24.501 section 9.11.4.14, to Kbps
+func GetSessionAmbrKbps(unit uint8, value [2]uint8) uint64 {
+	if unit == nasMessage.SessionAMBRUnitNotUsed ||
+		unit > nasMessage.SessionAMBRUnit256Pbps {
+		return 0
+	}
+
+	// Units increase in multiples of 4 starting from 1 Kbps, and restart from
+	// a multiple of 1000 every 5 steps i.e. 1 Mbps, 1 Gbps and so on
+	step := unit - nasMessage.SessionAMBRUnit1Kbps
+	multiplier := uint64(1)
+	for i := uint8(0); i < step/5; i++ {
+		multiplier *= 1000
+	}
+	for i := uint8(0); i < step%5; i++ {
+		multiplier *= 4
+	}
+	return uint64(binary.BigEndian.Uint16(value[:])) * multiplier
+}
+
+// GetGprsTimer3Seconds converts the GPRS Timer 3 unit and value, TS 24.008
+// section 10.5.7.4a, to seconds. Returns false if the timer is deactivated
+func GetGprsTimer3Seconds(unit, value uint8) (uint32, bool) {
+	var multiplier uint32
+	switch unit {
+	case nasMessage.GPRSTimer3UnitMultiplesOf10Minutes:
+		multiplier = 600
+	case nasMessage.GPRSTimer3UnitMultiplesOf1Hour:
+		multiplier = 3600
+	case nasMessage.GPRSTimer3UnitMultiplesOf10Hours:
+		multiplier = 36000
+	case nasMessage.GPRSTimer3UnitMultiplesOf2Seconds:
+		multiplier = 2
+	case nasMessage.GPRSTimer3UnitMultiplesOf30Seconds:
+		multiplier = 30
+	case nasMessage.GPRSTimer3UnitMultiplesOf1Minute:
+		multiplier = 60
+	case GPRS_TIMER3_UNIT_MULTIPLES_OF_320_HOURS:
+		multiplier = 320 * 3600
+	default:
+		return 0, false
+	}
+	return uint32(value) * multiplier, true
+}
+
+// GetGprsTimer2Seconds converts the GPRS Timer 2 value octet, TS 24.008
+// section 10.5.7.4, to seconds. Returns false if the timer is deactivated
+func GetGprsTimer2Seconds(octet uint8) (uint32, bool) {
+	var multiplier uint32
+	switch octet >> 5 {
+	case GPRS_TIMER2_UNIT_MULTIPLES_OF_2_SECONDS:
+		multiplier = 2
+	case GPRS_TIMER2_UNIT_MULTIPLES_OF_1_MINUTE:
+		multiplier = 60
+	case GPRS_TIMER2_UNIT_MULTIPLES_OF_DECIHOURS:
+		multiplier = 360
+	default:
+		return 0, false
+	}
+	return uint32(octet&0x1f) * multiplier, true
+}
+
+// GetPduSessionIds returns the PDU session IDs set in the PSI bitmap of the
+// PDU session status, uplink data status and PDU session reactivation result
+// IEs, TS 24.501 Section 9.11.3.44
+func GetPduSessionIds(bitmap []uint8) []int64 {
+	var ids []int64
+	for i, octet := range bitmap {
+		for bit := 0; bit < 8; bit++ {
+			// PSI 0 is spare
+			id := int64(i*8 + bit)
+			if id != 0 && octet&(1<<uint(bit)) != 0 {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// GetServingNetworkName returns the serving network name used in the key
+// derivations, TS 24.501 Section 9.12.1
+func GetServingNetworkName(plmnid *models.PlmnId) string {
+	mnc := plmnid.Mnc
+	if len(mnc) == 2 {
+		mnc = "0" + mnc
+	}
+	return fmt.Sprintf("5G:mnc%v.mcc%v.3gppnetwork.org", mnc, plmnid.Mcc)
+}
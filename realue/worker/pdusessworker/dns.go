@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pdusessworker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/omec-project/gnbsim/common"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// SendDnsQuery sends the next DNS query to the resolver. Queries are sent one
+// at a time, cycling through the names for each of the record types
+func SendDnsQuery(pduSess *realuectx.PduSession) (err error) {
+	index := pduSess.TxDataPktCount
+	name := pduSess.DnsNames[index%len(pduSess.DnsNames)]
+	rrType := pduSess.DnsTypes[(index/len(pduSess.DnsNames))%len(pduSess.DnsTypes)]
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qName, err := dnsmessage.NewName(name)
+	if err != nil {
+		return fmt.Errorf("invalid dns name:%v", err)
+	}
+
+	seq := pduSess.GetNextSeqNum()
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:               uint16(seq),
+		RecursionDesired: true,
+	})
+	builder.EnableCompression()
+	err = builder.StartQuestions()
+	if err == nil {
+		err = builder.Question(dnsmessage.Question{
+			Name:  qName,
+			Type:  dnsmessage.Type(rrType),
+			Class: dnsmessage.ClassINET,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to build dns query:%v", err)
+	}
+	query, err := builder.Finish()
+	if err != nil {
+		return fmt.Errorf("failed to build dns query:%v", err)
+	}
+
+	payload, err := buildUdpPacket(pduSess, query)
+	if err != nil {
+		return err
+	}
+	pduSess.DnsQueryName = name
+	pduSess.DnsQueryType = rrType
+
+	userDataMsg := &common.UserDataMessage{}
+	userDataMsg.Event = common.UL_UE_DATA_TRANSFER_EVENT
+	userDataMsg.Payload = payload
+	pduSess.WriteGnbChan <- userDataMsg
+	pduSess.TxDataPktCount++
+	pduSess.RecordEchoRequest(seq, len(payload))
+
+	pduSess.Log.Traceln("Sent DNS query, name:", name, "type:",
+		dnsmessage.Type(rrType), "id:", uint16(seq))
+	return nil
+}
+
+// HandleDnsResponse validates the response to the outstanding DNS query,
+// which must succeed and answer at least one record of the queried type
+func HandleDnsResponse(pduSess *realuectx.PduSession, udp []byte) error {
+	if len(udp) < UDP_HEADER_LEN {
+		return fmt.Errorf("udp datagram too short")
+	}
+	if binary.BigEndian.Uint16(udp[0:]) != pduSess.DstPort {
+		pduSess.Log.Traceln("Ignoring UDP packet not from the resolver")
+		return nil
+	}
+
+	var parser dnsmessage.Parser
+	hdr, err := parser.Start(udp[UDP_HEADER_LEN:])
+	if err != nil {
+		return fmt.Errorf("failed to parse dns response:%v", err)
+	}
+	if !hdr.Response || hdr.ID != uint16(pduSess.SeqNum) {
+		pduSess.Log.Warnln("Ignoring DNS message not answering the outstanding query, id:",
+			hdr.ID)
+		return nil
+	}
+	if hdr.RCode != dnsmessage.RCodeSuccess {
+		return fmt.Errorf("dns query for %v %v failed, rcode:%v",
+			pduSess.DnsQueryName, dnsmessage.Type(pduSess.DnsQueryType), hdr.RCode)
+	}
+
+	question, err := parser.Question()
+	if err != nil {
+		return fmt.Errorf("failed to parse dns question:%v", err)
+	}
+	if !strings.EqualFold(question.Name.String(), pduSess.DnsQueryName) ||
+		uint16(question.Type) != pduSess.DnsQueryType {
+		return fmt.Errorf("dns response question mismatch, name:%v, type:%v",
+			question.Name, question.Type)
+	}
+	err = parser.SkipAllQuestions()
+	if err != nil {
+		return fmt.Errorf("failed to parse dns questions:%v", err)
+	}
+
+	answers := 0
+	for {
+		rrHdr, err := parser.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse dns answer:%v", err)
+		}
+		// CNAME records of the chain leading to the answer are skipped
+		if uint16(rrHdr.Type) == pduSess.DnsQueryType {
+			answers++
+		}
+		err = parser.SkipAnswer()
+		if err != nil {
+			return fmt.Errorf("failed to parse dns answer:%v", err)
+		}
+	}
+	if answers == 0 {
+		return fmt.Errorf("no %v record for %v in dns response",
+			dnsmessage.Type(pduSess.DnsQueryType), pduSess.DnsQueryName)
+	}
+
+	pduSess.Log.Infoln("Received DNS response, name:", pduSess.DnsQueryName,
+		"type:", dnsmessage.Type(pduSess.DnsQueryType), "answers:", answers)
+
+	pduSess.RxDataPktCount++
+	pduSess.RecordEchoReply(int(hdr.ID))
+	pduSess.DnsQueryName = ""
+	if pduSess.TxDataPktCount < pduSess.ReqDataPktCount {
+		return SendDnsQuery(pduSess)
+	}
+	msg := &common.UuMessage{}
+	msg.Event = common.DATA_PKT_GEN_SUCCESS_EVENT
+	msg.DataStats = pduSess.EndBurst()
+	pduSess.WriteUeChan <- msg
+	pduSess.Log.Traceln("Sent Data Packet Generation Success Event")
+	return nil
+}
@@ -10,7 +10,9 @@ import (
 	"net"
 
 	"github.com/omec-project/gnbsim/common"
+	profctx "github.com/omec-project/gnbsim/profile/context"
 	realuectx "github.com/omec-project/gnbsim/realue/context"
+	"github.com/omec-project/gnbsim/realue/tcp"
 	"github.com/omec-project/gnbsim/util/test"
 
 	"golang.org/x/net/icmp"
@@ -29,6 +31,14 @@ const (
 func HandleInitEvent(pduSess *realuectx.PduSession,
 	intfcMsg common.InterfaceMessage) (err error) {
 	msg := intfcMsg.(*common.UeMessage)
+
+	// On handover, the uplink of the gNB user plane context being replaced
+	// is ended so that it may terminate
+	if pduSess.WriteGnbChan != nil && pduSess.WriteGnbChan != msg.CommChan {
+		userDataMsg := &common.UserDataMessage{}
+		userDataMsg.Event = common.LAST_DATA_PKT_EVENT
+		pduSess.WriteGnbChan <- userDataMsg
+	}
 	pduSess.WriteGnbChan = msg.CommChan
 	pduSess.LastDataPktRecvd = false
 	return nil
@@ -49,7 +59,7 @@ func SendIcmpEchoRequest(pduSess *realuectx.PduSession) (err error) {
 	ipv4hdr := ipv4.Header{
 		Version:  4,
 		Len:      IPV4_MIN_HEADER_LEN,
-		Protocol: 1,
+		Protocol: IP_PROTOCOL_ICMP,
 		Flags:    0,
 		TotalLen: IPV4_MIN_HEADER_LEN + ICMP_HEADER_LEN + icmpPayloadLen,
 		TTL:      64,
@@ -66,10 +76,11 @@ func SendIcmpEchoRequest(pduSess *realuectx.PduSession) (err error) {
 		return
 	}
 
+	seq := pduSess.GetNextSeqNum()
 	icmpMsg := icmp.Message{
 		Type: ipv4.ICMPTypeEcho, Code: 0,
 		Body: &icmp.Echo{
-			ID: 12394, Seq: pduSess.GetNextSeqNum(),
+			ID: 12394, Seq: seq,
 			Data: icmpPayload,
 		},
 	}
@@ -86,6 +97,7 @@ func SendIcmpEchoRequest(pduSess *realuectx.PduSession) (err error) {
 	userDataMsg.Payload = payload
 	pduSess.WriteGnbChan <- userDataMsg
 	pduSess.TxDataPktCount++
+	pduSess.RecordEchoRequest(seq, len(payload))
 
 	pduSess.Log.Traceln("Sent UL ICMP ping message")
 
@@ -110,11 +122,13 @@ func HandleIcmpMessage(pduSess *realuectx.PduSession,
 			echpReply.ID, echpReply.Seq)
 
 		pduSess.RxDataPktCount++
+		pduSess.RecordEchoReply(echpReply.Seq)
 		if pduSess.TxDataPktCount < pduSess.ReqDataPktCount {
 			SendIcmpEchoRequest(pduSess)
 		} else {
 			msg := &common.UuMessage{}
 			msg.Event = common.DATA_PKT_GEN_SUCCESS_EVENT
+			msg.DataStats = pduSess.EndBurst()
 			pduSess.WriteUeChan <- msg
 			pduSess.Log.Traceln("Sent Data Packet Generation Success Event")
 		}
@@ -146,14 +160,30 @@ func HandleDlMessage(pduSess *realuectx.PduSession,
 	if err != nil {
 		return fmt.Errorf("failed to parse ipv4 header:%v", err)
 	}
+	pduSess.RecordDlPkt(len(dataMsg.Payload))
 
 	switch ipv4Hdr.Protocol {
-	/* Currently supporting ICMP protocol */
-	case 1:
+	case IP_PROTOCOL_ICMP:
 		err = HandleIcmpMessage(pduSess, dataMsg.Payload[ipv4Hdr.Len:])
 		if err != nil {
 			return fmt.Errorf("failed to handle icmp message:%v", err)
 		}
+	case tcp.IP_PROTOCOL_TCP:
+		err = HandleTcpSegment(pduSess, dataMsg.Payload[ipv4Hdr.Len:])
+		if err != nil {
+			return fmt.Errorf("failed to handle tcp segment:%v", err)
+		}
+	case IP_PROTOCOL_UDP:
+		if pduSess.Protocol == profctx.TRAFFIC_PROTOCOL_DNS {
+			err = HandleDnsResponse(pduSess, dataMsg.Payload[ipv4Hdr.Len:])
+			if err != nil {
+				return fmt.Errorf("failed to handle dns response:%v", err)
+			}
+			break
+		}
+		// Responses of the UDP flows, if any, are only counted
+		pduSess.RxDataPktCount++
+		pduSess.Log.Traceln("Received DL UDP packet")
 	default:
 		return fmt.Errorf("unsupported ipv4 protocol:%v", ipv4Hdr.Protocol)
 	}
@@ -165,7 +195,37 @@ func HandleDataPktGenRequestEvent(pduSess *realuectx.PduSession,
 	intfcMsg common.InterfaceMessage) (err error) {
 	cmd := intfcMsg.(*common.UeMessage)
 	pduSess.ReqDataPktCount = cmd.UserDataPktCount
+	pduSess.TxDataPktCount = 0
+	pduSess.RxDataPktCount = 0
 	pduSess.DefaultAs = cmd.DefaultAs
+	pduSess.SrcPort = cmd.SrcPort
+	pduSess.DstPort = cmd.DstPort
+	pduSess.HttpPath = cmd.HttpPath
+	pduSess.Protocol = cmd.Protocol
+	pduSess.DnsNames = cmd.DnsNames
+	pduSess.DnsTypes = cmd.DnsTypes
+	pduSess.StartBurst()
+	if cmd.Protocol == profctx.TRAFFIC_PROTOCOL_DNS {
+		err = SendDnsQuery(pduSess)
+		if err != nil {
+			return fmt.Errorf("failed to send dns query:%v", err)
+		}
+		return nil
+	}
+	if cmd.Protocol == profctx.TRAFFIC_PROTOCOL_HTTP {
+		err = StartHttpRequest(pduSess)
+		if err != nil {
+			return fmt.Errorf("failed to start http request:%v", err)
+		}
+		return nil
+	}
+	if cmd.Protocol == profctx.TRAFFIC_PROTOCOL_UDP {
+		err = SendUdpPackets(pduSess)
+		if err != nil {
+			return fmt.Errorf("failed to send udp packets:%v", err)
+		}
+		return nil
+	}
 	err = SendIcmpEchoRequest(pduSess)
 	if err != nil {
 		return fmt.Errorf("failed to send icmp echo req:%v", err)
@@ -176,6 +236,12 @@ func HandleDataPktGenRequestEvent(pduSess *realuectx.PduSession,
 func HandleConnectionReleaseRequestEvent(pduSess *realuectx.PduSession,
 	intfcMsg common.InterfaceMessage) (err error) {
 
+	// User plane may already be released, e.g. when the connection is
+	// released without the data bearers being re-established
+	if pduSess.WriteGnbChan == nil {
+		return nil
+	}
+
 	userDataMsg := &common.UserDataMessage{}
 	userDataMsg.Event = common.LAST_DATA_PKT_EVENT
 	pduSess.WriteGnbChan <- userDataMsg
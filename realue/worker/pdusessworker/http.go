@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pdusessworker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+	"github.com/omec-project/gnbsim/realue/tcp"
+)
+
+// StartHttpRequest opens the TCP connection over which the next HTTP GET
+// request is sent. Each request uses a new connection, from the next source
+// port, which is closed by the server once the response is sent
+func StartHttpRequest(pduSess *realuectx.PduSession) error {
+	dst := net.ParseIP(pduSess.DefaultAs)
+	if dst == nil || dst.To4() == nil {
+		return fmt.Errorf("invalid http server ip:%v", pduSess.DefaultAs)
+	}
+	srcPort := pduSess.SrcPort + uint16(pduSess.TxDataPktCount)
+	pduSess.TcpConn = tcp.NewConn(pduSess.PduAddress, dst, srcPort,
+		pduSess.DstPort, pduSess.Rand.Uint32())
+	pduSess.TcpConnStart = time.Now()
+	pduSess.TxDataPktCount++
+
+	syn, err := pduSess.TcpConn.Connect()
+	if err != nil {
+		return err
+	}
+	sendUlPacket(pduSess, syn)
+	pduSess.Log.Traceln("Sent TCP SYN, source port:", srcPort)
+	return nil
+}
+
+// HandleTcpSegment handles the TCP segment received over the PDU session.
+// The HTTP request is sent once the connection is established, and the
+// response is validated once the server closes the connection
+func HandleTcpSegment(pduSess *realuectx.PduSession, segment []byte) error {
+	conn := pduSess.TcpConn
+	if conn == nil || !conn.Matches(segment) {
+		// e.g. acknowledgement of the FIN of a previous connection
+		pduSess.Log.Traceln("Ignoring TCP segment not matching the connection")
+		return nil
+	}
+
+	prevState := conn.State
+	pkts, err := conn.Handle(segment)
+	if err != nil {
+		return fmt.Errorf("tcp connection failed:%v", err)
+	}
+	for _, pkt := range pkts {
+		sendUlPacket(pduSess, pkt)
+	}
+
+	switch {
+	case prevState == tcp.STATE_SYN_SENT && conn.State == tcp.STATE_ESTABLISHED:
+		pduSess.RecordRtt(time.Since(pduSess.TcpConnStart))
+		pkts, err = conn.Send(getHttpRequest(pduSess))
+		if err != nil {
+			return err
+		}
+		for _, pkt := range pkts {
+			sendUlPacket(pduSess, pkt)
+		}
+		pduSess.Log.Traceln("Sent HTTP GET request, path:", pduSess.HttpPath)
+
+	case prevState == tcp.STATE_ESTABLISHED && conn.State == tcp.STATE_LAST_ACK:
+		err = validateHttpResponse(pduSess, conn.Received)
+		if err != nil {
+			return err
+		}
+		pduSess.RxDataPktCount++
+		if pduSess.TxDataPktCount < pduSess.ReqDataPktCount {
+			return StartHttpRequest(pduSess)
+		}
+		msg := &common.UuMessage{}
+		msg.Event = common.DATA_PKT_GEN_SUCCESS_EVENT
+		msg.DataStats = pduSess.EndBurst()
+		pduSess.WriteUeChan <- msg
+		pduSess.Log.Traceln("Sent Data Packet Generation Success Event")
+	}
+	return nil
+}
+
+func getHttpRequest(pduSess *realuectx.PduSession) []byte {
+	host := pduSess.DefaultAs
+	if pduSess.DstPort != 80 {
+		host = net.JoinHostPort(host, strconv.Itoa(int(pduSess.DstPort)))
+	}
+	return []byte(fmt.Sprintf("GET %v HTTP/1.1\r\nHost: %v\r\n"+
+		"User-Agent: gnbsim\r\nConnection: close\r\n\r\n", pduSess.HttpPath, host))
+}
+
+// validateHttpResponse checks that the complete response is received with a
+// success status
+func validateHttpResponse(pduSess *realuectx.PduSession, data []byte) error {
+	rsp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to parse http response:%v", err)
+	}
+	defer rsp.Body.Close()
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return fmt.Errorf("incomplete http response body:%v", err)
+	}
+	pduSess.Log.Infoln("Received HTTP response, status:", rsp.Status,
+		"body length:", len(body))
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return fmt.Errorf("http request failed, status:%v", rsp.Status)
+	}
+	return nil
+}
+
+func sendUlPacket(pduSess *realuectx.PduSession, pkt []byte) {
+	userDataMsg := &common.UserDataMessage{}
+	userDataMsg.Event = common.UL_UE_DATA_TRANSFER_EVENT
+	userDataMsg.Payload = pkt
+	pduSess.WriteGnbChan <- userDataMsg
+	pduSess.RecordUlPkt(len(pkt))
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pdusessworker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/omec-project/gnbsim/common"
+	realuectx "github.com/omec-project/gnbsim/realue/context"
+	"github.com/omec-project/gnbsim/util/test"
+
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	UDP_HEADER_LEN  int = 8
+	UDP_PAYLOAD_LEN int = 56
+
+	IP_PROTOCOL_ICMP int = 1
+	IP_PROTOCOL_UDP  int = 17
+)
+
+// SendUdpPackets sends the requested number of uplink UDP packets of the
+// configured flow. No response is expected, hence the packets are sent back
+// to back and the generation completes once these are sent
+func SendUdpPackets(pduSess *realuectx.PduSession) (err error) {
+	for pduSess.TxDataPktCount < pduSess.ReqDataPktCount {
+		err = SendUdpPacket(pduSess)
+		if err != nil {
+			return err
+		}
+	}
+
+	msg := &common.UuMessage{}
+	msg.Event = common.DATA_PKT_GEN_SUCCESS_EVENT
+	msg.DataStats = pduSess.EndBurst()
+	pduSess.WriteUeChan <- msg
+	pduSess.Log.Traceln("Sent Data Packet Generation Success Event")
+	return nil
+}
+
+// SendUdpPacket sends an uplink UDP packet, carrying the sequence number of
+// the packet in the payload
+func SendUdpPacket(pduSess *realuectx.PduSession) (err error) {
+	data := make([]byte, UDP_PAYLOAD_LEN)
+	binary.BigEndian.PutUint32(data, uint32(pduSess.GetNextSeqNum()))
+	payload, err := buildUdpPacket(pduSess, data)
+	if err != nil {
+		return err
+	}
+
+	userDataMsg := &common.UserDataMessage{}
+	userDataMsg.Event = common.UL_UE_DATA_TRANSFER_EVENT
+	userDataMsg.Payload = payload
+	pduSess.WriteGnbChan <- userDataMsg
+	pduSess.TxDataPktCount++
+	pduSess.RecordUlPkt(len(payload))
+
+	pduSess.Log.Traceln("Sent UL UDP packet, source port:", pduSess.SrcPort,
+		"destination port:", pduSess.DstPort)
+	return nil
+}
+
+// buildUdpPacket returns the IPv4 packet carrying the data in a UDP datagram
+// of the configured flow
+func buildUdpPacket(pduSess *realuectx.PduSession, data []byte) ([]byte, error) {
+	dst := net.ParseIP(pduSess.DefaultAs).To4()
+	udpLen := UDP_HEADER_LEN + len(data)
+
+	ipv4hdr := ipv4.Header{
+		Version:  4,
+		Len:      IPV4_MIN_HEADER_LEN,
+		Protocol: IP_PROTOCOL_UDP,
+		TotalLen: IPV4_MIN_HEADER_LEN + udpLen,
+		TTL:      64,
+		Src:      pduSess.PduAddress,
+		Dst:      dst,
+		ID:       1,
+	}
+	ipv4hdr.Checksum = int(test.CalculateIpv4HeaderChecksum(&ipv4hdr))
+	v4HdrBuf, err := ipv4hdr.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("ipv4hdr header marshal failed:%v", err)
+	}
+
+	payload := make([]byte, IPV4_MIN_HEADER_LEN+udpLen)
+	copy(payload, v4HdrBuf)
+	udp := payload[IPV4_MIN_HEADER_LEN:]
+	binary.BigEndian.PutUint16(udp[0:], pduSess.SrcPort)
+	binary.BigEndian.PutUint16(udp[2:], pduSess.DstPort)
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpLen))
+	copy(udp[UDP_HEADER_LEN:], data)
+	binary.BigEndian.PutUint16(udp[6:], getUdpChecksum(pduSess.PduAddress, dst, udp))
+	return payload, nil
+}
+
+// getUdpChecksum returns the checksum of the UDP datagram, computed over the
+// IPv4 pseudo header and the datagram, RFC 768
+func getUdpChecksum(src, dst net.IP, udp []byte) uint16 {
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(b[i])<<8 | uint32(b[i+1])
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	add(src.To4())
+	add(dst.To4())
+	sum += uint32(IP_PROTOCOL_UDP) + uint32(len(udp))
+	add(udp)
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	checksum := ^uint16(sum)
+	if checksum == 0 {
+		// Zero indicates that the checksum is not computed
+		checksum = 0xffff
+	}
+	return checksum
+}
@@ -0,0 +1,327 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/factory"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/profile"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	"github.com/omec-project/gnbsim/profile/util"
+	"github.com/omec-project/gnbsim/simue"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+	"github.com/omec-project/gnbsim/util/test"
+)
+
+const PROMPT string = "gnbsim> "
+
+// Time within which the UE must report its state
+const UE_STATE_QUERY_TIMEOUT time.Duration = 5 * time.Second
+
+// Shell lets a tester create a UE and step through the procedures one command
+// at a time, inspect the UE context and inject faults
+type Shell struct {
+	// Profile used as a template for the UE configuration
+	template *profctx.Profile
+
+	// Profile and SimUe corresponding to the UE being driven by the shell
+	profile *profctx.Profile
+	simUe   *simuectx.SimUe
+	gnb     *gnbctx.GNodeB
+
+	out io.Writer
+}
+
+type command struct {
+	usage   string
+	help    string
+	handler func(sh *Shell, args []string) error
+}
+
+var commands map[string]*command
+
+// procedures that can be directly executed through shell commands
+var procCommands = map[string]common.ProcedureType{
+	"register":   common.REGISTRATION_PROCEDURE,
+	"pdu":        common.PDU_SESSION_ESTABLISHMENT_PROCEDURE,
+	"data":       common.USER_DATA_PKT_GENERATION_PROCEDURE,
+	"service":    common.UE_TRIGGERED_SERVICE_REQUEST_PROCEDURE,
+	"inactive":   common.RRC_INACTIVE_TRANSITION_PROCEDURE,
+	"resume":     common.RRC_RESUME_PROCEDURE,
+	"pdurelease": common.UE_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE,
+	"dereg":      common.UE_INITIATED_DEREGISTRATION_PROCEDURE,
+}
+
+func init() {
+	commands = map[string]*command{
+		"create": {"create [imsi]", "Create a UE, defaults to the start imsi of the profile", handleCreate},
+		"release": {"release [ngap cause]",
+			"Trigger AN release through UE Context Release Request", handleRelease},
+		"fault": {"fault icsfailure [ngap cause]",
+			"Trigger Service Request and fail the Initial Context Setup", handleFault},
+		"show": {"show", "Display the UE context", handleShow},
+		"help": {"help", "Display this help", handleHelp},
+		"quit": {"quit", "Terminate the UE and exit the shell", nil},
+	}
+	for name, proc := range procCommands {
+		commands[name] = &command{name, "Execute " + proc.String(), handleProcedure}
+	}
+}
+
+// NewShell returns a shell which uses the provided profile as template for the
+// configuration of the UE
+func NewShell(template *profctx.Profile, out io.Writer) (*Shell, error) {
+	if template == nil {
+		return nil, fmt.Errorf("no profile available to be used as template")
+	}
+
+	gnb, err := factory.AppConfig.Configuration.GetGNodeB(template.GnbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch gNB context: %v", err)
+	}
+
+	sh := &Shell{
+		template: template,
+		gnb:      gnb,
+		out:      out,
+	}
+	return sh, nil
+}
+
+// Run reads and executes the commands until the input is exhausted or the quit
+// command is received
+func (sh *Shell) Run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprint(sh.out, PROMPT)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 0 {
+			cmd, ok := commands[fields[0]]
+			if !ok {
+				fmt.Fprintln(sh.out, "Unknown command:", fields[0],
+					", type 'help' to list the supported commands")
+			} else if cmd.handler == nil {
+				break
+			} else if err := cmd.handler(sh, fields); err != nil {
+				fmt.Fprintln(sh.out, "Error:", err)
+			}
+		}
+		fmt.Fprint(sh.out, PROMPT)
+	}
+	sh.terminateUe()
+}
+
+func handleCreate(sh *Shell, args []string) error {
+	if sh.simUe != nil {
+		return fmt.Errorf("ue %v already exists", sh.simUe.Supi)
+	}
+
+	imsi := sh.template.StartImsi
+	if len(sh.template.Imsis) != 0 {
+		imsis, err := sh.template.GetImsis()
+		if err != nil {
+			return err
+		}
+		imsi = imsis[0]
+	}
+	if len(args) > 1 {
+		imsi = args[1]
+	}
+	if _, err := strconv.Atoi(imsi); err != nil {
+		return fmt.Errorf("invalid imsi value:%v", imsi)
+	}
+
+	// Each UE gets a fresh copy of the profile so that the messages from a
+	// previously terminated UE do not interfere
+	p := *sh.template
+	p.ProfileType = profile.INTERACTIVE
+	p.Name = "shell"
+	p.Enable = true
+	p.RrcInactiveDuration = 0
+	p.Init()
+	if err := profile.InitProfile(&p); err != nil {
+		return err
+	}
+	if p.PerUserTimeout == 0 {
+		p.PerUserTimeout = profctx.PER_USER_TIMEOUT
+	}
+	if p.DataPktCount == 0 {
+		p.DataPktCount = 1
+	}
+
+	sh.profile = &p
+	sh.simUe = simuectx.NewSimUe("imsi-"+imsi, sh.gnb, sh.profile)
+	sh.simUe.Tac = sh.profile.GetTac(0)
+	sh.simUe.RealUe.Imeisv = sh.profile.GetImeisv(0, imsi)
+	go simue.Init(sh.simUe)
+
+	fmt.Fprintln(sh.out, "Created UE:", sh.simUe.Supi)
+	return nil
+}
+
+func handleProcedure(sh *Shell, args []string) error {
+	return sh.executeProcedure(procCommands[args[0]])
+}
+
+func handleRelease(sh *Shell, args []string) error {
+	if sh.simUe == nil {
+		return fmt.Errorf("no ue, use 'create' first")
+	}
+
+	sh.profile.UeCtxRelReqCause = ""
+	if len(args) > 1 {
+		if _, err := test.GetNgapCause(args[1]); err != nil {
+			return err
+		}
+		sh.profile.UeCtxRelReqCause = args[1]
+	}
+	return sh.executeProcedure(common.AN_RELEASE_PROCEDURE)
+}
+
+func handleFault(sh *Shell, args []string) error {
+	if sh.simUe == nil {
+		return fmt.Errorf("no ue, use 'create' first")
+	}
+	if len(args) < 2 || args[1] != "icsfailure" {
+		return fmt.Errorf("usage: %v", commands["fault"].usage)
+	}
+
+	sh.profile.IcsFailureCause = ""
+	if len(args) > 2 {
+		if _, err := test.GetNgapCause(args[2]); err != nil {
+			return err
+		}
+		sh.profile.IcsFailureCause = args[2]
+	}
+	return sh.executeProcedure(common.INITIAL_CTX_SETUP_FAILURE_PROCEDURE)
+}
+
+func handleShow(sh *Shell, args []string) error {
+	if sh.simUe == nil {
+		return fmt.Errorf("no ue, use 'create' first")
+	}
+
+	// Network initiated procedures may modify the context while the UE waits
+	// for the next command, hence it is read by the UE routines
+	state, err := sh.queryUeState()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(sh.out, "SUPI:", sh.simUe.Supi)
+	if state.Procedure != 0 {
+		fmt.Fprintln(sh.out, "Last Procedure:", state.Procedure)
+	}
+	fmt.Fprintln(sh.out, "GUTI:", state.Guti)
+	fmt.Fprintln(sh.out, "ngKSI:", state.NgKsi)
+	fmt.Fprintln(sh.out, "Security Context Available:", state.SecurityCtxAvailable)
+	fmt.Fprintln(sh.out, "UL Count:", state.UlCount, ", DL Count:", state.DlCount)
+	fmt.Fprintln(sh.out, "CM Idle:", state.CmIdle)
+	fmt.Fprintln(sh.out, "MICO Granted:", state.MicoGranted, ", T3512:", state.T3512, "seconds")
+	for _, pduSess := range state.PduSessions {
+		fmt.Fprintf(sh.out, "PDU Session ID: %v, Address: %v, DNN: %v, SSC Mode: %v\n",
+			pduSess.PduSessId, pduSess.PduAddress, pduSess.Dnn, pduSess.SscMode)
+		fmt.Fprintf(sh.out, "  Session AMBR, Uplink: %v Kbps, Downlink: %v Kbps\n",
+			pduSess.UlAmbr, pduSess.DlAmbr)
+	}
+	return nil
+}
+
+// queryUeState fetches a snapshot of the state of the UE from the SimUe and
+// RealUe routines
+func (sh *Shell) queryUeState() (*common.UeState, error) {
+	msg := &common.UeStateMessage{
+		State: &common.UeState{},
+		Done:  make(chan struct{}),
+	}
+	msg.Event = common.UE_STATE_QUERY_EVENT
+
+	timer := time.NewTimer(UE_STATE_QUERY_TIMEOUT)
+	defer timer.Stop()
+	select {
+	case sh.simUe.ReadChan <- msg:
+	case <-timer.C:
+		return nil, fmt.Errorf("ue is not responding")
+	}
+	select {
+	case <-msg.Done:
+		return msg.State, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("ue is not responding")
+	}
+}
+
+func handleHelp(sh *Shell, args []string) error {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(sh.out, "  %-35v %v\n", commands[name].usage, commands[name].help)
+	}
+	fmt.Fprintln(sh.out, "  Supported ngap causes:", strings.Join(test.GetNgapCauseNames(), ", "))
+	return nil
+}
+
+// executeProcedure directs the SimUe to execute the provided procedure and
+// waits for the result
+func (sh *Shell) executeProcedure(proc common.ProcedureType) error {
+	if sh.simUe == nil {
+		return fmt.Errorf("no ue, use 'create' first")
+	}
+
+	msg := &common.ProfileMessage{}
+	msg.Event = common.EXECUTE_PROCEDURE_EVENT
+	msg.Proc = proc
+	sh.simUe.ReadChan <- msg
+
+	timeout := time.Duration(sh.profile.PerUserTimeout) * time.Second
+	select {
+	case <-time.After(timeout):
+		sh.terminateUe()
+		return fmt.Errorf("procedure:%v timed out, ue terminated", proc)
+	case result := <-sh.profile.ReadChan:
+		if result.Event == common.PROFILE_FAIL_EVENT {
+			sh.abandonUe()
+			return fmt.Errorf("procedure:%v failed, ue terminated, error:%v",
+				result.Proc, result.Error)
+		}
+	}
+
+	fmt.Fprintln(sh.out, "Procedure complete:", proc)
+	if proc == common.UE_INITIATED_DEREGISTRATION_PROCEDURE {
+		// SimUe terminates itself once deregistered
+		sh.abandonUe()
+	}
+	return nil
+}
+
+func (sh *Shell) terminateUe() {
+	if sh.simUe == nil {
+		return
+	}
+	util.SendToSimUe(sh.simUe, common.QUIT_EVENT)
+	sh.abandonUe()
+}
+
+// abandonUe releases the references to a terminated UE. Any message still
+// sent by it to the profile routine is drained so that it does not block
+func (sh *Shell) abandonUe() {
+	go func(ch chan *common.ProfileMessage) {
+		for range ch {
+		}
+	}(sh.profile.ReadChan)
+	sh.simUe = nil
+	sh.profile = nil
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// isAbortedByDereg initiates the UE originated deregistration instead of
+// handling the event, when configured in the profile. It returns true if the
+// event is not to be handled further. The profile is complete for the UE once
+// the network releases the connection
+func isAbortedByDereg(ue *simuectx.SimUe, event common.EventType) bool {
+	if ue.DeregOnEvent == 0 || event != ue.DeregOnEvent ||
+		ue.Procedure == common.UE_INITIATED_DEREGISTRATION_PROCEDURE ||
+		ue.ReAuthenticating ||
+		(event == common.AUTH_REQUEST_EVENT && isReAuthentication(ue)) {
+		return false
+	}
+
+	ue.Log.Infoln("Aborting", ue.Procedure, "with Deregistration Request on",
+		event, "as configured")
+	ue.Procedure = common.UE_INITIATED_DEREGISTRATION_PROCEDURE
+	ue.Log.Infoln("Updated procedure to", ue.Procedure)
+	HandleProcedure(ue)
+	return true
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// checkCallFlow records the call flow of the UE passing the profile, or
+// verifies it against the recorded one. The call flow is taken from the
+// timeline of the UE when it passes the profile, messages exchanged after it
+// are not part of it
+func checkCallFlow(ue *simuectx.SimUe) error {
+	config := ue.ProfileCtx.CallFlow
+	if config == nil || ue.RealUe.Timeline == nil {
+		return nil
+	}
+	entries, dropped := ue.RealUe.Timeline.GetEntries()
+	if dropped != 0 {
+		return fmt.Errorf("call flow incomplete, %v messages dropped from the timeline",
+			dropped)
+	}
+	flow := common.NewCallFlow(ue.ProfileCtx.Name, ue.Supi, entries)
+
+	if expected := config.GetExpected(); expected != nil {
+		return flow.Compare(expected)
+	}
+
+	if config.ClaimRecord() {
+		err := common.WriteCallFlow(config.Record, flow)
+		if err != nil {
+			config.ReleaseRecord()
+			return fmt.Errorf("failed to record call flow:%v", err)
+		}
+		ue.Log.Infof("Recorded call flow of %v messages in %v", len(flow.Messages),
+			config.Record)
+	}
+	return nil
+}
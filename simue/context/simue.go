@@ -5,7 +5,10 @@
 package context
 
 import (
+	"math/rand"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/omec-project/gnbsim/common"
 	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
@@ -14,7 +17,9 @@ import (
 	realuectx "github.com/omec-project/gnbsim/realue/context"
 
 	"github.com/omec-project/nas/security"
+	"github.com/omec-project/openapi/models"
 	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
 )
 
 // SimUe controls the flow of messages between RealUe and GnbUe as per the test
@@ -40,6 +45,135 @@ type SimUe struct {
 	// Entities can be RealUe, GnbUe etc.
 	ReadChan chan common.InterfaceMessage
 
+	// TAC of the TA in which the UE camps
+	Tac string
+
+	// NR Cell Identity of the cell in which the UE camps, the gNB selects
+	// the cell as per the TAC when not set
+	NrCellId string
+
+	// Flow of the uplink user data generated by the UE, the UE pings
+	// defaultAs when not set
+	TrafficFlow *profctx.TrafficFlow
+
+	// Index of the next mobility step of the profile and the timer for its
+	// delay. Re-registration is pending while the UE releases the connection
+	// before moving to the target cell
+	NextMobilityStep     int
+	MobilityTimer        *time.Timer
+	MobilityReRegPending bool
+
+	// Time at which the ongoing procedure started, and the index of the
+	// ongoing step of the scenario profile type
+	ProcedureStart time.Time
+	ScenarioStep   int
+
+	// Time taken by each of the procedures completed by the UE
+	StageTimes []common.StageTime
+
+	// Source of the random values drawn by the UE, derived from the seed of
+	// the run and the SUPI
+	Rand *rand.Rand
+
+	// Set once the UE has completed the registration with the network
+	Registered bool
+
+	// Time at which the PDU session held by the session hold procedure is to
+	// be released, and the timer for the think time between traffic bursts
+	SessionHoldEnd time.Time
+	ThinkTimer     *time.Timer
+
+	// Time until which the PDU Session Establishment is not reattempted, as
+	// directed by the back-off timer of PDU Session Establishment Reject
+	PduSessEstBackoffEnd time.Time
+
+	// Time until which the registration is not reattempted, as directed by
+	// the T3346 or T3502 value of Registration Reject. Set once the rejected
+	// registration is reattempted, until the UE registers
+	RegBackoffEnd time.Time
+	RegRetried    bool
+
+	// NAS timer of the UE currently running (T3510, T3511 or T3521) and its
+	// generation, which tells apart the expiries of the stopped timers
+	NasTimer     *time.Timer
+	NasTimerName string
+	NasTimerGen  uint
+
+	// Registration attempt counter and the count of the Deregistration
+	// Request transmissions, along with the request retransmitted on the
+	// expiry of the NAS timers
+	RegAttempts   int
+	DeregAttempts int
+	PendingNasMsg *common.UuMessage
+
+	// Timer for the backoff before the failed procedure is retried, the
+	// retries of the ongoing procedure and the count of all the retries made
+	// by the UE
+	RetryTimer  *time.Timer
+	ProcRetries int
+	Retries     uint
+
+	// Timer for the wait before the next procedure is started
+	StepDelayTimer *time.Timer
+
+	// T3502 value in seconds provided by the network, 0 if not provided
+	NwT3502 uint32
+
+	// Progress of the SMS procedure, the mobile originated SMS is acknowledged
+	// and the count of the mobile terminated SMSs received
+	MoSmsComplete bool
+	MtSmsReceived int
+
+	// User plane KPIs of the user data generated while executing the profile
+	DataStats common.DataPlaneStats
+
+	// Count of the PDU sessions modified and released by the network outside
+	// of the procedures of the profile, e.g. initiated by the SMF
+	NwPduSessMods uint
+	NwPduSessRels uint
+
+	// Count of the network slice-specific authentication results received
+	NssaaResults int
+
+	// LADN service area of each LADN DNN, as provided by the network in the
+	// last Registration Accept or Configuration Update Command
+	LadnInfo map[string][]models.Tai
+
+	// Event on which the UE aborts the ongoing registration with a
+	// Deregistration Request, 0 if not configured
+	DeregOnEvent common.EventType
+
+	// Set when the ongoing procedure is drawn to fail on the next NAS
+	// message from the network, and once the radio link is lost until the
+	// gNB releases the connection
+	RadioLossPending bool
+	RadioLinkLost    bool
+
+	// Lua state running the event hook script of the profile for the UE,
+	// created on the first event hooked and closed once the UE terminates
+	HookState *lua.LState
+
+	// Set while the network re-authenticates the registered UE, the ongoing
+	// procedure is paused until the Security Mode Command taking the new key
+	// set into use is completed. ReAuthCount is the count of the completed
+	// re-authentications
+	ReAuthenticating bool
+	ReAuthCount      int
+
+	// Set once the PDU session to the IMS DNN is requested during the
+	// ongoing PDU session establishment procedure
+	ImsPduSessRequested bool
+
+	// 5G-S-TMSI with which the UE listens for the paging during the network
+	// triggered service request, and the time since the UE entered CM-IDLE
+	// state at which each paging attempt is received
+	PagingTmsi  *gnbctx.FiveGSTmsi
+	PagingTimes []time.Duration
+
+	// Set when the application is shutting down. The UE is only expected to
+	// clean up its state in the network
+	ShuttingDown bool
+
 	/* logger */
 	Log *logrus.Entry
 }
@@ -49,15 +183,130 @@ func NewSimUe(supi string, gnb *gnbctx.GNodeB, profile *profctx.Profile) *SimUe
 	simue.GnB = gnb
 	simue.Supi = supi
 	simue.ProfileCtx = profile
+	simue.Rand = common.NewRand(supi)
 	simue.ReadChan = make(chan common.InterfaceMessage, 5)
+	integrityAlg := security.AlgIntegrity128NIA2
+	if profile.NullSecurity {
+		integrityAlg = security.AlgIntegrity128NIA0
+	}
+	key, opc, seqNum := profile.Key, profile.Opc, profile.SeqNum
+	if subscriber := profile.GetSubscriber(strings.TrimPrefix(supi, "imsi-")); subscriber != nil {
+		key, opc, seqNum = subscriber.Key, subscriber.Opc, subscriber.SeqNum
+	}
 	simue.RealUe = realuectx.NewRealUe(supi,
-		security.AlgCiphering128NEA0, security.AlgIntegrity128NIA2,
-		simue.ReadChan, profile.Plmn, profile.Key, profile.Opc, profile.SeqNum, profile.Dnn, profile.SNssai)
+		security.AlgCiphering128NEA0, integrityAlg,
+		simue.ReadChan, profile.Plmn, key, opc, seqNum, profile.Dnn, profile.SNssai)
+	// Logs of the UE follow the log level of the profile, if set
+	logs := logger.GetProfileLogs(profile.Name)
+	simue.RealUe.Log = logs.RealUe.WithField(logger.FieldSupi, supi)
+	// Profile is validated before the UEs are created
+	simue.RealUe.ExpectedUeIpSubnet, _ = profile.GetExpectedUeIpSubnet()
+	simue.RealUe.ExpectedUlAmbr, simue.RealUe.ExpectedDlAmbr, _ = profile.GetExpectedSessionAmbr()
+	simue.RealUe.ServingPlmn = profile.GetServingPlmn()
+	simue.RealUe.NasRelease = profile.NasRelease
+	simue.RealUe.Capability5GMM, _ = profile.GetCapability5GMM()
+	simue.RealUe.S1Mode = profile.S1Mode
+	simue.RealUe.ConfiguredRegType, _ = profile.GetRegistrationType()
+	simue.RealUe.MicoRequested = profile.MicoMode
+	simue.RealUe.FollowOnRequest = profile.FollowOnRequest == nil || *profile.FollowOnRequest
+	simue.RealUe.ExpectedMicoGranted = profile.ExpectedMicoGranted
+	simue.RealUe.ExpectedT3512 = profile.ExpectedT3512
+	simue.RealUe.GoldenIes = profile.Golden
+	simue.RealUe.LogNasPayloads = profile.LogNasPayloads
+	if profile.NasPadding != nil {
+		simue.RealUe.RegRequestSize = profile.NasPadding.RegistrationRequestSize
+		simue.RealUe.PduSessEstRequestSize = profile.NasPadding.PduSessEstRequestSize
+	}
+	if profile.Timeline != nil {
+		simue.RealUe.Timeline = common.NewTimeline(profile.Timeline.GetMaxEntries())
+	} else if profile.CallFlow != nil {
+		// Entire call flow is retained
+		simue.RealUe.Timeline = common.NewTimeline(0)
+	}
+	if profile.Sms != nil {
+		simue.RealUe.SmsRequested = true
+		simue.RealUe.Smsc = profile.Sms.Smsc
+		simue.RealUe.SmsDestination = profile.Sms.Destination
+		simue.RealUe.SmsText = profile.Sms.Text
+	}
+	if profile.Pco != nil {
+		simue.RealUe.PcoRequestIds, _ = profile.Pco.GetRequestIds()
+		simue.RealUe.ExpectedDnsServers, _ = profile.Pco.GetExpectedDnsServers()
+		simue.RealUe.ExpectedPcscfServers, _ = profile.Pco.GetExpectedPcscfServers()
+		simue.RealUe.ExpectedMtu = profile.Pco.ExpectedMtu
+	}
+	if profile.Ims != nil {
+		simue.RealUe.UsageSetting, _ = profile.Ims.GetUsageSetting()
+		simue.RealUe.ImsDnn = profile.Ims.Dnn
+		simue.RealUe.ExpectPcscf = profile.Ims.ExpectPcscf
+	}
+	if profile.Ciot != nil {
+		simue.RealUe.Ciot = &realuectx.CiotCapability{
+			ControlPlane:      profile.Ciot.ControlPlane,
+			HeaderCompression: profile.Ciot.HeaderCompression,
+			N3Data:            profile.Ciot.N3Data,
+			RestrictEc:        profile.Ciot.RestrictEc,
+			DataOverNas:       profile.Ciot.DataOverNas,
+		}
+	}
+	for _, slice := range profile.Nssaa {
+		simue.RealUe.NssaaCredentials = append(simue.RealUe.NssaaCredentials,
+			&realuectx.NssaaCredentials{
+				SNssai:        *slice.SNssai,
+				Identity:      slice.Identity,
+				Password:      slice.Password,
+				ExpectFailure: slice.ExpectFailure,
+			})
+	}
+	simue.RealUe.UplinkDataPduSessions = profile.UplinkDataPduSessions
+	if profile.Abnormal != nil {
+		simue.RealUe.SecModRejectCause, _ = profile.Abnormal.GetSecModRejectCause()
+		simue.DeregOnEvent, _ = profile.Abnormal.GetDeregOnEvent()
+	}
+	if profile.SqnStore != "" {
+		if sqn, ok := realuectx.LoadSqn(profile.SqnStore, supi); ok {
+			simue.RealUe.SeqNum = sqn
+		}
+		simue.RealUe.SqnStore = profile.SqnStore
+	}
+	if profile.SecurityCtxStore != "" {
+		restored, err := simue.RealUe.RestoreSecurityCtx(profile.SecurityCtxStore)
+		if err != nil {
+			simue.RealUe.Log.Warnln("RestoreSecurityCtx returned:", err)
+		} else if restored {
+			simue.RealUe.Log.Infoln("Restored security context, GUTI:", simue.RealUe.Guti)
+		}
+		simue.RealUe.SecurityCtxStore = profile.SecurityCtxStore
+	}
 	simue.WriteRealUeChan = simue.RealUe.ReadChan
 	simue.WriteProfileChan = profile.ReadChan
+	simue.DataStats = common.DataPlaneStats{}
 
-	simue.Log = logger.SimUeLog.WithField(logger.FieldSupi, supi)
+	simue.Log = logs.SimUe.WithField(logger.FieldSupi, supi)
 
 	simue.Log.Traceln("Created new SimUe context")
 	return &simue
 }
+
+// CloseHookState closes the Lua state of the event hook, if created
+func (simue *SimUe) CloseHookState() {
+	if simue.HookState != nil {
+		simue.HookState.Close()
+		simue.HookState = nil
+	}
+}
+
+// AttachProfile hands over a SimUe acquired from a UE pool to another profile.
+// The UE retains its identity, its state in the network and the configuration
+// of the profile which created it. It is expected to be called while the UE
+// is idle, before the profile start event is sent to it
+func (simue *SimUe) AttachProfile(profile *profctx.Profile) {
+	// Event hook script of the previous profile is not run for this profile
+	simue.CloseHookState()
+	simue.ProfileCtx = profile
+	simue.WriteProfileChan = profile.ReadChan
+	logs := logger.GetProfileLogs(profile.Name)
+	simue.Log = logs.SimUe.WithField(logger.FieldSupi, simue.Supi)
+	simue.RealUe.Log = logs.RealUe.WithField(logger.FieldSupi, simue.Supi)
+	simue.Log.Infoln("Attached to profile:", profile.Name)
+}
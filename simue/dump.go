@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/omec-project/gnbsim/factory"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// StateDump is the live state of all the active SimUes and the gNBs,
+// serialized to JSON for debugging stuck runs. The state is read while the
+// UEs execute, hence it is a best effort snapshot. The PDU sessions of a UE,
+// along with their TEIDs, are part of the UE context of the serving gNB
+type StateDump struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Gnbs      []*gnbctx.GnbDump `json:"gnbs"`
+	Ues       []*SimUeDump      `json:"ues"`
+}
+
+// SimUeDump is the state of a SimUe and its RealUe
+type SimUeDump struct {
+	Supi             string     `json:"supi"`
+	Profile          string     `json:"profile"`
+	Gnb              string     `json:"gnb"`
+	Procedure        string     `json:"procedure,omitempty"`
+	ProcedureStarted *time.Time `json:"procedureStarted,omitempty"`
+	Registered       bool       `json:"registered"`
+	CmIdle           bool       `json:"cmIdle"`
+	Tac              string     `json:"tac,omitempty"`
+	NrCellId         string     `json:"nrCellId,omitempty"`
+	Guti             string     `json:"guti,omitempty"`
+
+	Security SecurityDump `json:"security"`
+	Timers   TimersDump   `json:"timers"`
+}
+
+// SecurityDump summarizes the NAS security context of the UE, the keys are
+// not included
+type SecurityDump struct {
+	Available    bool   `json:"available"`
+	NgKsi        int32  `json:"ngKsi"`
+	CipheringAlg uint8  `json:"cipheringAlg"`
+	IntegrityAlg uint8  `json:"integrityAlg"`
+	UlCount      uint32 `json:"ulCount"`
+	DlCount      uint32 `json:"dlCount"`
+}
+
+// TimersDump holds the timers of the UE, only the running ones are included
+type TimersDump struct {
+	T3512                uint32     `json:"t3512,omitempty"`
+	ThinkTimer           bool       `json:"thinkTimer,omitempty"`
+	MobilityTimer        bool       `json:"mobilityTimer,omitempty"`
+	NasTimer             string     `json:"nasTimer,omitempty"`
+	StepDelayTimer       bool       `json:"stepDelayTimer,omitempty"`
+	SessionHoldEnd       *time.Time `json:"sessionHoldEnd,omitempty"`
+	RegBackoffEnd        *time.Time `json:"regBackoffEnd,omitempty"`
+	PduSessEstBackoffEnd *time.Time `json:"pduSessEstBackoffEnd,omitempty"`
+}
+
+// GetStateDump returns the state of the active SimUes, ordered by SUPI, and of
+// the configured gNBs
+func GetStateDump() *StateDump {
+	dump := &StateDump{
+		Timestamp: time.Now(),
+		Gnbs:      []*gnbctx.GnbDump{},
+		Ues:       []*SimUeDump{},
+	}
+
+	for _, gnb := range factory.AppConfig.Configuration.Gnbs {
+		dump.Gnbs = append(dump.Gnbs, gnb.GetDump())
+	}
+	sort.Slice(dump.Gnbs, func(i, j int) bool {
+		return dump.Gnbs[i].Name < dump.Gnbs[j].Name
+	})
+
+	activeSimUes.Lock()
+	for simUe := range activeSimUes.ues {
+		dump.Ues = append(dump.Ues, getSimUeDump(simUe))
+	}
+	activeSimUes.Unlock()
+	sort.Slice(dump.Ues, func(i, j int) bool {
+		return dump.Ues[i].Supi < dump.Ues[j].Supi
+	})
+	return dump
+}
+
+// WriteStateDump writes the state dump as JSON to a file in the provided
+// directory, and returns the path of the file
+func WriteStateDump(dir string) (string, error) {
+	dump := GetStateDump()
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode state dump:%v", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("gnbsim-dump-%v.json",
+		dump.Timestamp.Format("20060102-150405.000")))
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write state dump:%v", err)
+	}
+	return path, nil
+}
+
+func getSimUeDump(ue *simuectx.SimUe) *SimUeDump {
+	dump := &SimUeDump{
+		Supi:       ue.Supi,
+		Profile:    ue.ProfileCtx.Name,
+		Registered: ue.Registered,
+		Tac:        ue.Tac,
+		NrCellId:   ue.NrCellId,
+	}
+	if ue.GnB != nil {
+		dump.Gnb = ue.GnB.GnbName
+	}
+	if ue.Procedure != 0 {
+		dump.Procedure = ue.Procedure.String()
+		dump.ProcedureStarted = getTimeDump(ue.ProcedureStart)
+	}
+
+	dump.Timers.ThinkTimer = ue.ThinkTimer != nil
+	dump.Timers.MobilityTimer = ue.MobilityTimer != nil
+	dump.Timers.NasTimer = ue.NasTimerName
+	dump.Timers.StepDelayTimer = ue.StepDelayTimer != nil
+	dump.Timers.SessionHoldEnd = getTimeDump(ue.SessionHoldEnd)
+	dump.Timers.RegBackoffEnd = getTimeDump(ue.RegBackoffEnd)
+	dump.Timers.PduSessEstBackoffEnd = getTimeDump(ue.PduSessEstBackoffEnd)
+
+	realUe := ue.RealUe
+	if realUe == nil {
+		return dump
+	}
+	dump.CmIdle = realUe.CmIdle
+	dump.Guti = realUe.Guti
+	dump.Timers.T3512 = realUe.T3512
+	dump.Security = SecurityDump{
+		Available:    realUe.SecurityCtxAvailable,
+		NgKsi:        realUe.NgKsi.Ksi,
+		CipheringAlg: realUe.CipheringAlg,
+		IntegrityAlg: realUe.IntegrityAlg,
+		UlCount:      realUe.ULCount.Get(),
+		DlCount:      realUe.DLCount.Get(),
+	}
+	return dump
+}
+
+// getTimeDump returns nil for the zero time, so that it is omitted
+func getTimeDump(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
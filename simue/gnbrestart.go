@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/gnodeb"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+
+	"github.com/omec-project/nas/nasMessage"
+)
+
+// startGnbRestart restarts the gNB of the UE, raising GNB_RESTART_COMPLETE_EVENT
+// once the gNB is connected to the AMF again. The UEs of the gNB lose their
+// connections meanwhile
+func startGnbRestart(ue *simuectx.SimUe) {
+	gnb := ue.GnB
+	readChan := ue.ReadChan
+	go func() {
+		msg := &common.UeMessage{}
+		msg.Event = common.GNB_RESTART_COMPLETE_EVENT
+		msg.Error = gnodeb.Restart(gnb)
+		readChan <- msg
+	}()
+}
+
+// HandleGnbRestartCompleteEvent recovers the UE once its gNB is restarted. A
+// registered UE re-registers through the mobility registration update, the
+// procedure completes on Registration Accept
+func HandleGnbRestartCompleteEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	if ue.Procedure != common.GNB_RESTART_PROCEDURE {
+		return nil
+	}
+	if err := intfcMsg.GetErrorMsg(); err != nil {
+		return fmt.Errorf("gnb restart failed: %v", err)
+	}
+
+	if !ue.Registered {
+		ue.Log.Infoln("gNB restarted")
+		ChangeProcedure(ue)
+		return nil
+	}
+
+	ue.Log.Infoln("gNB restarted, initiating Mobility Registration Update")
+	msg := &common.UeMessage{}
+	msg.Event = common.REG_REQUEST_EVENT
+	msg.RegistrationType = nasMessage.RegistrationType5GSMobilityRegistrationUpdating
+	SendToRealUe(ue, msg)
+	return nil
+}
+
+// handleGnbRestartRelease handles the loss of the connection of the UE as its
+// gNB restarts. The procedure in progress fails, unless the UE itself
+// restarted the gNB
+func handleGnbRestartRelease(ue *simuectx.SimUe, msg *common.UuMessage) error {
+	ue.WriteGnbUeChan = nil
+	SendToRealUe(ue, msg)
+	if ue.Procedure != common.GNB_RESTART_PROCEDURE {
+		return fmt.Errorf("connection lost as gnb %v restarted", ue.GnB.GnbName)
+	}
+	ue.Log.Infoln("Connection lost as gNB restarted")
+	return nil
+}
@@ -9,13 +9,66 @@ import (
 	"time"
 
 	"github.com/omec-project/gnbsim/common"
+	realueutil "github.com/omec-project/gnbsim/realue/util"
 	simuectx "github.com/omec-project/gnbsim/simue/context"
+	"github.com/omec-project/gnbsim/stats"
+	"github.com/omec-project/gnbsim/util/test"
+
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/ngap/ngapType"
 )
 
 func HandleProfileStartEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
 	ue.Procedure = ue.ProfileCtx.GetFirstProcedure()
+	ue.ProcedureStart = time.Now()
+	ue.ScenarioStep = 0
+	ue.StageTimes = nil
+	if ue.Procedure == common.REGISTRATION_PROCEDURE && ue.Registered {
+		// UE acquired from a UE pool is already registered
+		ue.Log.Infoln("UE already registered, skipping", ue.Procedure)
+		ChangeProcedure(ue)
+		return nil
+	}
+	ue.Log.Infoln("Updated procedure to", ue.Procedure)
+	HandleProcedure(ue)
+	return nil
+}
+
+func HandleExecuteProcedureEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.ProfileMessage)
+	ue.Procedure = msg.Proc
+	ue.Log.Infoln("Updated procedure to", ue.Procedure)
+	HandleProcedure(ue)
+	return nil
+}
+
+// HandleUeStateQueryEvent fills in the state of SimUe and passes the query on
+// to RealUe, which completes it
+func HandleUeStateQueryEvent(ue *simuectx.SimUe, intfcMsg common.InterfaceMessage) {
+	msg := intfcMsg.(*common.UeStateMessage)
+	msg.State.Procedure = ue.Procedure
+	SendToRealUe(ue, msg)
+}
+
+// HandleShutdownEvent cleans up the UE state in the network before the
+// application exits. A registered UE initiates deregistration, whereas any
+// other UE simply terminates
+func HandleShutdownEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	ue.ShuttingDown = true
+	if !ue.Registered {
+		msg := &common.DefaultMessage{}
+		msg.Event = common.QUIT_EVENT
+		ue.ReadChan <- msg
+		return nil
+	}
+
+	ue.Procedure = common.UE_INITIATED_DEREGISTRATION_PROCEDURE
 	ue.Log.Infoln("Updated procedure to", ue.Procedure)
 	HandleProcedure(ue)
 	return nil
@@ -24,27 +77,85 @@ func HandleProfileStartEvent(ue *simuectx.SimUe,
 func HandleRegRequestEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
+	if ue.WriteGnbUeChan == nil {
+		// UE re-registering from idle mode, e.g. in the target cell of a
+		// mobility step
+		err = ConnectToGnb(ue)
+		if err != nil {
+			return fmt.Errorf("failed to connect gnb %v:", err)
+		}
+	}
 	SendToGnbUe(ue, intfcMsg)
+
+	if timers := ue.ProfileCtx.NasTimers; timers != nil {
+		savePendingNasMsg(ue, intfcMsg.(*common.UuMessage))
+		startNasTimer(ue, T3510, timers.GetT3510())
+	}
 	return nil
 }
 
 func HandleRegRejectEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
-	err = ue.ProfileCtx.CheckCurrentEvent(common.REG_REQUEST_EVENT,
-		intfcMsg.GetEventType())
-	if err != nil {
-		ue.Log.Errorln("CheckCurrentEvent returned:", err)
-		return err
+	msg := intfcMsg.(*common.UeMessage)
+	nasMsg := msg.NasMsg.RegistrationReject
+	if nasMsg == nil {
+		ue.Log.Errorln("RegistrationReject is nil")
+		return fmt.Errorf("invalid NAS Message")
 	}
 
-	return nil
+	stopNasTimerOn(ue, T3510)
+	if nasMsg.T3502Value != nil {
+		ue.NwT3502, _ = realueutil.GetGprsTimer2Seconds(nasMsg.T3502Value.GetGPRSTimer2Value())
+	}
+
+	cause := nasMsg.GetCauseValue()
+	ue.Log.Infoln("Registration rejected, 5GMM cause:",
+		nasMessage.Cause5GMMToString(cause))
+
+	// UE does not reattempt the registration while T3346 runs, TS 24.501
+	// Section 5.5.1.2.5. T3502 applies once the reattempt is also rejected
+	var backoffTimer string
+	var backoff uint32
+	if cause == nasMessage.Cause5GMMCongestion && nasMsg.T3346Value != nil {
+		backoffTimer = "T3346"
+		backoff, _ = realueutil.GetGprsTimer2Seconds(nasMsg.T3346Value.GetGPRSTimer2Value())
+	} else if ue.RegRetried && nasMsg.T3502Value != nil {
+		backoffTimer = "T3502"
+		backoff, _ = realueutil.GetGprsTimer2Seconds(nasMsg.T3502Value.GetGPRSTimer2Value())
+	}
+
+	retryType, _ := ue.ProfileCtx.GetRegRejectRetryType()
+	if retryType != 0 && !ue.RegRetried && backoff == 0 {
+		ue.RegRetried = true
+		ue.Log.Infoln("Reattempting Registration, registration type:", retryType)
+		m := &common.UeMessage{}
+		m.Event = common.REG_REQUEST_EVENT
+		m.RegistrationType = retryType
+		SendToRealUe(ue, m)
+		return nil
+	}
+
+	if backoff != 0 {
+		ue.Log.Infoln(backoffTimer, "started,", backoff, "seconds")
+		ue.RegBackoffEnd = time.Now().Add(time.Duration(backoff) * time.Second)
+		return retryableOnCause(fmt.Errorf("registration rejected, 5gmm cause:%v, %v:%v seconds",
+			nasMessage.Cause5GMMToString(cause), backoffTimer, backoff),
+			cause, retryable5gmmCauses)
+	}
+	return retryableOnCause(fmt.Errorf("registration rejected, 5gmm cause:%v",
+		nasMessage.Cause5GMMToString(cause)), cause, retryable5gmmCauses)
 }
 
 func HandleAuthRequestEvent(ue *simuectx.SimUe,
 	intfMsg common.InterfaceMessage) (err error) {
 
 	msg := intfMsg.(*common.UeMessage)
+	if isReAuthentication(ue) {
+		startReAuthentication(ue, msg)
+		return nil
+	}
+
 	// checking as per profile if Authentication Request Message is expected
 	// from 5G Core against Registration Request message sent by RealUE
 	err = ue.ProfileCtx.CheckCurrentEvent(common.REG_REQUEST_EVENT, msg.Event)
@@ -69,10 +180,12 @@ func HandleAuthResponseEvent(ue *simuectx.SimUe,
 	msg := intfcMsg.(*common.UuMessage)
 	// Checking if RealUe has sent expected message as per profile against
 	// Authentication Request message recevied from 5G Core
-	err = ue.ProfileCtx.CheckCurrentEvent(common.AUTH_REQUEST_EVENT, msg.Event)
-	if err != nil {
-		ue.Log.Errorln("CheckCurrentEvent returned:", err)
-		return err
+	if !ue.ReAuthenticating {
+		err = ue.ProfileCtx.CheckCurrentEvent(common.AUTH_REQUEST_EVENT, msg.Event)
+		if err != nil {
+			ue.Log.Errorln("CheckCurrentEvent returned:", err)
+			return err
+		}
 	}
 
 	msg.Event = common.UL_INFO_TRANSFER_EVENT
@@ -81,12 +194,39 @@ func HandleAuthResponseEvent(ue *simuectx.SimUe,
 	return nil
 }
 
+// HandleAuthFailureEvent sends the Authentication Failure generated by RealUe
+// on detecting a synch failure. The network is expected to re-run the
+// authentication with the resynchronized SQN
+func HandleAuthFailureEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UuMessage)
+	msg.Event = common.UL_INFO_TRANSFER_EVENT
+	SendToGnbUe(ue, msg)
+	ue.Log.Infoln("Sending Authentication Failure to the network, synch failure")
+	return nil
+}
+
+func HandleAuthRejectEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	ue.Log.Infoln("Authentication rejected, aborting registration")
+	return fmt.Errorf("authentication rejected by the network")
+}
+
 func HandleSecModCommandEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
 	// TODO: Should check if SecModCommandEvent event is expected
 
 	msg := intfcMsg.(*common.UeMessage)
+	if ue.ReAuthenticating {
+		// Deviations of the profile apply to the registration only
+		msg.Event = common.SEC_MOD_COMPLETE_EVENT
+		SendToRealUe(ue, msg)
+		return nil
+	}
+
 	nextEvent, err := ue.ProfileCtx.GetNextEvent(msg.Event)
 	if err != nil {
 		ue.Log.Errorln("GetNextEvent returned:", err)
@@ -103,6 +243,13 @@ func HandleSecModCompleteEvent(ue *simuectx.SimUe,
 	ue.Log.Traceln("Handling Security Mode Complete Event")
 
 	msg := intfcMsg.(*common.UuMessage)
+	if ue.ReAuthenticating {
+		msg.Event = common.UL_INFO_TRANSFER_EVENT
+		SendToGnbUe(ue, msg)
+		completeReAuthentication(ue)
+		return nil
+	}
+
 	err = ue.ProfileCtx.CheckCurrentEvent(common.SEC_MOD_COMMAND_EVENT,
 		msg.Event)
 	if err != nil {
@@ -116,10 +263,47 @@ func HandleSecModCompleteEvent(ue *simuectx.SimUe,
 	return nil
 }
 
+// HandleSecModRejectEvent sends the Security Mode Reject generated by RealUe,
+// when the profile overrides the expected reply to Security Mode Command. The
+// network aborts the registration, which completes the profile for the UE
+func HandleSecModRejectEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UuMessage)
+	err = ue.ProfileCtx.CheckCurrentEvent(common.SEC_MOD_COMMAND_EVENT,
+		msg.Event)
+	if err != nil {
+		ue.Log.Errorln("CheckCurrentEvent returned:", err)
+		return err
+	}
+
+	msg.Event = common.UL_INFO_TRANSFER_EVENT
+	SendToGnbUe(ue, msg)
+	ue.Log.Infoln("Sent Security Mode Reject to the network, registration aborted")
+	completeProfile(ue)
+	return nil
+}
+
 func HandleRegAcceptEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
 	msg := intfcMsg.(*common.UeMessage)
+	stopNasTimerOn(ue, T3510)
+	ue.RegAttempts = 0
+	if t3502 := msg.NasMsg.RegistrationAccept.T3502Value; t3502 != nil {
+		ue.NwT3502, _ = realueutil.GetGprsTimer2Seconds(t3502.GetGPRSTimer2Value())
+	}
+
+	// LADN information not provided by Registration Accept is deleted, TS
+	// 24.501 Section 5.5.1.2.4
+	ue.LadnInfo = nil
+	if ladn := msg.NasMsg.RegistrationAccept.LADNInformation; ladn != nil {
+		err = updateLadnInfo(ue, ladn.GetLADND())
+		if err != nil {
+			return err
+		}
+	}
+
 	// TODO: Should check if Registration Accept event is expected
 	nextEvent, err := ue.ProfileCtx.GetNextEvent(msg.Event)
 	if err != nil {
@@ -141,9 +325,23 @@ func HandleRegCompleteEvent(ue *simuectx.SimUe,
 		return err
 	}
 
+	if abnormal := ue.ProfileCtx.Abnormal; abnormal != nil && abnormal.OmitRegComplete {
+		ue.Log.Infoln("Registration Complete omitted as configured")
+		completeProfile(ue)
+		return nil
+	}
+
 	msg.Event = common.UL_INFO_TRANSFER_EVENT
 	SendToGnbUe(ue, msg)
 	ue.Log.Traceln("Sent Registration Complete to the network")
+	ue.Registered = true
+	ue.RegRetried = false
+
+	if ue.Procedure == common.MOBILITY_PROCEDURE {
+		ue.NextMobilityStep++
+		startMobilityStep(ue)
+		return nil
+	}
 
 	ChangeProcedure(ue)
 	return nil
@@ -153,7 +351,24 @@ func HandleDeregRequestEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
 	msg := intfcMsg.(*common.UuMessage)
-	msg.Event = common.UL_INFO_TRANSFER_EVENT
+	timers := ue.ProfileCtx.NasTimers
+	if timers != nil && ue.Procedure != common.UE_POWER_OFF_DEREGISTRATION_PROCEDURE {
+		// No Deregistration Accept is expected for switch off
+		savePendingNasMsg(ue, msg)
+		ue.DeregAttempts++
+		startNasTimer(ue, T3521, timers.GetT3521())
+	}
+
+	if ue.WriteGnbUeChan == nil {
+		// UE is in idle mode, Deregistration Request is sent as the initial
+		// NAS message
+		err = ConnectToGnb(ue)
+		if err != nil {
+			return fmt.Errorf("failed to connect gnb %v:", err)
+		}
+	} else {
+		msg.Event = common.UL_INFO_TRANSFER_EVENT
+	}
 	SendToGnbUe(ue, msg)
 	ue.Log.Traceln("Sent Deregistration Request to the network")
 
@@ -163,6 +378,11 @@ func HandleDeregRequestEvent(ue *simuectx.SimUe,
 func HandleDeregAcceptEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
+	stopNasTimerOn(ue, T3521)
+	ue.DeregAttempts = 0
+	if ue.Procedure == common.UE_POWER_OFF_DEREGISTRATION_PROCEDURE {
+		return fmt.Errorf("deregistration accept received for switch off")
+	}
 	return nil
 }
 
@@ -184,6 +404,10 @@ func HandlePduSessEstAcceptEvent(ue *simuectx.SimUe,
 		ue.Log.Errorln("CheckCurrentEvent returned:", err)
 		return err
 	}
+	if cause := ue.ProfileCtx.ExpectedPduSessEstRejectCause; cause != "" {
+		return fmt.Errorf("pdu session establishment accepted, expected reject with 5gsm cause:%v",
+			cause)
+	}
 	nextEvent, err := ue.ProfileCtx.GetNextEvent(msg.Event)
 	if err != nil {
 		ue.Log.Errorln("GetNextEvent returned:", err)
@@ -198,13 +422,42 @@ func HandlePduSessEstAcceptEvent(ue *simuectx.SimUe,
 func HandlePduSessEstRejectEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
-	err = ue.ProfileCtx.CheckCurrentEvent(common.PDU_SESS_EST_REQUEST_EVENT,
-		intfcMsg.GetEventType())
-	if err != nil {
-		ue.Log.Errorln("CheckCurrentEvent returned:", err)
-		return err
+	msg := intfcMsg.(*common.UeMessage)
+	nasMsg := msg.NasMsg.PDUSessionEstablishmentReject
+	if nasMsg == nil {
+		ue.Log.Errorln("PDUSessionEstablishmentReject is nil")
+		return fmt.Errorf("invalid NAS Message")
 	}
 
+	causeName := test.GetCause5GSMName(nasMsg.GetCauseValue())
+	backoff := "not provided"
+	if timer := nasMsg.BackoffTimerValue; timer != nil {
+		// UE does not reattempt the PDU Session Establishment while the
+		// back-off timer (T3396) is running, TS 24.501 Section 6.4.1.4.3
+		seconds, active := realueutil.GetGprsTimer3Seconds(timer.GetUnitTimerValue(),
+			timer.GetTimerValue())
+		backoff = "deactivated"
+		if active {
+			backoff = fmt.Sprint(seconds, " seconds")
+			ue.PduSessEstBackoffEnd = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	ue.Log.Infoln("PDU Session Establishment rejected, 5GSM cause:", causeName,
+		", back-off timer:", backoff)
+
+	expectedCause := ue.ProfileCtx.ExpectedPduSessEstRejectCause
+	if expectedCause == "" {
+		return retryableOnCause(fmt.Errorf("pdu session establishment rejected, 5gsm cause:%v, back-off timer:%v",
+			causeName, backoff), nasMsg.GetCauseValue(), retryable5gsmCauses)
+	}
+	if expectedCause != causeName {
+		return fmt.Errorf("pdu session establishment reject cause mismatch, expected:%v, received:%v",
+			expectedCause, causeName)
+	}
+
+	// Remaining procedures of the profile depend on the PDU session
+	ue.Log.Infoln("Received expected PDU Session Establishment Reject")
+	completeProfile(ue)
 	return nil
 }
 
@@ -230,8 +483,10 @@ func HandlePduSessReleaseCommandEvent(ue *simuectx.SimUe,
 	}
 	nextEvent, err := ue.ProfileCtx.GetNextEvent(msg.Event)
 	if err != nil {
-		ue.Log.Errorln("GetNextEvent returned:", err)
-		return err
+		// Release initiated by the network outside of the procedures of the
+		// profile, e.g. by the SMF, is completed as well
+		ue.Log.Infoln("PDU Session Release initiated by the network")
+		nextEvent = common.PDU_SESS_REL_COMPLETE_EVENT
 	}
 	ue.Log.Infoln("Next Event:", nextEvent)
 	msg.Event = nextEvent
@@ -239,6 +494,31 @@ func HandlePduSessReleaseCommandEvent(ue *simuectx.SimUe,
 	return nil
 }
 
+// HandlePduSessModCommandEvent directs RealUe to complete the PDU Session
+// Modification initiated by the network
+func HandlePduSessModCommandEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UeMessage)
+	nextEvent, err := ue.ProfileCtx.GetNextEvent(msg.Event)
+	if err != nil {
+		nextEvent = common.PDU_SESS_MOD_COMPLETE_EVENT
+	}
+	ue.Log.Infoln("Next Event:", nextEvent)
+	msg.Event = nextEvent
+	SendToRealUe(ue, msg)
+	return nil
+}
+
+func HandlePduSessModCompleteEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UuMessage)
+	msg.Event = common.UL_INFO_TRANSFER_EVENT
+	SendToGnbUe(ue, msg)
+	return nil
+}
+
 func HandlePduSessReleaseCompleteEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
@@ -255,6 +535,17 @@ func HandleDlInfoTransferEvent(ue *simuectx.SimUe,
 	return nil
 }
 
+// HandleUlNasTransportEvent forwards the UL NAS Transport generated by RealUe,
+// such as the SOR or UE parameters update acknowledgement
+func HandleUlNasTransportEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UuMessage)
+	msg.Event = common.UL_INFO_TRANSFER_EVENT
+	SendToGnbUe(ue, msg)
+	return nil
+}
+
 func HandleDataBearerSetupRequestEvent(ue *simuectx.SimUe,
 	msg common.InterfaceMessage) (err error) {
 
@@ -267,10 +558,41 @@ func HandleDataBearerSetupResponseEvent(ue *simuectx.SimUe,
 
 	SendToGnbUe(ue, msg)
 
-	ChangeProcedure(ue)
+	// Handover completes once the target gNB has switched the data bearers
+	if msg.(*common.UuMessage).TriggeringEvent == common.TRIGGER_HANDOVER_EVENT {
+		return nil
+	}
+
+	completePduSessionSetup(ue)
 	return nil
 }
 
+// completePduSessionSetup completes the ongoing procedure once the PDU
+// session is set up, unless the procedure continues further
+func completePduSessionSetup(ue *simuectx.SimUe) {
+	// In case of uplink data triggered service request, the procedure
+	// completes once the pending uplink data is successfully exchanged
+	if ue.Procedure == common.UL_DATA_TRIGGERED_SERVICE_REQUEST_PROCEDURE {
+		return
+	}
+
+	// PDU session to the IMS DNN follows the PDU session to the DNN of the
+	// profile, the procedure completes once both are established
+	ims := ue.ProfileCtx.Ims
+	if ue.Procedure == common.PDU_SESSION_ESTABLISHMENT_PROCEDURE &&
+		ims != nil && ims.Dnn != "" && !ue.ImsPduSessRequested {
+		ue.ImsPduSessRequested = true
+		ue.Log.Infoln("Initiating PDU Session Establishment to IMS DNN")
+		m := &common.UeMessage{}
+		m.Event = common.PDU_SESS_EST_REQUEST_EVENT
+		m.Ims = true
+		SendToRealUe(ue, m)
+		return
+	}
+
+	ChangeProcedure(ue)
+}
+
 func HandleDataBearerReleaseRequestEvent(ue *simuectx.SimUe,
 	msg common.InterfaceMessage) (err error) {
 	// This event is sent by gNB component after it has sent
@@ -278,17 +600,87 @@ func HandleDataBearerReleaseRequestEvent(ue *simuectx.SimUe,
 	// routines in the RealUE will be terminated while processing PDU Session
 	// Release Complete which will also release the communication links
 	// (go channels) with the gNB
+	if ue.Procedure != common.UE_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE &&
+		ue.Procedure != common.NW_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE {
+		// Released by the network outside of the procedures of the profile,
+		// the ongoing procedure continues
+		ue.NwPduSessRels++
+		ue.Log.Infoln("PDU session released by the network")
+		return nil
+	}
 	ChangeProcedure(ue)
 	return nil
 }
 
+// HandleDataBearerModifyEvent records the modification of the PDU sessions by
+// the network. The ongoing procedure continues
+func HandleDataBearerModifyEvent(ue *simuectx.SimUe,
+	msg common.InterfaceMessage) (err error) {
+
+	ue.NwPduSessMods++
+	ue.Log.Infoln("PDU session modified by the network")
+	return nil
+}
+
 func HandleDataPktGenSuccessEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
+	if msg, ok := intfcMsg.(*common.UuMessage); ok {
+		ue.DataStats.Merge(msg.DataStats)
+	}
+
+	if ue.Procedure == common.SESSION_HOLD_PROCEDURE {
+		startThinkTime(ue)
+		return nil
+	}
 	ChangeProcedure(ue)
 	return nil
 }
 
+// HandleThinkTimeExpiryEvent sends the next burst of uplink traffic, or moves
+// to the next procedure once the lifetime of the held PDU session expires
+func HandleThinkTimeExpiryEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	ue.ThinkTimer = nil
+	if ue.Procedure != common.SESSION_HOLD_PROCEDURE {
+		return nil
+	}
+	if !time.Now().Before(ue.SessionHoldEnd) {
+		ue.Log.Infoln("PDU session lifetime expired")
+		ChangeProcedure(ue)
+		return nil
+	}
+
+	ue.Log.Infoln("Sending uplink traffic burst")
+	SendToRealUe(ue, getDataPktGenRequest(ue))
+	return nil
+}
+
+// startThinkTime raises THINK_TIME_EXPIRY_EVENT once the think time, or the
+// remaining lifetime of the held PDU session if shorter, expires
+func startThinkTime(ue *simuectx.SimUe) {
+	wait := time.Until(ue.SessionHoldEnd)
+	thinkTime := time.Duration(ue.ProfileCtx.SessionLifetime.ThinkTime) * time.Second
+	if thinkTime != 0 && thinkTime < wait {
+		wait = thinkTime
+	}
+
+	readChan := ue.ReadChan
+	ue.ThinkTimer = time.AfterFunc(wait, func() {
+		msg := &common.DefaultMessage{}
+		msg.Event = common.THINK_TIME_EXPIRY_EVENT
+		readChan <- msg
+	})
+}
+
+func stopThinkTime(ue *simuectx.SimUe) {
+	if ue.ThinkTimer != nil {
+		ue.ThinkTimer.Stop()
+		ue.ThinkTimer = nil
+	}
+}
+
 func HandleDataPktGenFailureEvent(ue *simuectx.SimUe,
 	msg common.InterfaceMessage) (err error) {
 
@@ -304,6 +696,13 @@ func HandleServiceRequestEvent(ue *simuectx.SimUe,
 		return fmt.Errorf("failed to connect gnb %v:", err)
 	}
 
+	if ue.Procedure == common.INITIAL_CTX_SETUP_FAILURE_PROCEDURE {
+		msg := &common.UeMessage{}
+		msg.Event = common.TRIGGER_INITIAL_CTX_SETUP_FAILURE_EVENT
+		msg.NgapCause = getNgapCause(ue, ue.ProfileCtx.IcsFailureCause)
+		SendToGnbUe(ue, msg)
+	}
+
 	SendToGnbUe(ue, intfcMsg)
 
 	ue.Log.Traceln("Sent Service Request Event to the network")
@@ -320,6 +719,8 @@ func HandleServiceAcceptEvent(ue *simuectx.SimUe,
 		return err
 	}
 
+	// RealUe synchronizes the PDU sessions as per the PDU Session Status
+	SendToRealUe(ue, intfcMsg)
 	return nil
 }
 
@@ -327,32 +728,111 @@ func HandleConnectionReleaseRequestEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 	msg := intfcMsg.(*common.UuMessage)
 
+	if msg.TriggeringEvent == common.GNB_RESTART_EVENT {
+		return handleGnbRestartRelease(ue, msg)
+	}
+
+	if isInactivityRelease(ue, msg) {
+		return handleInactivityRelease(ue, msg)
+	}
+
+	if ue.RadioLinkLost {
+		return handleRadioLossRelease(ue)
+	}
+
 	if ue.Procedure == common.AN_RELEASE_PROCEDURE {
 		err = ue.ProfileCtx.CheckCurrentEvent(common.TRIGGER_AN_RELEASE_EVENT,
 			common.CONNECTION_RELEASE_REQUEST_EVENT)
 		if err != nil {
 			return err
 		}
+	} else if ue.Procedure == common.INITIAL_CTX_SETUP_FAILURE_PROCEDURE {
+		err = ue.ProfileCtx.CheckCurrentEvent(
+			common.TRIGGER_INITIAL_CTX_SETUP_FAILURE_EVENT,
+			common.CONNECTION_RELEASE_REQUEST_EVENT)
+		if err != nil {
+			return err
+		}
+	} else if ue.Procedure == common.UE_DISAPPEARANCE_PROCEDURE {
+		err = ue.ProfileCtx.CheckCurrentEvent(common.TRIGGER_AN_RELEASE_EVENT,
+			common.CONNECTION_RELEASE_REQUEST_EVENT)
+		if err != nil {
+			return err
+		}
+		// UE no longer responds, the network is left to implicitly
+		// deregister it. Hence the UE neither deregisters on shutdown nor is
+		// added to a UE pool
+		ue.WriteGnbUeChan = nil
+		ue.Registered = false
+		ue.Log.Infoln("UE disappeared, registration left to expire in the network")
+		ChangeProcedure(ue)
+		return nil
 	}
 
 	ue.WriteGnbUeChan = nil
 
 	if msg.TriggeringEvent == common.DEREG_REQUEST_UE_ORIG_EVENT {
+		ue.Registered = false
 		msg := &common.UeMessage{}
 		msg.Event = common.QUIT_EVENT
 		ue.ReadChan <- msg
 		// Once UE is deregistered, Sim UE is not expecting any further
-		// procedures
-		SendToProfile(ue, common.PROFILE_PASS_EVENT, nil)
+		// procedures. The profile routine may no longer be waiting for the
+		// result when the application is shutting down
+		recordStageTime(ue)
+		if !ue.ShuttingDown {
+			SendToProfile(ue, common.PROFILE_PASS_EVENT, nil)
+		}
 		return nil
 	}
 
 	SendToRealUe(ue, msg)
+
+	if ue.RetryTimer != nil {
+		// Network releases the connection after rejecting the procedure,
+		// which is retried once the backoff expires
+		return nil
+	}
+
+	if ue.Procedure == common.MOBILITY_PROCEDURE {
+		if !ue.MobilityReRegPending {
+			// UE continues with the mobility steps in idle mode
+			ue.Log.Infoln("Connection released during mobility")
+			return nil
+		}
+		ue.MobilityReRegPending = false
+		step := ue.ProfileCtx.Mobility[ue.NextMobilityStep]
+		gnb, cell, err := getMobilityTarget(ue, step)
+		if err != nil {
+			return err
+		}
+		reRegister(ue, gnb, cell)
+		return nil
+	}
+
 	ChangeProcedure(ue)
 
 	return nil
 }
 
+func HandleRrcInactiveTransitionReportEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	triggerEvent := common.TRIGGER_RRC_INACTIVE_TRANSITION_EVENT
+	if ue.Procedure == common.RRC_RESUME_PROCEDURE {
+		triggerEvent = common.TRIGGER_RRC_RESUME_EVENT
+	}
+
+	err = ue.ProfileCtx.CheckCurrentEvent(triggerEvent, intfcMsg.GetEventType())
+	if err != nil {
+		ue.Log.Errorln("CheckCurrentEvent returned:", err)
+		return err
+	}
+
+	ChangeProcedure(ue)
+	return nil
+}
+
 func HandleNwDeregRequestEvent(ue *simuectx.SimUe, intfcMsg common.InterfaceMessage) (err error) {
 
 	msg := intfcMsg.(*common.UeMessage)
@@ -384,6 +864,7 @@ func HandleNwDeregAcceptEvent(ue *simuectx.SimUe, intfcMsg common.InterfaceMessa
 	msg.Event = common.UL_INFO_TRANSFER_EVENT
 	SendToGnbUe(ue, msg)
 	ue.Log.Traceln("Sent Dereg Accept to the network")
+	ue.Registered = false
 	return nil
 }
 
@@ -391,6 +872,7 @@ func HandleErrorEvent(ue *simuectx.SimUe,
 	intfcMsg common.InterfaceMessage) (err error) {
 
 	SendToProfile(ue, common.PROFILE_FAIL_EVENT, intfcMsg.GetErrorMsg())
+	stats.RecordProcedureFailure()
 
 	msg := &common.UuMessage{}
 	msg.Event = common.QUIT_EVENT
@@ -400,6 +882,12 @@ func HandleErrorEvent(ue *simuectx.SimUe,
 
 func HandleQuitEvent(ue *simuectx.SimUe,
 	msg common.InterfaceMessage) (err error) {
+	stopThinkTime(ue)
+	stopNasTimer(ue)
+	stopMobilityStep(ue)
+	stopRetryTimer(ue)
+	stopPagingWait(ue)
+	stopStepDelay(ue)
 	if ue.WriteGnbUeChan != nil {
 		SendToGnbUe(ue, msg)
 	}
@@ -411,34 +899,98 @@ func HandleQuitEvent(ue *simuectx.SimUe,
 }
 
 func ChangeProcedure(ue *simuectx.SimUe) {
+	stats.RecordProcedureComplete()
+	recordStageTime(ue)
+	ue.ProcRetries = 0
+	if len(ue.ProfileCtx.Scenario) != 0 {
+		changeScenarioStep(ue)
+		return
+	}
 	nextProcedure := ue.ProfileCtx.GetNextProcedure(ue.Procedure)
 	if nextProcedure != 0 {
 		ue.Procedure = nextProcedure
 		ue.Log.Infoln("Updated procedure to", nextProcedure)
-		HandleProcedure(ue)
+		startProcedure(ue)
 	} else {
+		completeProfile(ue)
+	}
+}
+
+// recordStageTime records the time taken by the UE to complete the current
+// procedure
+func recordStageTime(ue *simuectx.SimUe) {
+	if ue.Procedure == 0 {
+		return
+	}
+	ue.StageTimes = append(ue.StageTimes, common.StageTime{
+		Procedure: ue.Procedure,
+		Duration:  time.Since(ue.ProcedureStart),
+	})
+}
+
+// completeProfile reports the successful completion of the profile
+func completeProfile(ue *simuectx.SimUe) {
+	stats.SetUeState(ue.Supi, stats.UE_STATE_PROFILE_COMPLETE)
+	poolName := ue.ProfileCtx.PublishUePool
+	if poolName != "" && ue.Registered && !ue.ShuttingDown {
+		// UE remains connected for the profiles using the pool
+		AddToUePool(poolName, ue)
+		ue.Log.Infoln("Added to UE pool:", poolName)
 		SendToProfile(ue, common.PROFILE_PASS_EVENT, nil)
-		evt, err := ue.ProfileCtx.GetNextEvent(common.PROFILE_PASS_EVENT)
-		if err != nil {
-			ue.Log.Errorln("GetNextEvent failed:", err)
-			return
-		}
-		if evt == common.QUIT_EVENT {
-			msg := &common.DefaultMessage{}
-			msg.Event = common.QUIT_EVENT
-			ue.ReadChan <- msg
-		}
+		return
+	}
+
+	SendToProfile(ue, common.PROFILE_PASS_EVENT, nil)
+	evt, err := ue.ProfileCtx.GetNextEvent(common.PROFILE_PASS_EVENT)
+	if err != nil {
+		ue.Log.Errorln("GetNextEvent failed:", err)
+		return
+	}
+	if evt == common.QUIT_EVENT {
+		msg := &common.DefaultMessage{}
+		msg.Event = common.QUIT_EVENT
+		ue.ReadChan <- msg
 	}
 }
 
 func HandleProcedure(ue *simuectx.SimUe) {
+	stats.SetUeState(ue.Supi, ue.Procedure.String())
+	ue.ProcedureStart = time.Now()
+	drawRadioLoss(ue)
 	switch ue.Procedure {
 	case common.REGISTRATION_PROCEDURE:
+		if remaining := time.Until(ue.RegBackoffEnd); remaining > 0 {
+			failProcedure(ue, fmt.Errorf("registration not reattempted, back-off timer running for %v",
+				remaining.Round(time.Second)))
+			return
+		}
 		ue.Log.Infoln("Initiating Registration Procedure")
+		ue.RegAttempts = 0
 		msg := &common.UeMessage{}
 		msg.Event = common.REG_REQUEST_EVENT
 		SendToRealUe(ue, msg)
 	case common.PDU_SESSION_ESTABLISHMENT_PROCEDURE:
+		ue.ImsPduSessRequested = false
+		if remaining := time.Until(ue.PduSessEstBackoffEnd); remaining > 0 {
+			failProcedure(ue, fmt.Errorf("pdu session establishment not reattempted, back-off timer running for %v",
+				remaining.Round(time.Second)))
+			return
+		}
+		if ue.ProfileCtx.Ladn != nil {
+			inArea, err := isInLadnServiceArea(ue)
+			if err != nil {
+				failProcedure(ue, err)
+				return
+			}
+			ue.Log.Infoln("UE within LADN service area:", inArea)
+			if !inArea && !ue.ProfileCtx.Ladn.RequestOutside {
+				// Remaining procedures of the profile depend on the PDU
+				// session, TS 24.501 Section 6.4.1.1
+				ue.Log.Infoln("PDU session to LADN DNN not requested outside the service area")
+				completeProfile(ue)
+				return
+			}
+		}
 		ue.Log.Infoln("Initiating UE Requested PDU Session Establishment Procedure")
 		msg := &common.UeMessage{}
 		msg.Event = common.PDU_SESS_EST_REQUEST_EVENT
@@ -449,14 +1001,13 @@ func HandleProcedure(ue *simuectx.SimUe) {
 		msg.Event = common.PDU_SESS_REL_REQUEST_EVENT
 		SendToRealUe(ue, msg)
 	case common.USER_DATA_PKT_GENERATION_PROCEDURE:
-		ue.Log.Infoln("Initiating User Data Packet Generation Procedure")
-		msg := &common.UeMessage{}
-		msg.UserDataPktCount = ue.ProfileCtx.DataPktCount
-		if ue.ProfileCtx.DefaultAs == "" {
-			ue.ProfileCtx.DefaultAs = "192.168.250.1" // default destination for AIAB
+		if ue.ProfileCtx.Lightweight {
+			ue.Log.Infoln("User data not generated in the lightweight mode")
+			ChangeProcedure(ue)
+			return
 		}
-		msg.DefaultAs = ue.ProfileCtx.DefaultAs
-		msg.Event = common.DATA_PKT_GEN_REQUEST_EVENT
+		ue.Log.Infoln("Initiating User Data Packet Generation Procedure")
+		msg := getDataPktGenRequest(ue)
 
 		/* TODO: Solve timing issue. Currently UE may start sending user data
 		 * before gnb has successfuly sent PDU Session Resource Setup Response
@@ -471,19 +1022,135 @@ func HandleProcedure(ue *simuectx.SimUe) {
 		msg := &common.UeMessage{}
 		msg.Event = common.DEREG_REQUEST_UE_ORIG_EVENT
 		SendToRealUe(ue, msg)
+	case common.SMS_PROCEDURE:
+		ue.Log.Infoln("Initiating SMS Procedure")
+		ue.MoSmsComplete = false
+		msg := &common.UeMessage{}
+		msg.Event = common.MO_SMS_REQUEST_EVENT
+		SendToRealUe(ue, msg)
+	case common.NSSAA_PROCEDURE:
+		// AMF initiates the slice authentication once the UE registers
+		ue.Log.Infoln("Initiating NSSAA Procedure")
+		checkNssaaComplete(ue)
+	case common.UE_POWER_OFF_DEREGISTRATION_PROCEDURE:
+		ue.Log.Infoln("Initiating UE Power Off Deregistration Procedure")
+		msg := &common.UeMessage{}
+		msg.Event = common.DEREG_REQUEST_UE_ORIG_EVENT
+		msg.SwitchOff = true
+		SendToRealUe(ue, msg)
+	case common.UE_DISAPPEARANCE_PROCEDURE:
+		// gNB releases the connection on losing the radio link, the UE then
+		// stops responding altogether
+		ue.Log.Infoln("Initiating UE Disappearance Procedure")
+		msg := &common.UeMessage{}
+		msg.Event = common.TRIGGER_AN_RELEASE_EVENT
+		msg.NgapCause = getRadioLinkFailureCause(ue)
+		SendToGnbUe(ue, msg)
 	case common.AN_RELEASE_PROCEDURE:
+		if ue.WriteGnbUeChan == nil {
+			ue.Log.Infoln("Connection already released, skipping AN Release Procedure")
+			ChangeProcedure(ue)
+			return
+		}
 		ue.Log.Infoln("Initiating AN Release Procedure")
 		msg := &common.UeMessage{}
 		msg.Event = common.TRIGGER_AN_RELEASE_EVENT
+		msg.NgapCause = getNgapCause(ue, ue.ProfileCtx.UeCtxRelReqCause)
 		SendToGnbUe(ue, msg)
+	case common.INITIAL_CTX_SETUP_FAILURE_PROCEDURE:
+		ue.Log.Infoln("Initiating Initial Context Setup Failure Procedure")
+		msg := &common.UeMessage{}
+		msg.Event = common.SERVICE_REQUEST_EVENT
+		SendToRealUe(ue, msg)
 	case common.UE_TRIGGERED_SERVICE_REQUEST_PROCEDURE:
 		ue.Log.Infoln("Initiating UE Triggered Service Request Procedure")
 		msg := &common.UeMessage{}
 		msg.Event = common.SERVICE_REQUEST_EVENT
 		SendToRealUe(ue, msg)
+	case common.UL_DATA_TRIGGERED_SERVICE_REQUEST_PROCEDURE:
+		ue.Log.Infoln("Initiating Uplink Data Triggered Service Request Procedure")
+		SendToRealUe(ue, getDataPktGenRequest(ue))
+	case common.RRC_INACTIVE_TRANSITION_PROCEDURE:
+		ue.Log.Infoln("Initiating RRC Inactive Transition Procedure")
+		msg := &common.UeMessage{}
+		msg.Event = common.TRIGGER_RRC_INACTIVE_TRANSITION_EVENT
+		SendToGnbUe(ue, msg)
+	case common.RRC_RESUME_PROCEDURE:
+		ue.Log.Infof("Please wait, resuming from RRC Inactive state in %v seconds ...",
+			ue.ProfileCtx.RrcInactiveDuration)
+		time.Sleep(time.Duration(ue.ProfileCtx.RrcInactiveDuration) * time.Second)
+
+		ue.Log.Infoln("Initiating RRC Resume Procedure")
+		msg := &common.UeMessage{}
+		msg.Event = common.TRIGGER_RRC_RESUME_EVENT
+		SendToGnbUe(ue, msg)
+	case common.SESSION_HOLD_PROCEDURE:
+		lifetime := ue.ProfileCtx.SessionLifetime.GetDuration(ue.Rand)
+		ue.Log.Infoln("Holding PDU session for", lifetime)
+		ue.SessionHoldEnd = time.Now().Add(lifetime)
+		startThinkTime(ue)
+	case common.MOBILITY_PROCEDURE:
+		ue.Log.Infoln("Initiating Mobility Procedure,",
+			len(ue.ProfileCtx.Mobility), "steps")
+		ue.NextMobilityStep = 0
+		startMobilityStep(ue)
+	case common.GNB_RESTART_PROCEDURE:
+		ue.Log.Infoln("Initiating gNB Restart Procedure, gNB:", ue.GnB.GnbName)
+		startGnbRestart(ue)
+	case common.NW_TRIGGERED_SERVICE_REQUEST_PROCEDURE:
+		ue.Log.Infoln("Initiating N/W Triggered Service Request Procedure")
+		err := startPagingWait(ue)
+		if err != nil {
+			failProcedure(ue, err)
+		}
 	case common.NW_TRIGGERED_UE_DEREGISTRATION_PROCEDURE:
 		ue.Log.Infoln("Waiting for N/W Triggered De-registration Procedure")
 	case common.NW_REQUESTED_PDU_SESSION_RELEASE_PROCEDURE:
 		ue.Log.Infoln("Waiting for N/W Requested PDU Session Release Procedure")
 	}
 }
+
+// failProcedure fails the current procedure without initiating it
+func failProcedure(ue *simuectx.SimUe, err error) {
+	msg := &common.UeMessage{}
+	msg.Event = common.ERROR_EVENT
+	msg.Error = err
+	ue.ReadChan <- msg
+}
+
+// getDataPktGenRequest returns the request to RealUe for sending the
+// configured number of uplink user data packets
+func getDataPktGenRequest(ue *simuectx.SimUe) *common.UeMessage {
+	msg := &common.UeMessage{}
+	msg.UserDataPktCount = ue.ProfileCtx.DataPktCount
+	if ue.ProfileCtx.DefaultAs == "" {
+		ue.ProfileCtx.DefaultAs = "192.168.250.1" // default destination for AIAB
+	}
+	msg.DefaultAs = ue.ProfileCtx.DefaultAs
+	if flow := ue.TrafficFlow; flow != nil {
+		if flow.DestinationIp != "" {
+			msg.DefaultAs = flow.DestinationIp
+		}
+		msg.Protocol = flow.Protocol
+		msg.SrcPort = flow.SrcPort
+		msg.DstPort = flow.DstPort
+		msg.HttpPath = flow.HttpPath
+		msg.DnsNames = flow.DnsNames
+		msg.DnsTypes = flow.DnsTypes
+	}
+	msg.Event = common.DATA_PKT_GEN_REQUEST_EVENT
+	return msg
+}
+
+// getNgapCause returns the NGAP cause configured in the profile, or nil if not
+// configured. In which case gNB uses the default cause
+func getNgapCause(ue *simuectx.SimUe, name string) *ngapType.Cause {
+	if name == "" {
+		return nil
+	}
+	cause, err := test.GetNgapCause(name)
+	if err != nil {
+		ue.Log.Warnln("GetNgapCause returned:", err)
+	}
+	return cause
+}
@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/omec-project/gnbsim/common"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+)
+
+// EventHookHandler is an in-process event hook, deciding the action of the
+// UE on the configured events. The message of the event may be inspected and
+// modified by the handler before it is handled by the UE, e.g. the NAS
+// message or the parameters of the next procedure. The handler is called by
+// the routine of the UE, concurrently for the UEs
+type EventHookHandler interface {
+	HandleEvent(ue *simuectx.SimUe, msg common.InterfaceMessage) (*HookResponse, error)
+}
+
+// HookRequest is the event passed to the event hook script. Message is the
+// decoded NAS or NGAP message of the event, when the event carries one. Id
+// is carried back in the response of the script. Neither is set for the Lua
+// script, which gets the message of the event itself
+type HookRequest struct {
+	Id         uint64      `json:"id"`
+	Profile    string      `json:"profile"`
+	Supi       string      `json:"supi"`
+	Event      string      `json:"event"`
+	Procedure  string      `json:"procedure"`
+	Registered bool        `json:"registered"`
+	Message    interface{} `json:"message,omitempty"`
+}
+
+// HookResponse is the action decided by the event hook, one of the
+// profctx.HOOK_ACTION_* actions, continue when empty
+type HookResponse struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+var (
+	eventHookHandlersLock sync.RWMutex
+	eventHookHandlers     = make(map[string]EventHookHandler)
+)
+
+// RegisterEventHook registers the in-process event hook handler, referred to
+// by its name in the eventHook of the profiles
+func RegisterEventHook(name string, handler EventHookHandler) {
+	eventHookHandlersLock.Lock()
+	defer eventHookHandlersLock.Unlock()
+	eventHookHandlers[name] = handler
+}
+
+// GetEventHook returns the in-process event hook handler registered with the
+// name, nil if none
+func GetEventHook(name string) EventHookHandler {
+	eventHookHandlersLock.RLock()
+	defer eventHookHandlersLock.RUnlock()
+	return eventHookHandlers[name]
+}
+
+// runEventHook runs the event hook of the profile on the event, when
+// configured, and takes the action decided by it. It returns true if the
+// event is not to be handled further
+func runEventHook(ue *simuectx.SimUe, msg common.InterfaceMessage) (bool, error) {
+	event := msg.GetEventType()
+	hook := ue.ProfileCtx.EventHook
+	if hook == nil || !hook.HasEvent(event) {
+		return false, nil
+	}
+
+	var rsp *HookResponse
+	var err error
+	if hook.Handler != "" {
+		handler := GetEventHook(hook.Handler)
+		if handler == nil {
+			return false, fmt.Errorf("event hook handler not registered:%v",
+				hook.Handler)
+		}
+		rsp, err = handler.HandleEvent(ue, msg)
+	} else if hook.Lua != "" {
+		rsp, err = runEventHookLua(ue, hook, msg)
+	} else {
+		rsp, err = runEventHookScript(ue, hook, msg)
+	}
+	if err != nil {
+		return false, fmt.Errorf("event hook failed on %v:%v", event, err)
+	}
+	if rsp == nil {
+		rsp = &HookResponse{}
+	}
+
+	switch rsp.Action {
+	case "", profctx.HOOK_ACTION_CONTINUE:
+		ue.Log.Traceln("Event hook continued", event)
+		return false, nil
+	case profctx.HOOK_ACTION_SKIP:
+		ue.Log.Infoln("Event hook skipped", event)
+		return true, nil
+	case profctx.HOOK_ACTION_DEREGISTER:
+		if ue.Procedure == common.UE_INITIATED_DEREGISTRATION_PROCEDURE {
+			return false, nil
+		}
+		ue.Log.Infoln("Event hook aborted", ue.Procedure,
+			"with Deregistration Request on", event)
+		ue.Procedure = common.UE_INITIATED_DEREGISTRATION_PROCEDURE
+		ue.Log.Infoln("Updated procedure to", ue.Procedure)
+		HandleProcedure(ue)
+		return true, nil
+	case profctx.HOOK_ACTION_COMPLETE:
+		ue.Log.Infoln("Event hook completed the profile on", event)
+		completeProfile(ue)
+		return true, nil
+	case profctx.HOOK_ACTION_FAIL:
+		return true, fmt.Errorf("failed by event hook on %v:%v", event, rsp.Reason)
+	}
+	return false, fmt.Errorf("unsupported event hook action:%v", rsp.Action)
+}
+
+// runEventHookLua calls the on_event function of the Lua script of the event
+// hook in the Lua state of the UE, with the event and the message of the
+// event. The message is passed by reference, so that the fields set by the
+// script are seen by the handler of the event. The script returns the action
+// and the reason, continue when it returns nothing
+func runEventHookLua(ue *simuectx.SimUe, hook *profctx.EventHook,
+	msg common.InterfaceMessage) (*HookResponse, error) {
+
+	if ue.HookState == nil {
+		state := lua.NewState()
+		state.Push(state.NewFunctionFromProto(hook.GetLuaProto()))
+		err := state.PCall(0, lua.MultRet, nil)
+		if err != nil {
+			state.Close()
+			return nil, fmt.Errorf("failed to load event hook lua script:%v", err)
+		}
+		ue.HookState = state
+	}
+	state := ue.HookState
+
+	fn := state.GetGlobal(profctx.LUA_HOOK_FUNCTION)
+	if fn.Type() != lua.LTFunction {
+		return nil, fmt.Errorf("event hook lua function not defined:%v",
+			profctx.LUA_HOOK_FUNCTION)
+	}
+
+	req := &HookRequest{
+		Profile:    ue.ProfileCtx.Name,
+		Supi:       ue.Supi,
+		Event:      msg.GetEventType().String(),
+		Procedure:  ue.Procedure.String(),
+		Registered: ue.Registered,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hook.GetTimeout())
+	defer cancel()
+	state.SetContext(ctx)
+	err := state.CallByParam(lua.P{Fn: fn, NRet: 2, Protect: true},
+		luar.New(state, req), luar.New(state, msg))
+	if err != nil {
+		// State of an interrupted script is not reused
+		ue.CloseHookState()
+		return nil, fmt.Errorf("event hook lua script failed:%v", err)
+	}
+	state.RemoveContext()
+
+	action, reason := state.Get(-2), state.Get(-1)
+	state.Pop(2)
+	rsp := &HookResponse{}
+	if action != lua.LNil {
+		rsp.Action = lua.LVAsString(action)
+	}
+	if reason != lua.LNil {
+		rsp.Reason = lua.LVAsString(reason)
+	}
+	return rsp, nil
+}
+
+// runEventHookScript passes the event to the script of the event hook and
+// returns the action decided by it
+func runEventHookScript(ue *simuectx.SimUe, hook *profctx.EventHook,
+	msg common.InterfaceMessage) (*HookResponse, error) {
+
+	req := HookRequest{
+		Id:         hook.NextRequestId(),
+		Profile:    ue.ProfileCtx.Name,
+		Supi:       ue.Supi,
+		Event:      msg.GetEventType().String(),
+		Procedure:  ue.Procedure.String(),
+		Registered: ue.Registered,
+	}
+	switch m := msg.(type) {
+	case *common.UeMessage:
+		if m.NasMsg != nil {
+			req.Message = m.NasMsg
+		}
+	case *common.N2Message:
+		if m.NgapPdu != nil {
+			req.Message = m.NgapPdu
+		}
+	}
+	input, err := json.Marshal(&req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event hook request:%v", err)
+	}
+
+	output, err := hook.RunScript(req.Id, input)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &HookResponse{}
+	if len(bytes.TrimSpace(output)) != 0 {
+		err = json.Unmarshal(output, rsp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event hook response:%v", err)
+		}
+	}
+	return rsp, nil
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// drawRadioLoss draws whether the procedure being initiated fails due to the
+// loss of the radio link, as per the impairment configured in the profile
+func drawRadioLoss(ue *simuectx.SimUe) {
+	impairment := ue.ProfileCtx.Impairment
+	ue.RadioLossPending = impairment != nil &&
+		impairment.IsProcedureFailed(ue.Procedure, ue.Rand)
+	if ue.RadioLossPending {
+		ue.Log.Infoln("Radio link to be lost during", ue.Procedure)
+	}
+}
+
+// isDroppedByRadioLoss returns true if the event is not to be handled as the
+// radio link of the UE is lost. The link is lost on the first NAS message
+// from the network once the procedure is drawn to fail, the gNB then releases
+// the UE context with the radio link failure cause. Only the release of the
+// connection and the termination of the UE are handled until then
+func isDroppedByRadioLoss(ue *simuectx.SimUe, event common.EventType) bool {
+	if ue.RadioLinkLost {
+		switch event {
+		case common.CONNECTION_RELEASE_REQUEST_EVENT, common.ERROR_EVENT,
+			common.QUIT_EVENT:
+			return false
+		}
+		ue.Log.Infoln("Radio link lost, dropping event:", event)
+		return true
+	}
+
+	if !ue.RadioLossPending || event != common.DL_INFO_TRANSFER_EVENT ||
+		ue.WriteGnbUeChan == nil {
+		return false
+	}
+
+	ue.Log.Infof("Radio link lost during %v, dropping event: %v", ue.Procedure, event)
+	ue.RadioLossPending = false
+	ue.RadioLinkLost = true
+	stopNasTimer(ue)
+	stopThinkTime(ue)
+
+	msg := &common.UeMessage{}
+	msg.Event = common.TRIGGER_AN_RELEASE_EVENT
+	msg.NgapCause = getRadioLinkFailureCause(ue)
+	SendToGnbUe(ue, msg)
+	return true
+}
+
+// getRadioLinkFailureCause returns the NGAP cause with which the gNB releases
+// the UE context once the radio link of the UE is lost
+func getRadioLinkFailureCause(ue *simuectx.SimUe) *ngapType.Cause {
+	name := ue.ProfileCtx.RadioLinkFailureCause
+	if name == "" {
+		name = "radio-link-failure"
+	}
+	return getNgapCause(ue, name)
+}
+
+// handleRadioLossRelease fails the procedure once the gNB has released the
+// connection of the UE which lost the radio link
+func handleRadioLossRelease(ue *simuectx.SimUe) error {
+	ue.WriteGnbUeChan = nil
+	ue.RadioLinkLost = false
+	ue.Log.Infoln("Connection released after radio link loss")
+	return fmt.Errorf("%v failed due to radio link loss", ue.Procedure)
+}
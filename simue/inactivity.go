@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// isInactivityRelease returns true if the connection of the UE is released as
+// the gNB found the UE inactive, while the UE did not initiate the AN release
+func isInactivityRelease(ue *simuectx.SimUe, msg *common.UuMessage) bool {
+	return msg.TriggeringEvent == common.INACTIVITY_TIMER_EXPIRY_EVENT &&
+		ue.Procedure != common.AN_RELEASE_PROCEDURE
+}
+
+// handleInactivityRelease handles the release of the connection of the UE
+// initiated by the gNB on user inactivity. The UE moves to CM-IDLE state and
+// the procedure in progress continues, a following AN release is then skipped
+func handleInactivityRelease(ue *simuectx.SimUe, msg *common.UuMessage) error {
+	ue.Log.Infoln("Connection released by gNB due to user inactivity")
+	ue.WriteGnbUeChan = nil
+	SendToRealUe(ue, msg)
+	return nil
+}
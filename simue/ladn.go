@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"fmt"
+	"strings"
+
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	realueutil "github.com/omec-project/gnbsim/realue/util"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// updateLadnInfo records the LADN service areas provided by the network
+func updateLadnInfo(ue *simuectx.SimUe, buf []byte) error {
+	ladnInfo, err := realueutil.DecodeLadnInformation(buf)
+	if err != nil {
+		return fmt.Errorf("failed to decode ladn information: %v", err)
+	}
+	for dnn, tais := range ladnInfo {
+		ue.Log.Infoln("LADN DNN:", dnn, "service area:", len(tais), "TAIs")
+	}
+	ue.LadnInfo = ladnInfo
+	return nil
+}
+
+// isInLadnServiceArea checks if the UE is within the LADN service area of
+// the DNN of the profile, as per the configured presence. The DNN must be
+// provided as a LADN DNN by the network
+func isInLadnServiceArea(ue *simuectx.SimUe) (bool, error) {
+	dnn := ue.ProfileCtx.Dnn
+	tais, ok := ue.LadnInfo[dnn]
+	if !ok {
+		return false, fmt.Errorf("ladn information not provided for dnn:%v", dnn)
+	}
+
+	// Profile is validated before the UEs are created
+	presence, _ := ue.ProfileCtx.Ladn.GetPresence()
+	switch presence {
+	case profctx.LADN_PRESENCE_IN:
+		return true, nil
+	case profctx.LADN_PRESENCE_OUT:
+		return false, nil
+	}
+
+	plmn := ue.RealUe.ServingPlmn
+	for _, tai := range tais {
+		if strings.EqualFold(tai.Tac, ue.Tac) && tai.PlmnId != nil &&
+			plmn != nil && tai.PlmnId.Mcc == plmn.Mcc && tai.PlmnId.Mnc == plmn.Mnc {
+			return true, nil
+		}
+	}
+	return false, nil
+}
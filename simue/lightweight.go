@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"fmt"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/gnodeb"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	"github.com/omec-project/gnbsim/realue"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// Attach connects a SimUe of a lightweight profile to its gNB. Unlike Init,
+// no routine is started for the SimUe, its RealUe or its gNB UE context. The
+// caller drives them by passing the events read from their channels to
+// HandleEvent, realue.HandleEvent and gnbcpueworker.HandleEvent. Returns the
+// gNB UE context, nil if the SimUe failed to connect, in which case the
+// failure is sent to the profile
+func Attach(simUe *simuectx.SimUe) *gnbctx.GnbCpUe {
+	gnbUe, err := attachToGnb(simUe)
+	if err != nil {
+		err = fmt.Errorf("failed to connect to gnodeb: %v", err)
+		SendToProfile(simUe, common.PROFILE_FAIL_EVENT, err)
+		simUe.Log.Infoln("Sent Profile Fail Event to Profile routine")
+		return nil
+	}
+
+	realue.Setup(simUe.RealUe)
+	addActiveSimUe(simUe)
+	return gnbUe
+}
+
+// Detach releases a SimUe attached by Attach, once the SimUe, its RealUe and
+// its gNB UE context have terminated
+func Detach(simUe *simuectx.SimUe) {
+	simUe.CloseHookState()
+	removeActiveSimUe(simUe)
+	simUe.Log.Infoln("SIM UE complete")
+}
+
+func attachToGnb(simUe *simuectx.SimUe) (*gnbctx.GnbCpUe, error) {
+	uemsg, err := newConnectionRequest(simUe)
+	if err != nil {
+		return nil, err
+	}
+
+	gNb := simUe.GnB
+	gnbUe, err := gnodeb.AttachUe(gNb, uemsg)
+	if err != nil {
+		return nil, err
+	}
+	simUe.WriteGnbUeChan = gnbUe.ReadChan
+
+	simUe.Log.Infof("Connected to gNodeB, Name:%v, IP:%v, Port:%v", gNb.GnbName,
+		gNb.GnbN2Ip, gNb.GnbN2Port)
+	return gnbUe, nil
+}
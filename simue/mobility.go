@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/factory"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+
+	"github.com/omec-project/nas/nasMessage"
+)
+
+// HandleMobilityStepEvent moves the UE to the target cell of the current
+// mobility step. A connected UE is handed over to the target cell, unless the
+// step requires re-registration, in which case the UE first releases the
+// connection
+func HandleMobilityStepEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	ue.MobilityTimer = nil
+	if ue.Procedure != common.MOBILITY_PROCEDURE {
+		return nil
+	}
+
+	step := ue.ProfileCtx.Mobility[ue.NextMobilityStep]
+	procedure, err := step.GetProcedure()
+	if err != nil {
+		return err
+	}
+	gnb, cell, err := getMobilityTarget(ue, step)
+	if err != nil {
+		return err
+	}
+	ue.Log.Infoln("Executing mobility step:", ue.NextMobilityStep+1,
+		"procedure:", procedure, "target gNB:", gnb.GnbName,
+		"NR Cell Identity:", cell.NrCellId)
+
+	if procedure == profctx.MOBILITY_REGISTRATION || ue.WriteGnbUeChan == nil {
+		if ue.WriteGnbUeChan != nil {
+			ue.MobilityReRegPending = true
+			msg := &common.UeMessage{}
+			msg.Event = common.TRIGGER_AN_RELEASE_EVENT
+			SendToGnbUe(ue, msg)
+			return nil
+		}
+		reRegister(ue, gnb, cell)
+		return nil
+	}
+
+	ho := &gnbctx.Handover{}
+	ho.Type = gnbctx.HANDOVER_XN
+	if procedure == profctx.MOBILITY_N2 {
+		ho.Type = gnbctx.HANDOVER_N2
+	}
+	outcome, err := step.GetOutcome()
+	if err != nil {
+		return err
+	}
+	switch outcome {
+	case profctx.MOBILITY_OUTCOME_CANCEL:
+		ho.Outcome = gnbctx.HANDOVER_OUTCOME_CANCEL
+	case profctx.MOBILITY_OUTCOME_PREPARATION_FAILURE:
+		ho.Outcome = gnbctx.HANDOVER_OUTCOME_PREPARATION_FAILURE
+	default:
+		ho.Outcome = gnbctx.HANDOVER_OUTCOME_SUCCESS
+	}
+	ho.TargetGnb = gnb
+	ho.TargetCell = cell
+	ho.RequiredCause = getNgapCause(ue, ue.ProfileCtx.HandoverRequiredCause)
+	ho.FailureCause = getNgapCause(ue, ue.ProfileCtx.HandoverFailureCause)
+
+	msg := &gnbctx.HandoverMessage{Handover: ho}
+	msg.Event = common.TRIGGER_HANDOVER_EVENT
+	SendToGnbUe(ue, msg)
+	return nil
+}
+
+// HandleHandoverSwitchEvent redirects the messages of the UE to the target
+// gNB UE context, once the handover is executed
+func HandleHandoverSwitchEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	ho := intfcMsg.(*gnbctx.HandoverMessage).Handover
+	ue.WriteGnbUeChan = ho.GetTarget().ReadChan
+	ue.Log.Infoln("Handed over to gNB:", ho.TargetGnb.GnbName)
+	return nil
+}
+
+func HandleHandoverCompleteEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	ho := intfcMsg.(*gnbctx.HandoverMessage).Handover
+	ue.GnB = ho.TargetGnb
+	ue.NrCellId = ho.TargetCell.NrCellId
+	ue.Tac = ho.TargetCell.Tac
+	ue.Log.Infoln("Moved to gNB:", ue.GnB.GnbName, "NR Cell Identity:",
+		ue.NrCellId)
+
+	ue.NextMobilityStep++
+	startMobilityStep(ue)
+	return nil
+}
+
+func HandleHandoverFailureEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	return fmt.Errorf("handover failed: %v", intfcMsg.GetErrorMsg())
+}
+
+// HandleHandoverAbortedEvent moves to the next mobility step once the
+// handover is cancelled or fails the preparation as the step expects, the UE
+// remains in the source cell
+func HandleHandoverAbortedEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	ho := intfcMsg.(*gnbctx.HandoverMessage).Handover
+	ue.Log.Infoln("Handover to gNB:", ho.TargetGnb.GnbName, "aborted as expected,",
+		"outcome:", ho.Outcome, "remaining in NR Cell Identity:", ue.NrCellId)
+
+	ue.NextMobilityStep++
+	startMobilityStep(ue)
+	return nil
+}
+
+// startMobilityStep raises MOBILITY_STEP_EVENT once the delay of the next
+// mobility step expires, or moves to the next procedure once all the steps
+// are complete
+func startMobilityStep(ue *simuectx.SimUe) {
+	if ue.NextMobilityStep >= len(ue.ProfileCtx.Mobility) {
+		ue.Log.Infoln("Mobility steps complete")
+		ChangeProcedure(ue)
+		return
+	}
+
+	delay := ue.ProfileCtx.Mobility[ue.NextMobilityStep].Delay
+	readChan := ue.ReadChan
+	ue.MobilityTimer = time.AfterFunc(time.Duration(delay)*time.Millisecond,
+		func() {
+			msg := &common.DefaultMessage{}
+			msg.Event = common.MOBILITY_STEP_EVENT
+			readChan <- msg
+		})
+}
+
+func stopMobilityStep(ue *simuectx.SimUe) {
+	if ue.MobilityTimer != nil {
+		ue.MobilityTimer.Stop()
+		ue.MobilityTimer = nil
+	}
+}
+
+// reRegister camps the idle UE in the target cell and initiates the mobility
+// registration update
+func reRegister(ue *simuectx.SimUe, gnb *gnbctx.GNodeB, cell *gnbctx.NrCell) {
+	ue.GnB = gnb
+	ue.NrCellId = cell.NrCellId
+	ue.Tac = cell.Tac
+
+	ue.Log.Infoln("Initiating Mobility Registration Update")
+	msg := &common.UeMessage{}
+	msg.Event = common.REG_REQUEST_EVENT
+	msg.RegistrationType = nasMessage.RegistrationType5GSMobilityRegistrationUpdating
+	SendToRealUe(ue, msg)
+}
+
+// getMobilityTarget returns the target gNB and cell of the mobility step
+func getMobilityTarget(ue *simuectx.SimUe,
+	step profctx.MobilityStep) (*gnbctx.GNodeB, *gnbctx.NrCell, error) {
+
+	gnb := ue.GnB
+	if step.GnbName != "" {
+		var err error
+		gnb, err = factory.AppConfig.Configuration.GetGNodeB(step.GnbName)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if step.NrCellId == "" {
+		if len(gnb.Cells) == 0 {
+			return nil, nil, fmt.Errorf("no cell configured for gnb:%v",
+				gnb.GnbName)
+		}
+		return gnb, gnb.Cells[0], nil
+	}
+	cell, err := gnb.GetCell(step.NrCellId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gnb, cell, nil
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// HandleNasDataPathSetupEvent completes the PDU session establishment once
+// RealUe has set up the PDU session whose user data is carried over NAS
+func HandleNasDataPathSetupEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	completePduSessionSetup(ue)
+	return nil
+}
+
+// HandleNasDataUlTransportEvent sends the UL NAS Transport carrying the
+// uplink user data to the gNB
+func HandleNasDataUlTransportEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UuMessage)
+	msg.Event = common.UL_INFO_TRANSFER_EVENT
+	SendToGnbUe(ue, msg)
+	return nil
+}
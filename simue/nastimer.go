@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// UE NAS timers, TS 24.501 Section 10.2
+const (
+	T3510 string = "T3510"
+	T3511 string = "T3511"
+	T3521 string = "T3521"
+)
+
+// HandleNasTimerExpiryEvent handles the expiry of the NAS timer of the UE. The
+// Registration Request is reattempted on the expiry of T3511, which is started
+// once T3510 expires, until the registration attempt counter reaches its
+// maximum. The Deregistration Request is retransmitted on the expiry of T3521
+func HandleNasTimerExpiryEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.TimerMessage)
+	if ue.NasTimer == nil || msg.Gen != ue.NasTimerGen {
+		ue.Log.Traceln("Ignoring expiry of stopped timer:", msg.Timer)
+		return nil
+	}
+	ue.NasTimer = nil
+	ue.NasTimerName = ""
+	ue.Log.Infoln(msg.Timer, "expired")
+
+	timers := ue.ProfileCtx.NasTimers
+	switch msg.Timer {
+	case T3510:
+		ue.RegAttempts++
+		if ue.RegAttempts < timers.GetMaxRegAttempts() {
+			startNasTimer(ue, T3511, timers.GetT3511())
+			return nil
+		}
+		t3502 := timers.GetT3502(ue.NwT3502)
+		ue.RegBackoffEnd = time.Now().Add(t3502)
+		return retryable(fmt.Errorf("registration failed after %v attempts, T3502 started for %v",
+			ue.RegAttempts, t3502))
+	case T3511:
+		ue.Log.Infoln("Reattempting Registration, attempt:", ue.RegAttempts+1)
+		return HandleRegRequestEvent(ue, copyPendingNasMsg(ue))
+	case T3521:
+		if ue.DeregAttempts >= profctx.MAX_DEREG_ATTEMPTS {
+			return retryable(fmt.Errorf("deregistration accept not received after %v attempts",
+				ue.DeregAttempts))
+		}
+		ue.Log.Infoln("Retransmitting Deregistration Request, attempt:",
+			ue.DeregAttempts+1)
+		return HandleDeregRequestEvent(ue, copyPendingNasMsg(ue))
+	}
+	return nil
+}
+
+// startNasTimer starts the NAS timer, stopping the one already running. The
+// timer raises NAS_TIMER_EXPIRY_EVENT on expiry
+func startNasTimer(ue *simuectx.SimUe, name string, duration time.Duration) {
+	stopNasTimer(ue)
+	if ue.ProfileCtx.Lightweight {
+		// NAS messages are not retransmitted in the lightweight mode, the
+		// per user timeout fails the UE instead
+		return
+	}
+	ue.NasTimerGen++
+	ue.NasTimerName = name
+	ue.Log.Traceln(name, "started,", duration)
+
+	readChan := ue.ReadChan
+	gen := ue.NasTimerGen
+	ue.NasTimer = time.AfterFunc(duration, func() {
+		msg := &common.TimerMessage{}
+		msg.Event = common.NAS_TIMER_EXPIRY_EVENT
+		msg.Timer = name
+		msg.Gen = gen
+		readChan <- msg
+	})
+}
+
+// stopNasTimer stops the NAS timer of the UE, if running
+func stopNasTimer(ue *simuectx.SimUe) {
+	if ue.NasTimer != nil {
+		ue.NasTimer.Stop()
+		ue.Log.Traceln(ue.NasTimerName, "stopped")
+		ue.NasTimer = nil
+		ue.NasTimerName = ""
+	}
+}
+
+// stopNasTimerOn stops the NAS timer of the UE if it is the named timer
+func stopNasTimerOn(ue *simuectx.SimUe, name string) {
+	if ue.NasTimerName == name {
+		stopNasTimer(ue)
+	}
+}
+
+// savePendingNasMsg saves the NAS message for its retransmission
+func savePendingNasMsg(ue *simuectx.SimUe, msg *common.UuMessage) {
+	ue.PendingNasMsg = &common.UuMessage{}
+	ue.PendingNasMsg.Event = msg.Event
+	ue.PendingNasMsg.NasPdus = msg.NasPdus
+}
+
+func copyPendingNasMsg(ue *simuectx.SimUe) *common.UuMessage {
+	msg := &common.UuMessage{}
+	msg.Event = ue.PendingNasMsg.Event
+	msg.NasPdus = ue.PendingNasMsg.NasPdus
+	return msg
+}
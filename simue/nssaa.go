@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// HandleNssaaUlMessageEvent sends the NSSAA Complete or the Configuration
+// Update Complete generated by RealUe to the network
+func HandleNssaaUlMessageEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UuMessage)
+	msg.Event = common.UL_INFO_TRANSFER_EVENT
+	SendToGnbUe(ue, msg)
+	return nil
+}
+
+// HandleNssaaResultEvent counts the network slice-specific authentication
+// results, which may also be received before the NSSAA procedure starts
+func HandleNssaaResultEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	ue.NssaaResults++
+	checkNssaaComplete(ue)
+	return nil
+}
+
+// HandleConfigUpdateCommandEvent records the LADN information of the
+// Configuration Update Command, and lets RealUe process the rest of it. The
+// command is not part of the event map of the profile
+func HandleConfigUpdateCommandEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UeMessage)
+	if ladn := msg.NasMsg.ConfigurationUpdateCommand.LADNInformation; ladn != nil {
+		err = updateLadnInfo(ue, ladn.GetLADND())
+		if err != nil {
+			return err
+		}
+	}
+	SendToRealUe(ue, intfcMsg)
+	return nil
+}
+
+// checkNssaaComplete moves to the next procedure once the results of all the
+// slices subject to network slice-specific authentication are received
+func checkNssaaComplete(ue *simuectx.SimUe) {
+	if ue.Procedure != common.NSSAA_PROCEDURE {
+		return
+	}
+	expected := len(ue.ProfileCtx.Nssaa)
+	if ue.NssaaResults < expected {
+		ue.Log.Infoln("Waiting for NSSAA results, received:", ue.NssaaResults,
+			"expected:", expected)
+		return
+	}
+	ue.Log.Infoln("NSSAA procedure complete")
+	ChangeProcedure(ue)
+}
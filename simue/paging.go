@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	gnbctx "github.com/omec-project/gnbsim/gnodeb/context"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+
+	"github.com/omec-project/nas/nasConvert"
+)
+
+// startPagingWait registers the UE in CM-IDLE state with the gNB, to be
+// notified when the network pages it with the 5G-S-TMSI of its 5G-GUTI
+func startPagingWait(ue *simuectx.SimUe) error {
+	if ue.WriteGnbUeChan != nil {
+		return fmt.Errorf("ue not in idle mode, paging not expected")
+	}
+	if ue.RealUe.Guti == "" {
+		return fmt.Errorf("no 5g-guti assigned, ue cannot be paged")
+	}
+
+	guti := nasConvert.GutiToNas(ue.RealUe.Guti)
+	tmsi := guti.GetTMSI5G()
+	ue.PagingTmsi = &gnbctx.FiveGSTmsi{
+		AmfSetId:   guti.GetAMFSetID(),
+		AmfPointer: guti.GetAMFPointer(),
+		Tmsi:       binary.BigEndian.Uint32(tmsi[:]),
+	}
+	ue.PagingTimes = nil
+	ue.GnB.AddPagingUe(*ue.PagingTmsi, ue.ReadChan)
+	ue.Log.Infof("Waiting for paging, 5G-S-TMSI: %+v, paging attempts ignored: %v",
+		*ue.PagingTmsi, getPagingIgnoreCount(ue))
+	return nil
+}
+
+// stopPagingWait stops listening for the paging
+func stopPagingWait(ue *simuectx.SimUe) {
+	if ue.PagingTmsi == nil {
+		return
+	}
+	ue.GnB.RemovePagingUe(*ue.PagingTmsi)
+	ue.PagingTmsi = nil
+}
+
+// HandlePagingEvent records the time of the paging attempt since the UE
+// entered CM-IDLE state. The configured number of attempts are ignored, the
+// UE then responds with Service Request, TS 23.502 Section 4.2.3.3
+func HandlePagingEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	if ue.PagingTmsi == nil {
+		ue.Log.Warnln("Paging not expected, ignored")
+		return nil
+	}
+
+	elapsed := time.Since(ue.ProcedureStart)
+	ue.PagingTimes = append(ue.PagingTimes, elapsed)
+	attempt := uint(len(ue.PagingTimes))
+	if attempt <= getPagingIgnoreCount(ue) {
+		ue.Log.Infof("Ignoring paging attempt %v, received after %v", attempt, elapsed)
+		return nil
+	}
+
+	ue.Log.Infof("Responding to paging attempt %v, received after %v, paging times: %v",
+		attempt, elapsed, ue.PagingTimes)
+	stopPagingWait(ue)
+	msg := &common.UeMessage{}
+	msg.Event = common.SERVICE_REQUEST_EVENT
+	msg.PagingResponse = true
+	SendToRealUe(ue, msg)
+	return nil
+}
+
+func getPagingIgnoreCount(ue *simuectx.SimUe) uint {
+	if ue.ProfileCtx.Paging == nil {
+		return 0
+	}
+	return ue.ProfileCtx.Paging.IgnoreCount
+}
@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// isReAuthentication returns true if the Authentication Request is received
+// while the UE is registered, i.e. the AMF initiates the authentication
+// during a procedure other than the registration, such as a service request
+func isReAuthentication(ue *simuectx.SimUe) bool {
+	return ue.ReAuthenticating ||
+		(ue.Registered && ue.Procedure != common.REGISTRATION_PROCEDURE)
+}
+
+// startReAuthentication pauses the ongoing procedure and hands over the
+// Authentication Request to RealUe, which runs 5G-AKA. The key set derived is
+// taken into use by the following Security Mode Command. The event map of the
+// profile is not consulted, as it describes the registration
+func startReAuthentication(ue *simuectx.SimUe, msg *common.UeMessage) {
+	if !ue.ReAuthenticating {
+		ue.Log.Infoln("Network initiated re-authentication, pausing", ue.Procedure)
+		ue.ReAuthenticating = true
+	}
+	msg.Event = common.AUTH_RESPONSE_EVENT
+	SendToRealUe(ue, msg)
+}
+
+// completeReAuthentication resumes the ongoing procedure once the new NAS
+// security context is activated
+func completeReAuthentication(ue *simuectx.SimUe) {
+	ue.ReAuthenticating = false
+	ue.ReAuthCount++
+	ue.Log.Infof("Re-authentication complete, count: %v, resuming %v",
+		ue.ReAuthCount, ue.Procedure)
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"errors"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+
+	"github.com/omec-project/nas/nasMessage"
+)
+
+// retryableError is the failure of a procedure which may be retried as per
+// the retry policy of the profile, i.e. a timeout or a reject with a cause
+// allowing the retry
+type retryableError struct {
+	error
+}
+
+func retryable(err error) error {
+	return &retryableError{err}
+}
+
+// 5GMM and 5GSM causes of the rejects after which the procedure may be
+// retried, the network being temporarily unable to serve the UE
+var (
+	retryable5gmmCauses = []uint8{
+		nasMessage.Cause5GMMCongestion,
+		nasMessage.Cause5GMMProtocolErrorUnspecified,
+	}
+	retryable5gsmCauses = []uint8{
+		nasMessage.Cause5GSMInsufficientResources,
+		nasMessage.Cause5GSMRequestRejectedUnspecified,
+		nasMessage.Cause5GSMInsufficientResourcesForSpecificSliceAndDNN,
+		nasMessage.Cause5GSMInsufficientResourcesForSpecificSlice,
+		nasMessage.Cause5GSMProtocolErrorUnspecified,
+	}
+)
+
+// retryableOnCause marks the failure as retryable if the cause of the reject
+// allows the retry
+func retryableOnCause(err error, cause uint8, causes []uint8) error {
+	for _, c := range causes {
+		if c == cause {
+			return retryable(err)
+		}
+	}
+	return err
+}
+
+// retryProcedure schedules the retry of the failed procedure, once the
+// backoff expires. It returns false if the UE is to be marked failed instead
+func retryProcedure(ue *simuectx.SimUe, err error) bool {
+	policy := ue.ProfileCtx.RetryPolicy
+	var rerr *retryableError
+	if policy == nil || !errors.As(err, &rerr) {
+		return false
+	}
+	if !policy.IsRetried(ue.Procedure, ue.ProcRetries) {
+		if ue.ProcRetries != 0 {
+			ue.Log.Infof("%v not retried, %v retries made", ue.Procedure,
+				ue.ProcRetries)
+		}
+		return false
+	}
+
+	ue.ProcRetries++
+	ue.Retries++
+	backoff := policy.GetBackoff(ue.ProcRetries)
+
+	// Procedure is not reattempted while the back-off timer provided by the
+	// network runs
+	var nwBackoffEnd time.Time
+	switch ue.Procedure {
+	case common.REGISTRATION_PROCEDURE:
+		nwBackoffEnd = ue.RegBackoffEnd
+	case common.PDU_SESSION_ESTABLISHMENT_PROCEDURE:
+		nwBackoffEnd = ue.PduSessEstBackoffEnd
+	}
+	if remaining := time.Until(nwBackoffEnd); remaining > backoff {
+		backoff = remaining
+	}
+
+	// Retried Deregistration Request is transmitted afresh
+	stopNasTimer(ue)
+	ue.DeregAttempts = 0
+	ue.Log.Infof("%v failed: %v, retry %v in %v", ue.Procedure, err,
+		ue.ProcRetries, backoff.Round(time.Millisecond))
+
+	readChan := ue.ReadChan
+	ue.RetryTimer = time.AfterFunc(backoff, func() {
+		msg := &common.DefaultMessage{}
+		msg.Event = common.RETRY_PROCEDURE_EVENT
+		readChan <- msg
+	})
+	return true
+}
+
+// HandleRetryProcedureEvent initiates the failed procedure again once the
+// backoff expires
+func HandleRetryProcedureEvent(ue *simuectx.SimUe,
+	msg common.InterfaceMessage) (err error) {
+
+	if ue.RetryTimer == nil {
+		return nil
+	}
+	ue.RetryTimer = nil
+	ue.Log.Infof("Retrying %v, retry: %v", ue.Procedure, ue.ProcRetries)
+	HandleProcedure(ue)
+	return nil
+}
+
+// stopRetryTimer stops the backoff timer of the UE, if running
+func stopRetryTimer(ue *simuectx.SimUe) {
+	if ue.RetryTimer != nil {
+		ue.RetryTimer.Stop()
+		ue.RetryTimer = nil
+	}
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"fmt"
+	"time"
+
+	profctx "github.com/omec-project/gnbsim/profile/context"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// changeScenarioStep checks the completed step of the scenario and starts the
+// next one. The profile is complete for the UE once all the steps pass. The
+// steps are tracked by index, as a procedure may be repeated in the scenario
+func changeScenarioStep(ue *simuectx.SimUe) {
+	steps := ue.ProfileCtx.Scenario
+	step := steps[ue.ScenarioStep]
+	err := checkScenarioStep(ue, step)
+	if err != nil {
+		failProcedure(ue, fmt.Errorf("scenario step %v (%v) failed:%v",
+			ue.ScenarioStep+1, ue.Procedure, err))
+		return
+	}
+	ue.Log.Infoln("Scenario step", ue.ScenarioStep+1, "passed,", ue.Procedure)
+
+	ue.ScenarioStep++
+	if ue.ScenarioStep == len(steps) {
+		completeProfile(ue)
+		return
+	}
+	ue.Procedure = ue.ProfileCtx.Procedures[ue.ScenarioStep]
+	ue.Log.Infoln("Updated procedure to", ue.Procedure)
+	startProcedure(ue)
+}
+
+// checkScenarioStep validates the time taken by the step and its assertions.
+// RealUe updates its state before reporting the events completing the
+// procedure, hence the state is consistent once the procedure completes
+func checkScenarioStep(ue *simuectx.SimUe, step *profctx.ScenarioStep) error {
+	elapsed := time.Since(ue.ProcedureStart)
+	if step.Within != 0 && elapsed > time.Duration(step.Within)*time.Second {
+		return fmt.Errorf("completed in %v, expected within %v seconds",
+			elapsed.Round(time.Millisecond), step.Within)
+	}
+
+	assert := step.Assert
+	if assert == nil {
+		return nil
+	}
+	if assert.Registered != nil && *assert.Registered != ue.Registered {
+		return fmt.Errorf("registered mismatch, expected:%v, actual:%v",
+			*assert.Registered, ue.Registered)
+	}
+	if assert.MicoGranted != nil && *assert.MicoGranted != ue.RealUe.MicoGranted {
+		return fmt.Errorf("mico mode granted mismatch, expected:%v, received:%v",
+			*assert.MicoGranted, ue.RealUe.MicoGranted)
+	}
+	if assert.SmsAllowed != nil && *assert.SmsAllowed != ue.RealUe.SmsAllowed {
+		return fmt.Errorf("sms allowed mismatch, expected:%v, received:%v",
+			*assert.SmsAllowed, ue.RealUe.SmsAllowed)
+	}
+	if assert.T3512 != nil && *assert.T3512 != ue.RealUe.T3512 {
+		return fmt.Errorf("t3512 mismatch, expected:%v seconds, received:%v seconds",
+			*assert.T3512, ue.RealUe.T3512)
+	}
+	return nil
+}
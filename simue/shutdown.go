@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	"github.com/omec-project/gnbsim/logger"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+	"github.com/omec-project/gnbsim/stats"
+)
+
+// activeSimUes holds the SimUes which are connected to the gNodeB and are not
+// yet terminated
+var activeSimUes = struct {
+	sync.Mutex
+	ues map[*simuectx.SimUe]struct{}
+}{ues: make(map[*simuectx.SimUe]struct{})}
+
+func addActiveSimUe(simUe *simuectx.SimUe) {
+	activeSimUes.Lock()
+	defer activeSimUes.Unlock()
+	activeSimUes.ues[simUe] = struct{}{}
+	stats.SetUeState(simUe.Supi, stats.UE_STATE_WAITING)
+}
+
+func removeActiveSimUe(simUe *simuectx.SimUe) {
+	activeSimUes.Lock()
+	defer activeSimUes.Unlock()
+	delete(activeSimUes.ues, simUe)
+	stats.RemoveUe(simUe.Supi)
+}
+
+func getActiveSimUeCount() int {
+	activeSimUes.Lock()
+	defer activeSimUes.Unlock()
+	return len(activeSimUes.ues)
+}
+
+// ShutdownAllSimUes directs all the active SimUes to clean up their state in
+// the network, and waits until they are terminated or the deadline expires.
+// It returns the number of SimUes which did not terminate within the deadline
+func ShutdownAllSimUes(deadline time.Duration) int {
+	activeSimUes.Lock()
+	for simUe := range activeSimUes.ues {
+		// SimUe may be busy handling other events, hence the event is sent
+		// without blocking the shutdown of the remaining SimUes
+		go func(simUe *simuectx.SimUe) {
+			msg := &common.DefaultMessage{}
+			msg.Event = common.SHUTDOWN_EVENT
+			simUe.ReadChan <- msg
+		}(simUe)
+	}
+	count := len(activeSimUes.ues)
+	activeSimUes.Unlock()
+
+	logger.AppLog.Infoln("Shutting down", count, "active SimUe(s)")
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	expiry := time.After(deadline)
+	for {
+		count = getActiveSimUeCount()
+		if count == 0 {
+			return 0
+		}
+		select {
+		case <-expiry:
+			return count
+		case <-ticker.C:
+		}
+	}
+}
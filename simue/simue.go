@@ -11,6 +11,9 @@ import (
 	"github.com/omec-project/gnbsim/gnodeb"
 	"github.com/omec-project/gnbsim/realue"
 	simuectx "github.com/omec-project/gnbsim/simue/context"
+
+	"github.com/omec-project/nas/nasConvert"
+	"github.com/omec-project/openapi/models"
 )
 
 func Init(simUe *simuectx.SimUe) {
@@ -29,19 +32,24 @@ func Init(simUe *simuectx.SimUe) {
 		realue.Init(simUe.RealUe)
 	}()
 
+	addActiveSimUe(simUe)
+	addUeTimeline(simUe)
+	defer removeActiveSimUe(simUe)
+	defer removeFromUePools(simUe)
+	defer simUe.CloseHookState()
+
 	HandleEvents(simUe)
 	simUe.Log.Infoln("SIM UE go routine complete")
 }
 
 func ConnectToGnb(simUe *simuectx.SimUe) error {
-	uemsg := common.UuMessage{}
-	uemsg.Event = common.CONNECTION_REQUEST_EVENT
-	uemsg.CommChan = simUe.ReadChan
-	uemsg.Supi = simUe.Supi
+	uemsg, err := newConnectionRequest(simUe)
+	if err != nil {
+		return err
+	}
 
-	var err error
 	gNb := simUe.GnB
-	simUe.WriteGnbUeChan, err = gnodeb.RequestConnection(gNb, &uemsg)
+	simUe.WriteGnbUeChan, err = gnodeb.RequestConnection(gNb, uemsg)
 	if err != nil {
 		return err
 	}
@@ -51,91 +59,215 @@ func ConnectToGnb(simUe *simuectx.SimUe) error {
 	return nil
 }
 
-func HandleEvents(ue *simuectx.SimUe) {
+// newConnectionRequest returns the connection request of the SimUe to its gNB
+func newConnectionRequest(simUe *simuectx.SimUe) (*common.UuMessage, error) {
+	uemsg := &common.UuMessage{}
+	uemsg.Event = common.CONNECTION_REQUEST_EVENT
+	uemsg.CommChan = simUe.ReadChan
+	uemsg.Supi = simUe.Supi
+	uemsg.Tac = simUe.Tac
+	uemsg.NrCellId = simUe.NrCellId
+	uemsg.Plmn = simUe.RealUe.ServingPlmn
+	uemsg.Guami = getGuami(simUe.RealUe.Guti)
+	uemsg.Snssai = simUe.RealUe.SNssai
+	uemsg.Timeline = simUe.RealUe.Timeline
+	uemsg.CellChanges = simUe.ProfileCtx.CellChanges
+	uemsg.UeCtxModFailureCause = getNgapCause(simUe,
+		simUe.ProfileCtx.UeCtxModFailureCause)
+
 	var err error
+	uemsg.UeRadioCapability, err = simUe.ProfileCtx.GetUeRadioCapability()
+	if err != nil {
+		return nil, err
+	}
+	return uemsg, nil
+}
+
+// getGuami returns the GUAMI of the 5G-GUTI, nil if no 5G-GUTI is assigned
+func getGuami(guti string) *models.Guami {
+	if guti == "" {
+		return nil
+	}
+	gutiNas := nasConvert.GutiToNas(guti)
+	guami, _ := nasConvert.GutiToString(gutiNas.Octet[:])
+	return &guami
+}
+
+func HandleEvents(ue *simuectx.SimUe) {
 	for msg := range ue.ReadChan {
-		event := msg.GetEventType()
-		ue.Log.Infoln("Handling event:", event)
-
-		switch event {
-		case common.REG_REQUEST_EVENT:
-			err = HandleRegRequestEvent(ue, msg)
-		case common.REG_REJECT_EVENT:
-			err = HandleRegRejectEvent(ue, msg)
-		case common.AUTH_REQUEST_EVENT:
-			err = HandleAuthRequestEvent(ue, msg)
-		case common.AUTH_RESPONSE_EVENT:
-			err = HandleAuthResponseEvent(ue, msg)
-		case common.SEC_MOD_COMMAND_EVENT:
-			err = HandleSecModCommandEvent(ue, msg)
-		case common.SEC_MOD_COMPLETE_EVENT:
-			err = HandleSecModCompleteEvent(ue, msg)
-		case common.REG_ACCEPT_EVENT:
-			err = HandleRegAcceptEvent(ue, msg)
-		case common.REG_COMPLETE_EVENT:
-			err = HandleRegCompleteEvent(ue, msg)
-		case common.DEREG_REQUEST_UE_ORIG_EVENT:
-			err = HandleDeregRequestEvent(ue, msg)
-		case common.DEREG_ACCEPT_UE_ORIG_EVENT:
-			err = HandleDeregAcceptEvent(ue, msg)
-		case common.PDU_SESS_EST_REQUEST_EVENT:
-			err = HandlePduSessEstRequestEvent(ue, msg)
-		case common.PDU_SESS_REL_REQUEST_EVENT:
-			err = HandlePduSessReleaseRequestEvent(ue, msg)
-		case common.PDU_SESS_REL_COMMAND_EVENT:
-			err = HandlePduSessReleaseCommandEvent(ue, msg)
-		case common.PDU_SESS_EST_ACCEPT_EVENT:
-			err = HandlePduSessEstAcceptEvent(ue, msg)
-		case common.PDU_SESS_EST_REJECT_EVENT:
-			err = HandlePduSessEstRejectEvent(ue, msg)
-		case common.PDU_SESS_REL_COMPLETE_EVENT:
-			err = HandlePduSessReleaseCompleteEvent(ue, msg)
-		case common.DL_INFO_TRANSFER_EVENT:
-			err = HandleDlInfoTransferEvent(ue, msg)
-		case common.DATA_BEARER_SETUP_REQUEST_EVENT:
-			err = HandleDataBearerSetupRequestEvent(ue, msg)
-		case common.DATA_BEARER_SETUP_RESPONSE_EVENT:
-			err = HandleDataBearerSetupResponseEvent(ue, msg)
-		case common.DATA_BEARER_RELEASE_REQUEST_EVENT:
-			err = HandleDataBearerReleaseRequestEvent(ue, msg)
-		case common.DATA_PKT_GEN_SUCCESS_EVENT:
-			err = HandleDataPktGenSuccessEvent(ue, msg)
-		case common.DATA_PKT_GEN_FAILURE_EVENT:
-			err = HandleDataPktGenFailureEvent(ue, msg)
-		case common.SERVICE_REQUEST_EVENT:
-			err = HandleServiceRequestEvent(ue, msg)
-		case common.SERVICE_ACCEPT_EVENT:
-			err = HandleServiceAcceptEvent(ue, msg)
-		case common.PROFILE_START_EVENT:
-			err = HandleProfileStartEvent(ue, msg)
-		case common.CONNECTION_RELEASE_REQUEST_EVENT:
-			err = HandleConnectionReleaseRequestEvent(ue, msg)
-		case common.DEREG_REQUEST_UE_TERM_EVENT:
-			err = HandleNwDeregRequestEvent(ue, msg)
-		case common.DEREG_ACCEPT_UE_TERM_EVENT:
-			err = HandleNwDeregAcceptEvent(ue, msg)
-		case common.ERROR_EVENT:
-			HandleErrorEvent(ue, msg)
-			return
-		case common.QUIT_EVENT:
-			HandleQuitEvent(ue, msg)
+		if HandleEvent(ue, msg) {
 			return
-		default:
-			ue.Log.Warnln("Event:", event, "is not supported")
 		}
+	}
+}
 
-		if err != nil {
-			ue.Log.Errorln("Failed to handle event:", event, "Error:", err)
-			msg := &common.UeMessage{}
-			msg.Error = err
-			err = nil
-			msg.Event = common.ERROR_EVENT
-			HandleErrorEvent(ue, msg)
-			return
-		}
+// HandleEvent routes an event to the corresponding handler and returns true
+// once the SimUe has terminated
+func HandleEvent(ue *simuectx.SimUe, msg common.InterfaceMessage) (quit bool) {
+	event := msg.GetEventType()
+
+	// State is reported whatever the UE is going through, the query is not
+	// part of any procedure
+	if event == common.UE_STATE_QUERY_EVENT {
+		HandleUeStateQueryEvent(ue, msg)
+		return false
+	}
+
+	if isAbortedByDereg(ue, event) || isDroppedByRadioLoss(ue, event) {
+		return false
+	}
+	ue.Log.Infoln("Handling event:", event)
+
+	handled, err := runEventHook(ue, msg)
+	if err != nil {
+		ue.Log.Errorln("Event hook failed on event:", event, "Error:", err)
+		msg := &common.UeMessage{}
+		msg.Error = err
+		msg.Event = common.ERROR_EVENT
+		HandleErrorEvent(ue, msg)
+		return true
+	}
+	if handled {
+		return false
+	}
+
+	switch event {
+	case common.REG_REQUEST_EVENT:
+		err = HandleRegRequestEvent(ue, msg)
+	case common.REG_REJECT_EVENT:
+		err = HandleRegRejectEvent(ue, msg)
+	case common.AUTH_REQUEST_EVENT:
+		err = HandleAuthRequestEvent(ue, msg)
+	case common.AUTH_RESPONSE_EVENT:
+		err = HandleAuthResponseEvent(ue, msg)
+	case common.AUTH_FAILURE_EVENT:
+		err = HandleAuthFailureEvent(ue, msg)
+	case common.AUTH_REJECT_EVENT:
+		err = HandleAuthRejectEvent(ue, msg)
+	case common.SEC_MOD_COMMAND_EVENT:
+		err = HandleSecModCommandEvent(ue, msg)
+	case common.SEC_MOD_COMPLETE_EVENT:
+		err = HandleSecModCompleteEvent(ue, msg)
+	case common.SEC_MOD_REJECT_EVENT:
+		err = HandleSecModRejectEvent(ue, msg)
+	case common.REG_ACCEPT_EVENT:
+		err = HandleRegAcceptEvent(ue, msg)
+	case common.REG_COMPLETE_EVENT:
+		err = HandleRegCompleteEvent(ue, msg)
+	case common.DEREG_REQUEST_UE_ORIG_EVENT:
+		err = HandleDeregRequestEvent(ue, msg)
+	case common.DEREG_ACCEPT_UE_ORIG_EVENT:
+		err = HandleDeregAcceptEvent(ue, msg)
+	case common.PDU_SESS_EST_REQUEST_EVENT:
+		err = HandlePduSessEstRequestEvent(ue, msg)
+	case common.PDU_SESS_REL_REQUEST_EVENT:
+		err = HandlePduSessReleaseRequestEvent(ue, msg)
+	case common.PDU_SESS_REL_COMMAND_EVENT:
+		err = HandlePduSessReleaseCommandEvent(ue, msg)
+	case common.PDU_SESS_EST_ACCEPT_EVENT:
+		err = HandlePduSessEstAcceptEvent(ue, msg)
+	case common.PDU_SESS_EST_REJECT_EVENT:
+		err = HandlePduSessEstRejectEvent(ue, msg)
+	case common.PDU_SESS_REL_COMPLETE_EVENT:
+		err = HandlePduSessReleaseCompleteEvent(ue, msg)
+	case common.PDU_SESS_MOD_COMMAND_EVENT:
+		err = HandlePduSessModCommandEvent(ue, msg)
+	case common.PDU_SESS_MOD_COMPLETE_EVENT:
+		err = HandlePduSessModCompleteEvent(ue, msg)
+	case common.DL_INFO_TRANSFER_EVENT:
+		err = HandleDlInfoTransferEvent(ue, msg)
+	case common.UL_NAS_TRANSPORT_EVENT:
+		err = HandleUlNasTransportEvent(ue, msg)
+	case common.DATA_BEARER_SETUP_REQUEST_EVENT:
+		err = HandleDataBearerSetupRequestEvent(ue, msg)
+	case common.DATA_BEARER_SETUP_RESPONSE_EVENT:
+		err = HandleDataBearerSetupResponseEvent(ue, msg)
+	case common.DATA_BEARER_RELEASE_REQUEST_EVENT:
+		err = HandleDataBearerReleaseRequestEvent(ue, msg)
+	case common.DATA_BEARER_MODIFY_EVENT:
+		err = HandleDataBearerModifyEvent(ue, msg)
+	case common.DATA_PKT_GEN_SUCCESS_EVENT:
+		err = HandleDataPktGenSuccessEvent(ue, msg)
+	case common.DATA_PKT_GEN_FAILURE_EVENT:
+		err = HandleDataPktGenFailureEvent(ue, msg)
+	case common.MO_SMS_REQUEST_EVENT, common.SMS_UL_TRANSPORT_EVENT:
+		err = HandleSmsUlTransportEvent(ue, msg)
+	case common.NAS_DATA_PATH_SETUP_EVENT:
+		err = HandleNasDataPathSetupEvent(ue, msg)
+	case common.NAS_DATA_UL_TRANSPORT_EVENT:
+		err = HandleNasDataUlTransportEvent(ue, msg)
+	case common.MO_SMS_COMPLETE_EVENT:
+		err = HandleMoSmsCompleteEvent(ue, msg)
+	case common.MT_SMS_RECEIVED_EVENT:
+		err = HandleMtSmsReceivedEvent(ue, msg)
+	case common.NSSAA_COMPLETE_EVENT, common.CONFIG_UPDATE_COMPLETE_EVENT:
+		err = HandleNssaaUlMessageEvent(ue, msg)
+	case common.NSSAA_RESULT_EVENT:
+		err = HandleNssaaResultEvent(ue, msg)
+	case common.CONFIG_UPDATE_COMMAND_EVENT:
+		err = HandleConfigUpdateCommandEvent(ue, msg)
+	case common.SERVICE_REQUEST_EVENT:
+		err = HandleServiceRequestEvent(ue, msg)
+	case common.SERVICE_ACCEPT_EVENT:
+		err = HandleServiceAcceptEvent(ue, msg)
+	case common.PAGING_EVENT:
+		err = HandlePagingEvent(ue, msg)
+	case common.PROFILE_START_EVENT:
+		err = HandleProfileStartEvent(ue, msg)
+	case common.EXECUTE_PROCEDURE_EVENT:
+		err = HandleExecuteProcedureEvent(ue, msg)
+	case common.SHUTDOWN_EVENT:
+		err = HandleShutdownEvent(ue, msg)
+	case common.THINK_TIME_EXPIRY_EVENT:
+		err = HandleThinkTimeExpiryEvent(ue, msg)
+	case common.CONNECTION_RELEASE_REQUEST_EVENT:
+		err = HandleConnectionReleaseRequestEvent(ue, msg)
+	case common.RRC_INACTIVE_TRANSITION_REPORT_EVENT:
+		err = HandleRrcInactiveTransitionReportEvent(ue, msg)
+	case common.DEREG_REQUEST_UE_TERM_EVENT:
+		err = HandleNwDeregRequestEvent(ue, msg)
+	case common.DEREG_ACCEPT_UE_TERM_EVENT:
+		err = HandleNwDeregAcceptEvent(ue, msg)
+	case common.NAS_TIMER_EXPIRY_EVENT:
+		err = HandleNasTimerExpiryEvent(ue, msg)
+	case common.MOBILITY_STEP_EVENT:
+		err = HandleMobilityStepEvent(ue, msg)
+	case common.GNB_RESTART_COMPLETE_EVENT:
+		err = HandleGnbRestartCompleteEvent(ue, msg)
+	case common.RETRY_PROCEDURE_EVENT:
+		err = HandleRetryProcedureEvent(ue, msg)
+	case common.STEP_DELAY_EXPIRY_EVENT:
+		err = HandleStepDelayExpiryEvent(ue, msg)
+	case common.HANDOVER_SWITCH_EVENT:
+		err = HandleHandoverSwitchEvent(ue, msg)
+	case common.HANDOVER_COMPLETE_EVENT:
+		err = HandleHandoverCompleteEvent(ue, msg)
+	case common.HANDOVER_FAILURE_EVENT:
+		err = HandleHandoverFailureEvent(ue, msg)
+	case common.HANDOVER_ABORTED_EVENT:
+		err = HandleHandoverAbortedEvent(ue, msg)
+	case common.ERROR_EVENT:
+		HandleErrorEvent(ue, msg)
+		return true
+	case common.QUIT_EVENT:
+		HandleQuitEvent(ue, msg)
+		return true
+	default:
+		ue.Log.Warnln("Event:", event, "is not supported")
 	}
 
-	return
+	if err != nil && retryProcedure(ue, err) {
+		return false
+	}
+	if err != nil {
+		ue.Log.Errorln("Failed to handle event:", event, "Error:", err)
+		msg := &common.UeMessage{}
+		msg.Error = err
+		msg.Event = common.ERROR_EVENT
+		HandleErrorEvent(ue, msg)
+		return true
+	}
+	return false
 }
 
 func SendToRealUe(ue *simuectx.SimUe, msg common.InterfaceMessage) {
@@ -149,12 +281,29 @@ func SendToGnbUe(ue *simuectx.SimUe, msg common.InterfaceMessage) {
 }
 
 func SendToProfile(ue *simuectx.SimUe, event common.EventType, errMsg error) {
+	if event == common.PROFILE_PASS_EVENT {
+		err := checkCallFlow(ue)
+		if err != nil {
+			ue.Log.Errorln(err)
+			event, errMsg = common.PROFILE_FAIL_EVENT, err
+		}
+	}
+
 	ue.Log.Traceln("Sending", event, "to Profile routine")
 	msg := &common.ProfileMessage{}
 	msg.Event = event
 	msg.Supi = ue.Supi
 	msg.Proc = ue.Procedure
 	msg.Error = errMsg
+	if ue.DataStats.UlPkts != 0 {
+		stats := ue.DataStats
+		msg.DataStats = &stats
+	}
+	msg.NwPduSessMods = ue.NwPduSessMods
+	msg.NwPduSessRels = ue.NwPduSessRels
+	msg.StageTimes = ue.StageTimes
+	msg.Retries = ue.Retries
+	msg.PagingTimes = ue.PagingTimes
 	ue.WriteProfileChan <- msg
 	ue.Log.Traceln("Sent ", event, "to Profile routine")
 }
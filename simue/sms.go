@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// HandleSmsUlTransportEvent sends the SMS message generated by RealUe to the
+// network
+func HandleSmsUlTransportEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	msg := intfcMsg.(*common.UuMessage)
+	msg.Event = common.UL_INFO_TRANSFER_EVENT
+	SendToGnbUe(ue, msg)
+	return nil
+}
+
+func HandleMoSmsCompleteEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	ue.MoSmsComplete = true
+	checkSmsComplete(ue)
+	return nil
+}
+
+// HandleMtSmsReceivedEvent counts the mobile terminated SMSs, which may also
+// be received outside the SMS procedure
+func HandleMtSmsReceivedEvent(ue *simuectx.SimUe,
+	intfcMsg common.InterfaceMessage) (err error) {
+
+	ue.MtSmsReceived++
+	checkSmsComplete(ue)
+	return nil
+}
+
+// checkSmsComplete moves to the next procedure once the mobile originated SMS
+// is acknowledged and the expected mobile terminated SMSs are received
+func checkSmsComplete(ue *simuectx.SimUe) {
+	if ue.Procedure != common.SMS_PROCEDURE || !ue.MoSmsComplete {
+		return
+	}
+	var expected int
+	if ue.ProfileCtx.Sms != nil {
+		expected = ue.ProfileCtx.Sms.MtSmsCount
+	}
+	if ue.MtSmsReceived < expected {
+		ue.Log.Infoln("Waiting for MT SMS, received:", ue.MtSmsReceived,
+			"expected:", expected)
+		return
+	}
+	ue.Log.Infoln("SMS procedure complete")
+	ChangeProcedure(ue)
+}
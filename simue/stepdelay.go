@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"time"
+
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// startProcedure starts the procedure following a completed one, once the
+// step delay or the wait configured for the procedure expires. The events
+// from the network are handled as usual while the UE waits, letting the
+// timers of the core, such as the inactivity timers, expire. The procedures
+// follow each other with no wait in the lightweight mode
+func startProcedure(ue *simuectx.SimUe) {
+	delay := ue.ProfileCtx.GetStepDelay(ue.Procedure, ue.ScenarioStep)
+	if delay == 0 || ue.ProfileCtx.Lightweight {
+		HandleProcedure(ue)
+		return
+	}
+
+	ue.Log.Infof("Waiting %v before %v", delay, ue.Procedure)
+	readChan := ue.ReadChan
+	ue.StepDelayTimer = time.AfterFunc(delay, func() {
+		msg := &common.DefaultMessage{}
+		msg.Event = common.STEP_DELAY_EXPIRY_EVENT
+		readChan <- msg
+	})
+}
+
+// HandleStepDelayExpiryEvent starts the procedure once the wait expires
+func HandleStepDelayExpiryEvent(ue *simuectx.SimUe,
+	msg common.InterfaceMessage) (err error) {
+
+	if ue.StepDelayTimer == nil {
+		return nil
+	}
+	ue.StepDelayTimer = nil
+	HandleProcedure(ue)
+	return nil
+}
+
+// stopStepDelay stops the wait before the next procedure, if running
+func stopStepDelay(ue *simuectx.SimUe) {
+	if ue.StepDelayTimer != nil {
+		ue.StepDelayTimer.Stop()
+		ue.StepDelayTimer = nil
+	}
+}
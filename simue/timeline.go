@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/omec-project/gnbsim/common"
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// Formats in which the timelines are exported
+const (
+	TIMELINE_FORMAT_JSON     = "json"
+	TIMELINE_FORMAT_PLANTUML = "plantuml"
+)
+
+// ueTimelines holds the timelines of the UEs by SUPI. They are retained once
+// the UEs terminate, so that the failed UEs can be analysed after the run.
+// The timeline of a UE executed again replaces the previous one
+var ueTimelines = struct {
+	sync.Mutex
+	timelines map[string]*common.Timeline
+}{timelines: make(map[string]*common.Timeline)}
+
+// UeTimeline is the exported timeline of a UE
+type UeTimeline struct {
+	Supi    string                 `json:"supi"`
+	Dropped uint                   `json:"dropped,omitempty"`
+	Entries []common.TimelineEntry `json:"entries"`
+}
+
+func addUeTimeline(simUe *simuectx.SimUe) {
+	if simUe.RealUe.Timeline == nil {
+		return
+	}
+	ueTimelines.Lock()
+	defer ueTimelines.Unlock()
+	ueTimelines.timelines[simUe.Supi] = simUe.RealUe.Timeline
+}
+
+// GetUeTimelines returns the timelines of the provided UEs ordered by SUPI,
+// of all the recorded UEs when no SUPI is provided. The UEs with no timeline
+// are skipped
+func GetUeTimelines(supis []string) []*UeTimeline {
+	ueTimelines.Lock()
+	if len(supis) == 0 {
+		for supi := range ueTimelines.timelines {
+			supis = append(supis, supi)
+		}
+	}
+	timelines := make(map[string]*common.Timeline)
+	for _, supi := range supis {
+		if timeline, ok := ueTimelines.timelines[supi]; ok {
+			timelines[supi] = timeline
+		}
+	}
+	ueTimelines.Unlock()
+
+	result := []*UeTimeline{}
+	for supi, timeline := range timelines {
+		entries, dropped := timeline.GetEntries()
+		result = append(result, &UeTimeline{
+			Supi:    supi,
+			Dropped: dropped,
+			Entries: entries,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Supi < result[j].Supi
+	})
+	return result
+}
+
+// GetTimelinePlantUml renders the timelines as PlantUML sequence diagrams,
+// one diagram per UE. NAS messages are drawn between the UE and the AMF, NGAP
+// messages between the gNB and the AMF
+func GetTimelinePlantUml(timelines []*UeTimeline) string {
+	var b strings.Builder
+	for _, timeline := range timelines {
+		fmt.Fprintf(&b, "@startuml\ntitle %v\n", timeline.Supi)
+		b.WriteString("participant UE\nparticipant gNB\nparticipant AMF\n")
+		if timeline.Dropped != 0 {
+			fmt.Fprintf(&b, "note over UE, AMF : %v earlier messages dropped\n",
+				timeline.Dropped)
+		}
+		for _, entry := range timeline.Entries {
+			from, to := "UE", "AMF"
+			if entry.Protocol == common.TIMELINE_PROTOCOL_NGAP {
+				from = "gNB"
+			}
+			if entry.Direction == common.TIMELINE_DOWNLINK {
+				from, to = to, from
+			}
+			fmt.Fprintf(&b, "%v -> %v : [%v] %v %v (%v bytes)\n", from, to,
+				entry.Time.Format("15:04:05.000"), entry.Protocol, entry.Message,
+				entry.Size)
+		}
+		b.WriteString("@enduml\n")
+	}
+	return b.String()
+}
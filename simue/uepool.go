@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package simue
+
+import (
+	"sync"
+
+	simuectx "github.com/omec-project/gnbsim/simue/context"
+)
+
+// uePools holds the named pools of SimUes which remain connected once their
+// profile is complete, so that later profiles can execute procedures on the
+// same UEs instead of creating new ones
+var uePools = struct {
+	sync.Mutex
+	pools map[string][]*simuectx.SimUe
+}{pools: make(map[string][]*simuectx.SimUe)}
+
+// AddToUePool makes the SimUe available to the profiles using the named pool
+func AddToUePool(name string, simUe *simuectx.SimUe) {
+	uePools.Lock()
+	defer uePools.Unlock()
+	uePools.pools[name] = append(uePools.pools[name], simUe)
+}
+
+// AcquireFromUePool removes up to count SimUes from the named pool, all of
+// them when count is 0, and returns them. The SimUes are owned by the caller
+// until they are added back to a pool
+func AcquireFromUePool(name string, count int) []*simuectx.SimUe {
+	uePools.Lock()
+	defer uePools.Unlock()
+
+	pool := uePools.pools[name]
+	if count == 0 || count > len(pool) {
+		count = len(pool)
+	}
+	simUes := pool[:count:count]
+	uePools.pools[name] = pool[count:]
+	return simUes
+}
+
+// removeFromUePools removes a terminated SimUe from any pool it belongs to
+func removeFromUePools(simUe *simuectx.SimUe) {
+	uePools.Lock()
+	defer uePools.Unlock()
+
+	for name, pool := range uePools.pools {
+		for i, ue := range pool {
+			if ue == simUe {
+				uePools.pools[name] = append(pool[:i:i], pool[i+1:]...)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omec-project/gnbsim/logger"
+)
+
+const (
+	// Interval at which the snapshots are recorded in the history
+	SAMPLE_INTERVAL time.Duration = time.Second
+
+	// Number of snapshots retained in the history, an hour worth of samples
+	HISTORY_LENGTH int = 3600
+
+	// Prefix of the metrics giving the number of UEs in each state
+	UES_PER_STATE_PREFIX string = "uesPerState."
+
+	// Prefixes of the metrics giving the number of UEs carrying a tag which
+	// passed and failed their profile
+	UES_PASSED_PER_TAG_PREFIX string = "uesPassedPerTag."
+	UES_FAILED_PER_TAG_PREFIX string = "uesFailedPerTag."
+)
+
+// Metrics served to Grafana, in addition to the number of UEs per state
+var metrics = []string{
+	"activeUes",
+	"proceduresPerSec",
+	"failuresLastMinute",
+	"totalProcedures",
+	"totalFailures",
+}
+
+// history holds the recent snapshots, in the order of recording
+var history = struct {
+	sync.Mutex
+	snapshots []*Snapshot
+}{}
+
+// Request and response of the Grafana JSON datasource query
+type queryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+	} `json:"targets"`
+}
+
+type queryResponse struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// StartServer records the snapshots of the run and serves them on the
+// provided address. The current snapshot is served as JSON on /stats, while
+// /search and /query implement the Grafana JSON datasource
+func StartServer(addr string) error {
+	go recordSnapshots()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleIndex)
+	mux.HandleFunc("/stats", handleStats)
+	mux.HandleFunc("/search", handleSearch)
+	mux.HandleFunc("/query", handleQuery)
+
+	logger.HttpLog.Infoln("Starting stats server on", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func recordSnapshots() {
+	ticker := time.NewTicker(SAMPLE_INTERVAL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		snapshot := GetSnapshot()
+		history.Lock()
+		history.snapshots = append(history.snapshots, snapshot)
+		if len(history.snapshots) > HISTORY_LENGTH {
+			history.snapshots = history.snapshots[1:]
+		}
+		history.Unlock()
+	}
+}
+
+// handleIndex lets Grafana test the datasource
+func handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, GetSnapshot())
+}
+
+// handleSearch returns the names of the metrics which may be queried
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	targets := append([]string{}, metrics...)
+	for _, state := range GetUeStates() {
+		targets = append(targets, UES_PER_STATE_PREFIX+state)
+	}
+	for _, tag := range GetTags() {
+		targets = append(targets, UES_PASSED_PER_TAG_PREFIX+tag,
+			UES_FAILED_PER_TAG_PREFIX+tag)
+	}
+	writeJson(w, targets)
+}
+
+// handleQuery returns the time series of the requested metrics within the
+// requested time range
+func handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req queryRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	history.Lock()
+	var snapshots []*Snapshot
+	for _, snapshot := range history.snapshots {
+		if !req.Range.From.IsZero() && snapshot.Timestamp.Before(req.Range.From) {
+			continue
+		}
+		if !req.Range.To.IsZero() && snapshot.Timestamp.After(req.Range.To) {
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	history.Unlock()
+
+	rsp := make([]queryResponse, 0, len(req.Targets))
+	for _, target := range req.Targets {
+		series := queryResponse{
+			Target:     target.Target,
+			Datapoints: make([][2]float64, 0, len(snapshots)),
+		}
+		for _, snapshot := range snapshots {
+			value, ok := getMetric(snapshot, target.Target)
+			if !ok {
+				break
+			}
+			ts := float64(snapshot.Timestamp.UnixNano() / int64(time.Millisecond))
+			series.Datapoints = append(series.Datapoints, [2]float64{value, ts})
+		}
+		rsp = append(rsp, series)
+	}
+	writeJson(w, rsp)
+}
+
+// getMetric returns the value of the named metric in the snapshot
+func getMetric(snapshot *Snapshot, name string) (float64, bool) {
+	if strings.HasPrefix(name, UES_PER_STATE_PREFIX) {
+		state := strings.TrimPrefix(name, UES_PER_STATE_PREFIX)
+		return float64(snapshot.UesPerState[state]), true
+	}
+	if strings.HasPrefix(name, UES_PASSED_PER_TAG_PREFIX) {
+		tag := strings.TrimPrefix(name, UES_PASSED_PER_TAG_PREFIX)
+		return float64(snapshot.UesPassedPerTag[tag]), true
+	}
+	if strings.HasPrefix(name, UES_FAILED_PER_TAG_PREFIX) {
+		tag := strings.TrimPrefix(name, UES_FAILED_PER_TAG_PREFIX)
+		return float64(snapshot.UesFailedPerTag[tag]), true
+	}
+
+	switch name {
+	case "activeUes":
+		return float64(snapshot.ActiveUes), true
+	case "proceduresPerSec":
+		return snapshot.ProceduresPerSec, true
+	case "failuresLastMinute":
+		return float64(snapshot.FailuresLastMinute), true
+	case "totalProcedures":
+		return float64(snapshot.TotalProcedures), true
+	case "totalFailures":
+		return float64(snapshot.TotalFailures), true
+	}
+	return 0, false
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		logger.HttpLog.Errorln("Failed to encode response:", err)
+	}
+}
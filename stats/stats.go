@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Window in seconds over which the procedure rate is averaged
+	RATE_WINDOW int64 = 10
+
+	// Window in seconds over which the failures are counted
+	FAILURE_WINDOW int64 = 60
+
+	// State of a UE waiting for a profile to be started, and of a UE which
+	// has completed its profile but is still active, e.g. kept in a UE pool.
+	// UEs executing a profile are in the state of the current procedure
+	UE_STATE_WAITING          string = "WAITING"
+	UE_STATE_PROFILE_COMPLETE string = "PROFILE-COMPLETE"
+)
+
+// tagCounts counts the UEs carrying a tag which completed their profile
+type tagCounts struct {
+	passed uint64
+	failed uint64
+}
+
+// counterBucket counts the events which occurred within a second
+type counterBucket struct {
+	sec       int64
+	completed uint64
+	failed    uint64
+}
+
+// collector tracks the state of each active UE and counts the completed and
+// failed procedures in per second buckets, covering the longest window
+var collector = struct {
+	sync.Mutex
+	ueStates map[string]string
+	buckets  [FAILURE_WINDOW]counterBucket
+
+	totalCompleted uint64
+	totalFailed    uint64
+
+	// Results of the tagged UEs across the profiles, keyed by tag
+	tags map[string]*tagCounts
+}{ueStates: make(map[string]string), tags: make(map[string]*tagCounts)}
+
+// Snapshot is the current state of the run
+type Snapshot struct {
+	Timestamp          time.Time         `json:"timestamp"`
+	ActiveUes          int               `json:"activeUes"`
+	UesPerState        map[string]int    `json:"uesPerState"`
+	ProceduresPerSec   float64           `json:"proceduresPerSec"`
+	FailuresLastMinute uint64            `json:"failuresLastMinute"`
+	TotalProcedures    uint64            `json:"totalProcedures"`
+	TotalFailures      uint64            `json:"totalFailures"`
+	UesPassedPerTag    map[string]uint64 `json:"uesPassedPerTag,omitempty"`
+	UesFailedPerTag    map[string]uint64 `json:"uesFailedPerTag,omitempty"`
+}
+
+// SetUeState records the state of the UE, which also marks it active
+func SetUeState(supi, state string) {
+	collector.Lock()
+	defer collector.Unlock()
+	collector.ueStates[supi] = state
+}
+
+// RemoveUe stops tracking the UE once it is terminated
+func RemoveUe(supi string) {
+	collector.Lock()
+	defer collector.Unlock()
+	delete(collector.ueStates, supi)
+}
+
+// RecordProcedureComplete counts a procedure completed by a UE
+func RecordProcedureComplete() {
+	collector.Lock()
+	defer collector.Unlock()
+	getBucket(time.Now().Unix()).completed++
+	collector.totalCompleted++
+}
+
+// RecordProcedureFailure counts a procedure failed by a UE
+func RecordProcedureFailure() {
+	collector.Lock()
+	defer collector.Unlock()
+	getBucket(time.Now().Unix()).failed++
+	collector.totalFailed++
+}
+
+// RecordTagResult counts the result of a UE which completed its profile
+// against each of its tags
+func RecordTagResult(tags []string, passed bool) {
+	collector.Lock()
+	defer collector.Unlock()
+	for _, tag := range tags {
+		counts, ok := collector.tags[tag]
+		if !ok {
+			counts = &tagCounts{}
+			collector.tags[tag] = counts
+		}
+		if passed {
+			counts.passed++
+		} else {
+			counts.failed++
+		}
+	}
+}
+
+// GetSnapshot returns the current state of the run
+func GetSnapshot() *Snapshot {
+	collector.Lock()
+	defer collector.Unlock()
+
+	now := time.Now()
+	snapshot := &Snapshot{
+		Timestamp:       now,
+		ActiveUes:       len(collector.ueStates),
+		UesPerState:     make(map[string]int),
+		TotalProcedures: collector.totalCompleted,
+		TotalFailures:   collector.totalFailed,
+	}
+	for _, state := range collector.ueStates {
+		snapshot.UesPerState[state]++
+	}
+	if len(collector.tags) != 0 {
+		snapshot.UesPassedPerTag = make(map[string]uint64, len(collector.tags))
+		snapshot.UesFailedPerTag = make(map[string]uint64, len(collector.tags))
+		for tag, counts := range collector.tags {
+			snapshot.UesPassedPerTag[tag] = counts.passed
+			snapshot.UesFailedPerTag[tag] = counts.failed
+		}
+	}
+
+	// Current second is excluded from the rate as it is still in progress
+	sec := now.Unix()
+	var completed uint64
+	for _, bucket := range collector.buckets {
+		age := sec - bucket.sec
+		if age < FAILURE_WINDOW {
+			snapshot.FailuresLastMinute += bucket.failed
+		}
+		if age > 0 && age <= RATE_WINDOW {
+			completed += bucket.completed
+		}
+	}
+	snapshot.ProceduresPerSec = float64(completed) / float64(RATE_WINDOW)
+	return snapshot
+}
+
+// GetUeStates returns the sorted list of the states of the active UEs
+func GetUeStates() []string {
+	collector.Lock()
+	defer collector.Unlock()
+
+	seen := make(map[string]bool)
+	var states []string
+	for _, state := range collector.ueStates {
+		if !seen[state] {
+			seen[state] = true
+			states = append(states, state)
+		}
+	}
+	sort.Strings(states)
+	return states
+}
+
+// GetTags returns the sorted list of the tags of the UEs which completed
+// their profile
+func GetTags() []string {
+	collector.Lock()
+	defer collector.Unlock()
+
+	tags := make([]string, 0, len(collector.tags))
+	for tag := range collector.tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// getBucket returns the bucket of the provided second, resetting the bucket
+// if it holds the counts of an earlier second. Expected to be called with the
+// collector locked
+func getBucket(sec int64) *counterBucket {
+	bucket := &collector.buckets[sec%FAILURE_WINDOW]
+	if bucket.sec != sec {
+		*bucket = counterBucket{sec: sec}
+	}
+	return bucket
+}
@@ -9,6 +9,7 @@ type Transport interface {
 	ConnectToPeer(peer TransportPeer) error
 	SendToPeerBlock(peer TransportPeer, pkt []byte) ([]byte, error)
 	SendToPeer(peer TransportPeer, pkt []byte) (err error)
+	SendUeAssociatedToPeer(peer TransportPeer, ueId int64, pkt []byte) (err error)
 	ReceiveFromPeer(peer TransportPeer)
 	CheckTransportParam(peer TransportPeer, pkt []byte) error
 }
@@ -43,3 +43,97 @@ func BuildServiceRequest(serviceType uint8) *nas.Message {
 	m.GmmMessage.ServiceRequest = serviceRequest
 	return m
 }
+
+func BuildRegistrationRequest(registrationType uint8,
+	mobileIdentity nasType.MobileIdentity5GS, followOnRequest uint8) *nas.Message {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeRegistrationRequest)
+
+	registrationRequest := nasMessage.NewRegistrationRequest(0)
+	registrationRequest.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	registrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	registrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0x00)
+	registrationRequest.RegistrationRequestMessageIdentity.SetMessageType(nas.MsgTypeRegistrationRequest)
+	registrationRequest.NgksiAndRegistrationType5GS.SetTSC(nasMessage.TypeOfSecurityContextFlagNative)
+	registrationRequest.NgksiAndRegistrationType5GS.SetNasKeySetIdentifiler(0x7)
+	registrationRequest.NgksiAndRegistrationType5GS.SetFOR(followOnRequest)
+	registrationRequest.NgksiAndRegistrationType5GS.SetRegistrationType5GS(registrationType)
+	registrationRequest.MobileIdentity5GS = mobileIdentity
+
+	m.GmmMessage.RegistrationRequest = registrationRequest
+	return m
+}
+
+// BuildSecurityModeComplete returns the Security Mode Complete without the
+// optional IEs
+func BuildSecurityModeComplete() *nas.Message {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeSecurityModeComplete)
+
+	securityModeComplete := nasMessage.NewSecurityModeComplete(0)
+	securityModeComplete.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	securityModeComplete.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	securityModeComplete.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	securityModeComplete.SecurityModeCompleteMessageIdentity.SetMessageType(nas.MsgTypeSecurityModeComplete)
+
+	m.GmmMessage.SecurityModeComplete = securityModeComplete
+	return m
+}
+
+// BuildUlNasTransport returns the UL NAS Transport carrying the payload of the
+// provided payload container type, without the optional IEs
+func BuildUlNasTransport(payloadContainerType uint8, payload []byte) *nas.Message {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeULNASTransport)
+
+	ulNasTransport := nasMessage.NewULNASTransport(0)
+	ulNasTransport.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	ulNasTransport.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	ulNasTransport.SetMessageType(nas.MsgTypeULNASTransport)
+	ulNasTransport.SpareHalfOctetAndPayloadContainerType.SetPayloadContainerType(payloadContainerType)
+	ulNasTransport.PayloadContainer.SetLen(uint16(len(payload)))
+	ulNasTransport.PayloadContainer.SetPayloadContainerContents(payload)
+
+	m.GmmMessage.ULNASTransport = ulNasTransport
+	return m
+}
+
+// BuildPduSessionEstablishmentRequest returns the PDU Session Establishment
+// Request for an IPv4 PDU session, carrying the provided protocol
+// configuration options
+func BuildPduSessionEstablishmentRequest(pduSessionId uint8, pco []byte) *nas.Message {
+
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionEstablishmentRequest)
+
+	pduSessEstRequest := nasMessage.NewPDUSessionEstablishmentRequest(0)
+	pduSessEstRequest.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	pduSessEstRequest.SetMessageType(nas.MsgTypePDUSessionEstablishmentRequest)
+	pduSessEstRequest.PDUSessionID.SetPDUSessionID(pduSessionId)
+	pduSessEstRequest.PTI.SetPTI(0x01)
+	pduSessEstRequest.IntegrityProtectionMaximumDataRate.
+		SetMaximumDataRatePerUEForUserPlaneIntegrityProtectionForDownLink(0xff)
+	pduSessEstRequest.IntegrityProtectionMaximumDataRate.
+		SetMaximumDataRatePerUEForUserPlaneIntegrityProtectionForUpLink(0xff)
+
+	pduSessEstRequest.PDUSessionType = nasType.NewPDUSessionType(
+		nasMessage.PDUSessionEstablishmentRequestPDUSessionTypeType)
+	pduSessEstRequest.PDUSessionType.SetPDUSessionTypeValue(nasMessage.PDUSessionTypeIPv4)
+
+	pduSessEstRequest.ExtendedProtocolConfigurationOptions =
+		nasType.NewExtendedProtocolConfigurationOptions(
+			nasMessage.PDUSessionEstablishmentRequestExtendedProtocolConfigurationOptionsType)
+	pduSessEstRequest.ExtendedProtocolConfigurationOptions.SetLen(uint16(len(pco)))
+	pduSessEstRequest.ExtendedProtocolConfigurationOptions.
+		SetExtendedProtocolConfigurationOptionsContents(pco)
+
+	m.GsmMessage.PDUSessionEstablishmentRequest = pduSessEstRequest
+	return m
+}
@@ -744,6 +744,60 @@ func BuildUplinkNasTransport(amfUeNgapID, ranUeNgapID int64, nasPdu []byte) (pdu
 	return pdu
 }
 
+func BuildDownlinkNasTransport(amfUeNgapID, ranUeNgapID int64, nasPdu []byte) (pdu ngapType.NGAPPDU) {
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeDownlinkNASTransport
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentDownlinkNASTransport
+	initiatingMessage.Value.DownlinkNASTransport = new(ngapType.DownlinkNASTransport)
+
+	downlinkNasTransport := initiatingMessage.Value.DownlinkNASTransport
+	downlinkNasTransportIEs := &downlinkNasTransport.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.DownlinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.DownlinkNASTransportIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+
+	aMFUENGAPID := ie.Value.AMFUENGAPID
+	aMFUENGAPID.Value = amfUeNgapID
+
+	downlinkNasTransportIEs.List = append(downlinkNasTransportIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.DownlinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.DownlinkNASTransportIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+
+	rANUENGAPID := ie.Value.RANUENGAPID
+	rANUENGAPID.Value = ranUeNgapID
+
+	downlinkNasTransportIEs.List = append(downlinkNasTransportIEs.List, ie)
+
+	// NAS-PDU
+	ie = ngapType.DownlinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNASPDU
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.DownlinkNASTransportIEsPresentNASPDU
+	ie.Value.NASPDU = new(ngapType.NASPDU)
+
+	nASPDU := ie.Value.NASPDU
+	nASPDU.Value = nasPdu
+
+	downlinkNasTransportIEs.List = append(downlinkNasTransportIEs.List, ie)
+
+	return pdu
+}
+
 func BuildInitialContextSetupResponse(pduSessions []*PduSession, amfUeNgapID, ranUeNgapID int64, ipv4 string,
 	pduSessionFailedList *ngapType.PDUSessionResourceFailedToSetupListCxtRes) (pdu ngapType.NGAPPDU) {
 
@@ -3250,7 +3304,7 @@ func BuildCellTrafficTrace(amfUeNgapID, ranUeNgapID int64) (pdu ngapType.NGAPPDU
 }
 
 func buildPDUSessionResourceSetupResponseTransfer(pduSession *PduSession,
-	ipv4 string) (data ngapType.PDUSessionResourceSetupResponseTransfer) {
+	n3Ip string) (data ngapType.PDUSessionResourceSetupResponseTransfer) {
 
 	// QoS Flow per TNL Information
 	qosFlowPerTNLInformation := &data.DLQosFlowPerTNLInformation
@@ -3263,7 +3317,7 @@ func buildPDUSessionResourceSetupResponseTransfer(pduSession *PduSession,
 	teidOct := make([]byte, 4)
 	binary.BigEndian.PutUint32(teidOct, pduSession.Teid)
 	upTransportLayerInformation.GTPTunnel.GTPTEID.Value = teidOct
-	upTransportLayerInformation.GTPTunnel.TransportLayerAddress = ngapConvert.IPAddressToNgap(ipv4, "")
+	upTransportLayerInformation.GTPTunnel.TransportLayerAddress = IpAddressToNgap(n3Ip)
 
 	// Associated QoS Flow List in QoS Flow per TNL Information
 	associatedQosFlowList := &qosFlowPerTNLInformation.AssociatedQosFlowList
@@ -3543,8 +3597,8 @@ func buildSourceToTargetTransparentTransfer(
 	return data
 }
 
-func GetPDUSessionResourceSetupResponseTransfer(pduSession *PduSession, ipv4 string) []byte {
-	data := buildPDUSessionResourceSetupResponseTransfer(pduSession, ipv4)
+func GetPDUSessionResourceSetupResponseTransfer(pduSession *PduSession, n3Ip string) []byte {
+	data := buildPDUSessionResourceSetupResponseTransfer(pduSession, n3Ip)
 	encodeData, err := aper.MarshalWithParams(data, "valueExt")
 	if err != nil {
 		fatal.Fatalf("aper MarshalWithParams error in GetPDUSessionResourceSetupResponseTransfer: %+v", err)
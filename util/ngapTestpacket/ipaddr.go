@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ngapTestpacket
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/omec-project/aper"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// Lengths in bits of the Transport Layer Address IE, as described in 38.414
+const (
+	TLA_IPV4_BIT_LEN      = 32
+	TLA_IPV6_BIT_LEN      = 128
+	TLA_IPV4_IPV6_BIT_LEN = 160
+)
+
+// IpAddressToNgap encodes the IPv4 or IPv6 address as the Transport Layer
+// Address IE
+func IpAddressToNgap(ip string) (addr ngapType.TransportLayerAddress) {
+	netIp := net.ParseIP(ip)
+	if netIp == nil {
+		return
+	}
+	if ipv4 := netIp.To4(); ipv4 != nil {
+		addr.Value = aper.BitString{
+			Bytes:     []byte(ipv4),
+			BitLength: TLA_IPV4_BIT_LEN,
+		}
+		return
+	}
+	addr.Value = aper.BitString{
+		Bytes:     []byte(netIp.To16()),
+		BitLength: TLA_IPV6_BIT_LEN,
+	}
+	return
+}
+
+// NgapToIpAddress decodes the Transport Layer Address IE. When the IE
+// carries both an IPv4 and an IPv6 address, the IPv6 address is returned if
+// preferIpv6 is set and the IPv4 address otherwise
+func NgapToIpAddress(addr ngapType.TransportLayerAddress, preferIpv6 bool) (string, error) {
+	b := addr.Value.Bytes
+	switch addr.Value.BitLength {
+	case TLA_IPV4_BIT_LEN:
+		if len(b) >= net.IPv4len {
+			return net.IP(b[:net.IPv4len]).String(), nil
+		}
+	case TLA_IPV6_BIT_LEN:
+		if len(b) >= net.IPv6len {
+			return net.IP(b[:net.IPv6len]).String(), nil
+		}
+	case TLA_IPV4_IPV6_BIT_LEN:
+		if len(b) >= net.IPv4len+net.IPv6len {
+			if preferIpv6 {
+				return net.IP(b[net.IPv4len : net.IPv4len+net.IPv6len]).String(), nil
+			}
+			return net.IP(b[:net.IPv4len]).String(), nil
+		}
+	default:
+		return "", fmt.Errorf("invalid transport layer address length:%v",
+			addr.Value.BitLength)
+	}
+	return "", fmt.Errorf("transport layer address too short, length:%v", len(b))
+}
@@ -23,7 +23,9 @@ const (
 	FLAG_OPTIONAL          uint8 = (FLAG_EXT_HEADER | FLAG_SEQ_NUM | FLAG_NPDU_NUM)
 
 	/* GTPv1 Message Types Spec 3GPP TS-29281 */
-	TYPE_GPDU uint8 = 0xff
+	TYPE_ECHO_REQUEST  uint8 = 0x01
+	TYPE_ECHO_RESPONSE uint8 = 0x02
+	TYPE_GPDU          uint8 = 0xff
 
 	/* GTPv1 IE Types Spec 3GPP TS-29281 */
 	TEID_DATA_IE      uint8 = 0x10
@@ -119,6 +121,12 @@ func BuildGTPv1Header(extHdrFlag bool, snFlag bool, nPduFlag bool,
 	return bb, nil
 }
 
+// BuildEchoRequest builds a GTP-U Echo Request with the provided sequence
+// number, used to check that the peer is reachable
+func BuildEchoRequest(sn uint16) ([]byte, error) {
+	return BuildGTPv1Header(false, true, false, 0, sn, 0, TYPE_ECHO_REQUEST, 0, 0)
+}
+
 func DecodeGTPv1Header(pkt []byte) (gtpPdu *GtpPdu, err error) {
 	gtpPdu = &GtpPdu{}
 	gtpPdu.Hdr = &GtpHdr{}
@@ -221,19 +229,28 @@ func DecodePduSessContainerExtHeader(pkt []uint8) (payload []uint8,
 	return
 }
 
+// PDU session container extension header of the uplink G-PDUs, which is the
+// same for all the packets
+var ulPduSessContainer = BuildPduSessContainerExtHeader(9)
+
 func BuildGpduMessage(payload []byte, teID uint32) ([]byte, error) {
-	pduSessContainer := BuildPduSessContainerExtHeader(9)
+	return AppendGpduMessage(nil, payload, teID)
+}
 
+// AppendGpduMessage appends the G-PDU carrying the payload to b, allowing the
+// caller to reuse its buffer across the packets
+func AppendGpduMessage(b []byte, payload []byte, teID uint32) ([]byte, error) {
 	/* UE needs to ensure its payload length value should not exceed 2 bytes */
-	payloadLen := uint16(len(payload) + len(pduSessContainer))
+	payloadLen := uint16(len(payload) + len(ulPduSessContainer))
 
-	b, err := BuildGTPv1Header(true, false, false,
+	hdr, err := BuildGTPv1Header(true, false, false,
 		PDU_SESS_CONTAINER_EXT_HEADER_TYPE, 0, 0, TYPE_GPDU, payloadLen, teID)
 	if err != nil {
 		return nil, err
 	}
 
-	b = append(b, pduSessContainer...)
+	b = append(b, hdr...)
+	b = append(b, ulPduSessContainer...)
 	b = append(b, payload...)
 	return b, nil
 }
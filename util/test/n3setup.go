@@ -5,16 +5,16 @@
 package test
 
 import (
-	"fmt"
 	"net"
+	"strconv"
 )
 
 func ConnectToUpf(enbIP, upfIP string, gnbPort, upfPort int) (*net.UDPConn, error) {
-	upfAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", upfIP, upfPort))
+	upfAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(upfIP, strconv.Itoa(upfPort)))
 	if err != nil {
 		return nil, err
 	}
-	gnbAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", enbIP, gnbPort))
+	gnbAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(enbIP, strconv.Itoa(gnbPort)))
 	if err != nil {
 		return nil, err
 	}
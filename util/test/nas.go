@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package test
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/omec-project/nas/nasMessage"
+)
+
+// gsmCauses maps the cause names accepted through configuration to the
+// corresponding 5GSM cause, TS 24.501 Section 9.11.4.2
+var gsmCauses = map[string]uint8{
+	"insufficient-resources":                       nasMessage.Cause5GSMInsufficientResources,
+	"missing-or-unknown-dnn":                       nasMessage.Cause5GSMMissingOrUnknownDNN,
+	"unknown-pdu-session-type":                     nasMessage.Cause5GSMUnknownPDUSessionType,
+	"user-authentication-or-authorization-failed":  nasMessage.Cause5GSMUserAuthenticationOrAuthorizationFailed,
+	"request-rejected-unspecified":                 nasMessage.Cause5GSMRequestRejectedUnspecified,
+	"service-option-temporarily-out-of-order":      nasMessage.Cause5GSMServiceOptionTemporarilyOutOfOrder,
+	"pti-already-in-use":                           nasMessage.Cause5GSMPTIAlreadyInUse,
+	"out-of-ladn-service-area":                     nasMessage.Cause5GSMOutOfLADNServiceArea,
+	"pdu-session-type-ipv4-only-allowed":           nasMessage.Cause5GSMPDUSessionTypeIPv4OnlyAllowed,
+	"pdu-session-type-ipv6-only-allowed":           nasMessage.Cause5GSMPDUSessionTypeIPv6OnlyAllowed,
+	"insufficient-resources-for-slice-and-dnn":     nasMessage.Cause5GSMInsufficientResourcesForSpecificSliceAndDNN,
+	"not-supported-ssc-mode":                       nasMessage.Cause5GSMNotSupportedSSCMode,
+	"insufficient-resources-for-slice":             nasMessage.Cause5GSMInsufficientResourcesForSpecificSlice,
+	"missing-or-unknown-dnn-in-slice":              nasMessage.Cause5GSMMissingOrUnknownDNNInASlice,
+	"invalid-pti-value":                            nasMessage.Cause5GSMInvalidPTIValue,
+	"semantically-incorrect-message":               nasMessage.Cause5GSMSemanticallyIncorrectMessage,
+	"invalid-mandatory-information":                nasMessage.Cause5GSMInvalidMandatoryInformation,
+	"message-type-non-existent-or-not-implemented": nasMessage.Cause5GSMMessageTypeNonExistentOrNotImplemented,
+	"protocol-error-unspecified":                   nasMessage.Cause5GSMProtocolErrorUnspecified,
+}
+
+// GetCause5GSMNames returns the sorted list of the supported 5GSM cause names
+func GetCause5GSMNames() []string {
+	var names []string
+	for name := range gsmCauses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetCause5GSM returns the 5GSM cause value corresponding to the provided
+// cause name
+func GetCause5GSM(name string) (uint8, error) {
+	cause, ok := gsmCauses[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported 5gsm cause: %v", name)
+	}
+	return cause, nil
+}
+
+// GetCause5GSMName returns the name of the provided 5GSM cause value, or the
+// value itself if the cause is not supported through configuration
+func GetCause5GSMName(cause uint8) string {
+	for name, value := range gsmCauses {
+		if value == cause {
+			return name
+		}
+	}
+	return fmt.Sprintf("%v", cause)
+}
+
+// gmmCauses maps the cause names accepted through configuration to the
+// corresponding 5GMM cause sent by the UE, TS 24.501 Section 9.11.3.2
+var gmmCauses = map[string]uint8{
+	"ue-security-capabilities-mismatch":            nasMessage.Cause5GMMUESecurityCapabilitiesMismatch,
+	"security-mode-rejected-unspecified":           nasMessage.Cause5GMMSecurityModeRejectedUnspecified,
+	"mac-failure":                                  nasMessage.Cause5GMMMACFailure,
+	"ngksi-already-in-use":                         nasMessage.Cause5GMMngKSIAlreadyInUse,
+	"semantically-incorrect-message":               nasMessage.Cause5GMMSemanticallyIncorrectMessage,
+	"invalid-mandatory-information":                nasMessage.Cause5GMMInvalidMandatoryInformation,
+	"message-type-non-existent-or-not-implemented": nasMessage.Cause5GMMMessageTypeNonExistentOrNotImplemented,
+	"protocol-error-unspecified":                   nasMessage.Cause5GMMProtocolErrorUnspecified,
+}
+
+// GetCause5GMM returns the 5GMM cause value corresponding to the provided
+// cause name
+func GetCause5GMM(name string) (uint8, error) {
+	cause, ok := gmmCauses[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported 5gmm cause: %v", name)
+	}
+	return cause, nil
+}
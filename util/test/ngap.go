@@ -6,6 +6,11 @@
 package test
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/omec-project/gnbsim/logger"
 
 	"github.com/omec-project/aper"
@@ -35,3 +40,117 @@ func PrintAndGetCause(cause *ngapType.Cause) (present int, value aper.Enumerated
 	}
 	return
 }
+
+type ngapCause struct {
+	present int
+	value   aper.Enumerated
+}
+
+// ngapCauses maps the cause names accepted through configuration to the
+// corresponding NGAP cause, TS 38.413 Section 9.3.1.2
+var ngapCauses = map[string]ngapCause{
+	"radio-link-failure": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentRadioConnectionWithUeLost},
+	"user-inactivity": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentUserInactivity},
+	"radio-resources-not-available": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentRadioResourcesNotAvailable},
+	"failure-in-radio-interface-procedure": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentFailureInRadioInterfaceProcedure},
+	"release-due-to-ngran-generated-reason": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentReleaseDueToNgranGeneratedReason},
+	"unknown-target-id": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentUnknownTargetID},
+	"handover-cancelled": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentHandoverCancelled},
+	"handover-desirable-for-radio-reason": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentHandoverDesirableForRadioReason},
+	"time-critical-handover": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentTimeCriticalHandover},
+	"resource-optimisation-handover": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentResourceOptimisationHandover},
+	"radio-network-unspecified": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentUnspecified},
+	"transport-resource-unavailable": {ngapType.CausePresentTransport,
+		ngapType.CauseTransportPresentTransportResourceUnavailable},
+	"normal-release": {ngapType.CausePresentNas,
+		ngapType.CauseNasPresentNormalRelease},
+	"hardware-failure": {ngapType.CausePresentMisc,
+		ngapType.CauseMiscPresentHardwareFailure},
+	"om-intervention": {ngapType.CausePresentMisc,
+		ngapType.CauseMiscPresentOmIntervention},
+	"misc-unspecified": {ngapType.CausePresentMisc,
+		ngapType.CauseMiscPresentUnspecified},
+}
+
+// ngapCauseGroups maps the cause group names to the NGAP cause group and the
+// highest value of the group. Any cause is accepted through configuration as
+// "<group>:<value>", such as "radio-network:16"
+var ngapCauseGroups = map[string]ngapCause{
+	"radio-network": {ngapType.CausePresentRadioNetwork,
+		ngapType.CauseRadioNetworkPresentReleaseDueToPreEmption},
+	"transport": {ngapType.CausePresentTransport,
+		ngapType.CauseTransportPresentUnspecified},
+	"nas": {ngapType.CausePresentNas,
+		ngapType.CauseNasPresentUnspecified},
+	"protocol": {ngapType.CausePresentProtocol,
+		ngapType.CauseProtocolPresentUnspecified},
+	"misc": {ngapType.CausePresentMisc,
+		ngapType.CauseMiscPresentUnspecified},
+}
+
+// GetNgapCauseNames returns the sorted list of the supported cause names
+func GetNgapCauseNames() []string {
+	var names []string
+	for name := range ngapCauses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetNgapCause returns the NGAP cause corresponding to the provided cause
+// name, or to the cause group and value provided as "<group>:<value>"
+func GetNgapCause(name string) (*ngapType.Cause, error) {
+	c, ok := ngapCauses[name]
+	if !ok {
+		var err error
+		c, err = parseNgapCause(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cause := &ngapType.Cause{Present: c.present}
+	switch c.present {
+	case ngapType.CausePresentRadioNetwork:
+		cause.RadioNetwork = &ngapType.CauseRadioNetwork{Value: c.value}
+	case ngapType.CausePresentTransport:
+		cause.Transport = &ngapType.CauseTransport{Value: c.value}
+	case ngapType.CausePresentNas:
+		cause.Nas = &ngapType.CauseNas{Value: c.value}
+	case ngapType.CausePresentProtocol:
+		cause.Protocol = &ngapType.CauseProtocol{Value: c.value}
+	case ngapType.CausePresentMisc:
+		cause.Misc = &ngapType.CauseMisc{Value: c.value}
+	}
+	return cause, nil
+}
+
+// parseNgapCause parses the cause provided as "<group>:<value>"
+func parseNgapCause(name string) (ngapCause, error) {
+	parts := strings.SplitN(name, ":", 2)
+	if len(parts) != 2 {
+		return ngapCause{}, fmt.Errorf("unsupported ngap cause: %v", name)
+	}
+	group, ok := ngapCauseGroups[parts[0]]
+	if !ok {
+		return ngapCause{}, fmt.Errorf("unsupported ngap cause group: %v", parts[0])
+	}
+	value, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil || aper.Enumerated(value) > group.value {
+		return ngapCause{}, fmt.Errorf("invalid ngap cause value: %v, valid range for %v is 0 to %v",
+			parts[1], parts[0], group.value)
+	}
+	return ngapCause{group.present, aper.Enumerated(value)}, nil
+}
@@ -5,8 +5,11 @@
 package test
 
 import (
+	"encoding/binary"
 	"fmt"
 	"net"
+	"syscall"
+	"unsafe"
 
 	"git.cs.nctu.edu.tw/calee/sctp"
 	"github.com/calee0219/fatal"
@@ -14,6 +17,77 @@ import (
 
 const NgapPPID uint32 = 0x3c000000
 
+// Linux SCTP socket options, include/uapi/linux/sctp.h
+const (
+	SCTP_RTOINFO          = 0
+	SCTP_PEER_ADDR_PARAMS = 9
+	SCTP_STATUS           = 14
+	SCTP_GET_ASSOC_STATS  = 112
+	SPP_HB_ENABLE         = 1
+
+	// struct sctp_status, the number of outbound streams, and the smoothed
+	// RTT and the RTO of the primary path are at the following offsets
+	SCTP_STATUS_LEN             = 176
+	SCTP_STATUS_OUTSTRMS_OFFSET = 18
+	SCTP_STATUS_SRTT_OFFSET     = 164
+	SCTP_STATUS_RTO_OFFSET      = 168
+
+	// struct sctp_assoc_stats, the maximum observed RTO and the count of the
+	// retransmitted chunks are at the following offsets
+	SCTP_ASSOC_STATS_LEN           = 256
+	SCTP_ASSOC_STATS_MAXRTO_OFFSET = 136
+	SCTP_ASSOC_STATS_RTX_OFFSET    = 176
+
+	// struct sctp_paddrparams is packed, the heartbeat interval and the
+	// flags are at the following offsets
+	SCTP_PADDRPARAMS_LEN       = 156
+	SCTP_PADDRPARAMS_HB_OFFSET = 132
+	SCTP_PADDRPARAMS_FL_OFFSET = 146
+)
+
+// SctpParams holds the tunable parameters of the SCTP association. Parameters
+// set to 0 retain the defaults of the kernel
+type SctpParams struct {
+	// Retransmission timeout values in milliseconds
+	RtoInitial uint32
+	RtoMin     uint32
+	RtoMax     uint32
+
+	MaxInitRetransmits uint16
+
+	// Heartbeat interval in milliseconds
+	HeartbeatInterval uint32
+
+	// Number of outbound streams and maximum number of inbound streams
+	NumStreams uint16
+
+	// Network interface to which the socket is bound, not bound when empty
+	BindToDevice string
+}
+
+// SctpAssocStats holds the kernel statistics of the SCTP association. The
+// smoothed RTT of the primary path is updated by the heartbeats while the
+// association is idle
+type SctpAssocStats struct {
+	// Smoothed RTT and RTO of the primary path in milliseconds
+	Srtt uint32
+	Rto  uint32
+
+	// Maximum RTO in milliseconds observed since the previous query
+	MaxRto uint64
+
+	// Count of the chunks retransmitted over the association
+	RtxChunks uint64
+}
+
+// sctpRtoInfo corresponds to struct sctp_rtoinfo
+type sctpRtoInfo struct {
+	AssocId uint32
+	Initial uint32
+	Max     uint32
+	Min     uint32
+}
+
 func getNgapIp(amfIP, ranIP string, amfPort, ranPort int) (amfAddr, ranAddr *sctp.SCTPAddr, err error) {
 	ips := []net.IPAddr{}
 	if ip, err1 := net.ResolveIPAddr("ip", amfIP); err1 != nil {
@@ -60,3 +134,193 @@ func ConnectToAmf(amfIP, ranIP string, amfPort, ranPort int) (*sctp.SCTPConn, er
 	}
 	return conn, nil
 }
+
+// ConnectToAmfMultihomed establishes an SCTP association between the provided
+// lists of local and remote addresses, and applies the provided parameters.
+// It also returns the socket of the association, through which its kernel
+// statistics are queried, and the number of outbound streams negotiated with
+// the AMF
+func ConnectToAmfMultihomed(amfIPs, ranIPs []string, amfPort, ranPort int,
+	params *SctpParams) (*sctp.SCTPConn, int, uint16, error) {
+
+	amfAddr, err := getSctpAddr(amfIPs, amfPort)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	ranAddr, err := getSctpAddr(ranIPs, ranPort)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if params == nil {
+		params = &SctpParams{}
+	}
+
+	af := syscall.AF_INET
+	if amfAddr.IPAddrs[0].IP.To4() == nil {
+		af = syscall.AF_INET6
+	}
+	for _, ranIP := range ranAddr.IPAddrs {
+		if (ranIP.IP.To4() == nil) != (af == syscall.AF_INET6) {
+			return nil, 0, 0, fmt.Errorf("address family of local address %v does not match amf address %v",
+				ranIP.IP, amfAddr.IPAddrs[0].IP)
+		}
+	}
+	fd, err := syscall.Socket(af, syscall.SOCK_STREAM, syscall.IPPROTO_SCTP)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to create socket: %v", err)
+	}
+
+	if params.BindToDevice != "" {
+		err = syscall.BindToDevice(fd, params.BindToDevice)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, 0, 0, fmt.Errorf("failed to bind to interface %v: %v",
+				params.BindToDevice, err)
+		}
+	}
+
+	err = setSctpParams(fd, params)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, 0, 0, err
+	}
+
+	if len(ranAddr.IPAddrs) != 0 {
+		err = sctp.SCTPBind(fd, ranAddr, sctp.SCTP_BINDX_ADD_ADDR)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, 0, 0, fmt.Errorf("failed to bind %v: %v", ranAddr, err)
+		}
+	}
+	_, err = sctp.SCTPConnect(fd, amfAddr)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, 0, 0, fmt.Errorf("failed to connect %v: %v", amfAddr, err)
+	}
+
+	outStreams, err := getSctpOutStreams(fd)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, 0, 0, fmt.Errorf("failed to fetch sctp status: %v", err)
+	}
+
+	conn := sctp.NewSCTPConn(fd, nil)
+	info, err := conn.GetDefaultSentParam()
+	if err != nil {
+		conn.Close()
+		return nil, 0, 0, err
+	}
+	info.PPID = NgapPPID
+	err = conn.SetDefaultSentParam(info)
+	if err != nil {
+		conn.Close()
+		return nil, 0, 0, err
+	}
+	return conn, fd, outStreams, nil
+}
+
+func getSctpAddr(ips []string, port int) (*sctp.SCTPAddr, error) {
+	addr := &sctp.SCTPAddr{Port: port}
+	for _, ip := range ips {
+		ipAddr, err := net.ResolveIPAddr("ip", ip)
+		if err != nil {
+			return nil, fmt.Errorf("Error resolving address '%s': %v", ip, err)
+		}
+		addr.IPAddrs = append(addr.IPAddrs, *ipAddr)
+	}
+	return addr, nil
+}
+
+// setSctpParams applies the parameters on the socket, before the association
+// is established so that they are effective for the INIT exchange as well
+func setSctpParams(fd int, params *SctpParams) error {
+	initMsg := sctp.InitMsg{
+		NumOstreams:  params.NumStreams,
+		MaxInstreams: params.NumStreams,
+		MaxAttempts:  params.MaxInitRetransmits,
+	}
+	err := setSockOpt(fd, sctp.SCTP_INITMSG, unsafe.Pointer(&initMsg),
+		unsafe.Sizeof(initMsg))
+	if err != nil {
+		return fmt.Errorf("failed to set sctp init parameters: %v", err)
+	}
+
+	rtoInfo := sctpRtoInfo{
+		Initial: params.RtoInitial,
+		Max:     params.RtoMax,
+		Min:     params.RtoMin,
+	}
+	err = setSockOpt(fd, SCTP_RTOINFO, unsafe.Pointer(&rtoInfo),
+		unsafe.Sizeof(rtoInfo))
+	if err != nil {
+		return fmt.Errorf("failed to set sctp rto parameters: %v", err)
+	}
+
+	if params.HeartbeatInterval != 0 {
+		// Host byte order, gnbsim is built for little endian platforms
+		var paddrParams [SCTP_PADDRPARAMS_LEN]byte
+		binary.LittleEndian.PutUint32(paddrParams[SCTP_PADDRPARAMS_HB_OFFSET:],
+			params.HeartbeatInterval)
+		binary.LittleEndian.PutUint32(paddrParams[SCTP_PADDRPARAMS_FL_OFFSET:],
+			SPP_HB_ENABLE)
+		err = setSockOpt(fd, SCTP_PEER_ADDR_PARAMS, unsafe.Pointer(&paddrParams[0]),
+			uintptr(len(paddrParams)))
+		if err != nil {
+			return fmt.Errorf("failed to set sctp heartbeat interval: %v", err)
+		}
+	}
+	return nil
+}
+
+func setSockOpt(fd, optName int, optVal unsafe.Pointer, optLen uintptr) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(fd),
+		syscall.IPPROTO_SCTP, uintptr(optName), uintptr(optVal), optLen, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func getSockOpt(fd, optName int, optVal []byte) error {
+	optLen := uint32(len(optVal))
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, uintptr(fd),
+		syscall.IPPROTO_SCTP, uintptr(optName), uintptr(unsafe.Pointer(&optVal[0])),
+		uintptr(unsafe.Pointer(&optLen)), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func getSctpOutStreams(fd int) (uint16, error) {
+	var status [SCTP_STATUS_LEN]byte
+	err := getSockOpt(fd, SCTP_STATUS, status[:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(status[SCTP_STATUS_OUTSTRMS_OFFSET:]), nil
+}
+
+// GetSctpAssocStats queries the kernel statistics of the SCTP association on
+// the provided socket. Querying resets the maximum observed RTO
+func GetSctpAssocStats(fd int) (*SctpAssocStats, error) {
+	var status [SCTP_STATUS_LEN]byte
+	err := getSockOpt(fd, SCTP_STATUS, status[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sctp status: %v", err)
+	}
+
+	// The association ID is ignored for the one-to-one style sockets
+	var assocStats [SCTP_ASSOC_STATS_LEN]byte
+	err = getSockOpt(fd, SCTP_GET_ASSOC_STATS, assocStats[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sctp association stats: %v", err)
+	}
+
+	return &SctpAssocStats{
+		Srtt:      binary.LittleEndian.Uint32(status[SCTP_STATUS_SRTT_OFFSET:]),
+		Rto:       binary.LittleEndian.Uint32(status[SCTP_STATUS_RTO_OFFSET:]),
+		MaxRto:    binary.LittleEndian.Uint64(assocStats[SCTP_ASSOC_STATS_MAXRTO_OFFSET:]),
+		RtxChunks: binary.LittleEndian.Uint64(assocStats[SCTP_ASSOC_STATS_RTX_OFFSET:]),
+	}, nil
+}
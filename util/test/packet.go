@@ -36,6 +36,11 @@ func GetUplinkNASTransport(amfUeNgapID, ranUeNgapID int64, nasPdu []byte) ([]byt
 	return ngap.Encoder(message)
 }
 
+func GetDownlinkNASTransport(amfUeNgapID, ranUeNgapID int64, nasPdu []byte) ([]byte, error) {
+	message := ngapTestpacket.BuildDownlinkNasTransport(amfUeNgapID, ranUeNgapID, nasPdu)
+	return ngap.Encoder(message)
+}
+
 func GetInitialContextSetupResponse(amfUeNgapID int64, ranUeNgapID int64) ([]byte, error) {
 	message := ngapTestpacket.BuildInitialContextSetupResponseForRegistraionTest(amfUeNgapID, ranUeNgapID)
 